@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"www.theskyscape.com/internal/hosting"
+	"www.theskyscape.com/internal/retention"
+	"www.theskyscape.com/internal/tracing"
+	"www.theskyscape.com/models"
+)
+
+func Admin() (string, *AdminController) {
+	return "admin", &AdminController{}
+}
+
+type AdminController struct {
+	application.Controller
+}
+
+func (c *AdminController) Setup(app *application.App) {
+	c.Controller.Setup(app)
+	auth := c.Use("auth").(*AuthController)
+
+	route("GET /admin", c.Serve("admin.html", auth.AdminRequired))
+	route("GET /admin/fleet", c.Serve("admin-fleet.html", auth.AdminRequired))
+	route("POST /admin/build/{image}/cancel", c.ProtectFunc(c.cancelBuild, auth.AdminRequired))
+	route("POST /admin/project/{project}/restart", c.ProtectFunc(c.restartProject, auth.AdminRequired))
+
+	// Purge deleted content and prune tables past their retention
+	go retention.Run(time.Hour)
+}
+
+func (c AdminController) Handle(r *http.Request) application.Handler {
+	c.Request = r
+	return &c
+}
+
+// DashboardDays is how many days of history the dashboard charts
+const DashboardDays = 14
+
+// EmailDelivery summarizes outgoing email and delivery problems over the
+// dashboard's window
+func (c *AdminController) EmailDelivery() *models.EmailDelivery {
+	return models.EmailDeliveryFor(DashboardDays)
+}
+
+// Retention returns each table's retention policy and what pruning it has
+// deleted since the server started
+func (c *AdminController) Retention() []retention.Result {
+	return retention.Stats()
+}
+
+// Snapshots returns daily metrics for the dashboard, oldest first
+func (c *AdminController) Snapshots() []*models.MetricSnapshot {
+	return models.RecentSnapshots(DashboardDays)
+}
+
+// Totals sums the given snapshots into a single snapshot
+func (c *AdminController) Totals(snapshots []*models.MetricSnapshot) *models.MetricSnapshot {
+	totals := &models.MetricSnapshot{}
+	for _, s := range snapshots {
+		totals.Signups += s.Signups
+		totals.ActiveUsers += s.ActiveUsers
+		totals.Posts += s.Posts
+		totals.Builds += s.Builds
+		totals.FailedBuilds += s.FailedBuilds
+		totals.Revenue += s.Revenue
+	}
+	return totals
+}
+
+// TotalUsers returns the number of registered users
+func (c *AdminController) TotalUsers() int {
+	return models.Auth.Users.Count("")
+}
+
+// TopProjects returns the most starred live projects
+func (c *AdminController) TopProjects() []*models.Project {
+	projects, _ := models.Projects.Search(`
+		WHERE Status != 'shutdown'
+		ORDER BY projects.StarTotal DESC
+		LIMIT 10
+	`)
+	return projects
+}
+
+// RecentFailedBuilds returns the latest failed builds for triage
+func (c *AdminController) RecentFailedBuilds() []*models.Image {
+	images, _ := models.Images.Search(`
+		WHERE Status = 'failed'
+		ORDER BY CreatedAt DESC
+		LIMIT 10
+	`)
+	return images
+}
+
+// RunningBuilds returns images currently being built, oldest first so stuck
+// builds surface at the top
+func (c *AdminController) RunningBuilds() []*models.Image {
+	images, _ := models.Images.Search(`
+		WHERE Status = 'building'
+		ORDER BY CreatedAt ASC
+	`)
+	return images
+}
+
+// StuckBuildsCount returns how many builds have exceeded the stuck threshold
+func (c *AdminController) StuckBuildsCount() int {
+	return models.Images.Count("WHERE Status = 'building' AND CreatedAt < ?", time.Now().Add(-models.StuckBuildAfter))
+}
+
+// Containers returns the latest metrics for every live container, heaviest
+// memory users first
+func (c *AdminController) Containers() []*models.AppMetrics {
+	metrics, _ := models.AppMetricsManager.Search(`
+		WHERE ContainerStatus != ''
+		ORDER BY MemoryUsedMB DESC, CPUUsagePercent DESC
+	`)
+	return metrics
+}
+
+func (c *AdminController) cancelBuild(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	admin, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	img, err := models.Images.Get(r.PathValue("image"))
+	if err != nil {
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
+		return
+	}
+
+	if err = hosting.CancelBuild(img, "Cancelled by an administrator"); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	// Unblock the project so the owner can launch again
+	if project := img.Project(); project != nil && project.Status == "launching" {
+		project.Status = "draft"
+		project.Error = img.Error
+		models.Projects.Update(project)
+	}
+
+	slog.InfoContext(r.Context(), "admin cancelled build", "admin", admin.Handle, "image_id", img.ID, "entity_id", img.EntityID())
+	auth.audit(r, admin.ID, models.AuditBuildCancelled, "image", img.ID, img.EntityID())
+	c.Refresh(w, r)
+}
+
+func (c *AdminController) restartProject(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	admin, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	project, err := models.Projects.Get(r.PathValue("project"))
+	if err != nil {
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
+		return
+	}
+
+	if project.Status == "suspended" || project.Status == "removed" || project.Status == "shutdown" {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("project is "+project.Status)))
+		return
+	}
+
+	slog.InfoContext(r.Context(), "admin restarted project", "admin", admin.Handle, "project_id", project.ID)
+	auth.audit(r, admin.ID, models.AuditProjectRestarted, "project", project.ID, "")
+
+	// Rebuilding pushes a fresh image, which redeploys the container
+	go func() {
+		project.Status = "launching"
+		project.Error = ""
+		models.Projects.Update(project)
+
+		if _, err := hosting.BuildProject(tracing.Detach(r.Context()), project); err != nil {
+			project.Status = "draft"
+			project.Error = err.Error()
+			models.Projects.Update(project)
+			return
+		}
+
+		project.Status = "online"
+		project.Error = ""
+		models.Projects.Update(project)
+	}()
+
+	time.Sleep(time.Millisecond * 250)
+	c.Refresh(w, r)
+}
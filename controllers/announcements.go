@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"www.theskyscape.com/models"
+)
+
+// dismissedCookie stores the IDs of announcements the visitor has closed
+const dismissedCookie = "dismissed_announcements"
+
+func Announcements() (string, *AnnouncementsController) {
+	return "announcements", &AnnouncementsController{}
+}
+
+type AnnouncementsController struct {
+	application.Controller
+}
+
+func (c *AnnouncementsController) Setup(app *application.App) {
+	c.Controller.Setup(app)
+	auth := c.Use("auth").(*AuthController)
+
+	route("POST /announcement/{announcement}/dismiss", c.ProtectFunc(c.dismiss, auth.Optional))
+
+	route("GET /admin/announcements", c.Serve("admin-announcements.html", auth.AdminRequired))
+	route("POST /admin/announcements", c.ProtectFunc(c.create, auth.AdminRequired))
+	route("DELETE /admin/announcement/{announcement}", c.ProtectFunc(c.delete, auth.AdminRequired))
+}
+
+func (c AnnouncementsController) Handle(r *http.Request) application.Handler {
+	c.Request = r
+	return &c
+}
+
+// Active returns the live announcements for the current visitor, skipping
+// ones outside their audience or already dismissed
+func (c *AnnouncementsController) Active() []*models.Announcement {
+	auth := c.Use("auth").(*AuthController)
+	user, _, _ := auth.Authenticate(c.Request)
+	dismissed := c.dismissed(c.Request)
+
+	var active []*models.Announcement
+	for _, a := range models.LiveAnnouncements() {
+		if a.IsVisibleTo(user) && !slices.Contains(dismissed, a.ID) {
+			active = append(active, a)
+		}
+	}
+	return active
+}
+
+// All returns every announcement for the admin page
+func (c *AnnouncementsController) All() []*models.Announcement {
+	announcements, _ := models.Announcements.Search(`
+		ORDER BY StartsAt DESC
+		LIMIT 100
+	`)
+	return announcements
+}
+
+func (c *AnnouncementsController) dismissed(r *http.Request) []string {
+	cookie, err := r.Cookie(dismissedCookie)
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+	return strings.Split(cookie.Value, ".")
+}
+
+func (c *AnnouncementsController) dismiss(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("announcement")
+	if _, err := models.Announcements.Get(id); err != nil {
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
+		return
+	}
+
+	// Keep only IDs that are still live so the cookie doesn't grow forever
+	ids := []string{id}
+	for _, existing := range c.dismissed(r) {
+		if a, err := models.Announcements.Get(existing); err == nil && a.IsLive() && existing != id {
+			ids = append(ids, existing)
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     dismissedCookie,
+		Value:    strings.Join(ids, "."),
+		Path:     "/",
+		MaxAge:   int((90 * 24 * time.Hour).Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *AnnouncementsController) create(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	admin, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	message := strings.TrimSpace(r.FormValue("message"))
+	if message == "" {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("message is required")))
+		return
+	}
+
+	level := r.FormValue("level")
+	if level != "info" && level != "warning" && level != "success" {
+		level = "info"
+	}
+
+	audience := r.FormValue("audience")
+	if audience != models.AudienceSignedIn && audience != models.AudienceVerified {
+		audience = models.AudienceAll
+	}
+
+	link := strings.TrimSpace(r.FormValue("link"))
+	if link != "" && !strings.HasPrefix(link, "/") && !strings.HasPrefix(link, "https://") {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("link must be a path or https URL")))
+		return
+	}
+
+	startsAt := time.Now()
+	if v := r.FormValue("starts_at"); v != "" {
+		if startsAt, err = parseLocalTime(v); err != nil {
+			c.Render(w, r, "error-message.html", localize(r, errors.New("invalid start time")))
+			return
+		}
+	}
+
+	var endsAt time.Time
+	if v := r.FormValue("ends_at"); v != "" {
+		if endsAt, err = parseLocalTime(v); err != nil {
+			c.Render(w, r, "error-message.html", localize(r, errors.New("invalid end time")))
+			return
+		}
+		if !endsAt.After(startsAt) {
+			c.Render(w, r, "error-message.html", localize(r, errors.New("end time must be after start time")))
+			return
+		}
+	}
+
+	_, err = models.Announcements.Insert(&models.Announcement{
+		CreatedBy: admin.ID,
+		Message:   message,
+		Link:      link,
+		Level:     level,
+		Audience:  audience,
+		StartsAt:  startsAt,
+		EndsAt:    endsAt,
+	})
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+func (c *AnnouncementsController) delete(w http.ResponseWriter, r *http.Request) {
+	a, err := models.Announcements.Get(r.PathValue("announcement"))
+	if err != nil {
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
+		return
+	}
+
+	if err = models.Announcements.Delete(a); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+// parseLocalTime parses a datetime-local input in the app's timezone, the
+// same zone the format template func displays times in
+func parseLocalTime(value string) (time.Time, error) {
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		loc = time.UTC
+	}
+	return time.ParseInLocation("2006-01-02T15:04", value, loc)
+}
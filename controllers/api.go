@@ -1,11 +1,19 @@
 package controllers
 
 import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/The-Skyscape/devtools/pkg/application"
+	"www.theskyscape.com/internal/hosting"
 	"www.theskyscape.com/internal/security"
+	"www.theskyscape.com/internal/tracing"
 	"www.theskyscape.com/models"
 )
 
@@ -19,22 +27,60 @@ type APIController struct {
 
 func (c *APIController) Setup(app *application.App) {
 	c.Controller.Setup(app)
+	auth := c.Use("auth").(*AuthController)
 
 	// User endpoints
-	http.Handle("GET /api/user", c.ProtectFunc(c.getUser, security.RequireScopes("user:read")))
-	http.Handle("GET /api/profile", c.ProtectFunc(c.getProfile, security.RequireScopes("user:read")))
+	route("GET /api/user", c.ProtectFunc(apiLimit("user:read").WrapFunc(conditional(c.getUser)), security.RequireScopes("user:read")))
+	route("GET /api/profile", c.ProtectFunc(apiLimit("user:read").WrapFunc(conditional(c.getProfile)), security.RequireScopes("user:read")))
 
 	// Repo endpoints
-	http.Handle("GET /api/repos", c.ProtectFunc(c.getRepos, security.RequireScopes("repo:read")))
-	http.Handle("GET /api/repos/{id}", c.ProtectFunc(c.getRepo, security.RequireScopes("repo:read")))
+	route("GET /api/repos", c.ProtectFunc(apiLimit("repo:read").WrapFunc(conditional(c.getRepos)), security.RequireScopes("repo:read")))
+	route("GET /api/repos/{id}", c.ProtectFunc(apiLimit("repo:read").WrapFunc(conditional(c.getRepo)), security.RequireScopes("repo:read")))
+	route("POST /api/repos", withScopes(c.createRepo, "repo:write"))
 
 	// App endpoints
-	http.Handle("GET /api/apps", c.ProtectFunc(c.getApps, security.RequireScopes("app:read")))
-	http.Handle("GET /api/apps/{id}", c.ProtectFunc(c.getApp, security.RequireScopes("app:read")))
+	route("GET /api/apps", c.ProtectFunc(apiLimit("app:read").WrapFunc(conditional(c.getApps)), security.RequireScopes("app:read")))
+	route("GET /api/apps/{id}", c.ProtectFunc(apiLimit("app:read").WrapFunc(conditional(c.getApp)), security.RequireScopes("app:read")))
+	route("POST /api/apps/{id}/builds", withScopes(c.createAppBuild, "app:write"))
+
+	// Post and feed endpoints
+	route("GET /api/feed", c.ProtectFunc(apiLimit("post:read").WrapFunc(conditional(c.getFeed)), security.RequireScopes("post:read")))
+	route("GET /api/activities/{id}", c.ProtectFunc(apiLimit("post:read").WrapFunc(conditional(c.getActivity)), security.RequireScopes("post:read")))
+	route("POST /api/posts", withScopes(c.createPost, "post:write"))
+
+	// Thought endpoints, all under thought:write since they include drafts
+	route("GET /api/thoughts", c.ProtectFunc(apiLimit("thought:write").WrapFunc(conditional(c.getThoughts)), security.RequireScopes("thought:write")))
+	route("GET /api/thoughts/{id}", c.ProtectFunc(apiLimit("thought:write").WrapFunc(conditional(c.getThought)), security.RequireScopes("thought:write")))
+	route("POST /api/thoughts", withScopes(c.createThought, "thought:write"))
+	route("PUT /api/thoughts/{id}/blocks", withScopes(c.updateThoughtBlocks, "thought:write"))
+	route("POST /api/thoughts/{id}/publish", withScopes(c.publishThought, "thought:write"))
+
+	// Message endpoints, all under message:write since reading is private too
+	route("GET /api/messages", c.ProtectFunc(apiLimit("message:write").WrapFunc(conditional(c.getConversations)), security.RequireScopes("message:write")))
+	route("GET /api/messages/{user}", c.ProtectFunc(apiLimit("message:write").WrapFunc(conditional(c.getConversation)), security.RequireScopes("message:write")))
+	route("POST /api/messages/{user}", withScopes(c.sendMessage, "message:write"))
 
 	// Follow endpoints
-	http.Handle("GET /api/followers", c.ProtectFunc(c.getFollowers, security.RequireScopes("follow:read")))
-	http.Handle("GET /api/following", c.ProtectFunc(c.getFollowing, security.RequireScopes("follow:read")))
+	route("GET /api/followers", c.ProtectFunc(apiLimit("follow:read").WrapFunc(conditional(c.getFollowers)), security.RequireScopes("follow:read")))
+	route("GET /api/following", c.ProtectFunc(apiLimit("follow:read").WrapFunc(conditional(c.getFollowing)), security.RequireScopes("follow:read")))
+
+	// Deploy and build endpoints, authorized by a project deploy token or
+	// the CLI's project:deploy scope. /deploy is an alias of /deploys.
+	route("POST /api/projects/{id}/deploys", apiLimit("project:deploy").WrapFunc(c.createDeploy))
+	route("POST /api/projects/{id}/deploy", apiLimit("project:deploy").WrapFunc(c.createDeploy))
+	route("GET /api/projects/{id}/builds", apiLimit("project:builds").WrapFunc(conditional(c.getBuilds)))
+	route("GET /api/projects/{id}/builds/{build}", apiLimit("project:builds").WrapFunc(conditional(c.getBuild)))
+	route("GET /api/projects/{id}/builds/{build}/events", apiLimit("project:builds").WrapFunc(c.streamBuild))
+
+	// Service endpoints, authorized by a project's service token so its
+	// backend can act as the project rather than as a user. Notifications
+	// also accept an app's OAuth client credentials.
+	route("GET /api/service/users", apiLimit("service").WrapFunc(conditional(c.getServiceUsers)))
+	route("POST /api/service/notifications", apiLimit("service").WrapFunc(c.sendServiceNotification))
+
+	// Documentation, generated from apiOperations in controllers/openapi.go
+	route("GET /api/openapi.json", apiLimit("docs").WrapFunc(conditional(c.openAPI)))
+	route("GET /api/docs", c.Serve("api-docs.html", auth.Optional))
 }
 
 func (c APIController) Handle(r *http.Request) application.Handler {
@@ -88,6 +134,20 @@ type AppResponse struct {
 	UpdatedAt   time.Time     `json:"updated_at"`
 }
 
+type DeployResponse struct {
+	ID         string     `json:"id"`
+	ProjectID  string     `json:"project_id"`
+	GitHash    string     `json:"git_hash"`
+	Status     string     `json:"status"`                // "building", then "ready" or "failed"
+	Error      string     `json:"error,omitempty"`       // Build output when it failed
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"` // When it became ready or failed
+}
+
+type DeployRequest struct {
+	Ref string `json:"ref"` // Branch, tag or commit, main by default
+}
+
 type FollowResponse struct {
 	ID        string        `json:"id"`
 	User      *UserResponse `json:"user"`
@@ -179,6 +239,7 @@ func (c *APIController) getUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setLastModified(w, user.UpdatedAt)
 	JSON(w, http.StatusOK, &UserResponse{
 		ID:     user.ID,
 		Handle: user.Handle,
@@ -200,6 +261,7 @@ func (c *APIController) getProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setLastModified(w, user.UpdatedAt, profile.UpdatedAt)
 	JSON(w, http.StatusOK, &ProfileResponse{
 		ID:             profile.ID,
 		Handle:         user.Handle,
@@ -222,18 +284,24 @@ func (c *APIController) getRepos(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before, args, limit := ParseAPIPage(r, "")
 	repos, err := models.Repos.Search(`
-		WHERE OwnerID = ?
-		ORDER BY CreatedAt DESC
-	`, user.ID)
+		WHERE OwnerID = ? AND `+before+`
+		ORDER BY CreatedAt DESC, ID DESC
+		LIMIT ?
+	`, append(append([]any{user.ID}, args...), limit)...)
 	if err != nil {
 		JSONError(w, http.StatusInternalServerError, "failed to fetch repos")
 		return
 	}
+	if n := len(repos); n > 0 {
+		SetNextCursor(w, r, n, limit, repos[n-1].CreatedAt, repos[n-1].ID)
+	}
 
 	response := make([]*RepoResponse, 0, len(repos))
 	for _, repo := range repos {
 		response = append(response, repoToResponse(repo))
+		setLastModified(w, repo.UpdatedAt)
 	}
 
 	JSON(w, http.StatusOK, response)
@@ -259,6 +327,7 @@ func (c *APIController) getRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setLastModified(w, repo.UpdatedAt)
 	JSON(w, http.StatusOK, repoToResponse(repo))
 }
 
@@ -269,19 +338,25 @@ func (c *APIController) getApps(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before, args, limit := ParseAPIPage(r, "apps.")
 	apps, err := models.Apps.Search(`
 		JOIN repos ON repos.ID = apps.RepoID
-		WHERE repos.OwnerID = ? AND apps.Status != 'shutdown'
-		ORDER BY apps.CreatedAt DESC
-	`, user.ID)
+		WHERE repos.OwnerID = ? AND apps.Status != 'shutdown' AND `+before+`
+		ORDER BY apps.CreatedAt DESC, apps.ID DESC
+		LIMIT ?
+	`, append(append([]any{user.ID}, args...), limit)...)
 	if err != nil {
 		JSONError(w, http.StatusInternalServerError, "failed to fetch apps")
 		return
 	}
+	if n := len(apps); n > 0 {
+		SetNextCursor(w, r, n, limit, apps[n-1].CreatedAt, apps[n-1].ID)
+	}
 
 	response := make([]*AppResponse, 0, len(apps))
 	for _, app := range apps {
 		response = append(response, appToResponse(app))
+		setLastModified(w, app.UpdatedAt)
 	}
 
 	JSON(w, http.StatusOK, response)
@@ -308,6 +383,7 @@ func (c *APIController) getApp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setLastModified(w, app.UpdatedAt)
 	JSON(w, http.StatusOK, appToResponse(app))
 }
 
@@ -318,19 +394,25 @@ func (c *APIController) getFollowers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before, args, limit := ParseAPIPage(r, "")
 	followers, err := models.Follows.Search(`
-		WHERE FolloweeID = ?
-		ORDER BY CreatedAt DESC
-	`, user.ID)
+		WHERE FolloweeID = ? AND `+before+`
+		ORDER BY CreatedAt DESC, ID DESC
+		LIMIT ?
+	`, append(append([]any{user.ID}, args...), limit)...)
 	if err != nil {
 		JSONError(w, http.StatusInternalServerError, "failed to fetch followers")
 		return
 	}
+	if n := len(followers); n > 0 {
+		SetNextCursor(w, r, n, limit, followers[n-1].CreatedAt, followers[n-1].ID)
+	}
 
 	response := make([]*FollowResponse, 0, len(followers))
 	for _, follow := range followers {
 		profile := follow.Follower()
 		response = append(response, followToResponse(follow, profile))
+		setLastModified(w, follow.UpdatedAt)
 	}
 
 	JSON(w, http.StatusOK, response)
@@ -343,20 +425,125 @@ func (c *APIController) getFollowing(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before, args, limit := ParseAPIPage(r, "")
 	following, err := models.Follows.Search(`
-		WHERE FollowerID = ?
-		ORDER BY CreatedAt DESC
-	`, user.ID)
+		WHERE FollowerID = ? AND `+before+`
+		ORDER BY CreatedAt DESC, ID DESC
+		LIMIT ?
+	`, append(append([]any{user.ID}, args...), limit)...)
 	if err != nil {
 		JSONError(w, http.StatusInternalServerError, "failed to fetch following")
 		return
 	}
+	if n := len(following); n > 0 {
+		SetNextCursor(w, r, n, limit, following[n-1].CreatedAt, following[n-1].ID)
+	}
 
 	response := make([]*FollowResponse, 0, len(following))
 	for _, follow := range following {
 		profile := follow.Followee()
 		response = append(response, followToResponse(follow, profile))
+		setLastModified(w, follow.UpdatedAt)
 	}
 
 	JSON(w, http.StatusOK, response)
 }
+
+// maxDeployArchive bounds the size of an uploaded source tarball
+const maxDeployArchive = 100 << 20
+
+// createDeploy builds a project from a ref of its repo, or from a source
+// tarball uploaded as the request body, and deploys the result
+func (c *APIController) createDeploy(w http.ResponseWriter, r *http.Request) {
+	project, deployer, token, ok := deployProject(w, r)
+	if !ok {
+		return
+	}
+
+	if project.Status == "shutdown" || project.Takedown() != nil || models.ActiveSuspension(project.OwnerID) != nil {
+		JSONError(w, http.StatusForbidden, "project cannot be deployed")
+		return
+	}
+
+	allowed, _, err := models.Check(deployer, "deploy", 30, time.Hour)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "failed to check rate limit")
+		return
+	}
+	if !allowed {
+		JSONError(w, http.StatusTooManyRequests, "too many deploys, try again later")
+		return
+	}
+	models.Record(deployer, "deploy", time.Hour)
+
+	var src hosting.Source
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/gzip", "application/x-gzip", "application/x-tar+gzip":
+		if src.Archive, err = saveDeployArchive(w, r); err != nil {
+			JSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	case "application/json":
+		var body DeployRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&body); err != nil {
+			JSONError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		src.Ref = body.Ref
+	default:
+		src.Ref = r.FormValue("ref")
+	}
+
+	previous := project.Status
+	project.Status = "launching"
+	project.Error = ""
+	models.Projects.Update(project)
+
+	img, err := hosting.DeployProject(tracing.Detach(r.Context()), project, src, func(err error) {
+		if src.Archive != "" {
+			os.Remove(src.Archive)
+		}
+		if err != nil {
+			project.Error = err.Error()
+			models.Projects.Update(project)
+			slog.Error("deploy build failed", "project_id", project.ID, "error", err)
+			return
+		}
+		project.Status = "online"
+		project.Error = ""
+		models.Projects.Update(project)
+	})
+	if err != nil {
+		if src.Archive != "" {
+			os.Remove(src.Archive)
+		}
+		project.Status = previous
+		models.Projects.Update(project)
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if token != nil {
+		token.LastUsedAt = time.Now()
+		models.DeployTokens.Update(token)
+	}
+	slog.InfoContext(r.Context(), "deploy triggered", "project_id", project.ID, "deployer", deployer, "git_hash", img.GitHash)
+
+	JSON(w, http.StatusAccepted, imageToDeployResponse(img))
+}
+
+// saveDeployArchive writes an uploaded tarball to a temporary file
+func saveDeployArchive(w http.ResponseWriter, r *http.Request) (string, error) {
+	f, err := os.CreateTemp("", "deploy-*.tar.gz")
+	if err != nil {
+		return "", errors.New("failed to store archive")
+	}
+	defer f.Close()
+
+	if _, err = io.Copy(f, http.MaxBytesReader(w, r.Body, maxDeployArchive)); err != nil {
+		os.Remove(f.Name())
+		return "", errors.New("archive too large, max 100MB")
+	}
+	return f.Name(), nil
+}
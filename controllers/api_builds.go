@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"www.theskyscape.com/internal/events"
+	"www.theskyscape.com/internal/security"
+	"www.theskyscape.com/models"
+)
+
+const (
+	// defaultBuildsLimit is the page size of a project's builds when the
+	// client doesn't pick one
+	defaultBuildsLimit = 20
+
+	// buildPollInterval is how often a build stream rereads the build, for
+	// changes published on another server process, and keeps the stream
+	// alive while nothing changes
+	buildPollInterval = 15 * time.Second
+)
+
+func imageToDeployResponse(img *models.Image) *DeployResponse {
+	response := &DeployResponse{
+		ID:        img.ID,
+		ProjectID: img.ProjectID,
+		GitHash:   img.GitHash,
+		Status:    img.Status,
+		Error:     img.Error,
+		CreatedAt: img.CreatedAt,
+	}
+	if !img.IsBuilding() {
+		response.FinishedAt = &img.UpdatedAt
+	}
+	return response
+}
+
+// getBuilds lists a project's builds, newest first, so CI can find the one
+// its deploy started and see how earlier ones went
+func (c *APIController) getBuilds(w http.ResponseWriter, r *http.Request) {
+	project, _, _, ok := deployProject(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	limit := ParseLimit(query, defaultBuildsLimit)
+	before, args := ParseCursor(query).Before("")
+	images, err := models.Images.Search(`
+		WHERE ProjectID = ? AND `+before+`
+		ORDER BY CreatedAt DESC, ID DESC
+		LIMIT ?
+	`, append(append([]any{project.ID}, args...), limit)...)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "failed to fetch builds")
+		return
+	}
+	if n := len(images); n > 0 {
+		SetNextCursor(w, r, n, limit, images[n-1].CreatedAt, images[n-1].ID)
+	}
+
+	response := make([]*DeployResponse, 0, len(images))
+	for _, img := range images {
+		response = append(response, imageToDeployResponse(img))
+		setLastModified(w, img.UpdatedAt)
+	}
+
+	JSON(w, http.StatusOK, response)
+}
+
+// getBuild returns one of a project's builds, for CI polling until its
+// status leaves "building"
+func (c *APIController) getBuild(w http.ResponseWriter, r *http.Request) {
+	_, img, ok := projectBuild(w, r)
+	if !ok {
+		return
+	}
+
+	setLastModified(w, img.UpdatedAt)
+	JSON(w, http.StatusOK, imageToDeployResponse(img))
+}
+
+// streamBuild sends a build's status as Server-Sent "build" events: once
+// when the stream opens and again on each change, closing after it's ready
+// or failed, or once it's been building longer than models.StuckBuildAfter
+func (c *APIController) streamBuild(w http.ResponseWriter, r *http.Request) {
+	project, img, ok := projectBuild(w, r)
+	if !ok {
+		return
+	}
+
+	// Subscribe before rereading, so a change in between isn't missed
+	changes, stop := events.Subscribe(project.OwnerID)
+	defer stop()
+
+	rc, err := events.Start(w)
+	if err != nil {
+		return
+	}
+
+	poll := time.NewTicker(buildPollInterval)
+	defer poll.Stop()
+
+	sent := ""
+	for {
+		if img, err = models.Images.Get(img.ID); err != nil {
+			return
+		}
+		if img.Status != sent {
+			event := events.Event{Kind: events.Build, Data: imageToDeployResponse(img)}
+			if err := events.Write(w, rc, event); err != nil {
+				return
+			}
+			sent = img.Status
+		} else if err := events.Keepalive(w, rc); err != nil {
+			return
+		}
+		if !img.IsBuilding() || img.IsStuck() {
+			return
+		}
+
+		// Wait for news of this build, skipping the owner's other events
+	wait:
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-poll.C:
+				break wait
+			case event := <-changes:
+				if event.Kind == events.Build && publishedFor(event, img.ID) {
+					break wait
+				}
+			}
+		}
+	}
+}
+
+// publishedFor reports whether a build event is about an image
+func publishedFor(event events.Event, imageID string) bool {
+	data, ok := event.Data.(map[string]string)
+	return ok && data["image"] == imageID
+}
+
+// deployProject loads the project in the path and checks the request may
+// deploy it and read its builds, answering the request otherwise. CI uses
+// one of the project's deploy tokens; the CLI signs in as the owner with
+// the device flow and uses project:deploy. It returns who's deploying and
+// the deploy token, if one was used.
+func deployProject(w http.ResponseWriter, r *http.Request) (*models.Project, string, *models.DeployToken, bool) {
+	project, err := models.Projects.Get(r.PathValue("id"))
+	if err != nil {
+		JSONError(w, http.StatusNotFound, "project not found")
+		return nil, "", nil, false
+	}
+
+	token, err := security.ParseDeployToken(r)
+	if err == nil {
+		if token.ProjectID != project.ID {
+			JSONError(w, http.StatusNotFound, "project not found")
+			return nil, "", nil, false
+		}
+		return project, token.ID, token, true
+	}
+
+	if user, scopes, userErr := security.ParseAccessToken(r); userErr == nil && slices.Contains(scopes, "project:deploy") {
+		if user.ID != project.OwnerID {
+			JSONError(w, http.StatusNotFound, "project not found")
+			return nil, "", nil, false
+		}
+		return project, user.ID, nil, true
+	}
+
+	JSONError(w, http.StatusUnauthorized, err.Error())
+	return nil, "", nil, false
+}
+
+// projectBuild loads the build in the path if it's of the project in the
+// path and the request may read it, answering the request otherwise
+func projectBuild(w http.ResponseWriter, r *http.Request) (*models.Project, *models.Image, bool) {
+	project, _, _, ok := deployProject(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	img, err := models.Images.Get(r.PathValue("build"))
+	if err != nil || img.ProjectID != project.ID {
+		JSONError(w, http.StatusNotFound, "build not found")
+		return nil, nil, false
+	}
+	return project, img, true
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"www.theskyscape.com/internal/security"
+	"www.theskyscape.com/models"
+)
+
+// defaultFeedLimit is the feed page size when the client doesn't pick one.
+// Unlike other lists the feed is never returned whole.
+const defaultFeedLimit = 20
+
+type ActivityResponse struct {
+	ID           string         `json:"id"`
+	Action       string         `json:"action"` // "posted", "pushed", "deployed", "starred", ...
+	Content      string         `json:"content"`
+	Visibility   string         `json:"visibility"`
+	SubjectType  string         `json:"subject_type,omitempty"` // What the activity is about, e.g. "repo"
+	SubjectID    string         `json:"subject_id,omitempty"`
+	User         *UserResponse  `json:"user"`
+	CommentCount int            `json:"comment_count"`
+	Reactions    map[string]int `json:"reactions"` // Count by emoji
+	URL          string         `json:"url"`
+	CreatedAt    time.Time      `json:"created_at"`
+}
+
+func activityToResponse(a *models.Activity) *ActivityResponse {
+	visibility := a.Visibility
+	if visibility == "" {
+		visibility = models.PostPublic
+	}
+	return &ActivityResponse{
+		ID:           a.ID,
+		Action:       a.Action,
+		Content:      a.Content,
+		Visibility:   visibility,
+		SubjectType:  a.SubjectType,
+		SubjectID:    a.SubjectID,
+		User:         userToResponse(a.UserProfile()),
+		CommentCount: a.CommentsCount(),
+		Reactions:    a.ReactionCounts(),
+		URL:          "/post/" + a.ID,
+		CreatedAt:    a.CreatedAt,
+	}
+}
+
+// getFeed returns a page of the user's home feed, the same activities the
+// signed in feed shows them. Taken down activities are left out.
+func (c *APIController) getFeed(w http.ResponseWriter, r *http.Request) {
+	user := security.UserFromContext(r)
+	if user == nil {
+		JSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	response := []*ActivityResponse{}
+	profile, err := models.Profiles.First("WHERE UserID = ?", user.ID)
+	if err != nil || profile == nil {
+		JSON(w, http.StatusOK, response)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := ParseLimit(query, defaultFeedLimit)
+	activities := profile.HomeFeed(ParseCursor(query), limit, 0)
+	models.PreloadActivities(r.Context(), activities)
+	if n := len(activities); n > 0 {
+		SetNextCursor(w, r, n, limit, activities[n-1].CreatedAt, activities[n-1].ID)
+	}
+
+	for _, activity := range activities {
+		if activity.Takedown() == nil {
+			response = append(response, activityToResponse(activity))
+			setLastModified(w, activity.UpdatedAt)
+		}
+	}
+
+	JSON(w, http.StatusOK, response)
+}
+
+// getActivity returns an activity the user can see
+func (c *APIController) getActivity(w http.ResponseWriter, r *http.Request) {
+	user := security.UserFromContext(r)
+	if user == nil {
+		JSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	activity, err := models.Activities.Get(r.PathValue("id"))
+	if err != nil || activity.IsDeleted() || !activity.VisibleTo(user.ID) || activity.Takedown() != nil {
+		JSONError(w, http.StatusNotFound, "activity not found")
+		return
+	}
+	if author := activity.UserProfile(); author == nil || author.Suspended {
+		JSONError(w, http.StatusNotFound, "activity not found")
+		return
+	}
+
+	setLastModified(w, activity.UpdatedAt)
+	JSON(w, http.StatusOK, activityToResponse(activity))
+}
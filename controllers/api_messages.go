@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"www.theskyscape.com/internal/clientip"
+	"www.theskyscape.com/internal/security"
+	"www.theskyscape.com/models"
+)
+
+// defaultMessagesLimit is the page size of a conversation when the client
+// doesn't pick one, as on the web
+const defaultMessagesLimit = 20
+
+type MessageResponse struct {
+	ID          string    `json:"id"`
+	SenderID    string    `json:"sender_id"`
+	RecipientID string    `json:"recipient_id"`
+	Content     string    `json:"content"`
+	Read        bool      `json:"read"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type ConversationResponse struct {
+	User        *UserResponse    `json:"user"` // The other person
+	LastMessage *MessageResponse `json:"last_message"`
+	Unread      int              `json:"unread"` // Messages from them the user hasn't read
+}
+
+type SendMessageRequest struct {
+	Content string `json:"content"`
+}
+
+func messageToResponse(m *models.Message) *MessageResponse {
+	return &MessageResponse{
+		ID:          m.ID,
+		SenderID:    m.SenderID,
+		RecipientID: m.RecipientID,
+		Content:     m.Content,
+		Read:        m.Read,
+		CreatedAt:   m.CreatedAt,
+	}
+}
+
+// getConversations lists the people the user has messaged or been
+// messaged by, most recent first, as the messages page does
+func (c *APIController) getConversations(w http.ResponseWriter, r *http.Request) {
+	user := security.UserFromContext(r)
+	if user == nil {
+		JSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	response := []*ConversationResponse{}
+	profile, err := models.Profiles.Get(user.ID)
+	if err != nil {
+		JSON(w, http.StatusOK, response)
+		return
+	}
+
+	for _, other := range profile.MyConversations() {
+		conversation := &ConversationResponse{
+			User:   userToResponse(other),
+			Unread: profile.UnreadMessagesFrom(other),
+		}
+		if last := profile.LastMessage(other); last != nil {
+			conversation.LastMessage = messageToResponse(last)
+			setLastModified(w, last.UpdatedAt)
+		}
+		response = append(response, conversation)
+	}
+
+	JSON(w, http.StatusOK, response)
+}
+
+// getConversation returns a page of the user's messages with someone,
+// newest first, and marks the ones they sent as read like opening the
+// conversation does
+func (c *APIController) getConversation(w http.ResponseWriter, r *http.Request) {
+	profile, other, ok := messageParticipants(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	limit := ParseLimit(query, defaultMessagesLimit)
+	messages := profile.MessagesBefore(other, ParseCursor(query), limit)
+	if n := len(messages); n > 0 {
+		SetNextCursor(w, r, n, limit, messages[n-1].CreatedAt, messages[n-1].ID)
+	}
+	profile.MarkMessagesReadFrom(other)
+
+	response := make([]*MessageResponse, 0, len(messages))
+	for _, message := range messages {
+		response = append(response, messageToResponse(message))
+		setLastModified(w, message.UpdatedAt)
+	}
+
+	JSON(w, http.StatusOK, response)
+}
+
+// sendMessage sends a message as the user, validated, throttled and
+// notified the same way as the conversation form
+func (c *APIController) sendMessage(w http.ResponseWriter, r *http.Request) {
+	profile, other, ok := messageParticipants(w, r)
+	if !ok {
+		return
+	}
+
+	var req SendMessageRequest
+	if err := decodeAPIBody(r, &req); err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := validateMessage(req.Content); err != nil {
+		JSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if models.ActiveSuspension(profile.UserID) != nil {
+		JSONError(w, http.StatusForbidden, "message cannot be sent")
+		return
+	}
+
+	message, err := deliverMessage(profile, other, req.Content, clientip.From(r))
+	if err != nil {
+		if errors.Is(err, models.ThrottleStrangerDM.Err) {
+			JSONError(w, http.StatusTooManyRequests, err.Error())
+			return
+		}
+		JSONError(w, http.StatusInternalServerError, "failed to send message")
+		return
+	}
+
+	JSON(w, http.StatusCreated, messageToResponse(message))
+}
+
+// messageParticipants loads the user's profile and the profile of the user
+// in the path they're messaging, answering the request if either is missing
+func messageParticipants(w http.ResponseWriter, r *http.Request) (*models.Profile, *models.Profile, bool) {
+	user := security.UserFromContext(r)
+	if user == nil {
+		JSONError(w, http.StatusUnauthorized, "unauthorized")
+		return nil, nil, false
+	}
+
+	profile, err := models.Profiles.Get(user.ID)
+	if err != nil {
+		JSONError(w, http.StatusNotFound, "profile not found")
+		return nil, nil, false
+	}
+
+	other, err := models.Profiles.Get(r.PathValue("user"))
+	if err != nil || other.Suspended {
+		JSONError(w, http.StatusNotFound, "user not found")
+		return nil, nil, false
+	}
+
+	return profile, other, true
+}
@@ -0,0 +1,394 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/authentication"
+	"www.theskyscape.com/internal/security"
+	"www.theskyscape.com/models"
+)
+
+const (
+	// maxThoughtBody bounds thought write requests, which carry a whole
+	// post rather than one field
+	maxThoughtBody = 1 << 20
+
+	// maxThoughtBlocks is how many blocks a thought can be given through
+	// the API at once
+	maxThoughtBlocks = 500
+)
+
+// apiBlockTypes are the block types the API can create. Image and file
+// blocks need an upload, so they can only be kept or recaptioned.
+var apiBlockTypes = map[string]bool{
+	"paragraph": true, "heading": true, "quote": true, "code": true, "list": true,
+}
+
+type ThoughtResponse struct {
+	ID          string           `json:"id"`
+	Title       string           `json:"title"`
+	Slug        string           `json:"slug"`
+	Published   bool             `json:"published"`
+	PublishedAt *time.Time       `json:"published_at,omitempty"`
+	Views       int              `json:"views"`
+	Stars       int              `json:"stars"`
+	Version     int              `json:"version"`
+	URL         string           `json:"url"`
+	Blocks      []*BlockResponse `json:"blocks,omitempty"` // Only when getting one thought
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+}
+
+type BlockResponse struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`    // "paragraph", "heading", "quote", "code", "list", "image" or "file"
+	Content  string `json:"content"` // Markdown, or an image's caption
+	FileURL  string `json:"file_url,omitempty"`
+	Position int    `json:"position"`
+	Version  int    `json:"version"` // Send back when updating, to refuse stale edits
+}
+
+type ThoughtBlockRequest struct {
+	ID      string `json:"id,omitempty"`      // An existing block to keep; omit for a new one
+	Version *int   `json:"version,omitempty"` // The existing block's version as last read
+	Type    string `json:"type,omitempty"`    // "paragraph" (default), "heading", "quote", "code" or "list"
+	Content string `json:"content"`
+}
+
+type CreateThoughtRequest struct {
+	Title  string                `json:"title"`
+	Blocks []ThoughtBlockRequest `json:"blocks"`
+}
+
+type UpdateThoughtBlocksRequest struct {
+	Blocks []ThoughtBlockRequest `json:"blocks"` // Every block, in order; blocks left out are deleted
+}
+
+func thoughtToResponse(t *models.Thought, withBlocks bool) *ThoughtResponse {
+	response := &ThoughtResponse{
+		ID:        t.ID,
+		Title:     t.Title,
+		Slug:      t.Slug,
+		Published: t.Published,
+		Views:     t.ViewsCount,
+		Stars:     t.StarsCount,
+		Version:   t.Version,
+		URL:       "/thought/" + t.ID,
+		CreatedAt: t.CreatedAt,
+		UpdatedAt: t.UpdatedAt,
+	}
+	if !t.PublishedAt.IsZero() {
+		response.PublishedAt = &t.PublishedAt
+	}
+	if withBlocks {
+		response.Blocks = []*BlockResponse{}
+		for _, block := range t.Blocks() {
+			b := &BlockResponse{
+				ID:       block.ID,
+				Type:     block.Type,
+				Content:  block.Content,
+				Position: block.Position,
+				Version:  block.Version,
+			}
+			if file := block.File(); file != nil {
+				b.FileURL = file.URL()
+			}
+			response.Blocks = append(response.Blocks, b)
+		}
+	}
+	return response
+}
+
+// getThoughts lists the user's thoughts, drafts included
+func (c *APIController) getThoughts(w http.ResponseWriter, r *http.Request) {
+	user := security.UserFromContext(r)
+	if user == nil {
+		JSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	before, args, limit := ParseAPIPage(r, "")
+	thoughts, err := models.Thoughts.Search(`
+		WHERE UserID = ? AND `+before+`
+		ORDER BY CreatedAt DESC, ID DESC
+		LIMIT ?
+	`, append(append([]any{user.ID}, args...), limit)...)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "failed to fetch thoughts")
+		return
+	}
+	if n := len(thoughts); n > 0 {
+		SetNextCursor(w, r, n, limit, thoughts[n-1].CreatedAt, thoughts[n-1].ID)
+	}
+
+	response := make([]*ThoughtResponse, 0, len(thoughts))
+	for _, thought := range thoughts {
+		response = append(response, thoughtToResponse(thought, false))
+		setLastModified(w, thought.UpdatedAt)
+	}
+
+	JSON(w, http.StatusOK, response)
+}
+
+// getThought returns one of the user's thoughts with its blocks
+func (c *APIController) getThought(w http.ResponseWriter, r *http.Request) {
+	_, thought, ok := ownThought(w, r)
+	if !ok {
+		return
+	}
+
+	response := thoughtToResponse(thought, true)
+	setLastModified(w, thought.UpdatedAt)
+	for _, block := range thought.Blocks() {
+		setLastModified(w, block.UpdatedAt)
+	}
+	JSON(w, http.StatusOK, response)
+}
+
+// createThought creates a draft from a title and blocks, validated the same
+// way as the new thought form
+func (c *APIController) createThought(w http.ResponseWriter, r *http.Request) {
+	user := security.UserFromContext(r)
+	if user == nil {
+		JSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req CreateThoughtRequest
+	if err := decodeAPIBodyUpTo(r, &req, maxThoughtBody); err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		JSONError(w, http.StatusUnprocessableEntity, "title is required")
+		return
+	}
+	if len(title) > 200 {
+		JSONError(w, http.StatusUnprocessableEntity, "title too long, max 200 characters")
+		return
+	}
+	for _, block := range req.Blocks {
+		if block.ID != "" {
+			JSONError(w, http.StatusUnprocessableEntity, "new thoughts can't keep blocks")
+			return
+		}
+	}
+	if err := validateAPIBlocks(req.Blocks, nil); err != nil {
+		JSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	thought, err := models.Thoughts.Insert(&models.Thought{
+		UserID: user.ID,
+		Title:  title,
+		Slug:   generateSlug(title),
+	})
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "failed to create thought")
+		return
+	}
+
+	if err := saveAPIBlocks(thought, req.Blocks); err != nil {
+		JSONError(w, http.StatusInternalServerError, "failed to save blocks")
+		return
+	}
+
+	JSON(w, http.StatusCreated, thoughtToResponse(thought, true))
+}
+
+// updateThoughtBlocks replaces a thought's blocks with the ones sent,
+// keeping the blocks named by ID, adding the rest and deleting what's left
+// out. Blocks sent with a stale version get a 409, like the editor.
+func (c *APIController) updateThoughtBlocks(w http.ResponseWriter, r *http.Request) {
+	_, thought, ok := ownThought(w, r)
+	if !ok {
+		return
+	}
+
+	var req UpdateThoughtBlocksRequest
+	if err := decodeAPIBodyUpTo(r, &req, maxThoughtBody); err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	existing := map[string]*models.ThoughtBlock{}
+	for _, block := range thought.Blocks() {
+		existing[block.ID] = block
+	}
+	if err := validateAPIBlocks(req.Blocks, existing); err != nil {
+		status := http.StatusUnprocessableEntity
+		if errors.Is(err, models.ErrBlockConflict) {
+			status = http.StatusConflict
+		}
+		JSONError(w, status, err.Error())
+		return
+	}
+
+	if err := saveAPIBlocks(thought, req.Blocks); err != nil {
+		if errors.Is(err, models.ErrBlockConflict) {
+			JSONError(w, http.StatusConflict, err.Error())
+			return
+		}
+		JSONError(w, http.StatusInternalServerError, "failed to save blocks")
+		return
+	}
+
+	JSON(w, http.StatusOK, thoughtToResponse(thought, true))
+}
+
+// publishThought publishes one of the user's thoughts, as saving it with
+// published checked does on the web
+func (c *APIController) publishThought(w http.ResponseWriter, r *http.Request) {
+	user, thought, ok := ownThought(w, r)
+	if !ok {
+		return
+	}
+
+	if thought.Takedown() != nil || models.ActiveSuspension(user.ID) != nil {
+		JSONError(w, http.StatusForbidden, "thought cannot be published")
+		return
+	}
+
+	if !thought.Published {
+		thought.Published = true
+		if thought.PublishedAt.IsZero() {
+			thought.PublishedAt = time.Now()
+		}
+		if err := models.Thoughts.Update(thought); err != nil {
+			JSONError(w, http.StatusInternalServerError, "failed to publish thought")
+			return
+		}
+		thought.SyncFileVisibility()
+
+		models.Activities.Insert(&models.Activity{
+			UserID:      user.ID,
+			Action:      "published",
+			SubjectType: "thought",
+			SubjectID:   thought.ID,
+		})
+	}
+
+	JSON(w, http.StatusOK, thoughtToResponse(thought, false))
+}
+
+// ownThought loads the thought in the path if it's the user's, answering
+// the request otherwise
+func ownThought(w http.ResponseWriter, r *http.Request) (*authentication.User, *models.Thought, bool) {
+	user := security.UserFromContext(r)
+	if user == nil {
+		JSONError(w, http.StatusUnauthorized, "unauthorized")
+		return nil, nil, false
+	}
+
+	thought, err := models.Thoughts.Get(r.PathValue("id"))
+	if err != nil {
+		JSONError(w, http.StatusNotFound, "thought not found")
+		return nil, nil, false
+	}
+
+	// Only allow access to own thoughts
+	if thought.UserID != user.ID {
+		JSONError(w, http.StatusForbidden, "access denied")
+		return nil, nil, false
+	}
+
+	return user, thought, true
+}
+
+// validateAPIBlocks checks blocks before any are saved, so a bad request
+// doesn't leave a thought half updated. Kept blocks must be among existing
+// and, when a version is sent, still at it.
+func validateAPIBlocks(blocks []ThoughtBlockRequest, existing map[string]*models.ThoughtBlock) error {
+	if len(blocks) > maxThoughtBlocks {
+		return errors.New("too many blocks, max 500")
+	}
+
+	seen := map[string]bool{}
+	for _, req := range blocks {
+		if req.ID == "" {
+			if req.Type != "" && !apiBlockTypes[req.Type] {
+				return errors.New("invalid block type")
+			}
+			continue
+		}
+
+		block, ok := existing[req.ID]
+		if !ok || seen[req.ID] {
+			return errors.New("block not found")
+		}
+		seen[req.ID] = true
+
+		if req.Type != "" && req.Type != block.Type && (!apiBlockTypes[req.Type] || !apiBlockTypes[block.Type]) {
+			return errors.New("invalid block type")
+		}
+		if req.Version != nil && *req.Version != block.Version {
+			return models.ErrBlockConflict
+		}
+	}
+	return nil
+}
+
+// saveAPIBlocks applies validated blocks to a thought: deleting those left
+// out, updating those kept, adding the new ones, then putting them all in
+// the order sent
+func saveAPIBlocks(thought *models.Thought, blocks []ThoughtBlockRequest) error {
+	existing := map[string]*models.ThoughtBlock{}
+	for _, block := range thought.Blocks() {
+		existing[block.ID] = block
+	}
+
+	kept := map[string]bool{}
+	for _, req := range blocks {
+		kept[req.ID] = true
+	}
+	for id, block := range existing {
+		if !kept[id] {
+			if err := models.DeleteBlock(block); err != nil {
+				return err
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(blocks))
+	for _, req := range blocks {
+		block := existing[req.ID]
+		if block == nil {
+			blockType := req.Type
+			if blockType == "" {
+				blockType = "paragraph"
+			}
+			created, err := models.InsertBlock(&models.ThoughtBlock{
+				ThoughtID: thought.ID,
+				Type:      blockType,
+				Content:   req.Content,
+			})
+			if err != nil {
+				return err
+			}
+			ids = append(ids, created.ID)
+			continue
+		}
+
+		if req.Content != block.Content || (req.Type != "" && req.Type != block.Type) {
+			version := block.Version
+			if req.Version != nil {
+				version = *req.Version
+			}
+			block.Content = req.Content
+			if req.Type != "" {
+				block.Type = req.Type
+			}
+			if err := models.UpdateBlock(block, version); err != nil {
+				return err
+			}
+		}
+		ids = append(ids, block.ID)
+	}
+
+	return models.ReorderBlocks(thought.ID, ids)
+}
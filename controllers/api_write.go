@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"www.theskyscape.com/internal/security"
+	"www.theskyscape.com/models"
+)
+
+// maxAPIBody bounds the JSON body of API write requests
+const maxAPIBody = 64 << 10
+
+type PostResponse struct {
+	ID         string    `json:"id"`
+	Content    string    `json:"content"`
+	Visibility string    `json:"visibility"`
+	URL        string    `json:"url"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type CreateRepoRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type CreatePostRequest struct {
+	Content    string `json:"content"`
+	Visibility string `json:"visibility"` // "public" (default), "followers" or "unlisted"
+}
+
+// withScopes requires an access token with the given scopes, counting the
+// request against the token's limit for the first of them. Write endpoints use it instead of
+// ProtectFunc: they're called with a bearer token rather than a session
+// cookie, so there's no form to carry a CSRF token.
+func withScopes(handler http.HandlerFunc, scopes ...string) http.Handler {
+	check := security.RequireScopes(scopes...)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if check(nil, w, r) {
+			apiLimit(scopes[0]).WrapFunc(handler)(w, r)
+		}
+	})
+}
+
+// decodeAPIBody reads a JSON request body into v
+func decodeAPIBody(r *http.Request, v any) error {
+	return decodeAPIBodyUpTo(r, v, maxAPIBody)
+}
+
+// decodeAPIBodyUpTo reads a JSON request body of at most limit bytes into v
+func decodeAPIBodyUpTo(r *http.Request, v any, limit int64) error {
+	if err := json.NewDecoder(io.LimitReader(r.Body, limit)).Decode(v); err != nil {
+		return errors.New("invalid JSON body")
+	}
+	return nil
+}
+
+// createRepo creates a repo owned by the user, validated the same way as
+// the new repo form
+func (c *APIController) createRepo(w http.ResponseWriter, r *http.Request) {
+	user := security.UserFromContext(r)
+	if user == nil {
+		JSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req CreateRepoRequest
+	if err := decodeAPIBody(r, &req); err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	repo, err := createUserRepo(user, req.Name, req.Description)
+	if err != nil {
+		JSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	JSON(w, http.StatusCreated, repoToResponse(repo))
+}
+
+// createAppBuild rebuilds and redeploys one of the user's apps, like the
+// launch button
+func (c *APIController) createAppBuild(w http.ResponseWriter, r *http.Request) {
+	user := security.UserFromContext(r)
+	if user == nil {
+		JSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	app, err := models.Apps.Get(r.PathValue("id"))
+	if err != nil {
+		JSONError(w, http.StatusNotFound, "app not found")
+		return
+	}
+
+	// Only allow building own apps
+	if repo := app.Repo(); repo == nil || repo.OwnerID != user.ID {
+		JSONError(w, http.StatusForbidden, "access denied")
+		return
+	}
+
+	if app.Status == "shutdown" || models.ActiveSuspension(user.ID) != nil {
+		JSONError(w, http.StatusForbidden, "app cannot be built")
+		return
+	}
+	if app.Status == "launching" {
+		JSONError(w, http.StatusConflict, "app is already building")
+		return
+	}
+
+	startAppBuild(r, app)
+
+	app.Status = "launching"
+	app.Error = ""
+	JSON(w, http.StatusAccepted, appToResponse(app))
+}
+
+// createPost posts to the feed as the user, validated the same way as the
+// post form. Posts made through the API can't attach images or subjects.
+func (c *APIController) createPost(w http.ResponseWriter, r *http.Request) {
+	user := security.UserFromContext(r)
+	if user == nil {
+		JSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req CreatePostRequest
+	if err := decodeAPIBody(r, &req); err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	visibility, err := validatePost(req.Content, req.Visibility)
+	if err != nil {
+		JSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	post, err := publishPost(user, &models.Activity{
+		Content:    req.Content,
+		Visibility: visibility,
+	})
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "failed to create post")
+		return
+	}
+
+	JSON(w, http.StatusCreated, &PostResponse{
+		ID:         post.ID,
+		Content:    post.Content,
+		Visibility: post.Visibility,
+		URL:        "/post/" + post.ID,
+		CreatedAt:  post.CreatedAt,
+	})
+}
@@ -2,15 +2,21 @@ package controllers
 
 import (
 	"errors"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/The-Skyscape/devtools/pkg/application"
+	"www.theskyscape.com/internal/analytics"
 	"www.theskyscape.com/internal/hosting"
 	"www.theskyscape.com/internal/migration"
+	"www.theskyscape.com/internal/scanning"
 	"www.theskyscape.com/internal/social"
+	"www.theskyscape.com/internal/tracing"
 	"www.theskyscape.com/models"
 )
 
@@ -26,21 +32,32 @@ func (c *AppsController) Setup(app *application.App) {
 	c.Controller.Setup(app)
 	auth := c.Use("auth").(*AuthController)
 
-	http.Handle("GET /apps", c.Serve("apps.html", auth.Optional))
-	http.Handle("/app/{app}", c.Serve("app.html", auth.Optional))
-	http.Handle("/app/{app}/manage", c.Serve("app-manage.html", auth.Required))
-	http.Handle("/app/{app}/history", c.ProtectFunc(c.redirectToManage, auth.Optional))
-	http.Handle("GET /app/{app}/versions", c.ProtectFunc(c.pollVersions, auth.Required))
-	http.Handle("GET /app/{app}/comments", c.Serve("app-comments.html", auth.Optional))
-	http.Handle("POST /apps", c.ProtectFunc(c.create, auth.Required))
-	http.Handle("POST /app/{app}/edit", c.ProtectFunc(c.update, auth.Required))
-	http.Handle("POST /app/{app}/launch", c.ProtectFunc(c.launch, auth.Required))
-	http.Handle("POST /app/{app}/enable-database", c.ProtectFunc(c.enableDatabase, auth.Required))
-	http.Handle("POST /apps/{app}/promote", c.ProtectFunc(c.promoteApp, auth.Required))
-	http.Handle("DELETE /apps/{app}/promote", c.ProtectFunc(c.cancelPromotion, auth.Required))
-	http.Handle("POST /app/{app}/share", c.ProtectFunc(c.shareApp, auth.Required))
-	http.Handle("POST /app/{app}/migrate", c.ProtectFunc(c.migrateToProject, auth.Required))
-	http.Handle("DELETE /app/{app}", c.ProtectFunc(c.shutdown, auth.Required))
+	route("GET /apps", cached(c.Serve("apps.html", auth.Optional)))
+	route("/app/{app}", c.Serve("app.html", auth.Optional))
+	route("/app/{app}/manage", c.Serve("app-manage.html", auth.Required))
+	route("/app/{app}/history", c.ProtectFunc(c.redirectToManage, auth.Optional))
+	route("GET /app/{app}/versions", noindex(c.ProtectFunc(c.pollVersions, auth.Required)))
+	route("GET /app/{app}/comments", c.Serve("app-comments.html", auth.Optional))
+	route("POST /apps", c.ProtectFunc(c.create, auth.Required))
+	route("POST /app/{app}/edit", c.ProtectFunc(c.update, auth.Required))
+	route("POST /app/{app}/launch", c.ProtectFunc(c.launch, auth.Required))
+	route("POST /app/{app}/enable-database", c.ProtectFunc(c.enableDatabase, auth.Required))
+	route("POST /app/{app}/analytics", c.ProtectFunc(c.updateAnalytics, auth.Required))
+	route("POST /app/{app}/protection", c.ProtectFunc(c.updateProtection, auth.Required))
+	route("POST /app/{app}/screenshots", c.ProtectFunc(auth.limited(uploadLimit, c.uploadScreenshot), auth.Required))
+	route("DELETE /app/{app}/screenshot/{screenshot}", c.ProtectFunc(c.deleteScreenshot, auth.Required))
+	route("POST /app/{app}/pick", c.ProtectFunc(c.pickApp, auth.AdminRequired))
+	route("POST /app/{app}/review", c.ProtectFunc(c.review, auth.Required))
+	route("DELETE /app/{app}/review", c.ProtectFunc(c.deleteReview, auth.Required))
+	route("POST /app/{app}/review/{review}/respond", c.ProtectFunc(c.respondReview, auth.Required))
+	route("POST /app/{app}/review/{review}/report", c.ProtectFunc(auth.limited(reportLimit, c.reportReview), auth.Required))
+	route("GET /admin/reviews", c.Serve("admin-reviews.html", auth.AdminRequired))
+	route("POST /admin/review/{review}", c.ProtectFunc(c.moderateReview, auth.AdminRequired))
+	route("POST /apps/{app}/promote", c.ProtectFunc(c.promoteApp, auth.Required))
+	route("DELETE /apps/{app}/promote", c.ProtectFunc(c.cancelPromotion, auth.Required))
+	route("POST /app/{app}/share", c.ProtectFunc(c.shareApp, auth.Required))
+	route("POST /app/{app}/migrate", c.ProtectFunc(c.migrateToProject, auth.Required))
+	route("DELETE /app/{app}", c.ProtectFunc(c.shutdown, auth.Required))
 }
 
 func (c AppsController) Handle(r *http.Request) application.Handler {
@@ -127,17 +144,34 @@ func (c *AppsController) Comments() []*models.Comment {
 		return nil
 	}
 	limit := c.CommentLimit()
+	if cursor := ParseCursor(c.URL.Query()); cursor != nil {
+		return app.CommentsBefore(cursor, limit)
+	}
 	offset := (c.CommentPage() - 1) * limit
 	return app.Comments(limit, offset)
 }
 
+// AllApps returns the directory listing, filtered by the query and
+// category params and sorted by the sort param: newest first, or "popular"
+// for the most installs first
 func (c *AppsController) AllApps() []*models.App {
 	query := c.URL.Query().Get("query")
+	category := c.CurrentCategory()
+	order := "repos.CreatedAt DESC"
+	switch c.AppSort() {
+	case "popular":
+		order = "(SELECT COUNT(*) FROM oauth_authorizations WHERE AppID = apps.ID AND Revoked = false) DESC, repos.CreatedAt DESC"
+	case "rated":
+		order = `(SELECT COALESCE(AVG(Rating), 0) FROM app_reviews WHERE AppID = apps.ID AND Hidden = false) DESC,
+			(SELECT COUNT(*) FROM app_reviews WHERE AppID = apps.ID AND Hidden = false) DESC, repos.CreatedAt DESC`
+	}
 	apps, _ := models.Apps.Search(`
 		INNER JOIN repos on repos.ID = apps.RepoID
 	  INNER JOIN users on users.ID = repos.OwnerID
 		WHERE
 			apps.Status != 'shutdown'
+			AND repos.OwnerID NOT IN (SELECT UserID FROM profiles WHERE Suspended = true)
+			AND ($2 = '' OR apps.Category = $2)
 			AND (
 				apps.Name         LIKE $1 OR
 				apps.Description  LIKE $1 OR
@@ -145,11 +179,54 @@ func (c *AppsController) AllApps() []*models.App {
 				repos.Description LIKE $1 OR
 				users.Handle      LIKE LOWER($1)
 			)
-		ORDER BY repos.CreatedAt DESC
-	`, "%"+query+"%")
+		ORDER BY `+order+`
+	`, "%"+query+"%", category)
+	return apps
+}
+
+// Categories returns the sections of the app directory
+func (c *AppsController) Categories() []models.AppCategory {
+	return models.AppCategories
+}
+
+// CurrentCategory returns the category the directory is filtered to
+func (c *AppsController) CurrentCategory() string {
+	if category := c.URL.Query().Get("category"); models.IsAppCategory(category) {
+		return category
+	}
+	return ""
+}
+
+// AppSort returns how the directory is sorted, "new", "popular" or
+// "rated"
+func (c *AppsController) AppSort() string {
+	switch sort := c.URL.Query().Get("sort"); sort {
+	case "popular", "rated":
+		return sort
+	}
+	return "new"
+}
+
+// EditorsPicks returns the apps featured by admins, most recently picked
+// first
+func (c *AppsController) EditorsPicks() []*models.App {
+	apps, _ := models.Apps.Search(`
+		INNER JOIN repos on repos.ID = apps.RepoID
+		WHERE
+			apps.EditorsPick = true
+			AND apps.Status != 'shutdown'
+			AND repos.OwnerID NOT IN (SELECT UserID FROM profiles WHERE Suspended = true)
+		ORDER BY apps.PickedAt DESC
+		LIMIT 6
+	`)
 	return apps
 }
 
+// MaxScreenshots returns how many screenshots an app's gallery can hold
+func (c *AppsController) MaxScreenshots() int {
+	return models.MaxAppScreenshots
+}
+
 func (c *AppsController) ReadmeFile() *models.Blob {
 	app := c.CurrentApp()
 	if app == nil {
@@ -178,6 +255,7 @@ func (c *AppsController) RecentApps() []*models.App {
 	  INNER JOIN users on users.ID = repos.OwnerID
 		WHERE
 			apps.Status != 'shutdown'
+			AND repos.OwnerID NOT IN (SELECT UserID FROM profiles WHERE Suspended = true)
 			AND (
 				apps.Name         LIKE $1 OR
 				apps.Description  LIKE $1 OR
@@ -195,16 +273,16 @@ func (c *AppsController) create(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("unauthorized"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("unauthorized")))
 		return
 	}
 
 	repo, err := models.Repos.Get(r.FormValue("repo"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("repo not found"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("repo not found")))
 		return
 	} else if repo.OwnerID != user.ID {
-		c.Render(w, r, "error-message.html", errors.New("you are not the owner"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("you are not the owner")))
 		return
 	}
 
@@ -213,27 +291,27 @@ func (c *AppsController) create(w http.ResponseWriter, r *http.Request) {
 	databaseEnabled := r.FormValue("database") == "true"
 
 	if name == "" || description == "" {
-		c.Render(w, r, "error-message.html", errors.New("missing name or desc"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("missing name or desc")))
 		return
 	}
 
 	// Sanitize ID
 	id, err := hosting.SanitizeID(name)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	// Check if app already exists
 	if _, err := models.Apps.Get(id); err == nil {
-		c.Render(w, r, "error-message.html", errors.New("an app with this ID already exists"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("an app with this ID already exists")))
 		return
 	}
 
 	// Create app record
 	app, err := models.NewApp(id, repo.ID, name, description, databaseEnabled)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -250,7 +328,7 @@ func (c *AppsController) create(w http.ResponseWriter, r *http.Request) {
 		app.Status = "launching"
 		models.Apps.Update(app)
 
-		if _, err := hosting.BuildApp(app); err != nil {
+		if _, err := hosting.BuildApp(tracing.Detach(r.Context()), app); err != nil {
 			app.Error = err.Error()
 			models.Apps.Update(app)
 		}
@@ -263,13 +341,13 @@ func (c *AppsController) update(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("unauthorized"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("unauthorized")))
 		return
 	}
 
 	app, err := models.Apps.Get(r.PathValue("app"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("app not found"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("app not found")))
 		return
 	}
 
@@ -278,7 +356,7 @@ func (c *AppsController) update(w http.ResponseWriter, r *http.Request) {
 
 	// Allow owner or admin to edit
 	if !isOwner && !user.IsAdmin {
-		c.Render(w, r, "error-message.html", errors.New("you are not the owner"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("you are not the owner")))
 		return
 	}
 
@@ -286,27 +364,35 @@ func (c *AppsController) update(w http.ResponseWriter, r *http.Request) {
 	description := r.FormValue("description")
 
 	if name == "" || description == "" {
-		c.Render(w, r, "error-message.html", errors.New("missing name or description"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("missing name or description")))
+		return
+	}
+
+	category := r.FormValue("category")
+	if category != "" && !models.IsAppCategory(category) {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("invalid category")))
 		return
 	}
 
 	// Update app fields
 	app.Name = name
 	app.Description = description
+	app.Category = category
 
 	// Handle ID change (admin only)
 	newID := r.FormValue("id")
 	if newID != "" && newID != app.ID && user.IsAdmin {
 		if err := hosting.RenameApp(app.ID, newID, name, description); err != nil {
-			c.Render(w, r, "error-message.html", err)
+			c.Render(w, r, "error-message.html", localize(r, err))
 			return
 		}
+		auth.audit(r, user.ID, models.AuditAppRenamed, "app", newID, "renamed from "+app.ID)
 		c.Redirect(w, r, "/app/"+newID+"/manage")
 		return
 	}
 
 	if err := models.Apps.Update(app); err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -317,36 +403,104 @@ func (c *AppsController) launch(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	app, err := models.Apps.Get(r.PathValue("app"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("app not found"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("app not found")))
 		return
 	}
 
 	repo := app.Repo()
 	isOwner := repo != nil && repo.OwnerID == user.ID
 	if !isOwner && !user.IsAdmin {
-		c.Render(w, r, "error-message.html", errors.New("permission denied"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("permission denied")))
 		return
 	}
 
+	startAppBuild(r, app)
+
+	time.Sleep(time.Millisecond * 250)
+	c.Refresh(w, r)
+}
+
+// startAppBuild builds and deploys an app in the background, shared by the
+// launch button, enabling the database, and the API
+func startAppBuild(r *http.Request, app *models.App) {
 	go func() {
 		app.Status = "launching"
 		app.Error = ""
 		models.Apps.Update(app)
 
-		if _, err := hosting.BuildApp(app); err != nil {
+		if _, err := hosting.BuildApp(tracing.Detach(r.Context()), app); err != nil {
 			app.Error = err.Error()
 			models.Apps.Update(app)
 			return
 		}
 	}()
+}
+
+func (c *AppsController) updateAnalytics(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	app, err := models.Apps.Get(r.PathValue("app"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("app not found")))
+		return
+	}
+
+	repo := app.Repo()
+	isOwner := repo != nil && repo.OwnerID == user.ID
+	if !isOwner && !user.IsAdmin {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("permission denied")))
+		return
+	}
+
+	app.AnalyticsEnabled = r.FormValue("analytics") == "on"
+	if err = models.Apps.Update(app); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+	analytics.Forget(app.ID)
+
+	c.Refresh(w, r)
+}
+
+// updateProtection saves the limits and WAF rules the proxy applies to
+// the app
+func (c *AppsController) updateProtection(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	app, err := models.Apps.Get(r.PathValue("app"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("app not found")))
+		return
+	}
+
+	repo := app.Repo()
+	isOwner := repo != nil && repo.OwnerID == user.ID
+	if !isOwner && !user.IsAdmin {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("permission denied")))
+		return
+	}
+
+	if err = saveProxyRules(r, app.ID); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
 
-	time.Sleep(time.Millisecond * 250)
 	c.Refresh(w, r)
 }
 
@@ -354,25 +508,25 @@ func (c *AppsController) enableDatabase(w http.ResponseWriter, r *http.Request)
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	app, err := models.Apps.Get(r.PathValue("app"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("app not found"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("app not found")))
 		return
 	}
 
 	repo := app.Repo()
 	isOwner := repo != nil && repo.OwnerID == user.ID
 	if !isOwner && !user.IsAdmin {
-		c.Render(w, r, "error-message.html", errors.New("permission denied"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("permission denied")))
 		return
 	}
 
 	if app.DatabaseEnabled {
-		c.Render(w, r, "error-message.html", errors.New("database already enabled"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("database already enabled")))
 		return
 	}
 
@@ -380,17 +534,7 @@ func (c *AppsController) enableDatabase(w http.ResponseWriter, r *http.Request)
 	app.DatabaseEnabled = true
 	models.Apps.Update(app)
 
-	go func() {
-		app.Status = "launching"
-		app.Error = ""
-		models.Apps.Update(app)
-
-		if _, err := hosting.BuildApp(app); err != nil {
-			app.Error = err.Error()
-			models.Apps.Update(app)
-			return
-		}
-	}()
+	startAppBuild(r, app)
 
 	time.Sleep(time.Millisecond * 250)
 	c.Refresh(w, r)
@@ -400,49 +544,191 @@ func (c *AppsController) shutdown(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	app, err := models.Apps.Get(r.PathValue("app"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("app not found"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("app not found")))
 		return
 	}
 
 	repo := app.Repo()
 	isOwner := repo != nil && repo.OwnerID == user.ID
 	if !isOwner && !user.IsAdmin {
-		c.Render(w, r, "error-message.html", errors.New("permission denied"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("permission denied")))
 		return
 	}
 
 	app.Status = "shutdown"
 	if err = models.Apps.Update(app); err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
+	auth.audit(r, user.ID, models.AuditAppShutdown, "app", app.ID, "")
 
 	c.Redirect(w, r, "/profile")
 }
 
+// uploadScreenshot adds an image to the app's directory gallery
+func (c *AppsController) uploadScreenshot(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	app, err := models.Apps.Get(r.PathValue("app"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("app not found")))
+		return
+	}
+
+	repo := app.Repo()
+	isOwner := repo != nil && repo.OwnerID == user.ID
+	if !isOwner && !user.IsAdmin {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("permission denied")))
+		return
+	}
+
+	if len(app.Screenshots()) >= models.MaxAppScreenshots {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("remove a screenshot before adding another")))
+		return
+	}
+
+	r.ParseMultipartForm(maxImageSize)
+	file, handler, err := r.FormFile("file")
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("no file uploaded")))
+		return
+	}
+	defer file.Close()
+
+	if handler.Size > maxImageSize {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("image too large, max 10MB")))
+		return
+	}
+
+	mimeType := handler.Header.Get("Content-Type")
+	if !allowedImageTypes[mimeType] {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("Only images are allowed")))
+		return
+	}
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	stored, err := scanning.Store(&models.File{
+		OwnerID:    user.ID,
+		FilePath:   filepath.Base(filepath.Clean(handler.Filename)),
+		MimeType:   mimeType,
+		Content:    content,
+		Visibility: models.FilePublic,
+	})
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	caption := strings.TrimSpace(r.FormValue("caption"))
+	if len(caption) > 200 {
+		caption = caption[:200]
+	}
+	if _, err = app.AddScreenshot(stored.ID, caption); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+// deleteScreenshot removes an image from the app's gallery
+func (c *AppsController) deleteScreenshot(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	app, err := models.Apps.Get(r.PathValue("app"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("app not found")))
+		return
+	}
+
+	repo := app.Repo()
+	isOwner := repo != nil && repo.OwnerID == user.ID
+	if !isOwner && !user.IsAdmin {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("permission denied")))
+		return
+	}
+
+	screenshot, err := models.AppScreenshots.Get(r.PathValue("screenshot"))
+	if err != nil || screenshot.AppID != app.ID {
+		c.Render(w, r, "error-message.html", localize(r, application.ErrNotFound))
+		return
+	}
+
+	if err = models.AppScreenshots.Delete(screenshot); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+	if file, err := models.Files.Get(screenshot.FileID); err == nil {
+		models.Files.Delete(file)
+	}
+
+	c.Refresh(w, r)
+}
+
+// pickApp features an app in the directory's editor's picks, or removes it
+func (c *AppsController) pickApp(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	app, err := models.Apps.Get(r.PathValue("app"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("app not found")))
+		return
+	}
+
+	picked := r.FormValue("picked") == "true"
+	if err = app.SetEditorsPick(picked); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+	auth.audit(r, user.ID, models.AuditEditorsPick, "app", app.ID, strconv.FormatBool(picked))
+
+	c.Refresh(w, r)
+}
+
 func (c *AppsController) promoteApp(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	app, err := models.Apps.Get(r.PathValue("app"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	content := r.FormValue("content")
-	if _, err := social.CreatePromotion(user.ID, social.WrapApp(app), content); err != nil {
-		c.Render(w, r, "error-message.html", err)
+	excludeFollowers := r.FormValue("exclude_followers") == "on"
+	if _, err := social.CreatePromotion(user.ID, social.WrapApp(app), content, r.FormValue("tags"), excludeFollowers); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -453,18 +739,18 @@ func (c *AppsController) cancelPromotion(w http.ResponseWriter, r *http.Request)
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	app, err := models.Apps.Get(r.PathValue("app"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
-	if err := social.CancelPromotion(user.ID, social.WrapApp(app)); err != nil {
-		c.Render(w, r, "error-message.html", err)
+	if _, err := social.CancelPromotion(user.ID, social.WrapApp(app)); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -475,32 +761,34 @@ func (c *AppsController) shareApp(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	app, err := models.Apps.Get(r.PathValue("app"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	content := r.FormValue("content")
 	if len(content) > MaxContentLength {
-		c.Render(w, r, "error-message.html", errors.New("content too long"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("content too long")))
 		return
 	}
 
-	if _, err = models.Activities.Insert(&models.Activity{
+	post, err := models.Activities.Insert(&models.Activity{
 		UserID:      user.ID,
 		Action:      "posted",
 		SubjectType: "app",
 		SubjectID:   app.ID,
 		Content:     content,
-	}); err != nil {
-		c.Render(w, r, "error-message.html", err)
+	})
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
+	models.TagActivity(post)
 
 	c.Redirect(w, r, "/")
 }
@@ -509,20 +797,20 @@ func (c *AppsController) migrateToProject(w http.ResponseWriter, r *http.Request
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	app, err := models.Apps.Get(r.PathValue("app"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("app not found"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("app not found")))
 		return
 	}
 
 	repo := app.Repo()
 	isOwner := repo != nil && repo.OwnerID == user.ID
 	if !isOwner && !user.IsAdmin {
-		c.Render(w, r, "error-message.html", errors.New("permission denied"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("permission denied")))
 		return
 	}
 
@@ -544,11 +832,11 @@ func (c *AppsController) migrateToProject(w http.ResponseWriter, r *http.Request
 			})
 			return
 		}
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
-	log.Printf("Migrated app %s to project %s", app.ID, project.ID)
+	slog.InfoContext(r.Context(), "migrated app to project", "app_id", app.ID, "project_id", project.ID)
 	c.Redirect(w, r, "/project/"+project.ID)
 }
 
@@ -560,7 +848,7 @@ func (c *AppsController) redirectToManage(w http.ResponseWriter, r *http.Request
 func (c *AppsController) pollVersions(w http.ResponseWriter, r *http.Request) {
 	app, err := models.Apps.Get(r.PathValue("app"))
 	if err != nil {
-		c.RenderError(w, r, errors.New("app not found"))
+		c.RenderError(w, r, localize(r, errors.New("app not found")))
 		return
 	}
 
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"www.theskyscape.com/models"
+)
+
+// auditPageSize is how many audit entries the viewer shows at a time
+const auditPageSize = 100
+
+func Audit() (string, *AuditController) {
+	return "audit", &AuditController{}
+}
+
+// AuditController shows admins the audit log of sensitive operations
+type AuditController struct {
+	application.Controller
+}
+
+func (c *AuditController) Setup(app *application.App) {
+	c.Controller.Setup(app)
+	auth := c.Use("auth").(*AuthController)
+
+	route("GET /admin/audit", noindex(c.Serve("admin-audit.html", auth.AdminRequired)))
+}
+
+func (c AuditController) Handle(r *http.Request) application.Handler {
+	c.Request = r
+	return &c
+}
+
+// Actions returns every audited action, for the filter
+func (c *AuditController) Actions() []string {
+	return models.AuditActions
+}
+
+// Filter returns a filter value from the query, e.g. "action"
+func (c *AuditController) Filter(name string) string {
+	return strings.TrimSpace(c.URL.Query().Get(name))
+}
+
+// Entries returns the audit entries matching the filters, newest first.
+// The actor filter takes a handle or email.
+func (c *AuditController) Entries() []*models.AuditLog {
+	filter := models.AuditFilter{
+		Action:   c.Filter("action"),
+		TargetID: c.Filter("target"),
+		Before:   ParseCursor(c.URL.Query()),
+		Limit:    auditPageSize,
+	}
+	if actor := strings.TrimPrefix(c.Filter("actor"), "@"); actor != "" {
+		user, err := models.Auth.Users.First("WHERE Handle = $1 OR Email = $1", actor)
+		if err != nil {
+			return nil
+		}
+		filter.ActorID = user.ID
+	}
+	return models.SearchAuditLogs(filter)
+}
+
+// PageSize returns how many entries a page holds, to tell if there are more
+func (c *AuditController) PageSize() int {
+	return auditPageSize
+}
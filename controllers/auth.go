@@ -1,9 +1,13 @@
 package controllers
 
 import (
+	"cmp"
+	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,17 +15,40 @@ import (
 	"github.com/The-Skyscape/devtools/pkg/authentication"
 	"github.com/The-Skyscape/devtools/pkg/emailing"
 	"golang.org/x/crypto/bcrypt"
+	"www.theskyscape.com/internal/captcha"
+	"www.theskyscape.com/internal/clientip"
+	"www.theskyscape.com/internal/hosts"
+	"www.theskyscape.com/internal/i18n"
+	"www.theskyscape.com/internal/logging"
+	"www.theskyscape.com/internal/push"
 	"www.theskyscape.com/internal/security"
+	"www.theskyscape.com/internal/sociallogin"
+	"www.theskyscape.com/internal/webauthn"
 	"www.theskyscape.com/models"
 )
 
+// sessionCookie holds the signed-in user's session token
+const sessionCookie = "theskyscape"
+
+// socialCookie ties a GitHub or Google sign in to the browser that
+// started it
+const socialCookie = "theskyscape-social"
+
+// challengeCookie holds a sign-in waiting on a two-factor code
+const challengeCookie = "theskyscape-2fa"
+
 func Auth() (string, *AuthController) {
 	return "auth", &AuthController{
 		models.Auth.Controller(
-			authentication.WithCookie("theskyscape"),
+			authentication.WithCookie(sessionCookie),
 			authentication.WithSigninHandler(func(c *authentication.Controller, user *authentication.User) http.HandlerFunc {
 				return func(w http.ResponseWriter, r *http.Request) {
-					if next := r.FormValue("next"); next != "" && strings.HasPrefix(next, "/") {
+					// Restore the user's language setting on this device
+					if profile, err := models.Profiles.Get(user.ID); err == nil && i18n.Supported(profile.Locale) {
+						setLocaleCookie(w, profile.Locale)
+					}
+
+					if next := localPath(r.FormValue("next")); next != "" {
 						c.Redirect(w, r, next)
 						return
 					}
@@ -31,16 +58,13 @@ func Auth() (string, *AuthController) {
 			}),
 			authentication.WithSignupHandler(func(c *authentication.Controller, user *authentication.User) http.HandlerFunc {
 				return func(w http.ResponseWriter, r *http.Request) {
+					// Attribute the signup to whoever invited them
+					if invite, err := models.FindInvite(r.FormValue("invite")); err == nil {
+						invite.Redeem(user.ID)
+					}
+
 					// In the background;
-					go func() {
-						// Welcome the new user to The Skyscape community
-						models.Emails.Send(user.Email,
-							"Welcome to The Skyscape",
-							emailing.WithTemplate("welcome.html"),
-							emailing.WithData("user", user),
-							emailing.WithData("year", time.Now().Year()),
-						)
-					}()
+					welcome(requestLocale(r), user)
 
 					// While we redirect the user to their profile
 					c.Redirect(w, r, "/profile")
@@ -50,6 +74,20 @@ func Auth() (string, *AuthController) {
 	}
 }
 
+// welcome emails a new user in the background
+func welcome(locale string, user *authentication.User) {
+	go func() {
+		// Welcome the new user to The Skyscape community
+		models.SendEmail(user.Email,
+			i18n.T(locale, "Welcome to The Skyscape"),
+			"welcome.html",
+			emailing.WithData("t", i18n.For(locale)),
+			emailing.WithData("user", user),
+			emailing.WithData("year", time.Now().Year()),
+		)
+	}()
+}
+
 type AuthController struct {
 	*authentication.Controller
 }
@@ -59,19 +97,39 @@ func (c *AuthController) Setup(app *application.App) {
 	c.Controller.Controller.Setup(app)
 
 	// Register auth routes with rate limiting
-	http.HandleFunc("POST /_auth/signup", c.signupWithRateLimit)
-	http.HandleFunc("POST /_auth/signin", c.signinWithRateLimit)
-	http.HandleFunc("POST /_auth/signout", c.Controller.HandleSignout)
+	route("POST /_auth/signup", http.HandlerFunc(c.signupWithRateLimit))
+	route("POST /_auth/signin", http.HandlerFunc(c.signinWithRateLimit))
+	route("POST /_auth/signout", http.HandlerFunc(c.Controller.HandleSignout))
+	route("POST /_auth/2fa", http.HandlerFunc(c.verifyTwoFactor))
+
+	// Sessions, listed at /settings/security
+	route("DELETE /_auth/sessions/{session}", app.ProtectFunc(c.revokeSession, c.Required))
+	route("POST /_auth/sessions/revoke-others", app.ProtectFunc(c.revokeOtherSessions, c.Required))
+
+	// Admins signing in as a user, ended early or by expiry
+	route("POST /admin/user/{user}/impersonate", app.ProtectFunc(c.impersonate, c.AdminRequired))
+	route("POST "+endImpersonationPath, app.ProtectFunc(c.endImpersonation, nil))
+
+	// Passkeys
+	route("POST /_auth/passkeys/register/options", app.ProtectFunc(c.passkeyRegisterOptions, c.Required))
+	route("POST /_auth/passkeys/register", app.ProtectFunc(c.registerPasskey, c.Required))
+	route("POST /_auth/passkeys/signin/options", http.HandlerFunc(c.passkeySigninOptions))
+	route("POST /_auth/passkeys/signin", http.HandlerFunc(c.signinWithPasskey))
+
+	// GitHub and Google sign in
+	route("GET /_auth/social/{provider}", noindex(http.HandlerFunc(c.startSocialSignin)))
+	route("GET /_auth/social/{provider}/callback", noindex(http.HandlerFunc(c.finishSocialSignin)))
 
 	// Register view routes
-	http.Handle("/signin", app.ProtectFunc(c.signin, nil))
-	http.Handle("/signup", app.ProtectFunc(c.signup, nil))
+	route("/signin", app.ProtectFunc(c.signin, nil))
+	route("/signup", app.ProtectFunc(c.signup, nil))
+	route("GET /signin/2fa", noindex(app.ProtectFunc(c.twoFactor, nil)))
 
 	// Password reset routes
-	http.Handle("POST /reset-password", app.ProtectFunc(c.resetPassword, nil))
-	http.Handle("POST /forgot-password", app.ProtectFunc(c.sendPasswordToken, nil))
+	route("POST /reset-password", app.ProtectFunc(c.resetPassword, nil))
+	route("POST /forgot-password", app.ProtectFunc(c.sendPasswordToken, nil))
 
-	http.Handle("GET /forgot-password", app.Serve("forgot-password.html", func(app *application.App, w http.ResponseWriter, r *http.Request) bool {
+	route("GET /forgot-password", app.Serve("forgot-password.html", func(app *application.App, w http.ResponseWriter, r *http.Request) bool {
 		user, _, _ := c.Authenticate(r)
 		if user != nil {
 			c.Redirect(w, r, "/")
@@ -81,7 +139,7 @@ func (c *AuthController) Setup(app *application.App) {
 		return true
 	}))
 
-	http.Handle("GET /reset-password", app.Serve("reset-password.html", func(app *application.App, w http.ResponseWriter, r *http.Request) bool {
+	route("GET /reset-password", app.Serve("reset-password.html", func(app *application.App, w http.ResponseWriter, r *http.Request) bool {
 		user, _, _ := c.Authenticate(r)
 		if user != nil {
 			c.Redirect(w, r, "/")
@@ -103,21 +161,24 @@ func (c AuthController) Handle(r *http.Request) application.Handler {
 	return &c
 }
 
-var WebHostNames = []string{
-	"cloud.digitalocean.com", // health checks
-	"skysca.pe",
-	"web.skysca.pe", // legacy
-	"www.skysca.pe",
-	"theskyscape.com",
-	"www.theskyscape.com",
-}
-
 func (c *AuthController) Optional(app *application.App, w http.ResponseWriter, r *http.Request) bool {
 	if security.CheckReverseProxy(app, w, r) {
 		return false
 	}
 
-	return c.Controller.Optional(app, w, r)
+	if !c.checkImpersonation(w, r) {
+		return false
+	}
+
+	if !c.Controller.Optional(app, w, r) {
+		return false
+	}
+
+	if user, session, _ := c.Authenticate(r); user != nil {
+		logging.SetUser(r.Context(), user.ID)
+		c.trackSession(r, session)
+	}
+	return true
 }
 
 func (c *AuthController) Required(app *application.App, w http.ResponseWriter, r *http.Request) bool {
@@ -125,16 +186,48 @@ func (c *AuthController) Required(app *application.App, w http.ResponseWriter, r
 		return false
 	}
 
+	if !c.checkImpersonation(w, r) {
+		return false
+	}
+
 	if ok := c.Controller.Required(app, w, r); !ok {
 		return ok
 	}
 
 	profile := c.Use("profile").(*ProfileController)
 	profile.Request = r
-	if profile.CurrentProfile() == nil {
+	p := profile.CurrentProfile()
+	if p == nil {
 		c.Render(w, r, "setup.html", nil)
 		return false
 	}
+	logging.SetUser(r.Context(), p.UserID)
+
+	// Sessions created before a suspension are locked out too
+	if p.Suspended {
+		if s := models.ActiveSuspension(p.UserID); s != nil {
+			c.Redirect(w, r, s.URL())
+			return false
+		}
+	}
+
+	if _, session, err := c.Authenticate(r); err == nil {
+		c.trackSession(r, session)
+	}
+	return true
+}
+
+// AdminRequired allows only signed-in admins; everyone else gets a 404 so
+// admin routes aren't discoverable
+func (c *AuthController) AdminRequired(app *application.App, w http.ResponseWriter, r *http.Request) bool {
+	if !c.Required(app, w, r) {
+		return false
+	}
+
+	if user, _, err := c.Authenticate(r); err != nil || !user.IsAdmin {
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
+		return false
+	}
 
 	return true
 }
@@ -164,18 +257,56 @@ func (c *AuthController) signinWithRateLimit(w http.ResponseWriter, r *http.Requ
 	// Check rate limit: 5 attempts per 15 minutes
 	allowed, _, err := models.Check(ip, "signin", 5, 15*time.Minute)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	if !allowed {
-		c.Render(w, r, "error-message.html", errors.New("Too many signin attempts. Please try again in 15 minutes."))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("Too many signin attempts. Please try again in 15 minutes.")))
 		return
 	}
 
 	// Record the attempt before calling the handler
 	models.Record(ip, "signin", 15*time.Minute)
 
+	user, err := models.Auth.LookupUser(r.FormValue("handle"))
+	if err == nil {
+		// Guesses are also counted per account, since a botnet spreads
+		// them across too many IPs for the limit above to catch
+		risk := models.CheckSigninRisk(user.ID)
+		if risk.IsLocked() {
+			c.Render(w, r, "error-message.html", localize(r, errors.New("This account is temporarily locked after too many failed sign-in attempts. Try again later or reset your password.")))
+			return
+		}
+		if risk.NeedsCaptcha() && !captcha.Verify(r, ip) {
+			c.Render(w, r, "error-message.html", localize(r, errors.New("Please complete the CAPTCHA to sign in.")))
+			return
+		}
+
+		if bcrypt.CompareHashAndPassword(user.PassHash, []byte(r.FormValue("password"))) != nil {
+			c.failedSignin(r, user, ip)
+		} else {
+			// Suspended users who know their password are shown the
+			// suspension and appeal form instead of being signed in
+			if s := models.ActiveSuspension(user.ID); s != nil {
+				c.Redirect(w, r, s.URL())
+				return
+			}
+
+			// Users with two-factor authentication are asked for a code
+			// before they get a session
+			if models.TwoFactorEnabled(user.ID) {
+				models.Reset(ip, "signin")
+				if err := c.challengeTwoFactor(w, user, r.FormValue("next")); err != nil {
+					c.Render(w, r, "error-message.html", localize(r, err))
+					return
+				}
+				c.Redirect(w, r, "/signin/2fa")
+				return
+			}
+		}
+	}
+
 	// Call the devtools signin handler
 	c.Controller.HandleSignin(w, r)
 
@@ -183,6 +314,10 @@ func (c *AuthController) signinWithRateLimit(w http.ResponseWriter, r *http.Requ
 	for _, cookie := range w.Header()["Set-Cookie"] {
 		if strings.Contains(cookie, "theskyscape=") {
 			models.Reset(ip, "signin")
+			if user != nil {
+				models.ClearFailedSignins(user.ID)
+				c.checkDevice(r, user)
+			}
 			break
 		}
 	}
@@ -195,18 +330,26 @@ func (c *AuthController) signupWithRateLimit(w http.ResponseWriter, r *http.Requ
 	// Check rate limit: 3 attempts per hour
 	allowed, _, err := models.Check(ip, "signup", 3, 1*time.Hour)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	if !allowed {
-		c.Render(w, r, "error-message.html", errors.New("Too many signup attempts. Please try again in 1 hour."))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("Too many signup attempts. Please try again in 1 hour.")))
 		return
 	}
 
 	// Record the attempt before calling the handler
 	models.Record(ip, "signup", 1*time.Hour)
 
+	// While invite-only, signups need an unused invite code
+	if models.InviteOnly() {
+		if _, err := models.FindInvite(r.FormValue("invite")); err != nil {
+			c.Render(w, r, "error-message.html", localize(r, err))
+			return
+		}
+	}
+
 	// Call the devtools signup handler
 	c.Controller.HandleSignup(w, r)
 
@@ -220,26 +363,20 @@ func (c *AuthController) signupWithRateLimit(w http.ResponseWriter, r *http.Requ
 }
 
 func (c *AuthController) getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header first (for proxies/load balancers)
-	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
-		// X-Forwarded-For can contain multiple IPs, take the first one
-		if idx := strings.Index(forwarded, ","); idx > 0 {
-			return strings.TrimSpace(forwarded[:idx])
-		}
-		return strings.TrimSpace(forwarded)
-	}
-
-	// Check X-Real-IP header
-	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
-		return strings.TrimSpace(realIP)
-	}
-
-	// Fall back to RemoteAddr
-	if idx := strings.LastIndex(r.RemoteAddr, ":"); idx > 0 {
-		return r.RemoteAddr[:idx]
-	}
+	return clientip.From(r)
+}
 
-	return r.RemoteAddr
+// audit records a sensitive operation in the audit log, with the IP the
+// request came from
+func (c *AuthController) audit(r *http.Request, actorID, action, targetType, targetID, detail string) {
+	models.RecordAudit(&models.AuditLog{
+		ActorID:    actorID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IP:         c.getClientIP(r),
+		Detail:     detail,
+	})
 }
 
 func (c *AuthController) sendPasswordToken(w http.ResponseWriter, r *http.Request) {
@@ -248,13 +385,15 @@ func (c *AuthController) sendPasswordToken(w http.ResponseWriter, r *http.Reques
 		if token, err := models.PasswordResetTokens.Insert(&models.ResetPasswordToken{
 			UserID: user.ID,
 		}); err == nil {
-			err = models.Emails.Send(user.Email, "Skyscape Password Reset Token",
-				emailing.WithTemplate("password-reset.html"),
+			locale := requestLocale(r)
+			err = models.SendEmail(user.Email, i18n.T(locale, "Skyscape Password Reset Token"),
+				"password-reset.html",
+				emailing.WithData("t", i18n.For(locale)),
 				emailing.WithData("user", user),
 				emailing.WithData("year", time.Now().Year()),
 				emailing.WithData("resetURL", "https://www.theskyscape.com/reset-password?token="+token.ID))
 			if err != nil {
-				log.Println("Failed to send password reset email:", err)
+				slog.Error("failed to send password reset email", "error", err)
 			}
 		}
 	}
@@ -265,63 +404,84 @@ func (c *AuthController) sendPasswordToken(w http.ResponseWriter, r *http.Reques
 
 func (c *AuthController) resetPassword(w http.ResponseWriter, r *http.Request) {
 	if token := r.FormValue("token"); token == "" {
-		c.Render(w, r, "error-message.html", errors.New("missing token"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("missing token")))
 		return
 	}
 
 	token, err := models.PasswordResetTokens.Get(r.FormValue("token"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	user := token.User()
 	if user == nil {
-		c.Render(w, r, "error-message.html", errors.New("token no longer valid"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("token no longer valid")))
 		return
 	}
 
 	newPassword := r.FormValue("password")
 	confirmPassword := r.FormValue("confirm-password")
 	if newPassword != confirmPassword {
-		c.Render(w, r, "error-message.html", errors.New("passwords do not match"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("passwords do not match")))
 		return
 	}
 
 	if len(newPassword) < 8 {
-		c.Render(w, r, "error-message.html", errors.New("password must be at least 8 characters"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("password must be at least 8 characters")))
 		return
 	}
 
 	user.PassHash, err = bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	if err = models.Auth.Users.Update(user); err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	if err = models.PasswordResetTokens.Delete(token); err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
+	c.audit(r, user.ID, models.AuditPasswordChanged, "user", user.ID, "reset link")
+	models.ClearFailedSignins(user.ID)
 
+	// A new password isn't enough to get past two-factor authentication
+	if models.TwoFactorEnabled(user.ID) {
+		if err = c.challengeTwoFactor(w, user, "/"); err != nil {
+			c.Render(w, r, "error-message.html", localize(r, err))
+			return
+		}
+		c.Redirect(w, r, "/signin/2fa")
+		return
+	}
+
+	if err = c.startSession(w, r, user); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+
+}
+
+// startSession signs the user in on this browser
+func (c *AuthController) startSession(w http.ResponseWriter, r *http.Request, user *authentication.User) error {
 	session, err := models.Auth.Sessions.Insert(&authentication.Session{
 		UserID:    user.ID,
 		ExpiresAt: time.Now().Add(time.Hour * 24 * 30),
 	})
-
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
-		return
+		return err
 	}
 
 	cookie, _ := session.Token()
 	http.SetCookie(w, &http.Cookie{
-		Name:     "theskyscape",
+		Name:     sessionCookie,
 		Value:    cookie,
 		Path:     "/",
 		SameSite: http.SameSiteLaxMode,
@@ -329,7 +489,740 @@ func (c *AuthController) resetPassword(w http.ResponseWriter, r *http.Request) {
 		HttpOnly: true,
 		Secure:   true,
 	})
+	models.ClearFailedSignins(user.ID)
+	c.checkDevice(r, user)
+	return nil
+}
+
+// failedSignin counts a wrong password against the account, emailing the
+// owner once failures pile up and auditing a lockout
+func (c *AuthController) failedSignin(r *http.Request, user *authentication.User, ip string) {
+	risk := models.RecordFailedSignin(user.ID, ip, r.UserAgent())
+	if risk.Failures == models.LockoutThreshold {
+		slog.WarnContext(r.Context(), "account locked after failed sign-ins", "handle", user.Handle, "ips", risk.IPs)
+		c.audit(r, user.ID, models.AuditAccountLocked, "user", user.ID, strconv.Itoa(risk.IPs)+" IPs")
+	}
+	if risk.Failures < models.AlertThreshold {
+		return
+	}
+
+	// At most one alert an hour, however long the guessing goes on
+	if allowed, _, _ := models.Check(user.ID, "signin-alert", 1, time.Hour); !allowed {
+		return
+	}
+	models.Record(user.ID, "signin-alert", time.Hour)
+	go notifyFailedSignins(user, risk)
+}
+
+// notifyFailedSignins emails the owner of an account someone is guessing
+// the password of. Like new sign-in alerts it ignores their settings.
+func notifyFailedSignins(user *authentication.User, risk *models.SigninRisk) {
+	locale := models.EmailLocale(user.ID)
+	err := models.SendEmail(user.Email, i18n.T(locale, "Failed sign-in attempts on your account"),
+		"failed-signins.html",
+		emailing.WithData("t", i18n.For(locale)),
+		emailing.WithData("user", user),
+		emailing.WithData("failures", risk.Failures),
+		emailing.WithData("ips", risk.IPs),
+		emailing.WithData("distributed", risk.IsDistributed()),
+		emailing.WithData("locked", risk.IsLocked()),
+		emailing.WithData("year", time.Now().Year()))
+	if err != nil {
+		slog.Error("failed to send failed sign-in email", "user_id", user.ID, "error", err)
+	}
+}
+
+// checkDevice alerts the user when they sign in with a browser or from a
+// network they haven't used before
+func (c *AuthController) checkDevice(r *http.Request, user *authentication.User) {
+	device, ip := push.DeviceLabel(r.UserAgent()), c.getClientIP(r)
+	go func() {
+		if !models.RecognizeSignin(user.ID, device, ip) {
+			notifyNewSignin(user, device, ip)
+		}
+	}()
+}
+
+// notifyNewSignin pushes and emails a new-device alert. Unlike other
+// notifications it ignores the user's settings, since it may be the only
+// sign their account was taken over.
+func notifyNewSignin(user *authentication.User, device, ip string) {
+	locale := models.EmailLocale(user.ID)
+	push.SendNotification(user.ID, user.ID, models.NotifySignin,
+		i18n.T(locale, "New sign-in to your account"),
+		i18n.T(locale, "%s from %s", device, ip),
+		"/settings/security")
+
+	err := models.SendEmail(user.Email, i18n.T(locale, "New sign-in to your account"),
+		"new-signin.html",
+		emailing.WithData("t", i18n.For(locale)),
+		emailing.WithData("user", user),
+		emailing.WithData("device", device),
+		emailing.WithData("ip", ip),
+		emailing.WithData("time", time.Now().UTC().Format("Jan 2, 2006 15:04 MST")),
+		emailing.WithData("year", time.Now().Year()))
+	if err != nil {
+		slog.Error("failed to send new sign-in email", "user_id", user.ID, "error", err)
+	}
+}
+
+// trackSession records which device a session belongs to and when it was
+// last used
+func (c *AuthController) trackSession(r *http.Request, session *authentication.Session) {
+	// Impersonations stay out of the user's session list
+	if session == nil || c.impersonating(r) {
+		return
+	}
+	models.TrackSession(session, push.DeviceLabel(r.UserAgent()), r.UserAgent(), c.getClientIP(r))
+}
+
+// revokeSession signs one of the user's other sessions out
+func (c *AuthController) revokeSession(w http.ResponseWriter, r *http.Request) {
+	user, current, err := c.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	device, err := models.SessionDevices.Get(r.PathValue("session"))
+	if err != nil || device.UserID != user.ID {
+		c.Render(w, r, "error-message.html", localize(r, application.ErrNotFound))
+		return
+	}
+	if device.SessionID == current.ID {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("sign out to end this session")))
+		return
+	}
+
+	if err = device.Revoke(); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+	c.audit(r, user.ID, models.AuditSessionsRevoked, "user", user.ID, device.Device)
 
 	c.Refresh(w, r)
+}
+
+// revokeOtherSessions signs the user out everywhere but this browser
+func (c *AuthController) revokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	user, current, err := c.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	if err = models.RevokeOtherSessions(user.ID, current.ID); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+	c.audit(r, user.ID, models.AuditSessionsRevoked, "user", user.ID, "all other sessions")
+
+	c.Refresh(w, r)
+}
+
+// challengeTwoFactor holds the sign-in of a user whose password checked out
+// until they enter their authenticator code at /signin/2fa
+func (c *AuthController) challengeTwoFactor(w http.ResponseWriter, user *authentication.User, next string) error {
+	challenge, err := models.NewTwoFactorChallenge(user.ID, next)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     challengeCookie,
+		Value:    challenge.ID,
+		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
+		Expires:  challenge.ExpiresAt,
+		HttpOnly: true,
+		Secure:   true,
+	})
+	return nil
+}
+
+// currentChallenge returns the sign-in this browser is finishing
+func (c *AuthController) currentChallenge(r *http.Request) (*models.TwoFactorChallenge, error) {
+	cookie, err := r.Cookie(challengeCookie)
+	if err != nil {
+		return nil, errors.New("sign-in expired, please sign in again")
+	}
+	return models.FindTwoFactorChallenge(cookie.Value)
+}
+
+func (c *AuthController) twoFactor(w http.ResponseWriter, r *http.Request) {
+	if user, _, _ := c.Authenticate(r); user != nil {
+		c.Redirect(w, r, "/")
+		return
+	}
+
+	if _, err := c.currentChallenge(r); err != nil {
+		c.Redirect(w, r, "/signin")
+		return
+	}
+
+	c.Render(w, r, "signin-2fa.html", nil)
+}
+
+// verifyTwoFactor finishes a sign-in with a code from the user's
+// authenticator app or one of their recovery codes
+func (c *AuthController) verifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	challenge, err := c.currentChallenge(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	// Codes are only six digits, so guesses are limited per account rather
+	// than per IP
+	allowed, _, err := models.Check(challenge.UserID, "2fa", 5, 15*time.Minute)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+	if !allowed {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("Too many attempts. Please try again in 15 minutes.")))
+		return
+	}
+	models.Record(challenge.UserID, "2fa", 15*time.Minute)
+
+	code := r.FormValue("code")
+	secret := models.TwoFactorFor(challenge.UserID)
+	if secret == nil || !secret.Enabled || !(secret.Verify(code) || secret.UseRecoveryCode(code)) {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("invalid code")))
+		return
+	}
+	models.Reset(challenge.UserID, "2fa")
+
+	user, err := models.Auth.Users.Get(challenge.UserID)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	models.TwoFactorChallenges.Delete(challenge)
+	http.SetCookie(w, &http.Cookie{Name: challengeCookie, Path: "/", MaxAge: -1})
+
+	if err = c.startSession(w, r, user); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	// Restore the user's language setting on this device
+	if profile, err := models.Profiles.Get(user.ID); err == nil && i18n.Supported(profile.Locale) {
+		setLocaleCookie(w, profile.Locale)
+	}
+
+	if next := localPath(challenge.Next); next != "" {
+		c.Redirect(w, r, next)
+		return
+	}
+	c.Redirect(w, r, "/")
+}
+
+// errPasskeysOff is returned by the passkey routes when WEBAUTHN_RP_ID
+// isn't set
+var errPasskeysOff = errors.New("passkeys aren't available on this server")
+
+// localPath returns next if it's a path on this site to redirect to after
+// signing in, or "" otherwise. Browsers take //host and /\host to be
+// other sites, so those are refused too.
+func localPath(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return ""
+	}
+	return next
+}
+
+// relyingParty scopes passkeys to WEBAUTHN_RP_ID. It's never taken from
+// the request: apps are hosted on subdomains of the site domain, so only
+// the exact origins in WEBAUTHN_ORIGINS (by default the web host) may run
+// a ceremony, not every host under the RP ID.
+func relyingParty() (*webauthn.RelyingParty, error) {
+	id := os.Getenv("WEBAUTHN_RP_ID")
+	if id == "" {
+		return nil, errPasskeysOff
+	}
+
+	origins := []string{"https://" + hosts.Default.WebHost}
+	if value := os.Getenv("WEBAUTHN_ORIGINS"); value != "" {
+		origins = nil
+		for origin := range strings.SplitSeq(value, ",") {
+			if origin = strings.TrimSuffix(strings.TrimSpace(origin), "/"); origin != "" {
+				origins = append(origins, origin)
+			}
+		}
+	}
+	return &webauthn.RelyingParty{ID: id, Name: "The Skyscape", Origins: origins}, nil
+}
+
+// passkeyCredential is a browser's answer to a passkey prompt, with its
+// binary fields base64url encoded
+type passkeyCredential struct {
+	Challenge         string `json:"challenge"`
+	ID                string `json:"id"`
+	Name              string `json:"name"`
+	Next              string `json:"next"`
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AttestationObject string `json:"attestationObject"`
+	AuthenticatorData string `json:"authenticatorData"`
+	Signature         string `json:"signature"`
+}
+
+// passkeyRegisterOptions starts adding a passkey to the signed-in user's
+// account, returning options for navigator.credentials.create
+func (c *AuthController) passkeyRegisterOptions(w http.ResponseWriter, r *http.Request) {
+	user, _, err := c.Authenticate(r)
+	if err != nil {
+		JSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	rp, err := relyingParty()
+	if err != nil {
+		JSONError(w, http.StatusServiceUnavailable, localize(r, err).Error())
+		return
+	}
+
+	challenge, err := models.NewPasskeyChallenge(user.ID, models.PasskeyRegister)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, localize(r, err).Error())
+		return
+	}
+
+	// Don't let the same authenticator register twice
+	exclude := []map[string]string{}
+	for _, passkey := range models.PasskeysOf(user.ID) {
+		exclude = append(exclude, map[string]string{"type": "public-key", "id": passkey.CredentialID})
+	}
+
+	params := []map[string]any{}
+	for _, alg := range webauthn.Algorithms {
+		params = append(params, map[string]any{"type": "public-key", "alg": alg})
+	}
+
+	JSONSuccess(w, map[string]any{
+		"challenge": challenge,
+		"rp":        map[string]string{"id": rp.ID, "name": rp.Name},
+		"user": map[string]string{
+			"id":          webauthn.Encoding.EncodeToString([]byte(user.ID)),
+			"name":        user.Handle,
+			"displayName": user.Name,
+		},
+		"pubKeyCredParams":   params,
+		"excludeCredentials": exclude,
+		"authenticatorSelection": map[string]any{
+			"residentKey":        "required",
+			"requireResidentKey": true,
+			"userVerification":   "preferred",
+		},
+		"attestation": "none",
+		"timeout":     models.PasskeyChallengeTTL.Milliseconds(),
+	})
+}
+
+// registerPasskey saves the passkey the browser created
+func (c *AuthController) registerPasskey(w http.ResponseWriter, r *http.Request) {
+	user, _, err := c.Authenticate(r)
+	if err != nil {
+		JSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req passkeyCredential
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err = models.UsePasskeyChallenge(req.Challenge, user.ID, models.PasskeyRegister); err != nil {
+		JSONError(w, http.StatusBadRequest, localize(r, err).Error())
+		return
+	}
+
+	rp, err := relyingParty()
+	if err != nil {
+		JSONError(w, http.StatusServiceUnavailable, localize(r, err).Error())
+		return
+	}
+
+	clientData, _ := webauthn.Encoding.DecodeString(req.ClientDataJSON)
+	attestation, _ := webauthn.Encoding.DecodeString(req.AttestationObject)
+	credential, err := rp.Register(req.Challenge, clientData, attestation)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, localize(r, err).Error())
+		return
+	}
+
+	credentialID := webauthn.Encoding.EncodeToString(credential.ID)
+	if _, err := models.FindPasskey(credentialID); err == nil {
+		JSONError(w, http.StatusConflict, localize(r, errors.New("this passkey is already registered")).Error())
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if len(name) > 50 {
+		name = name[:50]
+	}
+
+	_, err = models.WebAuthnCredentials.Insert(&models.WebAuthnCredential{
+		UserID:       user.ID,
+		CredentialID: credentialID,
+		PublicKey:    webauthn.Encoding.EncodeToString(credential.PublicKey),
+		SignCount:    int64(credential.SignCount),
+		Name:         name,
+	})
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, localize(r, err).Error())
+		return
+	}
+	c.audit(r, user.ID, models.AuditPasskeyAdded, "user", user.ID, name)
+
+	JSONSuccess(w, map[string]string{"redirect": "/settings/security"})
+}
+
+// passkeySigninOptions starts a passkey sign-in, returning options for
+// navigator.credentials.get. The browser offers whichever of the user's
+// passkeys it has, so no account is named up front.
+func (c *AuthController) passkeySigninOptions(w http.ResponseWriter, r *http.Request) {
+	rp, err := relyingParty()
+	if err != nil {
+		JSONError(w, http.StatusServiceUnavailable, localize(r, err).Error())
+		return
+	}
+
+	challenge, err := models.NewPasskeyChallenge("", models.PasskeySignin)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, localize(r, err).Error())
+		return
+	}
+
+	JSONSuccess(w, map[string]any{
+		"challenge":        challenge,
+		"rpId":             rp.ID,
+		"userVerification": "preferred",
+		"timeout":          models.PasskeyChallengeTTL.Milliseconds(),
+	})
+}
+
+// signinWithPasskey signs a user in with a passkey. Passkeys that verified
+// the user (Touch ID, a PIN) count as both factors; otherwise users with
+// 2FA still enter a code.
+func (c *AuthController) signinWithPasskey(w http.ResponseWriter, r *http.Request) {
+	ip := c.getClientIP(r)
+	allowed, _, err := models.Check(ip, "signin", 5, 15*time.Minute)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, localize(r, err).Error())
+		return
+	}
+	if !allowed {
+		JSONError(w, http.StatusTooManyRequests, localize(r, errors.New("Too many signin attempts. Please try again in 15 minutes.")).Error())
+		return
+	}
+	models.Record(ip, "signin", 15*time.Minute)
+
+	var req passkeyCredential
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err = models.UsePasskeyChallenge(req.Challenge, "", models.PasskeySignin); err != nil {
+		JSONError(w, http.StatusBadRequest, localize(r, err).Error())
+		return
+	}
+
+	passkey, err := models.FindPasskey(req.ID)
+	if err != nil {
+		JSONError(w, http.StatusUnauthorized, localize(r, errors.New("passkey not recognized")).Error())
+		return
+	}
+
+	rp, err := relyingParty()
+	if err != nil {
+		JSONError(w, http.StatusServiceUnavailable, localize(r, err).Error())
+		return
+	}
 
+	clientData, _ := webauthn.Encoding.DecodeString(req.ClientDataJSON)
+	authData, _ := webauthn.Encoding.DecodeString(req.AuthenticatorData)
+	signature, _ := webauthn.Encoding.DecodeString(req.Signature)
+	assertion, err := rp.Verify(req.Challenge, passkey.Key(), uint32(passkey.SignCount), clientData, authData, signature)
+	if err != nil {
+		JSONError(w, http.StatusUnauthorized, localize(r, err).Error())
+		return
+	}
+
+	passkey.SignCount = int64(assertion.SignCount)
+	passkey.LastUsedAt = time.Now()
+	models.WebAuthnCredentials.Update(passkey)
+
+	user, err := models.Auth.Users.Get(passkey.UserID)
+	if err != nil {
+		JSONError(w, http.StatusUnauthorized, localize(r, errors.New("passkey not recognized")).Error())
+		return
+	}
+	models.Reset(ip, "signin")
+
+	if s := models.ActiveSuspension(user.ID); s != nil {
+		JSONSuccess(w, map[string]string{"redirect": s.URL()})
+		return
+	}
+
+	next := cmp.Or(localPath(req.Next), "/")
+
+	if !assertion.UserVerified && models.TwoFactorEnabled(user.ID) {
+		if err = c.challengeTwoFactor(w, user, next); err != nil {
+			JSONError(w, http.StatusInternalServerError, localize(r, err).Error())
+			return
+		}
+		JSONSuccess(w, map[string]string{"redirect": "/signin/2fa"})
+		return
+	}
+
+	if err = c.startSession(w, r, user); err != nil {
+		JSONError(w, http.StatusInternalServerError, localize(r, err).Error())
+		return
+	}
+
+	// Restore the user's language setting on this device
+	if profile, err := models.Profiles.Get(user.ID); err == nil && i18n.Supported(profile.Locale) {
+		setLocaleCookie(w, profile.Locale)
+	}
+
+	JSONSuccess(w, map[string]string{"redirect": next})
+}
+
+// CaptchaSiteKey returns the key for the sign in CAPTCHA widget, or ""
+// when CAPTCHAs aren't configured
+func (c *AuthController) CaptchaSiteKey() string {
+	if !captcha.Enabled() {
+		return ""
+	}
+	return captcha.SiteKey()
+}
+
+// PasskeysEnabled reports whether passkeys can be added and signed in
+// with, which needs WEBAUTHN_RP_ID
+func (c *AuthController) PasskeysEnabled() bool {
+	_, err := relyingParty()
+	return err == nil
+}
+
+// SocialProviders returns the accounts users can sign in with besides
+// a password, e.g. GitHub
+func (c *AuthController) SocialProviders() []*sociallogin.Provider {
+	return sociallogin.Providers()
+}
+
+// socialRedirectURI is where a provider sends users back to, which has to
+// match the callback URL registered with it
+func socialRedirectURI(provider string) string {
+	baseURL := "https://www.theskyscape.com"
+	if prefix := os.Getenv("PREFIX"); prefix != "" {
+		baseURL = "https://" + prefix + ".theskyscape.com"
+	}
+	return baseURL + "/_auth/social/" + provider + "/callback"
+}
+
+// startSocialSignin sends the user to the provider to approve signing in.
+// A user who is already signed in is connecting the account to theirs.
+func (c *AuthController) startSocialSignin(w http.ResponseWriter, r *http.Request) {
+	provider, err := sociallogin.Get(r.PathValue("provider"))
+	if err != nil {
+		c.RenderError(w, r, localize(r, err))
+		return
+	}
+
+	linkUserID := ""
+	if user, _, err := c.Authenticate(r); err == nil {
+		linkUserID = user.ID
+	}
+
+	next := localPath(r.URL.Query().Get("next"))
+
+	signin, err := models.NewSocialSignin(provider.Name, next, r.URL.Query().Get("invite"), linkUserID)
+	if err != nil {
+		c.RenderError(w, r, localize(r, err))
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     socialCookie,
+		Value:    signin.ID,
+		Path:     "/_auth/social",
+		SameSite: http.SameSiteLaxMode,
+		Expires:  signin.ExpiresAt,
+		HttpOnly: true,
+		Secure:   true,
+	})
+	http.Redirect(w, r, provider.AuthURL(signin.ID, socialRedirectURI(provider.Name)), http.StatusFound)
+}
+
+// finishSocialSignin handles the provider sending the user back. It signs
+// in the user the account is connected to, connects it to the signed-in
+// user, or signs up a new user, counting against the same limits as
+// password sign in and sign up.
+func (c *AuthController) finishSocialSignin(w http.ResponseWriter, r *http.Request) {
+	ip := c.getClientIP(r)
+	allowed, _, err := models.Check(ip, "signin", 5, 15*time.Minute)
+	if err != nil {
+		c.RenderError(w, r, localize(r, err))
+		return
+	}
+	if !allowed {
+		c.RenderError(w, r, localize(r, errors.New("Too many signin attempts. Please try again in 15 minutes.")))
+		return
+	}
+	models.Record(ip, "signin", 15*time.Minute)
+
+	provider, err := sociallogin.Get(r.PathValue("provider"))
+	if err != nil {
+		c.RenderError(w, r, localize(r, err))
+		return
+	}
+
+	query := r.URL.Query()
+	cookie, err := r.Cookie(socialCookie)
+	if err != nil || cookie.Value != query.Get("state") {
+		c.RenderError(w, r, localize(r, errors.New("sign-in expired, please sign in again")))
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: socialCookie, Path: "/_auth/social", MaxAge: -1})
+
+	signin, err := models.UseSocialSignin(cookie.Value, provider.Name)
+	if err != nil {
+		c.RenderError(w, r, localize(r, err))
+		return
+	}
+
+	// The user turned the provider down
+	if query.Get("error") != "" {
+		if signin.LinkUserID != "" {
+			c.Redirect(w, r, "/settings/security")
+		} else {
+			c.Redirect(w, r, "/signin")
+		}
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), query.Get("code"), socialRedirectURI(provider.Name))
+	if err != nil {
+		slog.WarnContext(r.Context(), "social sign in failed", "provider", provider.Name, "error", err)
+		c.RenderError(w, r, localize(r, errors.New("could not sign you in, please try again")))
+		return
+	}
+
+	// Connecting the account from /settings/security
+	if signin.LinkUserID != "" {
+		user, _, err := c.Authenticate(r)
+		if err != nil || user.ID != signin.LinkUserID {
+			c.RenderError(w, r, localize(r, errors.New("sign-in expired, please sign in again")))
+			return
+		}
+		if _, err = models.LinkSocialIdentity(user.ID, identity.Provider, identity.Subject, identity.Email); err != nil {
+			c.RenderError(w, r, localize(r, err))
+			return
+		}
+		c.audit(r, user.ID, models.AuditSocialConnected, "user", user.ID, identity.Provider)
+		models.Reset(ip, "signin")
+		c.Redirect(w, r, "/settings/security")
+		return
+	}
+
+	var user *authentication.User
+	next := cmp.Or(signin.Next, "/")
+	if link, err := models.FindSocialIdentity(identity.Provider, identity.Subject); err == nil {
+		if user, err = models.Auth.Users.Get(link.UserID); err != nil {
+			c.RenderError(w, r, localize(r, errors.New("could not sign you in, please try again")))
+			return
+		}
+	} else {
+		if user, err = c.socialSignup(r, ip, identity, signin.Invite); err != nil {
+			c.RenderError(w, r, localize(r, err))
+			return
+		}
+		// New users set up their profile first, like after signing up
+		next = "/profile"
+	}
+	models.Reset(ip, "signin")
+	logging.SetUser(r.Context(), user.ID)
+
+	if s := models.ActiveSuspension(user.ID); s != nil {
+		c.Redirect(w, r, s.URL())
+		return
+	}
+
+	if models.TwoFactorEnabled(user.ID) {
+		if err = c.challengeTwoFactor(w, user, next); err != nil {
+			c.RenderError(w, r, localize(r, err))
+			return
+		}
+		c.Redirect(w, r, "/signin/2fa")
+		return
+	}
+
+	if err = c.startSession(w, r, user); err != nil {
+		c.RenderError(w, r, localize(r, err))
+		return
+	}
+
+	// Restore the user's language setting on this device
+	if profile, err := models.Profiles.Get(user.ID); err == nil && i18n.Supported(profile.Locale) {
+		setLocaleCookie(w, profile.Locale)
+	}
+
+	c.Redirect(w, r, next)
+}
+
+// socialSignup creates an account for someone signing in with a provider
+// account that isn't connected to anyone yet
+func (c *AuthController) socialSignup(r *http.Request, ip string, identity *sociallogin.Identity, code string) (*authentication.User, error) {
+	// Only trust verified addresses, so nobody can sign up as someone else
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, errors.New("your account has no verified email address")
+	}
+
+	// Existing users connect the account themselves, after signing in
+	if models.Auth.Users.Count("WHERE Email = ?", identity.Email) > 0 {
+		return nil, errors.New("an account with this email already exists, sign in and connect it from your security settings")
+	}
+
+	allowed, _, err := models.Check(ip, "signup", 3, 1*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, errors.New("Too many signup attempts. Please try again in 1 hour.")
+	}
+	models.Record(ip, "signup", 1*time.Hour)
+
+	invite, inviteErr := models.FindInvite(code)
+	if models.InviteOnly() && inviteErr != nil {
+		return nil, inviteErr
+	}
+
+	user, err := models.Auth.Users.Insert(&authentication.User{
+		Name:   cmp.Or(identity.Name, identity.Handle),
+		Handle: models.AvailableHandle(identity.Handle),
+		Email:  identity.Email,
+		Avatar: identity.Avatar,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = models.LinkSocialIdentity(user.ID, identity.Provider, identity.Subject, identity.Email); err != nil {
+		models.Auth.Users.Delete(user)
+		return nil, err
+	}
+
+	if inviteErr == nil {
+		invite.Redeem(user.ID)
+	}
+	models.Reset(ip, "signup")
+	welcome(requestLocale(r), user)
+	return user, nil
 }
@@ -0,0 +1,265 @@
+package controllers
+
+import (
+	"crypto/hmac"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"www.theskyscape.com/internal/emailpreview"
+	"www.theskyscape.com/internal/i18n"
+	"www.theskyscape.com/internal/mailhooks"
+	"www.theskyscape.com/models"
+)
+
+func Broadcasts() (string, *BroadcastsController) {
+	return "broadcasts", &BroadcastsController{}
+}
+
+type BroadcastsController struct {
+	application.Controller
+}
+
+func (c *BroadcastsController) Setup(app *application.App) {
+	c.Controller.Setup(app)
+	auth := c.Use("auth").(*AuthController)
+
+	route("GET /admin/emails", c.Serve("admin-emails.html", auth.AdminRequired))
+	route("POST /admin/emails", c.ProtectFunc(c.send, auth.AdminRequired))
+	route("GET /admin/emails/templates/{template}", c.ProtectFunc(c.previewTemplate, auth.AdminRequired))
+	route("POST /admin/emails/templates/{template}", c.ProtectFunc(c.testTemplate, auth.AdminRequired))
+
+	// Delivery webhooks (no CSRF protection needed - Resend signs requests)
+	route("POST /webhooks/resend", http.HandlerFunc(c.deliveryWebhook))
+
+	// Unsubscribe links come from emails, so they're authorized by token
+	route("GET /unsubscribe", c.Serve("unsubscribe.html", c.tokenRequired))
+	route("POST /unsubscribe", c.ProtectFunc(c.unsubscribe, c.tokenRequired))
+}
+
+func (c BroadcastsController) Handle(r *http.Request) application.Handler {
+	c.Request = r
+	return &c
+}
+
+// tokenRequired checks the unsubscribe token for the user in the query
+func (c *BroadcastsController) tokenRequired(app *application.App, w http.ResponseWriter, r *http.Request) bool {
+	profile, err := models.Profiles.Get(r.FormValue("user"))
+	if err != nil || !hmac.Equal([]byte(r.FormValue("token")), []byte(profile.UnsubscribeToken())) {
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
+		return false
+	}
+	return true
+}
+
+// RecentBroadcasts returns previously sent broadcasts
+func (c *BroadcastsController) RecentBroadcasts() []*models.Broadcast {
+	broadcasts, _ := models.Broadcasts.Search(`
+		ORDER BY CreatedAt DESC
+		LIMIT 50
+	`)
+	return broadcasts
+}
+
+// AudienceSize returns how many users are in an audience
+func (c *BroadcastsController) AudienceSize(audience string) int {
+	recipients, _ := models.BroadcastRecipients(audience)
+	return len(recipients)
+}
+
+// EmailTemplates lists the email templates that can be previewed
+func (c *BroadcastsController) EmailTemplates() []string {
+	return emailpreview.Names()
+}
+
+// UnsubscribeProfile returns the profile from the unsubscribe link
+func (c *BroadcastsController) UnsubscribeProfile() *models.Profile {
+	profile, err := models.Profiles.Get(c.URL.Query().Get("user"))
+	if err != nil {
+		return nil
+	}
+	return profile
+}
+
+func (c *BroadcastsController) send(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	admin, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	subject := strings.TrimSpace(r.FormValue("subject"))
+	body := strings.TrimSpace(r.FormValue("body"))
+	if subject == "" || body == "" {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("subject and body are required")))
+		return
+	}
+
+	audience := r.FormValue("audience")
+	if _, err = models.BroadcastRecipients(audience); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	b := &models.Broadcast{
+		CreatedBy: admin.ID,
+		Subject:   subject,
+		Body:      body,
+		Audience:  audience,
+	}
+
+	// Test sends go only to the admin and aren't recorded
+	if r.FormValue("test") == "true" {
+		profile, err := models.Profiles.Get(admin.ID)
+		if err != nil {
+			c.Render(w, r, "error-message.html", localize(r, err))
+			return
+		}
+
+		if err = b.SendTo(admin, b.HTML(), profile.UnsubscribeURL()); err != nil {
+			c.Render(w, r, "error-message.html", localize(r, err))
+			return
+		}
+
+		w.Write([]byte("Test email sent to " + admin.Email))
+		return
+	}
+
+	b.Status = models.BroadcastSending
+	if b, err = models.Broadcasts.Insert(b); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	slog.InfoContext(r.Context(), "admin started broadcast", "admin", admin.Handle, "broadcast_id", b.ID, "audience", audience)
+	go b.Send()
+	c.Refresh(w, r)
+}
+
+func (c *BroadcastsController) unsubscribe(w http.ResponseWriter, r *http.Request) {
+	profile, err := models.Profiles.Get(r.FormValue("user"))
+	if err != nil {
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
+		return
+	}
+
+	profile.EmailOptOut = r.FormValue("resubscribe") != "true"
+	if err = models.Profiles.Update(profile); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+// previewTemplate renders an email template with sample data addressed to
+// the admin, in the locale from the query
+func (c *BroadcastsController) previewTemplate(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	admin, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.RenderError(w, r, localize(r, err))
+		return
+	}
+
+	name := r.PathValue("template")
+	if !slices.Contains(emailpreview.Names(), name) {
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
+		return
+	}
+
+	locale := r.URL.Query().Get("locale")
+	if !i18n.Supported(locale) {
+		locale = i18n.Default
+	}
+
+	html, err := emailpreview.Render(name, emailpreview.SampleFor(name, locale, admin).Data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(html))
+}
+
+// testTemplate sends an email template with sample data to the admin
+func (c *BroadcastsController) testTemplate(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	admin, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	name := r.PathValue("template")
+	if !slices.Contains(emailpreview.Names(), name) {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("email template not found")))
+		return
+	}
+
+	locale := models.EmailLocale(admin.ID)
+	sample := emailpreview.SampleFor(name, locale, admin)
+
+	// Catch template errors here rather than in the mail provider
+	if _, err = emailpreview.Render(name, sample.Data); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	if err = models.SendEmail(admin.Email, sample.Subject, name, emailpreview.Options(sample.Data)...); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	slog.InfoContext(r.Context(), "admin sent test email", "admin", admin.Handle, "template", name)
+	w.Write([]byte("Test email sent to " + admin.Email))
+}
+
+// deliveryWebhook records delivery, bounce and complaint events from the
+// email provider, suppressing addresses that hard bounced or complained
+func (c *BroadcastsController) deliveryWebhook(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	event, err := mailhooks.Verify(payload, r.Header)
+	if err != nil {
+		slog.WarnContext(r.Context(), "email webhook signature verification failed", "error", err)
+		http.Error(w, "invalid signature", http.StatusBadRequest)
+		return
+	}
+
+	var status string
+	switch event.Type {
+	case mailhooks.EventDelivered:
+		status = models.EmailDelivered
+	case mailhooks.EventBounced:
+		status = models.EmailBounced
+	case mailhooks.EventComplained:
+		status = models.EmailComplained
+	default:
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	for _, to := range event.Data.To {
+		if err := models.RecordEmailEvent(to, status, event.Detail(), event.Permanent()); err != nil {
+			slog.ErrorContext(r.Context(), "failed to record email event", "event", event.Type, "error", err)
+			http.Error(w, "failed to record event", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if event.Permanent() {
+		slog.InfoContext(r.Context(), "email address suppressed", "event", event.Type, "recipients", len(event.Data.To))
+	}
+	w.WriteHeader(http.StatusOK)
+}
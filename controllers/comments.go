@@ -4,14 +4,24 @@ import (
 	"cmp"
 	"errors"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/The-Skyscape/devtools/pkg/authentication"
 	"github.com/The-Skyscape/devtools/pkg/emailing"
+	"www.theskyscape.com/internal/i18n"
+	"www.theskyscape.com/internal/migration"
+	"www.theskyscape.com/internal/push"
+	"www.theskyscape.com/internal/webhooks"
 	"www.theskyscape.com/models"
 )
 
+// maxCommentLine bounds the line a file comment can point at
+const maxCommentLine = 1_000_000
+
 func Comments() (string, application.Handler) {
 	return "comments", &CommentsController{}
 }
@@ -24,9 +34,14 @@ func (c *CommentsController) Setup(app *application.App) {
 	c.Controller.Setup(app)
 	auth := app.Use("auth").(*AuthController)
 
-	http.Handle("POST /comment", c.ProtectFunc(c.create, auth.Required))
-	http.Handle("PUT /comment/{comment}", c.ProtectFunc(c.update, auth.Required))
-	http.Handle("DELETE /comment/{comment}", c.ProtectFunc(c.delete, auth.Required))
+	route("POST /comment", c.ProtectFunc(c.create, auth.Required))
+	route("PUT /comment/{comment}", c.ProtectFunc(c.update, auth.Required))
+	route("DELETE /comment/{comment}", c.ProtectFunc(c.delete, auth.Required))
+	route("POST /comment/{comment}/restore", c.ProtectFunc(c.restore, auth.Required))
+	route("POST /comment/{comment}/resolve", c.ProtectFunc(c.resolve, auth.Required))
+	route("DELETE /comment/{comment}/resolve", c.ProtectFunc(c.reopen, auth.Required))
+
+	migration.MigrateComments()
 }
 
 func (c CommentsController) Handle(r *http.Request) application.Handler {
@@ -38,7 +53,7 @@ func (c *CommentsController) create(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -47,27 +62,59 @@ func (c *CommentsController) create(w http.ResponseWriter, r *http.Request) {
 	content := r.FormValue("content")
 
 	if subjectID == "" || content == "" {
-		c.Render(w, r, "error-message.html", errors.New("missing required fields"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("missing required fields")))
+		return
+	}
+
+	if !slices.Contains(models.CommentTypes, subjectType) {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("invalid comment subject")))
 		return
 	}
 
 	if len(content) > 10000 {
-		c.Render(w, r, "error-message.html", errors.New("comment too long, max 10000 characters"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("comment too long, max 10000 characters")))
 		return
 	}
 
-	_, err = models.Comments.Insert(&models.Comment{
-		UserID:    user.ID,
-		SubjectID: subjectID,
-		Content:   content,
+	// File comments can point at a line of the file
+	line := 0
+	if value := r.FormValue("line"); value != "" && subjectType == models.CommentFile {
+		if line, err = strconv.Atoi(value); err != nil || line < 1 || line > maxCommentLine {
+			c.Render(w, r, "error-message.html", localize(r, errors.New("invalid line number")))
+			return
+		}
+	}
+
+	// Followers-only posts only take comments from people who can see them
+	if subjectType == "post" {
+		if post, err := models.Activities.Get(subjectID); err != nil || post.IsDeleted() || !post.VisibleTo(user.ID) {
+			c.Render(w, r, "error-message.html", localize(r, errors.New("post not found")))
+			return
+		}
+	}
+
+	if err = models.ThrottleComment.Allow(user.ID, auth.getClientIP(r)); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	comment, err := models.Comments.Insert(&models.Comment{
+		UserID:      user.ID,
+		SubjectType: subjectType,
+		SubjectID:   subjectID,
+		Content:     content,
+		Line:        line,
 	})
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
+	models.CountComment(comment, 1)
+	go notifyMentions(user, content, subjectURL(subjectType, subjectID))
+	go commentWebhook(comment, user)
 
 	// Handle post comments - notify the post author
-	if subjectType == "post" {
+	if subjectType == models.CommentPost {
 		go func() {
 			activity, err := models.Activities.Get(subjectID)
 			if err != nil || activity == nil {
@@ -79,6 +126,19 @@ func (c *CommentsController) create(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
+			push.SendNotification(
+				activity.UserID,
+				user.ID, // source = commenter
+				models.NotifyComment,
+				"New comment from @"+user.Handle,
+				truncateMessage(content, 100),
+				"/post/"+activity.ID,
+			)
+
+			if !models.WantsEmail(activity.UserID, models.NotifyComment) {
+				return
+			}
+
 			// Rate limit: 1 notification per hour per recipient
 			allowed, _, _ := models.Check(activity.UserID, "comment-notification", 1, time.Hour)
 			if !allowed {
@@ -109,9 +169,11 @@ func (c *CommentsController) create(w http.ResponseWriter, r *http.Request) {
 			}
 
 			// Send email notification
-			models.Emails.Send(postAuthorUser.Email,
-				"New comment on your post",
-				emailing.WithTemplate("new-comment.html"),
+			locale := models.EmailLocale(postAuthorUser.ID)
+			models.SendEmail(postAuthorUser.Email,
+				i18n.T(locale, "New comment on your post"),
+				"new-comment.html",
+				emailing.WithData("t", i18n.For(locale)),
 				emailing.WithData("commenter", commenter),
 				emailing.WithData("recipient", postAuthor),
 				emailing.WithData("comment", preview),
@@ -120,25 +182,13 @@ func (c *CommentsController) create(w http.ResponseWriter, r *http.Request) {
 		}()
 	} else {
 		// Create activity for non-post comments (repo/file/app comments)
-		var activitySubjectID string
-		activitySubjectType := subjectType
-
-		if subjectType == "file" {
+		activitySubjectType, activitySubjectID := subjectType, subjectID
+		if subjectType == models.CommentFile {
 			// Extract repo ID from "file:{repo_id}:{path}" format
-			parts := strings.SplitN(subjectID, ":", 3)
-			if len(parts) >= 2 {
+			activitySubjectType, activitySubjectID = "repo", ""
+			if parts := strings.SplitN(subjectID, ":", 3); len(parts) >= 2 {
 				activitySubjectID = parts[1]
-				activitySubjectType = "repo"
 			}
-		} else if subjectType == "thought" {
-			activitySubjectType = "thought"
-			activitySubjectID = subjectID
-		} else if subjectType == "app" || subjectType == "repo" || subjectType == "project" {
-			activitySubjectID = subjectID
-		} else {
-			// Default to repo for backwards compatibility
-			activitySubjectType = "repo"
-			activitySubjectID = subjectID
 		}
 
 		if activitySubjectID != "" {
@@ -155,28 +205,74 @@ func (c *CommentsController) create(w http.ResponseWriter, r *http.Request) {
 	c.Refresh(w, r)
 }
 
+// commentWebhook sends a new comment to the webhooks of whoever owns what
+// was commented on: repo and project hooks for comments on them, their
+// files or their apps, and account hooks for everything
+func commentWebhook(comment *models.Comment, author *authentication.User) {
+	ownerID, hookType, hookID := "", models.WebhookAccount, ""
+	switch comment.SubjectType {
+	case models.CommentPost:
+		if post, err := models.Activities.Get(comment.SubjectID); err == nil {
+			ownerID = post.UserID
+		}
+	case models.CommentThought:
+		if thought, err := models.Thoughts.Get(comment.SubjectID); err == nil {
+			ownerID = thought.UserID
+		}
+	case models.CommentApp:
+		if app, err := models.Apps.Get(comment.SubjectID); err == nil {
+			if repo := app.Repo(); repo != nil {
+				ownerID, hookType, hookID = repo.OwnerID, models.WebhookRepo, repo.ID
+			}
+		}
+	case models.CommentRepo, models.CommentProject, models.CommentFile:
+		id := comment.SubjectID
+		if comment.SubjectType == models.CommentFile {
+			// "file:{repo or project ID}:{path}"
+			if parts := strings.SplitN(id, ":", 3); len(parts) >= 2 {
+				id = parts[1]
+			}
+		}
+		if repo, err := models.Repos.Get(id); err == nil {
+			ownerID, hookType, hookID = repo.OwnerID, models.WebhookRepo, repo.ID
+		} else if project, err := models.Projects.Get(id); err == nil {
+			ownerID, hookType, hookID = project.OwnerID, models.WebhookProject, project.ID
+		}
+	}
+	if ownerID == "" {
+		return
+	}
+
+	webhooks.Comment(ownerID, hookType, hookID, comment, author, subjectURL(comment.SubjectType, comment.SubjectID))
+}
+
 func (c *CommentsController) update(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	comment, err := models.Comments.Get(r.PathValue("comment"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	if comment.UserID != user.ID {
-		c.Render(w, r, "error-message.html", errors.New("not authorized"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("not authorized")))
+		return
+	}
+
+	if comment.IsDeleted() {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("restore the comment before editing it")))
 		return
 	}
 
 	comment.Content = cmp.Or(r.Header.Get("HX-Prompt"), comment.Content)
 	if err = models.Comments.Update(comment); err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -187,23 +283,107 @@ func (c *CommentsController) delete(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	comment, err := models.Comments.Get(r.PathValue("comment"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	if comment.UserID != user.ID && !user.IsAdmin {
-		c.Render(w, r, "error-message.html", errors.New("not authorized"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("not authorized")))
+		return
+	}
+
+	if err = comment.SoftDelete(user.ID); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+// restore brings back a comment deleted by mistake
+func (c *CommentsController) restore(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	comment, err := models.Comments.Get(r.PathValue("comment"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	if !comment.CanRestore(user.ID, user.IsAdmin) {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("not authorized")))
+		return
+	}
+
+	if err = comment.Restore(); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+// resolve marks a file comment's thread as resolved
+func (c *CommentsController) resolve(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	comment, err := models.Comments.Get(r.PathValue("comment"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	if !comment.CanResolve(user.ID, user.IsAdmin) {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("not authorized")))
+		return
+	}
+
+	if err = comment.Resolve(user.ID); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+// reopen marks a resolved file comment's thread as open again
+func (c *CommentsController) reopen(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	comment, err := models.Comments.Get(r.PathValue("comment"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	if !comment.CanResolve(user.ID, user.IsAdmin) {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("not authorized")))
 		return
 	}
 
-	if err = models.Comments.Delete(comment); err != nil {
-		c.Render(w, r, "error-message.html", err)
+	if err = comment.Reopen(); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/The-Skyscape/devtools/pkg/authentication"
+	"www.theskyscape.com/internal/hosts"
+	"www.theskyscape.com/models"
+)
+
+func Domains() (string, *DomainsController) {
+	return "domains", &DomainsController{}
+}
+
+type DomainsController struct {
+	application.Controller
+}
+
+func (c *DomainsController) Setup(app *application.App) {
+	c.Controller.Setup(app)
+	auth := c.Use("auth").(*AuthController)
+
+	route("POST /project/{site}/domains", c.ProtectFunc(c.create, auth.Required))
+	route("POST /app/{site}/domains", c.ProtectFunc(c.create, auth.Required))
+	route("POST /domains/{domain}/verify", c.ProtectFunc(c.verify, auth.Required))
+	route("POST /domains/{domain}/https", c.ProtectFunc(c.updateHTTPS, auth.Required))
+	route("DELETE /domains/{domain}", c.ProtectFunc(c.delete, auth.Required))
+
+	// Asked by the edge proxy before it issues a certificate on demand
+	route("GET /_hosts/tls", http.HandlerFunc(c.allowCertificate))
+}
+
+func (c DomainsController) Handle(r *http.Request) application.Handler {
+	c.Request = r
+	return &c
+}
+
+// SiteHost returns the subdomain an app or project is served from, for
+// the CNAME target shown with its custom domains
+func (c *DomainsController) SiteHost(siteID string) string {
+	return hosts.Default.SiteHost(siteID)
+}
+
+// create adds a custom domain to an app or project, to be verified with a
+// TXT record before it's routed
+func (c *DomainsController) create(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	siteID := r.PathValue("site")
+	if !canManageSite(user, siteID) {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("permission denied")))
+		return
+	}
+
+	domain, err := hosts.Default.ValidateDomain(r.FormValue("domain"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	if models.CustomDomains.Count("WHERE SiteID = ?", siteID) >= models.MaxCustomDomains {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("you can add up to 5 domains")))
+		return
+	}
+
+	// Unverified claims don't block anyone, so a squatter can't hold a
+	// domain without its DNS
+	if models.CustomDomains.Count("WHERE Domain = ? AND (Verified = true OR SiteID = ?)", domain, siteID) > 0 {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("this domain is already in use")))
+		return
+	}
+
+	if _, err = models.CreateCustomDomain(siteID, domain); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+// verify looks up the domain's TXT record and starts routing it. Another
+// site's unverified claim on the same domain is dropped.
+func (c *DomainsController) verify(w http.ResponseWriter, r *http.Request) {
+	domain, err := c.ownDomain(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	if err = hosts.Verify(r.Context(), domain); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	domain.Verified, domain.VerifiedAt = true, time.Now()
+	if err = models.CustomDomains.Update(domain); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+	models.DB.Query("DELETE FROM custom_domains WHERE Domain = ? AND ID != ?", domain.Domain, domain.ID).Exec()
+	hosts.Forget(domain.Domain)
+
+	c.Refresh(w, r)
+}
+
+// updateHTTPS turns redirecting plain HTTP to HTTPS on or off
+func (c *DomainsController) updateHTTPS(w http.ResponseWriter, r *http.Request) {
+	domain, err := c.ownDomain(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	domain.ForceHTTPS = r.FormValue("https") == "on"
+	if err = models.CustomDomains.Update(domain); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+	hosts.Forget(domain.Domain)
+
+	c.Refresh(w, r)
+}
+
+func (c *DomainsController) delete(w http.ResponseWriter, r *http.Request) {
+	domain, err := c.ownDomain(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	if err = models.CustomDomains.Delete(domain); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+	hosts.Forget(domain.Domain)
+
+	c.Refresh(w, r)
+}
+
+// allowCertificate answers the edge proxy's on-demand TLS check: 200 if a
+// certificate may be issued for ?domain=, 404 otherwise
+func (c *DomainsController) allowCertificate(w http.ResponseWriter, r *http.Request) {
+	if !hosts.Default.AllowCertificate(r.URL.Query().Get("domain")) {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// ownDomain loads the domain in the path, if the current user can manage
+// its site
+func (c *DomainsController) ownDomain(r *http.Request) (*models.CustomDomain, error) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+
+	domain, err := models.CustomDomains.Get(r.PathValue("domain"))
+	if err != nil || !canManageSite(user, domain.SiteID) {
+		return nil, application.ErrNotFound
+	}
+	return domain, nil
+}
+
+// canManageSite reports whether a user owns an app or project, or is an
+// admin
+func canManageSite(user *authentication.User, siteID string) bool {
+	if user.IsAdmin {
+		return true
+	}
+	if project, err := models.Projects.Get(siteID); err == nil {
+		return project.OwnerID == user.ID
+	}
+	if app, err := models.Apps.Get(siteID); err == nil {
+		repo := app.Repo()
+		return repo != nil && repo.OwnerID == user.ID
+	}
+	return false
+}
@@ -0,0 +1,272 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"www.theskyscape.com/internal/git"
+	"www.theskyscape.com/internal/tracing"
+	"www.theskyscape.com/models"
+)
+
+const (
+	// maxEditorFile is the largest file the editor opens or saves
+	maxEditorFile = 1 << 20
+
+	// maxEditorChanges is how many files one commit from the editor can
+	// write or delete
+	maxEditorChanges = 100
+)
+
+// errEditorStale is returned when the project was pushed to after the
+// editor loaded it
+var errEditorStale = errors.New("the project changed since you opened the editor, reload to get the latest version")
+
+func Editor() (string, *EditorController) {
+	return "editor", &EditorController{}
+}
+
+// EditorController serves the in-browser code editor for projects, which
+// commits straight to the project's main branch so owners can change code
+// without git
+type EditorController struct {
+	application.Controller
+}
+
+func (c *EditorController) Setup(app *application.App) {
+	c.Controller.Setup(app)
+	auth := c.Use("auth").(*AuthController)
+
+	route("GET /project/{project}/editor", noindex(c.Serve("project-editor.html", auth.Required)))
+	route("GET /project/{project}/editor/file", c.ProtectFunc(c.readFile, auth.Required))
+	route("POST /project/{project}/editor/commit", c.ProtectFunc(c.commit, auth.Required))
+}
+
+func (c EditorController) Handle(r *http.Request) application.Handler {
+	c.Request = r
+	return &c
+}
+
+// TreeEntry is a file or directory in the editor's file tree
+type TreeEntry struct {
+	Path  string
+	Name  string
+	Depth int
+	IsDir bool
+}
+
+// Tree returns the current project's files on main, directories first
+func (c *EditorController) Tree() []*TreeEntry {
+	project, err := models.Projects.Get(c.PathValue("project"))
+	if err != nil {
+		return nil
+	}
+	paths, err := project.Tree("main")
+	if err != nil {
+		return nil
+	}
+	return buildTree(paths)
+}
+
+// Head returns the commit main points at, which the editor commits on top
+// of, or "" for an empty project
+func (c *EditorController) Head() string {
+	project, err := models.Projects.Get(c.PathValue("project"))
+	if err != nil {
+		return ""
+	}
+	return headCommit(project.Git("rev-parse", "--verify", "--quiet", "refs/heads/main"))
+}
+
+// readFile returns a text file from main for the editor to open
+func (c *EditorController) readFile(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		JSONError(w, http.StatusUnauthorized, localize(r, errors.New("unauthorized")).Error())
+		return
+	}
+
+	project, err := authorizeProject(user, r.PathValue("project"), true)
+	if err != nil {
+		JSONError(w, http.StatusForbidden, localize(r, err).Error())
+		return
+	}
+
+	filePath := r.URL.Query().Get("path")
+	if !git.ValidPath(filePath) {
+		JSONError(w, http.StatusNotFound, localize(r, errors.New("file not found")).Error())
+		return
+	}
+
+	file, err := project.Open("main", filePath)
+	if err != nil || file.IsDir {
+		JSONError(w, http.StatusNotFound, localize(r, errors.New("file not found")).Error())
+		return
+	}
+
+	content, err := file.Read()
+	if err != nil {
+		JSONError(w, http.StatusNotFound, localize(r, errors.New("file not found")).Error())
+		return
+	}
+	if content.IsBinary {
+		JSONError(w, http.StatusUnsupportedMediaType, localize(r, errors.New("binary files can't be edited in the browser")).Error())
+		return
+	}
+	if len(content.Content) > maxEditorFile {
+		JSONError(w, http.StatusRequestEntityTooLarge, localize(r, errors.New("this file is too large to edit in the browser")).Error())
+		return
+	}
+
+	JSON(w, http.StatusOK, map[string]string{
+		"path":    filePath,
+		"content": content.Content,
+	})
+}
+
+// commit writes the files the editor changed and deletes the ones it
+// removed in one commit on main, then deploys it like a push. The editor
+// sends the commit it loaded as base, so a push made meanwhile is a
+// conflict rather than being overwritten.
+func (c *EditorController) commit(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		JSONError(w, http.StatusUnauthorized, localize(r, errors.New("unauthorized")).Error())
+		return
+	}
+
+	project, err := authorizeProject(user, r.PathValue("project"), true)
+	if err != nil {
+		JSONError(w, http.StatusForbidden, localize(r, err).Error())
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxEditorChanges*maxEditorFile)
+	if err := r.ParseForm(); err != nil {
+		JSONError(w, http.StatusRequestEntityTooLarge, localize(r, errors.New("these changes are too large to commit at once")).Error())
+		return
+	}
+
+	paths, contents, deletes := r.PostForm["path"], r.PostForm["content"], r.PostForm["delete"]
+	if len(paths) != len(contents) {
+		JSONError(w, http.StatusBadRequest, localize(r, errors.New("invalid request")).Error())
+		return
+	}
+	if len(paths)+len(deletes) == 0 {
+		JSONError(w, http.StatusUnprocessableEntity, localize(r, git.ErrNoChanges).Error())
+		return
+	}
+	if len(paths)+len(deletes) > maxEditorChanges {
+		JSONError(w, http.StatusUnprocessableEntity, localize(r, errors.New("commit at most 100 files at once")).Error())
+		return
+	}
+
+	var changes []git.Change
+	for i, p := range paths {
+		if len(contents[i]) > maxEditorFile {
+			JSONError(w, http.StatusRequestEntityTooLarge, localize(r, errors.New("this file is too large to edit in the browser")).Error())
+			return
+		}
+		changes = append(changes, git.Change{Path: p, Content: []byte(contents[i])})
+	}
+	for _, p := range deletes {
+		changes = append(changes, git.Change{Path: p, Delete: true})
+	}
+	for _, change := range changes {
+		if !git.ValidPath(change.Path) {
+			JSONError(w, http.StatusUnprocessableEntity, localize(r, errors.New("invalid file path")).Error())
+			return
+		}
+	}
+
+	message := strings.TrimSpace(r.FormValue("message"))
+	if message == "" {
+		message = defaultCommitMessage(changes)
+	}
+
+	base := r.FormValue("base")
+	if head := headCommit(project.GitContext(r.Context(), "rev-parse", "--verify", "--quiet", "refs/heads/main")); head != base {
+		JSONError(w, http.StatusConflict, localize(r, errEditorStale).Error())
+		return
+	}
+
+	commit, err := project.Commit(r.Context(), "main", base, user, message, changes)
+	switch {
+	case errors.Is(err, git.ErrStale):
+		JSONError(w, http.StatusConflict, localize(r, errEditorStale).Error())
+		return
+	case errors.Is(err, git.ErrNoChanges):
+		JSONError(w, http.StatusUnprocessableEntity, localize(r, err).Error())
+		return
+	case err != nil:
+		slog.Error("editor commit failed", "project_id", project.ID, "error", err)
+		JSONError(w, http.StatusInternalServerError, localize(r, errors.New("failed to commit changes")).Error())
+		return
+	}
+
+	// Record, announce and deploy the commit as if it had been pushed
+	go afterProjectPush(tracing.Detach(r.Context()), project.ID, user.ID, base)
+
+	JSON(w, http.StatusOK, map[string]string{"commit": commit})
+}
+
+// defaultCommitMessage describes changes for a commit without a message
+func defaultCommitMessage(changes []git.Change) string {
+	if len(changes) > 1 {
+		return fmt.Sprintf("Update %d files", len(changes))
+	}
+	if changes[0].Delete {
+		return "Delete " + changes[0].Path
+	}
+	return "Update " + changes[0].Path
+}
+
+// buildTree turns file paths into a tree listing, each directory followed
+// by its contents with subdirectories before files
+func buildTree(paths []string) []*TreeEntry {
+	type dir struct {
+		dirs  map[string]*dir
+		files []string
+	}
+	root := &dir{dirs: map[string]*dir{}}
+	for _, p := range paths {
+		d := root
+		parts := strings.Split(p, "/")
+		for _, part := range parts[:len(parts)-1] {
+			if d.dirs[part] == nil {
+				d.dirs[part] = &dir{dirs: map[string]*dir{}}
+			}
+			d = d.dirs[part]
+		}
+		d.files = append(d.files, parts[len(parts)-1])
+	}
+
+	var entries []*TreeEntry
+	var walk func(d *dir, prefix string, depth int)
+	walk = func(d *dir, prefix string, depth int) {
+		names := make([]string, 0, len(d.dirs))
+		for name := range d.dirs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			entries = append(entries, &TreeEntry{Path: path.Join(prefix, name), Name: name, Depth: depth, IsDir: true})
+			walk(d.dirs[name], path.Join(prefix, name), depth+1)
+		}
+
+		sort.Strings(d.files)
+		for _, name := range d.files {
+			entries = append(entries, &TreeEntry{Path: path.Join(prefix, name), Name: name, Depth: depth})
+		}
+	}
+	walk(root, "", 0)
+	return entries
+}
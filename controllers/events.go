@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"www.theskyscape.com/internal/events"
+)
+
+func Events() (string, *EventsController) {
+	return "events", &EventsController{}
+}
+
+// EventsController serves the signed-in user's real-time event stream
+type EventsController struct {
+	application.Controller
+}
+
+func (c *EventsController) Setup(app *application.App) {
+	c.Controller.Setup(app)
+	auth := c.Use("auth").(*AuthController)
+
+	route("GET /events", c.ProtectFunc(c.stream, auth.Required))
+}
+
+func (c EventsController) Handle(r *http.Request) application.Handler {
+	c.Request = r
+	return &c
+}
+
+func (c *EventsController) stream(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		JSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	events.Serve(w, r, user.ID)
+}
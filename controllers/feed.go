@@ -5,12 +5,17 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 
 	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/The-Skyscape/devtools/pkg/authentication"
 	"github.com/The-Skyscape/devtools/pkg/emailing"
+	"www.theskyscape.com/internal/i18n"
 	"www.theskyscape.com/internal/push"
+	"www.theskyscape.com/internal/scanning"
+	"www.theskyscape.com/internal/tracing"
 	"www.theskyscape.com/models"
 )
 
@@ -31,14 +36,19 @@ func (c *FeedController) Setup(app *application.App) {
 	c.Controller.Setup(app)
 	auth := c.Use("auth").(*AuthController)
 
-	http.Handle("/", app.Serve("tbd.html", auth.Required))
-	http.Handle("/{$}", app.ProtectFunc(c.serveFeed, auth.Optional))
-	http.Handle("/explore", app.Serve("explore.html", auth.Optional))
-	http.Handle("/manifesto", app.Serve("manifesto.html", auth.Optional))
-	http.Handle("GET /feed/poll", c.ProtectFunc(c.pollFeed, auth.Optional))
-	http.Handle("POST /feed/post", c.ProtectFunc(c.createPost, auth.Required))
-	http.Handle("DELETE /feed/{post}", c.ProtectFunc(c.deletePost, auth.Required))
-	http.Handle("GET /post/{post}", app.Serve("post.html", auth.Optional))
+	// Keep cached star, follower and comment counts honest
+	go models.ReconcileCounters(time.Hour)
+
+	route("/", app.Serve("tbd.html", auth.Required))
+	route("/{$}", app.ProtectFunc(c.serveFeed, auth.Optional))
+	route("/explore", cached(app.Serve("explore.html", auth.Optional)))
+	route("/manifesto", cached(app.Serve("manifesto.html", auth.Optional)))
+	route("GET /feed/poll", noindex(c.ProtectFunc(c.pollFeed, auth.Optional)))
+	route("POST /feed/post", c.ProtectFunc(c.createPost, auth.Required))
+	route("DELETE /feed/{post}", c.ProtectFunc(c.deletePost, auth.Required))
+	route("POST /feed/{post}/restore", c.ProtectFunc(c.restorePost, auth.Required))
+	route("GET /post/{post}", cached(app.Serve("post.html", auth.Optional)))
+	route("GET /tag/{tag}", cached(app.Serve("tag.html", auth.Optional)))
 }
 
 func (c FeedController) Handle(r *http.Request) application.Handler {
@@ -63,8 +73,21 @@ func (c *FeedController) serveFeed(w http.ResponseWriter, r *http.Request) {
 	c.Render(w, r, "feed.html", nil)
 }
 
+// CurrentPost returns the post from the path if the current user can see it
 func (c *FeedController) CurrentPost() *models.Activity {
-	post, _ := models.Activities.Get(c.PathValue("post"))
+	post, err := models.Activities.Get(c.PathValue("post"))
+	if err != nil {
+		return nil
+	}
+
+	auth := c.Use("auth").(*AuthController)
+	viewerID := ""
+	if user := auth.CurrentUser(); user != nil {
+		viewerID = user.ID
+	}
+	if !post.VisibleTo(viewerID) {
+		return nil
+	}
 	return post
 }
 
@@ -80,19 +103,34 @@ func (c *FeedController) NextPage() int {
 	return c.Page() + 1
 }
 
+// Cursor returns the position to continue the feed from, if any. Page is
+// still passed alongside it to rotate promotions.
+func (c *FeedController) Cursor() *models.Cursor {
+	return ParseCursor(c.URL.Query())
+}
+
 func (c *FeedController) RecentActivities() []*models.Activity {
-	page := c.Page()
 	limit := c.Limit()
-	offset := (page - 1) * limit
+	cursor := c.Cursor()
+	offset := 0
+	if cursor == nil {
+		offset = (c.Page() - 1) * limit
+	}
 
+	before, args := cursor.Before("")
 	activities, _ := models.Activities.Search(`
-		ORDER BY CreatedAt DESC
+		WHERE UserID NOT IN (SELECT UserID FROM profiles WHERE Suspended = true)
+			AND `+models.PublicActivities+`
+			AND DeletedAt IS NULL
+			AND `+before+`
+		ORDER BY CreatedAt DESC, ID DESC
 		LIMIT ? OFFSET ?
-	`, limit, offset)
+	`, append(args, limit, offset)...)
 	return activities
 }
 
-// PersonalizedActivities returns activities from followed users + own posts
+// PersonalizedActivities returns activities from followed users and topics
+// + own posts
 func (c *FeedController) PersonalizedActivities() []*models.Activity {
 	auth := c.Use("auth").(*AuthController)
 	user := auth.CurrentUser()
@@ -105,34 +143,53 @@ func (c *FeedController) PersonalizedActivities() []*models.Activity {
 		return c.RecentActivities()
 	}
 
-	// Build list of user IDs: own ID + all followed user IDs
-	following := profile.Following()
-	userIDs := make([]interface{}, 0, len(following)+1)
-	userIDs = append(userIDs, user.ID)
-	for _, f := range following {
-		userIDs = append(userIDs, f.FolloweeID)
+	limit := c.Limit()
+	cursor := c.Cursor()
+	offset := 0
+	if cursor == nil {
+		offset = (c.Page() - 1) * limit
 	}
+	return profile.HomeFeed(cursor, limit, offset)
+}
 
-	page := c.Page()
-	limit := c.Limit()
-	offset := (page - 1) * limit
+// CurrentTag returns the tag from the path, or "" if it isn't valid
+func (c *FeedController) CurrentTag() string {
+	return models.NormalizeTag(c.PathValue("tag"))
+}
 
-	// Build placeholder string for IN clause
-	placeholders := "?"
-	for i := 1; i < len(userIDs); i++ {
-		placeholders += ",?"
+// TagActivities returns paginated posts tagged with the current tag
+func (c *FeedController) TagActivities() []*models.Activity {
+	tag := c.CurrentTag()
+	if tag == "" {
+		return nil
 	}
 
-	args := append(userIDs, limit, offset)
+	limit := c.Limit()
+	cursor := c.Cursor()
+	offset := 0
+	if cursor == nil {
+		offset = (c.Page() - 1) * limit
+	}
+
+	before, args := cursor.Before("")
 	activities, _ := models.Activities.Search(`
-		WHERE UserID IN (`+placeholders+`)
-		ORDER BY CreatedAt DESC
+		WHERE ID IN (SELECT ActivityID FROM activity_tags WHERE Tag = ?)
+			AND UserID NOT IN (SELECT UserID FROM profiles WHERE Suspended = true)
+			AND `+models.PublicActivities+`
+			AND DeletedAt IS NULL
+			AND `+before+`
+		ORDER BY CreatedAt DESC, ID DESC
 		LIMIT ? OFFSET ?
-	`, args...)
-
+	`, append(append([]any{tag}, args...), limit, offset)...)
+	models.PreloadActivities(c.Request.Context(), activities)
 	return activities
 }
 
+// TagFollowersCount returns how many users follow the current tag
+func (c *FeedController) TagFollowersCount() int {
+	return models.TopicFollowersCount(models.TopicTag, c.CurrentTag())
+}
+
 // ActivePromotions returns all non-expired promotions
 func (c *FeedController) ActivePromotions() []*models.Promotion {
 	return models.ActivePromotions()
@@ -156,16 +213,26 @@ func (f FeedItem) IsEndOfFeed() bool {
 }
 
 // FeedWithPromotions returns personalized activities with 1 promotion per page
-// The promotion is positioned in the middle of the activities (at limit/2)
+// The promotion is chosen by models.PromotionFor, which applies targeting and
+// frequency caps, and positioned in the middle of the activities (at limit/2)
 // Appends an EndOfFeed marker when there are no more activities to load
 func (c *FeedController) FeedWithPromotions() []FeedItem {
+	ctx, span := tracing.Start(c.Request.Context(), "FeedWithPromotions")
+	defer span.End()
+
 	activities := c.PersonalizedActivities()
-	promotions := c.ActivePromotions()
+	models.PreloadActivities(ctx, activities)
 	limit := c.Limit()
 	isEndOfFeed := len(activities) < limit
 
-	numPromos := len(promotions)
-	if numPromos == 0 {
+	auth := c.Use("auth").(*AuthController)
+	userID := ""
+	if user := auth.CurrentUser(); user != nil {
+		userID = user.ID
+	}
+
+	promo := models.PromotionFor(userID, c.Page())
+	if promo == nil || len(activities) == 0 {
 		// No promotions available, return activities only
 		result := make([]FeedItem, 0, len(activities)+1)
 		for _, activity := range activities {
@@ -176,13 +243,12 @@ func (c *FeedController) FeedWithPromotions() []FeedItem {
 		}
 		return result
 	}
+	if promo.UserID != userID {
+		models.RecordImpression(promo.ID, userID)
+	}
 
 	result := make([]FeedItem, 0, len(activities)+2)
 
-	// Rotate through promotions based on page number
-	page := c.Page()
-	promo := promotions[(page-1)%numPromos]
-
 	// Insert promotion in the middle of activities
 	promoPosition := limit / 2
 
@@ -207,6 +273,57 @@ func (c *FeedController) FeedWithPromotions() []FeedItem {
 	return result
 }
 
+// CatchUp is what the end of the feed suggests instead of a dead end
+type CatchUp struct {
+	Thoughts []*models.Thought
+	Apps     []*models.App
+	People   []*models.Profile
+}
+
+// IsEmpty returns true if there's nothing to suggest
+func (c *CatchUp) IsEmpty() bool {
+	return len(c.Thoughts) == 0 && len(c.Apps) == 0 && len(c.People) == 0
+}
+
+// CatchUp suggests popular thoughts from the last month, new apps and
+// people the current user doesn't follow yet, for when they reach the end
+// of their feed
+func (c *FeedController) CatchUp() *CatchUp {
+	catchUp := &CatchUp{}
+	monthAgo := time.Now().AddDate(0, -1, 0)
+
+	catchUp.Thoughts, _ = models.Thoughts.Search(`
+		WHERE Published = true
+			AND PublishedAt >= ?
+			AND UserID NOT IN (SELECT UserID FROM profiles WHERE Suspended = true)
+		ORDER BY StarsCount DESC, ViewsCount DESC
+		LIMIT 3
+	`, monthAgo)
+
+	catchUp.Apps, _ = models.Apps.Search(`
+		INNER JOIN repos ON repos.ID = apps.RepoID
+		WHERE apps.Status != 'shutdown'
+			AND repos.OwnerID NOT IN (SELECT UserID FROM profiles WHERE Suspended = true)
+		ORDER BY apps.CreatedAt DESC
+		LIMIT 3
+	`)
+
+	userID := ""
+	auth := c.Use("auth").(*AuthController)
+	if user := auth.CurrentUser(); user != nil {
+		userID = user.ID
+	}
+	catchUp.People, _ = models.Profiles.Search(`
+		WHERE Suspended = false
+			AND UserID != ?
+			AND UserID NOT IN (SELECT FolloweeID FROM follows WHERE FollowerID = ?)
+		ORDER BY FollowerTotal DESC, CreatedAt DESC
+		LIMIT 3
+	`, userID, userID)
+
+	return catchUp
+}
+
 // MyRepos returns all repos owned by the current user for the promote dropdown
 func (c *FeedController) MyRepos() []*models.Repo {
 	auth := c.Use("auth").(*AuthController)
@@ -246,6 +363,9 @@ func (c *FeedController) pollFeed(w http.ResponseWriter, r *http.Request) {
 		// Fallback to global feed for logged out users
 		activities, _ = models.Activities.Search(`
 			WHERE CreatedAt > ?
+				AND UserID NOT IN (SELECT UserID FROM profiles WHERE Suspended = true)
+				AND `+models.PublicActivities+`
+				AND DeletedAt IS NULL
 			ORDER BY CreatedAt ASC
 		`, after)
 	} else {
@@ -253,6 +373,9 @@ func (c *FeedController) pollFeed(w http.ResponseWriter, r *http.Request) {
 		if profile == nil {
 			activities, _ = models.Activities.Search(`
 				WHERE CreatedAt > ?
+					AND UserID NOT IN (SELECT UserID FROM profiles WHERE Suspended = true)
+					AND `+models.PublicActivities+`
+					AND DeletedAt IS NULL
 				ORDER BY CreatedAt ASC
 			`, after)
 		} else {
@@ -270,14 +393,18 @@ func (c *FeedController) pollFeed(w http.ResponseWriter, r *http.Request) {
 				placeholders += ",?"
 			}
 
-			args := append(userIDs, after)
+			args := append(userIDs, user.ID, user.ID, after)
 			activities, _ = models.Activities.Search(`
-				WHERE UserID IN (`+placeholders+`) AND CreatedAt > ?
+				WHERE (UserID IN (`+placeholders+`) OR (`+models.PublicActivities+` AND `+models.TopicActivities+`)) AND CreatedAt > ?
+					AND UserID NOT IN (SELECT UserID FROM profiles WHERE Suspended = true)
+					AND `+profile.FeedKindFilter()+`
+					AND DeletedAt IS NULL
 				ORDER BY CreatedAt ASC
 			`, args...)
 		}
 	}
 
+	models.PreloadActivities(r.Context(), activities)
 	c.Render(w, r, "feed-poll.html", activities)
 }
 
@@ -294,19 +421,16 @@ func (c *FeedController) createPost(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	r.ParseMultipartForm(maxImageSize)
 
 	content := r.FormValue("content")
-	if content == "" {
-		c.Render(w, r, "error-message.html", errors.New("Post content cannot be empty"))
-		return
-	}
-	if len(content) > MaxContentLength {
-		c.Render(w, r, "error-message.html", errors.New("Post content too long"))
+	visibility, err := validatePost(content, r.FormValue("visibility"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -326,48 +450,80 @@ func (c *FeedController) createPost(w http.ResponseWriter, r *http.Request) {
 		defer file.Close()
 
 		if handler.Size > maxImageSize {
-			c.Render(w, r, "error-message.html", errors.New("Image too large, max 10MB"))
+			c.Render(w, r, "error-message.html", localize(r, errors.New("Image too large, max 10MB")))
 			return
 		}
 
 		mimeType := handler.Header.Get("Content-Type")
 		if !allowedImageTypes[mimeType] {
-			c.Render(w, r, "error-message.html", errors.New("Only images are allowed"))
+			c.Render(w, r, "error-message.html", localize(r, errors.New("Only images are allowed")))
 			return
 		}
 
 		var buf bytes.Buffer
 		if _, err := io.Copy(&buf, file); err != nil {
-			c.Render(w, r, "error-message.html", err)
+			c.Render(w, r, "error-message.html", localize(r, err))
 			return
 		}
 
-		fileModel, err := models.Files.Insert(&models.File{
+		fileModel, err := scanning.Store(&models.File{
 			OwnerID:  user.ID,
 			FilePath: handler.Filename,
 			MimeType: mimeType,
 			Content:  buf.Bytes(),
 		})
 		if err != nil {
-			c.Render(w, r, "error-message.html", err)
+			c.Render(w, r, "error-message.html", localize(r, err))
 			return
 		}
 		fileID = fileModel.ID
 	}
 
-	_, err = models.Activities.Insert(&models.Activity{
-		UserID:      user.ID,
-		Action:      "posted",
+	if _, err = publishPost(user, &models.Activity{
 		SubjectType: subjectType,
 		SubjectID:   subjectID,
 		Content:     content,
 		FileID:      fileID,
-	})
-	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		Visibility:  visibility,
+	}); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
+	c.Refresh(w, r)
+}
+
+// validatePost checks a post's content and visibility, defaulting to
+// public, shared by the web form and the API
+func validatePost(content, visibility string) (string, error) {
+	if content == "" {
+		return "", errors.New("Post content cannot be empty")
+	}
+	if len(content) > MaxContentLength {
+		return "", errors.New("Post content too long")
+	}
+	if visibility == "" {
+		visibility = models.PostPublic
+	}
+	if !slices.Contains(models.PostVisibilities, visibility) {
+		return "", errors.New("invalid visibility")
+	}
+	return visibility, nil
+}
+
+// publishPost saves a validated post by the user, tags it and notifies
+// mentioned users and followers
+func publishPost(user *authentication.User, post *models.Activity) (*models.Activity, error) {
+	post.UserID = user.ID
+	post.Action = "posted"
+	post, err := models.Activities.Insert(post)
+	if err != nil {
+		return nil, err
+	}
+
+	models.TagActivity(post)
+	go notifyMentions(user, post.Content, "/post/"+post.ID)
+
 	// Notify followers in background
 	go func() {
 		poster, _ := models.Profiles.Get(user.ID)
@@ -375,7 +531,7 @@ func (c *FeedController) createPost(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		preview := content
+		preview := post.Content
 		if len(preview) > 200 {
 			preview = preview[:197] + "..."
 		}
@@ -394,15 +550,21 @@ func (c *FeedController) createPost(w http.ResponseWriter, r *http.Request) {
 			push.SendNotification(
 				follower.ID,
 				poster.ID, // source = poster
+				models.NotifyPost,
 				"New post from @"+poster.Handle(),
 				preview,
 				"/",
 			)
 
 			// Send email notification
-			models.Emails.Send(followerUser.Email,
-				"New post from "+poster.Name(),
-				emailing.WithTemplate("new-post.html"),
+			if !models.WantsEmail(followerUser.ID, models.NotifyPost) {
+				continue
+			}
+			locale := models.EmailLocale(followerUser.ID)
+			models.SendEmail(followerUser.Email,
+				i18n.T(locale, "New post from %s", poster.Name()),
+				"new-post.html",
+				emailing.WithData("t", i18n.For(locale)),
 				emailing.WithData("poster", poster),
 				emailing.WithData("recipient", follower),
 				emailing.WithData("user", followerUser),
@@ -412,30 +574,58 @@ func (c *FeedController) createPost(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	c.Refresh(w, r)
+	return post, nil
 }
 
 func (c *FeedController) deletePost(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	post, err := models.Activities.Get(r.PathValue("post"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	if !user.IsAdmin && post.UserID != user.ID {
-		c.Render(w, r, "error-message.html", errors.New("Not allowed"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("Not allowed")))
+		return
+	}
+
+	if err = post.SoftDelete(user.ID); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+// restorePost brings back a post deleted by mistake
+func (c *FeedController) restorePost(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	post, err := models.Activities.Get(r.PathValue("post"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	if !post.CanRestore(user.ID, user.IsAdmin) {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("Not allowed")))
 		return
 	}
 
-	if err = models.Activities.Delete(post); err != nil {
-		c.Render(w, r, "error-message.html", err)
+	if err = post.Restore(); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -2,14 +2,19 @@ package controllers
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"io"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/The-Skyscape/devtools/pkg/application"
 	"github.com/pkg/errors"
+	"www.theskyscape.com/internal/scanning"
 	"www.theskyscape.com/models"
 )
 
@@ -25,9 +30,13 @@ func (c *FilesController) Setup(app *application.App) {
 	c.Controller.Setup(app)
 	auth := c.Use("auth").(*AuthController)
 
-	http.Handle("GET /files", c.Serve("files.html", auth.Required))
-	http.Handle("POST /files", c.ProtectFunc(c.uploadFile, auth.Required))
-	http.Handle("GET /file/{file}", c.ProtectFunc(c.serveFile, auth.Optional))
+	route("GET /files", c.Serve("files.html", auth.Required))
+	route("POST /files", c.ProtectFunc(auth.limited(uploadLimit, c.uploadFile), auth.Required))
+	route("GET /file/{file}", c.ProtectFunc(c.serveFile, auth.Optional))
+	route("POST /file/{file}/visibility", c.ProtectFunc(c.updateVisibility, auth.Required))
+
+	// Retry uploads whose scan failed because the scanner was unreachable
+	go scanning.RescanPending(5 * time.Minute)
 }
 
 func (c FilesController) Handle(r *http.Request) application.Handler {
@@ -51,6 +60,11 @@ func (c *FilesController) MyFiles() []*models.File {
 
 const maxFileSize = 10 * 1024 * 1024 // 10MB
 
+// publicFileMaxAge is how long browsers and CDNs may reuse a public file
+// before revalidating it. It's short because the file can be made private
+// later, which a cached copy wouldn't find out about.
+const publicFileMaxAge = 5 * time.Minute
+
 var allowedMimeTypes = map[string]bool{
 	"image/jpeg":      true,
 	"image/png":       true,
@@ -65,14 +79,14 @@ func (c *FilesController) uploadFile(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	r.ParseMultipartForm(maxFileSize)
 	file, handler, err := r.FormFile("file")
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -80,43 +94,51 @@ func (c *FilesController) uploadFile(w http.ResponseWriter, r *http.Request) {
 
 	// Validate file size
 	if handler.Size > maxFileSize {
-		c.Render(w, r, "error-message.html", errors.New("file too large, max 10MB"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("file too large, max 10MB")))
 		return
 	}
 
 	// Validate MIME type
 	mimeType := handler.Header.Get("Content-Type")
 	if !allowedMimeTypes[mimeType] {
-		c.Render(w, r, "error-message.html", errors.New("file type not allowed"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("file type not allowed")))
 		return
 	}
 
 	// Sanitize filename to prevent path traversal
 	filename := filepath.Base(filepath.Clean(handler.Filename))
 	if filename == "." || filename == "/" || filename == "" {
-		c.Render(w, r, "error-message.html", errors.New("invalid filename"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("invalid filename")))
 		return
 	}
 
 	var buf bytes.Buffer
 	if _, err := io.Copy(&buf, file); err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
-	fileModel, err := models.Files.Insert(&models.File{
-		OwnerID:  user.ID,
-		FilePath: filename,
-		MimeType: handler.Header.Get("Content-Type"),
-		Content:  buf.Bytes(),
+	visibility := models.FilePublic
+	if r.FormValue("visibility") == models.FilePrivate {
+		visibility = models.FilePrivate
+	}
+
+	fileModel, err := scanning.Store(&models.File{
+		OwnerID:    user.ID,
+		FilePath:   filename,
+		MimeType:   handler.Header.Get("Content-Type"),
+		Content:    buf.Bytes(),
+		Visibility: visibility,
 	})
 
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
-	// Return JSON if requested (for editor integration)
+	// Return JSON if requested (for editor integration). The URL is the
+	// file's stable path: private files are signed where they're rendered,
+	// and their owner can fetch them unsigned.
 	if strings.Contains(r.Header.Get("Accept"), "application/json") {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{
@@ -135,10 +157,79 @@ func (c *FilesController) serveFile(w http.ResponseWriter, r *http.Request) {
 	file, err := models.Files.Get(r.PathValue("file"))
 
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
+	// Uploads are only downloadable once the scanner has cleared them
+	if !file.IsAvailable() {
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
+		return
+	}
+
+	// Content never changes once uploaded, so the content hash is a stable
+	// validator, but visibility can: caches revalidate every few minutes
+	// and a file made private stops being served from them.
+	cacheControl := "public, max-age=" + strconv.Itoa(int(publicFileMaxAge.Seconds())) + ", must-revalidate"
+
+	// Private files need a valid signature unless the owner is viewing them,
+	// and must never be stored by shared caches.
+	if file.IsPrivate() {
+		q := r.URL.Query()
+		expiresAt, ok := file.VerifySignature(q.Get("expires"), q.Get("sig"))
+		if !ok {
+			auth := c.Use("auth").(*AuthController)
+			if user, _, err := auth.Authenticate(r); err != nil || user.ID != file.OwnerID {
+				c.RenderError(w, r, localize(r, application.ErrNotFound))
+				return
+			}
+			cacheControl = "private, no-cache"
+		} else {
+			maxAge := int(time.Until(expiresAt).Seconds())
+			cacheControl = "private, max-age=" + strconv.Itoa(maxAge)
+		}
+	}
+
+	sum := sha256.Sum256(file.Content)
 	w.Header().Set("Content-Type", file.MimeType)
-	w.Write(file.Content)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Cache-Control", cacheControl)
+
+	// ServeContent handles If-None-Match, If-Modified-Since and Range
+	// requests so audio/video can seek and conditional GETs return 304.
+	http.ServeContent(w, r, file.FilePath, file.UpdatedAt, bytes.NewReader(file.Content))
+}
+
+// updateVisibility lets the owner switch a file between public and private
+func (c *FilesController) updateVisibility(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	file, err := models.Files.Get(r.PathValue("file"))
+	if err != nil {
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
+		return
+	}
+
+	if file.OwnerID != user.ID {
+		c.RenderError(w, r, localize(r, application.ErrForbidden))
+		return
+	}
+
+	visibility := r.FormValue("visibility")
+	if visibility != models.FilePublic && visibility != models.FilePrivate {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("invalid visibility")))
+		return
+	}
+
+	if err = file.SetVisibility(visibility); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
 }
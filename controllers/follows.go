@@ -7,6 +7,9 @@ import (
 
 	"github.com/The-Skyscape/devtools/pkg/application"
 	"github.com/The-Skyscape/devtools/pkg/emailing"
+	"www.theskyscape.com/internal/i18n"
+	"www.theskyscape.com/internal/push"
+	"www.theskyscape.com/internal/webhooks"
 	"www.theskyscape.com/models"
 )
 
@@ -22,8 +25,12 @@ func (c *FollowsController) Setup(app *application.App) {
 	c.Controller.Setup(app)
 	auth := app.Use("auth").(*AuthController)
 
-	http.Handle("POST /user/{user}/follow", c.ProtectFunc(c.follow, auth.Required))
-	http.Handle("DELETE /user/{user}/follow", c.ProtectFunc(c.unfollow, auth.Required))
+	route("POST /user/{user}/follow", c.ProtectFunc(c.follow, auth.Required))
+	route("DELETE /user/{user}/follow", c.ProtectFunc(c.unfollow, auth.Required))
+	for _, topicType := range models.TopicTypes {
+		route("POST /"+topicType+"/{id}/follow", c.ProtectFunc(c.followTopic(topicType), auth.Required))
+		route("DELETE /"+topicType+"/{id}/follow", c.ProtectFunc(c.unfollowTopic(topicType), auth.Required))
+	}
 }
 
 func (c FollowsController) Handle(r *http.Request) application.Handler {
@@ -35,7 +42,7 @@ func (c *FollowsController) follow(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -43,7 +50,7 @@ func (c *FollowsController) follow(w http.ResponseWriter, r *http.Request) {
 
 	// Validate not following self
 	if user.ID == followeeID {
-		c.Render(w, r, "error-message.html", errors.New("cannot follow yourself"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("cannot follow yourself")))
 		return
 	}
 
@@ -51,26 +58,32 @@ func (c *FollowsController) follow(w http.ResponseWriter, r *http.Request) {
 	existing, _ := models.Follows.First("WHERE FollowerID = ? AND FolloweeID = ?",
 		user.ID, followeeID)
 	if existing != nil {
-		c.Render(w, r, "error-message.html", errors.New("already following"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("already following")))
 		return
 	}
 
 	// Get the followee to ensure they exist
 	followee, err := models.Auth.Users.Get(followeeID)
 	if err != nil || followee == nil {
-		c.Render(w, r, "error-message.html", errors.New("user not found"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("user not found")))
+		return
+	}
+
+	if err = models.ThrottleFollow.Allow(user.ID, auth.getClientIP(r)); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	// Create follow
-	_, err = models.Follows.Insert(&models.Follow{
+	follow, err := models.Follows.Insert(&models.Follow{
 		FollowerID: user.ID,
 		FolloweeID: followeeID,
 	})
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
+	models.CountFollow(follow, 1)
 
 	// Create activity
 	models.Activities.Insert(&models.Activity{
@@ -80,11 +93,28 @@ func (c *FollowsController) follow(w http.ResponseWriter, r *http.Request) {
 		SubjectID:   followeeID,
 	})
 
-	// Send email notification in background
+	// Notify the followee in background
 	go func() {
-		models.Emails.Send(followee.Email,
-			"New Follower on The Skyscape",
-			emailing.WithTemplate("new-follower.html"),
+		webhooks.Follow(followee.ID, user)
+
+		push.SendNotification(
+			followee.ID,
+			user.ID, // source = follower
+			models.NotifyFollow,
+			"New follower",
+			"@"+user.Handle+" started following you",
+			"/user/"+user.Handle,
+		)
+
+		if !models.WantsEmail(followee.ID, models.NotifyFollow) {
+			return
+		}
+
+		locale := models.EmailLocale(followee.ID)
+		models.SendEmail(followee.Email,
+			i18n.T(locale, "New Follower on The Skyscape"),
+			"new-follower.html",
+			emailing.WithData("t", i18n.For(locale)),
 			emailing.WithData("user", followee),
 			emailing.WithData("follower", user),
 			emailing.WithData("year", time.Now().Year()),
@@ -98,7 +128,7 @@ func (c *FollowsController) unfollow(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -107,14 +137,110 @@ func (c *FollowsController) unfollow(w http.ResponseWriter, r *http.Request) {
 	follow, err := models.Follows.First("WHERE FollowerID = ? AND FolloweeID = ?",
 		user.ID, followeeID)
 	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("not following"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("not following")))
+		return
+	}
+
+	if err = models.ThrottleFollow.Allow(user.ID, auth.getClientIP(r)); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	if err = models.Follows.Delete(follow); err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
+	models.CountFollow(follow, -1)
 
 	c.Refresh(w, r)
 }
+
+// FollowsTopic returns true if the current user follows a repo, project
+// or tag
+func (c *FollowsController) FollowsTopic(topicType, topicID string) bool {
+	auth := c.Use("auth").(*AuthController)
+	user := auth.CurrentUser()
+	if user == nil {
+		return false
+	}
+	return models.FollowsTopic(user.ID, topicType, topicID)
+}
+
+// followTopic follows a repo, project or tag; following twice is a no-op
+func (c *FollowsController) followTopic(topicType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := c.Use("auth").(*AuthController)
+		user, _, err := auth.Authenticate(r)
+		if err != nil {
+			c.Render(w, r, "error-message.html", localize(r, err))
+			return
+		}
+
+		topicID := r.PathValue("id")
+		switch topicType {
+		case models.TopicRepo:
+			_, err = models.Repos.Get(topicID)
+		case models.TopicProject:
+			_, err = models.Projects.Get(topicID)
+		case models.TopicTag:
+			if topicID = models.NormalizeTag(topicID); topicID == "" {
+				err = errors.New("invalid tag")
+			}
+		}
+		if err != nil {
+			c.Render(w, r, "error-message.html", localize(r, errors.New(topicType+" not found")))
+			return
+		}
+
+		if models.FollowsTopic(user.ID, topicType, topicID) {
+			c.Refresh(w, r)
+			return
+		}
+
+		if err = models.ThrottleFollow.Allow(user.ID, auth.getClientIP(r)); err != nil {
+			c.Render(w, r, "error-message.html", localize(r, err))
+			return
+		}
+
+		if _, err = models.TopicFollows.Insert(&models.TopicFollow{
+			UserID:    user.ID,
+			TopicType: topicType,
+			TopicID:   topicID,
+		}); err != nil {
+			c.Render(w, r, "error-message.html", localize(r, err))
+			return
+		}
+
+		c.Refresh(w, r)
+	}
+}
+
+// unfollowTopic stops following a repo, project or tag
+func (c *FollowsController) unfollowTopic(topicType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := c.Use("auth").(*AuthController)
+		user, _, err := auth.Authenticate(r)
+		if err != nil {
+			c.Render(w, r, "error-message.html", localize(r, err))
+			return
+		}
+
+		topicID := r.PathValue("id")
+		if topicType == models.TopicTag {
+			topicID = models.NormalizeTag(topicID)
+		}
+
+		follow := models.FindTopicFollow(user.ID, topicType, topicID)
+		if follow == nil {
+			c.Refresh(w, r)
+			return
+		}
+
+		if err = models.TopicFollows.Delete(follow); err != nil {
+			c.Render(w, r, "error-message.html", localize(r, err))
+			return
+		}
+
+		c.Refresh(w, r)
+	}
+}
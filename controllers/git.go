@@ -1,16 +1,25 @@
 package controllers
 
 import (
+	"bytes"
+	"context"
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/The-Skyscape/devtools/pkg/application"
 	"github.com/The-Skyscape/devtools/pkg/authentication"
 	"github.com/sosedoff/gitkit"
+	"golang.org/x/crypto/ssh"
+	"www.theskyscape.com/internal/gitssh"
 	"www.theskyscape.com/internal/hosting"
+	"www.theskyscape.com/internal/logging"
+	"www.theskyscape.com/internal/summaries"
+	"www.theskyscape.com/internal/tracing"
+	"www.theskyscape.com/internal/webhooks"
 	"www.theskyscape.com/models"
 )
 
@@ -25,8 +34,17 @@ type GitController struct {
 func (c *GitController) Setup(app *application.App) {
 	c.Controller.Setup(app)
 
-	http.Handle("/repo/", http.StripPrefix("/repo/", c.repoGitServer()))
-	http.Handle("/project/", http.StripPrefix("/project/", c.projectGitServer()))
+	route("/repo/", http.StripPrefix("/repo/", c.repoGitServer()))
+	route("/project/", http.StripPrefix("/project/", c.projectGitServer()))
+
+	// Git over SSH runs on its own port when one is configured
+	if addr := os.Getenv("SSH_ADDR"); addr != "" {
+		go func() {
+			if err := c.sshServer().ListenAndServe(addr); err != nil {
+				slog.Error("git ssh server stopped", "error", err)
+			}
+		}()
+	}
 }
 
 func (c GitController) Handle(r *http.Request) application.Handler {
@@ -65,88 +83,37 @@ func (c *GitController) repoGitServer() *gitkit.Server {
 			return false, errors.New("invalid username or password")
 		} else if !user.VerifyPassword(creds.Password) {
 			return false, errors.New("invalid username or password")
+		} else if models.ActiveSuspension(user.ID) != nil {
+			return false, errors.New("account suspended")
 		} else {
-			log.Printf("User auth successful for %s", creds.Username)
+			logging.SetUser(req.Request.Context(), user.ID)
+			slog.DebugContext(req.Request.Context(), "git auth successful", "handle", creds.Username, "repo_id", req.RepoName)
 		}
 
-		repo, err := models.Repos.Get(req.RepoName)
+		repo, err := authorizeRepo(user, req.RepoName, isPush)
 		if err != nil {
-			log.Printf("Repository not found: %s", req.RepoName)
-			return false, errors.New("repository not found")
-		}
-
-		if isPush && (repo.OwnerID != user.ID && !user.IsAdmin) {
-			return false, errors.New("only owner can push to their repos")
+			slog.WarnContext(req.Request.Context(), "git access denied", "repo_id", req.RepoName, "error", err)
+			return false, err
 		}
 
 		// Create activity and trigger auto-deploy only on actual pack upload (not refs discovery)
 		if isPushPack {
-			go func(repoID, userID string) {
+			// The pack hasn't been received yet, so HEAD is still the old tip
+			before := headCommit(repo.GitContext(req.Request.Context(), "rev-parse", "--verify", "--quiet", "HEAD"))
+
+			go func(ctx context.Context, repoID, userID string) {
 				// Wait for push to complete
 				time.Sleep(2 * time.Second)
-
-				// Re-fetch repo to ensure we have latest data
-				repo, err := models.Repos.Get(repoID)
-				if err != nil {
-					return
-				}
-
-				// Get latest commit message from the repo
-				stdout, _, err := repo.Git("log", "-1", "--pretty=format:%s")
-				if err != nil {
-					log.Printf("Failed to get commit message: %v", err)
-					return
-				}
-
-				commitMsg := strings.TrimSpace(stdout.String())
-				if commitMsg == "" {
-					return
-				}
-
-				// Create activity
-				models.Activities.Insert(&models.Activity{
-					UserID:      userID,
-					Action:      "pushed",
-					SubjectType: "repo",
-					SubjectID:   repoID,
-					Content:     commitMsg,
-				})
-
-				// Auto-deploy: trigger build for any apps linked to this repo
-				apps, err := repo.Apps()
-				if err != nil || len(apps) == 0 {
-					return
-				}
-
-				for _, app := range apps {
-					// Skip shutdown apps
-					if app.Status == "shutdown" {
-						continue
-					}
-
-					log.Printf("[AutoDeploy] Triggering build for app %s after push to %s", app.ID, repoID)
-
-					// Start build in background
-					go func(a *models.App) {
-						a.Status = "launching"
-						a.Error = ""
-						models.Apps.Update(a)
-
-						if _, err := hosting.BuildApp(a); err != nil {
-							a.Error = err.Error()
-							models.Apps.Update(a)
-							log.Printf("[AutoDeploy] Build failed for app %s: %v", a.ID, err)
-						}
-					}(app)
-				}
-			}(repo.ID, user.ID)
+				afterRepoPush(ctx, repoID, userID, before)
+			}(tracing.Detach(req.Request.Context()), repo.ID, user.ID)
 		}
 
 		return true, nil
 	}
 
 	if err := git.Setup(); err != nil {
-		log.Fatal("Failed to setup git server: ", err)
+		slog.Error("failed to set up git server", "error", err)
+		os.Exit(1)
 	}
 
 	return git
@@ -184,78 +151,303 @@ func (c *GitController) projectGitServer() *gitkit.Server {
 			return false, errors.New("invalid username or password")
 		} else if !user.VerifyPassword(creds.Password) {
 			return false, errors.New("invalid username or password")
+		} else if models.ActiveSuspension(user.ID) != nil {
+			return false, errors.New("account suspended")
 		} else {
-			log.Printf("User auth successful for %s (project)", creds.Username)
+			logging.SetUser(req.Request.Context(), user.ID)
+			slog.DebugContext(req.Request.Context(), "git auth successful", "handle", creds.Username, "project_id", req.RepoName)
 		}
 
-		project, err := models.Projects.Get(req.RepoName)
+		project, err := authorizeProject(user, req.RepoName, isPush)
 		if err != nil {
-			log.Printf("Project not found: %s", req.RepoName)
-			return false, errors.New("project not found")
-		}
-
-		if isPush && (project.OwnerID != user.ID && !user.IsAdmin) {
-			return false, errors.New("only owner can push to their projects")
+			slog.WarnContext(req.Request.Context(), "git access denied", "project_id", req.RepoName, "error", err)
+			return false, err
 		}
 
 		// Create activity and trigger auto-deploy only on actual pack upload (not refs discovery)
 		if isPushPack {
-			go func(projectID, userID string) {
+			// The pack hasn't been received yet, so HEAD is still the old tip
+			before := headCommit(project.GitContext(req.Request.Context(), "rev-parse", "--verify", "--quiet", "HEAD"))
+
+			go func(ctx context.Context, projectID, userID string) {
 				// Wait for push to complete
 				time.Sleep(2 * time.Second)
+				afterProjectPush(ctx, projectID, userID, before)
+			}(tracing.Detach(req.Request.Context()), project.ID, user.ID)
+		}
+
+		return true, nil
+	}
 
-				// Re-fetch project to ensure we have latest data
-				project, err := models.Projects.Get(projectID)
+	if err := git.Setup(); err != nil {
+		slog.Error("failed to set up project git server", "error", err)
+		os.Exit(1)
+	}
+
+	return git
+}
+
+// sshServer serves git over SSH for users' registered keys, with the same
+// access rules and push handling as git over HTTP
+func (c *GitController) sshServer() *gitssh.Server {
+	hostKey := os.Getenv("SSH_HOST_KEY")
+	if hostKey == "" {
+		hostKey = "/mnt/git-repos/.ssh/host_ed25519_key"
+	}
+
+	return &gitssh.Server{
+		HostKeyPath: hostKey,
+		LookupKey: func(pub ssh.PublicKey) (string, error) {
+			key, err := models.FindSSHKey(pub)
+			if err != nil {
+				return "", err
+			}
+			return key.ID, nil
+		},
+		Authorize: func(req *gitssh.Request) (string, func(), error) {
+			key, err := models.SSHKeys.Get(req.KeyID)
+			if err != nil {
+				return "", nil, errors.New("unknown public key")
+			}
+			user, err := models.Auth.Users.Get(key.UserID)
+			if err != nil {
+				return "", nil, errors.New("unknown public key")
+			}
+			if models.ActiveSuspension(user.ID) != nil {
+				return "", nil, errors.New("account suspended")
+			}
+			key.Touch()
+
+			switch req.Kind {
+			case "repo":
+				repo, err := authorizeRepo(user, req.ID, req.IsPush())
 				if err != nil {
-					return
+					slog.Warn("git ssh access denied", "repo_id", req.ID, "user_id", user.ID, "error", err)
+					return "", nil, err
 				}
-
-				// Get latest commit message from the project
-				stdout, _, err := project.Git("log", "-1", "--pretty=format:%s")
+				before := headCommit(repo.GitContext(req.Context, "rev-parse", "--verify", "--quiet", "HEAD"))
+				return repo.Path(), func() {
+					afterRepoPush(context.Background(), repo.ID, user.ID, before)
+				}, nil
+			default:
+				project, err := authorizeProject(user, req.ID, req.IsPush())
 				if err != nil {
-					log.Printf("Failed to get commit message: %v", err)
-					return
+					slog.Warn("git ssh access denied", "project_id", req.ID, "user_id", user.ID, "error", err)
+					return "", nil, err
 				}
+				before := headCommit(project.GitContext(req.Context, "rev-parse", "--verify", "--quiet", "HEAD"))
+				return project.Path(), func() {
+					afterProjectPush(context.Background(), project.ID, user.ID, before)
+				}, nil
+			}
+		},
+	}
+}
 
-				commitMsg := strings.TrimSpace(stdout.String())
-				if commitMsg == "" {
-					return
-				}
+// authorizeRepo checks a user may pull from or push to a repo. Git over
+// HTTP and SSH share it.
+func authorizeRepo(user *authentication.User, repoID string, isPush bool) (*models.Repo, error) {
+	repo, err := models.Repos.Get(repoID)
+	if err != nil {
+		return nil, errors.New("repository not found")
+	}
 
-				// Create activity
-				models.Activities.Insert(&models.Activity{
-					UserID:      userID,
-					Action:      "pushed",
-					SubjectType: "project",
-					SubjectID:   projectID,
-					Content:     commitMsg,
-				})
-
-				// Auto-deploy: trigger build for the project directly
-				if project.Status == "shutdown" {
-					return
-				}
+	// Taken down repos stay readable by their owner so they can recover their code
+	if repo.Takedown() != nil && !user.IsAdmin && (isPush || repo.OwnerID != user.ID) {
+		return nil, errors.New("repository has been taken down")
+	}
 
-				log.Printf("[AutoDeploy] Triggering build for project %s after push", projectID)
+	if isPush && (repo.OwnerID != user.ID && !user.IsAdmin) {
+		return nil, errors.New("only owner can push to their repos")
+	}
 
-				project.Status = "launching"
-				project.Error = ""
-				models.Projects.Update(project)
+	return repo, nil
+}
 
-				if _, err := hosting.BuildProject(project); err != nil {
-					project.Error = err.Error()
-					models.Projects.Update(project)
-					log.Printf("[AutoDeploy] Build failed for project %s: %v", projectID, err)
-				}
-			}(project.ID, user.ID)
+// afterRepoPush records the push in the feed and redeploys the repo's apps.
+// before is the commit HEAD pointed at before the push.
+func afterRepoPush(ctx context.Context, repoID, userID, before string) {
+	// Re-fetch repo to ensure we have latest data
+	repo, err := models.Repos.Get(repoID)
+	if err != nil {
+		return
+	}
+
+	// Get latest commit message from the repo
+	stdout, _, err := repo.GitContext(ctx, "log", "-1", "--pretty=format:%s")
+	if err != nil {
+		slog.Error("failed to get commit message", "error", err)
+		return
+	}
+
+	commitMsg := strings.TrimSpace(stdout.String())
+	if commitMsg == "" {
+		return
+	}
+
+	// Create activity
+	models.Activities.Insert(&models.Activity{
+		UserID:      userID,
+		Action:      "pushed",
+		SubjectType: "repo",
+		SubjectID:   repoID,
+		Content:     pushContent(ctx, repo.GitContext, userID, before, commitMsg),
+	})
+
+	pusher, _ := models.Auth.Users.Get(userID)
+	after := headCommit(repo.GitContext(ctx, "rev-parse", "HEAD"))
+	go webhooks.Push(repo.OwnerID, webhooks.NewSubject(models.WebhookRepo, repo.ID, repo.Name), pusher, before, after, commitMsg)
+
+	// Auto-deploy: trigger build for any apps linked to this repo
+	apps, err := repo.Apps()
+	if err != nil || len(apps) == 0 {
+		return
+	}
+
+	for _, app := range apps {
+		// Skip shutdown apps
+		if app.Status == "shutdown" {
+			continue
 		}
 
-		return true, nil
+		slog.Info("auto-deploy triggered", "app_id", app.ID, "repo_id", repoID)
+
+		// Start build in background
+		go func(a *models.App) {
+			a.Status = "launching"
+			a.Error = ""
+			models.Apps.Update(a)
+
+			if _, err := hosting.BuildApp(ctx, a); err != nil {
+				a.Error = err.Error()
+				models.Apps.Update(a)
+				slog.Error("auto-deploy build failed", "app_id", a.ID, "error", err)
+			}
+		}(app)
 	}
+}
 
-	if err := git.Setup(); err != nil {
-		log.Fatal("Failed to setup project git server: ", err)
+// authorizeProject checks a user may pull from or push to a project. Git
+// over HTTP and SSH share it.
+func authorizeProject(user *authentication.User, projectID string, isPush bool) (*models.Project, error) {
+	project, err := models.Projects.Get(projectID)
+	if err != nil {
+		return nil, errors.New("project not found")
 	}
 
-	return git
+	// Taken down projects stay readable by their owner so they can recover their code
+	if project.Takedown() != nil && !user.IsAdmin && (isPush || project.OwnerID != user.ID) {
+		return nil, errors.New("project has been taken down")
+	}
+
+	if isPush && (project.OwnerID != user.ID && !user.IsAdmin) {
+		return nil, errors.New("only owner can push to their projects")
+	}
+
+	return project, nil
+}
+
+// afterProjectPush records the push in the feed and redeploys the project.
+// before is the commit HEAD pointed at before the push.
+func afterProjectPush(ctx context.Context, projectID, userID, before string) {
+	// Re-fetch project to ensure we have latest data
+	project, err := models.Projects.Get(projectID)
+	if err != nil {
+		return
+	}
+
+	// Get latest commit message from the project
+	stdout, _, err := project.GitContext(ctx, "log", "-1", "--pretty=format:%s")
+	if err != nil {
+		slog.Error("failed to get commit message", "error", err)
+		return
+	}
+
+	commitMsg := strings.TrimSpace(stdout.String())
+	if commitMsg == "" {
+		return
+	}
+
+	// Create activity
+	models.Activities.Insert(&models.Activity{
+		UserID:      userID,
+		Action:      "pushed",
+		SubjectType: "project",
+		SubjectID:   projectID,
+		Content:     pushContent(ctx, project.GitContext, userID, before, commitMsg),
+	})
+
+	pusher, _ := models.Auth.Users.Get(userID)
+	after := headCommit(project.GitContext(ctx, "rev-parse", "HEAD"))
+	go webhooks.Push(project.OwnerID, webhooks.NewSubject(models.WebhookProject, project.ID, project.Name), pusher, before, after, commitMsg)
+
+	// Auto-deploy: trigger build for the project directly
+	if project.Status == "shutdown" {
+		return
+	}
+
+	slog.Info("auto-deploy triggered", "project_id", projectID)
+
+	project.Status = "launching"
+	project.Error = ""
+	models.Projects.Update(project)
+
+	if _, err := hosting.BuildProject(ctx, project); err != nil {
+		project.Error = err.Error()
+		models.Projects.Update(project)
+		slog.Error("auto-deploy build failed", "project_id", projectID, "error", err)
+	}
+}
+
+// headCommit returns the commit from a rev-parse, or "" for an empty repository
+func headCommit(stdout, _ bytes.Buffer, err error) string {
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(stdout.String())
+}
+
+// pushContent describes a push in the feed: the latest commit message, or a
+// summary of every pushed commit when the pusher opted in to summaries
+func pushContent(ctx context.Context, git func(context.Context, ...string) (bytes.Buffer, bytes.Buffer, error), userID, before, commitMsg string) string {
+	if before == "" || !wantsSummaries(userID) {
+		return commitMsg
+	}
+
+	stdout, _, err := git(ctx, "log", "--pretty=format:%B%x00", before+"..HEAD")
+	if err != nil {
+		return commitMsg
+	}
+
+	commits := splitCommits(stdout.String())
+	if len(commits) < 2 {
+		return commitMsg
+	}
+
+	summary, err := summaries.Push(ctx, commits)
+	if err != nil {
+		slog.Warn("failed to summarize push", "user_id", userID, "error", err)
+		return commitMsg
+	}
+	return summary
+}
+
+// splitCommits splits NUL-separated git log output into commit messages
+func splitCommits(log string) []string {
+	var commits []string
+	for msg := range strings.SplitSeq(log, "\x00") {
+		if msg = strings.TrimSpace(msg); msg != "" {
+			commits = append(commits, msg)
+		}
+	}
+	return commits
+}
+
+// wantsSummaries reports whether summaries are on and the user opted in
+func wantsSummaries(userID string) bool {
+	if !summaries.Enabled() {
+		return false
+	}
+	profile, err := models.Profiles.Get(userID)
+	return err == nil && profile.Summaries
 }
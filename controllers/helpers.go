@@ -3,6 +3,15 @@ package controllers
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"www.theskyscape.com/internal/hosts"
+	"www.theskyscape.com/internal/logging"
+	"www.theskyscape.com/internal/pagecache"
+	"www.theskyscape.com/internal/tracing"
+	"www.theskyscape.com/models"
 )
 
 // JSON sends a JSON response with the given status code and data
@@ -23,3 +32,157 @@ func JSONError(w http.ResponseWriter, status int, message string) {
 func JSONSuccess(w http.ResponseWriter, data interface{}) {
 	JSON(w, http.StatusOK, data)
 }
+
+// route registers a handler on the default mux behind the tracing and
+// request logging middleware. Use it instead of http.Handle so every request
+// gets a span, an ID and a log line, and writes purge the cached pages they
+// change.
+func route(pattern string, handler http.Handler) {
+	http.Handle(pattern, tracing.Middleware(pattern, logging.Middleware(pagecache.PurgeOnWrite(changedPages, handler))))
+}
+
+// pagesOf maps the resources in write paths to the cached pages showing
+// them. A write to /{resource}/{id} purges each page with {id} filled in
+// and {user} as the writer's handle or ID; a write to /{resource} purges
+// those without {id}. Other resources purge their own path.
+var pagesOf = map[string][]string{
+	"repos":    {"/repos", "/repo/{id}"},
+	"projects": {"/projects", "/project/{id}"},
+	"apps":     {"/apps", "/app/{id}"},
+	"users":    {"/users", "/user/{id}"},
+	"feed":     {"/post/{id}"},
+	"posts":    {"/post/{id}"},
+	"thought":  {"/thoughts", "/user/{user}/thoughts"},
+	"thoughts": {"/thoughts", "/user/{user}/thoughts"},
+}
+
+// changedPages returns the cached pages a write may have changed: a
+// collection it added to, like /repos, or the pages of the one resource it
+// changed, like /repo/{id} and those under it. API writes count for the
+// same pages. Only authenticated writes purge anything, so sign in
+// attempts, webhooks and made-up tokens can't empty the cache.
+func changedPages(r *http.Request) []string {
+	userID := logging.UserID(r.Context())
+	if userID == "" {
+		return nil
+	}
+
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if segments[0] == "api" {
+		segments = segments[1:]
+	}
+	if len(segments) == 0 || segments[0] == "" {
+		return nil
+	}
+	resource, id := segments[0], ""
+	if len(segments) > 1 {
+		id = strings.TrimSuffix(segments[1], ".git")
+	}
+
+	patterns, ok := pagesOf[resource]
+	if !ok {
+		return []string{strings.TrimSuffix("/"+resource+"/"+id, "/")}
+	}
+
+	var pages []string
+	for _, page := range patterns {
+		if strings.Contains(page, "{id}") {
+			if id == "" {
+				continue
+			}
+			page = strings.ReplaceAll(page, "{id}", id)
+		}
+		if strings.Contains(page, "{user}") {
+			writer := []string{userID}
+			if user, err := models.Auth.Users.Get(userID); err == nil {
+				writer = append(writer, user.Handle)
+			}
+			for _, name := range writer {
+				pages = append(pages, strings.ReplaceAll(page, "{user}", name))
+			}
+			continue
+		}
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+// noindex asks search engines not to index a response, for pages like
+// checkout and HTMX partials that are useless out of context
+func noindex(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Robots-Tag", "noindex")
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// publicPageTTL is how long anonymous visitors may be served a cached copy
+// of a public page. Writes purge the cache sooner.
+const publicPageTTL = 30 * time.Second
+
+// pageCookies are the cookies a cached page's content depends on
+var pageCookies = []string{localeCookie, dismissedCookie}
+
+// cached serves anonymous visitors a public page from the page cache and
+// adds ETags so browsers can revalidate it cheaply. Only the web host's
+// pages are cached: auth.Optional forwards app and project hosts to their
+// containers, whose responses must pass the WAF, meters and takedown
+// checks every time and keep their own caching headers.
+func cached(handler http.Handler) http.Handler {
+	page := pagecache.Middleware(sessionCookie, pageCookies, publicPageTTL, handler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hosts.Default.Resolve(r.Host).Kind != hosts.Web {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		page.ServeHTTP(w, r)
+	})
+}
+
+// conditional adds an ETag to an API read so polling clients can
+// revalidate it with If-None-Match and get a 304 when nothing changed
+func conditional(handler http.HandlerFunc) http.HandlerFunc {
+	return pagecache.ETags(handler).ServeHTTP
+}
+
+// setLastModified sends the latest of the UpdatedAt times an API response
+// is built from as Last-Modified, keeping a later one already set so lists
+// can call it for each item. It's informational: revalidation goes by the
+// ETag alone, since counts like stars change without touching UpdatedAt.
+func setLastModified(w http.ResponseWriter, times ...time.Time) {
+	latest, _ := http.ParseTime(w.Header().Get("Last-Modified"))
+	for _, t := range times {
+		if t.After(latest) {
+			latest = t
+		}
+	}
+	if !latest.IsZero() {
+		w.Header().Set("Last-Modified", latest.UTC().Format(http.TimeFormat))
+	}
+}
+
+// claimEdit checks the version an edit form was loaded with against the
+// record, so a save from a stale tab gets models.ErrEditConflict instead of
+// overwriting newer changes. The new version is sent back in X-Edit-Version
+// for forms that keep saving. Requests without a version skip the check.
+func claimEdit(w http.ResponseWriter, r *http.Request, record models.Editable) error {
+	value := r.FormValue("version")
+	if value == "" {
+		return nil
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		return models.ErrEditConflict
+	}
+	if err := models.ClaimEdit(record, version); err != nil {
+		return err
+	}
+	w.Header().Set("X-Edit-Version", strconv.Itoa(version+1))
+	return nil
+}
+
+// doNotTrack returns true if the browser asks not to be tracked, with
+// either Do Not Track or Global Privacy Control
+func doNotTrack(r *http.Request) bool {
+	return r.Header.Get("DNT") == "1" || r.Header.Get("Sec-GPC") == "1"
+}
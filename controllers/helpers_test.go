@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"www.theskyscape.com/internal/logging"
+)
+
+func TestCachedSkipsSiteHosts(t *testing.T) {
+	tests := []struct {
+		host   string
+		served int // Times the handler runs for two identical requests
+	}{
+		{"www.theskyscape.com", 1},
+		{"blog.skysca.pe", 2},
+		{"a.blog.skysca.pe", 2},
+		{"theskyscape.com", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			served := 0
+			handler := cached(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				served++
+				w.Header().Set("Cache-Control", "max-age=60")
+				w.Write([]byte("page"))
+			}))
+
+			for range 2 {
+				r := httptest.NewRequest("GET", "http://"+tt.host+"/post/cached-"+tt.host, nil)
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+
+				if tt.served == 2 {
+					if cache := w.Header().Get("X-Cache"); cache != "" {
+						t.Errorf("X-Cache = %q, want the page left uncached", cache)
+					}
+					if got := w.Header().Get("Cache-Control"); got != "max-age=60" {
+						t.Errorf("Cache-Control = %q, want the handler's own", got)
+					}
+				}
+			}
+			if served != tt.served {
+				t.Errorf("handler ran %d times, want %d", served, tt.served)
+			}
+		})
+	}
+}
+
+func TestChangedPages(t *testing.T) {
+	tests := []struct {
+		method, path string
+		signedIn     bool
+		want         []string
+	}{
+		{"POST", "/repos", true, []string{"/repos"}},
+		{"POST", "/repo/abc/star", true, []string{"/repo/abc"}},
+		{"POST", "/repos/abc/share", true, []string{"/repos", "/repo/abc"}},
+		{"POST", "/api/repos", true, []string{"/repos"}},
+		{"POST", "/repo/abc/git-receive-pack", true, []string{"/repo/abc"}},
+		{"DELETE", "/feed/abc", true, []string{"/post/abc"}},
+		{"POST", "/feed/abc/restore", true, []string{"/post/abc"}},
+		{"POST", "/post/abc/react", true, []string{"/post/abc"}},
+		{"POST", "/settings/profile", true, []string{"/settings/profile"}},
+		{"POST", "/", true, nil},
+		{"POST", "/repo/abc/star", false, nil},
+		{"POST", "/signin", false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			var got []string
+			handler := logging.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.signedIn {
+					logging.SetUser(r.Context(), "user-id")
+				}
+				got = changedPages(r)
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("changedPages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"www.theskyscape.com/internal/i18n"
+)
+
+// localeCookie remembers the signed-in user's language setting so pages
+// don't need a profile lookup to pick a locale
+const localeCookie = "locale"
+
+func I18n() (string, *I18nController) {
+	return "i18n", &I18nController{}
+}
+
+// I18nController exposes translations to views, e.g. {{i18n.T "Save"}}
+type I18nController struct {
+	application.Controller
+}
+
+func (c I18nController) Handle(r *http.Request) application.Handler {
+	c.Request = r
+	return &c
+}
+
+// T translates msg into the request's locale
+func (c *I18nController) T(msg string, args ...any) string {
+	return i18n.T(requestLocale(c.Request), msg, args...)
+}
+
+// Locale returns the request's locale, for <html lang> and selected options
+func (c *I18nController) Locale() string {
+	return requestLocale(c.Request)
+}
+
+// Locales lists the languages users can choose from
+func (c *I18nController) Locales() []i18n.Locale {
+	return i18n.Locales
+}
+
+// requestLocale picks the user's saved language, falling back to the
+// browser's Accept-Language header
+func requestLocale(r *http.Request) string {
+	if r == nil {
+		return i18n.Default
+	}
+	if cookie, err := r.Cookie(localeCookie); err == nil && i18n.Supported(cookie.Value) {
+		return cookie.Value
+	}
+	return i18n.Negotiate(r.Header.Get("Accept-Language"))
+}
+
+// localize translates an error before it is rendered to the user
+func localize(r *http.Request, err error) error {
+	return i18n.Error(requestLocale(r), err)
+}
+
+// setLocaleCookie saves a language setting, clearing it for "" (browser default)
+func setLocaleCookie(w http.ResponseWriter, locale string) {
+	cookie := &http.Cookie{
+		Name:     localeCookie,
+		Value:    locale,
+		Path:     "/",
+		MaxAge:   int((365 * 24 * time.Hour).Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if locale == "" {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+}
@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/The-Skyscape/devtools/pkg/authentication"
+	"www.theskyscape.com/models"
+)
+
+// impersonatorCookie holds the admin's own session token while they're
+// signed in as someone else
+const impersonatorCookie = "theskyscape-admin"
+
+// endImpersonationPath is the one write allowed while impersonating
+const endImpersonationPath = "/_auth/impersonation/end"
+
+// impersonate signs the admin in as a user for ImpersonationExpiry, to
+// see the site the way they do. The admin's session is set aside rather
+// than signed out, and comes back when the impersonation ends.
+func (c *AuthController) impersonate(w http.ResponseWriter, r *http.Request) {
+	admin, adminSession, err := c.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	user, err := models.Auth.Users.Get(r.PathValue("user"))
+	if err != nil {
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
+		return
+	}
+
+	if user.ID == admin.ID || user.IsAdmin {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("admins cannot be impersonated")))
+		return
+	}
+
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if reason == "" {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("a reason is required")))
+		return
+	}
+
+	adminToken, err := r.Cookie(sessionCookie)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	impersonation, session, err := models.Impersonate(admin, adminSession, user, reason)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	token, _ := session.Token()
+	http.SetCookie(w, &http.Cookie{
+		Name:     impersonatorCookie,
+		Value:    adminToken.Value,
+		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
+		Expires:  impersonation.ExpiresAt,
+		HttpOnly: true,
+		Secure:   true,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
+		Expires:  impersonation.ExpiresAt,
+		HttpOnly: true,
+		Secure:   true,
+	})
+
+	slog.InfoContext(r.Context(), "admin started impersonation", "admin", admin.Handle, "handle", user.Handle, "reason", reason)
+	c.audit(r, admin.ID, models.AuditImpersonationStarted, "user", user.ID, reason)
+	c.Redirect(w, r, "/user/"+user.Handle)
+}
+
+// endImpersonation signs the admin back in as themselves
+func (c *AuthController) endImpersonation(w http.ResponseWriter, r *http.Request) {
+	if !c.impersonating(r) && c.activeImpersonation(r) == nil {
+		c.Redirect(w, r, "/")
+		return
+	}
+	if !c.stopImpersonating(w, r) {
+		c.Redirect(w, r, "/signin")
+		return
+	}
+	c.Redirect(w, r, "/admin")
+}
+
+// Impersonation returns the impersonation the current request is browsing
+// with, for the banner, or nil if the user is signed in as themselves
+func (c *AuthController) Impersonation() *models.Impersonation {
+	return c.activeImpersonation(c.Request)
+}
+
+// activeImpersonation returns the impersonation the request's session
+// belongs to, or nil if it's the user's own. It's decided by the session
+// alone, so deleting the admin's cookie doesn't lift the restrictions.
+func (c *AuthController) activeImpersonation(r *http.Request) *models.Impersonation {
+	_, session, err := c.Authenticate(r)
+	if err != nil {
+		return nil
+	}
+	return models.ActiveImpersonation(session.ID)
+}
+
+// impersonating reports whether the browser holds an admin's session set
+// aside by an impersonation, to restore once it ends. Only admins are
+// given the cookie, and it grants nothing by itself.
+func (c *AuthController) impersonating(r *http.Request) bool {
+	_, err := r.Cookie(impersonatorCookie)
+	return err == nil
+}
+
+// impersonator authenticates the admin's own session set aside while
+// impersonating
+func (c *AuthController) impersonator(r *http.Request) (*authentication.User, *authentication.Session, error) {
+	cookie, err := r.Cookie(impersonatorCookie)
+	if err != nil {
+		return nil, nil, err
+	}
+	admin := r.Clone(r.Context())
+	admin.Header.Del("Cookie")
+	admin.AddCookie(&http.Cookie{Name: sessionCookie, Value: cookie.Value})
+	return c.Authenticate(admin)
+}
+
+// checkImpersonation scopes an impersonation: the admin can look but not
+// change anything, and once it expires or is signed out of, they're
+// returned to their own session. Returns false if it handled the request.
+func (c *AuthController) checkImpersonation(w http.ResponseWriter, r *http.Request) bool {
+	impersonation := c.activeImpersonation(r)
+	if impersonation == nil {
+		if !c.impersonating(r) {
+			return true
+		}
+		if c.stopImpersonating(w, r) {
+			c.Redirect(w, r, "/admin")
+		} else {
+			c.Redirect(w, r, "/signin")
+		}
+		return false
+	}
+
+	slog.InfoContext(r.Context(), "impersonated request", "admin_id", impersonation.AdminID, "user_id", impersonation.UserID, "method", r.Method, "path", r.URL.Path)
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.URL.Path != endImpersonationPath {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("changes are disabled while signed in as another user")))
+		return false
+	}
+	return true
+}
+
+// stopImpersonating ends this browser's impersonation and restores the
+// admin's session. Returns false if the admin's session has since expired,
+// leaving the browser signed out.
+func (c *AuthController) stopImpersonating(w http.ResponseWriter, r *http.Request) bool {
+	admin, adminSession, err := c.impersonator(r)
+
+	var ended []*models.Impersonation
+	if err == nil {
+		ended = models.EndImpersonations(adminSession.ID)
+	} else if _, session, err := c.Authenticate(r); err == nil {
+		if impersonation := models.ActiveImpersonation(session.ID); impersonation != nil {
+			impersonation.End()
+			ended = append(ended, impersonation)
+		}
+	}
+	for _, impersonation := range ended {
+		detail := ""
+		if impersonation.IsExpired() {
+			detail = "expired"
+		}
+		c.audit(r, impersonation.AdminID, models.AuditImpersonationEnded, "user", impersonation.UserID, detail)
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: impersonatorCookie, Path: "/", MaxAge: -1})
+
+	if err != nil || !admin.IsAdmin {
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+		return false
+	}
+
+	token, _ := adminSession.Token()
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
+		Expires:  adminSession.ExpiresAt,
+		HttpOnly: true,
+		Secure:   true,
+	})
+	return true
+}
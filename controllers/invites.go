@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/The-Skyscape/devtools/pkg/emailing"
+	"www.theskyscape.com/internal/i18n"
+	"www.theskyscape.com/models"
+)
+
+func Invites() (string, *InvitesController) {
+	return "invites", &InvitesController{}
+}
+
+type InvitesController struct {
+	application.Controller
+}
+
+func (c *InvitesController) Setup(app *application.App) {
+	c.Controller.Setup(app)
+	auth := c.Use("auth").(*AuthController)
+
+	route("GET /invites", c.Serve("invites.html", auth.Required))
+	route("POST /invites", c.ProtectFunc(c.create, auth.Required))
+
+	route("GET /waitlist", c.Serve("waitlist.html", auth.Optional))
+	route("POST /waitlist", c.ProtectFunc(c.joinWaitlist, auth.Optional))
+
+	route("GET /admin/invites", c.Serve("admin-invites.html", auth.AdminRequired))
+	route("POST /admin/waitlist/{entry}/invite", c.ProtectFunc(c.inviteEntry, auth.AdminRequired))
+}
+
+func (c InvitesController) Handle(r *http.Request) application.Handler {
+	c.Request = r
+	return &c
+}
+
+// Required returns true when signups need an invite code
+func (c *InvitesController) Required() bool {
+	return models.InviteOnly()
+}
+
+// MyInvites returns invites created by the current user
+func (c *InvitesController) MyInvites() []*models.Invite {
+	auth := c.Use("auth").(*AuthController)
+	user := auth.CurrentUser()
+	if user == nil {
+		return nil
+	}
+
+	invites, _ := models.Invites.Search(`
+		WHERE InviterID = ?
+		ORDER BY CreatedAt DESC
+	`, user.ID)
+	return invites
+}
+
+// Waitlist returns entries still waiting for an invite, oldest first
+func (c *InvitesController) Waitlist() []*models.WaitlistEntry {
+	entries, _ := models.WaitlistEntries.Search(`
+		WHERE InviteID = ''
+		ORDER BY CreatedAt ASC
+	`)
+	return entries
+}
+
+// TopInviters returns the profiles that brought in the most users
+func (c *InvitesController) TopInviters() []*models.Profile {
+	profiles, _ := models.Profiles.Search(`
+		WHERE UserID IN (SELECT InviterID FROM invites WHERE InviteeID != '')
+		ORDER BY (SELECT COUNT(*) FROM invites WHERE InviterID = profiles.UserID AND InviteeID != '') DESC
+		LIMIT 20
+	`)
+	return profiles
+}
+
+// RedeemedCount returns how many users joined through an invite
+func (c *InvitesController) RedeemedCount() int {
+	return models.Invites.Count("WHERE InviteeID != ''")
+}
+
+// IssuedCount returns how many invites have been created
+func (c *InvitesController) IssuedCount() int {
+	return models.Invites.Count("")
+}
+
+func (c *InvitesController) create(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	profile, err := models.Profiles.Get(user.ID)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	if !user.IsAdmin && profile.RemainingInvites() == 0 {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("you have used all of your invites")))
+		return
+	}
+
+	if _, err = models.CreateInvite(user.ID, ""); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+func (c *InvitesController) joinWaitlist(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	ip := auth.getClientIP(r)
+
+	// Check rate limit: 3 requests per hour
+	allowed, _, err := models.Check(ip, "waitlist", 3, time.Hour)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	if !allowed {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("Too many requests. Please try again later.")))
+		return
+	}
+
+	models.Record(ip, "waitlist", time.Hour)
+
+	addr, err := mail.ParseAddress(r.FormValue("email"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("please enter a valid email address")))
+		return
+	}
+
+	email := strings.ToLower(addr.Address)
+	if existing, _ := models.WaitlistEntries.First("WHERE Email = ?", email); existing != nil {
+		c.Redirect(w, r, "/waitlist?joined=true")
+		return
+	}
+
+	_, err = models.WaitlistEntries.Insert(&models.WaitlistEntry{
+		Email:  email,
+		Name:   strings.TrimSpace(r.FormValue("name")),
+		Reason: strings.TrimSpace(r.FormValue("reason")),
+	})
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Redirect(w, r, "/waitlist?joined=true")
+}
+
+func (c *InvitesController) inviteEntry(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	admin, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	entry, err := models.WaitlistEntries.Get(r.PathValue("entry"))
+	if err != nil {
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
+		return
+	}
+
+	if entry.InviteID != "" {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("already invited")))
+		return
+	}
+
+	invite, err := models.CreateInvite(admin.ID, entry.Email)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	entry.InviteID = invite.ID
+	if err = models.WaitlistEntries.Update(entry); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	go func() {
+		if err := models.SendEmail(entry.Email,
+			"Your invite to The Skyscape",
+			"invite.html",
+			emailing.WithData("t", i18n.For(i18n.Default)), // Invitees have no language setting yet
+			emailing.WithData("Title", "You're Invited"),
+			emailing.WithData("name", entry.Name),
+			emailing.WithData("invite", invite),
+			emailing.WithData("year", time.Now().Year()),
+		); err != nil {
+			slog.Error("failed to email invite", "email", entry.Email, "error", err)
+		}
+	}()
+
+	c.Refresh(w, r)
+}
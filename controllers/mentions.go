@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/The-Skyscape/devtools/pkg/authentication"
+	"www.theskyscape.com/internal/push"
+	"www.theskyscape.com/models"
+)
+
+// mentionPattern matches @handle at the start of the text or after a space
+var mentionPattern = regexp.MustCompile(`(?:^|\s)@([A-Za-z0-9_-]+)`)
+
+// maxMentions bounds the notifications a single post or comment can send
+const maxMentions = 10
+
+// notifyMentions notifies each user @mentioned in content, once each
+func notifyMentions(author *authentication.User, content, url string) {
+	seen := map[string]bool{author.ID: true}
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		if len(seen) > maxMentions {
+			return
+		}
+
+		user, err := models.Auth.LookupUser(strings.ToLower(match[1]))
+		if err != nil || user == nil || seen[user.ID] {
+			continue
+		}
+		seen[user.ID] = true
+
+		push.SendNotification(
+			user.ID,
+			author.ID, // source = author
+			models.NotifyMention,
+			"@"+author.Handle+" mentioned you",
+			truncateMessage(content, 100),
+			url,
+		)
+	}
+}
+
+// subjectURL returns the page a comment's subject lives on
+func subjectURL(subjectType, subjectID string) string {
+	switch subjectType {
+	case "post", "thought", "repo", "app", "project":
+		return "/" + subjectType + "/" + subjectID
+	case "file":
+		// "file:{repo_id}:{path}"
+		if parts := strings.SplitN(subjectID, ":", 3); len(parts) == 3 {
+			return "/repo/" + parts[1] + "/file/" + parts[2]
+		}
+	}
+	return "/"
+}
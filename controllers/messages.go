@@ -9,6 +9,8 @@ import (
 
 	"github.com/The-Skyscape/devtools/pkg/application"
 	"github.com/The-Skyscape/devtools/pkg/emailing"
+	"www.theskyscape.com/internal/events"
+	"www.theskyscape.com/internal/i18n"
 	"www.theskyscape.com/internal/push"
 	"www.theskyscape.com/models"
 )
@@ -30,12 +32,12 @@ func (c *MessagesController) Setup(app *application.App) {
 	c.Controller.Setup(app)
 	auth := c.Use("auth").(*AuthController)
 
-	http.Handle("GET /messages", app.Serve("messages.html", auth.Required))
-	http.Handle("GET /messages/{id}", c.ProtectFunc(c.viewConversation, auth.Required))
-	http.Handle("GET /messages/{id}/list", app.Serve("message-list", auth.Required))
-	http.Handle("GET /messages/{id}/poll", c.ProtectFunc(c.pollMessages, auth.Required))
-	http.Handle("POST /messages/{id}", c.ProtectFunc(c.sendMessage, auth.Required))
-	http.Handle("GET /api/messages/unread", c.ProtectFunc(c.apiUnreadCount, auth.Required))
+	route("GET /messages", app.Serve("messages.html", auth.Required))
+	route("GET /messages/{id}", c.ProtectFunc(c.viewConversation, auth.Required))
+	route("GET /messages/{id}/list", noindex(c.ProtectFunc(c.listMessages, auth.Required)))
+	route("GET /messages/{id}/poll", noindex(c.ProtectFunc(c.pollMessages, auth.Required)))
+	route("POST /messages/{id}", c.ProtectFunc(auth.limited(messageLimit, c.sendMessage), auth.Required))
+	route("GET /api/messages/unread", c.ProtectFunc(auth.apiSession(c.apiUnreadCount), auth.Required))
 }
 
 func (c MessagesController) Handle(r *http.Request) application.Handler {
@@ -74,7 +76,10 @@ func (c *MessagesController) Messages() []*models.Message {
 		return nil
 	}
 
-	return profile.Messages(c.CurrentUser(), c.defaultPage, c.defaultLimit)
+	if cursor := ParseCursor(c.URL.Query()); cursor != nil {
+		return profile.MessagesBefore(c.CurrentUser(), cursor, c.Limit())
+	}
+	return profile.Messages(c.CurrentUser(), c.Page(), c.Limit())
 }
 
 func (c *MessagesController) Conversations() []*models.Profile {
@@ -123,6 +128,12 @@ func (c MessagesController) viewConversation(w http.ResponseWriter, r *http.Requ
 	c.Render(w, r, "conversation.html", nil)
 }
 
+// listMessages renders the page of older messages requested by infinite scroll
+func (c MessagesController) listMessages(w http.ResponseWriter, r *http.Request) {
+	c.Request = r
+	c.Render(w, r, "message-list.html", c.Messages())
+}
+
 // pollMessages returns new messages since the given timestamp
 func (c MessagesController) pollMessages(w http.ResponseWriter, r *http.Request) {
 	c.Request = r
@@ -162,44 +173,74 @@ func (c MessagesController) sendMessage(w http.ResponseWriter, r *http.Request)
 
 	user := c.CurrentUser()
 	if user == nil {
-		c.Render(w, r, "error-message.html", errors.New("authentication required"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("authentication required")))
 		return
 	}
 
 	profile, err := models.Profiles.Get(r.FormValue("id"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("user not found"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("user not found")))
 		return
 	}
 
 	content := r.FormValue("content")
-	if content == "" {
-		c.Render(w, r, "error-message.html", errors.New("message cannot be empty"))
+	if err = validateMessage(content); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
-	if len(content) > MaxContentLength {
-		c.Render(w, r, "error-message.html", errors.New("message too long"))
+
+	auth := c.Use("auth").(*AuthController)
+	if _, err = deliverMessage(user, profile, content, auth.getClientIP(r)); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
-	// Create the message
-	_, err = models.Messages.Insert(&models.Message{
-		SenderID:    user.ID,
-		RecipientID: profile.ID,
+	c.Refresh(w, r)
+}
+
+// validateMessage checks a message's content before it's sent
+func validateMessage(content string) error {
+	if content == "" {
+		return errors.New("message cannot be empty")
+	}
+	if len(content) > MaxContentLength {
+		return errors.New("message too long")
+	}
+	return nil
+}
+
+// deliverMessage sends a validated message from sender to recipient, then
+// refreshes the recipient's open tabs and notifies them by push and, for
+// their first message in an hour, by email. Messages to strangers are
+// throttled by sender and ip.
+func deliverMessage(sender, recipient *models.Profile, content, ip string) (*models.Message, error) {
+	// Cold messages are throttled to keep spam out of inboxes
+	if models.IsStranger(sender.ID, recipient.ID) {
+		if err := models.ThrottleStrangerDM.Allow(sender.ID, ip); err != nil {
+			return nil, err
+		}
+	}
+
+	message, err := models.Messages.Insert(&models.Message{
+		SenderID:    sender.ID,
+		RecipientID: recipient.ID,
 		Content:     content,
 	})
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
-		return
+		return nil, err
 	}
 
+	// Refresh the conversation in the recipient's open tabs
+	events.Publish(recipient.ID, events.Message, map[string]string{"from": sender.ID})
+
 	// Send push notification to recipient
 	go push.SendNotification(
-		profile.ID,
-		user.ID, // source = sender
-		"New message from @"+user.Handle(),
+		recipient.ID,
+		sender.ID, // source = sender
+		models.NotifyMessage,
+		"New message from @"+sender.Handle(),
 		truncateMessage(content, 100),
-		"/messages/"+user.ID,
+		"/messages/"+sender.ID,
 	)
 
 	// Check if we should send email notification
@@ -207,22 +248,23 @@ func (c MessagesController) sendMessage(w http.ResponseWriter, r *http.Request)
 	oneHourAgo := time.Now().Add(-1 * time.Hour)
 	recentMessages := models.Messages.Count(`
 		WHERE RecipientID = ? AND CreatedAt > ?
-	`, profile.ID, oneHourAgo)
+	`, recipient.ID, oneHourAgo)
 
 	// If this is the only message in the last hour (count = 1, the one we just sent), send email
-	if recentMessages == 1 {
-		userProfile, _ := models.Profiles.Get(user.ID)
-		go models.Emails.Send(profile.User().Email,
-			"New Message from "+user.Handle(),
-			emailing.WithTemplate("new-message.html"),
-			emailing.WithData("Title", "New Message"),
-			emailing.WithData("recipient", profile),
-			emailing.WithData("sender", userProfile),
+	if recentMessages == 1 && models.WantsEmail(recipient.UserID, models.NotifyMessage) {
+		locale := models.EmailLocale(recipient.UserID)
+		go models.SendEmail(recipient.User().Email,
+			i18n.T(locale, "New Message from %s", sender.Handle()),
+			"new-message.html",
+			emailing.WithData("t", i18n.For(locale)),
+			emailing.WithData("Title", i18n.T(locale, "New Message")),
+			emailing.WithData("recipient", recipient),
+			emailing.WithData("sender", sender),
 			emailing.WithData("year", time.Now().Year()),
 		)
 	}
 
-	c.Refresh(w, r)
+	return message, nil
 }
 
 func (c *MessagesController) Page() int {
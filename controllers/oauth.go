@@ -5,12 +5,11 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
-	"os"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/The-Skyscape/devtools/pkg/application"
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 	"www.theskyscape.com/internal/oauth"
 	"www.theskyscape.com/models"
@@ -50,6 +49,9 @@ func (p projectClient) IsProject() bool { return true }
 
 // getOAuthClient looks up an OAuth client by ID, checking both apps and projects
 func getOAuthClient(clientID string) (OAuthClient, error) {
+	if clientID == models.CLIClientID {
+		return cliClient{}, nil
+	}
 	// Try app first
 	if app, err := models.Apps.Get(clientID); err == nil {
 		return appClient{app}, nil
@@ -66,15 +68,28 @@ func (c *OAuthController) Setup(app *application.App) {
 	auth := c.Use("auth").(*AuthController)
 
 	// Authorization flow - use Controller.Required (auth only, no profile check)
-	http.Handle("GET /oauth/authorize", c.ProtectFunc(c.authorizeGet, auth.Required))
-	http.Handle("POST /oauth/authorize", c.ProtectFunc(c.authorize, auth.Required))
+	route("GET /oauth/authorize", c.ProtectFunc(c.authorizeGet, auth.Required))
+	route("POST /oauth/authorize", c.ProtectFunc(c.authorize, auth.Required))
 	// Token endpoint uses Basic Auth, no CSRF protection needed (server-to-server)
-	http.Handle("POST /oauth/token", http.HandlerFunc(c.token))
+	route("POST /oauth/token", tokenLimit.Wrap(http.HandlerFunc(c.token)))
+
+	// Device flow, for the CLI and other clients without a browser
+	route("POST /oauth/device/code", tokenLimit.Wrap(http.HandlerFunc(c.deviceCode)))
+	route("GET /oauth/device", noindex(c.Serve("oauth-device.html", auth.Required)))
+	route("POST /oauth/device", c.ProtectFunc(c.approveDevice, auth.Required))
+
+	// OpenID Connect, on top of the same flow
+	route("GET /.well-known/openid-configuration", http.HandlerFunc(c.openIDConfiguration))
+	route("GET /.well-known/jwks.json", http.HandlerFunc(c.jwks))
+	route("GET /oauth/userinfo", http.HandlerFunc(c.userinfo))
+	route("POST /oauth/userinfo", http.HandlerFunc(c.userinfo))
+	route("GET /admin/keys", c.Serve("admin-keys.html", auth.AdminRequired))
+	route("POST /admin/keys/rotate", c.ProtectFunc(c.rotateKeys, auth.AdminRequired))
 
 	// OAuth client management for apps
-	http.Handle("GET /app/{app}/users", c.Serve("app-users.html", auth.Required))
-	http.Handle("POST /app/{app}/oauth/regenerate", c.ProtectFunc(c.regenerateSecret, auth.Required))
-	http.Handle("DELETE /app/{app}/users/{user}", c.ProtectFunc(c.revokeUser, auth.Required))
+	route("GET /app/{app}/users", c.Serve("app-users.html", auth.Required))
+	route("POST /app/{app}/oauth/regenerate", c.ProtectFunc(c.regenerateSecret, auth.Required))
+	route("DELETE /app/{app}/users/{user}", c.ProtectFunc(c.revokeUser, auth.Required))
 }
 
 func (c OAuthController) Handle(r *http.Request) application.Handler {
@@ -151,12 +166,81 @@ func (c *OAuthController) ScopesMatch() bool {
 	return existing.Scopes == scope
 }
 
+// ClientOwner returns the profile of the developer behind the client
+func (c *OAuthController) ClientOwner() *models.Profile {
+	if project := c.CurrentProject(); project != nil {
+		return project.Owner()
+	}
+	if app := c.CurrentApp(); app != nil {
+		if owner := app.Owner(); owner != nil {
+			profile, _ := models.Profiles.First("WHERE UserID = ?", owner.ID)
+			return profile
+		}
+	}
+	return nil
+}
+
+// ClientUsers returns how many people have authorized the client
+func (c *OAuthController) ClientUsers() int {
+	clientID := c.URL.Query().Get("client_id")
+	if clientID == "" {
+		return 0
+	}
+	return models.OAuthAuthorizations.Count("WHERE (AppID = ? OR ProjectID = ?) AND Revoked = false", clientID, clientID)
+}
+
+// ClientVerification returns how much the consent screen can vouch for the
+// client, one of the models.Client* levels
+func (c *OAuthController) ClientVerification() string {
+	var createdAt time.Time
+	if project := c.CurrentProject(); project != nil {
+		createdAt = project.CreatedAt
+	} else if app := c.CurrentApp(); app != nil {
+		createdAt = app.CreatedAt
+	}
+	return models.ClientVerification(c.ClientOwner(), createdAt, c.ClientUsers())
+}
+
+// NewScopes returns the requested scopes the user hasn't granted the client
+// before, so the consent screen can warn about a request for more access.
+// It's empty the first time a user authorizes a client.
+func (c *OAuthController) NewScopes() []string {
+	auth := c.Use("auth").(*AuthController)
+	user := auth.CurrentUser()
+	clientID := c.URL.Query().Get("client_id")
+	if user == nil || clientID == "" {
+		return nil
+	}
+
+	existing, err := models.OAuthAuthorizations.First(
+		"WHERE UserID = ? AND (AppID = ? OR ProjectID = ?) AND Revoked = false",
+		user.ID, clientID, clientID,
+	)
+	if err != nil {
+		return nil
+	}
+
+	granted := existing.ScopeList()
+	var scopes []string
+	for _, scope := range c.RequestedScopes() {
+		if !slices.Contains(granted, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// ScopeDescription explains what an OAuth scope allows
+func (c *OAuthController) ScopeDescription(scope string) string {
+	return models.ScopeDescription(scope)
+}
+
 // authorizeGet handles the authorization consent screen (or auto-redirects if already authorized)
 func (c *OAuthController) authorizeGet(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -203,7 +287,7 @@ func (c *OAuthController) authorizeGet(w http.ResponseWriter, r *http.Request) {
 	// If already authorized with same scopes, skip consent screen
 	if err == nil && existing != nil && existing.Scopes == scope {
 		// Generate authorization code
-		code, err := oauth.CreateAuthorizationCode(clientID, user.ID, redirectURI, scope)
+		code, err := oauth.CreateAuthorizationCode(clientID, user.ID, redirectURI, scope, r.URL.Query().Get("nonce"))
 		if err != nil {
 			http.Error(w, "Failed to generate authorization code", http.StatusInternalServerError)
 			return
@@ -224,7 +308,7 @@ func (c *OAuthController) authorize(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -293,7 +377,7 @@ func (c *OAuthController) authorize(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Generate authorization code
-	code, err := oauth.CreateAuthorizationCode(clientID, user.ID, redirectURI, scope)
+	code, err := oauth.CreateAuthorizationCode(clientID, user.ID, redirectURI, scope, r.URL.Query().Get("nonce"))
 	if err != nil {
 		http.Error(w, "Failed to generate authorization code", http.StatusInternalServerError)
 		return
@@ -319,6 +403,7 @@ type TokenResponse struct {
 	TokenType   string `json:"token_type"`
 	ExpiresIn   int    `json:"expires_in"`
 	Scope       string `json:"scope"`
+	IDToken     string `json:"id_token,omitempty"` // When the openid scope was granted
 }
 
 // token handles the token exchange endpoint
@@ -329,9 +414,19 @@ func (c *OAuthController) token(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Extract client credentials from Basic Auth
+	// Device clients authenticate with the device code, not a secret
+	if r.PostFormValue("grant_type") == oauth.DeviceGrantType {
+		c.deviceToken(w, r)
+		return
+	}
+
+	// Extract client credentials from Basic Auth, or the form for clients
+	// using client_secret_post
 	clientID, clientSecret, ok := r.BasicAuth()
 	if !ok {
+		clientID, clientSecret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if clientID == "" || clientSecret == "" {
 		JSONError(w, http.StatusUnauthorized, "Client authentication required")
 		return
 	}
@@ -364,15 +459,17 @@ func (c *OAuthController) token(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Sync database to ensure we have latest state from primary
-	models.DB.Sync()
-
-	// Find authorization code
+	// Find authorization code. It was written moments ago, so the replica
+	// may not have it until it syncs.
 	hashedCode := oauth.HashToken(req.Code)
-	authCode, err := models.OAuthAuthorizationCodes.First(
-		"WHERE ClientID = ? AND Code = ?",
-		req.ClientID, hashedCode,
-	)
+	var authCode *models.OAuthAuthorizationCode
+	err = models.ReadAfterWrite(func() (err error) {
+		authCode, err = models.OAuthAuthorizationCodes.First(
+			"WHERE ClientID = ? AND Code = ?",
+			req.ClientID, hashedCode,
+		)
+		return err
+	})
 	if err != nil || authCode == nil {
 		JSONError(w, http.StatusBadRequest, "Authorization code not found")
 		return
@@ -390,14 +487,14 @@ func (c *OAuthController) token(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Mark code as used
+	// Mark code as used, which fails if another request redeemed it first
 	if err := authCode.MarkAsUsed(); err != nil {
-		JSONError(w, http.StatusInternalServerError, "Failed to process authorization code")
+		JSONError(w, http.StatusBadRequest, "Authorization code expired or already used")
 		return
 	}
 
 	// Generate JWT access token
-	accessToken, err := c.generateAccessToken(authCode.UserID, authCode.ClientID, authCode.Scopes)
+	accessToken, err := oauth.IssueAccessToken(oidcIssuer(), authCode.UserID, authCode.ClientID, authCode.Scopes)
 	if err != nil {
 		JSONError(w, http.StatusInternalServerError, "Failed to generate access token")
 		return
@@ -407,31 +504,24 @@ func (c *OAuthController) token(w http.ResponseWriter, r *http.Request) {
 	response := &TokenResponse{
 		AccessToken: accessToken,
 		TokenType:   "Bearer",
-		ExpiresIn:   30 * 24 * 60 * 60, // 30 days in seconds
+		ExpiresIn:   int(oauth.AccessTokenExpiry.Seconds()),
 		Scope:       authCode.Scopes,
 	}
 
-	JSONSuccess(w, response)
-}
-
-// generateAccessToken creates a signed JWT access token
-func (c *OAuthController) generateAccessToken(userID, clientID, scopes string) (string, error) {
-	secret := os.Getenv("AUTH_SECRET")
-	if secret == "" {
-		return "", errors.New("AUTH_SECRET not configured")
-	}
-
-	now := time.Now()
-	claims := jwt.MapClaims{
-		"sub":       userID,
-		"client_id": clientID,
-		"scope":     scopes,
-		"iat":       now.Unix(),
-		"exp":       now.Add(30 * 24 * time.Hour).Unix(), // 30 days
+	// Sign the user in to OpenID Connect clients
+	if scopes := strings.Fields(authCode.Scopes); slices.Contains(scopes, oauth.ScopeOpenID) {
+		user, err := models.Auth.Users.Get(authCode.UserID)
+		if err != nil {
+			JSONError(w, http.StatusBadRequest, "User not found")
+			return
+		}
+		if response.IDToken, err = oauth.IssueIDToken(oidcIssuer(), authCode.ClientID, user, scopes, authCode.Nonce); err != nil {
+			JSONError(w, http.StatusInternalServerError, "Failed to generate ID token")
+			return
+		}
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	JSONSuccess(w, response)
 }
 
 // regenerateSecret regenerates the OAuth client secret
@@ -439,41 +529,42 @@ func (c *OAuthController) regenerateSecret(w http.ResponseWriter, r *http.Reques
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	app, err := models.Apps.Get(r.PathValue("app"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("app not found"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("app not found")))
 		return
 	}
 
 	repo := app.Repo()
 	if repo == nil || repo.OwnerID != user.ID {
-		c.Render(w, r, "error-message.html", errors.New("permission denied"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("permission denied")))
 		return
 	}
 
 	// Generate new secret
 	secret, err := oauth.GenerateToken(32)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	// Hash and update app
 	hashedSecret, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	app.OAuthClientSecret = string(hashedSecret)
 	if err := models.Apps.Update(app); err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
+	auth.audit(r, user.ID, models.AuditOAuthSecretRegenerated, "app", app.ID, "")
 
 	c.Refresh(w, r)
 }
@@ -483,19 +574,19 @@ func (c *OAuthController) revokeUser(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	app, err := models.Apps.Get(r.PathValue("app"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("app not found"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("app not found")))
 		return
 	}
 
 	repo := app.Repo()
 	if repo == nil || repo.OwnerID != user.ID {
-		c.Render(w, r, "error-message.html", errors.New("permission denied"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("permission denied")))
 		return
 	}
 
@@ -508,12 +599,12 @@ func (c *OAuthController) revokeUser(w http.ResponseWriter, r *http.Request) {
 	)
 
 	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("authorization not found"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("authorization not found")))
 		return
 	}
 
 	if err := authorization.Revoke(); err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"www.theskyscape.com/internal/oauth"
+	"www.theskyscape.com/models"
+)
+
+// cliClient is the built in OAuth client for the skyscape CLI. It has no
+// redirect URI or secret, so only the device flow accepts it.
+type cliClient struct{}
+
+func (cliClient) GetID() string            { return models.CLIClientID }
+func (cliClient) GetName() string          { return "Skyscape CLI" }
+func (cliClient) RedirectURI() string      { return "" }
+func (cliClient) AllowedScopes() string    { return "user:read project:deploy" }
+func (cliClient) VerifySecret(string) bool { return false }
+func (cliClient) IsProject() bool          { return false }
+
+type DeviceCodeResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// deviceCode starts the device flow, for clients that can't open a
+// browser or keep a secret. Only the client ID is needed.
+func (c *OAuthController) deviceCode(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		JSONError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	client, err := getOAuthClient(r.PostFormValue("client_id"))
+	if err != nil {
+		JSONError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	scope := strings.Join(strings.Fields(r.PostFormValue("scope")), " ")
+	if scope == "" {
+		scope = client.AllowedScopes()
+	}
+
+	deviceCode, userCode, err := oauth.CreateDeviceCode(client.GetID(), scope)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	verificationURI := oidcIssuer() + "/oauth/device"
+	JSON(w, http.StatusOK, &DeviceCodeResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(userCode),
+		ExpiresIn:               int(oauth.DeviceCodeExpiry.Seconds()),
+		Interval:                int(oauth.DevicePollInterval.Seconds()),
+	})
+}
+
+// DeviceAuthorization returns the pending device authorization for the
+// user code in the URL, for the verification page
+func (c *OAuthController) DeviceAuthorization() *models.OAuthDeviceCode {
+	code := c.URL.Query().Get("user_code")
+	if code == "" {
+		return nil
+	}
+	device, _ := oauth.FindUserCode(code)
+	return device
+}
+
+// DeviceClient returns the client asking for device authorization
+func (c *OAuthController) DeviceClient() OAuthClient {
+	device := c.DeviceAuthorization()
+	if device == nil {
+		return nil
+	}
+	client, _ := getOAuthClient(device.ClientID)
+	return client
+}
+
+// DeviceScopes returns the scopes the device is asking for
+func (c *OAuthController) DeviceScopes() []string {
+	if device := c.DeviceAuthorization(); device != nil {
+		return strings.Fields(device.Scopes)
+	}
+	return nil
+}
+
+// approveDevice approves or denies a device authorization from the
+// verification page
+func (c *OAuthController) approveDevice(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	// An expired code sends the user back to the form, which explains it
+	code := r.FormValue("user_code")
+	device, err := oauth.FindUserCode(code)
+	if err != nil {
+		c.Redirect(w, r, "/oauth/device?user_code="+url.QueryEscape(code))
+		return
+	}
+	client, err := getOAuthClient(device.ClientID)
+	if err != nil {
+		http.Error(w, "Invalid client_id", http.StatusBadRequest)
+		return
+	}
+
+	device.UserID = user.ID
+	device.Status = models.DeviceDenied
+	if r.FormValue("action") == "approve" {
+		if _, _, err = oauth.CreateOrUpdateAuthorizationForClient(user.ID, device.ClientID, device.Scopes, client.IsProject()); err != nil {
+			http.Error(w, "Failed to create authorization", http.StatusInternalServerError)
+			return
+		}
+		device.Status = models.DeviceApproved
+		auth.audit(r, user.ID, models.AuditDeviceAuthorized, "user", user.ID, device.ClientID)
+	}
+	if err = models.OAuthDeviceCodes.Update(device); err != nil {
+		http.Error(w, "Failed to save authorization", http.StatusInternalServerError)
+		return
+	}
+
+	c.Redirect(w, r, "/oauth/device?result="+device.Status)
+}
+
+// deviceToken exchanges an approved device code for an access token. The
+// client polls until the user has decided, and errors follow RFC 8628 so
+// OAuth libraries know whether to keep polling.
+func (c *OAuthController) deviceToken(w http.ResponseWriter, r *http.Request) {
+	clientID := r.PostFormValue("client_id")
+	if user, _, ok := r.BasicAuth(); ok {
+		clientID = user
+	}
+
+	device, err := models.OAuthDeviceCodes.First(
+		"WHERE ClientID = ? AND DeviceCode = ?",
+		clientID, oauth.HashToken(r.PostFormValue("device_code")),
+	)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	if device.IsExpired() {
+		JSONError(w, http.StatusBadRequest, "expired_token")
+		return
+	}
+
+	polledAt := device.PolledAt
+	device.MarkPolled()
+
+	switch device.Status {
+	case models.DevicePending:
+		if time.Since(polledAt) < oauth.DevicePollInterval {
+			JSONError(w, http.StatusBadRequest, "slow_down")
+			return
+		}
+		JSONError(w, http.StatusBadRequest, "authorization_pending")
+		return
+	case models.DeviceDenied:
+		JSONError(w, http.StatusBadRequest, "access_denied")
+		return
+	case models.DeviceRedeemed:
+		JSONError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	if err := device.Redeem(); err != nil {
+		JSONError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	accessToken, err := oauth.IssueAccessToken(oidcIssuer(), device.UserID, device.ClientID, device.Scopes)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	JSONSuccess(w, &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(oauth.AccessTokenExpiry.Seconds()),
+		Scope:       device.Scopes,
+	})
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+
+	"www.theskyscape.com/internal/oauth"
+	"www.theskyscape.com/internal/security"
+	"www.theskyscape.com/models"
+)
+
+// oidcIssuer is the OpenID Connect issuer, the base URL every discovery
+// URL and ID token is relative to
+func oidcIssuer() string {
+	if prefix := os.Getenv("PREFIX"); prefix != "" {
+		return "https://" + prefix + ".theskyscape.com"
+	}
+	return "https://www.theskyscape.com"
+}
+
+// openIDConfiguration serves the discovery document OpenID Connect
+// libraries configure themselves from
+func (c *OAuthController) openIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	issuer := oidcIssuer()
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	JSON(w, http.StatusOK, map[string]any{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/oauth/authorize",
+		"token_endpoint":                        issuer + "/oauth/token",
+		"userinfo_endpoint":                     issuer + "/oauth/userinfo",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"device_authorization_endpoint":         issuer + "/oauth/device/code",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", oauth.DeviceGrantType},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": oauth.Algorithms(),
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+		"scopes_supported":                      []string{oauth.ScopeOpenID, oauth.ScopeProfile, oauth.ScopeEmail, "user:read", "repo:read", "repo:write", "app:read", "app:write", "follow:read", "post:read", "post:write", "thought:write", "message:write", "project:deploy"},
+		"claims_supported": []string{
+			"iss", "sub", "aud", "exp", "iat", "nonce",
+			"name", "preferred_username", "picture", "profile", "updated_at", "email", "email_verified",
+		},
+	})
+}
+
+// jwks serves the public keys access and ID tokens are signed with
+func (c *OAuthController) jwks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	JSON(w, http.StatusOK, map[string]any{"keys": oauth.JWKS()})
+}
+
+// userinfo returns claims about the user an access token was issued for,
+// limited to the scopes they granted
+func (c *OAuthController) userinfo(w http.ResponseWriter, r *http.Request) {
+	user, scopes, err := security.ParseAccessToken(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		JSONError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if !slices.Contains(scopes, oauth.ScopeOpenID) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+		JSONError(w, http.StatusForbidden, "insufficient scope: openid")
+		return
+	}
+	JSON(w, http.StatusOK, oauth.UserClaims(user, scopes, oidcIssuer()))
+}
+
+// SigningKeys returns recent signing keys, for /admin/keys
+func (c *OAuthController) SigningKeys() []*oauth.KeyStatus {
+	return oauth.SigningKeys()
+}
+
+// rotateKeys starts signing with a new key, revoking the old ones too if
+// one may have leaked
+func (c *OAuthController) rotateKeys(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	admin, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	revoke := r.FormValue("revoke") == "true"
+	key, err := oauth.RotateSigningKey(revoke)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	detail := "rotated"
+	if revoke {
+		detail = "revoked"
+	}
+	slog.InfoContext(r.Context(), "admin rotated signing key", "admin", admin.Handle, "kid", key.ID, "revoke", revoke)
+	auth.audit(r, admin.ID, models.AuditSigningKeyRotated, "signing_key", key.ID, detail)
+	c.Refresh(w, r)
+}
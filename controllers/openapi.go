@@ -0,0 +1,204 @@
+package controllers
+
+import (
+	"net/http"
+
+	"www.theskyscape.com/internal/openapi"
+	"www.theskyscape.com/models"
+)
+
+// apiOperations documents every /api route. Add an entry when adding a
+// route; the schemas come from the same structs the handlers use.
+var apiOperations = []openapi.Operation{{
+	Method: "GET", Path: "/api/user", Tag: "Users",
+	Summary:  "Get the signed in user",
+	Security: []string{openapi.OAuth}, Scopes: []string{"user:read"},
+	Response: UserResponse{},
+}, {
+	Method: "GET", Path: "/api/profile", Tag: "Users",
+	Summary:  "Get the signed in user's profile",
+	Security: []string{openapi.OAuth}, Scopes: []string{"user:read"},
+	Response: ProfileResponse{},
+}, {
+	Method: "GET", Path: "/api/repos", Tag: "Repos",
+	Summary:  "List the user's repos, newest first",
+	Security: []string{openapi.OAuth}, Scopes: []string{"repo:read"},
+	Paged:    true,
+	Response: []RepoResponse{},
+}, {
+	Method: "GET", Path: "/api/repos/{id}", Tag: "Repos",
+	Summary:  "Get one of the user's repos",
+	Security: []string{openapi.OAuth}, Scopes: []string{"repo:read"},
+	Response: RepoResponse{},
+}, {
+	Method: "POST", Path: "/api/repos", Tag: "Repos",
+	Summary:  "Create a repo",
+	Security: []string{openapi.OAuth}, Scopes: []string{"repo:write"},
+	Request:  CreateRepoRequest{},
+	Status:   http.StatusCreated,
+	Response: RepoResponse{},
+}, {
+	Method: "GET", Path: "/api/apps", Tag: "Apps",
+	Summary:  "List the user's apps, newest first",
+	Security: []string{openapi.OAuth}, Scopes: []string{"app:read"},
+	Paged:    true,
+	Response: []AppResponse{},
+}, {
+	Method: "GET", Path: "/api/apps/{id}", Tag: "Apps",
+	Summary:  "Get one of the user's apps",
+	Security: []string{openapi.OAuth}, Scopes: []string{"app:read"},
+	Response: AppResponse{},
+}, {
+	Method: "POST", Path: "/api/apps/{id}/builds", Tag: "Apps",
+	Summary:     "Rebuild and redeploy an app",
+	Description: "Responds 409 while the app is already building.",
+	Security:    []string{openapi.OAuth}, Scopes: []string{"app:write"},
+	Status:   http.StatusAccepted,
+	Response: AppResponse{},
+}, {
+	Method: "GET", Path: "/api/feed", Tag: "Posts",
+	Summary:     "List the user's home feed, newest first",
+	Description: "The activity of the user and the people and topics they follow, as their signed in feed shows it. Pages hold 20 activities unless limit is set.",
+	Security:    []string{openapi.OAuth}, Scopes: []string{"post:read"},
+	Paged:    true,
+	Response: []ActivityResponse{},
+}, {
+	Method: "GET", Path: "/api/activities/{id}", Tag: "Posts",
+	Summary:  "Get a post or other activity the user can see",
+	Security: []string{openapi.OAuth}, Scopes: []string{"post:read"},
+	Response: ActivityResponse{},
+}, {
+	Method: "POST", Path: "/api/posts", Tag: "Posts",
+	Summary:  "Post to the feed",
+	Security: []string{openapi.OAuth}, Scopes: []string{"post:write"},
+	Request:  CreatePostRequest{},
+	Status:   http.StatusCreated,
+	Response: PostResponse{},
+}, {
+	Method: "GET", Path: "/api/thoughts", Tag: "Thoughts",
+	Summary:  "List the user's thoughts, drafts included, newest first",
+	Security: []string{openapi.OAuth}, Scopes: []string{"thought:write"},
+	Paged:    true,
+	Response: []ThoughtResponse{},
+}, {
+	Method: "GET", Path: "/api/thoughts/{id}", Tag: "Thoughts",
+	Summary:  "Get one of the user's thoughts with its blocks",
+	Security: []string{openapi.OAuth}, Scopes: []string{"thought:write"},
+	Response: ThoughtResponse{},
+}, {
+	Method: "POST", Path: "/api/thoughts", Tag: "Thoughts",
+	Summary:     "Create a draft thought",
+	Description: "Blocks are Markdown. Image and file blocks need an upload, so they can only be added on the web.",
+	Security:    []string{openapi.OAuth}, Scopes: []string{"thought:write"},
+	Request:  CreateThoughtRequest{},
+	Status:   http.StatusCreated,
+	Response: ThoughtResponse{},
+}, {
+	Method: "PUT", Path: "/api/thoughts/{id}/blocks", Tag: "Thoughts",
+	Summary: "Replace a thought's blocks",
+	Description: "Send every block in order. Blocks with an id are kept and updated, blocks without one are added, " +
+		"and blocks left out are deleted. Responds 409 if a block's version is stale.",
+	Security: []string{openapi.OAuth}, Scopes: []string{"thought:write"},
+	Request:  UpdateThoughtBlocksRequest{},
+	Response: ThoughtResponse{},
+}, {
+	Method: "POST", Path: "/api/thoughts/{id}/publish", Tag: "Thoughts",
+	Summary:  "Publish a thought",
+	Security: []string{openapi.OAuth}, Scopes: []string{"thought:write"},
+	Response: ThoughtResponse{},
+}, {
+	Method: "GET", Path: "/api/messages", Tag: "Messages",
+	Summary:  "List the user's conversations, most recent first",
+	Security: []string{openapi.OAuth}, Scopes: []string{"message:write"},
+	Response: []ConversationResponse{},
+}, {
+	Method: "GET", Path: "/api/messages/{user}", Tag: "Messages",
+	Summary:     "List the user's messages with someone, newest first",
+	Description: "Messages from them are marked as read, as when opening the conversation on the web.",
+	Security:    []string{openapi.OAuth}, Scopes: []string{"message:write"},
+	Paged:    true,
+	Response: []MessageResponse{},
+}, {
+	Method: "POST", Path: "/api/messages/{user}", Tag: "Messages",
+	Summary:     "Send a message",
+	Description: "The recipient is notified as if it was sent on the web. Messages to people who don't follow the user are throttled, with a 429.",
+	Security:    []string{openapi.OAuth}, Scopes: []string{"message:write"},
+	Request:  SendMessageRequest{},
+	Status:   http.StatusCreated,
+	Response: MessageResponse{},
+}, {
+	Method: "GET", Path: "/api/followers", Tag: "Follows",
+	Summary:  "List the user's followers, newest first",
+	Security: []string{openapi.OAuth}, Scopes: []string{"follow:read"},
+	Paged:    true,
+	Response: []FollowResponse{},
+}, {
+	Method: "GET", Path: "/api/following", Tag: "Follows",
+	Summary:  "List who the user follows, newest first",
+	Security: []string{openapi.OAuth}, Scopes: []string{"follow:read"},
+	Paged:    true,
+	Response: []FollowResponse{},
+}, {
+	Method: "POST", Path: "/api/projects/{id}/deploys", Tag: "Deploys",
+	Summary: "Build and deploy a project",
+	Description: "Builds the ref in a JSON or form body, or a gzipped tarball of the source sent as the body with " +
+		"Content-Type: application/gzip (max 100MB). Limited to 30 deploys an hour.",
+	Security: []string{openapi.DeployToken, openapi.OAuth}, Scopes: []string{"project:deploy"},
+	Request:  DeployRequest{},
+	Status:   http.StatusAccepted,
+	Response: DeployResponse{},
+}, {
+	Method: "GET", Path: "/api/projects/{id}/builds", Tag: "Deploys",
+	Summary:  "List a project's builds, newest first",
+	Security: []string{openapi.DeployToken, openapi.OAuth}, Scopes: []string{"project:deploy"},
+	Paged:    true,
+	Response: []DeployResponse{},
+}, {
+	Method: "GET", Path: "/api/projects/{id}/builds/{build}", Tag: "Deploys",
+	Summary:     "Get a build's status",
+	Description: "Poll until the status leaves \"building\". Send the ETag back in If-None-Match to get a 304 while nothing changed.",
+	Security:    []string{openapi.DeployToken, openapi.OAuth}, Scopes: []string{"project:deploy"},
+	Response: DeployResponse{},
+}, {
+	Method: "GET", Path: "/api/projects/{id}/builds/{build}/events", Tag: "Deploys",
+	Summary: "Stream a build's status",
+	Description: "A text/event-stream of \"build\" events, each carrying the build as JSON: one when the stream opens " +
+		"and one per status change. The stream closes once the build is ready or failed.",
+	Security: []string{openapi.DeployToken, openapi.OAuth}, Scopes: []string{"project:deploy"},
+	Response: DeployResponse{},
+}, {
+	Method: "GET", Path: "/api/service/users", Tag: "Service",
+	Summary:  "List the users who authorized the project",
+	Security: []string{openapi.ServiceToken},
+	Response: []ServiceUserResponse{},
+}, {
+	Method: "POST", Path: "/api/service/notifications", Tag: "Service",
+	Summary: "Notify a user who authorized the app or project",
+	Description: "Limited to 100 notifications an hour per client and 10 a day per user. Users can mute a client " +
+		"or turn app notifications off.",
+	Security: []string{openapi.ServiceToken, openapi.ClientSecret},
+	Request:  NotificationRequest{},
+	Status:   http.StatusAccepted,
+	Response: map[string]string{},
+}}
+
+// APIOperations returns the documented API routes, for /api/docs
+func (c *APIController) APIOperations() []openapi.Operation {
+	return apiOperations
+}
+
+// openAPI serves the OpenAPI document for the API
+func (c *APIController) openAPI(w http.ResponseWriter, r *http.Request) {
+	issuer := oidcIssuer()
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	JSON(w, http.StatusOK, openapi.Document(openapi.Info{
+		Title:       "The Skyscape API",
+		Description: "Act for users who sign in to your app with OAuth, deploy projects, and reach your project's users from its backend.",
+		Version:     "1.0",
+		Server:      issuer,
+		AuthURL:     issuer + "/oauth/authorize",
+		TokenURL:    issuer + "/oauth/token",
+		Scopes:      models.ScopeDescriptions,
+	}, apiOperations))
+}
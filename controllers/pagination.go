@@ -1,8 +1,12 @@
 package controllers
 
 import (
+	"net/http"
 	"net/url"
 	"strconv"
+	"time"
+
+	"www.theskyscape.com/models"
 )
 
 const (
@@ -35,3 +39,50 @@ func ParseLimit(query url.Values, defaultLimit int) int {
 	}
 	return min(limit, MaxPageLimit)
 }
+
+// ParseCursor extracts the opaque ?cursor= token from URL query params.
+// Returns nil if not present or invalid, in which case callers fall back
+// to the deprecated ?page= offset pagination.
+func ParseCursor(query url.Values) *models.Cursor {
+	token := query.Get("cursor")
+	if token == "" {
+		return nil
+	}
+	cursor, err := models.ParseCursor(token)
+	if err != nil {
+		return nil
+	}
+	return cursor
+}
+
+// ParseAPIPage extracts ?cursor= and ?limit= for JSON list endpoints and
+// returns the cursor condition (see models.Cursor.Before) and limit to query
+// with. Lists stay unbounded (limit -1) unless the client opts in with either
+// param, so existing integrations keep receiving complete results.
+func ParseAPIPage(r *http.Request, prefix string) (string, []any, int) {
+	query := r.URL.Query()
+	cursor := ParseCursor(query)
+	before, args := cursor.Before(prefix)
+	if cursor == nil && query.Get("limit") == "" {
+		return before, args, -1
+	}
+	return before, args, ParseLimit(query, MaxPageLimit)
+}
+
+// SetNextCursor advertises the next page of a JSON list through the
+// X-Next-Cursor and Link headers when a full page was returned
+func SetNextCursor(w http.ResponseWriter, r *http.Request, returned, limit int, createdAt time.Time, id string) {
+	if limit < 0 || returned < limit {
+		return
+	}
+
+	cursor := models.EncodeCursor(createdAt, id)
+	next := *r.URL
+	query := next.Query()
+	query.Set("cursor", cursor)
+	query.Set("limit", strconv.Itoa(limit))
+	next.RawQuery = query.Encode()
+
+	w.Header().Set("X-Next-Cursor", cursor)
+	w.Header().Set("Link", "<"+next.RequestURI()+`>; rel="next"`)
+}
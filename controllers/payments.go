@@ -4,13 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strconv"
 	"time"
 
 	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/The-Skyscape/devtools/pkg/authentication"
 	"www.theskyscape.com/internal/payments"
 	"www.theskyscape.com/models"
 )
@@ -30,26 +31,27 @@ func (c *PaymentsController) Setup(app *application.App) {
 
 	// Initialize Stripe products idempotently
 	if err := c.stripe.InitProducts(); err != nil {
-		log.Printf("Warning: Failed to initialize Stripe products: %v", err)
+		slog.Warn("failed to initialize Stripe products", "error", err)
 	}
 
 	auth := c.Use("auth").(*AuthController)
 
 	// Checkout session creation
-	http.Handle("POST /checkout/verified", c.ProtectFunc(c.checkoutVerified, auth.Required))
-	http.Handle("POST /checkout/promotion/{app}", c.ProtectFunc(c.checkoutPromotion, auth.Required))
-	http.Handle("POST /checkout/upgrade/{app}", c.ProtectFunc(c.checkoutUpgrade, auth.Required))
+	route("POST /checkout/verified", c.ProtectFunc(c.checkoutVerified, auth.Required))
+	route("POST /checkout/promotion/{app}", c.ProtectFunc(c.checkoutPromotion, auth.Required))
+	route("POST /checkout/extend/{promotion}", c.ProtectFunc(c.checkoutExtension, auth.Required))
+	route("POST /checkout/upgrade/{app}", c.ProtectFunc(c.checkoutUpgrade, auth.Required))
 
 	// Stripe webhook (no CSRF protection needed - Stripe signs requests)
-	http.Handle("POST /webhooks/stripe", http.HandlerFunc(c.handleWebhook))
+	route("POST /webhooks/stripe", http.HandlerFunc(c.handleWebhook))
 
 	// Success/Cancel pages
-	http.Handle("GET /checkout/success", app.Serve("checkout-success.html", auth.Required))
-	http.Handle("GET /checkout/cancel", app.Serve("checkout-cancel.html", auth.Optional))
+	route("GET /checkout/success", noindex(app.Serve("checkout-success.html", auth.Required)))
+	route("GET /checkout/cancel", noindex(app.Serve("checkout-cancel.html", auth.Optional)))
 
 	// Billing management
-	http.Handle("GET /billing", app.Serve("billing.html", auth.Required))
-	http.Handle("POST /billing/portal", c.ProtectFunc(c.billingPortal, auth.Required))
+	route("GET /billing", noindex(app.Serve("billing.html", auth.Required)))
+	route("POST /billing/portal", c.ProtectFunc(c.billingPortal, auth.Required))
 }
 
 func (c PaymentsController) Handle(r *http.Request) application.Handler {
@@ -101,6 +103,18 @@ func (c *PaymentsController) UserPayments() []*models.Payment {
 	return models.UserPayments(user.ID, 50)
 }
 
+// MonthlyUsage returns the current user's transfer per app and project
+// since the start of the month, the period usage is billed over
+func (c *PaymentsController) MonthlyUsage() []*models.SiteUsage {
+	auth := c.Use("auth").(*AuthController)
+	user, _, _ := auth.Authenticate(c.Request)
+	if user == nil {
+		return nil
+	}
+	now := time.Now().UTC()
+	return models.UsageSince(user.ID, time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC))
+}
+
 // HasVerifiedSubscription returns true if current user has active verified subscription
 func (c *PaymentsController) HasVerifiedSubscription() bool {
 	auth := c.Use("auth").(*AuthController)
@@ -111,6 +125,21 @@ func (c *PaymentsController) HasVerifiedSubscription() bool {
 	return models.GetUserVerifiedSubscription(user.ID) != nil
 }
 
+// AccountCredit returns the current user's account credit formatted as
+// currency, or "" if they have none
+func (c *PaymentsController) AccountCredit() string {
+	auth := c.Use("auth").(*AuthController)
+	user, _, _ := auth.Authenticate(c.Request)
+	if user == nil {
+		return ""
+	}
+	profile, err := models.Profiles.First("WHERE UserID = ?", user.ID)
+	if err != nil || profile.Credit <= 0 {
+		return ""
+	}
+	return profile.FormatCredit()
+}
+
 // Checkout handlers
 
 func (c *PaymentsController) checkoutVerified(w http.ResponseWriter, r *http.Request) {
@@ -120,24 +149,24 @@ func (c *PaymentsController) checkoutVerified(w http.ResponseWriter, r *http.Req
 	// Get profile
 	profile, err := models.Profiles.First("WHERE UserID = ?", user.ID)
 	if err != nil {
-		c.RenderError(w, r, errors.New("profile not found"))
+		c.RenderError(w, r, localize(r, errors.New("profile not found")))
 		return
 	}
 
 	// Check if already verified
 	if profile.Verified {
-		c.RenderError(w, r, errors.New("you are already verified"))
+		c.RenderError(w, r, localize(r, errors.New("you are already verified")))
 		return
 	}
 
 	// Create or get Stripe customer
 	customerID := profile.StripeCustomerID
 	if customerID == "" {
-		customer, err := c.stripe.CreateCustomer(user.Email, user.Name, map[string]string{
+		customer, err := c.stripe.WithContext(r.Context()).CreateCustomer(user.Email, user.Name, map[string]string{
 			"user_id": user.ID,
 		})
 		if err != nil {
-			c.RenderError(w, r, fmt.Errorf("failed to create customer: %w", err))
+			c.RenderError(w, r, localize(r, fmt.Errorf("failed to create customer: %w", err)))
 			return
 		}
 		customerID = customer.ID
@@ -151,12 +180,12 @@ func (c *PaymentsController) checkoutVerified(w http.ResponseWriter, r *http.Req
 	}
 
 	// Create checkout session using pre-initialized price
-	catalog, err := c.stripe.GetCatalog()
+	catalog, err := c.stripe.WithContext(r.Context()).GetCatalog()
 	if err != nil {
-		c.RenderError(w, r, fmt.Errorf("payment system not configured: %w", err))
+		c.RenderError(w, r, localize(r, fmt.Errorf("payment system not configured: %w", err)))
 		return
 	}
-	session, err := c.stripe.CreateCheckoutSession(payments.CheckoutOptions{
+	session, err := c.stripe.WithContext(r.Context()).CreateCheckoutSession(payments.CheckoutOptions{
 		Mode:       payments.ModeSubscription,
 		CustomerID: customerID,
 		SuccessURL: baseURL + "/checkout/success?session_id={CHECKOUT_SESSION_ID}",
@@ -171,7 +200,7 @@ func (c *PaymentsController) checkoutVerified(w http.ResponseWriter, r *http.Req
 		},
 	})
 	if err != nil {
-		c.RenderError(w, r, fmt.Errorf("failed to create checkout: %w", err))
+		c.RenderError(w, r, localize(r, fmt.Errorf("failed to create checkout: %w", err)))
 		return
 	}
 
@@ -196,20 +225,20 @@ func (c *PaymentsController) checkoutPromotion(w http.ResponseWriter, r *http.Re
 	appID := r.PathValue("app")
 	app, err := models.Apps.Get(appID)
 	if err != nil {
-		c.RenderError(w, r, errors.New("app not found"))
+		c.RenderError(w, r, localize(r, errors.New("app not found")))
 		return
 	}
 
 	// Verify ownership
 	repo := app.Repo()
 	if repo == nil || repo.OwnerID != user.ID {
-		c.RenderError(w, r, errors.New("you can only promote your own apps"))
+		c.RenderError(w, r, localize(r, errors.New("you can only promote your own apps")))
 		return
 	}
 
 	// Check for existing promotion
 	if existing := app.ActivePromotion(); existing != nil {
-		c.RenderError(w, r, errors.New("this app already has an active promotion"))
+		c.RenderError(w, r, localize(r, errors.New("this app already has an active promotion")))
 		return
 	}
 
@@ -218,12 +247,83 @@ func (c *PaymentsController) checkoutPromotion(w http.ResponseWriter, r *http.Re
 	if days < 1 {
 		days = 7
 	}
-	if days > 30 {
-		days = 30
+	if days > models.MaxPromotionDays {
+		days = models.MaxPromotionDays
 	}
 
 	content := r.FormValue("content")
-	amount := int64(days * 100) // $1 per day in cents
+	tags := models.PromotionTags(r.FormValue("tags"))
+	excludeFollowers := r.FormValue("exclude_followers") == "on"
+
+	c.payForPromotion(w, r, user, appID, days, "/app/"+appID+"/manage", map[string]string{
+		"app_id":            appID,
+		"content":           content,
+		"tags":              tags,
+		"exclude_followers": strconv.FormatBool(excludeFollowers),
+	}, func(payment *models.Payment) {
+		c.createPromotion(user.ID, appID, content, tags, excludeFollowers, days, payment)
+	})
+}
+
+// checkoutExtension buys more days for an active promotion of any kind
+func (c *PaymentsController) checkoutExtension(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, _ := auth.Authenticate(r)
+
+	promo, err := models.Promotions.Get(r.PathValue("promotion"))
+	if err != nil || promo.UserID != user.ID {
+		c.RenderError(w, r, localize(r, errors.New("no active promotion found")))
+		return
+	}
+	if promo.IsExpired() {
+		c.RenderError(w, r, localize(r, errors.New("this promotion has already ended")))
+		return
+	}
+
+	days, _ := strconv.Atoi(r.FormValue("days"))
+	if days < 1 {
+		days = 7
+	}
+	if days > models.MaxPromotionDays {
+		days = models.MaxPromotionDays
+	}
+
+	c.payForPromotion(w, r, user, promo.SubjectID, days, "/promotions/"+promo.ID, map[string]string{
+		"promotion_id": promo.ID,
+	}, func(payment *models.Payment) {
+		c.extendPromotion(promo.ID, days)
+	})
+}
+
+// payForPromotion charges for days of promotion, spending the user's
+// account credit on whole days first. If the credit covers everything,
+// fulfill runs right away; otherwise the user checks out with Stripe and
+// the webhook fulfills the order from the metadata.
+func (c *PaymentsController) payForPromotion(w http.ResponseWriter, r *http.Request, user *authentication.User, subjectID string, days int, cancelPath string, metadata map[string]string, fulfill func(*models.Payment)) {
+	creditDays := models.CreditDays(user.ID, days)
+	credit := int64(creditDays * models.PromotionDayPrice)
+	amount := int64((days - creditDays) * models.PromotionDayPrice)
+
+	if amount == 0 {
+		if err := models.SpendCredit(user.ID, credit); err != nil {
+			c.RenderError(w, r, localize(r, err))
+			return
+		}
+
+		now := time.Now()
+		payment, _ := models.Payments.Insert(&models.Payment{
+			UserID:        user.ID,
+			ProductType:   models.PaymentPromotion,
+			SubjectID:     subjectID,
+			Currency:      "usd",
+			Status:        models.PaymentCompleted,
+			CompletedAt:   &now,
+			CreditApplied: credit,
+		})
+		fulfill(payment)
+		c.Redirect(w, r, "/promotions")
+		return
+	}
 
 	// Get profile for Stripe customer
 	profile, _ := models.Profiles.First("WHERE UserID = ?", user.ID)
@@ -237,26 +337,25 @@ func (c *PaymentsController) checkoutPromotion(w http.ResponseWriter, r *http.Re
 		baseURL = "https://" + prefix + ".theskyscape.com"
 	}
 
-	catalog, err := c.stripe.GetCatalog()
+	catalog, err := c.stripe.WithContext(r.Context()).GetCatalog()
 	if err != nil {
-		c.RenderError(w, r, fmt.Errorf("payment system not configured: %w", err))
+		c.RenderError(w, r, localize(r, fmt.Errorf("payment system not configured: %w", err)))
 		return
 	}
+
+	metadata["user_id"] = user.ID
+	metadata["product_type"] = models.PaymentPromotion
+	metadata["days"] = strconv.Itoa(days)
+	metadata["credit_days"] = strconv.Itoa(creditDays)
 	opts := payments.CheckoutOptions{
 		Mode:       payments.ModePayment,
 		SuccessURL: baseURL + "/checkout/success?session_id={CHECKOUT_SESSION_ID}",
-		CancelURL:  baseURL + "/app/" + appID + "/manage",
+		CancelURL:  baseURL + cancelPath,
 		LineItems: []payments.LineItem{{
 			PriceID:  catalog.PromotionPriceID,
-			Quantity: int64(days),
+			Quantity: int64(days - creditDays),
 		}},
-		Metadata: map[string]string{
-			"user_id":      user.ID,
-			"product_type": models.PaymentPromotion,
-			"app_id":       appID,
-			"days":         strconv.Itoa(days),
-			"content":      content,
-		},
+		Metadata: metadata,
 	}
 
 	if customerID != "" {
@@ -265,9 +364,9 @@ func (c *PaymentsController) checkoutPromotion(w http.ResponseWriter, r *http.Re
 		opts.CustomerEmail = user.Email
 	}
 
-	session, err := c.stripe.CreateCheckoutSession(opts)
+	session, err := c.stripe.WithContext(r.Context()).CreateCheckoutSession(opts)
 	if err != nil {
-		c.RenderError(w, r, fmt.Errorf("failed to create checkout: %w", err))
+		c.RenderError(w, r, localize(r, fmt.Errorf("failed to create checkout: %w", err)))
 		return
 	}
 
@@ -276,10 +375,11 @@ func (c *PaymentsController) checkoutPromotion(w http.ResponseWriter, r *http.Re
 		UserID:          user.ID,
 		StripePaymentID: session.ID,
 		ProductType:     models.PaymentPromotion,
-		SubjectID:       appID,
+		SubjectID:       subjectID,
 		Amount:          amount,
 		Currency:        "usd",
 		Status:          models.PaymentPending,
+		CreditApplied:   credit,
 	})
 
 	// Use http.Redirect for external Stripe URLs (not c.Redirect which is for internal HTMX navigation)
@@ -293,14 +393,14 @@ func (c *PaymentsController) checkoutUpgrade(w http.ResponseWriter, r *http.Requ
 	appID := r.PathValue("app")
 	app, err := models.Apps.Get(appID)
 	if err != nil {
-		c.RenderError(w, r, errors.New("app not found"))
+		c.RenderError(w, r, localize(r, errors.New("app not found")))
 		return
 	}
 
 	// Verify ownership
 	repo := app.Repo()
 	if repo == nil || repo.OwnerID != user.ID {
-		c.RenderError(w, r, errors.New("you can only upgrade your own apps"))
+		c.RenderError(w, r, localize(r, errors.New("you can only upgrade your own apps")))
 		return
 	}
 
@@ -313,7 +413,7 @@ func (c *PaymentsController) checkoutUpgrade(w http.ResponseWriter, r *http.Requ
 	totalPrice := int64(cpuCores*500) + int64(storageGB*25)
 
 	if totalPrice <= 0 {
-		c.RenderError(w, r, errors.New("please select resources to upgrade"))
+		c.RenderError(w, r, localize(r, errors.New("please select resources to upgrade")))
 		return
 	}
 
@@ -330,9 +430,9 @@ func (c *PaymentsController) checkoutUpgrade(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Build line items using pre-configured Stripe prices
-	catalog, err := c.stripe.GetCatalog()
+	catalog, err := c.stripe.WithContext(r.Context()).GetCatalog()
 	if err != nil {
-		c.RenderError(w, r, fmt.Errorf("payment system not configured: %w", err))
+		c.RenderError(w, r, localize(r, fmt.Errorf("payment system not configured: %w", err)))
 		return
 	}
 	var lineItems []payments.LineItem
@@ -371,9 +471,9 @@ func (c *PaymentsController) checkoutUpgrade(w http.ResponseWriter, r *http.Requ
 		opts.CustomerEmail = user.Email
 	}
 
-	session, err := c.stripe.CreateCheckoutSession(opts)
+	session, err := c.stripe.WithContext(r.Context()).CreateCheckoutSession(opts)
 	if err != nil {
-		c.RenderError(w, r, fmt.Errorf("failed to create checkout: %w", err))
+		c.RenderError(w, r, localize(r, fmt.Errorf("failed to create checkout: %w", err)))
 		return
 	}
 
@@ -404,12 +504,12 @@ func (c *PaymentsController) handleWebhook(w http.ResponseWriter, r *http.Reques
 	signature := r.Header.Get("Stripe-Signature")
 	event, err := c.stripe.VerifyWebhook(payload, signature)
 	if err != nil {
-		log.Printf("[Stripe Webhook] Signature verification failed: %v", err)
+		slog.WarnContext(r.Context(), "stripe webhook signature verification failed", "error", err)
 		http.Error(w, "invalid signature", http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("[Stripe Webhook] Received event: %s", event.Type)
+	slog.InfoContext(r.Context(), "stripe webhook received", "event", event.Type)
 
 	switch event.Type {
 	case payments.EventCheckoutCompleted:
@@ -426,7 +526,7 @@ func (c *PaymentsController) handleWebhook(w http.ResponseWriter, r *http.Reques
 func (c *PaymentsController) handleCheckoutCompleted(event *payments.Event) {
 	metadata, err := event.Metadata()
 	if err != nil {
-		log.Printf("[Stripe Webhook] Failed to get metadata: %v", err)
+		slog.Error("stripe webhook missing metadata", "error", err)
 		return
 	}
 
@@ -435,7 +535,7 @@ func (c *PaymentsController) handleCheckoutCompleted(event *payments.Event) {
 
 	session, err := event.CheckoutSessionEvent()
 	if err != nil {
-		log.Printf("[Stripe Webhook] Failed to parse checkout session: %v", err)
+		slog.Error("failed to parse checkout session", "error", err)
 		return
 	}
 
@@ -457,7 +557,17 @@ func (c *PaymentsController) handleCheckoutCompleted(event *payments.Event) {
 		if days < 1 {
 			days = 7
 		}
-		c.createPromotion(userID, appID, content, days, payment)
+		if creditDays, _ := strconv.Atoi(metadata["credit_days"]); creditDays > 0 {
+			if err := models.SpendCredit(userID, int64(creditDays*models.PromotionDayPrice)); err != nil {
+				slog.Warn("promotion credit spent before checkout completed", "user_id", userID, "error", err)
+			}
+		}
+		if promotionID := metadata["promotion_id"]; promotionID != "" {
+			c.extendPromotion(promotionID, days)
+			break
+		}
+		excludeFollowers, _ := strconv.ParseBool(metadata["exclude_followers"])
+		c.createPromotion(userID, appID, content, metadata["tags"], excludeFollowers, days, payment)
 
 	case models.PaymentResourceUpgrade:
 		appID := metadata["app_id"]
@@ -470,7 +580,7 @@ func (c *PaymentsController) handleCheckoutCompleted(event *payments.Event) {
 func (c *PaymentsController) activateVerified(userID string, session *payments.CheckoutSession) {
 	profile, err := models.Profiles.First("WHERE UserID = ?", userID)
 	if err != nil {
-		log.Printf("[Stripe Webhook] Profile not found for user %s", userID)
+		slog.Error("stripe webhook profile not found", "user_id", userID)
 		return
 	}
 
@@ -495,10 +605,10 @@ func (c *PaymentsController) activateVerified(userID string, session *payments.C
 		}
 	}
 
-	log.Printf("[Stripe Webhook] Activated verification for user %s", userID)
+	slog.Info("activated verification", "user_id", userID)
 }
 
-func (c *PaymentsController) createPromotion(userID, appID, content string, days int, payment *models.Payment) {
+func (c *PaymentsController) createPromotion(userID, appID, content, tags string, excludeFollowers bool, days int, payment *models.Payment) {
 	paymentID := ""
 	if payment != nil {
 		paymentID = payment.ID
@@ -513,9 +623,28 @@ func (c *PaymentsController) createPromotion(userID, appID, content string, days
 		ExpiresAt:   time.Now().Add(duration),
 		PaymentID:   paymentID,
 		IsPaid:      true,
+		PaidDays:    days,
+
+		Tags:             models.PromotionTags(tags),
+		ExcludeFollowers: excludeFollowers,
 	})
 
-	log.Printf("[Stripe Webhook] Created %d-day promotion for app %s", days, appID)
+	slog.Info("created promotion", "app_id", appID, "days", days)
+}
+
+func (c *PaymentsController) extendPromotion(promotionID string, days int) {
+	promo, err := models.Promotions.Get(promotionID)
+	if err != nil {
+		slog.Error("extended promotion not found", "promotion_id", promotionID)
+		return
+	}
+
+	if err = promo.Extend(days); err != nil {
+		slog.Error("failed to extend promotion", "promotion_id", promotionID, "error", err)
+		return
+	}
+
+	slog.Info("extended promotion", "promotion_id", promotionID, "days", days)
 }
 
 func (c *PaymentsController) activateResourceUpgrade(userID, appID string, session *payments.CheckoutSession, cpuCores float64, storageGB int) {
@@ -537,20 +666,20 @@ func (c *PaymentsController) activateResourceUpgrade(userID, appID string, sessi
 
 	// TODO: Apply the actual resource upgrade via headquarters
 	// This would update XFS quotas and container resource limits
-	log.Printf("[Stripe Webhook] Resource upgrade for app %s: CPU=%.1f, Storage=%dGB", appID, cpuCores, storageGB)
+	slog.Info("activated resource upgrade", "app_id", appID, "cpu", cpuCores, "storage_gb", storageGB)
 }
 
 func (c *PaymentsController) handleSubscriptionUpdated(event *payments.Event) {
 	sub, err := event.SubscriptionEvent()
 	if err != nil {
-		log.Printf("[Stripe Webhook] Failed to parse subscription: %v", err)
+		slog.Error("failed to parse subscription", "error", err)
 		return
 	}
 
 	// Find subscription by Stripe ID
 	subscription, err := models.Subscriptions.First("WHERE StripeSubscriptionID = ?", sub.ID)
 	if err != nil {
-		log.Printf("[Stripe Webhook] Subscription not found: %s", sub.ID)
+		slog.Error("subscription not found", "subscription_id", sub.ID)
 		return
 	}
 
@@ -563,20 +692,20 @@ func (c *PaymentsController) handleSubscriptionUpdated(event *payments.Event) {
 	}
 	models.Subscriptions.Update(subscription)
 
-	log.Printf("[Stripe Webhook] Updated subscription %s: status=%s", sub.ID, sub.Status)
+	slog.Info("updated subscription", "subscription_id", sub.ID, "status", sub.Status)
 }
 
 func (c *PaymentsController) handleSubscriptionDeleted(event *payments.Event) {
 	sub, err := event.SubscriptionEvent()
 	if err != nil {
-		log.Printf("[Stripe Webhook] Failed to parse subscription: %v", err)
+		slog.Error("failed to parse subscription", "error", err)
 		return
 	}
 
 	// Find subscription by Stripe ID
 	subscription, err := models.Subscriptions.First("WHERE StripeSubscriptionID = ?", sub.ID)
 	if err != nil {
-		log.Printf("[Stripe Webhook] Subscription not found for deletion: %s", sub.ID)
+		slog.Error("subscription not found for deletion", "subscription_id", sub.ID)
 		return
 	}
 
@@ -595,7 +724,7 @@ func (c *PaymentsController) handleSubscriptionDeleted(event *payments.Event) {
 		}
 	}
 
-	log.Printf("[Stripe Webhook] Deleted subscription %s", sub.ID)
+	slog.Info("deleted subscription", "subscription_id", sub.ID)
 }
 
 // Billing portal
@@ -606,7 +735,7 @@ func (c *PaymentsController) billingPortal(w http.ResponseWriter, r *http.Reques
 
 	profile, err := models.Profiles.First("WHERE UserID = ?", user.ID)
 	if err != nil || profile.StripeCustomerID == "" {
-		c.RenderError(w, r, errors.New("no billing account found"))
+		c.RenderError(w, r, localize(r, errors.New("no billing account found")))
 		return
 	}
 
@@ -615,9 +744,9 @@ func (c *PaymentsController) billingPortal(w http.ResponseWriter, r *http.Reques
 		baseURL = "https://" + prefix + ".theskyscape.com"
 	}
 
-	portalURL, err := c.stripe.CreatePortalSession(profile.StripeCustomerID, baseURL+"/billing")
+	portalURL, err := c.stripe.WithContext(r.Context()).CreatePortalSession(profile.StripeCustomerID, baseURL+"/billing")
 	if err != nil {
-		c.RenderError(w, r, fmt.Errorf("failed to create portal session: %w", err))
+		c.RenderError(w, r, localize(r, fmt.Errorf("failed to create portal session: %w", err)))
 		return
 	}
 
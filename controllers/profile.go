@@ -4,8 +4,12 @@ import (
 	"cmp"
 	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/The-Skyscape/devtools/pkg/application"
+	"www.theskyscape.com/internal/i18n"
+	"www.theskyscape.com/internal/imaging"
+	"www.theskyscape.com/internal/scanning"
 	"www.theskyscape.com/models"
 )
 
@@ -23,14 +27,18 @@ func (c *ProfileController) Setup(app *application.App) {
 	c.Controller.Setup(app)
 	auth := c.Use("auth").(*AuthController)
 
-	http.Handle("GET /profile", app.Serve("profile.html", auth.Required))
-	http.Handle("GET /user/{id}", app.Serve("profile.html", auth.Optional))
-	http.Handle("GET /user/{id}/repos", app.Serve("user-repos.html", auth.Optional))
-	http.Handle("GET /user/{id}/apps", app.Serve("user-apps.html", auth.Optional))
-	http.Handle("GET /user/{id}/projects", app.Serve("user-projects.html", auth.Optional))
-	http.Handle("GET /user/{id}/followers", app.Serve("user-followers.html", auth.Optional))
-	http.Handle("GET /user/{id}/following", app.Serve("user-following.html", auth.Optional))
-	http.Handle("POST /setup", app.ProtectFunc(c.setup, auth.Optional))
+	route("GET /profile", app.Serve("profile.html", auth.Required))
+	route("GET /user/{id}", cached(app.Serve("profile.html", auth.Optional)))
+	route("GET /user/{id}/repos", cached(app.Serve("user-repos.html", auth.Optional)))
+	route("GET /user/{id}/apps", cached(app.Serve("user-apps.html", auth.Optional)))
+	route("GET /user/{id}/projects", cached(app.Serve("user-projects.html", auth.Optional)))
+	route("GET /user/{id}/followers", cached(app.Serve("user-followers.html", auth.Optional)))
+	route("GET /user/{id}/following", cached(app.Serve("user-following.html", auth.Optional)))
+	route("GET /user/{id}/stars", cached(app.Serve("user-stars.html", auth.Optional)))
+	route("POST /setup", app.ProtectFunc(c.setup, auth.Optional))
+	route("POST /profile/avatar", c.ProtectFunc(auth.limited(uploadLimit, c.uploadAvatar), auth.Required))
+	route("GET /avatar/{file}", c.ProtectFunc(c.serveIdenticon, auth.Optional))
+	route("POST /onboarding/dismiss", c.ProtectFunc(c.dismissOnboarding, auth.Required))
 }
 
 func (c ProfileController) Handle(r *http.Request) application.Handler {
@@ -63,6 +71,14 @@ func (c *ProfileController) CurrentProfile() *models.Profile {
 		return nil
 	}
 
+	// Suspended profiles are only visible to admins
+	if p.Suspended {
+		auth := c.Use("auth").(*AuthController)
+		if viewer := auth.CurrentUser(); viewer == nil || !viewer.IsAdmin {
+			return nil
+		}
+	}
+
 	return p
 }
 
@@ -74,14 +90,45 @@ func (c *ProfileController) GetProfile(userID string) *models.Profile {
 	return p
 }
 
+// MyOnboarding returns the current user's welcome checklist, or nil once
+// it's finished or dismissed
+func (c *ProfileController) MyOnboarding() *models.Onboarding {
+	auth := c.Use("auth").(*AuthController)
+	user := auth.CurrentUser()
+	if user == nil {
+		return nil
+	}
+	p, err := models.Profiles.Get(user.ID)
+	if err != nil {
+		return nil
+	}
+	return p.Onboarding()
+}
+
+// OnboardingTip returns the checklist step to show a tip for on a page
+// about key, but only while it's the current user's next step
+func (c *ProfileController) OnboardingTip(key string) *models.OnboardingStep {
+	onboarding := c.MyOnboarding()
+	if onboarding == nil {
+		return nil
+	}
+	if next := onboarding.Next(); next != nil && next.Key == key {
+		return next
+	}
+	return nil
+}
+
 func (p *ProfileController) RecentProfiles() []*models.Profile {
 	query := p.URL.Query().Get("query")
 	profiles, _ := models.Profiles.Search(`
 	  INNER JOIN users on users.ID = profiles.UserID
 		WHERE
-			users.Name           LIKE $1        OR
-			users.Handle         LIKE LOWER($1) OR
-			profiles.Description LIKE $1
+			profiles.Suspended = false
+			AND (
+				users.Name           LIKE $1        OR
+				users.Handle         LIKE LOWER($1) OR
+				profiles.Description LIKE $1
+			)
 		ORDER BY (SELECT COUNT(*) FROM follows WHERE FolloweeID = profiles.ID) DESC
 		LIMIT 4
 	`, "%"+query+"%")
@@ -111,13 +158,30 @@ func (c *ProfileController) UserActivities() []*models.Activity {
 	}
 
 	limit := c.Limit()
-	offset := (c.Page() - 1) * limit
+	cursor := ParseCursor(c.URL.Query())
+	offset := 0
+	if cursor == nil {
+		offset = (c.Page() - 1) * limit
+	}
+
+	// Followers-only posts are left out unless the viewer can see them
+	visible := "1 = 1"
+	auth := c.Use("auth").(*AuthController)
+	user := auth.CurrentUser()
+	if user == nil || (user.ID != profile.UserID && !profile.IsFollowedBy(user.ID)) {
+		visible = "Visibility != '" + models.PostFollowers + "'"
+	}
 
+	before, args := cursor.Before("")
 	activities, _ := models.Activities.Search(`
 		WHERE UserID = ?
-		ORDER BY CreatedAt DESC
+			AND `+visible+`
+			AND DeletedAt IS NULL
+			AND `+before+`
+		ORDER BY CreatedAt DESC, ID DESC
 		LIMIT ? OFFSET ?
-	`, profile.UserID, limit, offset)
+	`, append(append([]any{profile.UserID}, args...), limit, offset)...)
+	models.PreloadActivities(c.Request.Context(), activities)
 	return activities
 }
 
@@ -125,31 +189,184 @@ func (c *ProfileController) setup(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("authentication required"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("authentication required")))
 		return
 	}
 
 	desc := r.FormValue("description")
 	if p, err := models.Profiles.Get(user.ID); err != nil {
-		if _, err = models.CreateProfile(user.ID, desc); err != nil {
-			c.Render(w, r, "error-message.html", err)
+		p, err = models.CreateProfile(user.ID, desc)
+		if err != nil {
+			c.Render(w, r, "error-message.html", localize(r, err))
 			return
 		}
+
+		// Email new users in the language they signed up with
+		p.Locale = requestLocale(r)
+		models.Profiles.Update(p)
+
+		// Give new users a generated avatar until they upload one
+		if user.Avatar == "" {
+			user.Avatar = models.IdenticonURL(user.ID)
+			models.Auth.Users.Update(user)
+		}
 	} else {
+		if err = claimEdit(w, r, p); err != nil {
+			c.Render(w, r, "error-message.html", localize(r, err))
+			return
+		}
+
 		user := p.User()
 		user.Avatar = cmp.Or(r.FormValue("avatar"), user.Avatar)
 		user.Name = cmp.Or(r.FormValue("name"), user.Name)
 		if err = models.Auth.Users.Update(user); err != nil {
-			c.Render(w, r, "error-message.html", err)
+			c.Render(w, r, "error-message.html", localize(r, err))
 			return
 		}
 
 		p.Description = cmp.Or(desc, p.Description)
+		if _, ok := r.Form["indexing"]; ok {
+			p.NoIndex = r.FormValue("noindex") == "on"
+		}
+		if locale, ok := r.Form["locale"]; ok && (locale[0] == "" || i18n.Supported(locale[0])) {
+			p.Locale = locale[0]
+			setLocaleCookie(w, p.Locale)
+		}
 		if err = models.Profiles.Update(p); err != nil {
-			c.Render(w, r, "error-message.html", err)
+			c.Render(w, r, "error-message.html", localize(r, err))
 			return
 		}
 	}
 
 	c.Refresh(w, r)
 }
+
+const maxAvatarSize = 5 * 1024 * 1024 // 5MB
+
+// uploadAvatar crops and resizes an uploaded image into the standard avatar
+// sizes and points the user's avatar at the processed result.
+func (c *ProfileController) uploadAvatar(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("authentication required")))
+		return
+	}
+
+	p, err := models.Profiles.Get(user.ID)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("profile not found")))
+		return
+	}
+
+	r.ParseMultipartForm(maxAvatarSize)
+	file, handler, err := r.FormFile("file")
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("no file uploaded")))
+		return
+	}
+	defer file.Close()
+
+	if handler.Size > maxAvatarSize {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("avatar too large, max 5MB")))
+		return
+	}
+
+	variants, err := imaging.ProcessAvatar(file, imaging.AvatarLarge, imaging.AvatarSmall)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	// Re-encoding strips anything hidden in the upload, but the results
+	// are still scanned like every other upload before they're served
+	large, err := scanning.Store(&models.File{
+		OwnerID:  user.ID,
+		FilePath: "avatar.png",
+		MimeType: "image/png",
+		Content:  variants[imaging.AvatarLarge],
+	})
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	thumb, err := scanning.Store(&models.File{
+		OwnerID:  user.ID,
+		FilePath: "avatar-thumb.png",
+		MimeType: "image/png",
+		Content:  variants[imaging.AvatarSmall],
+	})
+	if err != nil {
+		models.Files.Delete(large)
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	// Remove the previous processed avatar so uploads don't accumulate
+	for _, id := range []string{p.AvatarFileID, p.AvatarThumbID} {
+		if old, err := models.Files.Get(id); err == nil && old.OwnerID == user.ID {
+			models.Files.Delete(old)
+		}
+	}
+
+	p.AvatarFileID = large.ID
+	p.AvatarThumbID = thumb.ID
+	if err = models.Profiles.Update(p); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	user.Avatar = "/file/" + large.ID
+	if err = models.Auth.Users.Update(user); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		JSONSuccess(w, map[string]string{
+			"url":   user.Avatar,
+			"thumb": p.AvatarThumb(),
+		})
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+// serveIdenticon renders the generated fallback avatar for a user ID
+// dismissOnboarding hides the welcome checklist and its tips for good
+func (c *ProfileController) dismissOnboarding(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	p, err := models.Profiles.Get(user.ID)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("profile not found")))
+		return
+	}
+
+	p.OnboardingDismissed = true
+	if err = models.Profiles.Update(p); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+func (c *ProfileController) serveIdenticon(w http.ResponseWriter, r *http.Request) {
+	userID := strings.TrimSuffix(r.PathValue("file"), ".png")
+	size := imaging.AvatarLarge
+	if r.URL.Query().Get("size") == "small" {
+		size = imaging.AvatarSmall
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Write(imaging.Identicon(userID, size))
+}
@@ -4,7 +4,7 @@ import (
 	"cmp"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"path/filepath"
 	"strconv"
@@ -12,9 +12,14 @@ import (
 	"time"
 
 	"github.com/The-Skyscape/devtools/pkg/application"
+	"www.theskyscape.com/internal/analytics"
 	"www.theskyscape.com/internal/hosting"
+	"www.theskyscape.com/internal/imagescan"
 	"www.theskyscape.com/internal/social"
 	"www.theskyscape.com/internal/starter"
+	"www.theskyscape.com/internal/summaries"
+	"www.theskyscape.com/internal/tracing"
+	"www.theskyscape.com/internal/traffic"
 	"www.theskyscape.com/models"
 )
 
@@ -30,21 +35,32 @@ func (c *ProjectsController) Setup(app *application.App) {
 	c.Controller.Setup(app)
 	auth := app.Use("auth").(*AuthController)
 
-	http.Handle("GET /projects", c.Serve("projects.html", auth.Optional))
-	http.Handle("GET /project/{project}", c.Serve("project.html", auth.Optional))
-	http.Handle("GET /project/{project}/manage", c.Serve("project-manage.html", auth.Required))
-	http.Handle("GET /project/{project}/file/{path...}", c.Serve("project-file.html", auth.Optional))
-	http.Handle("GET /project/{project}/comments", c.Serve("project-comments.html", auth.Optional))
-	http.Handle("GET /project/{project}/versions", c.ProtectFunc(c.pollVersions, auth.Required))
-	http.Handle("POST /projects", c.ProtectFunc(c.create, auth.Required))
-	http.Handle("POST /project/{project}/edit", c.ProtectFunc(c.update, auth.Required))
-	http.Handle("POST /project/{project}/launch", c.ProtectFunc(c.launch, auth.Required))
-	http.Handle("POST /project/{project}/enable-database", c.ProtectFunc(c.enableDatabase, auth.Required))
-	http.Handle("POST /project/{project}/star", c.ProtectFunc(c.toggleStar, auth.Required))
-	http.Handle("POST /project/{project}/share", c.ProtectFunc(c.shareProject, auth.Required))
-	http.Handle("POST /project/{project}/promote", c.ProtectFunc(c.promoteProject, auth.Required))
-	http.Handle("DELETE /project/{project}/promote", c.ProtectFunc(c.cancelPromotion, auth.Required))
-	http.Handle("DELETE /project/{project}", c.ProtectFunc(c.shutdown, auth.Required))
+	go analytics.Run(time.Minute)
+	go traffic.Run(time.Minute)
+
+	route("GET /projects", cached(c.Serve("projects.html", auth.Optional)))
+	route("GET /project/{project}", cached(c.Serve("project.html", auth.Optional)))
+	route("GET /project/{project}/manage", c.Serve("project-manage.html", auth.Required))
+	route("GET /project/{project}/file/{path...}", c.Serve("project-file.html", auth.Optional))
+	route("GET /project/{project}/comments", c.Serve("project-comments.html", auth.Optional))
+	route("GET /project/{project}/versions", noindex(c.ProtectFunc(c.pollVersions, auth.Required)))
+	route("POST /projects", c.ProtectFunc(c.create, auth.Required))
+	route("GET /starters/{template}/preview.svg", http.HandlerFunc(c.starterPreview))
+	route("POST /project/{project}/edit", c.ProtectFunc(c.update, auth.Required))
+	route("POST /project/{project}/duplicate", c.ProtectFunc(c.duplicate, auth.Required))
+	route("POST /project/{project}/launch", c.ProtectFunc(c.launch, auth.Required))
+	route("POST /project/{project}/enable-database", c.ProtectFunc(c.enableDatabase, auth.Required))
+	route("POST /project/{project}/analytics", c.ProtectFunc(c.updateAnalytics, auth.Required))
+	route("POST /project/{project}/protection", c.ProtectFunc(c.updateProtection, auth.Required))
+	route("POST /project/{project}/block-vulnerable", c.ProtectFunc(c.updateBlockVulnerable, auth.Required))
+	route("POST /project/{project}/share", c.ProtectFunc(c.shareProject, auth.Required))
+	route("POST /project/{project}/promote", c.ProtectFunc(c.promoteProject, auth.Required))
+	route("DELETE /project/{project}/promote", c.ProtectFunc(c.cancelPromotion, auth.Required))
+	route("POST /project/{project}/deploy-tokens", c.ProtectFunc(c.createDeployToken, auth.Required))
+	route("DELETE /project/{project}/deploy-tokens/{token}", c.ProtectFunc(c.deleteDeployToken, auth.Required))
+	route("POST /project/{project}/service-token/rotate", c.ProtectFunc(c.rotateServiceToken, auth.Required))
+	route("POST /project/{project}/release-notes", c.ProtectFunc(c.draftReleaseNotes, auth.Required))
+	route("DELETE /project/{project}", c.ProtectFunc(c.shutdown, auth.Required))
 }
 
 func (c ProjectsController) Handle(r *http.Request) application.Handler {
@@ -56,6 +72,11 @@ func (c ProjectsController) Handle(r *http.Request) application.Handler {
 // Template Methods
 // =============================================================================
 
+// StarterTemplates returns the templates a new project can start from
+func (c *ProjectsController) StarterTemplates() []*starter.Template {
+	return starter.Templates()
+}
+
 func (c *ProjectsController) CurrentProject() *models.Project {
 	project, err := models.Projects.Get(c.PathValue("project"))
 	if err != nil {
@@ -64,6 +85,13 @@ func (c *ProjectsController) CurrentProject() *models.Project {
 	return project
 }
 
+// SummariesEnabled reports whether the current user can draft release notes
+func (c *ProjectsController) SummariesEnabled() bool {
+	auth := c.Use("auth").(*AuthController)
+	user := auth.CurrentUser()
+	return user != nil && wantsSummaries(user.ID)
+}
+
 func (c *ProjectsController) IsManagePage() bool {
 	return strings.HasSuffix(c.Request.URL.Path, "/manage")
 }
@@ -88,6 +116,7 @@ func (c *ProjectsController) AllProjects() []*models.Project {
 		INNER JOIN users ON users.ID = projects.OwnerID
 		WHERE
 			projects.Status != 'shutdown'
+			AND projects.OwnerID NOT IN (SELECT UserID FROM profiles WHERE Suspended = true)
 			AND (
 				projects.Name        LIKE $1 OR
 				projects.Description LIKE $1 OR
@@ -104,12 +133,13 @@ func (c *ProjectsController) RecentProjects() []*models.Project {
 		INNER JOIN users ON users.ID = projects.OwnerID
 		WHERE
 			projects.Status != 'shutdown'
+			AND projects.OwnerID NOT IN (SELECT UserID FROM profiles WHERE Suspended = true)
 			AND (
 				projects.Name        LIKE $1 OR
 				projects.Description LIKE $1 OR
 				users.Handle         LIKE LOWER($1)
 			)
-		ORDER BY (SELECT COUNT(*) FROM stars WHERE ProjectID = projects.ID) DESC
+		ORDER BY projects.StarTotal DESC
 		LIMIT 3
 	`, "%"+query+"%")
 	return projects
@@ -234,6 +264,9 @@ func (c *ProjectsController) Comments() []*models.Comment {
 		return nil
 	}
 	limit := c.CommentLimit()
+	if cursor := ParseCursor(c.URL.Query()); cursor != nil {
+		return project.CommentsBefore(cursor, limit)
+	}
 	offset := (c.CommentPage() - 1) * limit
 	return project.Comments(limit, offset)
 }
@@ -259,7 +292,7 @@ func (c *ProjectsController) create(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("unauthorized"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("unauthorized")))
 		return
 	}
 
@@ -267,39 +300,45 @@ func (c *ProjectsController) create(w http.ResponseWriter, r *http.Request) {
 	description := strings.TrimSpace(r.FormValue("description"))
 
 	if name == "" || description == "" {
-		c.Render(w, r, "error-message.html", errors.New("name and description are required"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("name and description are required")))
+		return
+	}
+
+	tmpl := starter.Lookup(cmp.Or(r.FormValue("template"), starter.Default))
+	if tmpl == nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("unknown starter template")))
 		return
 	}
 
 	// Sanitize ID
 	id, err := hosting.SanitizeID(name)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	// Check if project already exists
 	if _, err := models.Projects.Get(id); err == nil {
-		c.Render(w, r, "error-message.html", errors.New("a project with this ID already exists"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("a project with this ID already exists")))
 		return
 	}
 
 	// Check if git repo path exists
 	if hosting.RepoExists(id) {
-		c.Render(w, r, "error-message.html", errors.New("project directory already exists"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("project directory already exists")))
 		return
 	}
 
 	// Initialize git repo
 	if err := hosting.InitGitRepo(id); err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	// Create project record
 	project, err := models.NewProject(id, user.ID, name, description)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -317,10 +356,10 @@ func (c *ProjectsController) create(w http.ResponseWriter, r *http.Request) {
 		SubjectID:   project.ID,
 	})
 
-	// Initialize with starter Skykit app and trigger build
+	// Initialize with the starter template and trigger build
 	go func() {
-		if err := starter.CreateStarterFiles(project.Path(), project, user); err != nil {
-			log.Printf("warning: failed to init starter files for project %s: %v", project.ID, err)
+		if err := starter.CreateStarterFiles(project.Path(), project, user, tmpl); err != nil {
+			slog.Warn("failed to init starter files", "project_id", project.ID, "error", err)
 			return
 		}
 
@@ -328,8 +367,8 @@ func (c *ProjectsController) create(w http.ResponseWriter, r *http.Request) {
 		project.Status = "launching"
 		models.Projects.Update(project)
 
-		if _, err := hosting.BuildProject(project); err != nil {
-			log.Printf("warning: initial build failed for project %s: %v", project.ID, err)
+		if _, err := hosting.BuildProject(tracing.Detach(r.Context()), project); err != nil {
+			slog.Warn("initial build failed", "project_id", project.ID, "error", err)
 			project.Status = "draft"
 			project.Error = err.Error()
 		} else {
@@ -342,22 +381,134 @@ func (c *ProjectsController) create(w http.ResponseWriter, r *http.Request) {
 	c.Redirect(w, r, "/project/"+project.ID)
 }
 
+// starterPreview serves a starter template's preview image for the
+// gallery in the new project modal
+func (c *ProjectsController) starterPreview(w http.ResponseWriter, r *http.Request) {
+	tmpl := starter.Lookup(r.PathValue("template"))
+	if tmpl == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	svg, err := tmpl.Preview()
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(svg)
+}
+
+// duplicate copies a project's git history and settings into a new
+// project owned by the same user, and builds it. Nothing secret or tied
+// to the original is carried over: not its database, OAuth client,
+// tokens, custom domains or webhooks.
+func (c *ProjectsController) duplicate(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("unauthorized")))
+		return
+	}
+
+	source, err := models.Projects.Get(r.PathValue("project"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("project not found")))
+		return
+	}
+
+	if source.OwnerID != user.ID && !user.IsAdmin {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("permission denied")))
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("name is required")))
+		return
+	}
+
+	id, err := hosting.SanitizeID(name)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	if _, err := models.Projects.Get(id); err == nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("a project with this ID already exists")))
+		return
+	}
+
+	if hosting.RepoExists(id) {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("project directory already exists")))
+		return
+	}
+
+	if err := hosting.CloneGitRepo(source.ID, id); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	project, err := models.NewProject(id, source.OwnerID, name, source.Description)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	project.DatabaseEnabled = source.DatabaseEnabled
+	project.AnalyticsEnabled = source.AnalyticsEnabled
+	project.BlockVulnerable = source.BlockVulnerable
+	project.Status = "launching"
+	models.Projects.Update(project)
+
+	if rules := source.ProxyRules(); rules.ID != "" {
+		rules.ID, rules.SiteID = "", project.ID
+		if err := rules.Save(); err != nil {
+			slog.Warn("failed to copy proxy rules", "project_id", project.ID, "error", err)
+		}
+	}
+
+	models.Activities.Insert(&models.Activity{
+		UserID:      source.OwnerID,
+		Action:      "created",
+		SubjectType: "project",
+		SubjectID:   project.ID,
+	})
+
+	go func() {
+		if _, err := hosting.BuildProject(tracing.Detach(r.Context()), project); err != nil {
+			slog.Warn("build of duplicated project failed", "project_id", project.ID, "error", err)
+			project.Status = "draft"
+			project.Error = err.Error()
+		} else {
+			project.Status = "online"
+			project.Error = ""
+		}
+		models.Projects.Update(project)
+	}()
+
+	c.Redirect(w, r, "/project/"+project.ID+"/manage")
+}
+
 func (c *ProjectsController) update(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("unauthorized"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("unauthorized")))
 		return
 	}
 
 	project, err := models.Projects.Get(r.PathValue("project"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("project not found"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("project not found")))
 		return
 	}
 
 	if project.OwnerID != user.ID && !user.IsAdmin {
-		c.Render(w, r, "error-message.html", errors.New("you are not the owner"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("you are not the owner")))
 		return
 	}
 
@@ -365,7 +516,12 @@ func (c *ProjectsController) update(w http.ResponseWriter, r *http.Request) {
 	description := strings.TrimSpace(r.FormValue("description"))
 
 	if name == "" || description == "" {
-		c.Render(w, r, "error-message.html", errors.New("name and description are required"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("name and description are required")))
+		return
+	}
+
+	if err := claimEdit(w, r, project); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -376,15 +532,16 @@ func (c *ProjectsController) update(w http.ResponseWriter, r *http.Request) {
 	newID := r.FormValue("id")
 	if newID != "" && newID != project.ID && user.IsAdmin {
 		if err := hosting.RenameProject(project.ID, newID, name, description); err != nil {
-			c.Render(w, r, "error-message.html", err)
+			c.Render(w, r, "error-message.html", localize(r, err))
 			return
 		}
+		auth.audit(r, user.ID, models.AuditProjectRenamed, "project", newID, "renamed from "+project.ID)
 		c.Redirect(w, r, "/project/"+newID+"/manage")
 		return
 	}
 
 	if err := models.Projects.Update(project); err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -395,18 +552,18 @@ func (c *ProjectsController) launch(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	project, err := models.Projects.Get(r.PathValue("project"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("project not found"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("project not found")))
 		return
 	}
 
 	if project.OwnerID != user.ID && !user.IsAdmin {
-		c.Render(w, r, "error-message.html", errors.New("permission denied"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("permission denied")))
 		return
 	}
 
@@ -415,7 +572,7 @@ func (c *ProjectsController) launch(w http.ResponseWriter, r *http.Request) {
 		project.Error = ""
 		models.Projects.Update(project)
 
-		if _, err := hosting.BuildProject(project); err != nil {
+		if _, err := hosting.BuildProject(tracing.Detach(r.Context()), project); err != nil {
 			project.Status = "draft"
 			project.Error = err.Error()
 			models.Projects.Update(project)
@@ -435,23 +592,23 @@ func (c *ProjectsController) enableDatabase(w http.ResponseWriter, r *http.Reque
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	project, err := models.Projects.Get(r.PathValue("project"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("project not found"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("project not found")))
 		return
 	}
 
 	if project.OwnerID != user.ID && !user.IsAdmin {
-		c.Render(w, r, "error-message.html", errors.New("permission denied"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("permission denied")))
 		return
 	}
 
 	if project.DatabaseEnabled {
-		c.Render(w, r, "error-message.html", errors.New("database already enabled"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("database already enabled")))
 		return
 	}
 
@@ -463,7 +620,7 @@ func (c *ProjectsController) enableDatabase(w http.ResponseWriter, r *http.Reque
 		project.Error = ""
 		models.Projects.Update(project)
 
-		if _, err := hosting.BuildProject(project); err != nil {
+		if _, err := hosting.BuildProject(tracing.Detach(r.Context()), project); err != nil {
 			project.Error = err.Error()
 			models.Projects.Update(project)
 			return
@@ -474,72 +631,38 @@ func (c *ProjectsController) enableDatabase(w http.ResponseWriter, r *http.Reque
 	c.Refresh(w, r)
 }
 
-func (c *ProjectsController) toggleStar(w http.ResponseWriter, r *http.Request) {
-	auth := c.Use("auth").(*AuthController)
-	user, _, err := auth.Authenticate(r)
-	if err != nil {
-		c.Render(w, r, "error-message.html", err)
-		return
-	}
-
-	project, err := models.Projects.Get(r.PathValue("project"))
-	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("project not found"))
-		return
-	}
-
-	// Check if already starred
-	star, _ := models.Stars.First("WHERE UserID = ? AND ProjectID = ?", user.ID, project.ID)
-	if star != nil {
-		// Unstar
-		if err := models.Stars.Delete(star); err != nil {
-			c.Render(w, r, "error-message.html", err)
-			return
-		}
-	} else {
-		// Star
-		if _, err := models.Stars.Insert(&models.Star{
-			UserID:    user.ID,
-			ProjectID: project.ID,
-		}); err != nil {
-			c.Render(w, r, "error-message.html", err)
-			return
-		}
-	}
-
-	c.Refresh(w, r)
-}
-
 func (c *ProjectsController) shareProject(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	project, err := models.Projects.Get(r.PathValue("project"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	content := r.FormValue("content")
 	if len(content) > MaxContentLength {
-		c.Render(w, r, "error-message.html", errors.New("content too long"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("content too long")))
 		return
 	}
 
-	if _, err = models.Activities.Insert(&models.Activity{
+	post, err := models.Activities.Insert(&models.Activity{
 		UserID:      user.ID,
 		Action:      "posted",
 		SubjectType: "project",
 		SubjectID:   project.ID,
 		Content:     content,
-	}); err != nil {
-		c.Render(w, r, "error-message.html", err)
+	})
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
+	models.TagActivity(post)
 
 	c.Redirect(w, r, "/")
 }
@@ -548,19 +671,20 @@ func (c *ProjectsController) promoteProject(w http.ResponseWriter, r *http.Reque
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	project, err := models.Projects.Get(r.PathValue("project"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	content := r.FormValue("content")
-	if _, err := social.CreatePromotion(user.ID, social.WrapProject(project), content); err != nil {
-		c.Render(w, r, "error-message.html", err)
+	excludeFollowers := r.FormValue("exclude_followers") == "on"
+	if _, err := social.CreatePromotion(user.ID, social.WrapProject(project), content, r.FormValue("tags"), excludeFollowers); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -571,18 +695,18 @@ func (c *ProjectsController) cancelPromotion(w http.ResponseWriter, r *http.Requ
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	project, err := models.Projects.Get(r.PathValue("project"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
-	if err := social.CancelPromotion(user.ID, social.WrapProject(project)); err != nil {
-		c.Render(w, r, "error-message.html", err)
+	if _, err := social.CancelPromotion(user.ID, social.WrapProject(project)); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -593,34 +717,309 @@ func (c *ProjectsController) shutdown(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	project, err := models.Projects.Get(r.PathValue("project"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("project not found"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("project not found")))
 		return
 	}
 
 	if project.OwnerID != user.ID && !user.IsAdmin {
-		c.Render(w, r, "error-message.html", errors.New("permission denied"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("permission denied")))
 		return
 	}
 
 	project.Status = "shutdown"
 	if err = models.Projects.Update(project); err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
+	auth.audit(r, user.ID, models.AuditProjectShutdown, "project", project.ID, "")
 
 	c.Redirect(w, r, "/profile")
 }
 
+// maxDeployTokens bounds how many deploy tokens a project can have
+const maxDeployTokens = 10
+
+func (c *ProjectsController) createDeployToken(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	project, err := models.Projects.Get(r.PathValue("project"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("project not found")))
+		return
+	}
+
+	if project.OwnerID != user.ID && !user.IsAdmin {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("permission denied")))
+		return
+	}
+
+	if models.DeployTokens.Count("WHERE ProjectID = ?", project.ID) >= maxDeployTokens {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("projects can have up to 10 deploy tokens")))
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("name is required")))
+		return
+	}
+
+	record, token, err := models.CreateDeployToken(project.ID, user.ID, name)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	// The token is only shown this once, so render it instead of refreshing
+	c.Render(w, r, "project-deploy-token.html", map[string]any{
+		"Project": project,
+		"Record":  record,
+		"Token":   token,
+	})
+}
+
+func (c *ProjectsController) deleteDeployToken(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	project, err := models.Projects.Get(r.PathValue("project"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("project not found")))
+		return
+	}
+
+	if project.OwnerID != user.ID && !user.IsAdmin {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("permission denied")))
+		return
+	}
+
+	token, err := models.DeployTokens.Get(r.PathValue("token"))
+	if err != nil || token.ProjectID != project.ID {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("deploy token not found")))
+		return
+	}
+
+	if err = models.DeployTokens.Delete(token); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+// rotateServiceToken replaces the project's service token, for when it
+// leaked
+func (c *ProjectsController) rotateServiceToken(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	project, err := models.Projects.Get(r.PathValue("project"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("project not found")))
+		return
+	}
+
+	if project.OwnerID != user.ID && !user.IsAdmin {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("permission denied")))
+		return
+	}
+
+	if err = project.RotateServiceToken(); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+	auth.audit(r, user.ID, models.AuditServiceTokenRotated, "project", project.ID, "")
+
+	c.Refresh(w, r)
+}
+
+// releaseNoteCommits bounds the history release notes are drafted from
+const releaseNoteCommits = 100
+
+// draftReleaseNotes summarizes the commits since a ref, defaulting to the
+// latest tag, as release notes the owner can copy and edit
+func (c *ProjectsController) draftReleaseNotes(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	project, err := models.Projects.Get(r.PathValue("project"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("project not found")))
+		return
+	}
+
+	if project.OwnerID != user.ID && !user.IsAdmin {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("permission denied")))
+		return
+	}
+
+	if !wantsSummaries(user.ID) {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("turn on AI summaries in your settings first")))
+		return
+	}
+
+	since := strings.TrimSpace(r.FormValue("since"))
+	if since == "" {
+		stdout, _, err := project.Git("describe", "--tags", "--abbrev=0", "HEAD")
+		if err == nil {
+			since = strings.TrimSpace(stdout.String())
+		}
+	} else if strings.HasPrefix(since, "-") || headCommit(project.Git("rev-parse", "--verify", "--quiet", since+"^{commit}")) == "" {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("unknown tag, branch or commit")))
+		return
+	}
+
+	args := []string{"log", "--no-merges", "--pretty=format:%B%x00", "-n", strconv.Itoa(releaseNoteCommits)}
+	if since != "" {
+		args = append(args, since+"..HEAD")
+	}
+	stdout, _, err := project.Git(args...)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("project has no commits")))
+		return
+	}
+
+	commits := splitCommits(stdout.String())
+	if len(commits) == 0 {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("no new commits to summarize")))
+		return
+	}
+
+	notes, err := summaries.ReleaseNotes(r.Context(), commits)
+	if err != nil {
+		slog.Error("failed to draft release notes", "project_id", project.ID, "error", err)
+		c.Render(w, r, "error-message.html", localize(r, errors.New("couldn't draft release notes, try again later")))
+		return
+	}
+
+	c.Render(w, r, "project-release-notes.html", map[string]any{
+		"Since":   since,
+		"Commits": len(commits),
+		"Notes":   notes,
+	})
+}
+
+func (c *ProjectsController) updateAnalytics(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	project, err := models.Projects.Get(r.PathValue("project"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("project not found")))
+		return
+	}
+
+	if project.OwnerID != user.ID && !user.IsAdmin {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("permission denied")))
+		return
+	}
+
+	project.AnalyticsEnabled = r.FormValue("analytics") == "on"
+	if err = models.Projects.Update(project); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+	analytics.Forget(project.ID)
+
+	c.Refresh(w, r)
+}
+
+// updateProtection saves the limits and WAF rules the proxy applies to
+// the project
+func (c *ProjectsController) updateProtection(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	project, err := models.Projects.Get(r.PathValue("project"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("project not found")))
+		return
+	}
+
+	if project.OwnerID != user.ID && !user.IsAdmin {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("permission denied")))
+		return
+	}
+
+	if err = saveProxyRules(r, project.ID); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+// ImageScanning reports whether built images are scanned for
+// vulnerabilities, so projects can block deploys on them
+func (c *ProjectsController) ImageScanning() bool {
+	return imagescan.Enabled()
+}
+
+// updateBlockVulnerable turns blocking deploys with critical
+// vulnerabilities on or off
+func (c *ProjectsController) updateBlockVulnerable(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	project, err := models.Projects.Get(r.PathValue("project"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("project not found")))
+		return
+	}
+
+	if project.OwnerID != user.ID && !user.IsAdmin {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("permission denied")))
+		return
+	}
+
+	project.BlockVulnerable = r.FormValue("block") == "on"
+	if err = models.Projects.Update(project); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
 func (c *ProjectsController) pollVersions(w http.ResponseWriter, r *http.Request) {
 	project, err := models.Projects.Get(r.PathValue("project"))
 	if err != nil {
-		c.RenderError(w, r, errors.New("project not found"))
+		c.RenderError(w, r, localize(r, errors.New("project not found")))
 		return
 	}
 
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"www.theskyscape.com/models"
+)
+
+func Promotions() (string, *PromotionsController) {
+	return "promotions", &PromotionsController{}
+}
+
+// PromotionsController tracks clicks on promoted content and reports how
+// promotions performed to the people who bought them
+type PromotionsController struct {
+	application.Controller
+}
+
+func (c *PromotionsController) Setup(app *application.App) {
+	c.Controller.Setup(app)
+	auth := c.Use("auth").(*AuthController)
+
+	route("GET /promotions", noindex(c.Serve("promotions.html", auth.Required)))
+	route("GET /promotions/{promotion}", noindex(c.Serve("promotion.html", auth.Required)))
+	route("GET /promotions/{promotion}/visit", noindex(c.ProtectFunc(c.visit, auth.Optional)))
+}
+
+func (c PromotionsController) Handle(r *http.Request) application.Handler {
+	c.Request = r
+	return &c
+}
+
+// MyPromotions returns the current user's promotions with how each is doing
+func (c *PromotionsController) MyPromotions() []*models.PromotionReport {
+	auth := c.Use("auth").(*AuthController)
+	user := auth.CurrentUser()
+	if user == nil {
+		return nil
+	}
+
+	var reports []*models.PromotionReport
+	for _, promo := range models.PromotionsBy(user.ID) {
+		reports = append(reports, promo.Report())
+	}
+	return reports
+}
+
+// CurrentReport returns the report for the promotion in the path, if the
+// current user bought it
+func (c *PromotionsController) CurrentReport() *models.PromotionReport {
+	auth := c.Use("auth").(*AuthController)
+	user := auth.CurrentUser()
+	if user == nil {
+		return nil
+	}
+
+	promo, err := models.Promotions.Get(c.PathValue("promotion"))
+	if err != nil || promo.UserID != user.ID {
+		return nil
+	}
+	return promo.Report()
+}
+
+// visit records a click on a promotion and sends the visitor on to what
+// was promoted
+func (c *PromotionsController) visit(w http.ResponseWriter, r *http.Request) {
+	promo, err := models.Promotions.Get(r.PathValue("promotion"))
+	if err != nil {
+		c.Redirect(w, r, "/")
+		return
+	}
+
+	url := promo.URL()
+	if url == "" {
+		c.Redirect(w, r, "/")
+		return
+	}
+
+	auth := c.Use("auth").(*AuthController)
+	userID := ""
+	if user, _, err := auth.Authenticate(r); err == nil {
+		userID = user.ID
+	}
+
+	// The owner checking their own promotion isn't a click
+	if userID != promo.UserID {
+		models.RecordClick(promo.ID, userID)
+	}
+	c.Redirect(w, r, url)
+}
@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"www.theskyscape.com/internal/waf"
+	"www.theskyscape.com/models"
+)
+
+// saveProxyRules stores the proxy rules posted from a project or app's
+// manage page, after checking the proxy can use them
+func saveProxyRules(r *http.Request, siteID string) error {
+	rules := models.ProxyRulesFor(siteID)
+	rules.MaxBodyMB, _ = strconv.Atoi(strings.TrimSpace(r.FormValue("max_body_mb")))
+	rules.TimeoutSeconds, _ = strconv.Atoi(strings.TrimSpace(r.FormValue("timeout_seconds")))
+	rules.BlockedPaths = strings.TrimSpace(r.FormValue("blocked_paths"))
+	rules.AllowIPs = strings.TrimSpace(r.FormValue("allow_ips"))
+	rules.DenyIPs = strings.TrimSpace(r.FormValue("deny_ips"))
+	rules.WAF = r.FormValue("waf") == "on"
+
+	if _, err := waf.Compile(rules); err != nil {
+		return err
+	}
+	if err := rules.Save(); err != nil {
+		return err
+	}
+
+	waf.Forget(siteID)
+	return nil
+}
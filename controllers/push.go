@@ -2,8 +2,9 @@ package controllers
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/The-Skyscape/devtools/pkg/application"
 	"www.theskyscape.com/internal/push"
@@ -22,10 +23,13 @@ func (c *PushController) Setup(app *application.App) {
 	c.Controller.Setup(app)
 	auth := c.Use("auth").(*AuthController)
 
+	go push.Run(time.Minute)
+	go push.PruneDevices(24 * time.Hour)
+
 	// API endpoints for push subscription management
-	http.Handle("GET /api/push/vapid-key", c.ProtectFunc(c.getVAPIDKey, auth.Required))
-	http.Handle("POST /api/push/subscribe", c.ProtectFunc(c.subscribe, auth.Required))
-	http.Handle("DELETE /api/push/subscribe", c.ProtectFunc(c.unsubscribe, auth.Required))
+	route("GET /api/push/vapid-key", c.ProtectFunc(auth.apiSession(c.getVAPIDKey), auth.Required))
+	route("POST /api/push/subscribe", c.ProtectFunc(auth.apiSession(c.subscribe), auth.Required))
+	route("DELETE /api/push/subscribe", c.ProtectFunc(auth.apiSession(c.unsubscribe), auth.Required))
 }
 
 func (c PushController) Handle(r *http.Request) application.Handler {
@@ -35,15 +39,13 @@ func (c PushController) Handle(r *http.Request) application.Handler {
 
 // getVAPIDKey returns the public VAPID key for client-side subscription
 func (c *PushController) getVAPIDKey(w http.ResponseWriter, r *http.Request) {
-	log.Println("[Push] VAPID key requested")
 	publicKey := push.GetPublicKey()
 	if publicKey == "" {
-		log.Println("[Push] VAPID public key not configured")
+		slog.WarnContext(r.Context(), "VAPID public key not configured")
 		JSONError(w, http.StatusServiceUnavailable, "push notifications not configured")
 		return
 	}
 
-	log.Printf("[Push] Returning VAPID public key: %s...", publicKey[:20])
 	JSONSuccess(w, map[string]string{
 		"publicKey": publicKey,
 	})
@@ -51,8 +53,9 @@ func (c *PushController) getVAPIDKey(w http.ResponseWriter, r *http.Request) {
 
 // SubscriptionRequest represents the push subscription from the browser
 type SubscriptionRequest struct {
-	Endpoint string `json:"endpoint"`
-	Keys     struct {
+	Endpoint       string `json:"endpoint"`
+	ExpirationTime *int64 `json:"expirationTime"` // Unix milliseconds, usually null
+	Keys           struct {
 		P256dh string `json:"p256dh"`
 		Auth   string `json:"auth"`
 	} `json:"keys"`
@@ -60,30 +63,31 @@ type SubscriptionRequest struct {
 
 // subscribe saves a push subscription for the authenticated user
 func (c *PushController) subscribe(w http.ResponseWriter, r *http.Request) {
-	log.Println("[Push] Subscribe request received")
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		log.Printf("[Push] Subscribe auth failed: %v", err)
+		slog.WarnContext(r.Context(), "push subscribe auth failed", "error", err)
 		JSONError(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
-	log.Printf("[Push] Subscribe for user: %s", user.ID)
 
 	var req SubscriptionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("[Push] Subscribe JSON decode failed: %v", err)
+		slog.WarnContext(r.Context(), "push subscribe decode failed", "error", err)
 		JSONError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
 	if req.Endpoint == "" || req.Keys.P256dh == "" || req.Keys.Auth == "" {
-		log.Println("[Push] Subscribe missing data")
+		slog.WarnContext(r.Context(), "push subscribe missing data")
 		JSONError(w, http.StatusBadRequest, "missing subscription data")
 		return
 	}
-	log.Printf("[Push] Subscription endpoint: %s...", req.Endpoint[:min(80, len(req.Endpoint))])
-	log.Printf("[Push] Subscription keys - P256dh length: %d, Auth length: %d", len(req.Keys.P256dh), len(req.Keys.Auth))
+	slog.DebugContext(r.Context(), "push subscription received",
+		"endpoint", req.Endpoint[:min(80, len(req.Endpoint))],
+		"p256dh_length", len(req.Keys.P256dh),
+		"auth_length", len(req.Keys.Auth),
+	)
 
 	// Check if subscription already exists for this endpoint
 	existing, _ := models.PushSubscriptions.First(
@@ -91,31 +95,51 @@ func (c *PushController) subscribe(w http.ResponseWriter, r *http.Request) {
 		user.ID, req.Endpoint,
 	)
 
+	var expiresAt time.Time
+	if req.ExpirationTime != nil {
+		expiresAt = time.UnixMilli(*req.ExpirationTime)
+	}
+
+	// Browsers check in daily; one revoked from settings is told to unsubscribe
+	// instead of being recreated
+	if existing == nil && r.URL.Query().Has("checkin") {
+		JSONSuccess(w, map[string]string{
+			"status": "revoked",
+		})
+		return
+	}
+
 	if existing != nil {
-		// Update existing subscription
-		log.Printf("[Push] Updating existing subscription %s", existing.ID)
+		// Update existing subscription; browsers re-send it daily as a check-in
+		slog.DebugContext(r.Context(), "updating push subscription", "subscription_id", existing.ID)
 		existing.P256dh = req.Keys.P256dh
 		existing.Auth = req.Keys.Auth
+		existing.Label = push.DeviceLabel(r.UserAgent())
+		existing.LastUsedAt = time.Now()
+		existing.ExpiresAt = expiresAt
+		existing.Failures = 0
 		if err := models.PushSubscriptions.Update(existing); err != nil {
-			log.Printf("[Push] Update failed: %v", err)
+			slog.ErrorContext(r.Context(), "failed to update push subscription", "error", err)
 			JSONError(w, http.StatusInternalServerError, "failed to update subscription")
 			return
 		}
 	} else {
 		// Create new subscription
-		log.Println("[Push] Creating new subscription")
 		sub, err := models.PushSubscriptions.Insert(&models.PushSubscription{
-			UserID:   user.ID,
-			Endpoint: req.Endpoint,
-			P256dh:   req.Keys.P256dh,
-			Auth:     req.Keys.Auth,
+			UserID:     user.ID,
+			Endpoint:   req.Endpoint,
+			P256dh:     req.Keys.P256dh,
+			Auth:       req.Keys.Auth,
+			Label:      push.DeviceLabel(r.UserAgent()),
+			LastUsedAt: time.Now(),
+			ExpiresAt:  expiresAt,
 		})
 		if err != nil {
-			log.Printf("[Push] Insert failed: %v", err)
+			slog.ErrorContext(r.Context(), "failed to save push subscription", "error", err)
 			JSONError(w, http.StatusInternalServerError, "failed to save subscription")
 			return
 		}
-		log.Printf("[Push] Created subscription %s for user %s", sub.ID, user.ID)
+		slog.InfoContext(r.Context(), "created push subscription", "subscription_id", sub.ID)
 	}
 
 	JSONSuccess(w, map[string]string{
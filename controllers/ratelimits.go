@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"www.theskyscape.com/internal/ratelimit"
+)
+
+// Route rate limits. Sign in, sign up and two-factor codes keep their own
+// checks, since they only count failed attempts.
+var (
+	// Token exchanges come from app backends, so a busy app behind one IP
+	// still fits comfortably
+	tokenLimit = ratelimit.Limit{Action: "oauth-token", Max: 60, Window: 15 * time.Minute}
+
+	// Files, avatars and thought images, per user
+	uploadLimit = ratelimit.Limit{Action: "upload", Max: 60, Window: time.Hour}
+
+	// Direct messages, per user across all conversations
+	messageLimit = ratelimit.Limit{Action: "message", Max: 60, Window: 10 * time.Minute}
+
+	// Abuse reports, per user
+	reportLimit = ratelimit.Limit{Action: "report", Max: 20, Window: time.Hour}
+)
+
+// apiLimits are the hourly API limits for each token, by the scope the
+// route needs. Signed in pages calling /api with their session count as
+// "session", by user. Set API_RATE_LIMITS to override any of them, e.g.
+// "repo:read=2000,app:write=10".
+var apiLimits = map[string]int{
+	"user:read":      1000,
+	"repo:read":      1000,
+	"app:read":       1000,
+	"follow:read":    1000,
+	"post:read":      1000,
+	"repo:write":     100,
+	"post:write":     100,
+	"thought:write":  500, // Reads too, since drafts come with it
+	"message:write":  300, // Reads too, since conversations are private
+	"app:write":      30,
+	"project:deploy": 60,
+	"project:builds": 3600, // Build status, polled by CI while it waits
+	"service":        5000, // Project backends, by service token
+	"session":        3600,
+	"docs":           300, // The OpenAPI document, by IP
+}
+
+// verifiedAPIBoost multiplies the API limits of verified users
+const verifiedAPIBoost = 5
+
+var loadAPILimits = sync.OnceFunc(func() {
+	for _, pair := range strings.Split(os.Getenv("API_RATE_LIMITS"), ",") {
+		scope, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			apiLimits[scope] = n
+		} else {
+			slog.Warn("ignoring API rate limit", "scope", scope, "value", value)
+		}
+	}
+})
+
+// apiLimit returns the limit for API routes needing a scope, counted per
+// token. Every scope has its own count, so a burst of writes doesn't use
+// up an app's reads.
+func apiLimit(scope string) ratelimit.Limit {
+	loadAPILimits()
+	n, ok := apiLimits[scope]
+	if !ok {
+		n = apiLimits["user:read"]
+	}
+	return ratelimit.Limit{
+		Action:      "api:" + scope,
+		Max:         n,
+		VerifiedMax: n * verifiedAPIBoost,
+		Window:      time.Hour,
+		Key:         ratelimit.ByToken,
+	}
+}
+
+// apiSession limits a signed in page's calls to /api, counting by user
+// and answering with JSON like the rest of the API. Use it inside
+// ProtectFunc so the user is already authenticated.
+func (c *AuthController) apiSession(h http.HandlerFunc) http.HandlerFunc {
+	l := apiLimit("session")
+	l.Key = func(r *http.Request) string {
+		if user, _, err := c.Authenticate(r); err == nil {
+			return "user:" + user.ID
+		}
+		return ratelimit.ByIP(r)
+	}
+	return l.WrapFunc(h)
+}
+
+// limited applies a limit to a signed in web route, counting by user and
+// showing the error the way the route shows any other. Use it inside
+// ProtectFunc so the user is already authenticated.
+func (c *AuthController) limited(l ratelimit.Limit, h http.HandlerFunc) http.HandlerFunc {
+	l.Key = func(r *http.Request) string {
+		if user, _, err := c.Authenticate(r); err == nil {
+			return "user:" + user.ID
+		}
+		return ratelimit.ByIP(r)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !l.Allow(r) {
+			c.Render(w, r, "error-message.html", localize(r, ratelimit.ErrLimited))
+			return
+		}
+		h(w, r)
+	}
+}
@@ -20,8 +20,8 @@ func (c *ReactionsController) Setup(app *application.App) {
 	c.Controller.Setup(app)
 	auth := app.Use("auth").(*AuthController)
 
-	http.Handle("POST /post/{post}/react", c.ProtectFunc(c.react, auth.Required))
-	http.Handle("DELETE /post/{post}/react", c.ProtectFunc(c.unreact, auth.Required))
+	route("POST /post/{post}/react", c.ProtectFunc(c.react, auth.Required))
+	route("DELETE /post/{post}/react", c.ProtectFunc(c.unreact, auth.Required))
 }
 
 func (c ReactionsController) Handle(r *http.Request) application.Handler {
@@ -33,7 +33,7 @@ func (c *ReactionsController) react(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -41,20 +41,20 @@ func (c *ReactionsController) react(w http.ResponseWriter, r *http.Request) {
 	emoji := r.FormValue("emoji")
 
 	if activityID == "" || emoji == "" {
-		c.Render(w, r, "error-message.html", errors.New("missing required fields"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("missing required fields")))
 		return
 	}
 
 	// Validate emoji is a supported reaction
 	if !models.IsValidReaction(emoji) {
-		c.Render(w, r, "error-message.html", errors.New("invalid reaction type"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("invalid reaction type")))
 		return
 	}
 
-	// Check if activity exists
-	_, err = models.Activities.Get(activityID)
-	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("post not found"))
+	// Check if activity exists and the user can see it
+	activity, err := models.Activities.Get(activityID)
+	if err != nil || activity.IsDeleted() || !activity.VisibleTo(user.ID) {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("post not found")))
 		return
 	}
 
@@ -65,7 +65,7 @@ func (c *ReactionsController) react(w http.ResponseWriter, r *http.Request) {
 		// Update existing reaction
 		existing.Emoji = emoji
 		if err = models.Reactions.Update(existing); err != nil {
-			c.Render(w, r, "error-message.html", err)
+			c.Render(w, r, "error-message.html", localize(r, err))
 			return
 		}
 	} else {
@@ -76,13 +76,13 @@ func (c *ReactionsController) react(w http.ResponseWriter, r *http.Request) {
 			Emoji:      emoji,
 		})
 		if err != nil {
-			c.Render(w, r, "error-message.html", err)
+			c.Render(w, r, "error-message.html", localize(r, err))
 			return
 		}
 	}
 
 	// Return updated post partial
-	activity, _ := models.Activities.Get(activityID)
+	activity, _ = models.Activities.Get(activityID)
 	c.Render(w, r, "feed-post.html", activity)
 }
 
@@ -90,7 +90,7 @@ func (c *ReactionsController) unreact(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -99,12 +99,12 @@ func (c *ReactionsController) unreact(w http.ResponseWriter, r *http.Request) {
 	// Find and delete the user's reaction
 	reaction, err := models.Reactions.First("WHERE ActivityID = ? AND UserID = ?", activityID, user.ID)
 	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("reaction not found"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("reaction not found")))
 		return
 	}
 
 	if err = models.Reactions.Delete(reaction); err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/The-Skyscape/devtools/pkg/authentication"
 	"www.theskyscape.com/internal/hosting"
 	"www.theskyscape.com/models"
 )
@@ -25,13 +26,13 @@ func (c *ReposController) Setup(app *application.App) {
 	c.Controller.Setup(app)
 	auth := app.Use("auth").(*AuthController)
 
-	http.Handle("GET /repos", c.Serve("repos.html", auth.Optional))
-	http.Handle("GET /repo/{repo}", c.Serve("repo.html", auth.Optional))
-	http.Handle("GET /repo/{repo}/file/{path...}", c.Serve("file.html", auth.Optional))
-	http.Handle("POST /repos", c.ProtectFunc(c.createRepo, auth.Required))
-	http.Handle("PUT /repo/{repo}", c.ProtectFunc(c.updateRepo, auth.Required))
-	http.Handle("POST /repos/{repo}/share", c.ProtectFunc(c.shareRepo, auth.Required))
-	http.Handle("DELETE /repo/{repo}", c.ProtectFunc(c.deleteRepo, auth.Required))
+	route("GET /repos", cached(c.Serve("repos.html", auth.Optional)))
+	route("GET /repo/{repo}", cached(c.Serve("repo.html", auth.Optional)))
+	route("GET /repo/{repo}/file/{path...}", c.Serve("file.html", auth.Optional))
+	route("POST /repos", c.ProtectFunc(c.createRepo, auth.Required))
+	route("PUT /repo/{repo}", c.ProtectFunc(c.updateRepo, auth.Required))
+	route("POST /repos/{repo}/share", c.ProtectFunc(c.shareRepo, auth.Required))
+	route("DELETE /repo/{repo}", c.ProtectFunc(c.deleteRepo, auth.Required))
 }
 
 func (c ReposController) Handle(r *http.Request) application.Handler {
@@ -54,6 +55,7 @@ func (c *ReposController) AllRepos() []*models.Repo {
 	  INNER JOIN users on users.ID = repos.OwnerID
 		WHERE
 			repos.Archived = false
+			AND repos.OwnerID NOT IN (SELECT UserID FROM profiles WHERE Suspended = true)
 			AND (
 				repos.Name        LIKE $1 OR
 				repos.Description LIKE $1 OR
@@ -70,12 +72,13 @@ func (c *ReposController) RecentRepos() []*models.Repo {
 	  INNER JOIN users on users.ID = repos.OwnerID
 		WHERE
 			repos.Archived = false
+			AND repos.OwnerID NOT IN (SELECT UserID FROM profiles WHERE Suspended = true)
 			AND (
 				repos.Name        LIKE $1 OR
 				repos.Description LIKE $1 OR
 				users.Handle      LIKE LOWER($1)
 			)
-		ORDER BY (SELECT COUNT(*) FROM stars WHERE RepoID = repos.ID) DESC
+		ORDER BY repos.StarTotal DESC
 		LIMIT 3
 	`, "%"+query+"%")
 	return repos
@@ -165,48 +168,52 @@ func (c *ReposController) createRepo(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("unauthorized"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("unauthorized")))
 		return
 	}
 
-	name := strings.TrimSpace(r.FormValue("name"))
-	desc := strings.TrimSpace(r.FormValue("description"))
+	repo, err := createUserRepo(user, r.FormValue("name"), r.FormValue("description"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Redirect(w, r, "/repo/"+repo.ID)
+}
 
+// createUserRepo creates a repo and its git repository for a user, shared by
+// the web form and the API
+func createUserRepo(user *authentication.User, name, desc string) (*models.Repo, error) {
+	name, desc = strings.TrimSpace(name), strings.TrimSpace(desc)
 	if name == "" {
-		c.Render(w, r, "error-message.html", errors.New("name is required"))
-		return
+		return nil, errors.New("name is required")
 	}
 
 	// Sanitize ID
 	id, err := hosting.SanitizeID(name)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
-		return
+		return nil, err
 	}
 
 	// Check if repo already exists
 	if _, err := models.Repos.Get(id); err == nil {
-		c.Render(w, r, "error-message.html", errors.New("a repo with this ID already exists"))
-		return
+		return nil, errors.New("a repo with this ID already exists")
 	}
 
 	// Check if git repo path exists
 	if hosting.RepoExists(id) {
-		c.Render(w, r, "error-message.html", errors.New("repo directory already exists"))
-		return
+		return nil, errors.New("repo directory already exists")
 	}
 
 	// Initialize git repo
 	if err := hosting.InitGitRepo(id); err != nil {
-		c.Render(w, r, "error-message.html", err)
-		return
+		return nil, err
 	}
 
 	// Create repo record
 	repo, err := models.NewRepo(id, user.ID, name, desc)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
-		return
+		return nil, err
 	}
 
 	// Create activity
@@ -216,26 +223,25 @@ func (c *ReposController) createRepo(w http.ResponseWriter, r *http.Request) {
 		SubjectType: "repo",
 		SubjectID:   repo.ID,
 	})
-
-	c.Redirect(w, r, "/repo/"+repo.ID)
+	return repo, nil
 }
 
 func (c *ReposController) updateRepo(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	repo, err := models.Repos.Get(r.PathValue("repo"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	if repo.OwnerID != user.ID {
-		c.Render(w, r, "error-message.html", errors.New("you are not the owner"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("you are not the owner")))
 		return
 	}
 
@@ -243,12 +249,17 @@ func (c *ReposController) updateRepo(w http.ResponseWriter, r *http.Request) {
 	description := strings.TrimSpace(r.FormValue("description"))
 
 	if name == "" {
-		c.Render(w, r, "error-message.html", errors.New("repo name is required"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("repo name is required")))
 		return
 	}
 
 	if description == "" {
-		c.Render(w, r, "error-message.html", errors.New("description is required"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("description is required")))
+		return
+	}
+
+	if err = claimEdit(w, r, repo); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -256,7 +267,7 @@ func (c *ReposController) updateRepo(w http.ResponseWriter, r *http.Request) {
 	repo.Description = description
 
 	if err = models.Repos.Update(repo); err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -267,24 +278,24 @@ func (c *ReposController) deleteRepo(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	repo, err := models.Repos.Get(r.PathValue("repo"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	if repo.OwnerID != user.ID {
-		c.Render(w, r, "error-message.html", errors.New("you are not the owner"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("you are not the owner")))
 		return
 	}
 
 	repo.Archived = true
 	if err = models.Repos.Update(repo); err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -295,37 +306,39 @@ func (c *ReposController) shareRepo(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	repo, err := models.Repos.Get(r.PathValue("repo"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	if repo.OwnerID != user.ID {
-		c.Render(w, r, "error-message.html", errors.New("you can only share your own repos"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("you can only share your own repos")))
 		return
 	}
 
 	content := r.FormValue("content")
 	if len(content) > MaxContentLength {
-		c.Render(w, r, "error-message.html", errors.New("content too long"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("content too long")))
 		return
 	}
 
-	if _, err = models.Activities.Insert(&models.Activity{
+	post, err := models.Activities.Insert(&models.Activity{
 		UserID:      user.ID,
 		Action:      "posted",
 		SubjectType: "repo",
 		SubjectID:   repo.ID,
 		Content:     content,
-	}); err != nil {
-		c.Render(w, r, "error-message.html", err)
+	})
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
+	models.TagActivity(post)
 
 	c.Redirect(w, r, "/")
 }
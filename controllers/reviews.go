@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"www.theskyscape.com/internal/push"
+	"www.theskyscape.com/models"
+)
+
+// Reviews returns the current app's visible reviews, newest first
+func (c *AppsController) Reviews() []*models.AppReview {
+	app := c.CurrentApp()
+	if app == nil {
+		return nil
+	}
+	return app.Reviews(50)
+}
+
+// MyReview returns the signed in user's review of the current app
+func (c *AppsController) MyReview() *models.AppReview {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(c.Request)
+	if err != nil {
+		return nil
+	}
+	if app := c.CurrentApp(); app != nil {
+		return app.ReviewBy(user.ID)
+	}
+	return nil
+}
+
+// CanReview reports whether the signed in user has used the current app,
+// which they need to have done to review it
+func (c *AppsController) CanReview() bool {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(c.Request)
+	if err != nil {
+		return false
+	}
+	app := c.CurrentApp()
+	return app != nil && app.IsAuthorizedBy(user.ID)
+}
+
+// ReportedReviews returns reviews waiting on an admin, for /admin/reviews
+func (c *AppsController) ReportedReviews() []*models.AppReview {
+	return models.ReportedReviews()
+}
+
+// review rates the app, or updates the user's earlier rating
+func (c *AppsController) review(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	app, err := models.Apps.Get(r.PathValue("app"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("app not found")))
+		return
+	}
+
+	repo := app.Repo()
+	if repo != nil && repo.OwnerID == user.ID {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("you cannot review your own app")))
+		return
+	}
+
+	rating, _ := strconv.Atoi(r.FormValue("rating"))
+	isNew := app.ReviewBy(user.ID) == nil
+	if _, err = app.Review(user.ID, rating, strings.TrimSpace(r.FormValue("body"))); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	if isNew && repo != nil {
+		go push.SendNotification(repo.OwnerID, user.ID, models.NotifyComment,
+			"New review from @"+user.Handle,
+			app.Name+" was rated "+strconv.Itoa(rating)+"/5",
+			"/app/"+app.ID)
+	}
+
+	c.Refresh(w, r)
+}
+
+// deleteReview removes the user's own review
+func (c *AppsController) deleteReview(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	app, err := models.Apps.Get(r.PathValue("app"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("app not found")))
+		return
+	}
+
+	review := app.ReviewBy(user.ID)
+	if review == nil {
+		c.Render(w, r, "error-message.html", localize(r, application.ErrNotFound))
+		return
+	}
+
+	if err = models.AppReviews.Delete(review); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+// currentReview returns the review in the path if it belongs to the app
+func (c *AppsController) currentReview(r *http.Request) (*models.App, *models.AppReview, error) {
+	app, err := models.Apps.Get(r.PathValue("app"))
+	if err != nil {
+		return nil, nil, errors.New("app not found")
+	}
+	review, err := models.AppReviews.Get(r.PathValue("review"))
+	if err != nil || review.AppID != app.ID {
+		return nil, nil, application.ErrNotFound
+	}
+	return app, review, nil
+}
+
+// respondReview sets the owner's public reply to a review
+func (c *AppsController) respondReview(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	app, review, err := c.currentReview(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	if repo := app.Repo(); repo == nil || repo.OwnerID != user.ID {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("permission denied")))
+		return
+	}
+
+	response := strings.TrimSpace(r.FormValue("response"))
+	if response == "" {
+		// The reply menu collects it with hx-prompt
+		response = strings.TrimSpace(r.Header.Get("HX-Prompt"))
+	}
+	if err = review.Respond(response); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	if response != "" {
+		go push.SendNotification(review.UserID, user.ID, models.NotifyComment,
+			"@"+user.Handle+" responded to your review",
+			truncateMessage(response, 100),
+			"/app/"+app.ID)
+	}
+
+	c.Refresh(w, r)
+}
+
+// reportReview flags a review as abusive for admins to look at
+func (c *AppsController) reportReview(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	_, review, err := c.currentReview(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if reason == "" {
+		reason = strings.TrimSpace(r.Header.Get("HX-Prompt"))
+	}
+	if len(reason) > 500 {
+		reason = reason[:500]
+	}
+
+	if err = review.Report(user.ID, reason); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+// moderateReview hides a reported review or keeps it up
+func (c *AppsController) moderateReview(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	admin, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	review, err := models.AppReviews.Get(r.PathValue("review"))
+	if err != nil {
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
+		return
+	}
+
+	hidden := r.FormValue("action") == "hide"
+	if err = review.Moderate(hidden); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	decision := "kept"
+	if hidden {
+		decision = "hidden"
+	}
+	slog.InfoContext(r.Context(), "admin moderated review", "admin", admin.Handle, "review_id", review.ID, "decision", decision)
+	auth.audit(r, admin.ID, models.AuditReviewModerated, "user", review.UserID, decision)
+	c.Refresh(w, r)
+}
@@ -0,0 +1,280 @@
+package controllers
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"www.theskyscape.com/models"
+)
+
+func Search() (string, *SearchController) {
+	return "search", &SearchController{
+		defaultPage:  1,
+		defaultLimit: 20,
+	}
+}
+
+type SearchController struct {
+	application.Controller
+	defaultPage  int
+	defaultLimit int
+}
+
+// searchPreviewLimit is how many results of each kind show on the "All" tab
+const searchPreviewLimit = 4
+
+// suggestLimit is how many results of each kind the typeahead shows
+const suggestLimit = 3
+
+func (c *SearchController) Setup(app *application.App) {
+	c.Controller.Setup(app)
+	auth := c.Use("auth").(*AuthController)
+
+	go func() {
+		if err := models.SetupSearch(); err != nil {
+			slog.Error("failed to set up search index", "error", err)
+		}
+	}()
+
+	route("GET /search", c.Serve("search.html", auth.Optional))
+	route("GET /search/suggest", noindex(cached(http.HandlerFunc(c.suggest))))
+	route("GET /search/palette", noindex(c.ProtectFunc(c.palette, auth.Required)))
+}
+
+func (c SearchController) Handle(r *http.Request) application.Handler {
+	c.Request = r
+	return &c
+}
+
+// Query returns the raw search terms
+func (c *SearchController) Query() string {
+	return strings.TrimSpace(c.URL.Query().Get("q"))
+}
+
+// Type returns the kind filter, or "" to search everything
+func (c *SearchController) Type() string {
+	kind := c.URL.Query().Get("type")
+	if !slices.Contains(models.SearchKinds, kind) {
+		return ""
+	}
+	return kind
+}
+
+func (c *SearchController) Page() int {
+	return ParsePage(c.URL.Query(), c.defaultPage)
+}
+
+func (c *SearchController) Limit() int {
+	if c.Type() == "" {
+		return searchPreviewLimit
+	}
+	return ParseLimit(c.URL.Query(), c.defaultLimit)
+}
+
+func (c *SearchController) NextPage() int {
+	return c.Page() + 1
+}
+
+// SearchTab is a type filter with its number of matches
+type SearchTab struct {
+	Kind  string
+	Label string
+	Count int
+}
+
+var searchLabels = map[string]string{
+	models.SearchUser:    "Users",
+	models.SearchProject: "Projects",
+	models.SearchRepo:    "Repos",
+	models.SearchApp:     "Apps",
+	models.SearchThought: "Thoughts",
+	models.SearchPost:    "Posts",
+}
+
+// Tabs returns every type filter with its match count
+func (c *SearchController) Tabs() []SearchTab {
+	match := models.SearchMatch(c.Query())
+	if match == "" {
+		return nil
+	}
+
+	tabs := make([]SearchTab, 0, len(models.SearchKinds))
+	for _, kind := range models.SearchKinds {
+		tabs = append(tabs, SearchTab{
+			Kind:  kind,
+			Label: searchLabels[kind],
+			Count: models.SearchCount(kind, match),
+		})
+	}
+	return tabs
+}
+
+// Total returns the number of matches across every kind
+func (c *SearchController) Total() int {
+	total := 0
+	for _, tab := range c.Tabs() {
+		total += tab.Count
+	}
+	return total
+}
+
+// includes reports whether results of a kind should be shown, returning
+// the FTS query and paging to load them with
+func (c *SearchController) includes(kind string) (match string, limit, offset int, ok bool) {
+	match = models.SearchMatch(c.Query())
+	if match == "" {
+		return "", 0, 0, false
+	}
+
+	switch c.Type() {
+	case "":
+		return match, searchPreviewLimit, 0, true
+	case kind:
+		limit = c.Limit()
+		return match, limit, (c.Page() - 1) * limit, true
+	}
+	return "", 0, 0, false
+}
+
+func (c *SearchController) Users() []*models.Profile {
+	if match, limit, offset, ok := c.includes(models.SearchUser); ok {
+		return models.SearchProfiles(match, limit, offset)
+	}
+	return nil
+}
+
+func (c *SearchController) Projects() []*models.Project {
+	if match, limit, offset, ok := c.includes(models.SearchProject); ok {
+		return models.SearchProjects(match, limit, offset)
+	}
+	return nil
+}
+
+func (c *SearchController) Repos() []*models.Repo {
+	if match, limit, offset, ok := c.includes(models.SearchRepo); ok {
+		return models.SearchRepos(match, limit, offset)
+	}
+	return nil
+}
+
+func (c *SearchController) Apps() []*models.App {
+	if match, limit, offset, ok := c.includes(models.SearchApp); ok {
+		return models.SearchApps(match, limit, offset)
+	}
+	return nil
+}
+
+func (c *SearchController) Thoughts() []*models.Thought {
+	if match, limit, offset, ok := c.includes(models.SearchThought); ok {
+		return models.SearchThoughts(match, limit, offset)
+	}
+	return nil
+}
+
+func (c *SearchController) Posts() []*models.Activity {
+	if match, limit, offset, ok := c.includes(models.SearchPost); ok {
+		posts := models.SearchPosts(match, limit, offset)
+		models.PreloadActivities(c.Request.Context(), posts)
+		return posts
+	}
+	return nil
+}
+
+// suggest renders typeahead results for the navbar search box, matching
+// names and handles by prefix
+func (c *SearchController) suggest(w http.ResponseWriter, r *http.Request) {
+	match := models.SuggestMatch(r.URL.Query().Get("q"))
+	if match == "" {
+		return // Nothing typed yet, so clear the dropdown
+	}
+
+	c.Render(w, r, "search-suggest.html", map[string]any{
+		"Query":    strings.TrimSpace(r.URL.Query().Get("q")),
+		"Users":    models.SearchProfiles(match, suggestLimit, 0),
+		"Projects": models.SearchProjects(match, suggestLimit, 0),
+		"Repos":    models.SearchRepos(match, suggestLimit, 0),
+	})
+}
+
+// PaletteItem is one entry in the command palette. Items either link to a
+// URL or open one of the layout's modals by its element ID.
+type PaletteItem struct {
+	Kind     string `json:"kind"`
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Modal    string `json:"modal,omitempty"`
+}
+
+// paletteActions are the shortcuts every signed-in user gets
+var paletteActions = []PaletteItem{
+	{Kind: "action", Title: "New project", Modal: "create_project_modal"},
+	{Kind: "action", Title: "New repo", Modal: "create_repo_modal"},
+	{Kind: "action", Title: "New thought", Modal: "create_thought_modal"},
+	{Kind: "action", Title: "Home", URL: "/"},
+	{Kind: "action", Title: "Profile", URL: "/profile"},
+	{Kind: "action", Title: "Messages", URL: "/messages"},
+	{Kind: "action", Title: "Search", URL: "/search"},
+	{Kind: "action", Title: "Explore", URL: "/explore"},
+	{Kind: "action", Title: "Settings", URL: "/settings"},
+}
+
+// paletteConversations bounds how many recent conversations are listed
+const paletteConversations = 10
+
+// palette returns everything a Cmd+K palette filters over in one payload,
+// so it can search client-side without a request per keystroke
+func (c *SearchController) palette(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		JSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	profile, err := models.Profiles.Get(user.ID)
+	if err != nil {
+		JSONError(w, http.StatusNotFound, "profile not found")
+		return
+	}
+
+	projects := []PaletteItem{}
+	for _, project := range profile.Projects() {
+		projects = append(projects, PaletteItem{Kind: "project", Title: project.Name, Subtitle: project.Status, URL: "/project/" + project.ID})
+	}
+
+	repos := []PaletteItem{}
+	for _, repo := range profile.Repos() {
+		repos = append(repos, PaletteItem{Kind: "repo", Title: repo.Name, URL: "/repo/" + repo.ID})
+	}
+
+	apps := []PaletteItem{}
+	for _, app := range profile.Apps() {
+		apps = append(apps, PaletteItem{Kind: "app", Title: app.Name, Subtitle: app.Status, URL: "/app/" + app.ID})
+	}
+
+	conversations := []PaletteItem{}
+	for _, other := range profile.MyConversations() {
+		if len(conversations) == paletteConversations {
+			break
+		}
+		conversations = append(conversations, PaletteItem{Kind: "conversation", Title: other.Name(), Subtitle: "@" + other.Handle(), URL: "/messages/" + other.Handle()})
+	}
+
+	actions := slices.Clone(paletteActions)
+	if user.IsAdmin {
+		actions = append(actions, PaletteItem{Kind: "action", Title: "Admin", URL: "/admin"})
+	}
+
+	w.Header().Set("Cache-Control", "private, no-store")
+	JSON(w, http.StatusOK, map[string]any{
+		"projects":      projects,
+		"repos":         repos,
+		"apps":          apps,
+		"conversations": conversations,
+		"actions":       actions,
+	})
+}
@@ -0,0 +1,496 @@
+package controllers
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/The-Skyscape/devtools/pkg/authentication"
+	"golang.org/x/crypto/bcrypt"
+	"www.theskyscape.com/internal/imaging"
+	"www.theskyscape.com/internal/sociallogin"
+	"www.theskyscape.com/models"
+)
+
+func Security() (string, *SecurityController) {
+	return "security", &SecurityController{}
+}
+
+// SecurityController manages the account security settings at
+// /settings/security: two-factor authentication, passkeys and sessions,
+// and the apps and projects with access to the account at
+// /settings/authorizations
+type SecurityController struct {
+	application.Controller
+}
+
+func (c *SecurityController) Setup(app *application.App) {
+	c.Controller.Setup(app)
+	auth := c.Use("auth").(*AuthController)
+
+	route("GET /settings/security", noindex(c.Serve("settings-security.html", auth.Required)))
+	route("POST /settings/security/2fa", c.ProtectFunc(c.startTwoFactor, auth.Required))
+	route("GET /settings/security/2fa/qr.svg", noindex(c.ProtectFunc(c.twoFactorQR, auth.Required)))
+	route("POST /settings/security/2fa/enable", c.ProtectFunc(c.enableTwoFactor, auth.Required))
+	route("POST /settings/security/2fa/recovery-codes", c.ProtectFunc(c.regenerateRecoveryCodes, auth.Required))
+	route("DELETE /settings/security/2fa", c.ProtectFunc(c.disableTwoFactor, auth.Required))
+	route("DELETE /settings/security/passkeys/{passkey}", c.ProtectFunc(c.deletePasskey, auth.Required))
+	route("POST /settings/security/ssh-keys", c.ProtectFunc(c.addSSHKey, auth.Required))
+	route("DELETE /settings/security/ssh-keys/{key}", c.ProtectFunc(c.deleteSSHKey, auth.Required))
+	route("DELETE /settings/security/social/{identity}", c.ProtectFunc(c.disconnectSocial, auth.Required))
+	route("GET /settings/authorizations", noindex(c.Serve("settings-authorizations.html", auth.Required)))
+	route("DELETE /settings/authorizations/{authorization}", c.ProtectFunc(c.revokeAuthorization, auth.Required))
+	route("POST /settings/authorizations/{authorization}/mute", c.ProtectFunc(c.muteAuthorization, auth.Required))
+}
+
+func (c SecurityController) Handle(r *http.Request) application.Handler {
+	c.Request = r
+	return &c
+}
+
+// TwoFactor returns the current user's 2FA enrollment, pending or enabled
+func (c *SecurityController) TwoFactor() *models.TwoFactorSecret {
+	auth := c.Use("auth").(*AuthController)
+	user := auth.CurrentUser()
+	if user == nil {
+		return nil
+	}
+	return models.TwoFactorFor(user.ID)
+}
+
+// TwoFactorURI returns the otpauth:// link for a pending enrollment, for
+// users who can't scan the QR code
+func (c *SecurityController) TwoFactorURI() string {
+	auth := c.Use("auth").(*AuthController)
+	user := auth.CurrentUser()
+	if user == nil {
+		return ""
+	}
+	secret := models.TwoFactorFor(user.ID)
+	if secret == nil || secret.Enabled {
+		return ""
+	}
+	return secret.URI(user.Handle)
+}
+
+// Passkeys returns the current user's passkeys. They're added through the
+// /_auth/passkeys endpoints on AuthController.
+func (c *SecurityController) Passkeys() []*models.WebAuthnCredential {
+	auth := c.Use("auth").(*AuthController)
+	user := auth.CurrentUser()
+	if user == nil {
+		return nil
+	}
+	return models.PasskeysOf(user.ID)
+}
+
+// SocialConnection is a sign in provider and the current user's account
+// there, if they connected one
+type SocialConnection struct {
+	Provider *sociallogin.Provider
+	Identity *models.SocialIdentity
+}
+
+// SocialConnections returns each configured provider with the account the
+// current user connected. Accounts are connected through /_auth/social on
+// AuthController.
+func (c *SecurityController) SocialConnections() []SocialConnection {
+	auth := c.Use("auth").(*AuthController)
+	user := auth.CurrentUser()
+	if user == nil {
+		return nil
+	}
+
+	identities := models.SocialIdentitiesOf(user.ID)
+	var connections []SocialConnection
+	for _, provider := range sociallogin.Providers() {
+		connection := SocialConnection{Provider: provider}
+		for _, identity := range identities {
+			if identity.Provider == provider.Name {
+				connection.Identity = identity
+			}
+		}
+		connections = append(connections, connection)
+	}
+	return connections
+}
+
+// SSHKeys returns the keys the current user can use for git over SSH
+func (c *SecurityController) SSHKeys() []*models.SSHKey {
+	auth := c.Use("auth").(*AuthController)
+	user := auth.CurrentUser()
+	if user == nil {
+		return nil
+	}
+	return models.SSHKeysOf(user.ID)
+}
+
+// SSHRemote returns the start of an SSH clone URL, or "" when git over SSH
+// isn't enabled
+func (c *SecurityController) SSHRemote() string {
+	_, port, err := net.SplitHostPort(os.Getenv("SSH_ADDR"))
+	if err != nil {
+		return ""
+	}
+	host := c.Request.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return "ssh://git@" + net.JoinHostPort(host, port)
+}
+
+// Sessions returns where the current user is signed in. They're revoked
+// through the /_auth/sessions endpoints on AuthController.
+func (c *SecurityController) Sessions() []*models.SessionDevice {
+	auth := c.Use("auth").(*AuthController)
+	user := auth.CurrentUser()
+	if user == nil {
+		return nil
+	}
+	return models.SessionsOf(user.ID)
+}
+
+// Authorizations returns the apps and projects the current user has given
+// access to their account
+func (c *SecurityController) Authorizations() []*models.OAuthAuthorization {
+	auth := c.Use("auth").(*AuthController)
+	user := auth.CurrentUser()
+	if user == nil {
+		return nil
+	}
+	return models.AuthorizationsOf(user.ID)
+}
+
+// ScopeDescription explains what an OAuth scope allows
+func (c *SecurityController) ScopeDescription(scope string) string {
+	return models.ScopeDescription(scope)
+}
+
+// CurrentSessionID returns the ID of this browser's session
+func (c *SecurityController) CurrentSessionID() string {
+	auth := c.Use("auth").(*AuthController)
+	if _, session, err := auth.Authenticate(c.Request); err == nil {
+		return session.ID
+	}
+	return ""
+}
+
+// startTwoFactor creates a fresh secret for the user to add to their app
+func (c *SecurityController) startTwoFactor(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	if _, err = models.StartTwoFactor(user.ID); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+// twoFactorQR renders the pending secret's otpauth:// link as a QR code.
+// The secret is only shown until 2FA is enabled.
+func (c *SecurityController) twoFactorQR(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	secret := models.TwoFactorFor(user.ID)
+	if secret == nil || secret.Enabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	svg, err := imaging.QRCode(secret.URI(user.Handle))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(svg))
+}
+
+// enableTwoFactor turns 2FA on once the user proves their app has the
+// secret, and shows their recovery codes
+func (c *SecurityController) enableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	secret := models.TwoFactorFor(user.ID)
+	if secret == nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("two-factor authentication is not set up")))
+		return
+	}
+	if secret.Enabled {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("two-factor authentication is already enabled")))
+		return
+	}
+
+	if err = c.checkAttempt(user); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+	if !secret.Verify(r.FormValue("code")) {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("invalid code")))
+		return
+	}
+	models.Reset(user.ID, "2fa")
+
+	codes, err := secret.Enable()
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+	auth.audit(r, user.ID, models.AuditTwoFactorEnabled, "user", user.ID, "")
+
+	c.Render(w, r, "recovery-codes.html", codes)
+}
+
+// regenerateRecoveryCodes replaces the user's recovery codes, after they
+// confirm their password
+func (c *SecurityController) regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	secret := models.TwoFactorFor(user.ID)
+	if secret == nil || !secret.Enabled {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("two-factor authentication is not enabled")))
+		return
+	}
+
+	if err = c.checkPassword(user, r.FormValue("password")); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	codes, err := secret.RegenerateRecoveryCodes()
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+	auth.audit(r, user.ID, models.AuditRecoveryCodesReset, "user", user.ID, "")
+
+	c.Render(w, r, "recovery-codes.html", codes)
+}
+
+// disableTwoFactor turns 2FA off, after the user confirms their password
+func (c *SecurityController) disableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	secret := models.TwoFactorFor(user.ID)
+	if secret == nil {
+		c.Refresh(w, r)
+		return
+	}
+
+	if secret.Enabled {
+		if err = c.checkPassword(user, r.FormValue("password")); err != nil {
+			c.Render(w, r, "error-message.html", localize(r, err))
+			return
+		}
+	}
+
+	if err = models.TwoFactorSecrets.Delete(secret); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	// Cancelling a setup that was never turned on isn't worth recording
+	if secret.Enabled {
+		auth.audit(r, user.ID, models.AuditTwoFactorDisabled, "user", user.ID, "")
+	}
+
+	c.Refresh(w, r)
+}
+
+// deletePasskey removes one of the user's passkeys. Their password still
+// works, so this can't lock them out.
+func (c *SecurityController) deletePasskey(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	passkey, err := models.WebAuthnCredentials.Get(r.PathValue("passkey"))
+	if err != nil || passkey.UserID != user.ID {
+		c.Render(w, r, "error-message.html", localize(r, application.ErrNotFound))
+		return
+	}
+
+	if err = models.WebAuthnCredentials.Delete(passkey); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+	auth.audit(r, user.ID, models.AuditPasskeyRemoved, "user", user.ID, passkey.Name)
+
+	c.Refresh(w, r)
+}
+
+// addSSHKey registers a public key for git over SSH
+func (c *SecurityController) addSSHKey(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	key, err := models.AddSSHKey(user.ID, r.FormValue("name"), r.FormValue("key"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+	auth.audit(r, user.ID, models.AuditSSHKeyAdded, "user", user.ID, key.Fingerprint)
+
+	c.Refresh(w, r)
+}
+
+// deleteSSHKey removes one of the user's SSH keys
+func (c *SecurityController) deleteSSHKey(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	key, err := models.SSHKeys.Get(r.PathValue("key"))
+	if err != nil || key.UserID != user.ID {
+		c.Render(w, r, "error-message.html", localize(r, application.ErrNotFound))
+		return
+	}
+
+	if err = models.SSHKeys.Delete(key); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+	auth.audit(r, user.ID, models.AuditSSHKeyRemoved, "user", user.ID, key.Fingerprint)
+
+	c.Refresh(w, r)
+}
+
+// disconnectSocial stops a GitHub or Google account signing the user in
+func (c *SecurityController) disconnectSocial(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	identity, err := models.SocialIdentities.Get(r.PathValue("identity"))
+	if err != nil || identity.UserID != user.ID {
+		c.Render(w, r, "error-message.html", localize(r, application.ErrNotFound))
+		return
+	}
+
+	if err = identity.Unlink(user); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+	auth.audit(r, user.ID, models.AuditSocialDisconnected, "user", user.ID, identity.Provider)
+
+	c.Refresh(w, r)
+}
+
+// revokeAuthorization takes away an app or project's access to the user's
+// account, invalidating the tokens it holds
+func (c *SecurityController) revokeAuthorization(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	authorization, err := models.OAuthAuthorizations.Get(r.PathValue("authorization"))
+	if err != nil || authorization.UserID != user.ID || authorization.Revoked {
+		c.Render(w, r, "error-message.html", localize(r, application.ErrNotFound))
+		return
+	}
+
+	if err = authorization.Revoke(); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+	auth.audit(r, user.ID, models.AuditAuthorizationRevoked, "user", user.ID, authorization.ClientID())
+
+	c.Refresh(w, r)
+}
+
+// muteAuthorization turns notifications from an authorized app on or off,
+// without revoking its access
+func (c *SecurityController) muteAuthorization(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	authorization, err := models.OAuthAuthorizations.Get(r.PathValue("authorization"))
+	if err != nil || authorization.UserID != user.ID || authorization.Revoked {
+		c.Render(w, r, "error-message.html", localize(r, application.ErrNotFound))
+		return
+	}
+
+	authorization.Muted = r.FormValue("muted") == "true"
+	if err = models.OAuthAuthorizations.Update(authorization); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+// checkAttempt limits code and password guesses on security settings, the
+// same way as the sign-in challenge
+func (c *SecurityController) checkAttempt(user *authentication.User) error {
+	allowed, _, err := models.Check(user.ID, "2fa", 5, 15*time.Minute)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return errors.New("Too many attempts. Please try again in 15 minutes.")
+	}
+	return models.Record(user.ID, "2fa", 15*time.Minute)
+}
+
+// checkPassword re-confirms the user's password before a sensitive change
+func (c *SecurityController) checkPassword(user *authentication.User, password string) error {
+	if err := c.checkAttempt(user); err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword(user.PassHash, []byte(password)) != nil {
+		return errors.New("incorrect password")
+	}
+	models.Reset(user.ID, "2fa")
+	return nil
+}
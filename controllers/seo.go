@@ -1,11 +1,27 @@
 package controllers
 
 import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"html/template"
+	"image"
+	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/The-Skyscape/devtools/pkg/application"
+	"www.theskyscape.com/internal/assets"
+	"www.theskyscape.com/internal/imaging"
+	"www.theskyscape.com/internal/sitemap"
+	"www.theskyscape.com/models"
 )
 
 // swVersion is set at startup and changes on each restart
@@ -23,11 +39,16 @@ func (c *SEOController) Setup(app *application.App) {
 	c.Controller.Setup(app)
 	auth := app.Use("auth").(*AuthController)
 
-	http.Handle("GET /robots.txt", app.Serve("robots.txt", auth.Optional))
-	http.Handle("GET /sitemap.xml", app.ProtectFunc(c.sitemap, auth.Optional))
-	http.Handle("GET /manifest.json", app.ProtectFunc(c.manifest, auth.Optional))
-	http.Handle("GET /sw.js", app.ProtectFunc(c.serviceWorker, auth.Optional))
-	http.Handle("GET /google3c5c81d2e70ab3e1.html", app.Serve("google.html", auth.Optional))
+	route("GET /robots.txt", http.HandlerFunc(c.robots))
+	route("GET /sitemap.xml", http.HandlerFunc(c.sitemapIndex))
+	route("GET /sitemaps/{page}", http.HandlerFunc(c.sitemap))
+	route("GET /manifest.json", app.ProtectFunc(c.manifest, auth.Optional))
+	route("GET /sw.js", app.ProtectFunc(c.serviceWorker, auth.Optional))
+	route("GET /google3c5c81d2e70ab3e1.html", app.Serve("google.html", auth.Optional))
+	route("GET /assets/{hash}/{path...}", assets.Handler())
+	route("GET /og/{type}/{file}", http.HandlerFunc(c.socialImage))
+
+	go sitemap.Refresh(time.Hour)
 }
 
 func (c SEOController) Handle(r *http.Request) application.Handler {
@@ -39,10 +60,153 @@ func (c *SEOController) Version() string {
 	return swVersion
 }
 
+// PersonSchema returns schema.org Person markup for a profile page
+func (c *SEOController) PersonSchema(p *models.Profile) template.HTML {
+	if p == nil {
+		return ""
+	}
+	schema := person(p)
+	schema["@context"] = "https://schema.org"
+	return jsonLD(schema)
+}
+
+// ArticleSchema returns schema.org Article markup for a thought page
+func (c *SEOController) ArticleSchema(t *models.Thought) template.HTML {
+	if t == nil || !t.Published || t.Takedown() != nil {
+		return ""
+	}
+	meta := t.Meta()
+	article := map[string]any{
+		"@context":         "https://schema.org",
+		"@type":            "Article",
+		"headline":         t.Title,
+		"description":      meta.Description,
+		"image":            meta.Image,
+		"url":              meta.URL,
+		"mainEntityOfPage": meta.URL,
+		"datePublished":    t.CreatedAt.Format(time.RFC3339),
+		"dateModified":     t.UpdatedAt.Format(time.RFC3339),
+	}
+	if p := t.Profile(); p != nil {
+		article["author"] = person(p)
+	}
+	return jsonLD(article)
+}
+
+// SourceCodeSchema returns schema.org SoftwareSourceCode markup for a repo page
+func (c *SEOController) SourceCodeSchema(r *models.Repo) template.HTML {
+	if r == nil || r.Takedown() != nil {
+		return ""
+	}
+	meta := r.Meta()
+	code := map[string]any{
+		"@context":       "https://schema.org",
+		"@type":          "SoftwareSourceCode",
+		"name":           r.Name,
+		"description":    meta.Description,
+		"url":            meta.URL,
+		"codeRepository": meta.URL,
+		"dateCreated":    r.CreatedAt.Format(time.RFC3339),
+		"dateModified":   r.UpdatedAt.Format(time.RFC3339),
+	}
+	if owner, err := models.Profiles.Get(r.OwnerID); err == nil {
+		code["author"] = person(owner)
+	}
+	return jsonLD(code)
+}
+
+func person(p *models.Profile) map[string]any {
+	meta := p.Meta()
+	return map[string]any{
+		"@type":         "Person",
+		"name":          p.Name(),
+		"alternateName": "@" + p.Handle(),
+		"description":   meta.Description,
+		"image":         meta.Image,
+		"url":           meta.URL,
+	}
+}
+
+// jsonLD renders structured data as a script tag. json.Marshal escapes <, >
+// and &, so user content can't close the tag early.
+func jsonLD(v any) template.HTML {
+	data, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("failed to encode structured data", "error", err)
+		return ""
+	}
+	return template.HTML(`<script type="application/ld+json">` + string(data) + `</script>`)
+}
+
+// robotsDisallow lists paths crawlers should skip: private pages, auth
+// flows, checkout and HTMX partial endpoints
+var robotsDisallow = []string{
+	"/profile",
+	"/setup",
+	"/signin",
+	"/signup",
+	"/reset-password",
+	"/forgot-password",
+	"/checkout/",
+	"/billing",
+	"/messages",
+	"/files",
+	"/invites",
+	"/settings",
+	"/calendar.ics",
+	"/admin",
+	"/api/",
+	"/oauth/",
+	"/events",
+	"/search",
+	"/feed/poll",
+	"/thoughts/new",
+	"/thought/*/edit",
+	"/app/*/versions",
+	"/project/*/versions",
+	"/project/*/manage",
+}
+
+func (c *SEOController) robots(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	b.WriteString("User-agent: *\nAllow: /\n")
+	for _, path := range robotsDisallow {
+		b.WriteString("Disallow: " + path + "\n")
+	}
+	b.WriteString("\nSitemap: " + sitemap.BaseURL + "/sitemap.xml\n")
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+func (c *SEOController) sitemapIndex(w http.ResponseWriter, r *http.Request) {
+	index := sitemap.Index()
+	if index == nil {
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "sitemap is being generated", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write(index)
+}
+
+// sitemap serves /sitemaps/{n}.xml, as listed in the index
 func (c *SEOController) sitemap(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(strings.TrimSuffix(r.PathValue("page"), ".xml"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	page, ok := sitemap.Page(n)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/xml")
-	fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>`)
-	c.Render(w, r, "sitemap.xml", nil)
+	w.Write(page)
 }
 
 func (c *SEOController) manifest(w http.ResponseWriter, r *http.Request) {
@@ -56,3 +220,113 @@ func (c *SEOController) serviceWorker(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	c.Render(w, r, "sw.js", nil)
 }
+
+// ogCacheDir holds rendered social preview images. Files are named by a
+// hash of what they show, so a changed title or star count renders anew.
+var ogCacheDir = cmp.Or(os.Getenv("OG_CACHE_DIR"), filepath.Join(os.TempDir(), "skyscape-og"))
+
+// socialImage serves /og/{type}/{id}.png, the preview image for a thought,
+// repo or project rendered on first request and cached on disk
+func (c *SEOController) socialImage(w http.ResponseWriter, r *http.Request) {
+	kind, id := r.PathValue("type"), strings.TrimSuffix(r.PathValue("file"), ".png")
+	card, author, ok := socialCard(kind, id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s\x00%s\x00%s\x00%d\x00%s", card.Kind, card.Title, card.Author, card.Stars, author.AvatarFileID))
+	name := kind + "-" + id + "-" + hex.EncodeToString(sum[:6]) + ".png"
+	path := filepath.Join(ogCacheDir, name)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		card.Avatar = avatarImage(author)
+		if data, err = imaging.SocialCard(card); err != nil {
+			slog.ErrorContext(r.Context(), "failed to render social image", "type", kind, "id", id, "error", err)
+			http.Error(w, "failed to render image", http.StatusInternalServerError)
+			return
+		}
+
+		// Replace any stale render of the same page
+		stale, _ := filepath.Glob(filepath.Join(ogCacheDir, kind+"-"+id+"-*.png"))
+		for _, old := range stale {
+			os.Remove(old)
+		}
+		if err := os.MkdirAll(ogCacheDir, 0755); err == nil {
+			err = os.WriteFile(path, data, 0644)
+		}
+		if err != nil {
+			slog.WarnContext(r.Context(), "failed to cache social image", "path", path, "error", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Header().Set("ETag", `"`+name+`"`)
+	if r.Header.Get("If-None-Match") == `"`+name+`"` {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Write(data)
+}
+
+// socialCard describes the preview image for public content, leaving out
+// drafts and anything taken down
+func socialCard(kind, id string) (imaging.Card, *models.Profile, bool) {
+	var card imaging.Card
+	var ownerID string
+
+	switch kind {
+	case "thought":
+		t, err := models.Thoughts.Get(id)
+		if err != nil || !t.Published || t.Takedown() != nil {
+			return card, nil, false
+		}
+		card = imaging.Card{Kind: "Thought", Title: t.Title, Stars: t.StarsCount}
+		ownerID = t.UserID
+
+	case "repo":
+		repo, err := models.Repos.Get(id)
+		if err != nil || repo.Archived || repo.Takedown() != nil {
+			return card, nil, false
+		}
+		card = imaging.Card{Kind: "Repository", Title: repo.Name, Stars: repo.StarsCount()}
+		ownerID = repo.OwnerID
+
+	case "project":
+		project, err := models.Projects.Get(id)
+		if err != nil || project.Status == "shutdown" || project.Takedown() != nil {
+			return card, nil, false
+		}
+		card = imaging.Card{Kind: "Project", Title: project.Name, Stars: project.StarsCount()}
+		ownerID = project.OwnerID
+
+	default:
+		return card, nil, false
+	}
+
+	owner, err := models.Profiles.Get(ownerID)
+	if err != nil || owner.Suspended {
+		return card, nil, false
+	}
+	card.Author = "@" + owner.Handle()
+	return card, owner, true
+}
+
+// avatarImage decodes the user's uploaded avatar, falling back to their
+// identicon
+func avatarImage(p *models.Profile) image.Image {
+	if p.AvatarFileID != "" {
+		if file, err := models.Files.Get(p.AvatarFileID); err == nil {
+			if img, _, err := image.Decode(bytes.NewReader(file.Content)); err == nil {
+				return img
+			}
+		}
+	}
+	img, _, err := image.Decode(bytes.NewReader(imaging.Identicon(p.UserID, imaging.AvatarLarge)))
+	if err != nil {
+		return nil
+	}
+	return img
+}
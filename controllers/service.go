@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"www.theskyscape.com/internal/push"
+	"www.theskyscape.com/internal/security"
+	"www.theskyscape.com/models"
+)
+
+// Service API limits. Apps and projects notify users from their own
+// backend, so the hourly limit is per client across all its users, and
+// the daily one keeps a single user from being flooded.
+const (
+	serviceNotificationsPerHour    = 100
+	serviceNotificationsPerUserDay = 10
+	maxNotificationTitle           = 100
+	maxNotificationBody            = 500
+)
+
+type ServiceUserResponse struct {
+	*UserResponse
+	Scopes       []string  `json:"scopes"`
+	AuthorizedAt time.Time `json:"authorized_at"`
+}
+
+type NotificationRequest struct {
+	UserID string `json:"user_id"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+	URL    string `json:"url"` // Must be on the client's own domain
+}
+
+// serviceProject authenticates a service API request, returning the
+// project whose service token it carries. Projects that can't run can't
+// call the API either.
+func (c *APIController) serviceProject(w http.ResponseWriter, r *http.Request) *models.Project {
+	project, err := security.ParseServiceToken(r)
+	if err != nil {
+		JSONError(w, http.StatusUnauthorized, err.Error())
+		return nil
+	}
+	if project.Status == "shutdown" || project.Takedown() != nil || models.ActiveSuspension(project.OwnerID) != nil {
+		JSONError(w, http.StatusForbidden, "project is not active")
+		return nil
+	}
+	return project
+}
+
+// notificationClient authenticates a notification request, returning the
+// ID and name of the app or project sending it. Projects can use their
+// service token; apps, which don't have one, use their OAuth client
+// credentials with Basic Auth, like the token endpoint.
+func (c *APIController) notificationClient(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	clientID, secret, basic := r.BasicAuth()
+	if !basic {
+		project := c.serviceProject(w, r)
+		if project == nil {
+			return "", "", false
+		}
+		return project.ID, project.Name, true
+	}
+
+	client, err := getOAuthClient(clientID)
+	if err != nil || !client.VerifySecret(secret) {
+		JSONError(w, http.StatusUnauthorized, "invalid client credentials")
+		return "", "", false
+	}
+
+	active := true
+	switch client := client.(type) {
+	case appClient:
+		owner := client.Owner()
+		active = client.Status != "shutdown" && client.Takedown() == nil && owner != nil && models.ActiveSuspension(owner.ID) == nil
+	case projectClient:
+		active = client.Status != "shutdown" && client.Takedown() == nil && models.ActiveSuspension(client.OwnerID) == nil
+	}
+	if !active {
+		JSONError(w, http.StatusForbidden, "client is not active")
+		return "", "", false
+	}
+	return client.GetID(), client.GetName(), true
+}
+
+// getServiceUsers lists the users who authorized the project
+func (c *APIController) getServiceUsers(w http.ResponseWriter, r *http.Request) {
+	project := c.serviceProject(w, r)
+	if project == nil {
+		return
+	}
+
+	users := []*ServiceUserResponse{}
+	for _, authorization := range project.AuthorizedUsers() {
+		profile, err := models.Profiles.First("WHERE UserID = ?", authorization.UserID)
+		if err != nil {
+			continue
+		}
+		users = append(users, &ServiceUserResponse{
+			UserResponse: userToResponse(profile),
+			Scopes:       authorization.ScopeList(),
+			AuthorizedAt: authorization.CreatedAt,
+		})
+		setLastModified(w, authorization.UpdatedAt, profile.UpdatedAt)
+	}
+	JSON(w, http.StatusOK, users)
+}
+
+// sendServiceNotification notifies a user who authorized the app or
+// project, through the same channels as the platform's own notifications.
+// Users can mute a client from their authorized apps, and turn off app
+// notifications altogether in their notification settings.
+func (c *APIController) sendServiceNotification(w http.ResponseWriter, r *http.Request) {
+	clientID, clientName, ok := c.notificationClient(w, r)
+	if !ok {
+		return
+	}
+
+	var req NotificationRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 8192)).Decode(&req); err != nil {
+		JSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	req.Title, req.Body = strings.TrimSpace(req.Title), strings.TrimSpace(req.Body)
+	if req.Title == "" || len(req.Title) > maxNotificationTitle || len(req.Body) > maxNotificationBody {
+		JSONError(w, http.StatusBadRequest, "title is required, titles can be up to 100 characters and bodies up to 500")
+		return
+	}
+
+	// Links can only lead back to the client itself
+	home := "https://" + clientID + ".skysca.pe"
+	if req.URL == "" {
+		req.URL = home
+	} else if req.URL != home && !strings.HasPrefix(req.URL, home+"/") {
+		JSONError(w, http.StatusBadRequest, "url must be on "+home)
+		return
+	}
+
+	authorization, err := models.OAuthAuthorizations.First(`
+		WHERE (AppID = ? OR ProjectID = ?) AND UserID = ? AND Revoked = false
+	`, clientID, clientID, req.UserID)
+	if err != nil {
+		JSONError(w, http.StatusNotFound, "user has not authorized this client")
+		return
+	}
+	if authorization.Muted {
+		JSONError(w, http.StatusForbidden, "user has muted notifications from this client")
+		return
+	}
+
+	allowed, _, err := models.Check(clientID, "service-notify", serviceNotificationsPerHour, time.Hour)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "failed to check rate limit")
+		return
+	}
+	if !allowed {
+		JSONError(w, http.StatusTooManyRequests, "too many notifications, try again later")
+		return
+	}
+
+	perUser := clientID + ":" + req.UserID
+	allowed, _, err = models.Check(perUser, "service-notify-user", serviceNotificationsPerUserDay, 24*time.Hour)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, "failed to check rate limit")
+		return
+	}
+	if !allowed {
+		JSONError(w, http.StatusTooManyRequests, "too many notifications to this user today")
+		return
+	}
+	models.Record(clientID, "service-notify", time.Hour)
+	models.Record(perUser, "service-notify-user", 24*time.Hour)
+
+	if err := push.SendNotification(req.UserID, clientID, models.NotifyApp, clientName+": "+req.Title, req.Body, req.URL); err != nil {
+		JSONError(w, http.StatusInternalServerError, "failed to send notification")
+		return
+	}
+	JSON(w, http.StatusAccepted, map[string]string{"status": "sent"})
+}
@@ -0,0 +1,397 @@
+package controllers
+
+import (
+	"crypto/hmac"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"www.theskyscape.com/internal/chathooks"
+	"www.theskyscape.com/internal/ical"
+	"www.theskyscape.com/internal/summaries"
+	"www.theskyscape.com/models"
+)
+
+func Settings() (string, *SettingsController) {
+	return "settings", &SettingsController{}
+}
+
+type SettingsController struct {
+	application.Controller
+}
+
+func (c *SettingsController) Setup(app *application.App) {
+	c.Controller.Setup(app)
+	auth := c.Use("auth").(*AuthController)
+
+	route("GET /settings", noindex(c.Serve("settings.html", auth.Required)))
+	route("POST /settings/hooks", c.ProtectFunc(c.createHook, auth.Required))
+	route("POST /settings/hooks/{hook}/test", c.ProtectFunc(c.testHook, auth.Required))
+	route("DELETE /settings/hooks/{hook}", c.ProtectFunc(c.deleteHook, auth.Required))
+	route("POST /settings/calendar/reset", c.ProtectFunc(c.resetCalendar, auth.Required))
+	route("POST /settings/summaries", c.ProtectFunc(c.updateSummaries, auth.Required))
+	route("POST /settings/feed", c.ProtectFunc(c.updateFeed, auth.Required))
+	route("POST /settings/notifications", c.ProtectFunc(c.updateNotifications, auth.Required))
+	route("DELETE /settings/devices/{device}", c.ProtectFunc(c.revokeDevice, auth.Required))
+
+	// Calendar apps can't sign in, so the feed is authorized by token
+	route("GET /calendar.ics", noindex(http.HandlerFunc(c.calendar)))
+}
+
+func (c SettingsController) Handle(r *http.Request) application.Handler {
+	c.Request = r
+	return &c
+}
+
+// Hooks returns the current user's chat notification hooks
+func (c *SettingsController) Hooks() []*models.NotificationHook {
+	auth := c.Use("auth").(*AuthController)
+	user := auth.CurrentUser()
+	if user == nil {
+		return nil
+	}
+
+	hooks, _ := models.NotificationHooks.Search(`
+		WHERE UserID = ?
+		ORDER BY CreatedAt ASC
+	`, user.ID)
+	return hooks
+}
+
+// NotificationKinds lists the kinds a hook can subscribe to
+func (c *SettingsController) NotificationKinds() []string {
+	return models.NotificationKinds
+}
+
+// NotificationSettings returns how the current user wants each kind of
+// notification delivered
+func (c *SettingsController) NotificationSettings() *models.NotificationSettings {
+	auth := c.Use("auth").(*AuthController)
+	user := auth.CurrentUser()
+	if user == nil {
+		return nil
+	}
+	return models.NotificationSettingsFor(user.ID)
+}
+
+// Channels lists the delivery choices for a notification kind
+func (c *SettingsController) Channels(kind string) []string {
+	return models.Channels(kind)
+}
+
+// FeedKinds lists the kinds of activity users can hide from their home feed
+func (c *SettingsController) FeedKinds() []models.FeedKind {
+	return models.FeedKinds
+}
+
+// PushIntervals lists the push batching choices in minutes
+func (c *SettingsController) PushIntervals() []int {
+	return models.PushIntervals
+}
+
+// Devices returns the current user's push notification subscriptions
+func (c *SettingsController) Devices() []*models.PushSubscription {
+	auth := c.Use("auth").(*AuthController)
+	user := auth.CurrentUser()
+	if user == nil {
+		return nil
+	}
+
+	devices, _ := models.PushSubscriptions.Search(`
+		WHERE UserID = ?
+		ORDER BY LastUsedAt DESC
+	`, user.ID)
+	return devices
+}
+
+// CalendarURL returns the current user's private calendar feed link
+func (c *SettingsController) CalendarURL() string {
+	auth := c.Use("auth").(*AuthController)
+	user := auth.CurrentUser()
+	if user == nil {
+		return ""
+	}
+
+	profile, err := models.Profiles.Get(user.ID)
+	if err != nil {
+		return ""
+	}
+
+	url, err := profile.CalendarURL()
+	if err != nil {
+		slog.Error("failed to create calendar link", "user_id", user.ID, "error", err)
+		return ""
+	}
+	return url
+}
+
+// SummariesAvailable reports whether AI summaries are configured on this
+// server, so the opt-in is only offered when it would do something
+func (c *SettingsController) SummariesAvailable() bool {
+	return summaries.Enabled()
+}
+
+// Profile returns the current user's profile
+func (c *SettingsController) Profile() *models.Profile {
+	auth := c.Use("auth").(*AuthController)
+	user := auth.CurrentUser()
+	if user == nil {
+		return nil
+	}
+
+	profile, _ := models.Profiles.Get(user.ID)
+	return profile
+}
+
+// maxHooks bounds how many chat hooks a user can configure
+const maxHooks = 5
+
+func (c *SettingsController) createHook(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	if models.NotificationHooks.Count("WHERE UserID = ?", user.ID) >= maxHooks {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("you can connect up to 5 chats")))
+		return
+	}
+
+	service := r.FormValue("service")
+	url := strings.TrimSpace(r.FormValue("url"))
+	chatID := strings.TrimSpace(r.FormValue("chat_id"))
+	if service != chathooks.Telegram {
+		chatID = ""
+	}
+
+	if err := chathooks.Validate(service, url, chatID); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	r.ParseForm()
+	var kinds []string
+	for _, kind := range r.Form["kinds"] {
+		if slices.Contains(models.NotificationKinds, kind) && !slices.Contains(kinds, kind) {
+			kinds = append(kinds, kind)
+		}
+	}
+	if len(kinds) == 0 {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("choose at least one notification to send")))
+		return
+	}
+
+	_, err = models.NotificationHooks.Insert(&models.NotificationHook{
+		UserID:  user.ID,
+		Service: service,
+		URL:     url,
+		ChatID:  chatID,
+		Kinds:   strings.Join(kinds, ","),
+	})
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+func (c *SettingsController) testHook(w http.ResponseWriter, r *http.Request) {
+	hook, err := c.ownHook(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	err = chathooks.Send(hook, "Test notification", "Your Skyscape notifications will show up here.", "/settings")
+	if err != nil {
+		hook.LastError = err.Error()
+		models.NotificationHooks.Update(hook)
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	hook.LastError = ""
+	models.NotificationHooks.Update(hook)
+	c.Refresh(w, r)
+}
+
+func (c *SettingsController) deleteHook(w http.ResponseWriter, r *http.Request) {
+	hook, err := c.ownHook(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	if err = models.NotificationHooks.Delete(hook); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+// ownHook loads the hook in the path, if it belongs to the current user
+func (c *SettingsController) ownHook(r *http.Request) (*models.NotificationHook, error) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+
+	hook, err := models.NotificationHooks.Get(r.PathValue("hook"))
+	if err != nil || hook.UserID != user.ID {
+		return nil, application.ErrNotFound
+	}
+	return hook, nil
+}
+
+func (c *SettingsController) resetCalendar(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	profile, err := models.Profiles.Get(user.ID)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	if err = profile.ResetCalendarToken(); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+// calendar serves a user's schedule as an iCalendar feed
+func (c *SettingsController) calendar(w http.ResponseWriter, r *http.Request) {
+	profile, err := models.Profiles.Get(r.FormValue("user"))
+	if err != nil || profile.CalendarToken == "" ||
+		!hmac.Equal([]byte(r.FormValue("token")), []byte(profile.CalendarToken)) {
+		http.NotFound(w, r)
+		return
+	}
+
+	cal := profile.Calendar()
+	cal.Refresh = time.Hour
+
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Cache-Control", "private, max-age=900")
+	w.Write(cal.Encode())
+}
+
+func (c *SettingsController) updateSummaries(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	profile, err := models.Profiles.Get(user.ID)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("profile not found")))
+		return
+	}
+
+	profile.Summaries = r.FormValue("summaries") == "on"
+	if err = models.Profiles.Update(profile); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+// updateFeed saves which kinds of activity the home feed shows. The form
+// sends the kinds left checked, so everything else is hidden.
+func (c *SettingsController) updateFeed(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	profile, err := models.Profiles.Get(user.ID)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("profile not found")))
+		return
+	}
+
+	r.ParseForm()
+	var hidden []string
+	for _, kind := range models.FeedKinds {
+		if !slices.Contains(r.Form["kinds"], kind.Key) {
+			hidden = append(hidden, kind.Key)
+		}
+	}
+	profile.SetHiddenFeedKinds(hidden)
+	if err = models.Profiles.Update(profile); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+func (c *SettingsController) updateNotifications(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	settings := models.NotificationSettingsFor(user.ID)
+	for _, kind := range models.NotificationKinds {
+		if channel := r.FormValue(kind); channel != "" {
+			settings.SetChannel(kind, channel)
+		}
+	}
+	if interval, err := strconv.Atoi(r.FormValue("interval")); err == nil {
+		settings.SetInterval(interval)
+	}
+
+	if err = settings.Save(); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+// revokeDevice removes one of the current user's push subscriptions
+func (c *SettingsController) revokeDevice(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	sub, err := models.PushSubscriptions.Get(r.PathValue("device"))
+	if err != nil || sub.UserID != user.ID {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("device not found")))
+		return
+	}
+
+	if err = models.PushSubscriptions.Delete(sub); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
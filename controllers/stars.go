@@ -3,8 +3,15 @@ package controllers
 import (
 	"errors"
 	"net/http"
+	"slices"
+	"time"
 
 	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/The-Skyscape/devtools/pkg/authentication"
+	"github.com/The-Skyscape/devtools/pkg/emailing"
+	"www.theskyscape.com/internal/i18n"
+	"www.theskyscape.com/internal/migration"
+	"www.theskyscape.com/internal/push"
 	"www.theskyscape.com/models"
 )
 
@@ -12,6 +19,7 @@ func Stars() (string, application.Handler) {
 	return "stars", &StarsController{}
 }
 
+// StarsController stars and unstars repos, projects, apps and thoughts
 type StarsController struct {
 	application.Controller
 }
@@ -20,8 +28,13 @@ func (c *StarsController) Setup(app *application.App) {
 	c.Controller.Setup(app)
 	auth := app.Use("auth").(*AuthController)
 
-	http.Handle("POST /repo/{repo}/star", c.ProtectFunc(c.star, auth.Required))
-	http.Handle("DELETE /repo/{repo}/star", c.ProtectFunc(c.unstar, auth.Required))
+	route("GET /stars", app.Serve("stars.html", auth.Required))
+	for _, subjectType := range models.StarTypes {
+		route("POST /"+subjectType+"/{id}/star", c.ProtectFunc(c.star(subjectType), auth.Required))
+		route("DELETE /"+subjectType+"/{id}/star", c.ProtectFunc(c.unstar(subjectType), auth.Required))
+	}
+
+	migration.MigrateStars()
 }
 
 func (c StarsController) Handle(r *http.Request) application.Handler {
@@ -29,73 +42,176 @@ func (c StarsController) Handle(r *http.Request) application.Handler {
 	return &c
 }
 
-func (c *StarsController) star(w http.ResponseWriter, r *http.Request) {
+// Filter returns the star type the /stars page is filtered to, or "" for
+// everything
+func (c *StarsController) Filter() string {
+	subjectType := c.URL.Query().Get("type")
+	if !slices.Contains(models.StarTypes, subjectType) {
+		return ""
+	}
+	return subjectType
+}
+
+// MyStars returns the current user's stars, filtered by type
+func (c *StarsController) MyStars() []*models.Star {
 	auth := c.Use("auth").(*AuthController)
-	user, _, err := auth.Authenticate(r)
-	if err != nil {
-		c.Render(w, r, "error-message.html", err)
-		return
+	user := auth.CurrentUser()
+	if user == nil {
+		return nil
 	}
+	return models.StarsBy(user.ID, c.Filter())
+}
 
-	repoID := r.PathValue("repo")
+// StarTab is one type filter on the /stars page
+type StarTab struct {
+	Type  string
+	Label string
+	Count int
+}
 
-	// Check if already starred
-	existing, _ := models.Stars.First("WHERE UserID = ? AND RepoID = ?",
-		user.ID, repoID)
-	if existing != nil {
-		c.Render(w, r, "error-message.html", errors.New("already starred"))
-		return
+var starLabels = map[string]string{
+	models.StarProject: "Projects",
+	models.StarRepo:    "Repos",
+	models.StarApp:     "Apps",
+	models.StarThought: "Thoughts",
+}
+
+// Tabs returns the type filters with how many of each the user starred
+func (c *StarsController) Tabs() []StarTab {
+	auth := c.Use("auth").(*AuthController)
+	user := auth.CurrentUser()
+	if user == nil {
+		return nil
 	}
 
-	// Get the repo to ensure it exists
-	repo, err := models.Repos.Get(repoID)
-	if err != nil || repo == nil {
-		c.Render(w, r, "error-message.html", errors.New("repository not found"))
-		return
+	tabs := make([]StarTab, 0, len(models.StarTypes))
+	for _, subjectType := range models.StarTypes {
+		tabs = append(tabs, StarTab{
+			Type:  subjectType,
+			Label: starLabels[subjectType],
+			Count: models.Stars.Count("WHERE UserID = ? AND SubjectType = ?", user.ID, subjectType),
+		})
 	}
+	return tabs
+}
 
-	// Create star
-	_, err = models.Stars.Insert(&models.Star{
-		UserID: user.ID,
-		RepoID: repoID,
-	})
-	if err != nil {
-		c.Render(w, r, "error-message.html", err)
-		return
+// Recommendation suggests what the current user might star next
+func (c *StarsController) Recommendation() *models.StarRecommendation {
+	auth := c.Use("auth").(*AuthController)
+	user := auth.CurrentUser()
+	if user == nil {
+		return nil
 	}
+	return models.RecommendStars(user.ID, 3)
+}
 
-	// Create activity for feed
-	models.Activities.Insert(&models.Activity{
-		UserID:      user.ID,
-		Action:      "starred",
-		SubjectType: "repo",
-		SubjectID:   repoID,
-	})
+// star stars a subject; starring something twice is a no-op
+func (c *StarsController) star(subjectType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := c.Use("auth").(*AuthController)
+		user, _, err := auth.Authenticate(r)
+		if err != nil {
+			c.Render(w, r, "error-message.html", localize(r, err))
+			return
+		}
+
+		subject, err := models.FindStarSubject(subjectType, r.PathValue("id"))
+		if err != nil {
+			c.Render(w, r, "error-message.html", localize(r, errors.New(subjectType+" not found")))
+			return
+		}
+
+		if models.IsStarred(user.ID, subject.Type, subject.ID) {
+			c.Refresh(w, r)
+			return
+		}
+
+		star, err := models.Stars.Insert(&models.Star{
+			UserID:      user.ID,
+			SubjectType: subject.Type,
+			SubjectID:   subject.ID,
+		})
+		if err != nil {
+			c.Render(w, r, "error-message.html", localize(r, err))
+			return
+		}
+		models.CountStar(star, 1)
+
+		// Create activity for feed
+		models.Activities.Insert(&models.Activity{
+			UserID:      user.ID,
+			Action:      "starred",
+			SubjectType: subject.Type,
+			SubjectID:   subject.ID,
+		})
+
+		go notifyStar(subject, user)
+		c.Refresh(w, r)
+	}
+}
 
-	c.Refresh(w, r)
+// unstar removes a star; unstarring something not starred is a no-op
+func (c *StarsController) unstar(subjectType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := c.Use("auth").(*AuthController)
+		user, _, err := auth.Authenticate(r)
+		if err != nil {
+			c.Render(w, r, "error-message.html", localize(r, err))
+			return
+		}
+
+		star := models.FindStar(user.ID, subjectType, r.PathValue("id"))
+		if star == nil {
+			c.Refresh(w, r)
+			return
+		}
+
+		if err = models.Stars.Delete(star); err != nil {
+			c.Render(w, r, "error-message.html", localize(r, err))
+			return
+		}
+		models.CountStar(star, -1)
+
+		c.Refresh(w, r)
+	}
 }
 
-func (c *StarsController) unstar(w http.ResponseWriter, r *http.Request) {
-	auth := c.Use("auth").(*AuthController)
-	user, _, err := auth.Authenticate(r)
-	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+// notifyStar tells the owner someone starred their work. Each user
+// notifies an owner about a subject at most once a day, so toggling a star
+// doesn't spam them.
+func notifyStar(subject *models.StarSubject, stargazer *authentication.User) {
+	if subject.OwnerID == "" || subject.OwnerID == stargazer.ID {
 		return
 	}
 
-	repoID := r.PathValue("repo")
-
-	star, err := models.Stars.First("WHERE UserID = ? AND RepoID = ?",
-		user.ID, repoID)
-	if err != nil || star == nil {
-		c.Render(w, r, "error-message.html", errors.New("not starred"))
+	key := stargazer.ID + ":" + subject.ID
+	if allowed, _, _ := models.Check(key, "star-notification", 1, 24*time.Hour); !allowed {
 		return
 	}
-
-	if err = models.Stars.Delete(star); err != nil {
-		c.Render(w, r, "error-message.html", err)
+	models.Record(key, "star-notification", 24*time.Hour)
+
+	push.SendNotification(
+		subject.OwnerID,
+		stargazer.ID, // source = stargazer
+		models.NotifyStar,
+		"New star",
+		"@"+stargazer.Handle+" starred "+subject.Name,
+		subject.URL,
+	)
+
+	owner, err := models.Auth.Users.Get(subject.OwnerID)
+	if err != nil || !models.WantsEmail(owner.ID, models.NotifyStar) {
 		return
 	}
 
-	c.Refresh(w, r)
+	locale := models.EmailLocale(owner.ID)
+	models.SendEmail(owner.Email,
+		i18n.T(locale, "%s starred %s", stargazer.Name, subject.Name),
+		"new-star.html",
+		emailing.WithData("t", i18n.For(locale)),
+		emailing.WithData("user", owner),
+		emailing.WithData("stargazer", stargazer),
+		emailing.WithData("subject", subject),
+		emailing.WithData("year", time.Now().Year()),
+	)
 }
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"www.theskyscape.com/internal/health"
+	"www.theskyscape.com/models"
+)
+
+// incidentHistoryDays is how far back the status page lists resolved incidents
+const incidentHistoryDays = 14
+
+func Status() (string, *StatusController) {
+	return "status", &StatusController{}
+}
+
+type StatusController struct {
+	application.Controller
+}
+
+func (c *StatusController) Setup(app *application.App) {
+	c.Controller.Setup(app)
+	auth := c.Use("auth").(*AuthController)
+
+	route("GET /status", c.Serve("status.html", auth.Optional))
+	route("GET /status.json", http.HandlerFunc(c.statusJSON))
+
+	route("GET /admin/status", c.Serve("admin-status.html", auth.AdminRequired))
+	route("POST /admin/incidents", c.ProtectFunc(c.createIncident, auth.AdminRequired))
+	route("POST /admin/incident/{incident}", c.ProtectFunc(c.updateIncident, auth.AdminRequired))
+
+	go health.Monitor(time.Minute)
+	go models.KeepReplicaSynced(15 * time.Second)
+}
+
+func (c StatusController) Handle(r *http.Request) application.Handler {
+	c.Request = r
+	return &c
+}
+
+// Components returns the latest health of each platform component
+func (c *StatusController) Components() []health.Component {
+	return health.Latest()
+}
+
+// Overall returns the worst status across components
+func (c *StatusController) Overall() string {
+	return health.Overall(health.Latest())
+}
+
+// OpenIncidents returns incidents that are still ongoing
+func (c *StatusController) OpenIncidents() []*models.Incident {
+	return models.OpenIncidents()
+}
+
+// RecentIncidents returns incidents resolved in the last two weeks
+func (c *StatusController) RecentIncidents() []*models.Incident {
+	return models.RecentIncidents(incidentHistoryDays)
+}
+
+// Replica returns how fresh the local database replica is
+func (c *StatusController) Replica() models.ReplicaStats {
+	return models.ReplicaStatus()
+}
+
+// ComponentNames lists the components incidents can be posted for
+func (c *StatusController) ComponentNames() []string {
+	return health.Components
+}
+
+// IncidentResponse is an incident as listed in /status.json
+type IncidentResponse struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Component string    `json:"component"`
+	Impact    string    `json:"impact"`
+	Status    string    `json:"status"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// statusJSON lets deployed apps show degradation notices, so it allows
+// requests from any origin
+func (c *StatusController) statusJSON(w http.ResponseWriter, r *http.Request) {
+	components := health.Latest()
+
+	incidents := []*IncidentResponse{}
+	for _, i := range models.OpenIncidents() {
+		incidents = append(incidents, &IncidentResponse{
+			ID:        i.ID,
+			Title:     i.Title,
+			Component: i.Component,
+			Impact:    i.Impact,
+			Status:    i.Status,
+			Message:   i.Message,
+			CreatedAt: i.CreatedAt,
+			UpdatedAt: i.UpdatedAt,
+		})
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	JSON(w, http.StatusOK, map[string]any{
+		"status":     health.Overall(components),
+		"components": components,
+		"incidents":  incidents,
+	})
+}
+
+func (c *StatusController) createIncident(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	admin, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	title := strings.TrimSpace(r.FormValue("title"))
+	if title == "" {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("title is required")))
+		return
+	}
+
+	component := r.FormValue("component")
+	if !slices.Contains(health.Components, component) {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("unknown component")))
+		return
+	}
+
+	impact := r.FormValue("impact")
+	if impact != health.Outage {
+		impact = health.Degraded
+	}
+
+	_, err = models.Incidents.Insert(&models.Incident{
+		CreatedBy: admin.ID,
+		Title:     title,
+		Component: component,
+		Impact:    impact,
+		Status:    models.IncidentInvestigating,
+		Message:   strings.TrimSpace(r.FormValue("message")),
+	})
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+func (c *StatusController) updateIncident(w http.ResponseWriter, r *http.Request) {
+	incident, err := models.Incidents.Get(r.PathValue("incident"))
+	if err != nil {
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
+		return
+	}
+
+	status := r.FormValue("status")
+	switch status {
+	case models.IncidentInvestigating, models.IncidentIdentified, models.IncidentMonitoring:
+	case models.IncidentResolved:
+		if !incident.IsResolved() {
+			incident.ResolvedAt = time.Now()
+		}
+	default:
+		c.Render(w, r, "error-message.html", localize(r, errors.New("unknown incident status")))
+		return
+	}
+	incident.Status = status
+
+	if message := strings.TrimSpace(r.FormValue("message")); message != "" {
+		incident.Message = message
+	}
+
+	if err = models.Incidents.Update(incident); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
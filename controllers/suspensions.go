@@ -0,0 +1,267 @@
+package controllers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"www.theskyscape.com/models"
+)
+
+func Suspensions() (string, *SuspensionsController) {
+	return "suspensions", &SuspensionsController{}
+}
+
+type SuspensionsController struct {
+	application.Controller
+}
+
+func (c *SuspensionsController) Setup(app *application.App) {
+	c.Controller.Setup(app)
+	auth := c.Use("auth").(*AuthController)
+
+	// Suspended users can't sign in, so these are authorized by appeal token
+	route("GET /suspended/{suspension}", c.Serve("suspended.html", c.tokenRequired))
+	route("POST /suspended/{suspension}/appeal", c.ProtectFunc(c.appeal, c.tokenRequired))
+
+	route("GET /admin/suspensions", c.Serve("admin-suspensions.html", auth.AdminRequired))
+	route("POST /admin/user/{user}/suspend", c.ProtectFunc(c.suspend, auth.AdminRequired))
+	route("POST /admin/suspension/{suspension}/lift", c.ProtectFunc(c.lift, auth.AdminRequired))
+	route("POST /admin/suspension/{suspension}/appeal", c.ProtectFunc(c.reviewAppeal, auth.AdminRequired))
+	route("POST /admin/restriction/{restriction}/lift", c.ProtectFunc(c.liftRestriction, auth.AdminRequired))
+}
+
+func (c SuspensionsController) Handle(r *http.Request) application.Handler {
+	c.Request = r
+	return &c
+}
+
+// tokenRequired checks the appeal token for the suspension in the path
+func (c *SuspensionsController) tokenRequired(app *application.App, w http.ResponseWriter, r *http.Request) bool {
+	s, err := models.Suspensions.Get(r.PathValue("suspension"))
+	if err != nil || !s.VerifyAppealToken(r.FormValue("token")) {
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
+		return false
+	}
+	return true
+}
+
+// CurrentSuspension returns the suspension from the path
+func (c *SuspensionsController) CurrentSuspension() *models.Suspension {
+	s, err := models.Suspensions.Get(c.PathValue("suspension"))
+	if err != nil {
+		return nil
+	}
+	return s
+}
+
+// ActiveSuspensions returns all suspensions currently in effect
+func (c *SuspensionsController) ActiveSuspensions() []*models.Suspension {
+	suspensions, _ := models.Suspensions.Search(`
+		WHERE Active = true
+		ORDER BY CreatedAt DESC
+	`)
+	return suspensions
+}
+
+// ActiveRestrictions returns automatic restrictions still in effect
+func (c *SuspensionsController) ActiveRestrictions() []*models.Restriction {
+	return models.ActiveRestrictions()
+}
+
+// PendingAppeals returns appeals waiting on an admin decision
+func (c *SuspensionsController) PendingAppeals() []*models.Suspension {
+	suspensions, _ := models.Suspensions.Search(`
+		WHERE Active = true AND AppealStatus = ?
+		ORDER BY AppealedAt ASC
+	`, models.AppealPending)
+	return suspensions
+}
+
+// UserSuspensions returns the suspension history for a user
+func (c *SuspensionsController) UserSuspensions(userID string) []*models.Suspension {
+	suspensions, _ := models.Suspensions.Search(`
+		WHERE UserID = ?
+		ORDER BY CreatedAt DESC
+	`, userID)
+	return suspensions
+}
+
+func (c *SuspensionsController) suspend(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	admin, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	user, err := models.Auth.Users.Get(r.PathValue("user"))
+	if err != nil {
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
+		return
+	}
+
+	if user.IsAdmin {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("admins cannot be suspended")))
+		return
+	}
+
+	kind := r.FormValue("kind")
+	if kind != models.SuspensionSuspended && kind != models.SuspensionBanned {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("invalid suspension kind")))
+		return
+	}
+
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if reason == "" {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("a reason is required")))
+		return
+	}
+
+	// Duration in days, 0 or empty for indefinite
+	days, _ := strconv.Atoi(r.FormValue("days"))
+	if days < 0 {
+		days = 0
+	}
+
+	if _, err = models.Suspend(user.ID, admin.ID, kind, reason, time.Duration(days)*24*time.Hour); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	slog.InfoContext(r.Context(), "admin suspended user", "admin", admin.Handle, "kind", kind, "handle", user.Handle, "reason", reason)
+	auth.audit(r, admin.ID, models.AuditUserSuspended, "user", user.ID, kind+": "+reason)
+	c.Refresh(w, r)
+}
+
+func (c *SuspensionsController) lift(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	admin, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	s, err := models.Suspensions.Get(r.PathValue("suspension"))
+	if err != nil {
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
+		return
+	}
+
+	if !s.Active {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("suspension is not active")))
+		return
+	}
+
+	if err = s.Lift(admin.ID); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	slog.InfoContext(r.Context(), "admin lifted suspension", "admin", admin.Handle, "suspension_id", s.ID)
+	auth.audit(r, admin.ID, models.AuditSuspensionLifted, "user", s.UserID, "")
+	c.Refresh(w, r)
+}
+
+func (c *SuspensionsController) appeal(w http.ResponseWriter, r *http.Request) {
+	s, err := models.Suspensions.Get(r.PathValue("suspension"))
+	if err != nil {
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
+		return
+	}
+
+	if !s.CanAppeal() {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("this suspension can no longer be appealed")))
+		return
+	}
+
+	message := strings.TrimSpace(r.FormValue("appeal"))
+	if message == "" {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("please explain your appeal")))
+		return
+	}
+
+	if len(message) > 5000 {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("appeal must be 5000 characters or less")))
+		return
+	}
+
+	s.Appeal = message
+	s.AppealStatus = models.AppealPending
+	s.AppealedAt = time.Now()
+	if err = models.Suspensions.Update(s); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Refresh(w, r)
+}
+
+func (c *SuspensionsController) reviewAppeal(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	admin, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	s, err := models.Suspensions.Get(r.PathValue("suspension"))
+	if err != nil {
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
+		return
+	}
+
+	if s.AppealStatus != models.AppealPending {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("no pending appeal")))
+		return
+	}
+
+	switch r.FormValue("decision") {
+	case "approve":
+		s.AppealStatus = models.AppealApproved
+		err = s.Lift(admin.ID)
+	case "deny":
+		s.AppealStatus = models.AppealDenied
+		err = models.Suspensions.Update(s)
+	default:
+		err = errors.New("invalid decision")
+	}
+
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	slog.InfoContext(r.Context(), "admin reviewed appeal", "admin", admin.Handle, "suspension_id", s.ID, "status", s.AppealStatus)
+	auth.audit(r, admin.ID, models.AuditAppealReviewed, "user", s.UserID, s.AppealStatus)
+	c.Refresh(w, r)
+}
+
+// liftRestriction ends an automatic restriction early
+func (c *SuspensionsController) liftRestriction(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	admin, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	restriction, err := models.Restrictions.Get(r.PathValue("restriction"))
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("restriction not found")))
+		return
+	}
+
+	if err = restriction.Lift(admin.ID); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	slog.InfoContext(r.Context(), "admin lifted restriction", "admin", admin.Handle, "user_id", restriction.UserID, "action", restriction.Action)
+	auth.audit(r, admin.ID, models.AuditSuspensionLifted, "user", restriction.UserID, "restriction on "+restriction.Action)
+	c.Refresh(w, r)
+}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/The-Skyscape/devtools/pkg/emailing"
+	"www.theskyscape.com/internal/i18n"
+	"www.theskyscape.com/models"
+)
+
+func Takedowns() (string, *TakedownsController) {
+	return "takedowns", &TakedownsController{}
+}
+
+type TakedownsController struct {
+	application.Controller
+}
+
+func (c *TakedownsController) Setup(app *application.App) {
+	c.Controller.Setup(app)
+	auth := c.Use("auth").(*AuthController)
+
+	route("GET /admin/takedowns", c.Serve("admin-takedowns.html", auth.AdminRequired))
+	route("POST /admin/takedown", c.ProtectFunc(c.takedown, auth.AdminRequired))
+	route("POST /admin/takedown/{takedown}/restore", c.ProtectFunc(c.restore, auth.AdminRequired))
+}
+
+func (c TakedownsController) Handle(r *http.Request) application.Handler {
+	c.Request = r
+	return &c
+}
+
+// ActiveTakedowns returns content that is currently removed
+func (c *TakedownsController) ActiveTakedowns() []*models.Takedown {
+	takedowns, _ := models.Takedowns.Search(`
+		WHERE Active = true
+		ORDER BY CreatedAt DESC
+	`)
+	return takedowns
+}
+
+// History returns the most recent takedowns, including restored ones
+func (c *TakedownsController) History() []*models.Takedown {
+	takedowns, _ := models.Takedowns.Search(`
+		ORDER BY CreatedAt DESC
+		LIMIT 100
+	`)
+	return takedowns
+}
+
+func (c *TakedownsController) takedown(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	admin, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	subjectType := r.FormValue("type")
+	subjectID := strings.TrimSpace(r.FormValue("id"))
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if reason == "" {
+		// Quick takedowns from content menus collect the reason with hx-prompt
+		reason = strings.TrimSpace(r.Header.Get("HX-Prompt"))
+	}
+	if subjectID == "" || reason == "" {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("content ID and reason are required")))
+		return
+	}
+
+	t, err := models.TakeDown(subjectType, subjectID, admin.ID, reason)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	slog.InfoContext(r.Context(), "admin took down content", "admin", admin.Handle, "subject_type", subjectType, "subject_id", subjectID, "reason", reason)
+	auth.audit(r, admin.ID, models.AuditTakedown, subjectType, subjectID, reason)
+	go notifyTakedown(t, "content-removed.html", "Your content was removed")
+	c.Refresh(w, r)
+}
+
+func (c *TakedownsController) restore(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	admin, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	t, err := models.Takedowns.Get(r.PathValue("takedown"))
+	if err != nil {
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
+		return
+	}
+
+	if !t.Active {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("content is not taken down")))
+		return
+	}
+
+	if err = t.Restore(admin.ID); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	slog.InfoContext(r.Context(), "admin restored content", "admin", admin.Handle, "subject_type", t.SubjectType, "subject_id", t.SubjectID)
+	auth.audit(r, admin.ID, models.AuditTakedownRestored, t.SubjectType, t.SubjectID, "")
+	go notifyTakedown(t, "content-restored.html", "Your content was restored")
+	c.Refresh(w, r)
+}
+
+// notifyTakedown emails the author about a takedown or restore
+func notifyTakedown(t *models.Takedown, template, subject string) {
+	author := t.Author()
+	if author == nil {
+		return
+	}
+
+	locale := models.EmailLocale(author.ID)
+	models.SendEmail(author.Email,
+		i18n.T(locale, subject),
+		template,
+		emailing.WithData("t", i18n.For(locale)),
+		emailing.WithData("Title", i18n.T(locale, subject)),
+		emailing.WithData("user", author),
+		emailing.WithData("takedown", t),
+		emailing.WithData("year", time.Now().Year()),
+	)
+}
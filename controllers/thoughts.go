@@ -9,8 +9,10 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/The-Skyscape/devtools/pkg/application"
+	"www.theskyscape.com/internal/scanning"
 	"www.theskyscape.com/models"
 )
 
@@ -27,28 +29,24 @@ func (c *ThoughtsController) Setup(app *application.App) {
 	auth := app.Use("auth").(*AuthController)
 
 	// Public routes
-	http.Handle("GET /thoughts", app.Serve("thoughts.html", auth.Optional))
-	http.Handle("GET /thought/{thought}", c.ProtectFunc(c.view, auth.Optional))
-	http.Handle("GET /user/{user}/thoughts", app.Serve("user-thoughts.html", auth.Optional))
+	route("GET /thoughts", cached(app.Serve("thoughts.html", auth.Optional)))
+	route("GET /thought/{thought}", c.ProtectFunc(c.view, auth.Optional))
+	route("GET /user/{user}/thoughts", cached(app.Serve("user-thoughts.html", auth.Optional)))
 
 	// Authenticated routes
-	http.Handle("GET /thoughts/new", app.Serve("thought-edit.html", auth.Required))
-	http.Handle("GET /thought/{thought}/edit", app.Serve("thought-edit.html", auth.Required))
-	http.Handle("POST /thoughts", c.ProtectFunc(c.create, auth.Required))
-	http.Handle("POST /thought/{thought}", c.ProtectFunc(c.update, auth.Required))
-	http.Handle("DELETE /thought/{thought}", c.ProtectFunc(c.delete, auth.Required))
-
-	// Social features
-	http.Handle("POST /thought/{thought}/star", c.ProtectFunc(c.star, auth.Required))
-	http.Handle("DELETE /thought/{thought}/star", c.ProtectFunc(c.unstar, auth.Required))
+	route("GET /thoughts/new", noindex(app.Serve("thought-edit.html", auth.Required)))
+	route("GET /thought/{thought}/edit", noindex(app.Serve("thought-edit.html", auth.Required)))
+	route("POST /thoughts", c.ProtectFunc(c.create, auth.Required))
+	route("POST /thought/{thought}", c.ProtectFunc(c.update, auth.Required))
+	route("DELETE /thought/{thought}", c.ProtectFunc(c.delete, auth.Required))
 
 	// Block management endpoints (HTMX)
-	http.Handle("POST /thought/{thought}/header", c.ProtectFunc(c.uploadHeader, auth.Required))
-	http.Handle("POST /thought/{thought}/blocks", c.ProtectFunc(c.createBlock, auth.Required))
-	http.Handle("POST /thought/{thought}/blocks/image", c.ProtectFunc(c.createImageBlock, auth.Required))
-	http.Handle("POST /thought/{thought}/blocks/reorder", c.ProtectFunc(c.reorderBlocks, auth.Required))
-	http.Handle("POST /thought/{thought}/block/{block}", c.ProtectFunc(c.updateBlock, auth.Required))
-	http.Handle("DELETE /thought/{thought}/block/{block}", c.ProtectFunc(c.deleteBlock, auth.Required))
+	route("POST /thought/{thought}/header", c.ProtectFunc(auth.limited(uploadLimit, c.uploadHeader), auth.Required))
+	route("POST /thought/{thought}/blocks", c.ProtectFunc(c.createBlock, auth.Required))
+	route("POST /thought/{thought}/blocks/image", c.ProtectFunc(auth.limited(uploadLimit, c.createImageBlock), auth.Required))
+	route("POST /thought/{thought}/blocks/reorder", c.ProtectFunc(c.reorderBlocks, auth.Required))
+	route("POST /thought/{thought}/block/{block}", c.ProtectFunc(c.updateBlock, auth.Required))
+	route("DELETE /thought/{thought}/block/{block}", c.ProtectFunc(c.deleteBlock, auth.Required))
 }
 
 func (c ThoughtsController) Handle(r *http.Request) application.Handler {
@@ -89,6 +87,7 @@ func (c *ThoughtsController) AllThoughts() []*models.Thought {
 	thoughts, _ := models.Thoughts.Search(`
 		INNER JOIN users on users.ID = thoughts.UserID
 		WHERE Published = true
+			AND thoughts.UserID NOT IN (SELECT UserID FROM profiles WHERE Suspended = true)
 			AND (
 				thoughts.Title   LIKE $1 OR
 				thoughts.Content LIKE $1 OR
@@ -104,6 +103,7 @@ func (c *ThoughtsController) AllThoughts() []*models.Thought {
 func (c *ThoughtsController) RecentThoughts() []*models.Thought {
 	thoughts, _ := models.Thoughts.Search(`
 		WHERE Published = true
+			AND UserID NOT IN (SELECT UserID FROM profiles WHERE Suspended = true)
 		ORDER BY CreatedAt DESC
 		LIMIT 10
 	`)
@@ -137,7 +137,7 @@ func (c *ThoughtsController) MyThoughts() []*models.Thought {
 func (c *ThoughtsController) view(w http.ResponseWriter, r *http.Request) {
 	thought, err := models.Thoughts.Get(r.PathValue("thought"))
 	if err != nil {
-		c.RenderError(w, r, application.ErrNotFound)
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
 		return
 	}
 
@@ -145,16 +145,18 @@ func (c *ThoughtsController) view(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, _ := auth.Authenticate(r)
 	if !thought.Published && (user == nil || user.ID != thought.UserID) {
-		c.RenderError(w, r, application.ErrNotFound)
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
 		return
 	}
 
-	// Record view
-	var userID string
+	// Record view, without tracking anonymous readers who opted out
+	var userID, ip string
 	if user != nil {
 		userID = user.ID
+	} else if !doNotTrack(r) {
+		ip = auth.getClientIP(r)
 	}
-	thought.RecordView(userID, r.RemoteAddr)
+	thought.RecordView(userID, ip)
 
 	c.Render(w, r, "thought.html", thought)
 }
@@ -164,7 +166,7 @@ func (c *ThoughtsController) create(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -172,12 +174,12 @@ func (c *ThoughtsController) create(w http.ResponseWriter, r *http.Request) {
 	published := r.FormValue("published") == "true"
 
 	if title == "" {
-		c.Render(w, r, "error-message.html", errors.New("title is required"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("title is required")))
 		return
 	}
 
 	if len(title) > 200 {
-		c.Render(w, r, "error-message.html", errors.New("title too long, max 200 characters"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("title too long, max 200 characters")))
 		return
 	}
 
@@ -190,10 +192,13 @@ func (c *ThoughtsController) create(w http.ResponseWriter, r *http.Request) {
 		Slug:      slug,
 		Published: published,
 	}
+	if published {
+		thought.PublishedAt = time.Now()
+	}
 
 	created, err := models.Thoughts.Insert(thought)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
@@ -216,18 +221,18 @@ func (c *ThoughtsController) update(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	thought, err := models.Thoughts.Get(r.PathValue("thought"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("thought not found"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("thought not found")))
 		return
 	}
 
 	if thought.UserID != user.ID && !user.IsAdmin {
-		c.Render(w, r, "error-message.html", errors.New("not authorized"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("not authorized")))
 		return
 	}
 
@@ -235,7 +240,12 @@ func (c *ThoughtsController) update(w http.ResponseWriter, r *http.Request) {
 	published := r.FormValue("published") == "true"
 
 	if title == "" {
-		c.Render(w, r, "error-message.html", errors.New("title is required"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("title is required")))
+		return
+	}
+
+	if err := claimEdit(w, r, thought); err != nil {
+		http.Error(w, localize(r, err).Error(), http.StatusConflict)
 		return
 	}
 
@@ -243,12 +253,19 @@ func (c *ThoughtsController) update(w http.ResponseWriter, r *http.Request) {
 	thought.Title = title
 	thought.Published = published
 	thought.Slug = generateSlug(title)
+	if published && thought.PublishedAt.IsZero() {
+		thought.PublishedAt = time.Now()
+	}
 
 	if err := models.Thoughts.Update(thought); err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
+	if published != wasPublished {
+		thought.SyncFileVisibility()
+	}
+
 	// Create activity if newly published
 	if published && !wasPublished {
 		models.Activities.Insert(&models.Activity{
@@ -267,96 +284,29 @@ func (c *ThoughtsController) delete(w http.ResponseWriter, r *http.Request) {
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	thought, err := models.Thoughts.Get(r.PathValue("thought"))
 	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("thought not found"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("thought not found")))
 		return
 	}
 
 	if thought.UserID != user.ID && !user.IsAdmin {
-		c.Render(w, r, "error-message.html", errors.New("not authorized"))
+		c.Render(w, r, "error-message.html", localize(r, errors.New("not authorized")))
 		return
 	}
 
 	if err := models.Thoughts.Delete(thought); err != nil {
-		c.Render(w, r, "error-message.html", err)
+		c.Render(w, r, "error-message.html", localize(r, err))
 		return
 	}
 
 	c.Redirect(w, r, "/profile")
 }
 
-// star handles starring a thought
-func (c *ThoughtsController) star(w http.ResponseWriter, r *http.Request) {
-	auth := c.Use("auth").(*AuthController)
-	user, _, err := auth.Authenticate(r)
-	if err != nil {
-		c.Render(w, r, "error-message.html", err)
-		return
-	}
-
-	thought, err := models.Thoughts.Get(r.PathValue("thought"))
-	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("thought not found"))
-		return
-	}
-
-	// Check if already starred
-	if thought.IsStarredBy(user.ID) {
-		c.Refresh(w, r)
-		return
-	}
-
-	// Create star
-	models.ThoughtStars.Insert(&models.ThoughtStar{
-		ThoughtID: thought.ID,
-		UserID:    user.ID,
-	})
-
-	// Update cached count
-	thought.StarsCount++
-	models.Thoughts.Update(thought)
-
-	c.Refresh(w, r)
-}
-
-// unstar handles unstarring a thought
-func (c *ThoughtsController) unstar(w http.ResponseWriter, r *http.Request) {
-	auth := c.Use("auth").(*AuthController)
-	user, _, err := auth.Authenticate(r)
-	if err != nil {
-		c.Render(w, r, "error-message.html", err)
-		return
-	}
-
-	thought, err := models.Thoughts.Get(r.PathValue("thought"))
-	if err != nil {
-		c.Render(w, r, "error-message.html", errors.New("thought not found"))
-		return
-	}
-
-	// Find and delete star
-	star, err := models.ThoughtStars.First("WHERE ThoughtID = ? AND UserID = ?", thought.ID, user.ID)
-	if err != nil {
-		c.Refresh(w, r)
-		return
-	}
-
-	models.ThoughtStars.Delete(star)
-
-	// Update cached count
-	if thought.StarsCount > 0 {
-		thought.StarsCount--
-		models.Thoughts.Update(thought)
-	}
-
-	c.Refresh(w, r)
-}
-
 // generateSlug creates a URL-friendly slug from a title
 func generateSlug(title string) string {
 	slug := strings.ToLower(title)
@@ -377,18 +327,18 @@ func (c *ThoughtsController) createBlock(w http.ResponseWriter, r *http.Request)
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.RenderError(w, r, err)
+		c.RenderError(w, r, localize(r, err))
 		return
 	}
 
 	thought, err := models.Thoughts.Get(r.PathValue("thought"))
 	if err != nil {
-		c.RenderError(w, r, application.ErrNotFound)
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
 		return
 	}
 
 	if thought.UserID != user.ID && !user.IsAdmin {
-		c.RenderError(w, r, application.ErrForbidden)
+		c.RenderError(w, r, localize(r, application.ErrForbidden))
 		return
 	}
 
@@ -407,35 +357,20 @@ func (c *ThoughtsController) createBlock(w http.ResponseWriter, r *http.Request)
 		"code": true, "list": true, "image": true, "file": true,
 	}
 	if !validTypes[blockType] {
-		c.RenderError(w, r, errors.New("invalid block type"))
+		c.RenderError(w, r, localize(r, errors.New("invalid block type")))
 		return
 	}
 
-	// If position not specified, add at end
-	if position == 0 {
-		position = models.ThoughtBlocks.Count("WHERE ThoughtID = ?", thought.ID) + 1
-	}
-
-	// Shift existing blocks if inserting in middle
-	existingBlocks := thought.Blocks()
-	for _, block := range existingBlocks {
-		if block.Position >= position {
-			block.Position++
-			models.ThoughtBlocks.Update(block)
-		}
-	}
-
-	block := &models.ThoughtBlock{
+	// Without a position the block is added at the end
+	created, err := models.InsertBlock(&models.ThoughtBlock{
 		ThoughtID: thought.ID,
 		Type:      blockType,
 		Content:   content,
 		FileID:    fileID,
 		Position:  position,
-	}
-
-	created, err := models.ThoughtBlocks.Insert(block)
+	})
 	if err != nil {
-		c.RenderError(w, r, err)
+		c.RenderError(w, r, localize(r, err))
 		return
 	}
 
@@ -448,24 +383,24 @@ func (c *ThoughtsController) updateBlock(w http.ResponseWriter, r *http.Request)
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.RenderError(w, r, err)
+		c.RenderError(w, r, localize(r, err))
 		return
 	}
 
 	thought, err := models.Thoughts.Get(r.PathValue("thought"))
 	if err != nil {
-		c.RenderError(w, r, application.ErrNotFound)
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
 		return
 	}
 
 	if thought.UserID != user.ID && !user.IsAdmin {
-		c.RenderError(w, r, application.ErrForbidden)
+		c.RenderError(w, r, localize(r, application.ErrForbidden))
 		return
 	}
 
 	block, err := models.ThoughtBlocks.Get(r.PathValue("block"))
 	if err != nil || block.ThoughtID != thought.ID {
-		c.RenderError(w, r, application.ErrNotFound)
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
 		return
 	}
 
@@ -481,12 +416,25 @@ func (c *ThoughtsController) updateBlock(w http.ResponseWriter, r *http.Request)
 		block.FileID = fileID
 	}
 
-	if err := models.ThoughtBlocks.Update(block); err != nil {
-		c.RenderError(w, r, err)
+	// Editors send the version they loaded, so a save from a stale tab
+	// doesn't overwrite a newer one
+	version := block.Version
+	if v, err := strconv.Atoi(r.FormValue("version")); err == nil {
+		version = v
+	}
+
+	if err := models.UpdateBlock(block, version); err != nil {
+		if errors.Is(err, models.ErrBlockConflict) {
+			http.Error(w, localize(r, err).Error(), http.StatusConflict)
+			return
+		}
+		c.RenderError(w, r, localize(r, err))
 		return
 	}
 
-	// Return empty response for hx-swap="none"
+	// Return the new version for the next save, with an empty body for
+	// hx-swap="none"
+	w.Header().Set("X-Block-Version", strconv.Itoa(block.Version))
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -495,43 +443,32 @@ func (c *ThoughtsController) deleteBlock(w http.ResponseWriter, r *http.Request)
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.RenderError(w, r, err)
+		c.RenderError(w, r, localize(r, err))
 		return
 	}
 
 	thought, err := models.Thoughts.Get(r.PathValue("thought"))
 	if err != nil {
-		c.RenderError(w, r, application.ErrNotFound)
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
 		return
 	}
 
 	if thought.UserID != user.ID && !user.IsAdmin {
-		c.RenderError(w, r, application.ErrForbidden)
+		c.RenderError(w, r, localize(r, application.ErrForbidden))
 		return
 	}
 
 	block, err := models.ThoughtBlocks.Get(r.PathValue("block"))
 	if err != nil || block.ThoughtID != thought.ID {
-		c.RenderError(w, r, application.ErrNotFound)
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
 		return
 	}
 
-	deletedPosition := block.Position
-
-	if err := models.ThoughtBlocks.Delete(block); err != nil {
-		c.RenderError(w, r, err)
+	if err := models.DeleteBlock(block); err != nil {
+		c.RenderError(w, r, localize(r, err))
 		return
 	}
 
-	// Reorder remaining blocks
-	remainingBlocks := thought.Blocks()
-	for _, b := range remainingBlocks {
-		if b.Position > deletedPosition {
-			b.Position--
-			models.ThoughtBlocks.Update(b)
-		}
-	}
-
 	// Return empty response - HTMX will remove the element with hx-swap="outerHTML"
 	w.WriteHeader(http.StatusOK)
 }
@@ -541,18 +478,18 @@ func (c *ThoughtsController) createImageBlock(w http.ResponseWriter, r *http.Req
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.RenderError(w, r, err)
+		c.RenderError(w, r, localize(r, err))
 		return
 	}
 
 	thought, err := models.Thoughts.Get(r.PathValue("thought"))
 	if err != nil {
-		c.RenderError(w, r, application.ErrNotFound)
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
 		return
 	}
 
 	if thought.UserID != user.ID && !user.IsAdmin {
-		c.RenderError(w, r, application.ErrForbidden)
+		c.RenderError(w, r, localize(r, application.ErrForbidden))
 		return
 	}
 
@@ -560,21 +497,21 @@ func (c *ThoughtsController) createImageBlock(w http.ResponseWriter, r *http.Req
 	r.ParseMultipartForm(maxImageSize)
 	file, handler, err := r.FormFile("file")
 	if err != nil {
-		c.RenderError(w, r, errors.New("no file uploaded"))
+		c.RenderError(w, r, localize(r, errors.New("no file uploaded")))
 		return
 	}
 	defer file.Close()
 
 	// Validate file size
 	if handler.Size > maxImageSize {
-		c.RenderError(w, r, errors.New("image too large, max 10MB"))
+		c.RenderError(w, r, localize(r, errors.New("image too large, max 10MB")))
 		return
 	}
 
 	// Validate it's an image
 	mimeType := handler.Header.Get("Content-Type")
 	if !strings.HasPrefix(mimeType, "image/") {
-		c.RenderError(w, r, errors.New("file must be an image"))
+		c.RenderError(w, r, localize(r, errors.New("file must be an image")))
 		return
 	}
 
@@ -587,37 +524,32 @@ func (c *ThoughtsController) createImageBlock(w http.ResponseWriter, r *http.Req
 	// Read file content
 	var buf bytes.Buffer
 	if _, err := io.Copy(&buf, file); err != nil {
-		c.RenderError(w, r, err)
+		c.RenderError(w, r, localize(r, err))
 		return
 	}
 
 	// Create file record
-	fileModel, err := models.Files.Insert(&models.File{
-		OwnerID:  user.ID,
-		FilePath: filename,
-		MimeType: mimeType,
-		Content:  buf.Bytes(),
+	fileModel, err := scanning.Store(&models.File{
+		OwnerID:    user.ID,
+		FilePath:   filename,
+		MimeType:   mimeType,
+		Content:    buf.Bytes(),
+		Visibility: thought.FileVisibility(),
 	})
 	if err != nil {
-		c.RenderError(w, r, err)
+		c.RenderError(w, r, localize(r, err))
 		return
 	}
 
-	// Get next position
-	position := models.ThoughtBlocks.Count("WHERE ThoughtID = ?", thought.ID) + 1
-
-	// Create image block
-	block := &models.ThoughtBlock{
+	// Create image block at the end
+	created, err := models.InsertBlock(&models.ThoughtBlock{
 		ThoughtID: thought.ID,
 		Type:      "image",
 		Content:   "", // Caption can be added later
 		FileID:    fileModel.ID,
-		Position:  position,
-	}
-
-	created, err := models.ThoughtBlocks.Insert(block)
+	})
 	if err != nil {
-		c.RenderError(w, r, err)
+		c.RenderError(w, r, localize(r, err))
 		return
 	}
 
@@ -630,18 +562,18 @@ func (c *ThoughtsController) uploadHeader(w http.ResponseWriter, r *http.Request
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.RenderError(w, r, err)
+		c.RenderError(w, r, localize(r, err))
 		return
 	}
 
 	thought, err := models.Thoughts.Get(r.PathValue("thought"))
 	if err != nil {
-		c.RenderError(w, r, application.ErrNotFound)
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
 		return
 	}
 
 	if thought.UserID != user.ID && !user.IsAdmin {
-		c.RenderError(w, r, application.ErrForbidden)
+		c.RenderError(w, r, localize(r, application.ErrForbidden))
 		return
 	}
 
@@ -649,7 +581,7 @@ func (c *ThoughtsController) uploadHeader(w http.ResponseWriter, r *http.Request
 	r.ParseMultipartForm(maxImageSize)
 	file, handler, err := r.FormFile("file")
 	if err != nil {
-		c.RenderError(w, r, errors.New("no file uploaded"))
+		c.RenderError(w, r, localize(r, errors.New("no file uploaded")))
 		return
 	}
 	defer file.Close()
@@ -657,7 +589,7 @@ func (c *ThoughtsController) uploadHeader(w http.ResponseWriter, r *http.Request
 	// Validate it's an image
 	mimeType := handler.Header.Get("Content-Type")
 	if !strings.HasPrefix(mimeType, "image/") {
-		c.RenderError(w, r, errors.New("file must be an image"))
+		c.RenderError(w, r, localize(r, errors.New("file must be an image")))
 		return
 	}
 
@@ -670,26 +602,27 @@ func (c *ThoughtsController) uploadHeader(w http.ResponseWriter, r *http.Request
 	// Read file content
 	var buf bytes.Buffer
 	if _, err := io.Copy(&buf, file); err != nil {
-		c.RenderError(w, r, err)
+		c.RenderError(w, r, localize(r, err))
 		return
 	}
 
 	// Create file record
-	fileModel, err := models.Files.Insert(&models.File{
-		OwnerID:  user.ID,
-		FilePath: filename,
-		MimeType: mimeType,
-		Content:  buf.Bytes(),
+	fileModel, err := scanning.Store(&models.File{
+		OwnerID:    user.ID,
+		FilePath:   filename,
+		MimeType:   mimeType,
+		Content:    buf.Bytes(),
+		Visibility: thought.FileVisibility(),
 	})
 	if err != nil {
-		c.RenderError(w, r, err)
+		c.RenderError(w, r, localize(r, err))
 		return
 	}
 
 	// Update thought header
 	thought.HeaderImageID = fileModel.ID
 	if err := models.Thoughts.Update(thought); err != nil {
-		c.RenderError(w, r, err)
+		c.RenderError(w, r, localize(r, err))
 		return
 	}
 
@@ -702,18 +635,18 @@ func (c *ThoughtsController) reorderBlocks(w http.ResponseWriter, r *http.Reques
 	auth := c.Use("auth").(*AuthController)
 	user, _, err := auth.Authenticate(r)
 	if err != nil {
-		c.RenderError(w, r, err)
+		c.RenderError(w, r, localize(r, err))
 		return
 	}
 
 	thought, err := models.Thoughts.Get(r.PathValue("thought"))
 	if err != nil {
-		c.RenderError(w, r, application.ErrNotFound)
+		c.RenderError(w, r, localize(r, application.ErrNotFound))
 		return
 	}
 
 	if thought.UserID != user.ID && !user.IsAdmin {
-		c.RenderError(w, r, application.ErrForbidden)
+		c.RenderError(w, r, localize(r, application.ErrForbidden))
 		return
 	}
 
@@ -733,14 +666,14 @@ func (c *ThoughtsController) reorderBlocks(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Update each block's position
-	for i, blockID := range blockIDs {
-		block, err := models.ThoughtBlocks.Get(blockID)
-		if err != nil || block.ThoughtID != thought.ID {
-			continue // Skip invalid blocks
+	// Apply the whole order at once, or not at all if the blocks changed
+	if err := models.ReorderBlocks(thought.ID, blockIDs); err != nil {
+		if errors.Is(err, models.ErrBlockConflict) {
+			http.Error(w, localize(r, err).Error(), http.StatusConflict)
+			return
 		}
-		block.Position = i + 1
-		models.ThoughtBlocks.Update(block)
+		c.RenderError(w, r, localize(r, err))
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -24,7 +24,7 @@ func (c *UsersController) Setup(app *application.App) {
 	c.Controller.Setup(app)
 	auth := app.Use("auth").(*AuthController)
 
-	http.Handle("GET /users", app.Serve("users.html", auth.Optional))
+	route("GET /users", cached(app.Serve("users.html", auth.Optional)))
 }
 
 func (c UsersController) Handle(r *http.Request) application.Handler {
@@ -40,9 +40,12 @@ func (c *UsersController) AllProfiles() []*models.Profile {
 	users, _ := models.Profiles.Search(`
 	  INNER JOIN users on users.ID = profiles.UserID
 		WHERE
-			users.Name           LIKE $1        OR
-			users.Handle         LIKE LOWER($1) OR
-			profiles.Description LIKE $1
+			profiles.Suspended = false
+			AND (
+				users.Name           LIKE $1        OR
+				users.Handle         LIKE LOWER($1) OR
+				profiles.Description LIKE $1
+			)
 		ORDER BY profiles.CreatedAt
 		LIMIT $2 OFFSET $3
 	`, "%"+query+"%", limit, (page-1)*limit)
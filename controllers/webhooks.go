@@ -0,0 +1,272 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"www.theskyscape.com/internal/webhooks"
+	"www.theskyscape.com/models"
+)
+
+func Webhooks() (string, *WebhooksController) {
+	return "webhooks", &WebhooksController{}
+}
+
+type WebhooksController struct {
+	application.Controller
+}
+
+func (c *WebhooksController) Setup(app *application.App) {
+	c.Controller.Setup(app)
+	auth := c.Use("auth").(*AuthController)
+
+	go webhooks.Run(time.Minute)
+
+	route("GET /settings/webhooks", noindex(c.Serve("settings-webhooks.html", auth.Required)))
+	route("POST /settings/webhooks", c.ProtectFunc(c.create, auth.Required))
+	route("GET /settings/webhooks/{webhook}", noindex(c.Serve("settings-webhook.html", auth.Required)))
+	route("POST /settings/webhooks/{webhook}/ping", c.ProtectFunc(c.ping, auth.Required))
+	route("POST /settings/webhooks/{webhook}/secret", c.ProtectFunc(c.rotateSecret, auth.Required))
+	route("POST /settings/webhooks/{webhook}/enable", c.ProtectFunc(c.enable, auth.Required))
+	route("POST /settings/webhooks/{webhook}/deliveries/{delivery}/redeliver", c.ProtectFunc(c.redeliver, auth.Required))
+	route("DELETE /settings/webhooks/{webhook}", c.ProtectFunc(c.delete, auth.Required))
+}
+
+func (c WebhooksController) Handle(r *http.Request) application.Handler {
+	c.Request = r
+	return &c
+}
+
+// Hooks returns the current user's webhooks
+func (c *WebhooksController) Hooks() []*models.Webhook {
+	auth := c.Use("auth").(*AuthController)
+	user := auth.CurrentUser()
+	if user == nil {
+		return nil
+	}
+
+	hooks, _ := models.Webhooks.Search(`
+		WHERE UserID = ?
+		ORDER BY CreatedAt ASC
+	`, user.ID)
+	return hooks
+}
+
+// WebhookSubject is something a webhook can be registered on
+type WebhookSubject struct {
+	Value string // "account", "repo:{id}" or "project:{id}"
+	Label string
+}
+
+// Subjects lists the current user's account, repos and projects, for the
+// new webhook form. ?subject= preselects one, from a repo or project page.
+func (c *WebhooksController) Subjects() []WebhookSubject {
+	auth := c.Use("auth").(*AuthController)
+	user := auth.CurrentUser()
+	if user == nil {
+		return nil
+	}
+
+	subjects := []WebhookSubject{{models.WebhookAccount, "Everything you own"}}
+	repos, _ := models.Repos.Search("WHERE OwnerID = ? ORDER BY Name ASC", user.ID)
+	for _, repo := range repos {
+		subjects = append(subjects, WebhookSubject{models.WebhookRepo + ":" + repo.ID, "Repo " + repo.Name})
+	}
+	projects, _ := models.Projects.Search("WHERE OwnerID = ? ORDER BY Name ASC", user.ID)
+	for _, project := range projects {
+		subjects = append(subjects, WebhookSubject{models.WebhookProject + ":" + project.ID, "Project " + project.Name})
+	}
+	return subjects
+}
+
+// SelectedSubject returns the subject to preselect in the new webhook form
+func (c *WebhooksController) SelectedSubject() string {
+	return c.Request.URL.Query().Get("subject")
+}
+
+// Events lists the events a webhook can subscribe to
+func (c *WebhooksController) Events() []string {
+	return models.WebhookEvents
+}
+
+// CurrentHook returns the current user's webhook in the path
+func (c *WebhooksController) CurrentHook() *models.Webhook {
+	hook, err := c.ownHook(c.Request)
+	if err != nil {
+		return nil
+	}
+	return hook
+}
+
+func (c *WebhooksController) create(w http.ResponseWriter, r *http.Request) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	if models.Webhooks.Count("WHERE UserID = ?", user.ID) >= models.MaxWebhooks {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("you can register up to 20 webhooks")))
+		return
+	}
+
+	url := strings.TrimSpace(r.FormValue("url"))
+	if err := webhooks.Validate(url); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	subjectType, subjectID, _ := strings.Cut(r.FormValue("subject"), ":")
+	switch subjectType {
+	case models.WebhookAccount:
+		subjectID = ""
+	case models.WebhookRepo:
+		if repo, err := models.Repos.Get(subjectID); err != nil || repo.OwnerID != user.ID {
+			c.Render(w, r, "error-message.html", localize(r, errors.New("repo not found")))
+			return
+		}
+	case models.WebhookProject:
+		if project, err := models.Projects.Get(subjectID); err != nil || project.OwnerID != user.ID {
+			c.Render(w, r, "error-message.html", localize(r, errors.New("project not found")))
+			return
+		}
+	default:
+		c.Render(w, r, "error-message.html", localize(r, errors.New("choose what the webhook is for")))
+		return
+	}
+
+	r.ParseForm()
+	var events []string
+	for _, event := range r.Form["events"] {
+		if slices.Contains(models.WebhookEvents, event) && !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+	if len(events) == 0 {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("choose at least one event to send")))
+		return
+	}
+
+	hook, err := models.Webhooks.Insert(&models.Webhook{
+		UserID:      user.ID,
+		SubjectType: subjectType,
+		SubjectID:   subjectID,
+		URL:         url,
+		Events:      strings.Join(events, ","),
+	})
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	c.Redirect(w, r, "/settings/webhooks/"+hook.ID)
+}
+
+// ping sends a ping delivery, so owners can check their endpoint and its
+// signature verification before real events arrive
+func (c *WebhooksController) ping(w http.ResponseWriter, r *http.Request) {
+	hook, err := c.ownHook(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	delivery, err := webhooks.Queue(hook, models.WebhookPing, map[string]any{
+		"webhook": hook.ID,
+		"events":  hook.EventList(),
+	})
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+	webhooks.Attempt(hook, delivery)
+	c.Refresh(w, r)
+}
+
+func (c *WebhooksController) rotateSecret(w http.ResponseWriter, r *http.Request) {
+	hook, err := c.ownHook(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	hook.SecretVersion++
+	if err = models.Webhooks.Update(hook); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+	c.Refresh(w, r)
+}
+
+// enable turns a webhook back on after it was disabled for failing
+func (c *WebhooksController) enable(w http.ResponseWriter, r *http.Request) {
+	hook, err := c.ownHook(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	hook.Disabled = false
+	hook.Failures = 0
+	if err = models.Webhooks.Update(hook); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+	c.Refresh(w, r)
+}
+
+func (c *WebhooksController) redeliver(w http.ResponseWriter, r *http.Request) {
+	hook, err := c.ownHook(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	delivery, err := models.WebhookDeliveries.Get(r.PathValue("delivery"))
+	if err != nil || delivery.WebhookID != hook.ID {
+		c.Render(w, r, "error-message.html", localize(r, errors.New("delivery not found")))
+		return
+	}
+
+	if _, err = webhooks.Redeliver(hook, delivery); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+	c.Refresh(w, r)
+}
+
+func (c *WebhooksController) delete(w http.ResponseWriter, r *http.Request) {
+	hook, err := c.ownHook(r)
+	if err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+
+	if err = models.Webhooks.Delete(hook); err != nil {
+		c.Render(w, r, "error-message.html", localize(r, err))
+		return
+	}
+	models.DB.Query("DELETE FROM webhook_deliveries WHERE WebhookID = ?", hook.ID).Exec()
+
+	c.Redirect(w, r, "/settings/webhooks")
+}
+
+// ownHook loads the webhook in the path, if it belongs to the current user
+func (c *WebhooksController) ownHook(r *http.Request) (*models.Webhook, error) {
+	auth := c.Use("auth").(*AuthController)
+	user, _, err := auth.Authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+
+	hook, err := models.Webhooks.Get(r.PathValue("webhook"))
+	if err != nil || hook.UserID != user.ID {
+		return nil, application.ErrNotFound
+	}
+	return hook, nil
+}
@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"www.theskyscape.com/internal/imaging"
+	"www.theskyscape.com/models"
+)
+
+// widgetPolicy lets widgets be framed by any site while keeping the frame
+// itself inert: no scripts, no forms, only inline styles and images
+const widgetPolicy = "default-src 'none'; style-src 'unsafe-inline'; img-src 'self' https: data:; base-uri 'none'; form-action 'none'; frame-ancestors *"
+
+func Widgets() (string, *WidgetsController) {
+	return "widgets", &WidgetsController{}
+}
+
+type WidgetsController struct {
+	application.Controller
+}
+
+func (c *WidgetsController) Setup(app *application.App) {
+	c.Controller.Setup(app)
+
+	route("GET /embed.js", http.HandlerFunc(c.script))
+	route("GET /embed/repo/{id}/star", widget(c.repoStar))
+	route("GET /embed/project/{id}/star", widget(c.projectStar))
+	route("GET /embed/project/{id}/deployed", widget(c.projectDeployed))
+	route("GET /embed/app/{id}/deployed", widget(c.appDeployed))
+	route("GET /embed/user/{handle}/card", widget(c.profileCard))
+
+	// Shields-style badges for READMEs
+	route("GET /badge/app/{id}/status.svg", http.HandlerFunc(c.appStatusBadge))
+	route("GET /badge/project/{id}/status.svg", http.HandlerFunc(c.projectStatusBadge))
+	route("GET /badge/repo/{id}/stars.svg", http.HandlerFunc(c.repoStarsBadge))
+	route("GET /badge/project/{id}/stars.svg", http.HandlerFunc(c.projectStarsBadge))
+	route("GET /badge/repo/{id}/health.svg", http.HandlerFunc(c.repoHealthBadge))
+	route("GET /badge/project/{id}/health.svg", http.HandlerFunc(c.projectHealthBadge))
+}
+
+func (c WidgetsController) Handle(r *http.Request) application.Handler {
+	c.Request = r
+	return &c
+}
+
+// widget serves a handler as a frameable, cacheable, unindexed widget
+func widget(handler http.HandlerFunc) http.Handler {
+	return noindex(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", widgetPolicy)
+		w.Header().Set("Cross-Origin-Resource-Policy", "cross-origin")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		handler(w, r)
+	}))
+}
+
+// script replaces widget placeholders on other sites with iframes
+func (c *WidgetsController) script(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/javascript")
+	w.Header().Set("Cross-Origin-Resource-Policy", "cross-origin")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	c.Render(w, r, "embed.js", nil)
+}
+
+func (c *WidgetsController) repoStar(w http.ResponseWriter, r *http.Request) {
+	repo, err := models.Repos.Get(r.PathValue("id"))
+	if err != nil || repo.Takedown() != nil || models.ActiveSuspension(repo.OwnerID) != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	c.Render(w, r, "embed-star.html", map[string]any{
+		"Name":  repo.Name,
+		"Stars": repo.StarsCount(),
+		"URL":   "/repo/" + repo.ID,
+	})
+}
+
+func (c *WidgetsController) projectStar(w http.ResponseWriter, r *http.Request) {
+	project, err := models.Projects.Get(r.PathValue("id"))
+	if err != nil || project.Status == "shutdown" || project.Takedown() != nil || models.ActiveSuspension(project.OwnerID) != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	c.Render(w, r, "embed-star.html", map[string]any{
+		"Name":  project.Name,
+		"Stars": project.StarsCount(),
+		"URL":   "/project/" + project.ID,
+	})
+}
+
+func (c *WidgetsController) projectDeployed(w http.ResponseWriter, r *http.Request) {
+	project, err := models.Projects.Get(r.PathValue("id"))
+	if err != nil || project.Status == "shutdown" || project.Takedown() != nil || models.ActiveSuspension(project.OwnerID) != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	c.Render(w, r, "embed-deployed.html", map[string]any{
+		"Name": project.Name,
+		"URL":  "/project/" + project.ID,
+	})
+}
+
+func (c *WidgetsController) appDeployed(w http.ResponseWriter, r *http.Request) {
+	app, err := models.Apps.Get(r.PathValue("id"))
+	if err != nil || app.Status == "shutdown" || app.Takedown() != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if owner := app.Owner(); owner == nil || models.ActiveSuspension(owner.ID) != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	c.Render(w, r, "embed-deployed.html", map[string]any{
+		"Name": app.Name,
+		"URL":  "/app/" + app.ID,
+	})
+}
+
+func (c *WidgetsController) profileCard(w http.ResponseWriter, r *http.Request) {
+	user, err := models.Auth.LookupUser(r.PathValue("handle"))
+	if err != nil || user == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	profile, err := models.Profiles.Get(user.ID)
+	if err != nil || profile.Suspended {
+		http.NotFound(w, r)
+		return
+	}
+
+	c.Render(w, r, "embed-profile.html", profile)
+}
+
+// badgeTTL is how long clients and README proxies may cache a badge
+const badgeTTL = 5 * time.Minute
+
+// badge serves an SVG badge, answering revalidations with 304 when the
+// badge hasn't changed
+func badge(w http.ResponseWriter, r *http.Request, label, message, color string) {
+	svg := imaging.Badge(label, message, color)
+	sum := sha256.Sum256(svg)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	w.Header().Set("Cross-Origin-Resource-Policy", "cross-origin")
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(badgeTTL.Seconds())))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Write(svg)
+}
+
+// statusColor picks a badge color for an app or project status
+func statusColor(status string) string {
+	switch status {
+	case "online":
+		return imaging.BadgeGreen
+	case "launching":
+		return imaging.BadgeBlue
+	case "draft", "offline":
+		return imaging.BadgeGrey
+	default:
+		return imaging.BadgeRed
+	}
+}
+
+func (c *WidgetsController) appStatusBadge(w http.ResponseWriter, r *http.Request) {
+	app, err := models.Apps.Get(r.PathValue("id"))
+	if err != nil || app.Takedown() != nil {
+		badge(w, r, "status", "not found", imaging.BadgeGrey)
+		return
+	}
+	badge(w, r, "status", app.Status, statusColor(app.Status))
+}
+
+func (c *WidgetsController) projectStatusBadge(w http.ResponseWriter, r *http.Request) {
+	project, err := models.Projects.Get(r.PathValue("id"))
+	if err != nil || project.Takedown() != nil {
+		badge(w, r, "status", "not found", imaging.BadgeGrey)
+		return
+	}
+	badge(w, r, "status", project.Status, statusColor(project.Status))
+}
+
+func (c *WidgetsController) repoStarsBadge(w http.ResponseWriter, r *http.Request) {
+	repo, err := models.Repos.Get(r.PathValue("id"))
+	if err != nil || repo.Takedown() != nil {
+		badge(w, r, "stars", "not found", imaging.BadgeGrey)
+		return
+	}
+	badge(w, r, "stars", strconv.Itoa(repo.StarsCount()), imaging.BadgeBlue)
+}
+
+func (c *WidgetsController) projectStarsBadge(w http.ResponseWriter, r *http.Request) {
+	project, err := models.Projects.Get(r.PathValue("id"))
+	if err != nil || project.Takedown() != nil {
+		badge(w, r, "stars", "not found", imaging.BadgeGrey)
+		return
+	}
+	badge(w, r, "stars", strconv.Itoa(project.StarsCount()), imaging.BadgeBlue)
+}
+
+// healthBadge shows how many health checks pass, e.g. "3/4"
+func healthBadge(w http.ResponseWriter, r *http.Request, health *models.Health) {
+	color := imaging.BadgeRed
+	switch {
+	case health.Healthy():
+		color = imaging.BadgeGreen
+	case health.Percent() >= 50:
+		color = imaging.BadgeYellow
+	}
+	badge(w, r, "health", strconv.Itoa(health.Passed())+"/"+strconv.Itoa(len(health.Checks)), color)
+}
+
+func (c *WidgetsController) repoHealthBadge(w http.ResponseWriter, r *http.Request) {
+	repo, err := models.Repos.Get(r.PathValue("id"))
+	if err != nil || repo.Takedown() != nil {
+		badge(w, r, "health", "not found", imaging.BadgeGrey)
+		return
+	}
+	healthBadge(w, r, repo.Health())
+}
+
+func (c *WidgetsController) projectHealthBadge(w http.ResponseWriter, r *http.Request) {
+	project, err := models.Projects.Get(r.PathValue("id"))
+	if err != nil || project.Takedown() != nil {
+		badge(w, r, "health", "not found", imaging.BadgeGrey)
+		return
+	}
+	healthBadge(w, r, project.Health())
+}
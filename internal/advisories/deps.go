@@ -0,0 +1,117 @@
+package advisories
+
+import (
+	"encoding/json"
+	"strings"
+
+	"www.theskyscape.com/internal/git"
+)
+
+// Ecosystems, named as the OSV database names them
+const (
+	Go  = "Go"
+	NPM = "npm"
+)
+
+// Dependency is a package version a project builds with
+type Dependency struct {
+	Ecosystem string
+	Name      string
+	Version   string
+}
+
+// Dependencies reads the dependencies pinned in go.mod and
+// package-lock.json at the root of a commit. Missing files are skipped.
+func Dependencies(repoPath, commit string) []Dependency {
+	var deps []Dependency
+	if data, ok := readFile(repoPath, commit, "go.mod"); ok {
+		deps = append(deps, parseGoMod(data)...)
+	}
+	if data, ok := readFile(repoPath, commit, "package-lock.json"); ok {
+		deps = append(deps, parsePackageLock(data)...)
+	}
+	return deps
+}
+
+func readFile(repoPath, commit, path string) ([]byte, bool) {
+	stdout, _, err := git.Exec(repoPath, "show", commit+":"+path)
+	if err != nil {
+		return nil, false
+	}
+	return stdout.Bytes(), true
+}
+
+// parseGoMod returns the modules in go.mod's require directives
+func parseGoMod(data []byte) []Dependency {
+	var deps []Dependency
+	inBlock := false
+	for line := range strings.SplitSeq(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "//")
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+			continue
+		case inBlock && fields[0] == ")":
+			inBlock = false
+			continue
+		case fields[0] == "require" && len(fields) == 2 && fields[1] == "(":
+			inBlock = true
+			continue
+		case fields[0] == "require" && len(fields) == 3:
+			fields = fields[1:]
+		case !inBlock:
+			continue
+		}
+
+		if len(fields) == 2 {
+			deps = append(deps, Dependency{
+				Ecosystem: Go,
+				Name:      fields[0],
+				Version:   strings.TrimPrefix(fields[1], "v"),
+			})
+		}
+	}
+	return deps
+}
+
+// packageLock covers lockfile v1 ("dependencies") and v2/v3 ("packages")
+type packageLock struct {
+	Packages map[string]struct {
+		Version string `json:"version"`
+	} `json:"packages"`
+	Dependencies map[string]struct {
+		Version string `json:"version"`
+	} `json:"dependencies"`
+}
+
+// parsePackageLock returns every installed package in package-lock.json
+func parsePackageLock(data []byte) []Dependency {
+	var lock packageLock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil
+	}
+
+	seen := map[Dependency]bool{}
+	var deps []Dependency
+	add := func(name, version string) {
+		dep := Dependency{Ecosystem: NPM, Name: name, Version: version}
+		if name != "" && version != "" && !seen[dep] {
+			seen[dep] = true
+			deps = append(deps, dep)
+		}
+	}
+
+	for path, pkg := range lock.Packages {
+		// Keys are install paths like "node_modules/a/node_modules/b"; the
+		// root package has the key ""
+		if i := strings.LastIndex(path, "node_modules/"); i >= 0 {
+			add(path[i+len("node_modules/"):], pkg.Version)
+		}
+	}
+	if len(lock.Packages) == 0 {
+		for name, pkg := range lock.Dependencies {
+			add(name, pkg.Version)
+		}
+	}
+	return deps
+}
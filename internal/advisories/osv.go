@@ -0,0 +1,188 @@
+package advisories
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"www.theskyscape.com/models"
+)
+
+// osvAPI is the Open Source Vulnerabilities database, which aggregates the
+// GitHub, Go and npm advisory databases
+const osvAPI = "https://api.osv.dev/v1"
+
+// osvBatchSize is the most queries OSV accepts in one batch
+const osvBatchSize = 1000
+
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// Finding is an advisory affecting one dependency
+type Finding struct {
+	Dependency
+	AdvisoryID string
+	Summary    string
+	Severity   string
+	FixedIn    string
+}
+
+type osvQuery struct {
+	Package struct {
+		Name      string `json:"name"`
+		Ecosystem string `json:"ecosystem"`
+	} `json:"package"`
+	Version string `json:"version"`
+}
+
+type osvVuln struct {
+	ID               string `json:"id"`
+	Summary          string `json:"summary"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+	Affected []struct {
+		Package struct {
+			Name      string `json:"name"`
+			Ecosystem string `json:"ecosystem"`
+		} `json:"package"`
+		Ranges []struct {
+			Events []struct {
+				Fixed string `json:"fixed"`
+			} `json:"events"`
+		} `json:"ranges"`
+	} `json:"affected"`
+}
+
+// Check looks up every dependency in OSV and returns the advisories that
+// affect them
+func Check(deps []Dependency) ([]Finding, error) {
+	var findings []Finding
+	details := map[string]*osvVuln{}
+
+	for start := 0; start < len(deps); start += osvBatchSize {
+		batch := deps[start:min(start+osvBatchSize, len(deps))]
+		results, err := queryBatch(batch)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, ids := range results {
+			for _, id := range ids {
+				vuln, ok := details[id]
+				if !ok {
+					if vuln, err = fetchVuln(id); err != nil {
+						return nil, err
+					}
+					details[id] = vuln
+				}
+				findings = append(findings, finding(batch[i], vuln))
+			}
+		}
+	}
+	return findings, nil
+}
+
+// queryBatch returns the IDs of the advisories affecting each dependency
+func queryBatch(deps []Dependency) ([][]string, error) {
+	queries := make([]osvQuery, len(deps))
+	for i, dep := range deps {
+		queries[i].Package.Name = dep.Name
+		queries[i].Package.Ecosystem = dep.Ecosystem
+		queries[i].Version = dep.Version
+	}
+
+	body, err := json.Marshal(map[string]any{"queries": queries})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Post(osvAPI+"/querybatch", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query advisories")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("advisory database responded with %s", resp.Status)
+	}
+
+	var result struct {
+		Results []struct {
+			Vulns []struct {
+				ID string `json:"id"`
+			} `json:"vulns"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, errors.Wrap(err, "failed to decode advisories")
+	}
+
+	ids := make([][]string, len(deps))
+	for i, r := range result.Results {
+		if i >= len(ids) {
+			break
+		}
+		for _, v := range r.Vulns {
+			ids[i] = append(ids[i], v.ID)
+		}
+	}
+	return ids, nil
+}
+
+func fetchVuln(id string) (*osvVuln, error) {
+	resp, err := client.Get(osvAPI + "/vulns/" + url.PathEscape(id))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch advisory "+id)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("advisory database responded with %s for %s", resp.Status, id)
+	}
+
+	var vuln osvVuln
+	if err := json.NewDecoder(resp.Body).Decode(&vuln); err != nil {
+		return nil, errors.Wrap(err, "failed to decode advisory "+id)
+	}
+	return &vuln, nil
+}
+
+func finding(dep Dependency, vuln *osvVuln) Finding {
+	f := Finding{
+		Dependency: dep,
+		AdvisoryID: vuln.ID,
+		Summary:    vuln.Summary,
+		Severity:   severity(vuln.DatabaseSpecific.Severity),
+	}
+	for _, affected := range vuln.Affected {
+		if affected.Package.Name != dep.Name || affected.Package.Ecosystem != dep.Ecosystem {
+			continue
+		}
+		for _, r := range affected.Ranges {
+			for _, e := range r.Events {
+				if e.Fixed != "" {
+					f.FixedIn = e.Fixed
+				}
+			}
+		}
+	}
+	return f
+}
+
+// severity normalizes the GitHub advisory severities OSV passes through
+func severity(s string) string {
+	switch strings.ToLower(s) {
+	case "critical":
+		return models.SeverityCritical
+	case "high":
+		return models.SeverityHigh
+	case "moderate", "medium":
+		return models.SeverityModerate
+	case "low":
+		return models.SeverityLow
+	default:
+		return models.SeverityUnknown
+	}
+}
@@ -0,0 +1,88 @@
+package advisories
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/emailing"
+	"www.theskyscape.com/internal/i18n"
+	"www.theskyscape.com/models"
+)
+
+// ScanProject checks the dependencies of a project build against the
+// advisory database and replaces the project's alerts with the results.
+// The owner is emailed about critical advisories the last scan didn't have.
+func ScanProject(projectID, gitHash string) {
+	// Uploaded archives aren't in the repository, so there's nothing to read
+	if strings.HasPrefix(gitHash, "upload-") {
+		return
+	}
+
+	project, err := models.Projects.Get(projectID)
+	if err != nil {
+		slog.Error("failed to load project for advisory scan", "project_id", projectID, "error", err)
+		return
+	}
+
+	findings, err := Check(Dependencies(project.Path(), gitHash))
+	if err != nil {
+		slog.Error("advisory scan failed", "project_id", projectID, "git_hash", gitHash, "error", err)
+		return
+	}
+
+	previous := map[string]bool{}
+	for _, alert := range project.VulnerabilityAlerts() {
+		previous[alert.AdvisoryID+" "+alert.Package] = true
+		models.VulnerabilityAlerts.Delete(alert)
+	}
+
+	var critical []*models.VulnerabilityAlert
+	for _, f := range findings {
+		alert, err := models.VulnerabilityAlerts.Insert(&models.VulnerabilityAlert{
+			ProjectID:  project.ID,
+			GitHash:    gitHash,
+			Ecosystem:  f.Ecosystem,
+			Package:    f.Name,
+			Version:    f.Version,
+			AdvisoryID: f.AdvisoryID,
+			Summary:    f.Summary,
+			Severity:   f.Severity,
+			FixedIn:    f.FixedIn,
+		})
+		if err != nil {
+			slog.Error("failed to save vulnerability alert", "project_id", projectID, "advisory", f.AdvisoryID, "error", err)
+			continue
+		}
+		if alert.Severity == models.SeverityCritical && !previous[alert.AdvisoryID+" "+alert.Package] {
+			critical = append(critical, alert)
+		}
+	}
+
+	if len(findings) > 0 {
+		slog.Info("vulnerable dependencies found", "project_id", projectID, "git_hash", gitHash, "alerts", len(findings), "new_critical", len(critical))
+	}
+	if len(critical) > 0 {
+		notifyOwner(project, critical)
+	}
+}
+
+// notifyOwner emails the project owner about new critical advisories
+func notifyOwner(project *models.Project, alerts []*models.VulnerabilityAlert) {
+	owner, err := models.Auth.Users.Get(project.OwnerID)
+	if err != nil {
+		slog.Error("failed to load project owner", "project_id", project.ID, "error", err)
+		return
+	}
+
+	locale := models.EmailLocale(owner.ID)
+	models.SendEmail(owner.Email,
+		i18n.T(locale, "Critical vulnerability in %s", project.Name),
+		"vulnerability-alert.html",
+		emailing.WithData("t", i18n.For(locale)),
+		emailing.WithData("user", owner),
+		emailing.WithData("project", project),
+		emailing.WithData("alerts", alerts),
+		emailing.WithData("year", time.Now().Year()),
+	)
+}
@@ -0,0 +1,181 @@
+// Package analytics counts page views of deployed apps and projects whose
+// owners opted in. Views are counted in the reverse proxy, so apps don't
+// need a tracking script, and only daily aggregates are stored: visitors
+// are told apart by hashing their IP and user agent with a salt that is
+// replaced every day and never written down, and referrers are reduced to
+// their host.
+package analytics
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"www.theskyscape.com/internal/clientip"
+	"www.theskyscape.com/models"
+)
+
+// maxValues bounds how many distinct pages, referrers or countries are
+// kept per site between flushes; the rest are counted as "(other)"
+const maxValues = 200
+
+// enabledTTL is how long a site's opt-in is cached by the proxy
+const enabledTTL = time.Minute
+
+type key struct {
+	site, day, dimension, value string
+}
+
+var (
+	mu       sync.Mutex
+	day      string
+	salt     [16]byte
+	seen     = map[uint64]bool{}   // Today's visitor hashes
+	views    = map[key]int{}       // Views since the last flush
+	visitors = map[key]int{}       // New visitors per site and day since the last flush
+	distinct = map[string]int{}    // Distinct values per site since the last flush
+	enabled  = map[string]cached{} // Opt-ins, cached for enabledTTL
+)
+
+type cached struct {
+	on      bool
+	expires time.Time
+}
+
+// Enabled reports whether an app or project opted in to analytics
+func Enabled(siteID string) bool {
+	mu.Lock()
+	c, ok := enabled[siteID]
+	mu.Unlock()
+	if ok && time.Now().Before(c.expires) {
+		return c.on
+	}
+
+	on := false
+	if project, err := models.Projects.Get(siteID); err == nil {
+		on = project.AnalyticsEnabled
+	} else if app, err := models.Apps.Get(siteID); err == nil {
+		on = app.AnalyticsEnabled
+	}
+
+	mu.Lock()
+	enabled[siteID] = cached{on, time.Now().Add(enabledTTL)}
+	mu.Unlock()
+	return on
+}
+
+// Forget drops a site's cached opt-in after its owner changes it
+func Forget(siteID string) {
+	mu.Lock()
+	delete(enabled, siteID)
+	mu.Unlock()
+}
+
+// IsPageView reports whether a proxied response is a page a person viewed:
+// a successful HTML document fetched with GET by something other than a bot
+func IsPageView(r *http.Request, resp *http.Response) bool {
+	if r.Method != http.MethodGet || resp.StatusCode != http.StatusOK {
+		return false
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		return false
+	}
+	if r.Header.Get("HX-Request") != "" || r.Header.Get("Purpose") == "prefetch" {
+		return false
+	}
+	ua := strings.ToLower(r.UserAgent())
+	return ua != "" && !strings.Contains(ua, "bot") && !strings.Contains(ua, "spider") && !strings.Contains(ua, "crawl")
+}
+
+// Record counts a page view of a site
+func Record(siteID string, r *http.Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	rotate()
+	total := key{siteID, day, models.VisitTotal, ""}
+	views[total]++
+	add(siteID, models.VisitPage, r.URL.Path)
+	add(siteID, models.VisitCountry, country(r))
+	if ref := referrer(r); ref != "" {
+		add(siteID, models.VisitReferrer, ref)
+	}
+
+	h := sha256.New()
+	h.Write(salt[:])
+	h.Write([]byte(siteID + "\x00" + clientip.From(r) + "\x00" + r.UserAgent()))
+	visitor := binary.BigEndian.Uint64(h.Sum(nil))
+	if !seen[visitor] {
+		seen[visitor] = true
+		visitors[total]++
+	}
+}
+
+// add counts a view for one dimension value. Callers hold mu.
+func add(siteID, dimension, value string) {
+	k := key{siteID, day, dimension, value}
+	if _, ok := views[k]; !ok {
+		if distinct[siteID] >= maxValues {
+			k.value = "(other)"
+		} else {
+			distinct[siteID]++
+		}
+	}
+	views[k]++
+}
+
+// rotate starts a new day with a new salt, so visitors can't be linked
+// across days. Callers hold mu.
+func rotate() {
+	today := time.Now().UTC().Format(time.DateOnly)
+	if today == day {
+		return
+	}
+	day = today
+	rand.Read(salt[:])
+	clear(seen)
+}
+
+// Flush writes the counts gathered since the last flush
+func Flush() {
+	mu.Lock()
+	pending, newVisitors := views, visitors
+	views, visitors, distinct = map[key]int{}, map[key]int{}, map[string]int{}
+	mu.Unlock()
+
+	for k, n := range pending {
+		if err := models.AddSiteVisits(k.site, k.day, k.dimension, k.value, n, newVisitors[k]); err != nil {
+			slog.Error("failed to save site visits", "site_id", k.site, "error", err)
+		}
+	}
+}
+
+// Run flushes counts on an interval
+func Run(interval time.Duration) {
+	for range time.Tick(interval) {
+		Flush()
+	}
+}
+
+// referrer returns the host of an external referrer
+func referrer(r *http.Request) string {
+	ref, err := url.Parse(r.Referer())
+	if err != nil || ref.Host == "" || ref.Host == r.Host {
+		return ""
+	}
+	return strings.TrimPrefix(ref.Host, "www.")
+}
+
+// country returns the visitor's country from the edge's geolocation header
+func country(r *http.Request) string {
+	if code := r.Header.Get("CF-IPCountry"); len(code) == 2 && code != "XX" {
+		return strings.ToUpper(code)
+	}
+	return "Unknown"
+}
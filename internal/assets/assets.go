@@ -0,0 +1,99 @@
+// Package assets serves the files in views/public under content-hashed
+// URLs (e.g. /assets/3f2a9c01be/skyscape.js) that can be cached forever,
+// since a changed file gets a new URL on the next deploy. URLs can point at
+// a CDN that pulls from this server.
+package assets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Prefix is the path assets are served under
+const Prefix = "/assets/"
+
+var (
+	files  fs.FS
+	hashes = map[string]string{}
+	base   string
+)
+
+// Load hashes every file in the public directory of views. baseURL is
+// prepended to asset URLs: a CDN origin, the host prefix, or "".
+func Load(views fs.FS, baseURL string) error {
+	public, err := fs.Sub(views, "views/public")
+	if err != nil {
+		return err
+	}
+
+	files = public
+	base = strings.TrimSuffix(baseURL, "/")
+	return fs.WalkDir(public, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(public, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		hashes[name] = hex.EncodeToString(sum[:5])
+		return nil
+	})
+}
+
+// URL returns the fingerprinted URL of a file in views/public, such as
+// "skyscape.js" or "styles/markdown.css". Unknown files fall back to their
+// unversioned /public URL.
+func URL(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	hash, ok := hashes[name]
+	if !ok {
+		slog.Warn("unknown asset", "name", name)
+		return base + "/public/" + name
+	}
+	return base + Prefix + hash + "/" + name
+}
+
+// Handler serves GET /assets/{hash}/{path...}. Requests with the current
+// hash are cached for a year; stale hashes from a previous deploy still get
+// the current file, but browsers must revalidate it.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean(r.PathValue("path"))
+		hash, ok := hashes[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		data, err := fs.ReadFile(files, name)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		if r.PathValue("hash") == hash {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			w.Header().Set("Cache-Control", "public, no-cache")
+		}
+		if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.Header().Set("ETag", `"`+hash+`"`)
+		w.Header().Set("Access-Control-Allow-Origin", "*") // Served cross-origin from the CDN
+
+		if r.Header.Get("If-None-Match") == `"`+hash+`"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write(data)
+	})
+}
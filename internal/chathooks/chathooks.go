@@ -0,0 +1,128 @@
+// Package chathooks relays a user's notifications to their own Slack,
+// Discord or Telegram chat through incoming webhooks they configure in
+// settings. Hook URLs are restricted to each service's API host so a hook
+// can't be pointed at internal addresses.
+package chathooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"www.theskyscape.com/models"
+)
+
+// Supported services
+const (
+	Slack    = "slack"
+	Discord  = "discord"
+	Telegram = "telegram"
+)
+
+// siteURL makes notification links absolute for chat clients
+const siteURL = "https://www.theskyscape.com"
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+var telegramToken = regexp.MustCompile(`^[0-9]+:[A-Za-z0-9_-]+$`)
+
+// Validate checks a hook's service and destination before it is saved
+func Validate(service, url, chatID string) error {
+	switch service {
+	case Slack:
+		if !strings.HasPrefix(url, "https://hooks.slack.com/") {
+			return errors.New("Slack webhook URLs start with https://hooks.slack.com/")
+		}
+	case Discord:
+		if !strings.HasPrefix(url, "https://discord.com/api/webhooks/") &&
+			!strings.HasPrefix(url, "https://discordapp.com/api/webhooks/") {
+			return errors.New("Discord webhook URLs start with https://discord.com/api/webhooks/")
+		}
+	case Telegram:
+		if !telegramToken.MatchString(url) {
+			return errors.New("enter the bot token from @BotFather")
+		}
+		if chatID == "" {
+			return errors.New("a Telegram chat ID is required")
+		}
+	default:
+		return errors.New("unsupported chat service")
+	}
+	return nil
+}
+
+// Relay sends a notification to each of the user's hooks subscribed to its
+// kind. Failures are recorded on the hook for the settings page to show.
+func Relay(userID, kind, title, body, url string) {
+	hooks, err := models.NotificationHooks.Search("WHERE UserID = ?", userID)
+	if err != nil {
+		slog.Error("failed to load notification hooks", "user_id", userID, "error", err)
+		return
+	}
+
+	for _, hook := range hooks {
+		if !hook.Relays(kind) {
+			continue
+		}
+
+		err := Send(hook, title, body, url)
+		if err != nil {
+			slog.Warn("notification hook failed", "hook_id", hook.ID, "service", hook.Service, "error", err)
+			hook.LastError = err.Error()
+		} else {
+			hook.LastError = ""
+			hook.LastSentAt = time.Now()
+		}
+		models.NotificationHooks.Update(hook)
+	}
+}
+
+// Send posts a single notification to a hook
+func Send(hook *models.NotificationHook, title, body, url string) error {
+	link := url
+	if strings.HasPrefix(link, "/") {
+		link = siteURL + link
+	}
+
+	var endpoint string
+	var payload any
+	switch hook.Service {
+	case Slack:
+		endpoint = hook.URL
+		payload = map[string]string{"text": fmt.Sprintf("*%s*\n%s\n<%s>", title, body, link)}
+	case Discord:
+		endpoint = hook.URL
+		payload = map[string]string{"content": fmt.Sprintf("**%s**\n%s\n%s", title, body, link)}
+	case Telegram:
+		endpoint = "https://api.telegram.org/bot" + hook.URL + "/sendMessage"
+		payload = map[string]string{
+			"chat_id": hook.ChatID,
+			"text":    fmt.Sprintf("%s\n%s\n%s", title, body, link),
+		}
+	default:
+		return errors.New("unsupported chat service")
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(endpoint, "application/json", bytes.NewReader(data))
+	if err != nil {
+		// Don't leak the Telegram bot token, which is part of the URL
+		return errors.New("could not reach " + hook.Service)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("%s responded with %s", hook.Service, resp.Status)
+	}
+	return nil
+}
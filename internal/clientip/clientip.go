@@ -0,0 +1,89 @@
+// Package clientip finds the IP a request came from. Forwarding headers
+// are only believed when the connection comes from a trusted proxy, and
+// then only the entries trusted proxies added, since the client can send
+// any X-Forwarded-For it likes.
+package clientip
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// trusted are the proxies whose forwarding headers are believed: the
+// TRUSTED_PROXIES networks, or loopback and private addresses where the
+// TLS edge runs beside the server
+var trusted = parseTrusted(os.Getenv("TRUSTED_PROXIES"))
+
+func parseTrusted(value string) []netip.Prefix {
+	if strings.TrimSpace(value) == "" {
+		value = "127.0.0.0/8,::1/128,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,fc00::/7"
+	}
+
+	var prefixes []netip.Prefix
+	for entry := range strings.SplitSeq(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(entry); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+	return prefixes
+}
+
+// From returns the IP a request came from. A connection from a trusted
+// proxy is followed back through X-Forwarded-For from the right, past the
+// entries other trusted proxies added, to the first address none of them
+// vouches for; X-Real-IP is used when there's no X-Forwarded-For.
+func From(r *http.Request) string {
+	ip := remoteIP(r.RemoteAddr)
+	if !isTrusted(ip) {
+		return ip
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		entries := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(entries) - 1; i >= 0; i-- {
+			entry := strings.TrimSpace(entries[i])
+			if _, err := netip.ParseAddr(entry); err != nil {
+				break // Garbage can't be followed any further
+			}
+			ip = entry
+			if !isTrusted(entry) {
+				break
+			}
+		}
+		return ip
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		if _, err := netip.ParseAddr(realIP); err == nil {
+			return realIP
+		}
+	}
+	return ip
+}
+
+func remoteIP(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+func isTrusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
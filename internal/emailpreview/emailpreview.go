@@ -0,0 +1,179 @@
+// Package emailpreview renders the embedded email templates with sample
+// data, so admins can check a template change without triggering the flow
+// that sends it.
+package emailpreview
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/The-Skyscape/devtools/pkg/authentication"
+	"github.com/The-Skyscape/devtools/pkg/emailing"
+	"www.theskyscape.com/internal/i18n"
+	"www.theskyscape.com/models"
+)
+
+var templates fs.FS
+
+// Load keeps the email templates for previews. Call it with the same FS
+// given to models.Emails.LoadTemplates.
+func Load(fsys fs.FS) {
+	templates = fsys
+}
+
+// Names lists the email templates, without partials
+func Names() []string {
+	if templates == nil {
+		return nil
+	}
+	names, _ := fs.Glob(templates, "*.html")
+	sort.Strings(names)
+	return names
+}
+
+// Sample is a template's subject and data as a real send would give them
+type Sample struct {
+	Subject string
+	Data    map[string]any
+}
+
+// SampleFor builds sample data for a template, with user standing in for
+// everyone the email mentions
+func SampleFor(name, locale string, user *authentication.User) *Sample {
+	data := map[string]any{
+		"t":     i18n.For(locale),
+		"user":  user,
+		"year":  time.Now().Year(),
+		"Title": "Sample",
+	}
+	subject := "Sample email"
+
+	switch name {
+	case "broadcast.html":
+		subject = "Sample broadcast"
+		data["Title"] = subject
+		data["body"] = template.HTML("<p>This is a <strong>sample</strong> broadcast body.</p>")
+		data["unsubscribe"] = "https://www.theskyscape.com/unsubscribe"
+	case "content-removed.html", "content-restored.html":
+		subject = i18n.T(locale, "Your content was removed")
+		if name == "content-restored.html" {
+			subject = i18n.T(locale, "Your content was restored")
+		}
+		data["Title"] = subject
+		data["takedown"] = &models.Takedown{
+			Model:       application.Model{ID: "sample"},
+			SubjectType: models.TakedownPost,
+			SubjectID:   "sample",
+			Reason:      "Sample reason for the takedown.",
+		}
+	case "invite.html":
+		subject = "Your invite to The Skyscape"
+		data["Title"] = "You're Invited"
+		data["name"] = user.Name
+		data["invite"] = &models.Invite{Code: "SAMPLE"}
+	case "malware-detected.html":
+		subject = "Quarantined upload: Sample.Signature"
+		data["Title"] = "Upload Quarantined"
+		data["admin"] = user
+		data["owner"] = user
+		data["file"] = &models.File{
+			Model:      application.Model{ID: "sample"},
+			FilePath:   "uploads/sample.exe",
+			MimeType:   "application/octet-stream",
+			ScanResult: "Sample.Signature",
+		}
+	case "new-comment.html":
+		subject = i18n.T(locale, "New comment on your post")
+		data["commenter"] = user
+		data["recipient"] = user
+		data["comment"] = "This is a sample comment."
+	case "new-follower.html":
+		subject = i18n.T(locale, "New Follower on The Skyscape")
+		data["follower"] = user
+	case "new-message.html":
+		subject = i18n.T(locale, "New Message from %s", user.Handle)
+		data["Title"] = i18n.T(locale, "New Message")
+		data["recipient"] = user
+		data["sender"] = user
+	case "new-post.html":
+		subject = i18n.T(locale, "New post from %s", user.Name)
+		data["poster"] = user
+		data["recipient"] = user
+		data["preview"] = "This is a sample post."
+	case "new-star.html":
+		star := &models.StarSubject{Type: models.StarThought, ID: "sample", Name: "A sample thought", URL: "/thought/sample"}
+		subject = i18n.T(locale, "%s starred %s", user.Name, star.Name)
+		data["stargazer"] = user
+		data["subject"] = star
+	case "failed-signins.html":
+		subject = i18n.T(locale, "Failed sign-in attempts on your account")
+		data["failures"] = models.AlertThreshold
+		data["ips"] = 4
+		data["distributed"] = true
+		data["locked"] = false
+	case "new-signin.html":
+		subject = i18n.T(locale, "New sign-in to your account")
+		data["device"] = "Firefox on Windows"
+		data["ip"] = "203.0.113.7"
+		data["time"] = time.Now().UTC().Format("Jan 2, 2006 15:04 MST")
+	case "password-reset.html":
+		subject = i18n.T(locale, "Skyscape Password Reset Token")
+		data["resetURL"] = "https://www.theskyscape.com/reset-password?token=sample"
+	case "vulnerability-alert.html":
+		project := &models.Project{Model: application.Model{ID: "sample"}, Name: "sample-project"}
+		subject = i18n.T(locale, "Critical vulnerability in %s", project.Name)
+		data["project"] = project
+		data["alerts"] = []*models.VulnerabilityAlert{{
+			Ecosystem:  "Go",
+			Package:    "example.com/sample",
+			Version:    "v1.0.0",
+			AdvisoryID: "GO-0000-0000",
+			Summary:    "Sample advisory summary",
+			Severity:   "CRITICAL",
+			FixedIn:    "v1.0.1",
+		}}
+	case "welcome.html":
+		subject = i18n.T(locale, "Welcome to The Skyscape")
+	}
+
+	return &Sample{Subject: "[Test] " + subject, Data: data}
+}
+
+// Render renders a template the way the mailer does: every data key is a
+// template function as well as a field of dot
+func Render(name string, data map[string]any) (string, error) {
+	if templates == nil {
+		return "", fmt.Errorf("email templates not loaded")
+	}
+
+	funcs := template.FuncMap{}
+	for key, value := range data {
+		funcs[key] = func() any { return value }
+	}
+
+	t, err := template.New(path.Base(name)).Funcs(funcs).ParseFS(templates, name, "partials/*.html")
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err = t.ExecuteTemplate(&buf, path.Base(name), data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Options turns sample data into options for models.SendEmail
+func Options(data map[string]any) []emailing.EmailOption {
+	var opts []emailing.EmailOption
+	for key, value := range data {
+		opts = append(opts, emailing.WithData(key, value))
+	}
+	return opts
+}
@@ -0,0 +1,181 @@
+// Package events fans real-time events out to each user's open browser
+// connections over Server-Sent Events. Every tab holds a single stream that
+// carries all event kinds (messages, notifications, build status), so
+// features publish to a user instead of each keeping their own connections.
+//
+// The hub is in-memory, so events only reach connections held by the same
+// server process. Pages keep a slow poll as a fallback for anything missed.
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Event kinds published by the app. Clients receive each as a DOM event
+// named "skyscape:<kind>" on document.body.
+const (
+	Message      = "message"
+	Notification = "notification"
+	Build        = "build"
+)
+
+const (
+	// keepaliveInterval is comfortably below the idle timeout of common load
+	// balancers (60s) so quiet streams aren't dropped
+	keepaliveInterval = 25 * time.Second
+
+	// retryDelay tells the browser how long to wait before reconnecting
+	retryDelay = 5 * time.Second
+
+	// bufferSize is how many events a slow connection can fall behind
+	// before new ones are dropped for it
+	bufferSize = 16
+)
+
+// Event is a named payload delivered to one user
+type Event struct {
+	Kind string
+	Data any
+}
+
+type client chan Event
+
+var hub = struct {
+	mu      sync.RWMutex
+	clients map[string]map[client]struct{}
+}{clients: map[string]map[client]struct{}{}}
+
+// Publish sends an event to every open connection of the user. It never
+// blocks; connections that have fallen too far behind miss the event.
+func Publish(userID, kind string, data any) {
+	if userID == "" {
+		return
+	}
+
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+
+	for c := range hub.clients[userID] {
+		select {
+		case c <- Event{Kind: kind, Data: data}:
+		default:
+			slog.Debug("dropped event for slow connection", "user_id", userID, "kind", kind)
+		}
+	}
+}
+
+func subscribe(userID string) client {
+	c := make(client, bufferSize)
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	if hub.clients[userID] == nil {
+		hub.clients[userID] = map[client]struct{}{}
+	}
+	hub.clients[userID][c] = struct{}{}
+	return c
+}
+
+func unsubscribe(userID string, c client) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	delete(hub.clients[userID], c)
+	if len(hub.clients[userID]) == 0 {
+		delete(hub.clients, userID)
+	}
+}
+
+// Serve streams the user's events to the response until the client
+// disconnects, sending a comment line periodically to keep proxies and load
+// balancers from closing the idle connection.
+func Serve(w http.ResponseWriter, r *http.Request, userID string) {
+	rc, err := Start(w)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "event stream not supported", "error", err)
+		return
+	}
+
+	c := subscribe(userID)
+	defer unsubscribe(userID, c)
+
+	keepalive := time.NewTicker(keepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-keepalive.C:
+			if err := Keepalive(w, rc); err != nil {
+				return
+			}
+
+		case event := <-c:
+			if err := Write(w, rc, event); err != nil {
+				if errors.Is(err, errEncode) {
+					slog.ErrorContext(r.Context(), "failed to encode event", "kind", event.Kind, "error", err)
+					continue
+				}
+				return
+			}
+		}
+	}
+}
+
+// Subscribe returns the user's events as they're published, for streams
+// that pick out some of them, and a func to stop receiving them
+func Subscribe(userID string) (<-chan Event, func()) {
+	c := subscribe(userID)
+	return c, func() { unsubscribe(userID, c) }
+}
+
+// errEncode is returned by Write for data that can't be sent as JSON
+var errEncode = errors.New("failed to encode event")
+
+// Start begins a Server-Sent Events response and flushes its headers. It
+// fails if the response can't be streamed.
+func Start(w http.ResponseWriter) (*http.ResponseController, error) {
+	rc := http.NewResponseController(w)
+
+	// Streams are long-lived, so lift any server write timeout
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable nginx response buffering
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", retryDelay.Milliseconds())
+	return rc, rc.Flush()
+}
+
+// Write sends an event on a stream begun with Start
+func Write(w http.ResponseWriter, rc *http.ResponseController, event Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return errors.Join(errEncode, err)
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Kind, data); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
+
+// Keepalive sends a comment line on a stream begun with Start, so it isn't
+// closed while idle
+func Keepalive(w http.ResponseWriter, rc *http.ResponseController) error {
+	if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
@@ -2,7 +2,9 @@ package git
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -62,3 +64,18 @@ func IsEmpty(repoPath, branch string) bool {
 	_, err := ListCommits(repoPath, branch, 1)
 	return err != nil
 }
+
+// LastCommitTime returns when the latest commit on a branch was made.
+func LastCommitTime(repoPath, branch string) (time.Time, error) {
+	branch = SanitizeBranch(branch)
+	stdout, stderr, err := Exec(repoPath, "log", "-1", "--format=%ct", branch)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "failed to read last commit: %s", stderr.String())
+	}
+
+	unix, err := strconv.ParseInt(strings.TrimSpace(stdout.String()), 10, 64)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to parse commit time")
+	}
+	return time.Unix(unix, 0), nil
+}
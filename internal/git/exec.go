@@ -2,14 +2,47 @@ package git
 
 import (
 	"bytes"
+	"context"
+	"io"
+	"os"
 	"os/exec"
+
+	"go.opentelemetry.io/otel/attribute"
+	"www.theskyscape.com/internal/tracing"
 )
 
 // Exec runs a git command in the specified repository path.
 // Returns stdout, stderr buffers and any error from execution.
 func Exec(repoPath string, args ...string) (stdout, stderr bytes.Buffer, err error) {
-	cmd := exec.Command("git", args...)
+	return ExecContext(context.Background(), repoPath, args...)
+}
+
+// ExecContext runs a git command like Exec, traced as a child of any span
+// in ctx. The command is killed if ctx is cancelled.
+func ExecContext(ctx context.Context, repoPath string, args ...string) (stdout, stderr bytes.Buffer, err error) {
+	return execWith(ctx, repoPath, nil, nil, args...)
+}
+
+// execWith runs a git command like ExecContext, adding env to the
+// environment and feeding it stdin when not nil
+func execWith(ctx context.Context, repoPath string, env []string, stdin io.Reader, args ...string) (stdout, stderr bytes.Buffer, err error) {
+	name := "git"
+	if len(args) > 0 {
+		name += " " + args[0]
+	}
+
+	ctx, span := tracing.Start(ctx, name,
+		attribute.String("git.repo_path", repoPath),
+		attribute.StringSlice("git.args", args),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	cmd := exec.CommandContext(ctx, "git", args...)
 	cmd.Dir = repoPath
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stdin = stdin
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 	return stdout, stderr, cmd.Run()
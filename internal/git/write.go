@@ -0,0 +1,159 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Change is a file to write or delete in a commit
+type Change struct {
+	Path    string
+	Content []byte
+	Delete  bool
+}
+
+// Author is who a commit is by
+type Author struct {
+	Name  string
+	Email string
+}
+
+var (
+	// ErrStale is returned when the branch moved on from the parent a
+	// commit was made against
+	ErrStale = errors.New("the branch changed since it was read")
+
+	// ErrNoChanges is returned when a commit wouldn't change any file
+	ErrNoChanges = errors.New("nothing to commit")
+)
+
+// ValidPath reports whether p can be written in a commit: a clean,
+// relative path with no parent or .git elements
+func ValidPath(p string) bool {
+	if p == "" || len(p) > 4096 || strings.ContainsAny(p, "\x00\n\r\\") {
+		return false
+	}
+	if strings.HasPrefix(p, "/") || path.Clean(p) != p {
+		return false
+	}
+	for _, element := range strings.Split(p, "/") {
+		if element == ".." || element == "." || strings.EqualFold(element, ".git") {
+			return false
+		}
+	}
+	return true
+}
+
+// Commit writes changes on top of parent as a new commit on a branch of a
+// bare repository, and returns its hash. There's no working tree: blobs
+// are hashed straight into the repository and the tree is built in a
+// temporary index. The branch is only moved if it still points at parent,
+// otherwise ErrStale is returned and the commit is left unreferenced. An
+// empty parent starts a new branch.
+func Commit(ctx context.Context, repoPath, branch, parent string, author Author, message string, changes []Change) (string, error) {
+	branch = SanitizeBranch(branch)
+	for _, change := range changes {
+		if !ValidPath(change.Path) {
+			return "", errors.Errorf("invalid path: %q", change.Path)
+		}
+	}
+
+	index, err := os.CreateTemp("", "git-index-*")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create index")
+	}
+	index.Close()
+	os.Remove(index.Name()) // git refuses an empty index file, but takes a missing one
+	defer os.Remove(index.Name())
+
+	env := []string{"GIT_INDEX_FILE=" + index.Name()}
+	git := func(stdin io.Reader, args ...string) (string, error) {
+		stdout, stderr, err := execWith(ctx, repoPath, env, stdin, args...)
+		if err != nil {
+			return "", errors.Wrapf(err, "git %s: %s", args[0], strings.TrimSpace(stderr.String()))
+		}
+		return strings.TrimSpace(stdout.String()), nil
+	}
+
+	if parent != "" {
+		if _, err := git(nil, "read-tree", parent); err != nil {
+			return "", err
+		}
+	}
+
+	for _, change := range changes {
+		if change.Delete {
+			// Mode 0 removes the entry, and unlike --force-remove needs no work tree
+			entry := "0 0000000000000000000000000000000000000000\t" + change.Path + "\n"
+			if _, err := git(strings.NewReader(entry), "update-index", "--index-info"); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		blob, err := git(bytes.NewReader(change.Content), "hash-object", "-w", "--stdin")
+		if err != nil {
+			return "", err
+		}
+
+		// Keep the executable bit of files being changed
+		mode := "100644"
+		if staged, _ := git(nil, "ls-files", "--stage", "--", change.Path); strings.HasPrefix(staged, "100755 ") {
+			mode = "100755"
+		}
+		if _, err := git(nil, "update-index", "--add", "--cacheinfo", mode+","+blob+","+change.Path); err != nil {
+			return "", err
+		}
+	}
+
+	tree, err := git(nil, "write-tree")
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"commit-tree", tree, "-m", message}
+	if parent != "" {
+		if parentTree, err := git(nil, "rev-parse", parent+"^{tree}"); err == nil && parentTree == tree {
+			return "", ErrNoChanges
+		}
+		args = append(args, "-p", parent)
+	}
+
+	env = append(env,
+		"GIT_AUTHOR_NAME="+author.Name, "GIT_AUTHOR_EMAIL="+author.Email,
+		"GIT_COMMITTER_NAME="+author.Name, "GIT_COMMITTER_EMAIL="+author.Email,
+	)
+	commit, err := git(nil, args...)
+	if err != nil {
+		return "", err
+	}
+
+	// An empty old value makes sure the branch doesn't exist yet
+	if _, err := git(nil, "update-ref", "refs/heads/"+branch, commit, parent); err != nil {
+		return "", ErrStale
+	}
+	return commit, nil
+}
+
+// ListTree returns the path of every file in a branch, sorted
+func ListTree(repoPath, branch string) ([]string, error) {
+	branch = SanitizeBranch(branch)
+	stdout, _, err := Exec(repoPath, "ls-tree", "-r", "-z", "--name-only", branch)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list tree: %s", branch)
+	}
+
+	var paths []string
+	for p := range strings.SplitSeq(stdout.String(), "\x00") {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,268 @@
+// Package gitssh serves git over SSH. It only runs upload-pack and
+// receive-pack, and leaves deciding who may touch which repository to the
+// caller so SSH follows the same rules as git over HTTP.
+package gitssh
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Git services a client can ask for
+const (
+	UploadPack  = "git-upload-pack"  // clone, fetch and pull
+	ReceivePack = "git-receive-pack" // push
+)
+
+// Timeout bounds a single git command, so a stalled client can't hold a
+// connection open forever
+const Timeout = 30 * time.Minute
+
+// Request is a git command an SSH client asked to run
+type Request struct {
+	Context context.Context
+	KeyID   string // What LookupKey returned for the client's key
+	Service string // UploadPack or ReceivePack
+	Kind    string // "repo" or "project"
+	ID      string
+}
+
+// IsPush returns true if the client is pushing
+func (r *Request) IsPush() bool {
+	return r.Service == ReceivePack
+}
+
+// Server accepts SSH connections from registered keys and runs git
+// commands for them
+type Server struct {
+	// HostKeyPath is where the server's ed25519 host key is kept. A key is
+	// generated there on first start.
+	HostKeyPath string
+
+	// LookupKey identifies the owner of a key a client offered, returning
+	// an error to turn the client away
+	LookupKey func(key ssh.PublicKey) (string, error)
+
+	// Authorize decides whether a request may run, returning the git
+	// directory to run it in and an optional func to call after a
+	// successful push
+	Authorize func(req *Request) (dir string, afterPush func(), err error)
+}
+
+// ListenAndServe accepts connections on addr until the listener fails
+func (s *Server) ListenAndServe(addr string) error {
+	signer, err := s.hostKey()
+	if err != nil {
+		return err
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			keyID, err := s.LookupKey(key)
+			if err != nil {
+				return nil, errors.New("unknown public key")
+			}
+			return &ssh.Permissions{Extensions: map[string]string{"key-id": keyID}}, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	slog.Info("git ssh server listening", "addr", addr)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serve(conn, config)
+	}
+}
+
+// serve runs the handshake and then each session the client opens
+func (s *Server) serve(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+
+	// Clients get a short window to authenticate
+	conn.SetDeadline(time.Now().Add(time.Minute))
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	defer sconn.Close()
+	conn.SetDeadline(time.Time{})
+	go ssh.DiscardRequests(reqs)
+
+	keyID := sconn.Permissions.Extensions["key-id"]
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			newChan.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		ch, requests, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+		go s.session(keyID, ch, requests)
+	}
+}
+
+// session waits for the client's exec request and runs it. Anything else
+// a session might ask for, like a shell, is refused.
+func (s *Server) session(keyID string, ch ssh.Channel, requests <-chan *ssh.Request) {
+	defer ch.Close()
+
+	for req := range requests {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+
+		var payload struct{ Command string }
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+			req.Reply(false, nil)
+			return
+		}
+		req.Reply(true, nil)
+
+		code := s.exec(keyID, payload.Command, ch)
+		status := make([]byte, 4)
+		binary.BigEndian.PutUint32(status, code)
+		ch.SendRequest("exit-status", false, status)
+		return
+	}
+}
+
+// exec authorizes and runs one git command, returning its exit status
+func (s *Server) exec(keyID, command string, ch ssh.Channel) uint32 {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	req, err := ParseCommand(command)
+	if err != nil {
+		fmt.Fprintf(ch.Stderr(), "ERROR: %s. Only git clone, fetch and push are available over SSH.\n", err)
+		return 1
+	}
+	req.Context = ctx
+	req.KeyID = keyID
+
+	dir, afterPush, err := s.Authorize(req)
+	if err != nil {
+		fmt.Fprintf(ch.Stderr(), "ERROR: %s\n", err)
+		return 1
+	}
+
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := exec.CommandContext(ctx, "git", "init", "--bare", dir).Run(); err != nil {
+			slog.Error("failed to create repository", "dir", dir, "error", err)
+			fmt.Fprintf(ch.Stderr(), "ERROR: repository unavailable\n")
+			return 1
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, "git", strings.TrimPrefix(req.Service, "git-"), dir)
+	cmd.Stdout = ch
+	cmd.Stderr = ch.Stderr()
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return 1
+	}
+	if err := cmd.Start(); err != nil {
+		slog.Error("failed to start git", "service", req.Service, "error", err)
+		return 1
+	}
+
+	// The copy ends when the client closes its side, or when the session
+	// closes after git exits
+	go func() {
+		io.Copy(stdin, ch)
+		stdin.Close()
+	}()
+
+	err = cmd.Wait()
+	if err != nil {
+		slog.Warn("git over ssh failed", "service", req.Service, "kind", req.Kind, "id", req.ID, "error", err)
+		if exit, ok := err.(*exec.ExitError); ok && exit.ExitCode() > 0 {
+			return uint32(exit.ExitCode())
+		}
+		return 1
+	}
+
+	if req.IsPush() && afterPush != nil {
+		go afterPush()
+	}
+	return 0
+}
+
+// ParseCommand reads the git command an SSH client sends, such as
+// git-receive-pack '/project/abc.git'
+func ParseCommand(command string) (*Request, error) {
+	service, path, ok := strings.Cut(strings.TrimSpace(command), " ")
+	if !ok {
+		return nil, errors.New("invalid git command")
+	}
+
+	// Older clients send "git upload-pack" rather than "git-upload-pack"
+	if service == "git" {
+		if service, path, ok = strings.Cut(path, " "); !ok {
+			return nil, errors.New("invalid git command")
+		}
+		service = "git-" + service
+	}
+	if service != UploadPack && service != ReceivePack {
+		return nil, errors.New("unsupported git command")
+	}
+
+	path = strings.Trim(strings.TrimSpace(path), `'"`)
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	kind, id, ok := strings.Cut(path, "/")
+	if !ok || (kind != "repo" && kind != "project") || id == "" || strings.Contains(id, "/") || strings.HasPrefix(id, ".") {
+		return nil, errors.New("repository not found")
+	}
+
+	return &Request{Service: service, Kind: kind, ID: id}, nil
+}
+
+// hostKey loads the server's host key, generating one the first time
+func (s *Server) hostKey() (ssh.Signer, error) {
+	if data, err := os.ReadFile(s.HostKeyPath); err == nil {
+		return ssh.ParsePrivateKey(data)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	block, err := ssh.MarshalPrivateKey(key, "skyscape git")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.HostKeyPath), 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(s.HostKeyPath, pem.EncodeToMemory(block), 0o600); err != nil {
+		return nil, err
+	}
+	slog.Info("generated git ssh host key", "path", s.HostKeyPath)
+	return ssh.NewSignerFromKey(key)
+}
@@ -0,0 +1,197 @@
+// Package health checks the platform components users depend on and keeps
+// the latest results in memory for the status page. Checks run in the
+// background so a slow dependency never slows down /status.
+package health
+
+import (
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"www.theskyscape.com/models"
+)
+
+// Component statuses, from best to worst
+const (
+	Operational = "operational"
+	Degraded    = "degraded"
+	Outage      = "outage"
+)
+
+// Components lists the checked components, in display order
+var Components = []string{"database", "builds", "git", "registry", "email", "payments"}
+
+// Component is the latest check result for one component
+type Component struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Detail    string    `json:"detail,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// gitRoot is where repositories and projects are stored
+const gitRoot = "/mnt/git-repos"
+
+var client = &http.Client{Timeout: 5 * time.Second}
+
+var checks = map[string]func() (string, string){
+	"database": checkDatabase,
+	"builds":   checkBuilds,
+	"git":      checkGit,
+	"registry": checkRegistry,
+	"email":    checkEmail,
+	"payments": checkPayments,
+}
+
+var latest = struct {
+	mu         sync.RWMutex
+	components []Component
+}{}
+
+// Monitor checks every component now and then every interval
+func Monitor(interval time.Duration) {
+	for {
+		Check()
+		time.Sleep(interval)
+	}
+}
+
+// Check runs every component check concurrently and stores the results
+func Check() {
+	results := make([]Component, len(Components))
+
+	var wg sync.WaitGroup
+	for i, name := range Components {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, detail := checks[name]()
+			results[i] = Component{Name: name, Status: status, Detail: detail, CheckedAt: time.Now()}
+		}()
+	}
+	wg.Wait()
+
+	latest.mu.Lock()
+	latest.components = results
+	latest.mu.Unlock()
+}
+
+// Latest returns the most recent results, worsened by any open incident
+// an admin has posted for a component
+func Latest() []Component {
+	latest.mu.RLock()
+	components := append([]Component(nil), latest.components...)
+	latest.mu.RUnlock()
+
+	for _, incident := range models.OpenIncidents() {
+		for i := range components {
+			if components[i].Name == incident.Component && Worse(incident.Impact, components[i].Status) {
+				components[i].Status = incident.Impact
+				components[i].Detail = incident.Title
+			}
+		}
+	}
+	return components
+}
+
+// Overall returns the worst status across components
+func Overall(components []Component) string {
+	status := Operational
+	for _, c := range components {
+		if Worse(c.Status, status) {
+			status = c.Status
+		}
+	}
+	return status
+}
+
+// Worse reports whether status a is worse than status b
+func Worse(a, b string) bool {
+	rank := map[string]int{Operational: 0, Degraded: 1, Outage: 2}
+	return rank[a] > rank[b]
+}
+
+// checkDatabase makes sure the replica is syncing from the primary
+func checkDatabase() (string, string) {
+	stats := models.ReplicaStatus()
+	switch {
+	case stats.SyncedAt.IsZero() && stats.Failures > 0:
+		return Outage, "Database is unreachable"
+	case stats.LastError != "":
+		return Degraded, "Database sync is failing"
+	case stats.Lag() > models.ReplicaStalled:
+		return Degraded, "Recent changes may take a few minutes to appear"
+	}
+	return Operational, ""
+}
+
+// checkBuilds looks for stuck builds and a high failure rate in the last hour
+func checkBuilds() (string, string) {
+	if n := models.Images.Count("WHERE Status = 'building' AND CreatedAt < ?", time.Now().Add(-models.StuckBuildAfter)); n > 0 {
+		return Degraded, "Some builds are taking longer than usual"
+	}
+
+	since := time.Now().Add(-time.Hour)
+	total := models.Images.Count("WHERE CreatedAt > ? AND Status != 'building'", since)
+	failed := models.Images.Count("WHERE CreatedAt > ? AND Status = 'failed'", since)
+	if total >= 5 && failed*2 > total {
+		return Degraded, "Elevated build failures"
+	}
+	return Operational, ""
+}
+
+// checkGit makes sure repository storage is mounted
+func checkGit() (string, string) {
+	if info, err := os.Stat(gitRoot); err != nil || !info.IsDir() {
+		return Outage, "Repository storage is unavailable"
+	}
+	return Operational, ""
+}
+
+// checkRegistry pings the container registry builds push to
+func checkRegistry() (string, string) {
+	addr := os.Getenv("HQ_ADDR")
+	if addr == "" {
+		return Outage, "Registry is not configured"
+	}
+	resp, err := client.Get("http://" + addr + ":5000/v2/")
+	if err != nil {
+		return Outage, "Registry is unreachable"
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return Degraded, "Registry is returning errors"
+	}
+	return Operational, ""
+}
+
+// checkEmail makes sure the email provider is configured and reachable
+func checkEmail() (string, string) {
+	if os.Getenv("RESEND_API_KEY") == "" {
+		return Outage, "Email is not configured"
+	}
+	return reachable("https://api.resend.com/", "Email provider is unreachable")
+}
+
+// checkPayments makes sure Stripe is configured and reachable
+func checkPayments() (string, string) {
+	if os.Getenv("STRIPE_SECRET_KEY") == "" {
+		return Outage, "Payments are not configured"
+	}
+	return reachable("https://api.stripe.com/", "Payment provider is unreachable")
+}
+
+// reachable treats any response short of a server error as healthy, since
+// unauthenticated requests to provider APIs are expected to be rejected
+func reachable(url, detail string) (string, string) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return Outage, detail
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return Degraded, detail
+	}
+	return Operational, ""
+}
@@ -2,13 +2,25 @@ package hosting
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/The-Skyscape/devtools/pkg/containers"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"www.theskyscape.com/internal/advisories"
+	"www.theskyscape.com/internal/events"
+	"www.theskyscape.com/internal/git"
+	"www.theskyscape.com/internal/push"
+	"www.theskyscape.com/internal/tracing"
+	"www.theskyscape.com/internal/webhooks"
 	"www.theskyscape.com/models"
 )
 
@@ -17,6 +29,7 @@ type Buildable interface {
 	GetID() string
 	RepoPath() string
 	IsProject() bool
+	OwnerID() string
 }
 
 // appBuildable wraps an App to implement Buildable
@@ -26,6 +39,12 @@ type appBuildable struct {
 
 func (a *appBuildable) GetID() string    { return a.app.ID }
 func (a *appBuildable) IsProject() bool  { return false }
+func (a *appBuildable) OwnerID() string {
+	if repo := a.app.Repo(); repo != nil {
+		return repo.OwnerID
+	}
+	return ""
+}
 func (a *appBuildable) RepoPath() string {
 	if repo := a.app.Repo(); repo != nil {
 		return repo.Path()
@@ -40,27 +59,62 @@ type projectBuildable struct {
 
 func (p *projectBuildable) GetID() string    { return p.project.ID }
 func (p *projectBuildable) IsProject() bool  { return true }
+func (p *projectBuildable) OwnerID() string  { return p.project.OwnerID }
 func (p *projectBuildable) RepoPath() string { return p.project.Path() }
 
 // BuildApp builds and pushes a Docker image for an App.
-func BuildApp(app *models.App) (*models.Image, error) {
-	return BuildEntity(&appBuildable{app: app})
+func BuildApp(ctx context.Context, app *models.App) (*models.Image, error) {
+	return BuildEntity(ctx, &appBuildable{app: app})
 }
 
 // BuildProject builds and pushes a Docker image for a Project.
-func BuildProject(project *models.Project) (*models.Image, error) {
-	return BuildEntity(&projectBuildable{project: project})
+func BuildProject(ctx context.Context, project *models.Project) (*models.Image, error) {
+	return BuildEntity(ctx, &projectBuildable{project: project})
+}
+
+// Source selects what a build checks out instead of the main branch
+type Source struct {
+	Ref     string // Branch, tag or commit in the entity's repo
+	Archive string // Path to a gzipped tarball of the source tree
 }
 
 // BuildEntity builds and pushes a Docker image for any Buildable entity.
-// Creates Image record and updates its status.
-func BuildEntity(entity Buildable) (*models.Image, error) {
+// Creates Image record and updates its status. The build is traced as a
+// child of any span in ctx.
+func BuildEntity(ctx context.Context, entity Buildable) (*models.Image, error) {
+	img, err := QueueBuild(entity, Source{})
+	if err != nil {
+		return nil, err
+	}
+	if err = RunBuild(ctx, entity, img, Source{}); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// DeployProject queues a build of a project from src and runs it in the
+// background, returning the image record as soon as it exists
+func DeployProject(ctx context.Context, project *models.Project, src Source, done func(error)) (*models.Image, error) {
+	entity := &projectBuildable{project: project}
+	img, err := QueueBuild(entity, src)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		done(RunBuild(ctx, entity, img, src))
+	}()
+	return img, nil
+}
+
+// QueueBuild resolves the commit src points at and records a building
+// image for it
+func QueueBuild(entity Buildable, src Source) (*models.Image, error) {
 	repoPath := entity.RepoPath()
 	if repoPath == "" {
 		return nil, errors.New("repo not found")
 	}
 
-	gitHash, err := GetGitHash(repoPath)
+	gitHash, err := SourceHash(repoPath, src)
 	if err != nil {
 		return nil, err
 	}
@@ -80,17 +134,102 @@ func BuildEntity(entity Buildable) (*models.Image, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create image")
 	}
+	publishBuild(entity, img)
+	return img, nil
+}
+
+// RunBuild builds a queued image and records whether it succeeded
+func RunBuild(ctx context.Context, entity Buildable, img *models.Image, src Source) (err error) {
+	ctx, span := tracing.Start(ctx, "BuildEntity",
+		attribute.String("build.entity_id", entity.GetID()),
+		attribute.Bool("build.project", entity.IsProject()),
+		attribute.String("build.git_hash", img.GitHash),
+	)
+	defer func() { tracing.End(span, err) }()
 
-	result, err := Build(entity.GetID(), repoPath)
+	result, err := Build(ctx, entity.GetID(), entity.RepoPath(), src)
 	if err != nil {
 		img.Status = "failed"
-		img.Error = result.Error
+		if result != nil {
+			img.Error = result.Error
+		}
 		models.Images.Update(img)
-		return nil, err
+		publishBuild(entity, img)
+		go notifyBuild(entity, img)
+		return err
+	}
+
+	if err = scanImage(ctx, entity, img); err != nil {
+		img.Status = "failed"
+		img.Error = err.Error()
+		models.Images.Update(img)
+		publishBuild(entity, img)
+		go notifyBuild(entity, img)
+		return err
 	}
 
 	img.Status = "ready"
-	return img, models.Images.Update(img)
+	if err = models.Images.Update(img); err != nil {
+		return err
+	}
+	publishBuild(entity, img)
+	go notifyBuild(entity, img)
+
+	// Followers of the project or app see deploys in their feed
+	subjectType := "app"
+	if entity.IsProject() {
+		subjectType = "project"
+	}
+	models.Activities.Insert(&models.Activity{
+		UserID:      entity.OwnerID(),
+		Action:      "deployed",
+		SubjectType: subjectType,
+		SubjectID:   entity.GetID(),
+		Content:     "Build " + img.GitHash + " is live",
+	})
+
+	if entity.IsProject() {
+		go advisories.ScanProject(entity.GetID(), img.GitHash)
+	}
+	return nil
+}
+
+// publishBuild tells the owner's open tabs that a build changed status
+func publishBuild(entity Buildable, img *models.Image) {
+	events.Publish(entity.OwnerID(), events.Build, map[string]string{
+		"id":     entity.GetID(),
+		"image":  img.ID,
+		"status": img.Status,
+	})
+}
+
+// notifyBuild tells the owner a build finished, through the channels they
+// chose for deploy notifications
+func notifyBuild(entity Buildable, img *models.Image) {
+	url := "/app/" + entity.GetID() + "/manage"
+	if entity.IsProject() {
+		url = "/project/" + entity.GetID() + "/manage"
+	}
+
+	title, body := "Deploy failed: "+entity.GetID(), img.Error
+	if img.Status == "ready" {
+		title, body = "Deployed "+entity.GetID(), "Build "+img.GitHash+" is live"
+	}
+	if len(body) > 100 {
+		body = body[:97] + "..."
+	}
+
+	push.SendNotification(entity.OwnerID(), entity.GetID(), models.NotifyDeploy, title, body, url)
+
+	switch e := entity.(type) {
+	case *projectBuildable:
+		subject := webhooks.NewSubject("project", e.project.ID, e.project.Name)
+		webhooks.Deploy(e.project.OwnerID, models.WebhookProject, e.project.ID, subject, img)
+	case *appBuildable:
+		// App deploys go to hooks on the app's repo
+		subject := webhooks.NewSubject("app", e.app.ID, e.app.Name)
+		webhooks.Deploy(entity.OwnerID(), models.WebhookRepo, e.app.RepoID, subject, img)
+	}
 }
 
 // BuildResult contains the outcome of a build
@@ -102,7 +241,10 @@ type BuildResult struct {
 
 // Build clones, builds, and pushes a Docker image.
 // Returns the git hash and status. Use BuildApp/BuildProject for full orchestration.
-func Build(entityID, repoPath string) (*BuildResult, error) {
+func Build(ctx context.Context, entityID, repoPath string, src Source) (result *BuildResult, err error) {
+	_, span := tracing.Start(ctx, "docker build", attribute.String("build.entity_id", entityID))
+	defer func() { tracing.End(span, err) }()
+
 	host := containers.Local()
 
 	// Create temp directory
@@ -114,7 +256,7 @@ func Build(entityID, repoPath string) (*BuildResult, error) {
 	defer os.RemoveAll(tmpDir)
 
 	// Get git hash
-	gitHash, err := GetGitHash(repoPath)
+	gitHash, err := SourceHash(repoPath, src)
 	if err != nil {
 		return nil, err
 	}
@@ -124,14 +266,21 @@ func Build(entityID, repoPath string) (*BuildResult, error) {
 	host.SetStdout(&stdout)
 	host.SetStderr(&stderr)
 
-	hqAddr := os.Getenv("HQ_ADDR")
+	// Check out main, the requested commit, or the uploaded tree
+	checkout := fmt.Sprintf("git clone -b main %s %s", repoPath, tmpDir)
+	if src.Archive != "" {
+		checkout = fmt.Sprintf("tar -xzf %s --no-same-owner -C %s", src.Archive, tmpDir)
+	} else if src.Ref != "" {
+		checkout = fmt.Sprintf("git clone %s %s && git -C %s checkout --detach %s", repoPath, tmpDir, tmpDir, gitHash)
+	}
+
 	buildCmd := fmt.Sprintf(`
 		mkdir -p %[1]s
-		git clone -b main %[2]s %[1]s
+		%[2]s
 		cd %[1]s
-		docker build -t %[3]s:5000/%[4]s:%[5]s .
-		docker push %[3]s:5000/%[4]s:%[5]s
-	`, tmpDir, repoPath, hqAddr, entityID, gitHash)
+		docker build -t %[3]s .
+		docker push %[3]s
+	`, tmpDir, checkout, ImageRef(entityID, gitHash))
 
 	if err = host.Exec("bash", "-c", buildCmd); err != nil {
 		return &BuildResult{
@@ -147,6 +296,11 @@ func Build(entityID, repoPath string) (*BuildResult, error) {
 	}, nil
 }
 
+// ImageRef names an entity's image for a commit in the registry on HQ
+func ImageRef(entityID, gitHash string) string {
+	return fmt.Sprintf("%s:5000/%s:%s", os.Getenv("HQ_ADDR"), entityID, gitHash)
+}
+
 // GetGitHash retrieves the short hash of the main branch
 func GetGitHash(repoPath string) (string, error) {
 	host := containers.Local()
@@ -164,3 +318,39 @@ func GetGitHash(repoPath string) (string, error) {
 
 	return strings.TrimSpace(stdout.String()), nil
 }
+
+// validRef matches branch and tag names and commit hashes a deploy may
+// name, keeping them safe to pass to git and the shell
+var validRef = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+
+// SourceHash identifies the code a build of src will contain: the short
+// commit hash for the main branch or a ref, or a digest of an archive
+func SourceHash(repoPath string, src Source) (string, error) {
+	if src.Archive != "" {
+		f, err := os.Open(src.Archive)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to open archive")
+		}
+		defer f.Close()
+
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return "", errors.Wrap(err, "failed to read archive")
+		}
+		return "upload-" + hex.EncodeToString(h.Sum(nil))[:12], nil
+	}
+
+	if src.Ref == "" {
+		return GetGitHash(repoPath)
+	}
+
+	if !validRef.MatchString(src.Ref) || strings.Contains(src.Ref, "..") {
+		return "", errors.New("invalid ref")
+	}
+
+	stdout, _, err := git.Exec(repoPath, "rev-parse", "--verify", "--quiet", "--short", src.Ref+"^{commit}")
+	if err != nil {
+		return "", errors.Errorf("ref %s not found", src.Ref)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
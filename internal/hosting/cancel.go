@@ -0,0 +1,35 @@
+package hosting
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/The-Skyscape/devtools/pkg/containers"
+	"github.com/pkg/errors"
+	"www.theskyscape.com/models"
+)
+
+// CancelBuild kills any docker build or push running for the image and marks
+// it failed. BuildEntity will see the killed process fail and record the
+// entity's error as usual.
+func CancelBuild(img *models.Image, reason string) error {
+	if !img.IsBuilding() {
+		return errors.New("image is not building")
+	}
+
+	host := containers.Local()
+	var stdout, stderr bytes.Buffer
+	host.SetStdout(&stdout)
+	host.SetStderr(&stderr)
+
+	// pkill exits 1 when nothing matched, which just means the build
+	// already finished or died, so the result is ignored
+	tag := fmt.Sprintf("/%s:%s", img.EntityID(), img.GitHash)
+	host.Exec("bash", "-c", fmt.Sprintf(`
+		pkill -f 'docker (build|push) .*%[1]s' || true
+	`, tag))
+
+	img.Status = "failed"
+	img.Error = reason
+	return models.Images.Update(img)
+}
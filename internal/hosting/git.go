@@ -37,3 +37,22 @@ func RepoExists(id string) bool {
 	_, err := os.Stat(RepoPath(id))
 	return err == nil
 }
+
+// CloneGitRepo copies a bare repository's branches and tags into a new
+// bare repository, without a remote pointing back at the original
+func CloneGitRepo(srcID, dstID string) error {
+	path := RepoPath(dstID)
+	if _, err := os.Stat(path); err == nil {
+		return errors.New("repository directory already exists")
+	}
+
+	host := containers.Local()
+	if err := host.Exec("git", "clone", "--bare", "--no-hardlinks", RepoPath(srcID), path); err != nil {
+		return errors.Wrap(err, "failed to copy git repo")
+	}
+	if err := host.Exec("git", "-C", path, "remote", "remove", "origin"); err != nil {
+		return errors.Wrap(err, "failed to detach copied git repo")
+	}
+
+	return nil
+}
@@ -2,7 +2,7 @@ package hosting
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 
 	"github.com/pkg/errors"
@@ -38,7 +38,7 @@ func RenameProject(oldID, newID, name, description string) error {
 
 	// Move git repo to new path
 	if err := os.Rename(oldGitPath, newGitPath); err != nil {
-		log.Printf("[ProjectRename] Failed to move git repo from %s to %s: %v", oldGitPath, newGitPath, err)
+		slog.Error("failed to move git repo", "from", oldGitPath, "to", newGitPath, "error", err)
 		return errors.Wrap(err, "failed to move git repo")
 	}
 
@@ -69,6 +69,9 @@ func updateAppRelatedTables(oldID, newID string) {
 	}{
 		{"images", "AppID"},
 		{"app_metrics", "AppID"},
+		{"site_traffic", "SiteID"},
+		{"proxy_rules", "SiteID"},
+		{"custom_domains", "SiteID"},
 		{"oauth_authorizations", "AppID"},
 		{"oauth_authorization_codes", "ClientID"},
 	}
@@ -78,7 +81,7 @@ func updateAppRelatedTables(oldID, newID string) {
 			fmt.Sprintf("UPDATE %s SET %s = ? WHERE %s = ?", t.table, t.column, t.column),
 			newID, oldID,
 		).Exec(); err != nil {
-			log.Printf("[AppRename] Failed to update %s.%s from %s to %s: %v", t.table, t.column, oldID, newID, err)
+			slog.Error("failed to rename app references", "table", t.table, "column", t.column, "from", oldID, "to", newID, "error", err)
 		}
 	}
 }
@@ -91,8 +94,10 @@ func updateProjectRelatedTables(oldID, newID string) {
 	}{
 		{"images", "ProjectID"},
 		{"app_metrics", "ProjectID"},
+		{"site_traffic", "SiteID"},
+		{"proxy_rules", "SiteID"},
+		{"custom_domains", "SiteID"},
 		{"oauth_authorizations", "ProjectID"},
-		{"stars", "ProjectID"},
 	}
 
 	for _, t := range tables {
@@ -100,21 +105,21 @@ func updateProjectRelatedTables(oldID, newID string) {
 			fmt.Sprintf("UPDATE %s SET %s = ? WHERE %s = ?", t.table, t.column, t.column),
 			newID, oldID,
 		).Exec(); err != nil {
-			log.Printf("[ProjectRename] Failed to update %s.%s from %s to %s: %v", t.table, t.column, oldID, newID, err)
+			slog.Error("failed to rename project references", "table", t.table, "column", t.column, "from", oldID, "to", newID, "error", err)
 		}
 	}
 }
 
 // updateSubjectTables updates all tables that reference an entity as a subject
 func updateSubjectTables(subjectType, oldID, newID string) {
-	// Activities and promotions filter by SubjectType
-	subjectTypeTables := []string{"activities", "promotions"}
+	// Activities, promotions and stars filter by SubjectType
+	subjectTypeTables := []string{"activities", "promotions", "stars"}
 	for _, table := range subjectTypeTables {
 		if err := models.DB.Query(
 			fmt.Sprintf("UPDATE %s SET SubjectID = ? WHERE SubjectType = ? AND SubjectID = ?", table),
 			newID, subjectType, oldID,
 		).Exec(); err != nil {
-			log.Printf("[%sRename] Failed to update %s.SubjectID from %s to %s: %v", subjectType, table, oldID, newID, err)
+			slog.Error("failed to rename subject references", "subject_type", subjectType, "table", table, "from", oldID, "to", newID, "error", err)
 		}
 	}
 
@@ -123,6 +128,6 @@ func updateSubjectTables(subjectType, oldID, newID string) {
 		"UPDATE comments SET SubjectID = ? WHERE SubjectID = ?",
 		newID, oldID,
 	).Exec(); err != nil {
-		log.Printf("[%sRename] Failed to update comments.SubjectID from %s to %s: %v", subjectType, oldID, newID, err)
+		slog.Error("failed to rename comment subjects", "subject_type", subjectType, "from", oldID, "to", newID, "error", err)
 	}
 }
@@ -0,0 +1,36 @@
+package hosting
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"www.theskyscape.com/internal/imagescan"
+	"www.theskyscape.com/models"
+)
+
+// scanImage scans a built image for vulnerable packages, noting what it
+// finds on the image for RunBuild to save. A project that blocks vulnerable deploys gets an error back
+// when there are critical ones. A scan that can't run doesn't stop the
+// build; the image is just left unscanned.
+func scanImage(ctx context.Context, entity Buildable, img *models.Image) error {
+	if !imagescan.Enabled() {
+		return nil
+	}
+
+	report, err := imagescan.Scan(ctx, ImageRef(entity.GetID(), img.GitHash))
+	if err != nil {
+		slog.Warn("image scan failed", "entity_id", entity.GetID(), "git_hash", img.GitHash, "error", err)
+		return nil
+	}
+	report.Apply(img)
+
+	if report.Critical == 0 {
+		return nil
+	}
+	slog.Info("critical vulnerabilities in image", "entity_id", entity.GetID(), "git_hash", img.GitHash, "critical", report.Critical)
+	if p, ok := entity.(*projectBuildable); ok && p.project.BlockVulnerable {
+		return fmt.Errorf("deploy blocked: the image has %d critical vulnerabilities", report.Critical)
+	}
+	return nil
+}
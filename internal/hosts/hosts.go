@@ -0,0 +1,298 @@
+// Package hosts decides what a request's Host header points at: The
+// Skyscape itself, an alias redirected to it, an app or project on a
+// subdomain of the site domain or on a verified custom domain, or nothing
+// at all. It also answers which hosts may be issued TLS certificates.
+package hosts
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"www.theskyscape.com/models"
+)
+
+// Kind is what a host points at
+type Kind int
+
+const (
+	Web      Kind = iota // The Skyscape itself
+	Redirect             // An alias of the web host
+	Site                 // An app or project
+	Unknown              // A subdomain of the site domain nothing is hosted on
+)
+
+// Route is where a host points
+type Route struct {
+	Kind   Kind
+	Host   string // The normalized host
+	SiteID string // For Site
+	Target string // Host to redirect to, for Redirect
+	Custom bool   // Whether a Site was found by its custom domain
+}
+
+// Router resolves hosts. The zero value serves everything as Web.
+type Router struct {
+	WebHost    string   // Canonical host of the site, e.g. "www.theskyscape.com"
+	Aliases    []string // Redirected to WebHost
+	WebHosts   []string // Also served as the site, without a redirect
+	SiteDomain string   // Apps and projects are served from its subdomains
+
+	// Lookup finds the site a custom domain belongs to
+	Lookup func(host string) (siteID string, ok bool)
+
+	// Exists reports whether an app or project is hosted under an ID
+	Exists func(siteID string) bool
+}
+
+// Normalize lowercases a host and drops its port and trailing dot
+func Normalize(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// Resolve returns where a host points. Hosts that aren't the site's own,
+// a subdomain of the site domain or a custom domain are served as Web, so
+// health checks, IPs and local development keep working.
+func (rt *Router) Resolve(host string) Route {
+	host = Normalize(host)
+	route := Route{Kind: Web, Host: host}
+
+	switch {
+	case host == rt.WebHost || slices.Contains(rt.WebHosts, host):
+		return route
+	case slices.Contains(rt.Aliases, host):
+		route.Kind, route.Target = Redirect, rt.WebHost
+		return route
+	}
+
+	if rt.SiteDomain != "" {
+		if sub, ok := strings.CutSuffix(host, "."+rt.SiteDomain); ok {
+			if sub == "" || strings.Contains(sub, ".") {
+				route.Kind = Unknown
+			} else {
+				route.Kind, route.SiteID = Site, sub
+			}
+			return route
+		}
+	}
+
+	if rt.Lookup != nil {
+		if siteID, ok := rt.Lookup(host); ok {
+			route.Kind, route.SiteID, route.Custom = Site, siteID, true
+		}
+	}
+	return route
+}
+
+// IsPlatform reports whether a host is the site's own or a subdomain of
+// the site domain, which can't be claimed as a custom domain
+func (rt *Router) IsPlatform(host string) bool {
+	host = Normalize(host)
+	for _, own := range append([]string{rt.WebHost, rt.SiteDomain}, append(rt.Aliases, rt.WebHosts...)...) {
+		if own != "" && (host == own || strings.HasSuffix(host, "."+own)) {
+			return true
+		}
+	}
+	return false
+}
+
+// SiteHost returns the subdomain an app or project is served from
+func (rt *Router) SiteHost(siteID string) string {
+	return siteID + "." + rt.SiteDomain
+}
+
+// Default routes The Skyscape's hosts, with WEB_HOST and SITE_DOMAIN
+// overriding the production ones
+var Default = &Router{
+	WebHost: cmp.Or(os.Getenv("WEB_HOST"), "www.theskyscape.com"),
+	Aliases: []string{"theskyscape.com"},
+	WebHosts: []string{
+		"cloud.digitalocean.com", // health checks
+		"skysca.pe",
+		"web.skysca.pe", // legacy
+		"www.skysca.pe",
+	},
+	SiteDomain: cmp.Or(os.Getenv("SITE_DOMAIN"), "skysca.pe"),
+	Lookup:     lookupDomain,
+	Exists:     siteExists,
+}
+
+// domainTTL is how long custom domain lookups are cached. At most
+// maxDomains verified domains are cached, and at most maxUnknown hosts
+// found not to be one, since anyone can send any Host.
+const (
+	domainTTL  = time.Minute
+	maxDomains = 10000
+	maxUnknown = 1000
+)
+
+var (
+	mu      sync.Mutex
+	domains = map[string]cachedDomain{}
+	unknown = map[string]time.Time{} // When each host's miss expires
+)
+
+type cachedDomain struct {
+	siteID     string
+	forceHTTPS bool
+	expires    time.Time
+}
+
+// lookupDomain finds a verified custom domain, caching the answer
+func lookupDomain(host string) (string, bool) {
+	c := cachedLookup(host)
+	return c.siteID, c.siteID != ""
+}
+
+// cachedLookup returns what's known about a custom domain, looking it up
+// when it isn't cached or the cached answer is too old
+func cachedLookup(host string) cachedDomain {
+	now := time.Now()
+	mu.Lock()
+	c, ok := domains[host]
+	missed, isUnknown := unknown[host]
+	mu.Unlock()
+	if ok && now.Before(c.expires) {
+		return c
+	}
+	if isUnknown && now.Before(missed) {
+		return cachedDomain{}
+	}
+
+	c = cachedDomain{expires: now.Add(domainTTL)}
+	domain := models.VerifiedDomain(host)
+	if domain != nil {
+		c.siteID, c.forceHTTPS = domain.SiteID, domain.ForceHTTPS
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	delete(domains, host)
+	delete(unknown, host)
+	if domain == nil {
+		sweep(unknown, maxUnknown, func(expires time.Time) time.Time { return expires })
+		if len(unknown) < maxUnknown {
+			unknown[host] = c.expires
+		}
+	} else {
+		sweep(domains, maxDomains, func(c cachedDomain) time.Time { return c.expires })
+		if len(domains) < maxDomains {
+			domains[host] = c
+		}
+	}
+	return c
+}
+
+// sweep drops a full cache's expired entries, leaving it full if none
+// have expired; the caller holds mu
+func sweep[V any](cache map[string]V, limit int, expires func(V) time.Time) {
+	if len(cache) < limit {
+		return
+	}
+	now := time.Now()
+	for host, v := range cache {
+		if now.After(expires(v)) {
+			delete(cache, host)
+		}
+	}
+}
+
+// siteExists reports whether a project or app has the ID
+func siteExists(siteID string) bool {
+	_, err := models.Projects.Get(siteID)
+	if err != nil {
+		_, err = models.Apps.Get(siteID)
+	}
+	return err == nil
+}
+
+// Forget drops a cached custom domain lookup after it changes
+func Forget(host string) {
+	host = Normalize(host)
+	mu.Lock()
+	delete(domains, host)
+	delete(unknown, host)
+	mu.Unlock()
+}
+
+// ForceHTTPS reports whether a custom domain's owner wants plain HTTP
+// redirected to HTTPS, from the same cache as the domain's lookup
+func ForceHTTPS(host string) bool {
+	return cachedLookup(Normalize(host)).forceHTTPS
+}
+
+// Errors explaining why a domain can't be added
+var (
+	ErrInvalidDomain  = errors.New("enter a domain name, like app.example.com")
+	ErrPlatformDomain = errors.New("domains of The Skyscape can't be used as custom domains")
+	ErrNotVerified    = errors.New("the TXT record wasn't found yet; DNS changes can take a few minutes")
+)
+
+// ValidateDomain normalizes a domain an owner entered, checking it's a
+// domain name outside the platform's own
+func (rt *Router) ValidateDomain(domain string) (string, error) {
+	domain = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(domain), "https://"), "http://")
+	domain = Normalize(strings.TrimSuffix(domain, "/"))
+	if len(domain) > 253 || !strings.Contains(domain, ".") || net.ParseIP(domain) != nil {
+		return "", ErrInvalidDomain
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if !validLabel(label) {
+			return "", ErrInvalidDomain
+		}
+	}
+	if rt.IsPlatform(domain) {
+		return "", ErrPlatformDomain
+	}
+	return domain, nil
+}
+
+func validLabel(label string) bool {
+	if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for _, c := range label {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// Verify looks for a domain's TXT record
+func Verify(ctx context.Context, domain *models.CustomDomain) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	records, err := net.DefaultResolver.LookupTXT(ctx, domain.TXTName())
+	if err != nil || !slices.Contains(records, domain.TXTValue()) {
+		return ErrNotVerified
+	}
+	return nil
+}
+
+// AllowCertificate reports whether a TLS certificate may be issued for a
+// host: the site's own hosts, subdomains of live apps and projects, and
+// verified custom domains. Edge proxies issuing certificates on demand
+// ask this before each one.
+func (rt *Router) AllowCertificate(host string) bool {
+	route := rt.Resolve(host)
+	switch route.Kind {
+	case Redirect:
+		return true
+	case Web:
+		return route.Host == rt.WebHost || slices.Contains(rt.WebHosts, route.Host)
+	case Site:
+		return route.Custom || (rt.Exists != nil && rt.Exists(route.SiteID))
+	}
+	return false
+}
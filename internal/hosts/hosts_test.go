@@ -0,0 +1,194 @@
+package hosts
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// router is a Router for The Skyscape's production hosts, hosting the
+// sites "blog" and "shop", with "blog" also on app.example.com
+var router = &Router{
+	WebHost:    "www.theskyscape.com",
+	Aliases:    []string{"theskyscape.com"},
+	WebHosts:   []string{"skysca.pe", "www.skysca.pe"},
+	SiteDomain: "skysca.pe",
+	Lookup: func(host string) (string, bool) {
+		if host == "app.example.com" {
+			return "blog", true
+		}
+		return "", false
+	},
+	Exists: func(siteID string) bool {
+		return siteID == "blog" || siteID == "shop"
+	},
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		host string
+		want Route
+	}{
+		// Platform hosts
+		{"www.theskyscape.com", Route{Kind: Web, Host: "www.theskyscape.com"}},
+		{"WWW.TheSkyscape.com:443", Route{Kind: Web, Host: "www.theskyscape.com"}},
+		{"skysca.pe", Route{Kind: Web, Host: "skysca.pe"}},
+		{"www.skysca.pe.", Route{Kind: Web, Host: "www.skysca.pe"}},
+		{"theskyscape.com", Route{Kind: Redirect, Host: "theskyscape.com", Target: "www.theskyscape.com"}},
+
+		// Tenant subdomains
+		{"blog.skysca.pe", Route{Kind: Site, Host: "blog.skysca.pe", SiteID: "blog"}},
+		{"Shop.Skysca.pe:8080", Route{Kind: Site, Host: "shop.skysca.pe", SiteID: "shop"}},
+		{"missing.skysca.pe", Route{Kind: Site, Host: "missing.skysca.pe", SiteID: "missing"}},
+		{"a.blog.skysca.pe", Route{Kind: Unknown, Host: "a.blog.skysca.pe"}},
+
+		// Custom domains
+		{"app.example.com", Route{Kind: Site, Host: "app.example.com", SiteID: "blog", Custom: true}},
+		{"App.Example.com.", Route{Kind: Site, Host: "app.example.com", SiteID: "blog", Custom: true}},
+
+		// Anything else is served as the site
+		{"other.example.com", Route{Kind: Web, Host: "other.example.com"}},
+		{"notskysca.pe", Route{Kind: Web, Host: "notskysca.pe"}},
+		{"127.0.0.1:5000", Route{Kind: Web, Host: "127.0.0.1"}},
+		{"localhost", Route{Kind: Web, Host: "localhost"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := router.Resolve(tt.host); got != tt.want {
+				t.Errorf("Resolve(%q) = %+v, want %+v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveZeroRouter(t *testing.T) {
+	for _, host := range []string{"www.theskyscape.com", "blog.skysca.pe", "localhost"} {
+		if got := new(Router).Resolve(host); got.Kind != Web {
+			t.Errorf("zero Router Resolve(%q) = %+v, want Web", host, got)
+		}
+	}
+}
+
+func TestIsPlatform(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"www.theskyscape.com", true},
+		{"theskyscape.com", true},
+		{"api.theskyscape.com", true},
+		{"SKYSCA.PE", true},
+		{"www.skysca.pe", true},
+		{"blog.skysca.pe", true},
+		{"a.blog.skysca.pe:443", true},
+		{"app.example.com", false},
+		{"example.com", false},
+		{"notskysca.pe", false},
+		{"theskyscape.com.evil.com", false},
+		{"localhost", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := router.IsPlatform(tt.host); got != tt.want {
+				t.Errorf("IsPlatform(%q) = %v, want %v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDomain(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   string
+		err    error
+	}{
+		// Custom domains, normalized
+		{"app.example.com", "app.example.com", nil},
+		{"  App.Example.COM  ", "app.example.com", nil},
+		{"https://app.example.com/", "app.example.com", nil},
+		{"http://example.com.", "example.com", nil},
+		{"my-app.example.co.uk", "my-app.example.co.uk", nil},
+		{"xn--bcher-kva.example", "xn--bcher-kva.example", nil},
+
+		// Platform hosts and tenant subdomains
+		{"www.theskyscape.com", "", ErrPlatformDomain},
+		{"theskyscape.com", "", ErrPlatformDomain},
+		{"skysca.pe", "", ErrPlatformDomain},
+		{"blog.skysca.pe", "", ErrPlatformDomain},
+		{"https://Shop.Skysca.pe/", "", ErrPlatformDomain},
+
+		// Not domain names
+		{"", "", ErrInvalidDomain},
+		{"localhost", "", ErrInvalidDomain},
+		{"1.2.3.4", "", ErrInvalidDomain},
+		{"app..example.com", "", ErrInvalidDomain},
+		{"-app.example.com", "", ErrInvalidDomain},
+		{"app-.example.com", "", ErrInvalidDomain},
+		{"app_1.example.com", "", ErrInvalidDomain},
+		{"app.example.com/path", "", ErrInvalidDomain},
+		{"*.example.com", "", ErrInvalidDomain},
+		{strings.Repeat("a", 64) + ".example.com", "", ErrInvalidDomain},
+		{strings.Repeat("a.", 127) + "com", "", ErrInvalidDomain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			got, err := router.ValidateDomain(tt.domain)
+			if got != tt.want || !errors.Is(err, tt.err) {
+				t.Errorf("ValidateDomain(%q) = %q, %v, want %q, %v", tt.domain, got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestAllowCertificate(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		// Platform hosts
+		{"www.theskyscape.com", true},
+		{"theskyscape.com", true},
+		{"skysca.pe", true},
+		{"www.skysca.pe", true},
+
+		// Tenant subdomains, only of live sites
+		{"blog.skysca.pe", true},
+		{"shop.skysca.pe", true},
+		{"missing.skysca.pe", false},
+		{"a.blog.skysca.pe", false},
+
+		// Verified custom domains only
+		{"app.example.com", true},
+		{"other.example.com", false},
+
+		// Hosts served as the site but never issued certificates
+		{"127.0.0.1", false},
+		{"localhost", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := router.AllowCertificate(tt.host); got != tt.want {
+				t.Errorf("AllowCertificate(%q) = %v, want %v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSweep(t *testing.T) {
+	now := time.Now()
+	cache := map[string]time.Time{
+		"old.example.com": now.Add(-time.Second),
+		"new.example.com": now.Add(time.Minute),
+	}
+	expires := func(t time.Time) time.Time { return t }
+
+	sweep(cache, 3, expires)
+	if len(cache) != 2 {
+		t.Errorf("sweep of a cache under its limit left %d entries, want 2", len(cache))
+	}
+	sweep(cache, 2, expires)
+	if _, ok := cache["new.example.com"]; !ok || len(cache) != 1 {
+		t.Errorf("sweep of a full cache left %v, want only new.example.com", cache)
+	}
+}
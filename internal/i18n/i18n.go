@@ -0,0 +1,136 @@
+// Package i18n translates user-facing text. Catalogs in locales/*.json map
+// English source text to its translation, so untranslated text (or a
+// missing catalog entry) falls back to English instead of a key name.
+//
+// To add a language, add locales/<code>.json and list it in Locales.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path"
+
+	"golang.org/x/text/language"
+)
+
+// Default is the source language of the app's text
+const Default = "en"
+
+// Locale is a supported language
+type Locale struct {
+	Code string // BCP 47 code, e.g. "es"
+	Name string // Name of the language in itself, e.g. "Español"
+}
+
+// Locales lists the supported languages, Default first
+var Locales = []Locale{
+	{Code: "en", Name: "English"},
+	{Code: "es", Name: "Español"},
+}
+
+//go:embed locales/*.json
+var catalogFS embed.FS
+
+var (
+	catalogs = map[string]map[string]string{}
+	matcher  language.Matcher
+)
+
+func init() {
+	tags := make([]language.Tag, 0, len(Locales))
+	for _, l := range Locales {
+		tags = append(tags, language.Make(l.Code))
+		if l.Code == Default {
+			continue
+		}
+
+		data, err := catalogFS.ReadFile(path.Join("locales", l.Code+".json"))
+		if err != nil {
+			slog.Error("missing translation catalog", "locale", l.Code, "error", err)
+			continue
+		}
+		catalog := map[string]string{}
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			slog.Error("invalid translation catalog", "locale", l.Code, "error", err)
+			continue
+		}
+		catalogs[l.Code] = catalog
+	}
+	matcher = language.NewMatcher(tags)
+}
+
+// Supported reports whether code is one of Locales
+func Supported(code string) bool {
+	for _, l := range Locales {
+		if l.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Negotiate picks the best supported locale for an Accept-Language header
+func Negotiate(acceptLanguage string) string {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return Default
+	}
+	_, index, confidence := matcher.Match(tags...)
+	if confidence == language.No {
+		return Default
+	}
+	return Locales[index].Code
+}
+
+// T translates msg into locale. When args are given the translation is
+// used as a fmt format string, so "%s" placeholders survive translation.
+func T(locale, msg string, args ...any) string {
+	if translated, ok := catalogs[locale][msg]; ok && translated != "" {
+		msg = translated
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// Error translates an error's message, keeping errors with dynamic text
+// that has no catalog entry as they are. The translated error wraps the
+// original, so errors.Is still matches sentinels like application.ErrNotFound.
+func Error(locale string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if translated, ok := catalogs[locale][err.Error()]; ok && translated != "" {
+		return &translatedError{msg: translated, err: err}
+	}
+	return err
+}
+
+type translatedError struct {
+	msg string
+	err error
+}
+
+func (e *translatedError) Error() string { return e.msg }
+
+func (e *translatedError) Unwrap() error { return e.err }
+
+// Translator binds a locale for templates, e.g. {{t.T "Hey %s," user.Name}}
+type Translator struct {
+	Locale string
+}
+
+// For returns a Translator for locale, falling back to Default
+func For(locale string) Translator {
+	if !Supported(locale) {
+		locale = Default
+	}
+	return Translator{Locale: locale}
+}
+
+func (t Translator) T(msg string, args ...any) string {
+	return T(t.Locale, msg, args...)
+}
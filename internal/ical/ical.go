@@ -0,0 +1,112 @@
+// Package ical writes iCalendar (RFC 5545) feeds that calendar apps can
+// subscribe to. It only covers what the site publishes: a calendar of
+// point-in-time events with a title, description and link.
+package ical
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType is the media type for .ics responses
+const ContentType = "text/calendar; charset=utf-8"
+
+// maxLine is the longest content line allowed before folding, in octets
+const maxLine = 75
+
+// Calendar is a named feed of events
+type Calendar struct {
+	Name    string
+	Refresh time.Duration // How often clients should poll, 0 to leave it to them
+	Events  []Event
+}
+
+// Event is a single calendar entry. Events without an End are treated as
+// instants, which calendars show at their start time.
+type Event struct {
+	UID         string // Globally unique and stable across refreshes
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	URL         string
+	Updated     time.Time
+}
+
+// Encode renders the calendar as an iCalendar document
+func (c *Calendar) Encode() []byte {
+	var b bytes.Buffer
+	line(&b, "BEGIN:VCALENDAR")
+	line(&b, "VERSION:2.0")
+	line(&b, "PRODID:-//The Skyscape//Calendar//EN")
+	line(&b, "CALSCALE:GREGORIAN")
+	line(&b, "METHOD:PUBLISH")
+	if c.Name != "" {
+		line(&b, "X-WR-CALNAME:"+escape(c.Name))
+	}
+	if c.Refresh > 0 {
+		ttl := "PT" + strconv.Itoa(int(c.Refresh.Minutes())) + "M"
+		line(&b, "REFRESH-INTERVAL;VALUE=DURATION:"+ttl)
+		line(&b, "X-PUBLISHED-TTL:"+ttl)
+	}
+
+	for _, e := range c.Events {
+		line(&b, "BEGIN:VEVENT")
+		line(&b, "UID:"+escape(e.UID))
+		stamp := e.Updated
+		if stamp.IsZero() {
+			stamp = e.Start
+		}
+		line(&b, "DTSTAMP:"+timestamp(stamp))
+		line(&b, "DTSTART:"+timestamp(e.Start))
+		if !e.End.IsZero() {
+			line(&b, "DTEND:"+timestamp(e.End))
+		}
+		line(&b, "SUMMARY:"+escape(e.Summary))
+		if e.Description != "" {
+			line(&b, "DESCRIPTION:"+escape(e.Description))
+		}
+		if e.URL != "" {
+			line(&b, "URL:"+e.URL)
+		}
+		line(&b, "END:VEVENT")
+	}
+
+	line(&b, "END:VCALENDAR")
+	return b.Bytes()
+}
+
+func timestamp(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// escape quotes the characters RFC 5545 reserves in text values
+func escape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// line writes a content line, folding it at maxLine octets without
+// splitting a UTF-8 character. Continuation lines start with a space,
+// which counts toward their length.
+func line(b *bytes.Buffer, s string) {
+	limit := maxLine
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+		limit = maxLine - 1
+	}
+	b.WriteString(s + "\r\n")
+}
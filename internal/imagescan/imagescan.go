@@ -0,0 +1,155 @@
+// Package imagescan scans built images for known vulnerabilities in the
+// packages installed in them, using Trivy. Where internal/advisories reads
+// a project's own lockfiles, this covers the base image and anything the
+// Dockerfile installs. Scanning is skipped when Trivy isn't installed.
+package imagescan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"www.theskyscape.com/internal/tracing"
+	"www.theskyscape.com/models"
+)
+
+// Timeout bounds a scan. The first one also downloads Trivy's database.
+const Timeout = 10 * time.Minute
+
+// binary is the Trivy executable, TRIVY_PATH or trivy on the PATH
+func binary() string {
+	if path := os.Getenv("TRIVY_PATH"); path != "" {
+		return path
+	}
+	return "trivy"
+}
+
+// Enabled reports whether Trivy is installed
+func Enabled() bool {
+	_, err := exec.LookPath(binary())
+	return err == nil
+}
+
+// Report is the outcome of scanning an image
+type Report struct {
+	Critical, High, Moderate, Low int
+	Findings                      []*models.ImageVulnerability // Most severe first
+}
+
+// report is the part of Trivy's JSON output scans use
+type report struct {
+	Results []struct {
+		Vulnerabilities []struct {
+			VulnerabilityID  string
+			PkgName          string
+			InstalledVersion string
+			FixedVersion     string
+			Severity         string
+			Title            string
+		}
+	}
+}
+
+// severities maps Trivy's severities to the advisory ones
+var severities = map[string]string{
+	"CRITICAL": models.SeverityCritical,
+	"HIGH":     models.SeverityHigh,
+	"MEDIUM":   models.SeverityModerate,
+	"LOW":      models.SeverityLow,
+}
+
+var severityRank = map[string]int{
+	models.SeverityCritical: 0,
+	models.SeverityHigh:     1,
+	models.SeverityModerate: 2,
+	models.SeverityLow:      3,
+	models.SeverityUnknown:  4,
+}
+
+// Scan scans an image in the local Docker daemon, where it was just built
+func Scan(ctx context.Context, ref string) (result *Report, err error) {
+	ctx, span := tracing.Start(ctx, "trivy image", attribute.String("image.ref", ref))
+	defer func() { tracing.End(span, err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, binary(), "image",
+		"--quiet", "--format", "json", "--scanners", "vuln", "--image-src", "docker", ref)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "failed to scan image: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	var parsed report
+	if err = json.Unmarshal(stdout.Bytes(), &parsed); err != nil {
+		return nil, errors.Wrap(err, "failed to read scan")
+	}
+
+	result = &Report{}
+	seen := map[string]bool{}
+	for _, target := range parsed.Results {
+		for _, v := range target.Vulnerabilities {
+			// The same package can turn up in several layers
+			key := v.VulnerabilityID + " " + v.PkgName + " " + v.InstalledVersion
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			severity, ok := severities[v.Severity]
+			if !ok {
+				severity = models.SeverityUnknown
+			}
+			switch severity {
+			case models.SeverityCritical:
+				result.Critical++
+			case models.SeverityHigh:
+				result.High++
+			case models.SeverityModerate:
+				result.Moderate++
+			case models.SeverityLow:
+				result.Low++
+			}
+			result.Findings = append(result.Findings, &models.ImageVulnerability{
+				ID:       v.VulnerabilityID,
+				Package:  v.PkgName,
+				Version:  v.InstalledVersion,
+				FixedIn:  v.FixedVersion,
+				Severity: severity,
+				Title:    v.Title,
+			})
+		}
+	}
+
+	sort.SliceStable(result.Findings, func(i, j int) bool {
+		return severityRank[result.Findings[i].Severity] < severityRank[result.Findings[j].Severity]
+	})
+	return result, nil
+}
+
+// Apply copies the report onto the image it's for, keeping the worst
+// models.MaxImageVulnerabilities findings. The caller saves the image.
+func (r *Report) Apply(img *models.Image) {
+	findings := r.Findings
+	if len(findings) > models.MaxImageVulnerabilities {
+		findings = findings[:models.MaxImageVulnerabilities]
+	}
+	data, _ := json.Marshal(findings)
+
+	img.Scanned = true
+	img.CriticalCount = r.Critical
+	img.HighCount = r.High
+	img.ModerateCount = r.Moderate
+	img.LowCount = r.Low
+	img.Vulnerabilities = string(data)
+}
@@ -0,0 +1,104 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Standard avatar sizes in pixels
+const (
+	AvatarLarge = 256
+	AvatarSmall = 64
+)
+
+// MaxSourcePixels bounds decoded uploads to avoid decompression bombs
+const MaxSourcePixels = 4096 * 4096
+
+// ProcessAvatar decodes an uploaded image, crops it to a centered square,
+// and returns PNG encodings keyed by each requested size.
+func ProcessAvatar(r io.Reader, sizes ...int) (map[int][]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read image")
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.New("unsupported image format")
+	}
+	if cfg.Width*cfg.Height > MaxSourcePixels {
+		return nil, errors.New("image dimensions too large")
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode image")
+	}
+
+	square := CropSquare(src)
+	result := make(map[int][]byte, len(sizes))
+	for _, size := range sizes {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, Resize(square, size)); err != nil {
+			return nil, errors.Wrap(err, "failed to encode avatar")
+		}
+		result[size] = buf.Bytes()
+	}
+
+	return result, nil
+}
+
+// CropSquare returns the largest centered square region of an image
+func CropSquare(src image.Image) image.Image {
+	b := src.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(dst, dst.Bounds(), src, image.Pt(x0, y0), draw.Src)
+	return dst
+}
+
+// Resize scales a square image to size x size using box-filter averaging
+// when shrinking and nearest-neighbour sampling when enlarging.
+func Resize(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	scaleX := float64(b.Dx()) / float64(size)
+	scaleY := float64(b.Dy()) / float64(size)
+
+	for y := 0; y < size; y++ {
+		sy0 := b.Min.Y + int(float64(y)*scaleY)
+		sy1 := max(sy0+1, b.Min.Y+int(float64(y+1)*scaleY))
+		for x := 0; x < size; x++ {
+			sx0 := b.Min.X + int(float64(x)*scaleX)
+			sx1 := max(sx0+1, b.Min.X+int(float64(x+1)*scaleX))
+
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(bl / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,71 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+)
+
+// Badge colors, matching the shields.io palette READMEs are used to
+const (
+	BadgeGreen  = "#4c1"
+	BadgeBlue   = "#007ec6"
+	BadgeYellow = "#dfb317"
+	BadgeRed    = "#e05d44"
+	BadgeGrey   = "#9f9f9f"
+)
+
+// badgeFontSize is the text size badges are drawn with
+const badgeFontSize = 11
+
+// badgePadding is the horizontal space around each half's text
+const badgePadding = 6
+
+var badgeFace = sync.OnceValue(func() font.Face {
+	f, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		return nil
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: badgeFontSize, DPI: 72})
+	if err != nil {
+		return nil
+	}
+	return face
+})
+
+// Badge renders a flat, two-part SVG badge: a grey label and a colored
+// message, e.g. "stars | 42"
+func Badge(label, message, color string) []byte {
+	lw := textWidth(label) + 2*badgePadding
+	mw := textWidth(message) + 2*badgePadding
+	width := lw + mw
+
+	label, message = html.EscapeString(label), html.EscapeString(message)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">`, width, label, message)
+	fmt.Fprintf(&b, `<title>%s: %s</title>`, label, message)
+	b.WriteString(`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`)
+	fmt.Fprintf(&b, `<clipPath id="r"><rect width="%d" height="20" rx="3" fill="#fff"/></clipPath>`, width)
+	fmt.Fprintf(&b, `<g clip-path="url(#r)"><rect width="%d" height="20" fill="#555"/><rect x="%d" width="%d" height="20" fill="%s"/><rect width="%d" height="20" fill="url(#s)"/></g>`, lw, lw, mw, color, width)
+	b.WriteString(`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`)
+	fmt.Fprintf(&b, `<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%d" y="14">%s</text>`, lw/2, label, lw/2, label)
+	fmt.Fprintf(&b, `<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%d" y="14">%s</text>`, lw+mw/2, message, lw+mw/2, message)
+	b.WriteString(`</g></svg>`)
+	return b.Bytes()
+}
+
+// textWidth estimates how wide text renders in the badge font. Verdana is
+// wider than Go's font, so the measurement is scaled up to avoid clipping.
+func textWidth(text string) int {
+	face := badgeFace()
+	if face == nil {
+		return len(text) * 7
+	}
+	return font.MeasureString(face, text).Ceil() * 11 / 10
+}
@@ -0,0 +1,165 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Social card dimensions, the size Open Graph and Twitter recommend
+const (
+	CardWidth  = 1200
+	CardHeight = 630
+)
+
+// cardPadding is the margin around the card's content
+const cardPadding = 80
+
+// maxTitleLines bounds how much of a long title is drawn
+const maxTitleLines = 3
+
+// Card is the content of a social preview image
+type Card struct {
+	Kind   string      // Label above the title, e.g. "Repository"
+	Title  string      // Wrapped across up to three lines
+	Author string      // Shown next to the avatar, e.g. "@handle"
+	Avatar image.Image // Author avatar, cropped to a circle; may be nil
+	Stars  int
+}
+
+var (
+	cardBackground = color.RGBA{0x1d, 0x23, 0x2a, 0xff}
+	cardAccent     = color.RGBA{0x60, 0x5d, 0xff, 0xff}
+	cardText       = color.RGBA{0xf2, 0xf2, 0xf2, 0xff}
+	cardMuted      = color.RGBA{0xa6, 0xad, 0xbb, 0xff}
+)
+
+// SocialCard renders a card as a CardWidth x CardHeight PNG
+func SocialCard(card Card) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, CardWidth, CardHeight))
+	draw.Draw(img, img.Bounds(), &image.Uniform{cardBackground}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, CardWidth, 12), &image.Uniform{cardAccent}, image.Point{}, draw.Src)
+
+	kindFace, err := face(gobold.TTF, 32)
+	if err != nil {
+		return nil, err
+	}
+	titleFace, err := face(gobold.TTF, 64)
+	if err != nil {
+		return nil, err
+	}
+	bodyFace, err := face(goregular.TTF, 36)
+	if err != nil {
+		return nil, err
+	}
+
+	drawText(img, kindFace, cardAccent, cardPadding, cardPadding+32, strings.ToUpper(card.Kind))
+
+	y := cardPadding + 32 + 40
+	for _, line := range wrap(titleFace, card.Title, CardWidth-2*cardPadding, maxTitleLines) {
+		y += 76
+		drawText(img, titleFace, cardText, cardPadding, y, line)
+	}
+
+	// Footer: avatar and author on the left, stars and site on the right
+	footer := CardHeight - cardPadding
+	x := cardPadding
+	if card.Avatar != nil {
+		const size = 72
+		avatar := Resize(CropSquare(card.Avatar), size)
+		rect := image.Rect(x, footer-size+12, x+size, footer+12)
+		draw.DrawMask(img, rect, avatar, image.Point{}, &circle{size: size}, image.Point{}, draw.Over)
+		x += size + 24
+	}
+	drawText(img, bodyFace, cardText, x, footer, card.Author)
+
+	stars := strconv.Itoa(card.Stars) + " stars"
+	if card.Stars == 1 {
+		stars = "1 star"
+	}
+	right := stars + "  ·  The Skyscape"
+	width := font.MeasureString(bodyFace, right).Ceil()
+	drawText(img, bodyFace, cardMuted, CardWidth-cardPadding-width, footer, right)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, errors.Wrap(err, "failed to encode card")
+	}
+	return buf.Bytes(), nil
+}
+
+func face(ttf []byte, size float64) (font.Face, error) {
+	f, err := opentype.Parse(ttf)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse font")
+	}
+	return opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+}
+
+func drawText(img draw.Image, face font.Face, c color.Color, x, y int, text string) {
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  &image.Uniform{c},
+		Face: face,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
+
+// wrap breaks text into lines no wider than width, ending the last line
+// with an ellipsis if the text doesn't fit in maxLines
+func wrap(face font.Face, text string, width, maxLines int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		candidate := strings.TrimSpace(line + " " + word)
+		if line != "" && font.MeasureString(face, candidate).Ceil() > width {
+			lines = append(lines, line)
+			line = word
+			continue
+		}
+		line = candidate
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+		last := []rune(lines[maxLines-1])
+		for len(last) > 0 && font.MeasureString(face, string(last)+"…").Ceil() > width {
+			last = last[:len(last)-1]
+		}
+		lines[maxLines-1] = strings.TrimSpace(string(last)) + "…"
+	}
+	return lines
+}
+
+// circle is an alpha mask that rounds a square avatar
+type circle struct {
+	size int
+}
+
+func (c *circle) ColorModel() color.Model { return color.AlphaModel }
+
+func (c *circle) Bounds() image.Rectangle { return image.Rect(0, 0, c.size, c.size) }
+
+func (c *circle) At(x, y int) color.Color {
+	r := float64(c.size) / 2
+	dx, dy := float64(x)+0.5-r, float64(y)+0.5-r
+	if dx*dx+dy*dy <= r*r {
+		return color.Alpha{0xff}
+	}
+	return color.Alpha{0}
+}
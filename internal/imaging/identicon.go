@@ -0,0 +1,53 @@
+package imaging
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+)
+
+// identiconGrid is the number of cells per side; the left half is mirrored
+const identiconGrid = 5
+
+// Identicon generates a deterministic, horizontally symmetric avatar for
+// the given seed (usually a user ID) encoded as a PNG of size x size.
+func Identicon(seed string, size int) []byte {
+	sum := sha256.Sum256([]byte(seed))
+
+	background := color.RGBA{0x1d, 0x23, 0x2a, 0xff}
+	foreground := color.RGBA{
+		R: 0x60 + sum[0]%0x90,
+		G: 0x60 + sum[1]%0x90,
+		B: 0x60 + sum[2]%0x90,
+		A: 0xff,
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), &image.Uniform{background}, image.Point{}, draw.Src)
+
+	cell := size / (identiconGrid + 1)
+	offset := (size - cell*identiconGrid) / 2
+	half := (identiconGrid + 1) / 2
+
+	for row := 0; row < identiconGrid; row++ {
+		for col := 0; col < half; col++ {
+			if sum[3+row*half+col]%2 == 0 {
+				continue
+			}
+			for _, c := range []int{col, identiconGrid - 1 - col} {
+				rect := image.Rect(
+					offset+c*cell, offset+row*cell,
+					offset+(c+1)*cell, offset+(row+1)*cell,
+				)
+				draw.Draw(img, rect, &image.Uniform{foreground}, image.Point{}, draw.Src)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
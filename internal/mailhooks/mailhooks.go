@@ -0,0 +1,113 @@
+// Package mailhooks verifies and parses delivery webhooks from Resend, the
+// email provider. Resend signs webhooks the Svix way: an HMAC-SHA256 over
+// "id.timestamp.body", keyed with the base64 part of RESEND_WEBHOOK_SECRET.
+package mailhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event types
+const (
+	EventDelivered  = "email.delivered"
+	EventBounced    = "email.bounced"
+	EventComplained = "email.complained"
+)
+
+// tolerance is how old a signed webhook can be
+const tolerance = 5 * time.Minute
+
+// Event is a delivery event for one email
+type Event struct {
+	Type string `json:"type"`
+	Data struct {
+		EmailID string   `json:"email_id"`
+		To      []string `json:"to"`
+		Subject string   `json:"subject"`
+		Bounce  struct {
+			Type    string `json:"type"` // "Permanent", "Transient" or "Undetermined"
+			SubType string `json:"subType"`
+			Message string `json:"message"`
+		} `json:"bounce"`
+	} `json:"data"`
+}
+
+// Permanent reports whether the event means the address shouldn't be
+// mailed again: a complaint, or a bounce that isn't transient
+func (e *Event) Permanent() bool {
+	switch e.Type {
+	case EventComplained:
+		return true
+	case EventBounced:
+		return e.Data.Bounce.Type != "Transient"
+	}
+	return false
+}
+
+// Detail describes why an email bounced or was complained about
+func (e *Event) Detail() string {
+	b := e.Data.Bounce
+	switch {
+	case e.Type == EventComplained:
+		return "Marked as spam"
+	case b.Message != "":
+		return b.Message
+	case b.SubType != "":
+		return b.Type + ": " + b.SubType
+	}
+	return b.Type
+}
+
+// Verify checks a webhook's signature and returns its event
+func Verify(payload []byte, header http.Header) (*Event, error) {
+	secret, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(os.Getenv("RESEND_WEBHOOK_SECRET"), "whsec_"))
+	if err != nil || len(secret) == 0 {
+		return nil, fmt.Errorf("webhook secret not configured")
+	}
+
+	id, timestamp := header.Get("svix-id"), header.Get("svix-timestamp")
+	if id == "" || timestamp == "" {
+		return nil, fmt.Errorf("invalid signature headers")
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp")
+	}
+	if age := time.Since(time.Unix(ts, 0)); age > tolerance || age < -tolerance {
+		return nil, fmt.Errorf("timestamp outside tolerance window")
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(id + "." + timestamp + "." + string(payload)))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	// The header lists space-separated "v1,<signature>" pairs, one per
+	// active secret
+	verified := false
+	for _, sig := range strings.Fields(header.Get("svix-signature")) {
+		version, value, _ := strings.Cut(sig, ",")
+		if version == "v1" && hmac.Equal([]byte(value), []byte(expected)) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, fmt.Errorf("signature verification failed")
+	}
+
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
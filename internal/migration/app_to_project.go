@@ -83,8 +83,9 @@ func MigrateAppToProject(app *models.App, customID string) (*models.Project, err
 	// Since projectID == app.ID, this just sets ProjectID = AppID
 	models.DB.Query("UPDATE images SET ProjectID = ? WHERE AppID = ?", projectID, app.ID).Exec()
 
-	// Migrate Stars: copy repo stars to project
-	models.DB.Query("UPDATE stars SET ProjectID = ? WHERE RepoID = ?", projectID, repo.ID).Exec()
+	// Migrate Stars: move repo and app stars to the project
+	models.DB.Query("UPDATE stars SET SubjectType = 'project', SubjectID = ? WHERE SubjectType = 'repo' AND SubjectID = ?", projectID, repo.ID).Exec()
+	models.DB.Query("UPDATE stars SET SubjectType = 'project', SubjectID = ? WHERE SubjectType = 'app' AND SubjectID = ?", projectID, app.ID).Exec()
 
 	// Migrate OAuth Authorizations: update ProjectID for all with this AppID
 	models.DB.Query("UPDATE oauth_authorizations SET ProjectID = ? WHERE AppID = ?", projectID, app.ID).Exec()
@@ -0,0 +1,30 @@
+package migration
+
+import (
+	"log/slog"
+
+	"www.theskyscape.com/models"
+)
+
+// MigrateComments backfills Comment.SubjectType on comments from before it
+// existed by finding what each SubjectID belongs to. File comments are
+// recognized by their "file:" prefix; on an ID collision the first match
+// wins, in the order below. Cached comment counts catch up on the next
+// counter reconciliation. Safe to run on every start.
+func MigrateComments() {
+	queries := []string{
+		"UPDATE comments SET SubjectType = 'file' WHERE SubjectType = '' AND SubjectID LIKE 'file:%'",
+		"UPDATE comments SET SubjectType = 'post' WHERE SubjectType = '' AND SubjectID IN (SELECT ID FROM activities)",
+		"UPDATE comments SET SubjectType = 'thought' WHERE SubjectType = '' AND SubjectID IN (SELECT ID FROM thoughts)",
+		"UPDATE comments SET SubjectType = 'app' WHERE SubjectType = '' AND SubjectID IN (SELECT ID FROM apps)",
+		"UPDATE comments SET SubjectType = 'project' WHERE SubjectType = '' AND SubjectID IN (SELECT ID FROM projects)",
+		"UPDATE comments SET SubjectType = 'repo' WHERE SubjectType = '' AND SubjectID IN (SELECT ID FROM repos)",
+	}
+
+	for _, query := range queries {
+		if err := models.DB.Query(query).Exec(); err != nil {
+			slog.Error("failed to migrate comments", "error", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package migration
+
+import (
+	"log/slog"
+
+	"www.theskyscape.com/models"
+)
+
+// MigrateStars moves stars from the per-type columns and the old
+// thought_stars table onto Star.SubjectType and Star.SubjectID. Cached
+// star counts catch up on the next counter reconciliation. Safe to run on
+// every start.
+func MigrateStars() {
+	queries := []string{
+		"UPDATE stars SET SubjectType = 'repo', SubjectID = RepoID WHERE SubjectType = '' AND RepoID != ''",
+		"UPDATE stars SET SubjectType = 'project', SubjectID = ProjectID WHERE SubjectType = '' AND ProjectID != ''",
+	}
+
+	// thought_stars only exists on databases from before stars were unified
+	var legacy string
+	models.DB.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'thought_stars'").Scan(&legacy)
+	if legacy != "" {
+		queries = append(queries, `
+			INSERT INTO stars (ID, CreatedAt, UpdatedAt, UserID, SubjectType, SubjectID)
+			SELECT ID, CreatedAt, UpdatedAt, UserID, 'thought', ThoughtID FROM thought_stars
+			WHERE ID NOT IN (SELECT ID FROM stars)
+		`)
+	}
+
+	for _, query := range queries {
+		if err := models.DB.Query(query).Exec(); err != nil {
+			slog.Error("failed to migrate stars", "error", err)
+			return
+		}
+	}
+}
@@ -8,8 +8,9 @@ import (
 
 const CodeExpiry = 10 * time.Minute
 
-// CreateAuthorizationCode creates a new authorization code for the OAuth flow
-func CreateAuthorizationCode(clientID, userID, redirectURI, scopes string) (string, error) {
+// CreateAuthorizationCode creates a new authorization code for the OAuth
+// flow. nonce is the OpenID Connect nonce, if the app sent one.
+func CreateAuthorizationCode(clientID, userID, redirectURI, scopes, nonce string) (string, error) {
 	code, err := GenerateToken(32)
 	if err != nil {
 		return "", err
@@ -23,6 +24,7 @@ func CreateAuthorizationCode(clientID, userID, redirectURI, scopes string) (stri
 		Code:        hashedCode,
 		RedirectURI: redirectURI,
 		Scopes:      scopes,
+		Nonce:       nonce,
 		ExpiresAt:   time.Now().Add(CodeExpiry),
 		Used:        false,
 	}
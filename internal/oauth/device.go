@@ -0,0 +1,84 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"www.theskyscape.com/models"
+)
+
+// DeviceGrantType is the token endpoint grant type for the device flow
+const DeviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+const (
+	DeviceCodeExpiry   = 15 * time.Minute
+	DevicePollInterval = 5 * time.Second
+)
+
+// userCodeAlphabet has no vowels, so codes can't spell words, and no
+// characters that are easily confused
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// CreateDeviceCode starts a device authorization, returning the device
+// code the client polls with and the user code the user approves
+func CreateDeviceCode(clientID, scopes string) (string, string, error) {
+	deviceCode, err := GenerateToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	var code strings.Builder
+	for i := range 8 {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(userCodeAlphabet))))
+		if err != nil {
+			return "", "", errors.Wrap(err, "failed to generate user code")
+		}
+		if i == 4 {
+			code.WriteByte('-')
+		}
+		code.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+	userCode := code.String()
+
+	if _, err := models.OAuthDeviceCodes.Insert(&models.OAuthDeviceCode{
+		ClientID:   clientID,
+		DeviceCode: HashToken(deviceCode),
+		UserCode:   userCode,
+		Scopes:     scopes,
+		Status:     models.DevicePending,
+		ExpiresAt:  time.Now().Add(DeviceCodeExpiry),
+	}); err != nil {
+		return "", "", err
+	}
+
+	return deviceCode, userCode, nil
+}
+
+// FindUserCode returns the pending device authorization for a user code,
+// however the user typed it
+func FindUserCode(input string) (*models.OAuthDeviceCode, error) {
+	var normalized strings.Builder
+	for _, r := range strings.ToUpper(input) {
+		if strings.ContainsRune(userCodeAlphabet, r) {
+			normalized.WriteRune(r)
+		}
+	}
+	userCode := normalized.String()
+	if len(userCode) != 8 {
+		return nil, errors.New("invalid code")
+	}
+	userCode = userCode[:4] + "-" + userCode[4:]
+
+	var device *models.OAuthDeviceCode
+	err := models.ReadAfterWrite(func() (err error) {
+		device, err = models.OAuthDeviceCodes.First("WHERE UserCode = ? AND Status = ?", userCode, models.DevicePending)
+		return err
+	})
+	if err != nil || device.IsExpired() {
+		return nil, errors.New("invalid or expired code")
+	}
+	return device, nil
+}
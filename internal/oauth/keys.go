@@ -0,0 +1,360 @@
+package oauth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"www.theskyscape.com/models"
+)
+
+// AccessTokenExpiry is how long an access token is valid
+const AccessTokenExpiry = 30 * 24 * time.Hour
+
+// SigningKeyRotation is how old the signing key gets before a new one
+// takes over. The old key stays published until every token it signed has
+// expired, so apps that cache the JWKS keep verifying through a rotation.
+const SigningKeyRotation = 90 * 24 * time.Hour
+
+// keyringRefresh is how often a server picks up keys rotated by another,
+// and keyringReload the least time between reloads forced by a token
+// naming a key it doesn't know
+const (
+	keyringRefresh = 5 * time.Minute
+	keyringReload  = 10 * time.Second
+)
+
+// Signing algorithms. New keys use SIGNING_ALGORITHM, RS256 by default
+// since every JWT library supports it.
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// signingKey is a stored key, parsed
+type signingKey struct {
+	*models.SigningKey
+	signer crypto.Signer
+}
+
+func (k *signingKey) method() jwt.SigningMethod {
+	if k.Algorithm == AlgorithmEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+var keyring struct {
+	sync.Mutex
+	keys     []*signingKey // Published keys, newest first
+	loadedAt time.Time
+}
+
+// publishedKeys returns the keys tokens may be signed with, newest first,
+// rotating in a new key when there isn't one or the newest is due. force
+// reloads them from the database rather than using the cached ones, unless
+// they were loaded within keyringReload.
+func publishedKeys(force bool) ([]*signingKey, error) {
+	keyring.Lock()
+	defer keyring.Unlock()
+	age := time.Since(keyring.loadedAt)
+	if len(keyring.keys) > 0 && (age < keyringReload || !force && age < keyringRefresh) {
+		return keyring.keys, nil
+	}
+
+	keys, err := loadKeys()
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 || time.Since(keys[0].CreatedAt) > SigningKeyRotation {
+		key, err := generateKey()
+		if err != nil {
+			return nil, err
+		}
+		keys = append([]*signingKey{key}, keys...)
+	}
+
+	keyring.keys, keyring.loadedAt = keys, time.Now()
+	return keys, nil
+}
+
+// loadKeys reads the published keys. A key is published until its
+// successor has been signing for AccessTokenExpiry, or until it's revoked.
+func loadKeys() ([]*signingKey, error) {
+	stored, err := models.SigningKeys.Search("WHERE Revoked = false ORDER BY CreatedAt DESC")
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*signingKey
+	for i, s := range stored {
+		if i > 0 && time.Since(stored[i-1].CreatedAt) > AccessTokenExpiry {
+			break
+		}
+		signer, err := parseKey(s.PrivateKey)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, &signingKey{SigningKey: s, signer: signer})
+	}
+	return keys, nil
+}
+
+// generateKey creates and stores a key with the configured algorithm
+func generateKey() (*signingKey, error) {
+	algorithm := AlgorithmRS256
+	if os.Getenv("SIGNING_ALGORITHM") == AlgorithmEdDSA {
+		algorithm = AlgorithmEdDSA
+	}
+
+	var signer crypto.Signer
+	var err error
+	if algorithm == AlgorithmEdDSA {
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	} else {
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := models.SigningKeys.Insert(&models.SigningKey{
+		Algorithm:  algorithm,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &signingKey{SigningKey: stored, signer: signer}, nil
+}
+
+// parseKey decodes a PEM encoded RSA or Ed25519 private key
+func parseKey(encoded string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(encoded))
+	if block == nil {
+		return nil, errors.New("invalid signing key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case ed25519.PrivateKey:
+		return key, nil
+	}
+	return nil, errors.New("signing key is not an RSA or Ed25519 key")
+}
+
+// RotateSigningKey puts a new key in charge of signing straight away. With
+// revoke, every older key is withdrawn too, for when one has leaked; tokens
+// they signed stop working, here immediately and on other servers within
+// keyringRefresh.
+func RotateSigningKey(revoke bool) (*models.SigningKey, error) {
+	keyring.Lock()
+	defer keyring.Unlock()
+
+	if revoke {
+		if err := models.DB.Query("UPDATE signing_keys SET Revoked = true WHERE Revoked = false").Exec(); err != nil {
+			return nil, err
+		}
+	}
+	key, err := generateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []*signingKey{key}
+	if !revoke {
+		if loaded, err := loadKeys(); err == nil {
+			keys = loaded
+		}
+		if len(keys) == 0 || keys[0].ID != key.ID {
+			keys = append([]*signingKey{key}, keys...)
+		}
+	}
+	keyring.keys, keyring.loadedAt = keys, time.Now()
+	return key.SigningKey, nil
+}
+
+// sign signs claims with the newest key, naming it in the kid header
+func sign(claims jwt.Claims) (string, error) {
+	keys, err := publishedKeys(false)
+	if err != nil {
+		return "", err
+	}
+	key := keys[0]
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signer)
+}
+
+// firstKey caches when the first signing key was created, which never
+// changes once there is one
+var firstKey struct {
+	sync.Mutex
+	createdAt time.Time
+}
+
+// KeysIntroducedAt returns when the first signing key was created, which
+// is when access tokens stopped being HS256 with AUTH_SECRET. It's the
+// zero time while there are no keys yet.
+func KeysIntroducedAt() (time.Time, error) {
+	firstKey.Lock()
+	defer firstKey.Unlock()
+	if !firstKey.createdAt.IsZero() {
+		return firstKey.createdAt, nil
+	}
+
+	keys, err := models.SigningKeys.Search("ORDER BY CreatedAt ASC LIMIT 1")
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(keys) > 0 {
+		firstKey.createdAt = keys[0].CreatedAt
+	}
+	return firstKey.createdAt, nil
+}
+
+// IssueAccessToken signs an access token for an app or project acting for
+// a user. Apps can verify it against the JWKS without calling back, but
+// only the API sees a user revoking access before it expires.
+func IssueAccessToken(issuer, userID, clientID, scopes string) (string, error) {
+	now := time.Now()
+	return sign(jwt.MapClaims{
+		"iss":       issuer,
+		"sub":       userID,
+		"client_id": clientID,
+		"scope":     scopes,
+		"iat":       now.Unix(),
+		"exp":       now.Add(AccessTokenExpiry).Unix(),
+	})
+}
+
+// VerificationKey returns the public key a token names in its kid header,
+// for jwt.Parse. A kid this server hasn't seen yet may be a key another
+// server just rotated in, so the keys are reloaded once to look for it.
+func VerificationKey(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	for _, force := range []bool{false, true} {
+		keys, err := publishedKeys(force)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if key.ID != kid {
+				continue
+			}
+			if token.Method.Alg() != key.method().Alg() {
+				return nil, errors.New("invalid signing method")
+			}
+			return key.signer.Public(), nil
+		}
+	}
+	return nil, errors.New("unknown signing key")
+}
+
+// Algorithms returns the algorithms of the published keys, for discovery
+func Algorithms() []string {
+	keys, err := publishedKeys(false)
+	if err != nil {
+		return []string{AlgorithmRS256}
+	}
+	var algorithms []string
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if !seen[key.Algorithm] {
+			seen[key.Algorithm] = true
+			algorithms = append(algorithms, key.Algorithm)
+		}
+	}
+	return algorithms
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Modulus   string `json:"n,omitempty"`   // RSA
+	Exponent  string `json:"e,omitempty"`   // RSA
+	Curve     string `json:"crv,omitempty"` // EdDSA
+	X         string `json:"x,omitempty"`   // EdDSA
+}
+
+// JWKS returns the public halves of the published keys, for apps
+// verifying tokens
+func JWKS() []JWK {
+	keys, _ := publishedKeys(false)
+
+	jwks := []JWK{}
+	for _, key := range keys {
+		jwk := JWK{
+			Use:       "sig",
+			Algorithm: key.Algorithm,
+			KeyID:     key.ID,
+		}
+		switch public := key.signer.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.Modulus = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.Exponent = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		jwks = append(jwks, jwk)
+	}
+	return jwks
+}
+
+// KeyStatus is a signing key as the admin page shows it
+type KeyStatus struct {
+	*models.SigningKey
+	Signing        bool      // Signs new tokens
+	PublishedUntil time.Time // When it leaves the JWKS, zero while signing
+}
+
+// SigningKeys returns recent keys, newest first, including ones no longer
+// published
+func SigningKeys() []*KeyStatus {
+	stored, _ := models.SigningKeys.Search("ORDER BY CreatedAt DESC LIMIT 20")
+
+	var statuses []*KeyStatus
+	var successor *models.SigningKey
+	for _, s := range stored {
+		status := &KeyStatus{SigningKey: s}
+		if !s.Revoked {
+			if successor == nil {
+				status.Signing = true
+			} else {
+				status.PublishedUntil = successor.CreatedAt.Add(AccessTokenExpiry)
+			}
+			successor = s
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// IsPublished reports whether the key is still in the JWKS
+func (k *KeyStatus) IsPublished() bool {
+	return !k.Revoked && (k.Signing || time.Now().Before(k.PublishedUntil))
+}
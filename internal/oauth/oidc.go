@@ -0,0 +1,65 @@
+package oauth
+
+import (
+	"slices"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/authentication"
+	"github.com/golang-jwt/jwt/v5"
+	"www.theskyscape.com/models"
+)
+
+// IDTokenExpiry is how long an ID token is valid. Apps use it once, right
+// after signing in, so it's kept short.
+const IDTokenExpiry = time.Hour
+
+// OpenID Connect scopes on top of the API's own
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// UserClaims returns the standard claims about a user that the granted
+// scopes allow, shared by ID tokens and the userinfo endpoint. host is
+// prepended to relative URLs like uploaded avatars.
+func UserClaims(user *authentication.User, scopes []string, host string) map[string]any {
+	claims := map[string]any{"sub": user.ID}
+	if slices.Contains(scopes, ScopeProfile) || slices.Contains(scopes, "user:read") {
+		picture := user.Avatar
+		if profile, err := models.Profiles.First("WHERE UserID = ?", user.ID); err == nil {
+			picture = profile.Avatar()
+		}
+		if len(picture) > 0 && picture[0] == '/' {
+			picture = host + picture
+		}
+		claims["name"] = user.Name
+		claims["preferred_username"] = user.Handle
+		claims["picture"] = picture
+		claims["profile"] = host + "/user/" + user.Handle
+		claims["updated_at"] = user.UpdatedAt.Unix()
+	}
+	if slices.Contains(scopes, ScopeEmail) {
+		claims["email"] = user.Email
+		// Addresses aren't confirmed at signup, so apps shouldn't treat
+		// them as proof of ownership
+		claims["email_verified"] = false
+	}
+	return claims
+}
+
+// IssueIDToken signs an OpenID Connect ID token for a user signing in to
+// a client, issued by issuer
+func IssueIDToken(issuer, clientID string, user *authentication.User, scopes []string, nonce string) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims(UserClaims(user, scopes, issuer))
+	claims["iss"] = issuer
+	claims["aud"] = clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(IDTokenExpiry).Unix()
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	return sign(claims)
+}
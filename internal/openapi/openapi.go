@@ -0,0 +1,369 @@
+// Package openapi builds an OpenAPI 3 document from a list of operations.
+// Request and response schemas are reflected from the Go types the
+// handlers encode, so the document can't drift from what the API sends.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version is the OpenAPI version documents are written in
+const Version = "3.0.3"
+
+// Security schemes an operation can require
+const (
+	OAuth        = "oauth"        // Bearer access token with Scopes
+	DeployToken  = "deployToken"  // Bearer skd_ deploy token
+	ServiceToken = "serviceToken" // Bearer service token of a project
+	ClientSecret = "clientSecret" // OAuth client ID and secret with Basic Auth
+)
+
+// Operation is one endpoint
+type Operation struct {
+	Method      string
+	Path        string // e.g. "/api/repos/{id}"
+	Tag         string
+	Summary     string
+	Description string
+	Security    []string // Any one of these schemes is accepted
+	Scopes      []string // Required with OAuth
+	Paged       bool     // Takes cursor and limit, returns X-Next-Cursor
+	Request     any      // JSON body, a value of the type decoded
+	Status      int      // Success status, 200 by default
+	Response    any      // A value of the type encoded on success
+}
+
+// ID returns the operation's operationId, e.g. "getApiReposId"
+func (o *Operation) ID() string {
+	id := strings.ToLower(o.Method)
+	for _, part := range strings.FieldsFunc(o.Path, func(r rune) bool { return r == '/' || r == '{' || r == '}' }) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+// Params returns the names of the path parameters
+func (o *Operation) Params() []string {
+	var params []string
+	for _, match := range pathParam.FindAllStringSubmatch(o.Path, -1) {
+		params = append(params, match[1])
+	}
+	return params
+}
+
+// SuccessStatus returns the status a successful call responds with
+func (o *Operation) SuccessStatus() int {
+	if o.Status == 0 {
+		return http.StatusOK
+	}
+	return o.Status
+}
+
+var pathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+// Info describes the API as a whole
+type Info struct {
+	Title       string
+	Description string
+	Version     string
+	Server      string // Base URL, e.g. "https://www.theskyscape.com"
+	TokenURL    string
+	AuthURL     string
+	Scopes      map[string]string // OAuth scopes and what they allow
+}
+
+// Document returns the OpenAPI document for the operations, ready to be
+// encoded as JSON
+func Document(info Info, operations []Operation) map[string]any {
+	schemas := map[string]any{}
+	paths := map[string]map[string]any{}
+
+	for _, op := range operations {
+		operation := map[string]any{
+			"operationId": op.ID(),
+			"summary":     op.Summary,
+			"tags":        []string{op.Tag},
+		}
+		if op.Description != "" {
+			operation["description"] = op.Description
+		}
+
+		var params []map[string]any
+		for _, name := range op.Params() {
+			params = append(params, map[string]any{
+				"name": name, "in": "path", "required": true,
+				"schema": map[string]any{"type": "string"},
+			})
+		}
+		if op.Paged {
+			params = append(params, map[string]any{
+				"name": "cursor", "in": "query",
+				"description": "X-Next-Cursor from the previous page",
+				"schema":      map[string]any{"type": "string"},
+			}, map[string]any{
+				"name": "limit", "in": "query",
+				"description": "Page size; every item is returned when neither this nor cursor is set",
+				"schema":      map[string]any{"type": "integer", "minimum": 1},
+			})
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+
+		if op.Request != nil {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": schemaOf(reflect.TypeOf(op.Request), schemas)},
+				},
+			}
+		}
+
+		success := map[string]any{"description": http.StatusText(op.SuccessStatus())}
+		if op.Response != nil {
+			success["content"] = map[string]any{
+				"application/json": map[string]any{"schema": schemaOf(reflect.TypeOf(op.Response), schemas)},
+			}
+		}
+		headers := rateLimitHeaders()
+		if op.Paged {
+			headers["X-Next-Cursor"] = map[string]any{
+				"description": "Cursor of the next page, set when a full page was returned",
+				"schema":      map[string]any{"type": "string"},
+			}
+		}
+		success["headers"] = headers
+
+		limited := rateLimitHeaders()
+		limited["Retry-After"] = map[string]any{
+			"description": "Seconds until the limit resets",
+			"schema":      map[string]any{"type": "integer"},
+		}
+		operation["responses"] = map[string]any{
+			strconv.Itoa(op.SuccessStatus()): success,
+			"429": map[string]any{
+				"description": "Rate limit reached",
+				"headers":     limited,
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Error"}},
+				},
+			},
+			"default": map[string]any{
+				"description": "Error",
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Error"}},
+				},
+			},
+		}
+
+		var security []map[string][]string
+		for _, scheme := range op.Security {
+			scopes := []string{}
+			if scheme == OAuth {
+				scopes = op.Scopes
+			}
+			security = append(security, map[string][]string{scheme: scopes})
+		}
+		operation["security"] = security
+
+		if paths[op.Path] == nil {
+			paths[op.Path] = map[string]any{}
+		}
+		paths[op.Path][strings.ToLower(op.Method)] = operation
+	}
+
+	schemas["Error"] = map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"error": map[string]any{"type": "string"}},
+	}
+
+	return map[string]any{
+		"openapi": Version,
+		"info": map[string]any{
+			"title":       info.Title,
+			"description": info.Description,
+			"version":     info.Version,
+		},
+		"servers": []map[string]any{{"url": info.Server}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				OAuth: map[string]any{
+					"type": "oauth2",
+					"flows": map[string]any{
+						"authorizationCode": map[string]any{
+							"authorizationUrl": info.AuthURL,
+							"tokenUrl":         info.TokenURL,
+							"scopes":           info.Scopes,
+						},
+					},
+				},
+				DeployToken:  map[string]any{"type": "http", "scheme": "bearer", "description": "A project deploy token (skd_...)"},
+				ServiceToken: map[string]any{"type": "http", "scheme": "bearer", "description": "A project's service token"},
+				ClientSecret: map[string]any{"type": "http", "scheme": "basic", "description": "OAuth client ID and secret"},
+			},
+		},
+	}
+}
+
+// rateLimitHeaders describes the headers every API response reports its
+// rate limit in
+func rateLimitHeaders() map[string]any {
+	return map[string]any{
+		"X-RateLimit-Limit": map[string]any{
+			"description": "Requests allowed per hour for this token and scope",
+			"schema":      map[string]any{"type": "integer"},
+		},
+		"X-RateLimit-Remaining": map[string]any{
+			"description": "Requests left in the current hour",
+			"schema":      map[string]any{"type": "integer"},
+		},
+		"X-RateLimit-Reset": map[string]any{
+			"description": "Unix time the count resets at",
+			"schema":      map[string]any{"type": "integer"},
+		},
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf returns the schema of t, adding named structs to schemas and
+// referring to them by name
+func schemaOf(t reflect.Type, schemas map[string]any) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		if _, ok := schemas[t.Name()]; !ok {
+			schemas[t.Name()] = nil // Reserved, in case the type refers to itself
+			schemas[t.Name()] = structSchema(t, schemas)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	case t.Kind() == reflect.Struct:
+		return structSchema(t, schemas)
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem(), schemas)}
+	}
+	return map[string]any{}
+}
+
+// structSchema describes a struct's JSON fields
+func structSchema(t reflect.Type, schemas map[string]any) map[string]any {
+	properties := map[string]any{}
+	for _, field := range jsonFields(t) {
+		properties[field.Name] = schemaOf(field.Type, schemas)
+	}
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+// jsonField is a struct field as encoding/json names it
+type jsonField struct {
+	Name string
+	Type reflect.Type
+}
+
+// jsonFields lists the fields encoding/json encodes, inlining embedded
+// structs the way it does
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			fields = append(fields, jsonFields(fieldType)...)
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, jsonField{Name: name, Type: field.Type})
+	}
+	return fields
+}
+
+// RequestExample returns an example request body, or "" without one
+func (o *Operation) RequestExample() string {
+	return example(o.Request)
+}
+
+// ResponseExample returns an example response body, or "" without one
+func (o *Operation) ResponseExample() string {
+	return example(o.Response)
+}
+
+// example renders a value of v's type as indented JSON, with placeholder
+// values and one item in each list, for the docs page
+func example(v any) string {
+	if v == nil {
+		return ""
+	}
+	data, _ := json.MarshalIndent(exampleOf(reflect.TypeOf(v)), "", "  ")
+	return string(data)
+}
+
+func exampleOf(t reflect.Type) any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return "2025-01-01T00:00:00Z"
+	case t.Kind() == reflect.Struct:
+		fields := map[string]any{}
+		for _, field := range jsonFields(t) {
+			fields[field.Name] = exampleOf(field.Type)
+		}
+		return fields
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return false
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return 0
+	case reflect.Slice, reflect.Array:
+		return []any{exampleOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"key": exampleOf(t.Elem())}
+	}
+	return nil
+}
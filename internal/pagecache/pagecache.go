@@ -0,0 +1,270 @@
+// Package pagecache serves public pages to anonymous visitors from memory
+// and adds ETags so repeat visits revalidate with a 304 instead of a full
+// render. It absorbs traffic spikes (e.g. a promoted post) that would
+// otherwise render the same page from the database on every hit.
+package pagecache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxEntries bounds the number of cached pages
+	maxEntries = 2000
+
+	// maxBodySize skips caching unusually large pages
+	maxBodySize = 2 << 20
+)
+
+type entry struct {
+	path        string
+	contentType string
+	body        []byte
+	etag        string
+	expires     time.Time
+}
+
+var cache = struct {
+	mu      sync.RWMutex
+	entries map[string]*entry
+}{entries: map[string]*entry{}}
+
+// PurgePages drops the cached copies of the pages at each path and the
+// pages under it, so visitors see a change without waiting for them to
+// expire
+func PurgePages(paths ...string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	for key, e := range cache.entries {
+		for _, p := range paths {
+			if e.path == p || strings.HasPrefix(e.path, strings.TrimSuffix(p, "/")+"/") {
+				delete(cache.entries, key)
+				break
+			}
+		}
+	}
+}
+
+// PurgeOnWrite purges the pages a write request may have changed once it's
+// handled, as listed by pages. Only pages are purged, never the whole
+// cache, so a flood of writes can't defeat it.
+func PurgeOnWrite(pages func(r *http.Request) []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if paths := pages(r); len(paths) > 0 {
+				PurgePages(paths...)
+			}
+		}
+	})
+}
+
+// Middleware caches successful GET responses for ttl when the request has
+// no session cookie or Authorization header, and sets an ETag on every
+// successful response. Responses that set cookies are never cached. Pages
+// are told apart by the varyCookies they depend on; other cookies are
+// ignored, so they can't fill the cache with copies of one page.
+func Middleware(sessionCookie string, varyCookies []string, ttl time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		anonymous := r.Header.Get("Authorization") == ""
+		if _, err := r.Cookie(sessionCookie); err == nil {
+			anonymous = false
+		}
+
+		key := cacheKey(r, varyCookies)
+		if anonymous {
+			if e := lookup(key); e != nil {
+				w.Header().Set("X-Cache", "HIT")
+				write(w, r, e.contentType, e.etag, true, e.body)
+				return
+			}
+		}
+
+		buf := &buffer{header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(buf, r)
+
+		for k, v := range buf.header {
+			w.Header()[k] = v
+		}
+		if buf.status != http.StatusOK {
+			w.WriteHeader(buf.status)
+			w.Write(buf.body.Bytes())
+			return
+		}
+
+		body := buf.body.Bytes()
+		etag := etagOf(body)
+		contentType := buf.header.Get("Content-Type")
+
+		cacheable := anonymous && r.Method == http.MethodGet &&
+			buf.header.Get("Set-Cookie") == "" && len(body) <= maxBodySize
+		if cacheable {
+			store(key, &entry{
+				path:        r.URL.Path,
+				contentType: contentType,
+				body:        body,
+				etag:        etag,
+				expires:     time.Now().Add(ttl),
+			})
+			w.Header().Set("X-Cache", "MISS")
+		}
+
+		write(w, r, contentType, etag, anonymous, body)
+	})
+}
+
+// ETags sets an ETag on successful GET responses and answers a request
+// whose If-None-Match still matches with 304 Not Modified. Unlike
+// Middleware nothing is cached, so it suits per-user responses like the
+// API's: clients polling them skip the body when nothing changed.
+func ETags(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		buf := &buffer{header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(buf, r)
+
+		for k, v := range buf.header {
+			w.Header()[k] = v
+		}
+		if buf.status != http.StatusOK {
+			w.WriteHeader(buf.status)
+			w.Write(buf.body.Bytes())
+			return
+		}
+
+		body := buf.body.Bytes()
+		etag := etagOf(body)
+		w.Header().Set("ETag", etag)
+		w.Header().Add("Vary", "Authorization, Cookie")
+		if w.Header().Get("Cache-Control") == "" {
+			w.Header().Set("Cache-Control", "private, no-cache")
+		}
+
+		if matchesETag(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write(body)
+	})
+}
+
+// etagOf returns a strong ETag for a response body
+func etagOf(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// write sends a page, or 304 Not Modified if the client already has it.
+// Browsers must revalidate either way so writes show up immediately.
+func write(w http.ResponseWriter, r *http.Request, contentType, etag string, public bool, body []byte) {
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Add("Vary", "Cookie, Accept-Language, HX-Request, HX-Boosted")
+	if public {
+		w.Header().Set("Cache-Control", "public, no-cache")
+	} else {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	}
+
+	if matchesETag(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Write(body)
+}
+
+func matchesETag(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheKey varies on the full URL, HTMX request headers (partial vs full
+// page renders), the browser's languages and the cookies pages like
+// announcements depend on
+func cacheKey(r *http.Request, varyCookies []string) string {
+	key := r.Host + r.URL.RequestURI() + "\x00" +
+		r.Header.Get("HX-Request") + r.Header.Get("HX-Boosted") + "\x00" +
+		r.Header.Get("Accept-Language")
+	for _, name := range varyCookies {
+		key += "\x00"
+		if cookie, err := r.Cookie(name); err == nil {
+			key += cookie.Value
+		}
+	}
+	return key
+}
+
+func lookup(key string) *entry {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	e := cache.entries[key]
+	if e == nil || time.Now().After(e.expires) {
+		return nil
+	}
+	return e
+}
+
+func store(key string, e *entry) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if len(cache.entries) >= maxEntries {
+		now := time.Now()
+		for k, old := range cache.entries {
+			if now.After(old.expires) {
+				delete(cache.entries, k)
+			}
+		}
+		if len(cache.entries) >= maxEntries {
+			return
+		}
+	}
+	cache.entries[key] = e
+}
+
+// buffer captures a response so it can be hashed and cached before sending
+type buffer struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (b *buffer) Header() http.Header { return b.header }
+
+func (b *buffer) WriteHeader(status int) {
+	if !b.wroteHeader {
+		b.status = status
+		b.wroteHeader = true
+	}
+}
+
+func (b *buffer) Write(p []byte) (int, error) {
+	b.wroteHeader = true
+	return b.body.Write(p)
+}
@@ -1,6 +1,7 @@
 package payments
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,6 +10,9 @@ import (
 	"os"
 	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"www.theskyscape.com/internal/tracing"
 )
 
 // Client is a Stripe API client
@@ -18,6 +22,7 @@ type Client struct {
 	webhookSecret string
 	baseURL       string
 	httpClient    *http.Client
+	ctx           context.Context
 }
 
 // New creates a new Stripe client from environment variables
@@ -33,6 +38,14 @@ func New() *Client {
 	}
 }
 
+// WithContext returns a copy of the client whose API requests are made
+// with ctx, so they are cancelled with it and traced under its span
+func (c *Client) WithContext(ctx context.Context) *Client {
+	clone := *c
+	clone.ctx = ctx
+	return &clone
+}
+
 // PublishableKey returns the publishable key for client-side use
 func (c *Client) PublishableKey() string {
 	return c.publishKey
@@ -44,7 +57,22 @@ func (c *Client) IsConfigured() bool {
 }
 
 // request makes an authenticated request to the Stripe API
-func (c *Client) request(method, endpoint string, params url.Values) ([]byte, error) {
+func (c *Client) request(method, endpoint string, params url.Values) (_ []byte, err error) {
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// Name spans by resource (e.g. "stripe GET /subscriptions") rather than
+	// the full path so IDs don't make every span name unique
+	resource, _, _ := strings.Cut(strings.TrimPrefix(endpoint, "/"), "/")
+	resource, _, _ = strings.Cut(resource, "?")
+	ctx, span := tracing.Start(ctx, "stripe "+method+" /"+resource,
+		attribute.String("http.request.method", method),
+		attribute.String("stripe.endpoint", endpoint),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	reqURL := c.baseURL + endpoint
 
 	var body io.Reader
@@ -52,7 +80,7 @@ func (c *Client) request(method, endpoint string, params url.Values) ([]byte, er
 		body = strings.NewReader(params.Encode())
 	}
 
-	req, err := http.NewRequest(method, reqURL, body)
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, body)
 	if err != nil {
 		return nil, err
 	}
@@ -65,6 +93,7 @@ func (c *Client) request(method, endpoint string, params url.Values) ([]byte, er
 		return nil, err
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -3,7 +3,7 @@ package payments
 import (
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/url"
 	"sync"
 )
@@ -78,7 +78,7 @@ func (c *Client) GetCatalog() (*ProductCatalog, error) {
 // Call this on application startup
 func (c *Client) InitProducts() error {
 	if !c.IsConfigured() {
-		log.Println("Stripe not configured, skipping product initialization")
+		slog.Info("Stripe not configured, skipping product initialization")
 		return nil
 	}
 
@@ -89,7 +89,7 @@ func (c *Client) InitProducts() error {
 		return nil
 	}
 
-	log.Println("Initializing Stripe products...")
+	slog.Info("initializing Stripe products")
 
 	// 1. Verified Subscription - $8/month
 	verifiedProduct, err := c.ensureProduct("skyscape_verified", "Verified Badge", "Verified badge, 2x replicas, priority support")
@@ -103,7 +103,7 @@ func (c *Client) InitProducts() error {
 		return err
 	}
 	catalog.VerifiedPriceID = verifiedPrice.ID
-	log.Printf("  Verified: product=%s price=%s", verifiedProduct.ID, verifiedPrice.ID)
+	slog.Info("Stripe product ready", "product", "verified", "product_id", verifiedProduct.ID, "price_id", verifiedPrice.ID)
 
 	// 2. App Promotion - $1/day one-time payment
 	promotionProduct, err := c.ensureProduct("skyscape_promotion", "App Promotion", "Promote your app in the activity feed")
@@ -117,7 +117,7 @@ func (c *Client) InitProducts() error {
 		return err
 	}
 	catalog.PromotionPriceID = promotionPrice.ID
-	log.Printf("  Promotion: product=%s price=%s", promotionProduct.ID, promotionPrice.ID)
+	slog.Info("Stripe product ready", "product", "promotion", "product_id", promotionProduct.ID, "price_id", promotionPrice.ID)
 
 	// 3. CPU Upgrade - $2.50/half-core/month (so $5/core/month)
 	cpuProduct, err := c.ensureProduct("skyscape_cpu", "CPU Cores", "Additional CPU for your app")
@@ -131,7 +131,7 @@ func (c *Client) InitProducts() error {
 		return err
 	}
 	catalog.CPUPriceID = cpuPrice.ID
-	log.Printf("  CPU: product=%s price=%s", cpuProduct.ID, cpuPrice.ID)
+	slog.Info("Stripe product ready", "product", "cpu", "product_id", cpuProduct.ID, "price_id", cpuPrice.ID)
 
 	// 4. Storage Upgrade - $0.25/GB/month
 	storageProduct, err := c.ensureProduct("skyscape_storage", "Storage", "Additional storage for your app")
@@ -145,10 +145,10 @@ func (c *Client) InitProducts() error {
 		return err
 	}
 	catalog.StoragePriceID = storagePrice.ID
-	log.Printf("  Storage: product=%s price=%s", storageProduct.ID, storagePrice.ID)
+	slog.Info("Stripe product ready", "product", "storage", "product_id", storageProduct.ID, "price_id", storagePrice.ID)
 
 	catalog.initialized = true
-	log.Println("Stripe products initialized")
+	slog.Info("Stripe products initialized")
 	return nil
 }
 
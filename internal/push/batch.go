@@ -0,0 +1,133 @@
+package push
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"www.theskyscape.com/models"
+)
+
+// Run sends queued pushes on an interval. Each user gets at most one push
+// per their batching interval; whatever queued up in between is coalesced
+// into it, e.g. "3 new comments and 2 new followers".
+func Run(interval time.Duration) {
+	for range time.Tick(interval) {
+		Flush()
+	}
+}
+
+// Flush sends the queued pushes of every user whose batching interval has
+// passed since their last push
+func Flush() {
+	queued, err := models.QueuedPushes.Search("ORDER BY CreatedAt ASC")
+	if err != nil {
+		slog.Error("failed to load queued pushes", "error", err)
+		return
+	}
+
+	var users []string
+	byUser := map[string][]*models.QueuedPush{}
+	for _, item := range queued {
+		if byUser[item.UserID] == nil {
+			users = append(users, item.UserID)
+		}
+		byUser[item.UserID] = append(byUser[item.UserID], item)
+	}
+
+	for _, userID := range users {
+		items := byUser[userID]
+		lastLog, _ := models.PushNotificationLogs.First("WHERE UserID = ? AND SourceID = ''", userID)
+		interval := models.NotificationSettingsFor(userID).Interval()
+		if lastLog != nil && time.Since(lastLog.LastSentAt) < interval {
+			continue
+		}
+
+		title, body, url := Summarize(items)
+		slog.Info("sending push notification", "user_id", userID, "batched", len(items))
+		if err := deliver(userID, title, body, url); err != nil {
+			continue
+		}
+
+		for _, item := range items {
+			models.QueuedPushes.Delete(item)
+		}
+
+		if lastLog != nil {
+			lastLog.LastSentAt = time.Now()
+			models.PushNotificationLogs.Update(lastLog)
+		} else {
+			models.PushNotificationLogs.Insert(&models.PushNotificationLog{
+				UserID:     userID,
+				LastSentAt: time.Now(),
+			})
+		}
+	}
+}
+
+// Summarize coalesces queued pushes, oldest first, into one notification.
+// A single push is sent as is; several from the same source and kind keep
+// the latest title and link; anything else is counted per kind.
+func Summarize(items []*models.QueuedPush) (title, body, url string) {
+	latest := items[len(items)-1]
+	if len(items) == 1 {
+		return latest.Title, latest.Body, latest.URL
+	}
+
+	counts := map[string]int{}
+	sameSource, sameURL := true, true
+	for _, item := range items {
+		counts[item.Kind]++
+		sameSource = sameSource && item.SourceID == latest.SourceID && item.Kind == latest.Kind
+		sameURL = sameURL && item.URL == latest.URL
+	}
+
+	var parts []string
+	for _, kind := range models.NotificationKinds {
+		if n := counts[kind]; n > 0 {
+			parts = append(parts, describe(kind, n))
+		}
+	}
+	body = joinList(parts)
+
+	switch {
+	case sameSource:
+		return latest.Title, body, latest.URL
+	case sameURL:
+		return "New activity", body, latest.URL
+	case len(counts) == 1 && counts[models.NotifyMessage] > 0:
+		return "New messages", body, "/messages"
+	default:
+		return "New activity", body, "/"
+	}
+}
+
+// describe counts a kind of notification, e.g. "2 new followers"
+func describe(kind string, n int) string {
+	noun := map[string]string{
+		models.NotifyFollow:  "new follower",
+		models.NotifyMention: "mention",
+		models.NotifyComment: "new comment",
+		models.NotifyMessage: "new message",
+		models.NotifyPost:    "new post",
+		models.NotifyStar:    "new star",
+		models.NotifyDeploy:  "finished build",
+		models.NotifyApp:     "app notification",
+	}[kind]
+	if noun == "" {
+		noun = "notification"
+	}
+	if n != 1 {
+		noun += "s"
+	}
+	return fmt.Sprintf("%d %s", n, noun)
+}
+
+// joinList joins phrases as "a, b and c"
+func joinList(parts []string) string {
+	if len(parts) < 2 {
+		return strings.Join(parts, "")
+	}
+	return strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+}
@@ -0,0 +1,78 @@
+package push
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"www.theskyscape.com/models"
+)
+
+// StaleAfter is how long a subscription can go without a delivery or a
+// check-in from its browser before it's considered abandoned
+const StaleAfter = 90 * 24 * time.Hour
+
+// MaxFailures is how many deliveries in a row can fail before a
+// subscription is dropped
+const MaxFailures = 5
+
+// DeviceLabel describes the browser and OS of a user agent, e.g.
+// "Chrome on macOS", for telling a user's devices apart in settings
+func DeviceLabel(userAgent string) string {
+	browser := "Browser"
+	switch {
+	case strings.Contains(userAgent, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(userAgent, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(userAgent, "SamsungBrowser/"):
+		browser = "Samsung Internet"
+	case strings.Contains(userAgent, "Firefox/"), strings.Contains(userAgent, "FxiOS/"):
+		browser = "Firefox"
+	case strings.Contains(userAgent, "Chrome/"), strings.Contains(userAgent, "CriOS/"):
+		browser = "Chrome"
+	case strings.Contains(userAgent, "Safari/"):
+		browser = "Safari"
+	}
+
+	switch {
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"):
+		return browser + " on iOS"
+	case strings.Contains(userAgent, "Android"):
+		return browser + " on Android"
+	case strings.Contains(userAgent, "Mac OS X"):
+		return browser + " on macOS"
+	case strings.Contains(userAgent, "Windows"):
+		return browser + " on Windows"
+	case strings.Contains(userAgent, "CrOS"):
+		return browser + " on ChromeOS"
+	case strings.Contains(userAgent, "Linux"):
+		return browser + " on Linux"
+	}
+	return browser
+}
+
+// PruneDevices periodically removes subscriptions that expired, keep
+// failing, or haven't been used or checked in for StaleAfter, rather than
+// waiting for a push service to answer 410
+func PruneDevices(interval time.Duration) {
+	for range time.Tick(interval) {
+		now := time.Now()
+		subs, err := models.PushSubscriptions.Search(`
+			WHERE Failures >= ?
+			   OR (ExpiresAt > ? AND ExpiresAt < ?)
+			   OR (LastUsedAt < ? AND CreatedAt < ?)
+		`, MaxFailures, time.Time{}, now, now.Add(-StaleAfter), now.Add(-StaleAfter))
+		if err != nil {
+			slog.Error("failed to load stale push subscriptions", "error", err)
+			continue
+		}
+
+		for _, sub := range subs {
+			models.PushSubscriptions.Delete(sub)
+		}
+		if len(subs) > 0 {
+			slog.Info("pruned push subscriptions", "count", len(subs))
+		}
+	}
+}
@@ -3,10 +3,12 @@ package push
 import (
 	"encoding/json"
 	"io"
-	"log"
+	"log/slog"
 	"time"
 
 	webpush "github.com/SherClockHolmes/webpush-go"
+	"www.theskyscape.com/internal/chathooks"
+	"www.theskyscape.com/internal/events"
 	"www.theskyscape.com/models"
 )
 
@@ -34,55 +36,63 @@ type SendResult struct {
 	ErrorBody    string // response body on error
 }
 
-// SendNotification sends a push notification to a user (rate limited per source)
-func SendNotification(userID, sourceID, title, body, url string) error {
-	log.Printf("[Push] Notification requested for user %s from source %s: %s", userID, sourceID, title)
+// SendNotification fans a notification out to the user's open tabs and
+// chat hooks right away, and queues it for their push subscriptions (unless
+// the user turned pushes of this kind off). Queued pushes are batched by
+// Run. kind is one of the models.Notify* kinds.
+func SendNotification(userID, sourceID, kind, title, body, url string) error {
+	slog.Debug("push notification requested", "user_id", userID, "source_id", sourceID, "kind", kind)
+
+	// Open tabs show the notification in-app right away, without batching
+	events.Publish(userID, events.Notification, map[string]string{
+		"title": title,
+		"body":  body,
+		"url":   url,
+	})
+
+	// Chat hooks are opted into per kind, so they aren't batched either
+	chathooks.Relay(userID, kind, title, body, url)
 
 	if !KeysConfigured() {
-		log.Println("[Push] VAPID keys not configured, skipping push")
+		slog.Debug("VAPID keys not configured, skipping push")
 		return nil
 	}
 
-	// Get all subscriptions for this user
-	subscriptions, err := models.PushSubscriptions.Search("WHERE UserID = ?", userID)
-	if err != nil {
-		log.Printf("[Push] Error fetching subscriptions: %v", err)
-		return err
-	}
-	if len(subscriptions) == 0 {
-		log.Printf("[Push] No subscriptions found for user %s", userID)
+	if !models.WantsPush(userID, kind) {
+		slog.Debug("push disabled by notification settings", "user_id", userID, "kind", kind)
 		return nil
 	}
-	log.Printf("[Push] Found %d subscription(s) for user %s", len(subscriptions), userID)
-
-	// Check rate limiting
-	lastLog, _ := models.PushNotificationLogs.First("WHERE UserID = ? AND SourceID = ?", userID, sourceID)
-
-	var lastSent *time.Time
-	if lastLog != nil {
-		lastSent = &lastLog.LastSentAt
-	}
 
-	if !ShouldSend(lastSent) {
-		log.Printf("[Push] Rate limited for source %s - last notification sent at %s",
-			sourceID, lastLog.LastSentAt.Format(time.RFC3339))
+	if models.PushSubscriptions.Count("WHERE UserID = ?", userID) == 0 {
+		slog.Debug("no push subscriptions", "user_id", userID)
 		return nil
 	}
 
-	// Count messages since last notification for aggregation
-	sinceTime := GetSinceTime(lastSent)
-	messageCount := models.Messages.Count("WHERE RecipientID = ? AND SenderID = ? AND CreatedAt > ?",
-		userID, sourceID, sinceTime)
-
-	// Aggregate message if multiple
-	notificationTitle, notificationBody, notificationURL := AggregateMessage(
-		messageCount, title, body, url)
+	_, err := models.QueuedPushes.Insert(&models.QueuedPush{
+		UserID:   userID,
+		SourceID: sourceID,
+		Kind:     kind,
+		Title:    title,
+		Body:     body,
+		URL:      url,
+	})
+	if err != nil {
+		slog.Error("failed to queue push notification", "user_id", userID, "error", err)
+	}
+	return err
+}
 
-	log.Printf("[Push] Sending notification to user %s (%d messages since %s)",
-		userID, messageCount, sinceTime.Format(time.RFC3339))
+// deliver pushes a notification to all of a user's subscriptions
+func deliver(userID, title, body, url string) error {
+	subscriptions, err := models.PushSubscriptions.Search("WHERE UserID = ?", userID)
+	if err != nil {
+		slog.Error("failed to fetch push subscriptions", "user_id", userID, "error", err)
+		return err
+	}
+	slog.Debug("found push subscriptions", "user_id", userID, "count", len(subscriptions))
 
 	// Build payload
-	payload := BuildPayload(notificationTitle, notificationBody, notificationURL)
+	payload := BuildPayload(title, body, url)
 
 	// Send to all subscriptions
 	for _, sub := range subscriptions {
@@ -95,34 +105,27 @@ func SendNotification(userID, sourceID, title, body, url string) error {
 		endpoint := TruncateEndpoint(sub.Endpoint)
 
 		if result.Error != nil {
-			log.Printf("[Push] Failed to send to %s: %v", endpoint, result.Error)
+			slog.Warn("push send failed", "endpoint", endpoint, "error", result.Error)
+			sub.Failures++
+			models.PushSubscriptions.Update(sub)
 			continue
 		}
 
 		if result.ShouldRemove {
-			log.Printf("[Push] Removing invalid subscription: %d", result.StatusCode)
+			slog.Info("removing invalid push subscription", "status", result.StatusCode)
 			models.PushSubscriptions.Delete(sub)
 		} else if result.StatusCode >= 200 && result.StatusCode < 300 {
-			log.Printf("[Push] Successfully sent to %s (status: %d)", endpoint, result.StatusCode)
+			slog.Debug("push sent", "endpoint", endpoint, "status", result.StatusCode)
+			sub.LastUsedAt = time.Now()
+			sub.Failures = 0
+			models.PushSubscriptions.Update(sub)
 		} else {
-			log.Printf("[Push] Unexpected status %d for %s: %s",
-				result.StatusCode, endpoint, result.ErrorBody)
+			slog.Warn("unexpected push status", "endpoint", endpoint, "status", result.StatusCode, "body", result.ErrorBody)
+			sub.Failures++
+			models.PushSubscriptions.Update(sub)
 		}
 	}
 
-	// Update the notification log
-	now := time.Now()
-	if lastLog != nil {
-		lastLog.LastSentAt = now
-		models.PushNotificationLogs.Update(lastLog)
-	} else {
-		models.PushNotificationLogs.Insert(&models.PushNotificationLog{
-			UserID:     userID,
-			SourceID:   sourceID,
-			LastSentAt: now,
-		})
-	}
-
 	return nil
 }
 
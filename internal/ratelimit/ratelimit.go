@@ -0,0 +1,128 @@
+// Package ratelimit limits how often a route can be called, counted per
+// IP, user or token, on top of the rate_limits table the sign-in checks use
+package ratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"www.theskyscape.com/internal/clientip"
+	"www.theskyscape.com/internal/security"
+	"www.theskyscape.com/models"
+)
+
+// ErrLimited is shown to callers over a limit
+var ErrLimited = errors.New("Too many requests. Please try again later.")
+
+// Key returns who a request is counted against
+type Key func(r *http.Request) string
+
+// Limit allows Max requests per Window for each key. Routes sharing an
+// Action share a count.
+type Limit struct {
+	Action      string
+	Max         int
+	VerifiedMax int // Max for verified users, when higher
+	Window      time.Duration
+	Key         Key // ByIP when nil
+}
+
+// ByIP counts requests by the client's IP
+func ByIP(r *http.Request) string {
+	return "ip:" + clientip.From(r)
+}
+
+// ByToken counts requests by the token they carry, so each app a user
+// authorized, and each deploy or service token, has its own count. The
+// token is checked first: requests without a valid one are counted by IP.
+func ByToken(r *http.Request) string {
+	if key, ok := security.TokenKey(r); ok {
+		return "token:" + key
+	}
+	return ByIP(r)
+}
+
+// Status is where a request left its key's count
+type Status struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// Take counts a request and reports where that leaves its key. If the
+// count can't be read the request is allowed, so a database hiccup
+// doesn't take every limited route down with it.
+func (l Limit) Take(r *http.Request) Status {
+	key := l.Key
+	if key == nil {
+		key = ByIP
+	}
+	id := key(r)
+
+	limit := l.Max
+	if l.VerifiedMax > limit && isVerified(r) {
+		limit = l.VerifiedMax
+	}
+
+	allowed, remaining, reset, err := models.Take(id, l.Action, limit, l.Window)
+	if err != nil {
+		slog.Error("failed to take rate limit", "action", l.Action, "error", err)
+		return Status{Allowed: true, Limit: limit, Remaining: limit, Reset: time.Now().Add(l.Window)}
+	}
+	return Status{Allowed: allowed, Limit: limit, Remaining: remaining, Reset: reset}
+}
+
+// Allow counts a request and reports whether it's within the limit
+func (l Limit) Allow(r *http.Request) bool {
+	return l.Take(r).Allowed
+}
+
+// isVerified reports whether an API request was made for a verified user
+func isVerified(r *http.Request) bool {
+	user := security.UserFromContext(r)
+	if user == nil {
+		return false
+	}
+	profile, err := models.Profiles.Get(user.ID)
+	return err == nil && profile.Verified
+}
+
+// SetHeaders reports the status in the X-RateLimit headers, adding
+// Retry-After once the limit is reached
+func (s Status) SetHeaders(w http.ResponseWriter) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(s.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(s.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(s.Reset.Unix(), 10))
+	if !s.Allowed {
+		retry := int(time.Until(s.Reset).Seconds()) + 1
+		w.Header().Set("Retry-After", strconv.Itoa(max(retry, 1)))
+	}
+}
+
+// Wrap limits a handler, answering requests over the limit with a JSON
+// error, for API and OAuth endpoints. Every response carries the
+// X-RateLimit headers.
+func (l Limit) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := l.Take(r)
+		status.SetHeaders(w)
+		if !status.Allowed {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]string{"error": "too many requests, try again later"})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// WrapFunc is Wrap for a handler function, so limits can sit inside
+// ProtectFunc and count by the user it authenticated
+func (l Limit) WrapFunc(h http.HandlerFunc) http.HandlerFunc {
+	return l.Wrap(h).ServeHTTP
+}
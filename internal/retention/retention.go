@@ -0,0 +1,140 @@
+// Package retention permanently removes data once it has been kept as
+// long as it needs to be
+package retention
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"www.theskyscape.com/models"
+)
+
+// Policy is how long rows of a table are kept, measured by one of its
+// timestamp columns. Keep can be overridden with RETENTION_<TABLE>_DAYS,
+// e.g. RETENTION_THOUGHT_VIEWS_DAYS=30; 0 keeps the table forever.
+type Policy struct {
+	Table  string
+	Column string
+	Keep   time.Duration
+}
+
+// Policies are the tables that would otherwise grow forever
+var Policies = []Policy{
+	// Views dedupe readers, so a reader returning after this counts again.
+	// Anonymous readers are only kept as a hash, see Thought.RecordView.
+	{Table: "thought_views", Column: "CreatedAt", Keep: 90 * 24 * time.Hour},
+	// Expired windows are never read again
+	{Table: "rate_limits", Column: "ResetAt", Keep: 24 * time.Hour},
+	// Only the last send time matters, and batching never looks back a day
+	{Table: "push_notification_logs", Column: "LastSentAt", Keep: 30 * 24 * time.Hour},
+	// Queued pushes are sent within hours; anything older is stuck
+	{Table: "queued_pushes", Column: "CreatedAt", Keep: 7 * 24 * time.Hour},
+	// The admin dashboard only reports recent delivery
+	{Table: "email_logs", Column: "CreatedAt", Keep: 90 * 24 * time.Hour},
+	// Devices stop being recognized after KnownDeviceExpiry anyway
+	{Table: "known_devices", Column: "LastSeenAt", Keep: models.KnownDeviceExpiry},
+	// The delivery log is for debugging recent deliveries, and retries end within a day
+	{Table: "webhook_deliveries", Column: "CreatedAt", Keep: 30 * 24 * time.Hour},
+}
+
+// Retention returns how long the policy keeps rows, honoring its
+// environment override
+func (p Policy) Retention() time.Duration {
+	env := "RETENTION_" + strings.ToUpper(p.Table) + "_DAYS"
+	if days, err := strconv.Atoi(os.Getenv(env)); err == nil && days >= 0 {
+		return time.Duration(days) * 24 * time.Hour
+	}
+	return p.Keep
+}
+
+// Result is what pruning a table has done since the server started
+type Result struct {
+	Policy
+	Keep     time.Duration // Retention in effect, see Policy.Retention
+	LastRun  time.Time
+	Deleted  int // Rows deleted on the last run
+	Total    int // Rows deleted since the server started
+	Error    string
+	Disabled bool
+}
+
+// Days returns the retention in effect in days
+func (r Result) Days() int {
+	return int(r.Keep.Hours() / 24)
+}
+
+var results = struct {
+	sync.Mutex
+	byTable map[string]*Result
+}{byTable: map[string]*Result{}}
+
+// Stats returns the pruning results of every policy, in policy order
+func Stats() []Result {
+	results.Lock()
+	defer results.Unlock()
+	stats := make([]Result, 0, len(Policies))
+	for _, p := range Policies {
+		if r, ok := results.byTable[p.Table]; ok {
+			stats = append(stats, *r)
+		} else {
+			keep := p.Retention()
+			stats = append(stats, Result{Policy: p, Keep: keep, Disabled: keep == 0})
+		}
+	}
+	return stats
+}
+
+// Run purges expired data on an interval
+func Run(interval time.Duration) {
+	for range time.Tick(interval) {
+		Purge()
+		Prune()
+	}
+}
+
+// Purge removes posts and comments whose tombstones have outlived
+// models.DeletedRetention
+func Purge() {
+	posts, comments, err := models.PurgeDeleted()
+	if err != nil {
+		slog.Error("failed to purge deleted content", "error", err)
+		return
+	}
+	if posts > 0 || comments > 0 {
+		slog.Info("purged deleted content", "posts", posts, "comments", comments)
+	}
+}
+
+// Prune deletes the rows each policy no longer keeps
+func Prune() {
+	if err := models.AnonymizeViews(); err != nil {
+		slog.Error("failed to anonymize thought views", "error", err)
+	}
+
+	for _, p := range Policies {
+		keep := p.Retention()
+		result := Result{Policy: p, Keep: keep, LastRun: time.Now(), Disabled: keep == 0}
+		if !result.Disabled {
+			deleted, err := models.PruneBefore(p.Table, p.Column, time.Now().Add(-keep))
+			result.Deleted = deleted
+			if err != nil {
+				result.Error = err.Error()
+				slog.Error("failed to prune table", "table", p.Table, "error", err)
+			} else if deleted > 0 {
+				slog.Info("pruned table", "table", p.Table, "rows", deleted, "keep", keep)
+			}
+		}
+
+		results.Lock()
+		if prev, ok := results.byTable[p.Table]; ok {
+			result.Total = prev.Total
+		}
+		result.Total += result.Deleted
+		results.byTable[p.Table] = &result
+		results.Unlock()
+	}
+}
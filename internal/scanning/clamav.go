@@ -0,0 +1,78 @@
+package scanning
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// clamdChunkSize is the maximum chunk sent per INSTREAM frame
+const clamdChunkSize = 64 * 1024
+
+// ClamAV scans content by streaming it to a clamd daemon over TCP
+type ClamAV struct {
+	Addr    string // host:port of clamd
+	Timeout time.Duration
+}
+
+func (c *ClamAV) Name() string { return "clamav" }
+
+// Scan sends content using the clamd INSTREAM protocol and parses the reply
+func (c *ClamAV) Scan(content []byte) (*Verdict, error) {
+	conn, err := net.DialTimeout("tcp", c.Addr, c.Timeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to clamd")
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(c.Timeout))
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return nil, errors.Wrap(err, "failed to start stream")
+	}
+
+	size := make([]byte, 4)
+	for start := 0; start < len(content); start += clamdChunkSize {
+		chunk := content[start:min(start+clamdChunkSize, len(content))]
+		binary.BigEndian.PutUint32(size, uint32(len(chunk)))
+		if _, err := conn.Write(size); err != nil {
+			return nil, errors.Wrap(err, "failed to write chunk size")
+		}
+		if _, err := conn.Write(chunk); err != nil {
+			return nil, errors.Wrap(err, "failed to write chunk")
+		}
+	}
+
+	// Zero-length chunk terminates the stream
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := conn.Write(size); err != nil {
+		return nil, errors.Wrap(err, "failed to end stream")
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return nil, errors.Wrap(err, "failed to read clamd reply")
+	}
+
+	return parseClamdReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// parseClamdReply interprets replies like "stream: OK" or
+// "stream: Eicar-Signature FOUND"
+func parseClamdReply(reply string) (*Verdict, error) {
+	result := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case result == "OK":
+		return &Verdict{}, nil
+	case strings.HasSuffix(result, "FOUND"):
+		return &Verdict{
+			Infected:  true,
+			Signature: strings.TrimSpace(strings.TrimSuffix(result, "FOUND")),
+		}, nil
+	default:
+		return nil, errors.New("clamd error: " + result)
+	}
+}
@@ -0,0 +1,137 @@
+package scanning
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/emailing"
+	"www.theskyscape.com/internal/i18n"
+	"www.theskyscape.com/models"
+)
+
+// Verdict is the outcome of scanning a single upload
+type Verdict struct {
+	Infected  bool
+	Signature string // Name of the detected threat, if any
+}
+
+// Scanner inspects file content for malware. Implementations must be safe
+// for concurrent use.
+type Scanner interface {
+	Name() string
+	Scan(content []byte) (*Verdict, error)
+}
+
+// noopScanner accepts everything; used when no scanner is configured
+type noopScanner struct{}
+
+func (noopScanner) Name() string                  { return "none" }
+func (noopScanner) Scan([]byte) (*Verdict, error) { return &Verdict{}, nil }
+
+// Default is the scanner used for uploads. It talks to clamd when
+// CLAMAV_ADDR is set and otherwise marks uploads clean without scanning.
+var Default Scanner = newDefaultScanner()
+
+func newDefaultScanner() Scanner {
+	if addr := os.Getenv("CLAMAV_ADDR"); addr != "" {
+		return &ClamAV{Addr: addr, Timeout: 30 * time.Second}
+	}
+	return noopScanner{}
+}
+
+// ErrQuarantined is returned when an upload is flagged by the scanner
+var ErrQuarantined = errors.New("file was rejected by the malware scanner")
+
+// Store inserts an upload as pending and scans it before it can be served.
+// If the scanner is unreachable the file stays pending and is retried by
+// RescanPending.
+func Store(file *models.File) (*models.File, error) {
+	file.ScanStatus = models.ScanPending
+	file, err := models.Files.Insert(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = ScanFile(file); err != nil {
+		return file, nil
+	}
+
+	if file.IsQuarantined() {
+		return nil, ErrQuarantined
+	}
+
+	return file, nil
+}
+
+// RescanPending periodically retries files whose scan has not completed
+func RescanPending(interval time.Duration) {
+	for range time.Tick(interval) {
+		files, err := models.Files.Search("WHERE ScanStatus = ? ORDER BY CreatedAt ASC LIMIT 100", models.ScanPending)
+		if err != nil {
+			slog.Error("failed to load pending files", "error", err)
+			continue
+		}
+
+		for _, file := range files {
+			if err := ScanFile(file); err != nil {
+				break // Scanner is still down, try again next tick
+			}
+		}
+	}
+}
+
+// ScanFile runs the file through the default scanner and records the result.
+// Infected files are quarantined and admins are notified in the background.
+// Scanner failures leave the file pending so it is not served unscanned.
+func ScanFile(file *models.File) error {
+	verdict, err := Default.Scan(file.Content)
+	if err != nil {
+		slog.Error("scanner failed", "scanner", Default.Name(), "file_id", file.ID, "error", err)
+		file.ScanStatus = models.ScanPending
+		file.ScanResult = err.Error()
+		models.Files.Update(file)
+		return err
+	}
+
+	file.ScannedAt = time.Now()
+	if !verdict.Infected {
+		file.ScanStatus = models.ScanClean
+		file.ScanResult = ""
+		return models.Files.Update(file)
+	}
+
+	slog.Warn("quarantined file", "file_id", file.ID, "path", file.FilePath, "signature", verdict.Signature)
+	file.ScanStatus = models.ScanQuarantined
+	file.ScanResult = verdict.Signature
+	if err := models.Files.Update(file); err != nil {
+		return err
+	}
+
+	go notifyAdmins(file)
+	return nil
+}
+
+// notifyAdmins emails every admin about a quarantined upload
+func notifyAdmins(file *models.File) {
+	admins, err := models.Auth.Users.Search("WHERE IsAdmin = true")
+	if err != nil {
+		slog.Error("failed to load admins", "error", err)
+		return
+	}
+
+	owner := file.Owner()
+	for _, admin := range admins {
+		models.SendEmail(admin.Email,
+			"Quarantined upload: "+file.ScanResult,
+			"malware-detected.html",
+			emailing.WithData("t", i18n.For(models.EmailLocale(admin.ID))),
+			emailing.WithData("Title", "Upload Quarantined"),
+			emailing.WithData("admin", admin),
+			emailing.WithData("file", file),
+			emailing.WithData("owner", owner),
+			emailing.WithData("year", time.Now().Year()),
+		)
+	}
+}
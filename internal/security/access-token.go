@@ -8,18 +8,42 @@ import (
 	"os"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/The-Skyscape/devtools/pkg/application"
 	"github.com/The-Skyscape/devtools/pkg/authentication"
 	"github.com/golang-jwt/jwt/v5"
+	"www.theskyscape.com/internal/logging"
+	"www.theskyscape.com/internal/oauth"
 	"www.theskyscape.com/models"
 )
 
+// checkLegacyToken rejects an HS256 token unless it was issued before the
+// first signing key was created and that was less than AccessTokenExpiry
+// ago. Once none is left, remove the HS256 branch of parseAccessToken.
+func checkLegacyToken(token *jwt.Token) error {
+	switched, err := oauth.KeysIntroducedAt()
+	if err != nil {
+		return errors.New("server configuration error")
+	}
+	if switched.IsZero() {
+		return nil // Nothing has been signed with a key yet
+	}
+	if time.Since(switched) > oauth.AccessTokenExpiry {
+		return errors.New("legacy tokens are no longer accepted")
+	}
+	if iat, err := token.Claims.GetIssuedAt(); err != nil || iat == nil || !iat.Before(switched) {
+		return errors.New("legacy token issued after the switch")
+	}
+	return nil
+}
+
 type contextKey string
 
 const (
 	userContextKey   contextKey = "api_user"
 	scopesContextKey contextKey = "api_scopes"
+	clientContextKey contextKey = "api_client"
 )
 
 // UserFromContext retrieves the authenticated user from request context
@@ -39,59 +63,69 @@ func ScopesFromContext(r *http.Request) []string {
 }
 
 func ParseAccessToken(r *http.Request) (*authentication.User, []string, error) {
+	user, scopes, _, err := parseAccessToken(r)
+	return user, scopes, err
+}
+
+// parseAccessToken is ParseAccessToken, also returning the app or project
+// the token was issued to
+func parseAccessToken(r *http.Request) (*authentication.User, []string, string, error) {
 	// Extract Bearer token from Authorization header
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
-		return nil, nil, errors.New("missing authorization header")
+		return nil, nil, "", errors.New("missing authorization header")
 	}
 
 	if !strings.HasPrefix(authHeader, "Bearer ") {
-		return nil, nil, errors.New("invalid authorization header format")
+		return nil, nil, "", errors.New("invalid authorization header format")
 	}
 
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-	// Parse and validate JWT
-	secret := os.Getenv("AUTH_SECRET")
-	if secret == "" {
-		return nil, nil, errors.New("server configuration error")
-	}
-
+	// Parse and validate JWT. Tokens are signed with the published keys;
+	// ones issued before the first key was created are HS256 with
+	// AUTH_SECRET, and are accepted until the last of them expires.
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Verify signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("invalid signing method")
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+			if err := checkLegacyToken(token); err != nil {
+				return nil, err
+			}
+			secret := os.Getenv("AUTH_SECRET")
+			if secret == "" {
+				return nil, errors.New("server configuration error")
+			}
+			return []byte(secret), nil
 		}
-		return []byte(secret), nil
-	})
+		return oauth.VerificationKey(token)
+	}, jwt.WithValidMethods([]string{"HS256", oauth.AlgorithmRS256, oauth.AlgorithmEdDSA}))
 
 	if err != nil {
-		return nil, nil, errors.New("invalid token")
+		return nil, nil, "", errors.New("invalid token")
 	}
 
 	if !token.Valid {
-		return nil, nil, errors.New("token is not valid")
+		return nil, nil, "", errors.New("token is not valid")
 	}
 
 	// Extract claims
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return nil, nil, errors.New("invalid token claims")
+		return nil, nil, "", errors.New("invalid token claims")
 	}
 
 	userID, ok := claims["sub"].(string)
 	if !ok {
-		return nil, nil, errors.New("missing user ID in token")
+		return nil, nil, "", errors.New("missing user ID in token")
 	}
 
 	appID, ok := claims["client_id"].(string)
 	if !ok {
-		return nil, nil, errors.New("missing client ID in token")
+		return nil, nil, "", errors.New("missing client ID in token")
 	}
 
 	scopeStr, ok := claims["scope"].(string)
 	if !ok {
-		return nil, nil, errors.New("missing scopes in token")
+		return nil, nil, "", errors.New("missing scopes in token")
 	}
 
 	scopes := strings.Split(scopeStr, " ")
@@ -104,16 +138,23 @@ func ParseAccessToken(r *http.Request) (*authentication.User, []string, error) {
 	)
 
 	if err != nil || auth == nil {
-		return nil, nil, errors.New("authorization not found")
+		return nil, nil, "", errors.New("authorization not found")
+	}
+
+	// Tokens issued before the user last revoked access stay revoked. The
+	// issue time is in whole seconds, so compare against the second too.
+	if iat, err := claims.GetIssuedAt(); err != nil || iat == nil || iat.Before(auth.RevokedAt.Truncate(time.Second)) {
+		return nil, nil, "", errors.New("authorization revoked")
 	}
+	auth.MarkUsed()
 
 	// Get user
 	user, err := models.Auth.Users.Get(userID)
 	if err != nil {
-		return nil, nil, errors.New("user not found")
+		return nil, nil, "", errors.New("user not found")
 	}
 
-	return user, scopes, nil
+	return user, scopes, appID, nil
 }
 
 func jsonError(w http.ResponseWriter, status int, message string) {
@@ -124,7 +165,7 @@ func jsonError(w http.ResponseWriter, status int, message string) {
 
 func RequireScopes(required ...string) application.AccessCheck {
 	return func(app *application.App, w http.ResponseWriter, r *http.Request) bool {
-		user, scopes, err := ParseAccessToken(r)
+		user, scopes, client, err := parseAccessToken(r)
 		if err != nil {
 			jsonError(w, http.StatusUnauthorized, err.Error())
 			return false
@@ -137,12 +178,36 @@ func RequireScopes(required ...string) application.AccessCheck {
 			}
 		}
 
+		logging.SetUser(r.Context(), user.ID)
+
 		// Store user and scopes in context for handlers
 		ctx := r.Context()
 		ctx = context.WithValue(ctx, userContextKey, user)
 		ctx = context.WithValue(ctx, scopesContextKey, scopes)
+		ctx = context.WithValue(ctx, clientContextKey, client)
 		*r = *r.WithContext(ctx)
 
 		return true
 	}
 }
+
+// TokenKey names the valid token a request carries, for counting its
+// requests: the user and app or project an access token was issued to, or
+// the deploy or service token. It's false without a valid token, so made
+// up tokens don't each get a count of their own.
+func TokenKey(r *http.Request) (string, bool) {
+	if user := UserFromContext(r); user != nil {
+		client, _ := r.Context().Value(clientContextKey).(string)
+		return "oauth:" + user.ID + ":" + client, true
+	}
+	if token, err := ParseDeployToken(r); err == nil {
+		return "deploy:" + token.ID, true
+	}
+	if project, err := ParseServiceToken(r); err == nil {
+		return "service:" + project.ID, true
+	}
+	if user, _, client, err := parseAccessToken(r); err == nil {
+		return "oauth:" + user.ID + ":" + client, true
+	}
+	return "", false
+}
@@ -0,0 +1,24 @@
+package security
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"www.theskyscape.com/models"
+)
+
+// ParseDeployToken returns the deploy token in the request's Bearer
+// Authorization header
+func ParseDeployToken(r *http.Request) (*models.DeployToken, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, errors.New("missing authorization header")
+	}
+
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return nil, errors.New("invalid authorization header format")
+	}
+
+	return models.FindDeployToken(strings.TrimPrefix(authHeader, "Bearer "))
+}
@@ -5,33 +5,80 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"strings"
 
 	"github.com/The-Skyscape/devtools/pkg/application"
+	"www.theskyscape.com/internal/analytics"
+	"www.theskyscape.com/internal/hosts"
+	"www.theskyscape.com/internal/traffic"
+	"www.theskyscape.com/internal/waf"
+	"www.theskyscape.com/models"
 )
 
-// CheckReverseProxy redirects apex domain to www and forwards app subdomains.
-// Returns true if the request was handled (redirected or forwarded).
+// CheckReverseProxy routes requests by host: aliases are redirected to
+// the web host, and app and project hosts are forwarded to their
+// containers. Returns true if the request was handled.
 func CheckReverseProxy(app *application.App, w http.ResponseWriter, r *http.Request) bool {
-	// Redirect apex domain to www to avoid cookie issues
-	if r.Host == "theskyscape.com" {
-		target := "https://www.theskyscape.com" + r.URL.RequestURI()
+	route := hosts.Default.Resolve(r.Host)
+	switch route.Kind {
+	case hosts.Redirect:
+		target := "https://" + route.Target + r.URL.RequestURI()
 		http.Redirect(w, r, target, http.StatusMovedPermanently)
 		return true
-	}
 
-	// Forward app subdomains to their containers
-	if strings.HasSuffix(r.Host, "skysca.pe") {
-		if parts := strings.Split(r.Host, "."); len(parts) == 3 {
-			forward(parts[0], w, r)
+	case hosts.Unknown:
+		siteNotFound(app, w, r)
+		return true
+
+	case hosts.Site:
+		exists, available := siteStatus(route.SiteID)
+		if !exists {
+			siteNotFound(app, w, r)
+			return true
+		}
+		if !available {
+			http.Error(w, "This app is currently unavailable", http.StatusServiceUnavailable)
 			return true
 		}
+		if route.Custom && hosts.ForceHTTPS(route.Host) {
+			if r.Header.Get("X-Forwarded-Proto") == "http" {
+				http.Redirect(w, r, "https://"+route.Host+r.URL.RequestURI(), http.StatusMovedPermanently)
+				return true
+			}
+			w.Header().Set("Strict-Transport-Security", "max-age=31536000")
+		}
+		forward(route.SiteID, w, r)
+		return true
 	}
 
 	return false
 }
 
-// forward forwards requests to a specific container
+// siteStatus reports whether an app or project exists, and whether it's
+// available or was taken offline by an admin, either through a takedown
+// or its owner's suspension
+func siteStatus(id string) (exists, available bool) {
+	if project, err := models.Projects.Get(id); err == nil {
+		return true, project.Status != "suspended" && project.Status != "removed"
+	}
+	if app, err := models.Apps.Get(id); err == nil {
+		return true, app.Status != "suspended" && app.Status != "removed"
+	}
+	return false, false
+}
+
+// siteNotFound answers hosts nothing is served on with a 404 page
+func siteNotFound(app *application.App, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	w.WriteHeader(http.StatusNotFound)
+	app.Render(w, r, "site-not-found.html", map[string]any{
+		"Host":    hosts.Normalize(r.Host),
+		"WebHost": hosts.Default.WebHost,
+	})
+}
+
+// forward forwards requests to a specific container, metering them for
+// the owner's traffic stats and screening them with the owner's proxy rules
 func forward(name string, w http.ResponseWriter, r *http.Request) {
 	resource := fmt.Sprintf("http://%s:5000", name)
 	url, err := url.Parse(resource)
@@ -41,5 +88,24 @@ func forward(name string, w http.ResponseWriter, r *http.Request) {
 	}
 
 	proxy := httputil.NewSingleHostReverseProxy(url)
-	proxy.ServeHTTP(w, r)
+	if analytics.Enabled(name) {
+		proxy.ModifyResponse = func(resp *http.Response) error {
+			if analytics.IsPageView(r, resp) {
+				analytics.Record(name, r)
+			}
+			return nil
+		}
+	}
+
+	meter := traffic.NewMeter(w, r)
+	defer meter.Done(name)
+
+	r, done, ok := waf.Guard(name, meter, r)
+	if !ok {
+		return
+	}
+	defer done()
+
+	proxy.ErrorHandler = waf.ErrorHandler
+	proxy.ServeHTTP(meter, r)
 }
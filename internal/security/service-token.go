@@ -0,0 +1,24 @@
+package security
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"www.theskyscape.com/models"
+)
+
+// ParseServiceToken returns the project whose service token is in the
+// request's Bearer Authorization header
+func ParseServiceToken(r *http.Request) (*models.Project, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, errors.New("missing authorization header")
+	}
+
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return nil, errors.New("invalid authorization header format")
+	}
+
+	return models.FindServiceToken(strings.TrimPrefix(authHeader, "Bearer "))
+}
@@ -0,0 +1,134 @@
+// Package sitemap builds the XML sitemaps search engines crawl. Listing
+// every public page is too slow to do per request, so the sitemaps are
+// generated in the background on a schedule and served from memory.
+//
+// /sitemap.xml is a sitemap index pointing at /sitemaps/1.xml,
+// /sitemaps/2.xml, ... each holding at most PageSize URLs.
+package sitemap
+
+import (
+	"encoding/xml"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"www.theskyscape.com/models"
+)
+
+// PageSize is the number of URLs per sitemap, well under the protocol's
+// limit of 50,000 URLs and 50MB
+const PageSize = 10000
+
+// BaseURL is prepended to every path, since sitemaps need absolute URLs
+const BaseURL = "https://www.theskyscape.com"
+
+// staticPages are listed first in every sitemap build
+var staticPages = []string{"/", "/explore", "/users", "/repos", "/projects", "/apps", "/thoughts", "/manifesto", "/status"}
+
+type urlset struct {
+	XMLName xml.Name `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []url    `xml:"url"`
+}
+
+type url struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapindex struct {
+	XMLName  xml.Name  `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []sitemap `xml:"sitemap"`
+}
+
+type sitemap struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+var current = struct {
+	mu    sync.RWMutex
+	index []byte
+	pages [][]byte
+}{}
+
+// Refresh regenerates the sitemaps now and then every interval
+func Refresh(interval time.Duration) {
+	for {
+		if err := Generate(); err != nil {
+			slog.Error("failed to generate sitemap", "error", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// Generate rebuilds the sitemaps from the database
+func Generate() error {
+	start := time.Now()
+
+	var urls []url
+	for _, path := range staticPages {
+		urls = append(urls, url{Loc: BaseURL + path})
+	}
+	for _, entry := range models.SitemapEntries() {
+		urls = append(urls, url{Loc: BaseURL + entry.Path, LastMod: lastMod(entry.Modified)})
+	}
+
+	var pages [][]byte
+	index := sitemapindex{}
+	for i := 0; i < len(urls); i += PageSize {
+		page, err := encode(urlset{URLs: urls[i:min(i+PageSize, len(urls))]})
+		if err != nil {
+			return err
+		}
+		pages = append(pages, page)
+		index.Sitemaps = append(index.Sitemaps, sitemap{
+			Loc:     BaseURL + "/sitemaps/" + strconv.Itoa(len(pages)) + ".xml",
+			LastMod: lastMod(start),
+		})
+	}
+
+	data, err := encode(index)
+	if err != nil {
+		return err
+	}
+
+	current.mu.Lock()
+	current.index, current.pages = data, pages
+	current.mu.Unlock()
+
+	slog.Info("generated sitemap", "urls", len(urls), "pages", len(pages), "duration", time.Since(start))
+	return nil
+}
+
+// Index returns the sitemap index, or nil before the first Generate
+func Index() []byte {
+	current.mu.RLock()
+	defer current.mu.RUnlock()
+	return current.index
+}
+
+// Page returns the nth sitemap, counting from 1
+func Page(n int) ([]byte, bool) {
+	current.mu.RLock()
+	defer current.mu.RUnlock()
+	if n < 1 || n > len(current.pages) {
+		return nil, false
+	}
+	return current.pages[n-1], true
+}
+
+func encode(v any) ([]byte, error) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+func lastMod(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
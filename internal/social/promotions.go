@@ -57,10 +57,12 @@ func WrapProject(project *models.Project) Promotable {
 	return &projectPromotable{project: project}
 }
 
-// CreatePromotion creates a new promotion for the given entity.
+// CreatePromotion creates a new promotion for the given entity, targeted at
+// users interested in tags (all users when empty) and optionally skipping
+// the owner's followers.
 // Returns an error if the user doesn't own the entity, if there's already
 // an active promotion, or if the content is too long.
-func CreatePromotion(userID string, entity Promotable, content string) (*models.Promotion, error) {
+func CreatePromotion(userID string, entity Promotable, content, tags string, excludeFollowers bool) (*models.Promotion, error) {
 	// Check ownership
 	if entity.GetOwnerID() != userID {
 		return nil, errors.New("you can only promote your own content")
@@ -83,24 +85,28 @@ func CreatePromotion(userID string, entity Promotable, content string) (*models.
 		SubjectID:   entity.GetID(),
 		Content:     content,
 		ExpiresAt:   time.Now().Add(models.DefaultPromotionDuration),
+
+		Tags:             models.PromotionTags(tags),
+		ExcludeFollowers: excludeFollowers,
 	}
 
 	return models.Promotions.Insert(promo)
 }
 
-// CancelPromotion cancels the active promotion for the given entity.
+// CancelPromotion stops the active promotion for the given entity, crediting
+// unused paid days to the user's account, and returns the credit in cents.
 // Returns an error if the user doesn't own the entity or if there's no active promotion.
-func CancelPromotion(userID string, entity Promotable) error {
+func CancelPromotion(userID string, entity Promotable) (int64, error) {
 	// Check ownership
 	if entity.GetOwnerID() != userID {
-		return errors.New("you can only cancel your own promotions")
+		return 0, errors.New("you can only cancel your own promotions")
 	}
 
 	// Get active promotion
 	promo := entity.ActivePromotion()
 	if promo == nil {
-		return errors.New("no active promotion found")
+		return 0, errors.New("no active promotion found")
 	}
 
-	return models.Promotions.Delete(promo)
+	return promo.Stop()
 }
@@ -0,0 +1,229 @@
+// Package sociallogin signs users in with their GitHub or Google account
+// using the OAuth 2.0 authorization code flow. A provider is only offered
+// when its client ID and secret are set, e.g. GITHUB_CLIENT_ID and
+// GITHUB_CLIENT_SECRET.
+package sociallogin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var client = &http.Client{Timeout: 15 * time.Second}
+
+// Identity is who the provider says the user is
+type Identity struct {
+	Provider      string
+	Subject       string // The provider's stable ID for the account
+	Email         string
+	EmailVerified bool
+	Name          string
+	Handle        string // Suggested handle, e.g. the GitHub login
+	Avatar        string
+}
+
+// Provider is an OAuth provider users can sign in with
+type Provider struct {
+	Name     string // Used in URLs, e.g. "github"
+	Label    string // Shown on buttons, e.g. "GitHub"
+	authURL  string
+	tokenURL string
+	scopes   string
+	identify func(ctx context.Context, token string) (*Identity, error)
+}
+
+var providers = []*Provider{
+	{
+		Name:     "github",
+		Label:    "GitHub",
+		authURL:  "https://github.com/login/oauth/authorize",
+		tokenURL: "https://github.com/login/oauth/access_token",
+		scopes:   "read:user user:email",
+		identify: githubIdentity,
+	},
+	{
+		Name:     "google",
+		Label:    "Google",
+		authURL:  "https://accounts.google.com/o/oauth2/v2/auth",
+		tokenURL: "https://oauth2.googleapis.com/token",
+		scopes:   "openid email profile",
+		identify: googleIdentity,
+	},
+}
+
+// Providers returns the providers that are configured, in display order
+func Providers() []*Provider {
+	var enabled []*Provider
+	for _, p := range providers {
+		if p.Enabled() {
+			enabled = append(enabled, p)
+		}
+	}
+	return enabled
+}
+
+// Get returns a configured provider by name
+func Get(name string) (*Provider, error) {
+	for _, p := range Providers() {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return nil, errors.New("sign in provider not available")
+}
+
+// Enabled reports whether the provider's credentials are set
+func (p *Provider) Enabled() bool {
+	return p.clientID() != "" && p.clientSecret() != ""
+}
+
+func (p *Provider) clientID() string {
+	return os.Getenv(strings.ToUpper(p.Name) + "_CLIENT_ID")
+}
+
+func (p *Provider) clientSecret() string {
+	return os.Getenv(strings.ToUpper(p.Name) + "_CLIENT_SECRET")
+}
+
+// AuthURL returns where to send the user to approve signing in. The
+// provider sends them back to redirectURI with a code and the state.
+func (p *Provider) AuthURL(state, redirectURI string) string {
+	query := url.Values{
+		"client_id":     {p.clientID()},
+		"redirect_uri":  {redirectURI},
+		"response_type": {"code"},
+		"scope":         {p.scopes},
+		"state":         {state},
+	}
+	return p.authURL + "?" + query.Encode()
+}
+
+// Exchange trades the code the provider sent back for the user's identity
+func (p *Provider) Exchange(ctx context.Context, code, redirectURI string) (*Identity, error) {
+	form := url.Values{
+		"client_id":     {p.clientID()},
+		"client_secret": {p.clientSecret()},
+		"code":          {code},
+		"grant_type":    {"authorization_code"},
+		"redirect_uri":  {redirectURI},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	if err = do(req, &token); err != nil {
+		return nil, errors.Wrap(err, "failed to exchange sign in code")
+	}
+	if token.AccessToken == "" {
+		return nil, errors.Errorf("sign in was not approved: %s", token.Error)
+	}
+
+	identity, err := p.identify(ctx, token.AccessToken)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to look up account")
+	}
+	identity.Provider = p.Name
+	if identity.Subject == "" {
+		return nil, errors.New("failed to look up account")
+	}
+	return identity, nil
+}
+
+func githubIdentity(ctx context.Context, token string) (*Identity, error) {
+	var user struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err := get(ctx, "https://api.github.com/user", token, &user); err != nil {
+		return nil, err
+	}
+
+	// The profile email may be hidden or unverified, so use the primary
+	// address from the verified list instead
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := get(ctx, "https://api.github.com/user/emails", token, &emails); err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		Subject: strconv.FormatInt(user.ID, 10),
+		Name:    user.Name,
+		Handle:  user.Login,
+		Avatar:  user.AvatarURL,
+	}
+	for _, e := range emails {
+		if e.Primary {
+			identity.Email, identity.EmailVerified = e.Email, e.Verified
+		}
+	}
+	return identity, nil
+}
+
+func googleIdentity(ctx context.Context, token string) (*Identity, error) {
+	var user struct {
+		Sub           string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+		Picture       string `json:"picture"`
+	}
+	if err := get(ctx, "https://openidconnect.googleapis.com/v1/userinfo", token, &user); err != nil {
+		return nil, err
+	}
+
+	handle, _, _ := strings.Cut(user.Email, "@")
+	return &Identity{
+		Subject:       user.Sub,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Name:          user.Name,
+		Handle:        handle,
+		Avatar:        user.Picture,
+	}, nil
+}
+
+func get(ctx context.Context, url, token string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	return do(req, v)
+}
+
+func do(req *http.Request, v any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return errors.Errorf("%s returned %d: %s", req.URL.Host, resp.StatusCode, body)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,88 @@
+package starter
+
+import (
+	"encoding/json"
+	"io/fs"
+	"path"
+	"slices"
+
+	"github.com/pkg/errors"
+)
+
+// Default is the template projects start from when none is picked
+const Default = "skykit"
+
+// Template is a starter a project can be created from. Each one is a
+// bundle under templates/<id>: a template.json describing it, a
+// preview.svg shown in the gallery, and the files it creates. Files
+// ending in .tmpl are executed with the project and lose the suffix; the
+// rest are copied as they are.
+type Template struct {
+	ID          string `json:"-"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Stack       string `json:"stack"` // Language or runtime, e.g. "Go"
+	Order       int    `json:"order"` // Position in the gallery
+}
+
+// IsDefault reports whether the template is preselected in the gallery
+func (t *Template) IsDefault() bool {
+	return t.ID == Default
+}
+
+// Preview returns the template's preview image, an SVG
+func (t *Template) Preview() ([]byte, error) {
+	return templates.ReadFile(path.Join("templates", t.ID, "preview.svg"))
+}
+
+func (t *Template) files() string {
+	return path.Join("templates", t.ID, "files")
+}
+
+// gallery is loaded at startup, so a broken bundle stops the server
+// instead of failing someone's new project
+var gallery = mustLoadGallery()
+
+func mustLoadGallery() []*Template {
+	dirs, err := templates.ReadDir("templates")
+	if err != nil {
+		panic(err)
+	}
+
+	var list []*Template
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		data, err := templates.ReadFile(path.Join("templates", dir.Name(), "template.json"))
+		if err != nil {
+			panic(errors.Wrapf(err, "starter template %s has no template.json", dir.Name()))
+		}
+		t := &Template{ID: dir.Name()}
+		if err := json.Unmarshal(data, t); err != nil {
+			panic(errors.Wrapf(err, "invalid template.json in starter template %s", dir.Name()))
+		}
+		if _, err := fs.Stat(templates, t.files()); err != nil {
+			panic(errors.Wrapf(err, "starter template %s has no files", dir.Name()))
+		}
+		list = append(list, t)
+	}
+
+	slices.SortFunc(list, func(a, b *Template) int { return a.Order - b.Order })
+	return list
+}
+
+// Templates returns the gallery, in display order
+func Templates() []*Template {
+	return gallery
+}
+
+// Lookup returns the template with an ID, or nil
+func Lookup(id string) *Template {
+	for _, t := range gallery {
+		if t.ID == id {
+			return t
+		}
+	}
+	return nil
+}
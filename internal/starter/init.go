@@ -3,8 +3,10 @@ package starter
 import (
 	"bytes"
 	"embed"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"text/template"
 
 	"github.com/The-Skyscape/devtools/pkg/authentication"
@@ -13,11 +15,12 @@ import (
 	"www.theskyscape.com/models"
 )
 
-//go:embed templates/*
+//go:embed all:templates
 var templates embed.FS
 
-// CreateStarterFiles creates a Skykit starter app in the project repository
-func CreateStarterFiles(repoPath string, project *models.Project, author *authentication.User) error {
+// CreateStarterFiles commits a starter template's files to the project
+// repository
+func CreateStarterFiles(repoPath string, project *models.Project, author *authentication.User, starter *Template) error {
 	// Create temp directory for working tree
 	tmpDir, err := os.MkdirTemp("", "project-init-*")
 	if err != nil {
@@ -36,24 +39,23 @@ func CreateStarterFiles(repoPath string, project *models.Project, author *authen
 		return errors.Wrap(err, "failed to add remote")
 	}
 
-	// Create directory structure
-	viewsDir := filepath.Join(tmpDir, "views")
-	if err := os.MkdirAll(viewsDir, 0755); err != nil {
-		return errors.Wrap(err, "failed to create views dir")
-	}
-
-	// Generate and write files from templates
-	if err := writeTemplate(tmpDir, "main.go", "templates/main.go.tmpl", project); err != nil {
-		return err
-	}
-	if err := writeTemplate(tmpDir, "go.mod", "templates/go.mod.tmpl", project); err != nil {
-		return err
-	}
-	if err := writeStatic(tmpDir, "Dockerfile", "templates/Dockerfile"); err != nil {
-		return err
-	}
-	if err := writeTemplate(viewsDir, "index.html", "templates/views/index.html.tmpl", project); err != nil {
-		return err
+	// Generate and write the template's files
+	root := starter.files()
+	err = fs.WalkDir(templates, root, func(src string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(src, root), "/")
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(tmpDir, rel), 0755)
+		}
+		if name, ok := strings.CutSuffix(rel, ".tmpl"); ok {
+			return writeTemplate(tmpDir, name, src, project)
+		}
+		return writeStatic(tmpDir, rel, src)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to write %s starter", starter.ID)
 	}
 
 	// Git add, commit, and push
@@ -61,7 +63,7 @@ func CreateStarterFiles(repoPath string, project *models.Project, author *authen
 	host.SetStdout(&stdout)
 	host.SetStderr(&stderr)
 
-	if err := host.Exec("bash", "-c", buildCommitScript(tmpDir, author)); err != nil {
+	if err := host.Exec("bash", "-c", buildCommitScript(tmpDir, author, starter)); err != nil {
 		return errors.Wrapf(err, "failed to commit and push: %s", stderr.String())
 	}
 
@@ -104,13 +106,13 @@ func writeStatic(dir, filename, srcPath string) error {
 	return nil
 }
 
-func buildCommitScript(tmpDir string, user *authentication.User) string {
+func buildCommitScript(tmpDir string, user *authentication.User, starter *Template) string {
 	return `
 		cd ` + tmpDir + `
 		git config user.name "` + user.Name + `"
 		git config user.email "` + user.Email + `"
 		git add -A
-		git commit -m "Initial commit: Skykit starter app"
+		git commit -m "Initial commit: ` + starter.Name + ` starter"
 		git push origin main
 	`
 }
@@ -0,0 +1,110 @@
+// Package summaries writes plain-language summaries of commit history with a
+// language model. It is off unless AI_SUMMARIES=true and AI_API_KEY are set,
+// and callers only use it for users who opted in on their settings page.
+package summaries
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxCommits bounds how much history is sent in one request
+const maxCommits = 100
+
+// maxMessage truncates long commit bodies
+const maxMessage = 1000
+
+var client = &http.Client{Timeout: time.Minute}
+
+// Enabled reports whether the integration is configured. It speaks the
+// OpenAI chat completions API, so AI_API_URL can point at any compatible
+// provider.
+func Enabled() bool {
+	return os.Getenv("AI_SUMMARIES") == "true" && os.Getenv("AI_API_KEY") != ""
+}
+
+// Push summarizes the commits of a push in a sentence or two, for the
+// "pushed" activity in the feed
+func Push(ctx context.Context, commits []string) (string, error) {
+	return complete(ctx, `You summarize a git push for a developer's public activity feed.
+Reply with one or two plain sentences describing what changed, written in the past tense
+without mentioning commits, hashes or the author. No markdown.`, commits)
+}
+
+// ReleaseNotes drafts release notes from commit history, newest first
+func ReleaseNotes(ctx context.Context, commits []string) (string, error) {
+	return complete(ctx, `You draft release notes from git commit messages.
+Group user-facing changes under "Features", "Fixes" and "Other" headings as Markdown
+bullet lists, skip sections with no entries, and leave out merge and housekeeping commits.
+Reply with the release notes only.`, commits)
+}
+
+func complete(ctx context.Context, instructions string, commits []string) (string, error) {
+	if !Enabled() {
+		return "", errors.New("summaries are not enabled")
+	}
+	if len(commits) == 0 {
+		return "", errors.New("no commits to summarize")
+	}
+
+	commits = commits[:min(len(commits), maxCommits)]
+	var prompt strings.Builder
+	for _, msg := range commits {
+		msg = strings.TrimSpace(msg)
+		if len(msg) > maxMessage {
+			msg = msg[:maxMessage]
+		}
+		prompt.WriteString("- " + strings.ReplaceAll(msg, "\n", "\n  ") + "\n")
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"model": cmp.Or(os.Getenv("AI_MODEL"), "gpt-4o-mini"),
+		"messages": []map[string]string{
+			{"role": "system", "content": instructions},
+			{"role": "user", "content": prompt.String()},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	url := cmp.Or(os.Getenv("AI_API_URL"), "https://api.openai.com/v1/chat/completions")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+os.Getenv("AI_API_KEY"))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to reach summary provider")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("summary provider responded with %s", resp.Status)
+	}
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", errors.Wrap(err, "failed to decode summary")
+	}
+	if len(result.Choices) == 0 || strings.TrimSpace(result.Choices[0].Message.Content) == "" {
+		return "", errors.New("summary provider returned nothing")
+	}
+	return strings.TrimSpace(result.Choices[0].Message.Content), nil
+}
@@ -0,0 +1,91 @@
+// Package tracing configures OpenTelemetry tracing and provides helpers
+// for starting spans around requests, git commands, builds and API calls.
+package tracing
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName identifies this server in traces unless OTEL_SERVICE_NAME is set
+const ServiceName = "skyscape"
+
+var tracer = otel.Tracer("www.theskyscape.com")
+
+// Setup installs the global tracer provider. Spans are exported over OTLP/HTTP
+// when OTEL_EXPORTER_OTLP_ENDPOINT (or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT) is
+// set; otherwise tracing stays a no-op. Sampling follows OTEL_TRACES_SAMPLER.
+// Incoming and outgoing requests always propagate W3C trace context.
+func Setup() {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return
+	}
+
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		slog.Error("failed to create trace exporter", "error", err)
+		return
+	}
+
+	// Attributes from OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES win
+	// over the defaults since they are detected last
+	res, err := resource.New(context.Background(),
+		resource.WithAttributes(semconv.ServiceName(ServiceName)),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		slog.Warn("failed to detect trace resource", "error", err)
+	}
+
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	))
+	slog.Info("tracing enabled")
+}
+
+// Start begins a span as a child of any span in ctx. End it with End.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err on the span, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Middleware starts a server span for each request to the route, continuing
+// any trace the caller propagated in the traceparent header
+func Middleware(pattern string, next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, pattern)
+}
+
+// Detach returns a context that keeps ctx's span but not its cancellation,
+// for background work (like builds) that outlives the request starting it
+func Detach(ctx context.Context) context.Context {
+	return context.WithoutCancel(ctx)
+}
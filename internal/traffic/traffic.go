@@ -0,0 +1,142 @@
+// Package traffic meters requests the reverse proxy forwards to apps and
+// projects: how many, how many failed, the bytes each way and how long the
+// container took to respond. Counts are kept in memory and added to daily
+// rows on each flush, for owners' manage pages and usage billing.
+package traffic
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"www.theskyscape.com/models"
+)
+
+type key struct {
+	site, day string
+}
+
+type counts struct {
+	requests, errors  int
+	bytesIn, bytesOut int64
+	latency           []int // Per models.LatencyBuckets, plus overflow
+}
+
+var (
+	mu      sync.Mutex
+	pending = map[key]*counts{}
+)
+
+// Record counts one proxied request. latency is the time until the
+// container's response headers arrived.
+func Record(siteID string, status int, bytesIn, bytesOut int64, latency time.Duration) {
+	k := key{siteID, time.Now().UTC().Format(time.DateOnly)}
+
+	mu.Lock()
+	defer mu.Unlock()
+	c, ok := pending[k]
+	if !ok {
+		c = &counts{latency: make([]int, len(models.LatencyBuckets)+1)}
+		pending[k] = c
+	}
+	c.requests++
+	if status >= 500 {
+		c.errors++
+	}
+	c.bytesIn += bytesIn
+	c.bytesOut += bytesOut
+	c.latency[models.LatencyBucket(latency)]++
+}
+
+// Flush writes the counts gathered since the last flush
+func Flush() {
+	mu.Lock()
+	flushing := pending
+	pending = map[key]*counts{}
+	mu.Unlock()
+
+	for k, c := range flushing {
+		if err := models.AddSiteTraffic(k.site, k.day, c.requests, c.errors, c.bytesIn, c.bytesOut, c.latency); err != nil {
+			slog.Error("failed to save site traffic", "site_id", k.site, "error", err)
+		}
+	}
+}
+
+// Run flushes counts on an interval
+func Run(interval time.Duration) {
+	for range time.Tick(interval) {
+		Flush()
+	}
+}
+
+// Meter wraps a proxied request and its response writer to count the
+// bytes sent each way. Call Done once the proxy has finished.
+type Meter struct {
+	http.ResponseWriter
+	body    *countingBody
+	start   time.Time
+	latency time.Duration
+	status  int
+	written int64
+}
+
+// NewMeter starts metering a request, replacing its body with one that
+// counts what the proxy reads from it
+func NewMeter(w http.ResponseWriter, r *http.Request) *Meter {
+	m := &Meter{ResponseWriter: w, start: time.Now()}
+	if r.Body != nil && r.Body != http.NoBody {
+		m.body = &countingBody{ReadCloser: r.Body}
+		r.Body = m.body
+	}
+	return m
+}
+
+func (m *Meter) WriteHeader(status int) {
+	if m.status == 0 {
+		m.status = status
+		m.latency = time.Since(m.start)
+	}
+	m.ResponseWriter.WriteHeader(status)
+}
+
+func (m *Meter) Write(b []byte) (int, error) {
+	if m.status == 0 {
+		m.WriteHeader(http.StatusOK)
+	}
+	n, err := m.ResponseWriter.Write(b)
+	m.written += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, so the
+// proxy can still flush streams and hijack WebSocket upgrades. Bytes sent
+// over a hijacked connection aren't counted.
+func (m *Meter) Unwrap() http.ResponseWriter {
+	return m.ResponseWriter
+}
+
+// Done records the request against a site
+func (m *Meter) Done(siteID string) {
+	status, latency := m.status, m.latency
+	if status == 0 {
+		status, latency = http.StatusOK, time.Since(m.start)
+	}
+	var read int64
+	if m.body != nil {
+		read = m.body.n
+	}
+	Record(siteID, status, read, m.written, latency)
+}
+
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,290 @@
+// Package waf screens requests in the reverse proxy before they reach an
+// app or project's container, using the limits and rules its owner set:
+// a body size limit, a response timeout, blocked paths, IP allow and deny
+// lists, and a set of patterns that catch common attacks. Rules are
+// compiled once and cached per site, so most requests cost a map lookup.
+package waf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"www.theskyscape.com/internal/clientip"
+	"www.theskyscape.com/models"
+)
+
+// rulesTTL is how long a site's compiled rules are cached by the proxy
+const rulesTTL = time.Minute
+
+var (
+	mu    sync.Mutex
+	cache = map[string]cached{}
+)
+
+type cached struct {
+	rules   *Rules // nil when the site has no rules
+	expires time.Time
+}
+
+// Rules are a site's proxy rules, parsed for checking requests
+type Rules struct {
+	maxBody int64
+	timeout time.Duration
+	blocked []string
+	allow   []*net.IPNet
+	deny    []*net.IPNet
+	waf     bool
+}
+
+// Compile parses a site's rules, returning an error naming the first
+// line that can't be used
+func Compile(rules *models.ProxyRules) (*Rules, error) {
+	if rules.MaxBodyMB < 0 || rules.MaxBodyMB > models.MaxProxyBodyMB {
+		return nil, fmt.Errorf("max body size must be between 0 and %d MB", models.MaxProxyBodyMB)
+	}
+	if rules.TimeoutSeconds < 0 || rules.TimeoutSeconds > models.MaxProxyTimeout {
+		return nil, fmt.Errorf("timeout must be between 0 and %d seconds", models.MaxProxyTimeout)
+	}
+
+	c := &Rules{
+		maxBody: int64(rules.MaxBodyMB) << 20,
+		timeout: time.Duration(rules.TimeoutSeconds) * time.Second,
+		waf:     rules.WAF,
+	}
+
+	paths := models.Lines(rules.BlockedPaths)
+	if len(paths) > models.MaxProxyRules {
+		return nil, fmt.Errorf("at most %d blocked paths", models.MaxProxyRules)
+	}
+	for _, p := range paths {
+		if !strings.HasPrefix(p, "/") {
+			return nil, fmt.Errorf("blocked path %q must start with /", p)
+		}
+		c.blocked = append(c.blocked, strings.ToLower(p))
+	}
+
+	var err error
+	if c.allow, err = parseNets("allowed", rules.AllowIPs); err != nil {
+		return nil, err
+	}
+	if c.deny, err = parseNets("denied", rules.DenyIPs); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func parseNets(kind, list string) ([]*net.IPNet, error) {
+	lines := models.Lines(list)
+	if len(lines) > models.MaxProxyRules {
+		return nil, fmt.Errorf("at most %d %s IPs", models.MaxProxyRules, kind)
+	}
+
+	var nets []*net.IPNet
+	for _, line := range lines {
+		if !strings.Contains(line, "/") {
+			ip := net.ParseIP(line)
+			if ip == nil {
+				return nil, fmt.Errorf("%s IP %q is not an IP or CIDR range", kind, line)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s IP %q is not an IP or CIDR range", kind, line)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// For returns a site's compiled rules, or nil if it has none. Rules that
+// no longer compile are ignored rather than blocking every request.
+func For(siteID string) *Rules {
+	mu.Lock()
+	c, ok := cache[siteID]
+	mu.Unlock()
+	if ok && time.Now().Before(c.expires) {
+		return c.rules
+	}
+
+	var compiled *Rules
+	if rules := models.ProxyRulesFor(siteID); rules.IsActive() {
+		var err error
+		if compiled, err = Compile(rules); err != nil {
+			slog.Warn("waf: ignoring rules", "site", siteID, "error", err)
+		}
+	}
+
+	mu.Lock()
+	cache[siteID] = cached{compiled, time.Now().Add(rulesTTL)}
+	mu.Unlock()
+	return compiled
+}
+
+// Forget drops a site's cached rules after its owner changes them
+func Forget(siteID string) {
+	mu.Lock()
+	delete(cache, siteID)
+	mu.Unlock()
+}
+
+// Check returns the status and reason to refuse a request with, or 0 if
+// the request is allowed
+func (c *Rules) Check(r *http.Request) (int, string) {
+	if len(c.allow) > 0 || len(c.deny) > 0 {
+		ip := net.ParseIP(clientip.From(r))
+		if len(c.allow) > 0 && !contains(c.allow, ip) {
+			return http.StatusForbidden, "ip not allowed"
+		}
+		if contains(c.deny, ip) {
+			return http.StatusForbidden, "ip denied"
+		}
+	}
+
+	if c.maxBody > 0 && r.ContentLength > c.maxBody {
+		return http.StatusRequestEntityTooLarge, "body too large"
+	}
+
+	if len(c.blocked) > 0 {
+		p := strings.ToLower(path.Clean("/" + r.URL.Path))
+		for _, prefix := range c.blocked {
+			if isUnder(p, prefix) {
+				return http.StatusForbidden, "path blocked"
+			}
+		}
+	}
+
+	if c.waf {
+		if rule := matchAttack(r); rule != "" {
+			return http.StatusForbidden, rule
+		}
+	}
+	return 0, ""
+}
+
+// isUnder reports whether p is prefix or below it. A prefix ending in a
+// slash only matches below it, so "/admin/" leaves "/admin" alone.
+func isUnder(p, prefix string) bool {
+	if strings.HasSuffix(prefix, "/") {
+		return strings.HasPrefix(p+"/", prefix)
+	}
+	return p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Guard screens a request to a site before it's proxied. Refused requests
+// are answered and Guard returns false. Allowed ones come back with the
+// site's body limit and response timeout applied; call done once the
+// request has been proxied.
+func Guard(siteID string, w http.ResponseWriter, r *http.Request) (_ *http.Request, done func(), ok bool) {
+	rules := For(siteID)
+	if rules == nil {
+		return r, func() {}, true
+	}
+
+	if status, reason := rules.Check(r); status != 0 {
+		slog.Info("waf: refused request", "site", siteID, "reason", reason, "path", r.URL.Path, "ip", clientip.From(r))
+		http.Error(w, http.StatusText(status), status)
+		return r, nil, false
+	}
+
+	if rules.maxBody > 0 && r.Body != nil && r.Body != http.NoBody {
+		r.Body = http.MaxBytesReader(w, r.Body, rules.maxBody)
+	}
+
+	done = func() {}
+	if rules.timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), rules.timeout)
+		r, done = r.WithContext(ctx), cancel
+	}
+	return r, done, true
+}
+
+// ErrorHandler answers requests the proxy couldn't complete, telling a
+// response timeout and an oversized body apart from an unreachable
+// container
+func ErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	case errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(http.StatusGatewayTimeout)
+	case errors.Is(err, context.Canceled):
+		// The client went away, there's no one to answer
+		w.WriteHeader(499)
+	default:
+		slog.Warn("proxy error", "host", r.Host, "error", err)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+}
+
+// attacks are the patterns the WAF refuses, matched against the decoded,
+// lowercased path and query string
+var attacks = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"path traversal", regexp.MustCompile(`(^|[/\\])\.\.([/\\]|$)`)},
+	{"sensitive file", regexp.MustCompile(`(^|/)(\.env|\.git|\.svn|\.hg|\.htpasswd|\.htaccess|\.ds_store|wp-config\.php)([/.?]|$)|/etc/(passwd|shadow)`)},
+	{"null byte", regexp.MustCompile(`\x00`)},
+	{"sql injection", regexp.MustCompile(`union(\s|/\*.*?\*/|\+)+(all(\s|\+)+)?select|'\s*(or|and)\s+'?\d+'?\s*=\s*'?\d+|;\s*(drop|truncate|delete|alter)\s+|\b(sleep|benchmark|pg_sleep)\s*\(|information_schema|xp_cmdshell`)},
+	{"cross-site scripting", regexp.MustCompile(`<\s*(script|iframe|object|embed)\b|javascript\s*:|\bon(error|load|mouseover|focus|click)\s*=|<\s*svg[^>]*\bon\w+\s*=`)},
+	{"command injection", regexp.MustCompile(`(;|\|\|?|&&)\s*(cat|wget|curl|nc|bash|sh)\s+|\$\([^)]*\)|/bin/(ba)?sh\b`)},
+}
+
+// scanners are the user agents of common vulnerability scanners
+var scanners = regexp.MustCompile(`sqlmap|nikto|acunetix|nessus|masscan|wpscan|nuclei|dirbuster|gobuster`)
+
+// matchAttack returns the name of the attack a request looks like, or ""
+func matchAttack(r *http.Request) string {
+	if scanners.MatchString(strings.ToLower(r.UserAgent())) {
+		return "scanner"
+	}
+
+	target := strings.ToLower(decode(r.URL.EscapedPath()) + "?" + decode(r.URL.RawQuery))
+	for _, attack := range attacks {
+		if attack.pattern.MatchString(target) {
+			return attack.name
+		}
+	}
+	return ""
+}
+
+// decode unescapes s twice, so double-encoded payloads are caught too
+func decode(s string) string {
+	for range 2 {
+		unescaped, err := url.QueryUnescape(s)
+		if err != nil || unescaped == s {
+			break
+		}
+		s = unescaped
+	}
+	return s
+}
@@ -0,0 +1,295 @@
+// Package webauthn verifies passkey registrations and sign-ins (Web
+// Authentication Level 2). It asks authenticators for no attestation, so a
+// registration is trusted as far as the signed-in user who made it, and
+// supports the ES256, RS256 and EdDSA keys browsers create.
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"slices"
+)
+
+// COSE algorithm identifiers, in order of preference
+const (
+	ES256 = -7
+	EdDSA = -8
+	RS256 = -257
+)
+
+// Algorithms lists the key types offered to authenticators
+var Algorithms = []int{ES256, EdDSA, RS256}
+
+// Authenticator data flags
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// Encoding is how credential IDs and challenges travel as text
+var Encoding = base64.RawURLEncoding
+
+var (
+	ErrChallenge = errors.New("passkey challenge doesn't match")
+	ErrOrigin    = errors.New("passkey was created for another site")
+	ErrSignature = errors.New("passkey signature is invalid")
+	ErrCounter   = errors.New("passkey counter went backwards, it may have been cloned")
+)
+
+// NewChallenge returns a random challenge for one ceremony
+func NewChallenge() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return Encoding.EncodeToString(b)
+}
+
+// RelyingParty is the site passkeys are scoped to. Only ceremonies run on
+// one of Origins are accepted, not every subdomain of ID, since other
+// parties may control some of them.
+type RelyingParty struct {
+	ID      string // Registrable domain, e.g. theskyscape.com
+	Name    string
+	Origins []string // Exact origins, e.g. https://www.theskyscape.com
+}
+
+// Credential is a passkey created at registration
+type Credential struct {
+	ID           []byte
+	PublicKey    []byte // COSE_Key, CBOR encoded
+	SignCount    uint32
+	UserVerified bool
+}
+
+// Assertion is the outcome of a successful sign-in
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+// clientData is the browser's record of a ceremony
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// checkClientData checks the browser ran the ceremony we asked for
+func (rp *RelyingParty) checkClientData(raw []byte, kind, challenge string) error {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return err
+	}
+	if cd.Type != kind {
+		return errors.New("unexpected passkey ceremony")
+	}
+	if cd.Challenge != challenge {
+		return ErrChallenge
+	}
+
+	if !slices.Contains(rp.Origins, cd.Origin) {
+		return ErrOrigin
+	}
+	return nil
+}
+
+// authData is the authenticator's signed statement
+type authData struct {
+	rpIDHash   []byte
+	flags      byte
+	signCount  uint32
+	credential []byte // Credential ID, only at registration
+	publicKey  []byte // COSE key, only at registration
+}
+
+func parseAuthData(raw []byte) (*authData, error) {
+	if len(raw) < 37 {
+		return nil, errors.New("authenticator data too short")
+	}
+	ad := &authData{
+		rpIDHash:  raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+
+	if ad.flags&flagAttested != 0 {
+		rest := raw[37:]
+		if len(rest) < 18 {
+			return nil, errors.New("authenticator data too short")
+		}
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < idLen {
+			return nil, errors.New("authenticator data too short")
+		}
+		ad.credential = rest[:idLen]
+
+		// The key is followed by extensions, if any
+		_, after, err := decodeCBOR(rest[idLen:])
+		if err != nil {
+			return nil, err
+		}
+		ad.publicKey = rest[idLen : len(rest)-len(after)]
+	}
+	return ad, nil
+}
+
+// checkAuthData checks the authenticator scoped the credential to us and
+// the user was present
+func (rp *RelyingParty) checkAuthData(ad *authData) error {
+	want := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(ad.rpIDHash, want[:]) {
+		return ErrOrigin
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return errors.New("passkey didn't confirm the user was present")
+	}
+	return nil
+}
+
+// Register verifies a new passkey from navigator.credentials.create
+func (rp *RelyingParty) Register(challenge string, clientDataJSON, attestationObject []byte) (*Credential, error) {
+	if err := rp.checkClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, err
+	}
+	attestation, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, errCBOR
+	}
+	raw, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, errCBOR
+	}
+
+	ad, err := parseAuthData(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err = rp.checkAuthData(ad); err != nil {
+		return nil, err
+	}
+	if ad.credential == nil {
+		return nil, errors.New("passkey has no credential")
+	}
+
+	// Make sure the key is one we can check signatures with later
+	if _, _, err = parseKey(ad.publicKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:           ad.credential,
+		PublicKey:    ad.publicKey,
+		SignCount:    ad.signCount,
+		UserVerified: ad.flags&flagUserVerified != 0,
+	}, nil
+}
+
+// Verify checks a sign-in from navigator.credentials.get against a stored
+// passkey
+func (rp *RelyingParty) Verify(challenge string, publicKey []byte, signCount uint32, clientDataJSON, authenticatorData, signature []byte) (*Assertion, error) {
+	if err := rp.checkClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return nil, err
+	}
+
+	ad, err := parseAuthData(authenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	if err = rp.checkAuthData(ad); err != nil {
+		return nil, err
+	}
+
+	alg, key, err := parseKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authenticatorData...), clientHash[:]...)
+	if !verifySignature(alg, key, signed, signature) {
+		return nil, ErrSignature
+	}
+
+	// Authenticators that keep a counter must always move it forward
+	if (ad.signCount != 0 || signCount != 0) && ad.signCount <= signCount {
+		return nil, ErrCounter
+	}
+
+	return &Assertion{SignCount: ad.signCount, UserVerified: ad.flags&flagUserVerified != 0}, nil
+}
+
+// parseKey reads a COSE_Key into a Go public key
+func parseKey(cose []byte) (int, crypto.PublicKey, error) {
+	decoded, _, err := decodeCBOR(cose)
+	if err != nil {
+		return 0, nil, err
+	}
+	m, ok := decoded.(map[any]any)
+	if !ok {
+		return 0, nil, errCBOR
+	}
+	alg, _ := m[int64(3)].(int64)
+
+	switch alg {
+	case ES256:
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv, _ := m[int64(-1)].(int64); crv != 1 || len(x) != 32 || len(y) != 32 {
+			return 0, nil, errors.New("unsupported passkey curve")
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return 0, nil, errors.New("invalid passkey public key")
+		}
+		return ES256, key, nil
+	case EdDSA:
+		x, _ := m[int64(-2)].([]byte)
+		if crv, _ := m[int64(-1)].(int64); crv != 6 || len(x) != ed25519.PublicKeySize {
+			return 0, nil, errors.New("unsupported passkey curve")
+		}
+		return EdDSA, ed25519.PublicKey(x), nil
+	case RS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return 0, nil, errors.New("unsupported passkey key size")
+		}
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		return RS256, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}, nil
+	}
+	return 0, nil, errors.New("unsupported passkey algorithm")
+}
+
+func verifySignature(alg int, key crypto.PublicKey, signed, signature []byte) bool {
+	switch alg {
+	case ES256:
+		digest := sha256.Sum256(signed)
+		return ecdsa.VerifyASN1(key.(*ecdsa.PublicKey), digest[:], signature)
+	case EdDSA:
+		return ed25519.Verify(key.(ed25519.PublicKey), signed, signature)
+	case RS256:
+		digest := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), crypto.SHA256, digest[:], signature) == nil
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package webhooks
+
+import (
+	"github.com/The-Skyscape/devtools/pkg/authentication"
+	"www.theskyscape.com/models"
+)
+
+// siteURL makes links in payloads absolute
+const siteURL = "https://www.theskyscape.com"
+
+// Subject is the repo, project or app an event is about
+type Subject struct {
+	Type string `json:"type"` // "repo", "project" or "app"
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// NewSubject describes a repo, project or app for a payload
+func NewSubject(subjectType, id, name string) *Subject {
+	return &Subject{Type: subjectType, ID: id, Name: name, URL: siteURL + "/" + subjectType + "/" + id}
+}
+
+// Actor is the user who caused an event
+type Actor struct {
+	ID     string `json:"id"`
+	Handle string `json:"handle"`
+	URL    string `json:"url"`
+}
+
+func newActor(user *authentication.User) *Actor {
+	if user == nil {
+		return nil
+	}
+	return &Actor{ID: user.ID, Handle: user.Handle, URL: siteURL + "/user/" + user.Handle}
+}
+
+// PushData is the data of a push event
+type PushData struct {
+	Subject *Subject `json:"subject"`
+	Pusher  *Actor   `json:"pusher"`
+	Before  string   `json:"before"` // "" for the first push
+	After   string   `json:"after"`
+	Message string   `json:"message"` // Of the newest commit
+}
+
+// Push sends a push to a repo or project to its owner's hooks
+func Push(ownerID string, subject *Subject, pusher *authentication.User, before, after, message string) {
+	Dispatch(ownerID, subject.Type, subject.ID, models.WebhookPush, PushData{
+		Subject: subject,
+		Pusher:  newActor(pusher),
+		Before:  before,
+		After:   after,
+		Message: message,
+	})
+}
+
+// DeployData is the data of deploy.succeeded and deploy.failed events
+type DeployData struct {
+	Subject *Subject `json:"subject"` // The app or project deployed
+	Image   string   `json:"image"`
+	Commit  string   `json:"commit"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// Deploy sends a finished build. App deploys go to hooks on the app's
+// repo, project deploys to hooks on the project.
+func Deploy(ownerID, hookSubjectType, hookSubjectID string, subject *Subject, img *models.Image) {
+	event := models.WebhookDeployFailed
+	if img.Status == "ready" {
+		event = models.WebhookDeploySucceeded
+	}
+	Dispatch(ownerID, hookSubjectType, hookSubjectID, event, DeployData{
+		Subject: subject,
+		Image:   img.ID,
+		Commit:  img.GitHash,
+		Error:   img.Error,
+	})
+}
+
+// FollowData is the data of a follow event
+type FollowData struct {
+	Follower *Actor `json:"follower"`
+}
+
+// Follow sends a new follower to the followee's account hooks
+func Follow(followeeID string, follower *authentication.User) {
+	Dispatch(followeeID, models.WebhookAccount, "", models.WebhookFollow, FollowData{
+		Follower: newActor(follower),
+	})
+}
+
+// CommentData is the data of a comment event
+type CommentData struct {
+	ID          string `json:"id"`
+	Author      *Actor `json:"author"`
+	Content     string `json:"content"`
+	SubjectType string `json:"subject_type"` // One of models.CommentTypes
+	SubjectID   string `json:"subject_id"`
+	URL         string `json:"url"`
+}
+
+// Comment sends a comment to the hooks of the owner of what was commented
+// on. Comments on a repo's files or apps count as comments on the repo.
+func Comment(ownerID, hookSubjectType, hookSubjectID string, comment *models.Comment, author *authentication.User, url string) {
+	Dispatch(ownerID, hookSubjectType, hookSubjectID, models.WebhookComment, CommentData{
+		ID:          comment.ID,
+		Author:      newActor(author),
+		Content:     comment.Content,
+		SubjectType: comment.SubjectType,
+		SubjectID:   comment.SubjectID,
+		URL:         siteURL + url,
+	})
+}
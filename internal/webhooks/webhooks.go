@@ -0,0 +1,265 @@
+// Package webhooks delivers events to URLs users register for their
+// account, repos and projects. Each event is stored as a delivery and sent
+// straight away; failed deliveries are retried on a backoff by Run, and a
+// hook that keeps failing is turned off. Bodies are signed with the hook's
+// secret so receivers can tell they came from here.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"www.theskyscape.com/models"
+)
+
+// Timeout bounds a single delivery attempt
+const Timeout = 10 * time.Second
+
+// retryAfter is how long a new delivery is left to its first attempt
+const retryAfter = 2 * Timeout
+
+// maxResponseBody is how much of a response is kept for the delivery log
+const maxResponseBody = 2048
+
+// client refuses to connect to private, loopback and link-local addresses,
+// checked after DNS resolves so a public name can't point inward
+var client = &http.Client{
+	Timeout: Timeout,
+	Transport: &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !isPublic(ip) {
+					return errors.New("webhook URLs must resolve to a public address")
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func isPublic(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsUnspecified() && !ip.IsMulticast()
+}
+
+// Validate checks a webhook URL before it's saved
+func Validate(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return errors.New("enter a full URL, like https://example.com/webhooks")
+	}
+	if u.Scheme != "https" {
+		return errors.New("webhook URLs must use https")
+	}
+	if u.User != nil {
+		return errors.New("webhook URLs can't contain credentials")
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !isPublic(ip) {
+		return errors.New("webhook URLs must resolve to a public address")
+	}
+	return nil
+}
+
+// Payload is the JSON body of every delivery
+type Payload struct {
+	ID        string    `json:"id"` // Its first delivery's ID, kept across retries and redeliveries
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// Dispatch queues an event for the owner's hooks that subscribe to it:
+// their account hooks and those on the repo or project it's about. Each is
+// attempted right away in the background.
+func Dispatch(ownerID, subjectType, subjectID, event string, data any) {
+	for _, hook := range models.WebhooksFor(ownerID, subjectType, subjectID, event) {
+		delivery, err := Queue(hook, event, data)
+		if err != nil {
+			slog.Error("failed to queue webhook delivery", "webhook_id", hook.ID, "event", event, "error", err)
+			continue
+		}
+		go Attempt(hook, delivery)
+	}
+}
+
+// Queue stores a delivery of an event to a hook for the caller to attempt.
+// Should the server stop before it does, Retry picks it up after
+// retryAfter.
+func Queue(hook *models.Webhook, event string, data any) (*models.WebhookDelivery, error) {
+	delivery, err := models.WebhookDeliveries.Insert(&models.WebhookDelivery{
+		WebhookID:     hook.ID,
+		Event:         event,
+		Status:        models.DeliveryPending,
+		NextAttemptAt: time.Now().Add(retryAfter),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(Payload{
+		ID:        delivery.ID,
+		Event:     event,
+		CreatedAt: delivery.CreatedAt,
+		Data:      data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	delivery.Payload = string(body)
+	return delivery, models.WebhookDeliveries.Update(delivery)
+}
+
+// Sign returns the signature header for a body: an HMAC-SHA256 of the
+// timestamp, a dot and the body, keyed with the hook's secret
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Attempt sends a delivery once and records the outcome: delivered on a
+// 2xx, otherwise scheduled for its next retry or, out of retries, failed
+func Attempt(hook *models.Webhook, delivery *models.WebhookDelivery) error {
+	start := time.Now()
+	status, body, err := send(hook, delivery)
+
+	delivery.Attempts++
+	delivery.ResponseCode = status
+	delivery.ResponseBody = body
+	delivery.DurationMS = int(time.Since(start).Milliseconds())
+	delivery.Error = ""
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliveryDelivered
+		hook.Failures = 0
+	case delivery.Attempts <= len(models.DeliveryRetries):
+		delivery.Status = models.DeliveryPending
+		delivery.NextAttemptAt = time.Now().Add(models.DeliveryRetries[delivery.Attempts-1])
+	default:
+		delivery.Status = models.DeliveryFailed
+		hook.Failures++
+		if hook.Failures >= models.WebhookDisableAfter {
+			hook.Disabled = true
+			slog.Warn("webhook disabled after repeated failures", "webhook_id", hook.ID)
+		}
+	}
+	if updateErr := models.WebhookDeliveries.Update(delivery); updateErr != nil {
+		slog.Error("failed to save webhook delivery", "delivery_id", delivery.ID, "error", updateErr)
+	}
+
+	hook.LastStatus = status
+	hook.LastAttemptAt = time.Now()
+	models.Webhooks.Update(hook)
+	return err
+}
+
+// send posts the delivery's payload, returning the response status and
+// the start of its body
+func send(hook *models.Webhook, delivery *models.WebhookDelivery) (int, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Skyscape-Webhooks/1.0")
+	req.Header.Set("X-Skyscape-Event", delivery.Event)
+	req.Header.Set("X-Skyscape-Delivery", delivery.ID)
+	req.Header.Set("X-Skyscape-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Skyscape-Signature", Sign(hook.Secret(), timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(data), errors.Errorf("responded with %s", resp.Status)
+	}
+	return resp.StatusCode, string(data), nil
+}
+
+// Run retries due deliveries on an interval
+func Run(interval time.Duration) {
+	for range time.Tick(interval) {
+		Retry()
+	}
+}
+
+// Retry attempts every pending delivery that's due, oldest first
+func Retry() {
+	due, err := models.WebhookDeliveries.Search(`
+		WHERE Status = ? AND NextAttemptAt <= ?
+		ORDER BY NextAttemptAt ASC
+		LIMIT 100
+	`, models.DeliveryPending, time.Now())
+	if err != nil {
+		slog.Error("failed to load webhook deliveries", "error", err)
+		return
+	}
+
+	for _, delivery := range due {
+		hook, err := models.Webhooks.Get(delivery.WebhookID)
+		if err != nil || hook.Disabled {
+			delivery.Status = models.DeliveryFailed
+			delivery.Error = "webhook removed or disabled"
+			models.WebhookDeliveries.Update(delivery)
+			continue
+		}
+		Attempt(hook, delivery)
+	}
+}
+
+// Redeliver sends a past delivery's payload again as a new delivery, with
+// its own retries, and returns it
+func Redeliver(hook *models.Webhook, past *models.WebhookDelivery) (*models.WebhookDelivery, error) {
+	delivery, err := models.WebhookDeliveries.Insert(&models.WebhookDelivery{
+		WebhookID:     hook.ID,
+		Event:         past.Event,
+		Payload:       past.Payload,
+		Status:        models.DeliveryPending,
+		NextAttemptAt: time.Now().Add(retryAfter),
+	})
+	if err != nil {
+		return nil, err
+	}
+	Attempt(hook, delivery)
+	return delivery, nil
+}
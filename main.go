@@ -1,14 +1,19 @@
 package main
 
 import (
+	"cmp"
 	"embed"
 	"html/template"
-	"log"
+	"log/slog"
 	"os"
 	"time"
 
 	"github.com/The-Skyscape/devtools/pkg/application"
 	"www.theskyscape.com/controllers"
+	"www.theskyscape.com/internal/assets"
+	"www.theskyscape.com/internal/emailpreview"
+	"www.theskyscape.com/internal/logging"
+	"www.theskyscape.com/internal/tracing"
 	"www.theskyscape.com/models"
 )
 
@@ -25,15 +30,27 @@ func init() {
 	var err error
 	appTimezone, err = time.LoadLocation("America/Los_Angeles")
 	if err != nil {
-		log.Fatal("Failed to load app timezone:", err)
+		slog.Error("failed to load app timezone", "error", err)
+		os.Exit(1)
 	}
 }
 
 func main() {
+	logging.Setup()
+	tracing.Setup()
+
+	// Fingerprint static assets, served from the CDN when one is configured
+	if err := assets.Load(views, cmp.Or(os.Getenv("ASSET_CDN_URL"), os.Getenv("PREFIX"))); err != nil {
+		slog.Error("failed to load assets", "error", err)
+		os.Exit(1)
+	}
+
 	// Load email templates synchronously before server starts
 	if err := models.Emails.LoadTemplates(emails); err != nil {
-		log.Fatal("Failed to load email templates:", err)
+		slog.Error("failed to load email templates", "error", err)
+		os.Exit(1)
 	}
+	emailpreview.Load(emails)
 
 	_, auth := controllers.Auth()
 	application.Serve(views,
@@ -41,6 +58,7 @@ func main() {
 		application.WithHostPrefix(os.Getenv("PREFIX")),
 		application.WithPublicAccess(auth.Optional),
 		application.WithFunc("format", format),
+		application.WithFunc("asset", assets.URL),
 		application.WithFunc("now", func() time.Time { return time.Now() }),
 		application.WithFunc("safeHTML", func(s string) template.HTML { return template.HTML(s) }),
 		application.WithController("auth", auth),
@@ -55,6 +73,7 @@ func main() {
 		application.WithController(controllers.Reactions()),
 		application.WithController(controllers.Follows()),
 		application.WithController(controllers.Stars()),
+		application.WithController(controllers.Promotions()),
 		application.WithController(controllers.Messages()),
 		application.WithController(controllers.SEO()),
 		application.WithController(controllers.OAuth()),
@@ -63,6 +82,23 @@ func main() {
 		application.WithController(controllers.Thoughts()),
 		application.WithController(controllers.Payments()),
 		application.WithController(controllers.Projects()),
+		application.WithController(controllers.Admin()),
+		application.WithController(controllers.Suspensions()),
+		application.WithController(controllers.Takedowns()),
+		application.WithController(controllers.Audit()),
+		application.WithController(controllers.Announcements()),
+		application.WithController(controllers.Broadcasts()),
+		application.WithController(controllers.Invites()),
+		application.WithController(controllers.Search()),
+		application.WithController(controllers.Events()),
+		application.WithController(controllers.I18n()),
+		application.WithController(controllers.Settings()),
+		application.WithController(controllers.Webhooks()),
+		application.WithController(controllers.Domains()),
+		application.WithController(controllers.Editor()),
+		application.WithController(controllers.Security()),
+		application.WithController(controllers.Status()),
+		application.WithController(controllers.Widgets()),
 	)
 }
 
@@ -1,23 +1,64 @@
 package models
 
 import (
+	"time"
+
 	"github.com/The-Skyscape/devtools/pkg/application"
 	"github.com/The-Skyscape/devtools/pkg/authentication"
 )
 
 type Activity struct {
 	application.Model
-	UserID      string
-	Action      string
-	SubjectType string
-	SubjectID   string
-	Content     string
-	FileID      string
+	UserID       string
+	Action       string
+	SubjectType  string
+	SubjectID    string
+	Content      string
+	FileID       string
+	Visibility   string     // One of PostVisibilities (empty is public)
+	CommentTotal int        // Cached comment count, see CountComment
+	DeletedAt    *time.Time // Set while the post is a tombstone, see SoftDelete
+	DeletedBy    string     // The author, or the admin who removed it
+
+	preload *activityPreload // Set by PreloadActivities
 }
 
 func (*Activity) Table() string { return "activities" }
 
+// Post visibilities. Followers-only posts are shown to the author's
+// followers; unlisted posts stay off the public feed, tag pages and search
+// but are visible on the author's profile and by link.
+const (
+	PostPublic    = "public"
+	PostFollowers = "followers"
+	PostUnlisted  = "unlisted"
+)
+
+// PostVisibilities lists every post visibility
+var PostVisibilities = []string{PostPublic, PostFollowers, PostUnlisted}
+
+// PublicActivities is a WHERE clause matching activities anyone may see in
+// public listings
+const PublicActivities = `Visibility IN ('', 'public')`
+
+// IsPublic returns true if the activity can appear in public listings
+func (a *Activity) IsPublic() bool {
+	return a.Visibility == "" || a.Visibility == PostPublic
+}
+
+// VisibleTo returns true if a user can see the activity; userID is empty
+// for signed out visitors
+func (a *Activity) VisibleTo(userID string) bool {
+	if a.Visibility != PostFollowers || a.UserID == userID {
+		return true
+	}
+	return userID != "" && Follows.Count("WHERE FollowerID = ? AND FolloweeID = ?", userID, a.UserID) > 0
+}
+
 func (a *Activity) User() *authentication.User {
+	if a.preload != nil {
+		return a.preload.user
+	}
 	user, err := Auth.Users.Get(a.UserID)
 	if err != nil {
 		return nil
@@ -28,6 +69,9 @@ func (a *Activity) User() *authentication.User {
 
 // UserProfile returns the profile of the user who created this activity
 func (a *Activity) UserProfile() *Profile {
+	if a.preload != nil {
+		return a.preload.profile
+	}
 	profile, err := Profiles.First("WHERE UserID = ?", a.UserID)
 	if err != nil {
 		return nil
@@ -40,6 +84,10 @@ func (a *Activity) Profile() *Profile {
 	if a.SubjectType != "profile" {
 		return nil
 	}
+	if a.preload != nil {
+		profile, _ := a.preload.subject.(*Profile)
+		return profile
+	}
 	profile, err := Profiles.Get(a.SubjectID)
 	if err != nil {
 		return nil
@@ -53,6 +101,10 @@ func (a *Activity) Repo() *Repo {
 	if a.SubjectType != "" && a.SubjectType != "repo" {
 		return nil
 	}
+	if a.preload != nil {
+		repo, _ := a.preload.subject.(*Repo)
+		return repo
+	}
 	repo, err := Repos.Get(a.SubjectID)
 	if err != nil {
 		return nil
@@ -66,6 +118,10 @@ func (a *Activity) App() *App {
 	if a.SubjectType != "app" {
 		return nil
 	}
+	if a.preload != nil {
+		app, _ := a.preload.subject.(*App)
+		return app
+	}
 	app, err := Apps.Get(a.SubjectID)
 	if err != nil {
 		return nil
@@ -79,6 +135,10 @@ func (a *Activity) Project() *Project {
 	if a.SubjectType != "project" {
 		return nil
 	}
+	if a.preload != nil {
+		project, _ := a.preload.subject.(*Project)
+		return project
+	}
 	project, err := Projects.Get(a.SubjectID)
 	if err != nil {
 		return nil
@@ -92,6 +152,10 @@ func (a *Activity) Thought() *Thought {
 	if a.SubjectType != "thought" {
 		return nil
 	}
+	if a.preload != nil {
+		thought, _ := a.preload.subject.(*Thought)
+		return thought
+	}
 	thought, err := Thoughts.Get(a.SubjectID)
 	if err != nil {
 		return nil
@@ -104,6 +168,9 @@ func (a *Activity) File() *File {
 	if a.FileID == "" {
 		return nil
 	}
+	if a.preload != nil {
+		return a.preload.file
+	}
 	file, err := Files.Get(a.FileID)
 	if err != nil {
 		return nil
@@ -111,23 +178,46 @@ func (a *Activity) File() *File {
 	return file
 }
 
+// Takedown returns the active takedown for this post or the content it
+// shares, so removed content doesn't resurface through the feed
+func (a *Activity) Takedown() *Takedown {
+	if a.preload != nil {
+		return a.preload.takedown
+	}
+	if t := ActiveTakedown(TakedownPost, a.ID); t != nil {
+		return t
+	}
+
+	switch a.SubjectType {
+	case TakedownThought, TakedownRepo, TakedownProject, TakedownApp:
+		return ActiveTakedown(a.SubjectType, a.SubjectID)
+	}
+	return nil
+}
+
 // Comments returns comments on this activity/post (max 100)
 func (a *Activity) Comments() []*Comment {
+	if a.preload != nil {
+		return a.preload.comments
+	}
 	comments, _ := Comments.Search(`
-		WHERE SubjectID = ?
+		WHERE SubjectType = ? AND SubjectID = ?
 		ORDER BY CreatedAt ASC
 		LIMIT 100
-	`, a.ID)
+	`, CommentPost, a.ID)
 	return comments
 }
 
 // CommentsCount returns the number of comments on this activity/post
 func (a *Activity) CommentsCount() int {
-	return Comments.Count("WHERE SubjectID = ?", a.ID)
+	return a.CommentTotal
 }
 
 // Reactions returns reactions on this activity/post (max 500)
 func (a *Activity) Reactions() []*Reaction {
+	if a.preload != nil {
+		return a.preload.reactions
+	}
 	reactions, _ := Reactions.Search(`
 		WHERE ActivityID = ?
 		LIMIT 500
@@ -146,6 +236,14 @@ func (a *Activity) ReactionCounts() map[string]int {
 
 // UserReaction returns the current user's reaction on this activity, if any
 func (a *Activity) UserReaction(userID string) *Reaction {
+	if a.preload != nil {
+		for _, r := range a.preload.reactions {
+			if r.UserID == userID {
+				return r
+			}
+		}
+		return nil
+	}
 	reaction, _ := Reactions.First("WHERE ActivityID = ? AND UserID = ?", a.ID, userID)
 	return reaction
 }
@@ -154,3 +252,8 @@ func (a *Activity) UserReaction(userID string) *Reaction {
 func (a *Activity) HasReactions() bool {
 	return len(a.Reactions()) > 0
 }
+
+// Cursor returns the token for paging past this activity
+func (a *Activity) Cursor() string {
+	return EncodeCursor(a.CreatedAt, a.ID)
+}
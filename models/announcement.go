@@ -0,0 +1,74 @@
+package models
+
+import (
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/The-Skyscape/devtools/pkg/authentication"
+)
+
+// Announcement audiences
+const (
+	AudienceAll      = "all"
+	AudienceSignedIn = "signed_in"
+	AudienceVerified = "verified"
+)
+
+// Announcement is a site-wide banner shown in the layout between StartsAt
+// and EndsAt (zero EndsAt means until deleted)
+type Announcement struct {
+	application.Model
+	CreatedBy string
+	Message   string
+	Link      string // Optional "learn more" URL
+	Level     string // "info", "warning", "success"
+	Audience  string // "all", "signed_in", "verified"
+	StartsAt  time.Time
+	EndsAt    time.Time
+}
+
+func (*Announcement) Table() string { return "announcements" }
+
+// IsLive returns true if the announcement is within its schedule
+func (a *Announcement) IsLive() bool {
+	now := time.Now()
+	return !now.Before(a.StartsAt) && (a.EndsAt.IsZero() || now.Before(a.EndsAt))
+}
+
+// IsScheduled returns true if the announcement hasn't started yet
+func (a *Announcement) IsScheduled() bool {
+	return time.Now().Before(a.StartsAt)
+}
+
+// IsVisibleTo returns true if the user is in the announcement's audience
+func (a *Announcement) IsVisibleTo(user *authentication.User) bool {
+	switch a.Audience {
+	case AudienceSignedIn:
+		return user != nil
+	case AudienceVerified:
+		if user == nil {
+			return false
+		}
+		profile, err := Profiles.Get(user.ID)
+		return err == nil && profile.Verified
+	default:
+		return true
+	}
+}
+
+// LiveAnnouncements returns announcements currently within their schedule
+func LiveAnnouncements() []*Announcement {
+	announcements, _ := Announcements.Search(`
+		WHERE StartsAt <= ?
+		ORDER BY StartsAt DESC
+		LIMIT 50
+	`, time.Now())
+
+	var live []*Announcement
+	for _, a := range announcements {
+		if a.IsLive() {
+			live = append(live, a)
+		}
+	}
+	return live
+}
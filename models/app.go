@@ -18,6 +18,11 @@ type App struct {
 	Error             string
 	OAuthClientSecret string // bcrypt hashed
 	DatabaseEnabled   bool   // Whether app has database provisioned
+	AnalyticsEnabled  bool   // Opted in to visitor analytics, see internal/analytics
+	StarTotal         int    // Cached star count, see CountStar
+	Category          string // One of AppCategories, for browsing the directory
+	EditorsPick       bool   // Featured by an admin at the top of the directory
+	PickedAt          time.Time
 }
 
 func (*App) Table() string { return "apps" }
@@ -37,6 +42,11 @@ func NewApp(id, repoID, name, description string, databaseEnabled bool) (*App, e
 	return Apps.Insert(app)
 }
 
+// Takedown returns the active takedown for this app, if any
+func (a *App) Takedown() *Takedown {
+	return ActiveTakedown(TakedownApp, a.ID)
+}
+
 func (a *App) Repo() *Repo {
 	repo, err := Repos.Get(a.RepoID)
 	if err != nil {
@@ -55,6 +65,18 @@ func (a *App) Owner() *authentication.User {
 	return repo.Owner()
 }
 
+func (a *App) StarsCount() int {
+	return a.StarTotal
+}
+
+func (a *App) RecentStargazers(limit int) []*Star {
+	return RecentStars(StarApp, a.ID, limit)
+}
+
+func (a *App) IsStarredBy(userID string) bool {
+	return IsStarred(userID, StarApp, a.ID)
+}
+
 func (a *App) RedirectURI() string {
 	return fmt.Sprintf("https://%s.skysca.pe/auth/callback", a.ID)
 }
@@ -100,11 +122,24 @@ func (app *App) Images() []*Image {
 
 func (a *App) Comments(limit, offset int) []*Comment {
 	comments, _ := Comments.Search(`
-		WHERE SubjectID = ?
+		WHERE SubjectType = ? AND SubjectID = ?
 			AND Content != ''
 		ORDER BY CreatedAt DESC
 		LIMIT ? OFFSET ?
-	`, a.ID, limit, offset)
+	`, CommentApp, a.ID, limit, offset)
+	return comments
+}
+
+// CommentsBefore returns the page of comments that follows the cursor
+func (a *App) CommentsBefore(cursor *Cursor, limit int) []*Comment {
+	before, args := cursor.Before("")
+	comments, _ := Comments.Search(`
+		WHERE SubjectType = ? AND SubjectID = ?
+			AND Content != ''
+			AND `+before+`
+		ORDER BY CreatedAt DESC, ID DESC
+		LIMIT ?
+	`, append(append([]any{CommentApp, a.ID}, args...), limit)...)
 	return comments
 }
 
@@ -0,0 +1,208 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/The-Skyscape/devtools/pkg/authentication"
+)
+
+// MaxReviewLength bounds a review or the owner's response to one
+const MaxReviewLength = 2000
+
+// ReviewReportThreshold is how many people must report a review before
+// it's hidden, pending an admin's decision
+const ReviewReportThreshold = 3
+
+// AppReview is a star rating, with optional text, from someone who has
+// authorized the app. Each user has at most one per app, which they can
+// edit, and the app's owner can respond to it publicly.
+type AppReview struct {
+	application.Model
+	AppID       string
+	UserID      string
+	Rating      int // 1 to 5
+	Body        string
+	Response    string // The owner's reply
+	RespondedAt time.Time
+	Hidden      bool // Hidden by reports or an admin
+	Flagged     bool // Has reports waiting on an admin
+	Kept        bool // An admin decided it stays up despite reports
+}
+
+func (*AppReview) Table() string { return "app_reviews" }
+
+// AppReviewReport is someone flagging a review as abusive
+type AppReviewReport struct {
+	application.Model
+	ReviewID string
+	UserID   string
+	Reason   string
+}
+
+func (*AppReviewReport) Table() string { return "app_review_reports" }
+
+// AppRating summarizes an app's visible reviews
+type AppRating struct {
+	Average float64
+	Count   int
+}
+
+// Stars renders the average rounded to the nearest star, e.g. "★★★★☆"
+func (r *AppRating) Stars() string {
+	return stars(int(r.Average + 0.5))
+}
+
+// User returns the reviewer
+func (r *AppReview) User() *authentication.User {
+	user, _ := Auth.Users.Get(r.UserID)
+	return user
+}
+
+// App returns the reviewed app
+func (r *AppReview) App() *App {
+	app, _ := Apps.Get(r.AppID)
+	return app
+}
+
+// Stars renders the rating, e.g. "★★★★☆"
+func (r *AppReview) Stars() string {
+	return stars(r.Rating)
+}
+
+func stars(n int) string {
+	n = min(max(n, 0), 5)
+	return strings.Repeat("★", n) + strings.Repeat("☆", 5-n)
+}
+
+// ReportsCount returns how many people have reported the review
+func (r *AppReview) ReportsCount() int {
+	return AppReviewReports.Count("WHERE ReviewID = ?", r.ID)
+}
+
+// Reports returns the reports against the review, oldest first
+func (r *AppReview) Reports() []*AppReviewReport {
+	reports, _ := AppReviewReports.Search("WHERE ReviewID = ? ORDER BY CreatedAt", r.ID)
+	return reports
+}
+
+// User returns who made the report
+func (r *AppReviewReport) User() *authentication.User {
+	user, _ := Auth.Users.Get(r.UserID)
+	return user
+}
+
+// Rating returns the app's average rating across visible reviews
+func (a *App) Rating() *AppRating {
+	rating := &AppRating{}
+	DB.Query(`
+		SELECT COALESCE(AVG(Rating), 0), COUNT(*) FROM app_reviews
+		WHERE AppID = ? AND Hidden = false
+	`, a.ID).Scan(&rating.Average, &rating.Count)
+	return rating
+}
+
+// Reviews returns the app's visible reviews, newest first
+func (a *App) Reviews(limit int) []*AppReview {
+	reviews, _ := AppReviews.Search(`
+		WHERE AppID = ? AND Hidden = false
+		ORDER BY CreatedAt DESC
+		LIMIT ?
+	`, a.ID, limit)
+	return reviews
+}
+
+// ReviewBy returns the user's review of the app, or nil
+func (a *App) ReviewBy(userID string) *AppReview {
+	review, err := AppReviews.First("WHERE AppID = ? AND UserID = ?", a.ID, userID)
+	if err != nil {
+		return nil
+	}
+	return review
+}
+
+// IsAuthorizedBy reports whether the user has signed in to the app
+func (a *App) IsAuthorizedBy(userID string) bool {
+	return OAuthAuthorizations.Count("WHERE AppID = ? AND UserID = ? AND Revoked = false", a.ID, userID) > 0
+}
+
+// Review saves the user's rating of the app, replacing any earlier one.
+// Only people who have used the app can review it.
+func (a *App) Review(userID string, rating int, body string) (*AppReview, error) {
+	if rating < 1 || rating > 5 {
+		return nil, errors.New("rating must be between 1 and 5 stars")
+	}
+	if len(body) > MaxReviewLength {
+		return nil, errors.New("review must be 2000 characters or less")
+	}
+	if !a.IsAuthorizedBy(userID) {
+		return nil, errors.New("only people who use this app can review it")
+	}
+
+	if review := a.ReviewBy(userID); review != nil {
+		review.Rating = rating
+		review.Body = body
+		return review, AppReviews.Update(review)
+	}
+	return AppReviews.Insert(&AppReview{
+		AppID:  a.ID,
+		UserID: userID,
+		Rating: rating,
+		Body:   body,
+	})
+}
+
+// Respond sets the owner's public reply, or clears it when empty
+func (r *AppReview) Respond(response string) error {
+	if len(response) > MaxReviewLength {
+		return errors.New("response must be 2000 characters or less")
+	}
+	r.Response = response
+	r.RespondedAt = time.Now()
+	return AppReviews.Update(r)
+}
+
+// Report flags the review for admins, hiding it once enough people have.
+// A review an admin has already kept goes back in the queue but stays up.
+func (r *AppReview) Report(userID, reason string) error {
+	if r.UserID == userID {
+		return errors.New("you cannot report your own review")
+	}
+	if AppReviewReports.Count("WHERE ReviewID = ? AND UserID = ?", r.ID, userID) > 0 {
+		return errors.New("you have already reported this review")
+	}
+	if _, err := AppReviewReports.Insert(&AppReviewReport{
+		ReviewID: r.ID,
+		UserID:   userID,
+		Reason:   reason,
+	}); err != nil {
+		return err
+	}
+
+	r.Flagged = true
+	if !r.Kept && r.ReportsCount() >= ReviewReportThreshold {
+		r.Hidden = true
+	}
+	return AppReviews.Update(r)
+}
+
+// Moderate records an admin's decision on a reported review
+func (r *AppReview) Moderate(hidden bool) error {
+	r.Hidden = hidden
+	r.Kept = !hidden
+	r.Flagged = false
+	return AppReviews.Update(r)
+}
+
+// ReportedReviews returns reviews with reports an admin hasn't looked at,
+// hidden ones first
+func ReportedReviews() []*AppReview {
+	reviews, _ := AppReviews.Search(`
+		WHERE Flagged = true
+		ORDER BY Hidden DESC, UpdatedAt DESC
+		LIMIT 100
+	`)
+	return reviews
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+)
+
+// AppCategory is a section of the app directory
+type AppCategory struct {
+	Slug string // Stored in App.Category and used in /apps?category=
+	Name string
+}
+
+// AppCategories are the sections apps can be listed under
+var AppCategories = []AppCategory{
+	{"productivity", "Productivity"},
+	{"developer-tools", "Developer Tools"},
+	{"social", "Social"},
+	{"games", "Games"},
+	{"education", "Education"},
+	{"finance", "Finance"},
+	{"media", "Media"},
+	{"utilities", "Utilities"},
+}
+
+// IsAppCategory reports whether slug is one of AppCategories
+func IsAppCategory(slug string) bool {
+	for _, category := range AppCategories {
+		if category.Slug == slug {
+			return true
+		}
+	}
+	return false
+}
+
+// CategoryName returns the display name of the app's category, or "" if
+// it has none
+func (a *App) CategoryName() string {
+	for _, category := range AppCategories {
+		if category.Slug == a.Category {
+			return category.Name
+		}
+	}
+	return ""
+}
+
+// MaxAppScreenshots bounds an app's gallery
+const MaxAppScreenshots = 6
+
+// AppScreenshot is an image in an app's gallery on its directory page
+type AppScreenshot struct {
+	application.Model
+	AppID    string
+	FileID   string
+	Caption  string
+	Position int // Order in the gallery, lowest first
+}
+
+func (*AppScreenshot) Table() string { return "app_screenshots" }
+
+// URL returns where the screenshot image is served
+func (s *AppScreenshot) URL() string {
+	return "/file/" + s.FileID
+}
+
+// Screenshots returns the app's gallery in order
+func (a *App) Screenshots() []*AppScreenshot {
+	screenshots, _ := AppScreenshots.Search("WHERE AppID = ? ORDER BY Position, CreatedAt", a.ID)
+	return screenshots
+}
+
+// AddScreenshot appends an uploaded image to the app's gallery
+func (a *App) AddScreenshot(fileID, caption string) (*AppScreenshot, error) {
+	return AppScreenshots.Insert(&AppScreenshot{
+		AppID:    a.ID,
+		FileID:   fileID,
+		Caption:  caption,
+		Position: AppScreenshots.Count("WHERE AppID = ?", a.ID),
+	})
+}
+
+// SetEditorsPick features or unfeatures the app in the directory
+func (a *App) SetEditorsPick(picked bool) error {
+	a.EditorsPick = picked
+	a.PickedAt = time.Time{}
+	if picked {
+		a.PickedAt = time.Now()
+	}
+	return Apps.Update(a)
+}
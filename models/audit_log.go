@@ -0,0 +1,147 @@
+package models
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/The-Skyscape/devtools/pkg/authentication"
+)
+
+// Audited actions, grouped by the prefix before the dot
+const (
+	AuditPasswordChanged      = "auth.password_changed"
+	AuditTwoFactorEnabled     = "auth.2fa_enabled"
+	AuditTwoFactorDisabled    = "auth.2fa_disabled"
+	AuditRecoveryCodesReset   = "auth.recovery_codes_reset"
+	AuditPasskeyAdded         = "auth.passkey_added"
+	AuditPasskeyRemoved       = "auth.passkey_removed"
+	AuditSSHKeyAdded          = "auth.ssh_key_added"
+	AuditSSHKeyRemoved        = "auth.ssh_key_removed"
+	AuditSocialConnected      = "auth.social_connected"
+	AuditSocialDisconnected   = "auth.social_disconnected"
+	AuditSessionsRevoked      = "auth.sessions_revoked"
+	AuditAuthorizationRevoked = "auth.authorization_revoked"
+	AuditDeviceAuthorized     = "auth.device_authorized"
+	AuditAccountLocked        = "auth.account_locked"
+
+	AuditOAuthSecretRegenerated = "app.oauth_secret_regenerated"
+	AuditAppShutdown            = "app.shutdown"
+	AuditProjectShutdown        = "project.shutdown"
+	AuditServiceTokenRotated    = "project.service_token_rotated"
+
+	AuditAppRenamed           = "admin.app_renamed"
+	AuditProjectRenamed       = "admin.project_renamed"
+	AuditProjectRestarted     = "admin.project_restarted"
+	AuditBuildCancelled       = "admin.build_cancelled"
+	AuditUserSuspended        = "admin.user_suspended"
+	AuditSuspensionLifted     = "admin.suspension_lifted"
+	AuditAppealReviewed       = "admin.appeal_reviewed"
+	AuditTakedown             = "admin.takedown"
+	AuditTakedownRestored     = "admin.takedown_restored"
+	AuditEditorsPick          = "admin.editors_pick"
+	AuditImpersonationStarted = "admin.impersonation_started"
+	AuditImpersonationEnded   = "admin.impersonation_ended"
+	AuditReviewModerated      = "admin.review_moderated"
+	AuditSigningKeyRotated    = "admin.signing_key_rotated"
+)
+
+// AuditActions lists every audited action, for filtering the log
+var AuditActions = []string{
+	AuditPasswordChanged, AuditTwoFactorEnabled, AuditTwoFactorDisabled,
+	AuditRecoveryCodesReset, AuditPasskeyAdded, AuditPasskeyRemoved,
+	AuditSSHKeyAdded, AuditSSHKeyRemoved, AuditSocialConnected,
+	AuditSocialDisconnected, AuditSessionsRevoked, AuditAuthorizationRevoked,
+	AuditDeviceAuthorized, AuditAccountLocked,
+	AuditOAuthSecretRegenerated, AuditAppShutdown, AuditProjectShutdown,
+	AuditServiceTokenRotated,
+	AuditAppRenamed, AuditProjectRenamed, AuditProjectRestarted,
+	AuditBuildCancelled, AuditUserSuspended, AuditSuspensionLifted,
+	AuditAppealReviewed, AuditTakedown, AuditTakedownRestored,
+	AuditEditorsPick, AuditImpersonationStarted, AuditImpersonationEnded,
+	AuditReviewModerated, AuditSigningKeyRotated,
+}
+
+// AuditLog records a sensitive operation: who did it, from where, and what
+// it was done to. Entries are only ever inserted.
+type AuditLog struct {
+	application.Model
+	ActorID    string // User who did it, empty for unauthenticated requests
+	Action     string // One of the Audit constants
+	TargetType string // e.g. "user", "app", "project"
+	TargetID   string
+	IP         string
+	Detail     string // Anything else worth knowing, e.g. a new ID
+}
+
+func (*AuditLog) Table() string { return "audit_logs" }
+
+// Actor returns the user who performed the action
+func (l *AuditLog) Actor() *authentication.User {
+	if l.ActorID == "" {
+		return nil
+	}
+	user, _ := Auth.Users.Get(l.ActorID)
+	return user
+}
+
+// Category returns the group an action belongs to, e.g. "auth"
+func (l *AuditLog) Category() string {
+	category, _, _ := strings.Cut(l.Action, ".")
+	return category
+}
+
+// Cursor returns the token for loading entries older than this one
+func (l *AuditLog) Cursor() string {
+	return EncodeCursor(l.CreatedAt, l.ID)
+}
+
+// RecordAudit saves an audit entry. Failing to record doesn't fail the
+// action itself, so errors are only logged.
+func RecordAudit(entry *AuditLog) {
+	if _, err := AuditLogs.Insert(entry); err != nil {
+		slog.Error("failed to record audit log", "action", entry.Action, "target", entry.TargetID, "error", err)
+	}
+}
+
+// AuditFilter narrows the audit log. Empty fields match everything.
+type AuditFilter struct {
+	Action   string // An action, or a category like "admin"
+	ActorID  string
+	TargetID string
+	Before   *Cursor
+	Limit    int
+}
+
+// SearchAuditLogs returns matching entries, newest first
+func SearchAuditLogs(f AuditFilter) []*AuditLog {
+	conditions := []string{"1 = 1"}
+	var args []any
+	if f.Action != "" {
+		if strings.Contains(f.Action, ".") {
+			conditions = append(conditions, "Action = ?")
+			args = append(args, f.Action)
+		} else {
+			conditions = append(conditions, "Action LIKE ?")
+			args = append(args, f.Action+".%")
+		}
+	}
+	if f.ActorID != "" {
+		conditions = append(conditions, "ActorID = ?")
+		args = append(args, f.ActorID)
+	}
+	if f.TargetID != "" {
+		conditions = append(conditions, "TargetID = ?")
+		args = append(args, f.TargetID)
+	}
+	before, beforeArgs := f.Before.Before("")
+	conditions = append(conditions, before)
+	args = append(args, beforeArgs...)
+
+	entries, _ := AuditLogs.Search(`
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY CreatedAt DESC, ID DESC
+		LIMIT ?
+	`, append(args, f.Limit)...)
+	return entries
+}
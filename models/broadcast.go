@@ -0,0 +1,144 @@
+package models
+
+import (
+	"html/template"
+	"log/slog"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/The-Skyscape/devtools/pkg/authentication"
+	"github.com/The-Skyscape/devtools/pkg/emailing"
+	"github.com/pkg/errors"
+	"www.theskyscape.com/internal/i18n"
+	"www.theskyscape.com/internal/markup"
+)
+
+// Broadcast audiences
+const (
+	BroadcastAll      = "all"
+	BroadcastVerified = "verified"
+	BroadcastDeployed = "deployed" // Users with at least one online app
+)
+
+// Broadcast statuses
+const (
+	BroadcastSending = "sending"
+	BroadcastSent    = "sent"
+	BroadcastFailed  = "failed"
+)
+
+// Broadcast sending limits keep us under the email provider's rate limits
+const (
+	broadcastBatchSize  = 50
+	broadcastBatchDelay = 10 * time.Second
+)
+
+// Broadcast is an admin-composed email sent to an audience of users
+type Broadcast struct {
+	application.Model
+	CreatedBy    string
+	Subject      string
+	Body         string // Markdown
+	Audience     string // "all", "verified", "deployed"
+	Status       string // "sending", "sent", "failed"
+	SentCount    int
+	SkippedCount int // Unsubscribed users
+	FailedCount  int
+	FinishedAt   time.Time
+}
+
+func (*Broadcast) Table() string { return "broadcasts" }
+
+// Author returns the admin who composed the broadcast
+func (b *Broadcast) Author() *authentication.User {
+	user, _ := Auth.Users.Get(b.CreatedBy)
+	return user
+}
+
+// HTML renders the markdown body
+func (b *Broadcast) HTML() template.HTML {
+	return markup.RenderMarkdown(b.Body)
+}
+
+// BroadcastRecipients returns the profiles in an audience, excluding
+// suspended users. Unsubscribed users are included so they can be counted.
+func BroadcastRecipients(audience string) ([]*Profile, error) {
+	switch audience {
+	case BroadcastAll:
+		return Profiles.Search("WHERE Suspended = false ORDER BY CreatedAt")
+	case BroadcastVerified:
+		return Profiles.Search("WHERE Suspended = false AND Verified = true ORDER BY CreatedAt")
+	case BroadcastDeployed:
+		return Profiles.Search(`
+			WHERE Suspended = false AND (
+				UserID IN (SELECT OwnerID FROM projects WHERE Status = 'online')
+				OR UserID IN (
+					SELECT repos.OwnerID FROM apps
+					JOIN repos ON repos.ID = apps.RepoID
+					WHERE apps.Status = 'online'
+				)
+			)
+			ORDER BY CreatedAt
+		`)
+	default:
+		return nil, errors.New("unknown audience")
+	}
+}
+
+// Send delivers the broadcast in throttled batches, honoring unsubscribes.
+// It blocks until every batch is sent, so callers should run it in the
+// background.
+func (b *Broadcast) Send() {
+	recipients, err := BroadcastRecipients(b.Audience)
+	if err != nil {
+		slog.Error("failed to load broadcast recipients", "broadcast_id", b.ID, "error", err)
+		b.Status = BroadcastFailed
+		Broadcasts.Update(b)
+		return
+	}
+
+	body := b.HTML()
+	for i, profile := range recipients {
+		if i > 0 && i%broadcastBatchSize == 0 {
+			Broadcasts.Update(b) // Persist progress between batches
+			time.Sleep(broadcastBatchDelay)
+		}
+
+		if profile.EmailOptOut {
+			b.SkippedCount++
+			continue
+		}
+
+		user := profile.User()
+		if user == nil || user.Email == "" {
+			b.SkippedCount++
+			continue
+		}
+
+		if err := b.SendTo(user, body, profile.UnsubscribeURL()); err != nil {
+			slog.Error("failed to send broadcast", "broadcast_id", b.ID, "handle", user.Handle, "error", err)
+			b.FailedCount++
+			continue
+		}
+		b.SentCount++
+	}
+
+	b.Status = BroadcastSent
+	b.FinishedAt = time.Now()
+	Broadcasts.Update(b)
+	slog.Info("finished broadcast", "broadcast_id", b.ID, "sent", b.SentCount, "skipped", b.SkippedCount, "failed", b.FailedCount)
+}
+
+// SendTo emails the broadcast to a single user
+func (b *Broadcast) SendTo(user *authentication.User, body template.HTML, unsubscribeURL string) error {
+	return SendEmail(user.Email,
+		b.Subject,
+		"broadcast.html",
+		emailing.WithData("t", i18n.For(EmailLocale(user.ID))),
+		emailing.WithData("Title", b.Subject),
+		emailing.WithData("user", user),
+		emailing.WithData("body", body),
+		emailing.WithData("unsubscribe", unsubscribeURL),
+		emailing.WithData("year", time.Now().Year()),
+	)
+}
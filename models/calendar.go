@@ -0,0 +1,61 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+	"www.theskyscape.com/internal/ical"
+)
+
+// CalendarURL returns the user's private calendar feed link, creating
+// its token the first time
+func (p *Profile) CalendarURL() (string, error) {
+	if p.CalendarToken == "" {
+		if err := p.ResetCalendarToken(); err != nil {
+			return "", err
+		}
+	}
+	return siteURL + "/calendar.ics?user=" + p.UserID + "&token=" + p.CalendarToken, nil
+}
+
+// ResetCalendarToken replaces the calendar token, breaking any
+// subscriptions to the old link
+func (p *Profile) ResetCalendarToken() error {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return errors.Wrap(err, "failed to generate calendar token")
+	}
+	p.CalendarToken = hex.EncodeToString(buf)
+	return Profiles.Update(p)
+}
+
+// Calendar lists the user's scheduled items for calendar apps: for now,
+// when each of their thoughts was published
+func (p *Profile) Calendar() *ical.Calendar {
+	cal := &ical.Calendar{Name: "The Skyscape"}
+	if user := p.User(); user != nil {
+		cal.Name = "@" + user.Handle + " on The Skyscape"
+	}
+
+	thoughts, _ := Thoughts.Search(`
+		WHERE UserID = ? AND Published = true
+		ORDER BY CreatedAt DESC
+		LIMIT 500
+	`, p.UserID)
+	for _, t := range thoughts {
+		start := t.PublishedAt
+		if start.IsZero() {
+			start = t.CreatedAt // Published before publish times were recorded
+		}
+		cal.Events = append(cal.Events, ical.Event{
+			UID:         "thought-" + t.ID + "@theskyscape.com",
+			Start:       start,
+			Summary:     "Published: " + t.Title,
+			Description: summary(t.BlocksToMarkdown(), ""),
+			URL:         siteURL + "/thought/" + t.ID,
+			Updated:     t.UpdatedAt,
+		})
+	}
+	return cal
+}
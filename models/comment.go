@@ -1,15 +1,47 @@
 package models
 
 import (
+	"strings"
+	"time"
+
 	"github.com/The-Skyscape/devtools/pkg/application"
 	"github.com/The-Skyscape/devtools/pkg/authentication"
 )
 
+// Comment subject types
+const (
+	CommentPost    = "post"
+	CommentThought = "thought"
+	CommentRepo    = "repo"
+	CommentApp     = "app"
+	CommentProject = "project"
+	CommentFile    = "file" // SubjectID is "file:{repo or project ID}:{path}"
+)
+
+// CommentTypes lists everything that can be commented on
+var CommentTypes = []string{CommentPost, CommentThought, CommentRepo, CommentApp, CommentProject, CommentFile}
+
+// File comment filters, see FileComments
+const (
+	CommentsOpen     = "open"
+	CommentsResolved = "resolved"
+)
+
+// Comment is a comment on a post, thought, repo, app, project or file.
+// SubjectType says which, since IDs of different kinds can collide.
 type Comment struct {
 	application.Model
-	UserID    string
-	SubjectID string
-	Content   string
+	UserID      string
+	SubjectType string // One of CommentTypes
+	SubjectID   string
+	Content     string
+	DeletedAt   *time.Time // Set while the comment is a tombstone, see SoftDelete
+	DeletedBy   string     // The author, or the admin who removed it
+	Line        int        // Line of the file a file comment is about, 0 for the whole file
+	ResolvedAt  *time.Time // Set once a file comment's thread is resolved, see Resolve
+	ResolvedBy  string     // Who resolved it
+
+	preload *commentPreload // Set by PreloadActivities
 }
 
 func (*Comment) Table() string {
@@ -17,12 +49,105 @@ func (*Comment) Table() string {
 }
 
 func (c *Comment) User() *authentication.User {
+	if c.preload != nil {
+		return c.preload.user
+	}
 	user, _ := Auth.Users.Get(c.UserID)
 	return user
 }
 
 // UserProfile returns the profile of the user who wrote this comment
 func (c *Comment) UserProfile() *Profile {
+	if c.preload != nil {
+		return c.preload.profile
+	}
 	profile, _ := Profiles.First("WHERE UserID = ?", c.UserID)
 	return profile
 }
+
+// Cursor returns the token for paging past this comment
+func (c *Comment) Cursor() string {
+	return EncodeCursor(c.CreatedAt, c.ID)
+}
+
+// FileComments returns the comments on a repo's or project's file, newest
+// first. The filter picks CommentsOpen or CommentsResolved ones; anything
+// else returns them all.
+func FileComments(siteID, path, filter string) ([]*Comment, error) {
+	resolved := ""
+	switch filter {
+	case CommentsOpen:
+		resolved = "AND ResolvedAt IS NULL"
+	case CommentsResolved:
+		resolved = "AND ResolvedAt IS NOT NULL"
+	}
+	return Comments.Search(`
+		WHERE SubjectType = $1 AND SubjectID = $2
+			AND Content != ''
+			`+resolved+`
+		ORDER BY CreatedAt DESC
+	`, CommentFile, "file:"+siteID+":"+path)
+}
+
+// File returns the repo or project ID and the path of a file comment
+func (c *Comment) File() (siteID, path string) {
+	if c.SubjectType != CommentFile {
+		return "", ""
+	}
+	// "file:{repo or project ID}:{path}"
+	parts := strings.SplitN(c.SubjectID, ":", 3)
+	if len(parts) < 3 {
+		return "", ""
+	}
+	return parts[1], parts[2]
+}
+
+// IsResolved returns true if the comment's thread was resolved
+func (c *Comment) IsResolved() bool {
+	return c.ResolvedAt != nil
+}
+
+// ResolvedByProfile returns the profile of whoever resolved the comment
+func (c *Comment) ResolvedByProfile() *Profile {
+	if c.ResolvedBy == "" {
+		return nil
+	}
+	profile, _ := Profiles.First("WHERE UserID = ?", c.ResolvedBy)
+	return profile
+}
+
+// CanResolve returns true if the user may resolve or reopen the comment.
+// Only file comments have threads to resolve: their author, the owner of
+// the repo or project and admins can.
+func (c *Comment) CanResolve(userID string, isAdmin bool) bool {
+	siteID, _ := c.File()
+	if siteID == "" || c.IsDeleted() {
+		return false
+	}
+	if isAdmin || c.UserID == userID {
+		return true
+	}
+	if repo, err := Repos.Get(siteID); err == nil {
+		return repo.OwnerID == userID
+	}
+	if project, err := Projects.Get(siteID); err == nil {
+		return project.OwnerID == userID
+	}
+	return false
+}
+
+// Resolve marks the comment's thread as resolved by the user
+func (c *Comment) Resolve(userID string) error {
+	if c.IsResolved() {
+		return nil
+	}
+	now := time.Now()
+	c.ResolvedAt, c.ResolvedBy = &now, userID
+	return Comments.Update(c)
+}
+
+// Reopen marks a resolved comment's thread as open again
+func (c *Comment) Reopen() error {
+	c.ResolvedAt, c.ResolvedBy = nil, ""
+	return Comments.Update(c)
+}
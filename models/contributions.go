@@ -0,0 +1,213 @@
+package models
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+)
+
+// ContributionDays is how far back the profile heatmap goes
+const ContributionDays = 365
+
+// ContributionSummary caches a user's contribution heatmap and yearly totals.
+// Every push, commit, post, published thought and deploy counts once. The
+// cache is recomputed the first time it is read on a new day.
+type ContributionSummary struct {
+	application.Model
+	UserID   string
+	Day      string // Date computed, YYYY-MM-DD (UTC)
+	Daily    string // JSON map of YYYY-MM-DD to count
+	Pushes   int
+	Commits  int
+	Posts    int
+	Thoughts int
+	Deploys  int
+}
+
+func (*ContributionSummary) Table() string { return "contribution_summaries" }
+
+// Contributions returns the profile's cached contributions
+func (p *Profile) Contributions() *ContributionSummary {
+	return ContributionsFor(p.UserID)
+}
+
+// ContributionsFor returns a user's contributions, computing them if they
+// weren't computed today
+func ContributionsFor(userID string) *ContributionSummary {
+	today := time.Now().UTC().Format("2006-01-02")
+	cached, err := ContributionSummaries.First("WHERE UserID = ?", userID)
+	if err == nil && cached.Day == today {
+		return cached
+	}
+
+	fresh := computeContributions(userID)
+	fresh.Day = today
+	if err != nil {
+		if fresh, err = ContributionSummaries.Insert(fresh); err != nil {
+			slog.Error("failed to cache contributions", "user_id", userID, "error", err)
+		}
+		return fresh
+	}
+
+	fresh.Model = cached.Model
+	if err = ContributionSummaries.Update(fresh); err != nil {
+		slog.Error("failed to cache contributions", "user_id", userID, "error", err)
+	}
+	return fresh
+}
+
+// computeContributions tallies the user's activities and the commits they
+// authored in their own repos and projects over the last ContributionDays
+func computeContributions(userID string) *ContributionSummary {
+	c := &ContributionSummary{UserID: userID}
+	since := time.Now().UTC().AddDate(0, 0, -ContributionDays)
+	daily := map[string]int{}
+
+	activities, _ := Activities.Search(`
+		WHERE UserID = ?
+			AND Action IN ('pushed', 'posted', 'published', 'deployed')
+			AND CreatedAt >= ?
+			AND DeletedAt IS NULL
+	`, userID, since)
+	for _, a := range activities {
+		daily[a.CreatedAt.UTC().Format("2006-01-02")]++
+		switch a.Action {
+		case "pushed":
+			c.Pushes++
+		case "posted":
+			c.Posts++
+		case "published":
+			c.Thoughts++
+		case "deployed":
+			c.Deploys++
+		}
+	}
+
+	// Commits are matched to the user by author email
+	if user, err := Auth.Users.Get(userID); err == nil && user.Email != "" {
+		args := []string{"log", "--all", "-F", "--author=" + user.Email,
+			"--since=" + since.Format("2006-01-02"), "--date=short", "--pretty=format:%ad"}
+		var logs []string
+		repos, _ := Repos.Search("WHERE OwnerID = ?", userID)
+		for _, repo := range repos {
+			if stdout, _, err := repo.Git(args...); err == nil {
+				logs = append(logs, stdout.String())
+			}
+		}
+		projects, _ := Projects.Search("WHERE OwnerID = ?", userID)
+		for _, project := range projects {
+			if stdout, _, err := project.Git(args...); err == nil {
+				logs = append(logs, stdout.String())
+			}
+		}
+		for _, log := range logs {
+			for _, day := range strings.Fields(log) {
+				daily[day]++
+				c.Commits++
+			}
+		}
+	}
+
+	data, _ := json.Marshal(daily)
+	c.Daily = string(data)
+	return c
+}
+
+// Total returns every contribution in the period
+func (c *ContributionSummary) Total() int {
+	return c.Pushes + c.Commits + c.Posts + c.Thoughts + c.Deploys
+}
+
+// ContributionDay is one cell of the heatmap
+type ContributionDay struct {
+	Date  time.Time
+	Count int
+}
+
+// Level buckets the day's count into 0-4 for shading
+func (d ContributionDay) Level() int {
+	switch {
+	case d.Count == 0:
+		return 0
+	case d.Count < 3:
+		return 1
+	case d.Count < 6:
+		return 2
+	case d.Count < 10:
+		return 3
+	}
+	return 4
+}
+
+// days returns every day in the period, oldest first
+func (c *ContributionSummary) days() []ContributionDay {
+	counts := map[string]int{}
+	json.Unmarshal([]byte(c.Daily), &counts)
+
+	end, err := time.Parse("2006-01-02", c.Day)
+	if err != nil {
+		end = time.Now().UTC().Truncate(24 * time.Hour)
+	}
+
+	days := make([]ContributionDay, 0, ContributionDays+1)
+	for d := end.AddDate(0, 0, -ContributionDays); !d.After(end); d = d.AddDate(0, 0, 1) {
+		days = append(days, ContributionDay{Date: d, Count: counts[d.Format("2006-01-02")]})
+	}
+	return days
+}
+
+// Weeks returns the heatmap's columns, Sunday to Saturday. The first week
+// starts on the Sunday before the period, with the padding days left empty.
+func (c *ContributionSummary) Weeks() [][]ContributionDay {
+	days := c.days()
+	if len(days) == 0 {
+		return nil
+	}
+
+	var weeks [][]ContributionDay
+	week := make([]ContributionDay, int(days[0].Date.Weekday()))
+	for _, day := range days {
+		week = append(week, day)
+		if len(week) == 7 {
+			weeks = append(weeks, week)
+			week = nil
+		}
+	}
+	if len(week) > 0 {
+		weeks = append(weeks, week)
+	}
+	return weeks
+}
+
+// CurrentStreak returns how many days in a row up to today had
+// contributions. A quiet today doesn't break a streak until it's over.
+func (c *ContributionSummary) CurrentStreak() int {
+	days := c.days()
+	if n := len(days); n > 0 && days[n-1].Count == 0 {
+		days = days[:n-1]
+	}
+
+	streak := 0
+	for i := len(days) - 1; i >= 0 && days[i].Count > 0; i-- {
+		streak++
+	}
+	return streak
+}
+
+// LongestStreak returns the most days in a row with contributions
+func (c *ContributionSummary) LongestStreak() int {
+	longest, streak := 0, 0
+	for _, day := range c.days() {
+		if day.Count == 0 {
+			streak = 0
+			continue
+		}
+		if streak++; streak > longest {
+			longest = streak
+		}
+	}
+	return longest
+}
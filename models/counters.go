@@ -0,0 +1,97 @@
+package models
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Follower, star and comment counts are rendered for every feed item, so
+// they are cached in columns on the counted record instead of running a
+// COUNT(*) per render. The Count* helpers adjust a column in place with a
+// single UPDATE so concurrent writes don't clobber each other, and
+// ReconcileCounters periodically recomputes every column from the source
+// tables to repair any drift (e.g. rows removed by cascades).
+
+// CountFollow adjusts the follower and following counts for a follow
+// that was just created (delta 1) or deleted (delta -1)
+func CountFollow(f *Follow, delta int) {
+	adjustCounter("profiles", "FollowerTotal", "UserID", f.FolloweeID, delta)
+	adjustCounter("profiles", "FollowingTotal", "UserID", f.FollowerID, delta)
+}
+
+// starCounters maps each star subject type to its cached count column
+var starCounters = map[string][2]string{
+	StarRepo:    {"repos", "StarTotal"},
+	StarProject: {"projects", "StarTotal"},
+	StarApp:     {"apps", "StarTotal"},
+	StarThought: {"thoughts", "StarsCount"},
+}
+
+// CountStar adjusts the star count of the starred subject
+func CountStar(s *Star, delta int) {
+	if counter, ok := starCounters[s.SubjectType]; ok {
+		adjustCounter(counter[0], counter[1], "ID", s.SubjectID, delta)
+	}
+}
+
+// CountComment adjusts the comment count of the post or thought commented on.
+// Comments on other subjects (projects, files) are not counted.
+func CountComment(c *Comment, delta int) {
+	switch c.SubjectType {
+	case CommentPost:
+		adjustCounter("activities", "CommentTotal", "ID", c.SubjectID, delta)
+	case CommentThought:
+		adjustCounter("thoughts", "CommentTotal", "ID", c.SubjectID, delta)
+	}
+}
+
+func adjustCounter(table, column, key, id string, delta int) {
+	if id == "" {
+		return
+	}
+
+	query := "UPDATE " + table + " SET " + column + " = MAX(" + column + " + ?, 0) WHERE " + key + " = ?"
+	if err := DB.Query(query, delta, id).Exec(); err != nil {
+		slog.Error("failed to adjust counter", "table", table, "column", column, "id", id, "error", err)
+	}
+}
+
+// counter is a cached count column and the query counting it from its
+// source table
+type counter struct {
+	table, column, count string
+}
+
+// counters lists every cached counter
+var counters = []counter{
+	{"profiles", "FollowerTotal", `SELECT COUNT(*) FROM follows WHERE follows.FolloweeID = profiles.UserID`},
+	{"profiles", "FollowingTotal", `SELECT COUNT(*) FROM follows WHERE follows.FollowerID = profiles.UserID`},
+	{"repos", "StarTotal", `SELECT COUNT(*) FROM stars WHERE stars.SubjectType = 'repo' AND stars.SubjectID = repos.ID`},
+	{"projects", "StarTotal", `SELECT COUNT(*) FROM stars WHERE stars.SubjectType = 'project' AND stars.SubjectID = projects.ID`},
+	{"apps", "StarTotal", `SELECT COUNT(*) FROM stars WHERE stars.SubjectType = 'app' AND stars.SubjectID = apps.ID`},
+	{"thoughts", "StarsCount", `SELECT COUNT(*) FROM stars WHERE stars.SubjectType = 'thought' AND stars.SubjectID = thoughts.ID`},
+	{"thoughts", "CommentTotal", `SELECT COUNT(*) FROM comments WHERE comments.SubjectType = 'thought' AND comments.DeletedAt IS NULL AND comments.SubjectID = thoughts.ID`},
+	{"activities", "CommentTotal", `SELECT COUNT(*) FROM comments WHERE comments.SubjectType = 'post' AND comments.DeletedAt IS NULL AND comments.SubjectID = activities.ID`},
+}
+
+// reconcileQuery recomputes a counter, writing only the rows that drifted
+// so an hourly run doesn't rewrite (and replicate) whole tables. IS NOT
+// repairs NULL counts too, which != would skip.
+func (c counter) reconcileQuery() string {
+	return "UPDATE " + c.table + " SET " + c.column + " = (" + c.count + ") WHERE " + c.column + " IS NOT (" + c.count + ")"
+}
+
+// ReconcileCounters recomputes every cached counter immediately and then
+// again on each interval. Blocks forever, so run it in a goroutine.
+func ReconcileCounters(interval time.Duration) {
+	for {
+		start := time.Now()
+		for _, c := range counters {
+			if err := DB.Query(c.reconcileQuery()).Exec(); err != nil {
+				slog.Error("counter reconciliation failed", "table", c.table, "column", c.column, "error", err)
+			}
+		}
+		slog.Info("reconciled cached counters", "duration", time.Since(start))
+		time.Sleep(interval)
+	}
+}
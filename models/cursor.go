@@ -0,0 +1,55 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cursor marks a position in a newest-first list by the CreatedAt and ID of
+// the last item seen. Unlike offsets, cursors don't skip or repeat items when
+// new rows arrive, and seeking by CreatedAt stays fast deep into history.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// EncodeCursor returns the opaque token clients pass back as ?cursor=
+func EncodeCursor(createdAt time.Time, id string) string {
+	raw := strconv.FormatInt(createdAt.UnixNano(), 10) + ":" + id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseCursor decodes a token from EncodeCursor
+func ParseCursor(token string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok || id == "" {
+		return nil, errors.New("invalid cursor")
+	}
+
+	unix, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	return &Cursor{CreatedAt: time.Unix(0, unix), ID: id}, nil
+}
+
+// Before returns a condition matching rows that come after the cursor in a
+// list ordered by CreatedAt DESC, ID DESC. Prefix qualifies the columns in
+// joined queries (e.g. "apps."). A nil cursor matches every row.
+func (c *Cursor) Before(prefix string) (string, []any) {
+	if c == nil {
+		return "1 = 1", nil
+	}
+
+	return "(" + prefix + "CreatedAt < ? OR (" + prefix + "CreatedAt = ? AND " + prefix + "ID < ?))",
+		[]any{c.CreatedAt, c.CreatedAt, c.ID}
+}
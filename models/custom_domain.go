@@ -0,0 +1,77 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/pkg/errors"
+)
+
+// MaxCustomDomains is how many domains an app or project can have
+const MaxCustomDomains = 5
+
+// CustomDomain serves an app or project from a domain its owner controls.
+// It's only routed once the owner proves control with a TXT record.
+type CustomDomain struct {
+	application.Model
+	SiteID     string // App or project ID
+	Domain     string // Lowercase, without a port or trailing dot
+	Token      string // Expected in the TXT record at TXTName
+	Verified   bool   // Set once the TXT record has been found
+	VerifiedAt time.Time
+	ForceHTTPS bool // Redirect plain HTTP to HTTPS and send HSTS
+}
+
+func (*CustomDomain) Table() string { return "custom_domains" }
+
+// TXTName is where the verification record goes
+func (d *CustomDomain) TXTName() string {
+	return "_skyscape." + d.Domain
+}
+
+// TXTValue is the verification record's value
+func (d *CustomDomain) TXTValue() string {
+	return "skyscape-verify=" + d.Token
+}
+
+// CreateCustomDomain adds an unverified domain to a site, with a new
+// token for its TXT record
+func CreateCustomDomain(siteID, domain string) (*CustomDomain, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, errors.Wrap(err, "failed to generate domain token")
+	}
+
+	return CustomDomains.Insert(&CustomDomain{
+		SiteID: siteID,
+		Domain: domain,
+		Token:  hex.EncodeToString(buf),
+	})
+}
+
+// VerifiedDomain returns the verified custom domain for a host, or nil
+func VerifiedDomain(host string) *CustomDomain {
+	domain, err := CustomDomains.First("WHERE Domain = ? AND Verified = true", host)
+	if err != nil {
+		return nil
+	}
+	return domain
+}
+
+// CustomDomainsFor returns a site's domains, oldest first
+func CustomDomainsFor(siteID string) []*CustomDomain {
+	domains, _ := CustomDomains.Search("WHERE SiteID = ? ORDER BY CreatedAt", siteID)
+	return domains
+}
+
+// CustomDomains returns the project's custom domains
+func (p *Project) CustomDomains() []*CustomDomain {
+	return CustomDomainsFor(p.ID)
+}
+
+// CustomDomains returns the app's custom domains
+func (a *App) CustomDomains() []*CustomDomain {
+	return CustomDomainsFor(a.ID)
+}
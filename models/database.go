@@ -25,16 +25,42 @@ var (
 	Reactions  = database.Manage(DB, new(Reaction))
 	Promotions = database.Manage(DB, new(Promotion))
 
+	PromotionImpressions = database.Manage(DB, new(PromotionImpression))
+	PromotionClicks      = database.Manage(DB, new(PromotionClick))
+
 	PasswordResetTokens  = database.Manage(DB, new(ResetPasswordToken))
 	RateLimits           = database.Manage(DB, new(RateLimit))
 	Messages             = database.Manage(DB, new(Message))
 	PushSubscriptions    = database.Manage(DB, new(PushSubscription))
 	PushNotificationLogs = database.Manage(DB, new(PushNotificationLog))
+	NotificationHooks    = database.Manage(DB, new(NotificationHook))
+	Webhooks             = database.Manage(DB, new(Webhook))
+	WebhookDeliveries    = database.Manage(DB, new(WebhookDelivery))
+	DeployTokens         = database.Manage(DB, new(DeployToken))
+	AppScreenshots       = database.Manage(DB, new(AppScreenshot))
+	AppReviews           = database.Manage(DB, new(AppReview))
+	AppReviewReports     = database.Manage(DB, new(AppReviewReport))
+	VulnerabilityAlerts  = database.Manage(DB, new(VulnerabilityAlert))
+	SiteVisits           = database.Manage(DB, new(SiteVisit))
+	SiteTraffics         = database.Manage(DB, new(SiteTraffic))
+	ProxyRuleSets        = database.Manage(DB, new(ProxyRules))
+	CustomDomains        = database.Manage(DB, new(CustomDomain))
 
 	OAuthAuthorizations     = database.Manage(DB, new(OAuthAuthorization))
 	OAuthAuthorizationCodes = database.Manage(DB, new(OAuthAuthorizationCode))
+	OAuthDeviceCodes        = database.Manage(DB, new(OAuthDeviceCode))
+	SigningKeys             = database.Manage(DB, new(SigningKey))
+
+	AppMetricsManager           = database.Manage(DB, new(AppMetrics))
+	NotificationSettingsManager = database.Manage(DB, new(NotificationSettings))
 
-	AppMetricsManager = database.Manage(DB, new(AppMetrics))
+	QueuedPushes          = database.Manage(DB, new(QueuedPush))
+	EmailLogs             = database.Manage(DB, new(EmailLog))
+	EmailSuppressions     = database.Manage(DB, new(EmailSuppression))
+	Restrictions          = database.Manage(DB, new(Restriction))
+	TopicFollows          = database.Manage(DB, new(TopicFollow))
+	ActivityTags          = database.Manage(DB, new(ActivityTag))
+	ContributionSummaries = database.Manage(DB, new(ContributionSummary))
 
 	// Payment system
 	Subscriptions = database.Manage(DB, new(Subscription))
@@ -42,6 +68,31 @@ var (
 
 	Thoughts      = database.Manage(DB, new(Thought))
 	ThoughtViews  = database.Manage(DB, new(ThoughtView))
-	ThoughtStars  = database.Manage(DB, new(ThoughtStar))
 	ThoughtBlocks = database.Manage(DB, new(ThoughtBlock))
+
+	// Admin dashboard
+	MetricSnapshots = database.Manage(DB, new(MetricSnapshot))
+	Suspensions     = database.Manage(DB, new(Suspension))
+	Takedowns       = database.Manage(DB, new(Takedown))
+	Announcements   = database.Manage(DB, new(Announcement))
+	Broadcasts      = database.Manage(DB, new(Broadcast))
+	Incidents       = database.Manage(DB, new(Incident))
+	AuditLogs       = database.Manage(DB, new(AuditLog))
+	Impersonations  = database.Manage(DB, new(Impersonation))
+
+	// Account security
+	TwoFactorSecrets    = database.Manage(DB, new(TwoFactorSecret))
+	TwoFactorChallenges = database.Manage(DB, new(TwoFactorChallenge))
+	WebAuthnCredentials = database.Manage(DB, new(WebAuthnCredential))
+	WebAuthnChallenges  = database.Manage(DB, new(WebAuthnChallenge))
+	SessionDevices      = database.Manage(DB, new(SessionDevice))
+	FailedSignins       = database.Manage(DB, new(FailedSignin))
+	KnownDevices        = database.Manage(DB, new(KnownDevice))
+	SSHKeys             = database.Manage(DB, new(SSHKey))
+	SocialIdentities    = database.Manage(DB, new(SocialIdentity))
+	SocialSignins       = database.Manage(DB, new(SocialSignin))
+
+	// Invite-only signups
+	Invites         = database.Manage(DB, new(Invite))
+	WaitlistEntries = database.Manage(DB, new(WaitlistEntry))
 )
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/pkg/errors"
+)
+
+// deployTokenPrefix marks deploy tokens so they are recognizable in CI
+// secrets and secret scanners
+const deployTokenPrefix = "skd_"
+
+// DeployToken lets a CLI or CI job deploy one project without the owner's
+// git credentials
+type DeployToken struct {
+	application.Model
+	ProjectID  string
+	UserID     string // Who created the token
+	Name       string // e.g. "GitHub Actions"
+	TokenHash  string // SHA-256 of the token, which is only shown once
+	Hint       string // Last characters of the token, to tell tokens apart
+	LastUsedAt time.Time
+}
+
+func (*DeployToken) Table() string { return "deploy_tokens" }
+
+// CreateDeployToken issues a token for a project, returning the token
+// itself alongside its record since only the hash is stored
+func CreateDeployToken(projectID, userID, name string) (*DeployToken, string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", errors.Wrap(err, "failed to generate deploy token")
+	}
+	token := deployTokenPrefix + hex.EncodeToString(buf)
+
+	record, err := DeployTokens.Insert(&DeployToken{
+		ProjectID: projectID,
+		UserID:    userID,
+		Name:      name,
+		TokenHash: hashDeployToken(token),
+		Hint:      token[len(token)-4:],
+	})
+	return record, token, err
+}
+
+// FindDeployToken returns the record for a deploy token, if it exists
+func FindDeployToken(token string) (*DeployToken, error) {
+	if !strings.HasPrefix(token, deployTokenPrefix) {
+		return nil, errors.New("invalid deploy token")
+	}
+	record, err := DeployTokens.First("WHERE TokenHash = ?", hashDeployToken(token))
+	if err != nil || record == nil {
+		return nil, errors.New("invalid deploy token")
+	}
+	return record, nil
+}
+
+func hashDeployToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// Project returns the project the token deploys
+func (t *DeployToken) Project() *Project {
+	project, _ := Projects.Get(t.ProjectID)
+	return project
+}
+
+// DeployTokens returns the project's deploy tokens, newest first
+func (p *Project) DeployTokens() []*DeployToken {
+	tokens, _ := DeployTokens.Search(`
+		WHERE ProjectID = ?
+		ORDER BY CreatedAt DESC
+	`, p.ID)
+	return tokens
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+)
+
+// CLIClientID is the OAuth client ID of the skyscape CLI. It's built in
+// rather than registered as an app, and since a CLI can't keep a secret
+// it can only sign in with the device flow.
+const CLIClientID = "skyscape-cli"
+
+// Device authorization states
+const (
+	DevicePending  = "pending"
+	DeviceApproved = "approved"
+	DeviceDenied   = "denied"
+	DeviceRedeemed = "redeemed" // Exchanged for an access token
+)
+
+// OAuthDeviceCode is a device authorization (RFC 8628). A device without
+// a browser, like the CLI, shows the user a short code to approve at
+// /oauth/device while it polls the token endpoint with the device code.
+type OAuthDeviceCode struct {
+	application.Model
+	ClientID   string
+	DeviceCode string // SHA-256 hashed
+	UserCode   string // What the user types, e.g. "WDJB-MJHT"
+	Scopes     string // space-separated
+	UserID     string // Who approved or denied it
+	Status     string
+	ExpiresAt  time.Time
+	PolledAt   time.Time // Last token request, to enforce the polling interval
+}
+
+func (*OAuthDeviceCode) Table() string { return "oauth_device_codes" }
+
+// IsExpired returns true if this code has expired
+func (d *OAuthDeviceCode) IsExpired() bool {
+	return time.Now().After(d.ExpiresAt)
+}
+
+// MarkPolled records a token request. Only PolledAt is written, so a poll
+// served from a stale replica can't undo the user's approval.
+func (d *OAuthDeviceCode) MarkPolled() {
+	d.PolledAt = time.Now()
+	DB.Query("UPDATE oauth_device_codes SET PolledAt = ? WHERE ID = ?", d.PolledAt, d.ID).Exec()
+}
+
+// Redeem marks an approved code as exchanged. The write is checked
+// against the primary, like OAuthAuthorizationCode.MarkAsUsed, so one
+// approval can't be redeemed twice.
+func (d *OAuthDeviceCode) Redeem() error {
+	var id string
+	err := DB.Query(`
+		UPDATE oauth_device_codes SET Status = ?, UpdatedAt = ?
+		WHERE ID = ? AND Status = ?
+		RETURNING ID
+	`, DeviceRedeemed, time.Now(), d.ID, DeviceApproved).Scan(&id)
+	if err != nil {
+		return errors.New("device code already used")
+	}
+	d.Status = DeviceRedeemed
+	return nil
+}
+
+// IsCLI reports whether the authorization is for the skyscape CLI
+func (a *OAuthAuthorization) IsCLI() bool {
+	return a.AppID == CLIClientID
+}
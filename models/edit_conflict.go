@@ -0,0 +1,42 @@
+package models
+
+import (
+	"errors"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+)
+
+// ErrEditConflict is returned when a record was saved somewhere else, e.g.
+// in another tab or by an admin, since the editor loaded it
+var ErrEditConflict = errors.New("this was changed somewhere else while you were editing, reload to get the latest version")
+
+// Editable records carry a Version that edit forms send back, so two
+// editors can't silently overwrite each other
+type Editable interface {
+	Table() string
+	GetModel() *application.Model
+	version() *int
+}
+
+func (t *Thought) version() *int { return &t.Version }
+func (r *Repo) version() *int    { return &r.Version }
+func (p *Project) version() *int { return &p.Version }
+func (p *Profile) version() *int { return &p.Version }
+
+// ClaimEdit bumps the record's Version if it is still the version the
+// editor loaded, returning ErrEditConflict otherwise. The check and bump
+// are one statement, so when two saves race only one claims the edit.
+// Save the record with its manager afterwards as usual.
+func ClaimEdit(record Editable, version int) error {
+	var claimed int
+	err := DB.Query(`
+		UPDATE `+record.Table()+` SET Version = COALESCE(Version, 0) + 1
+		WHERE ID = ? AND COALESCE(Version, 0) = ?
+		RETURNING Version
+	`, record.GetModel().ID, version).Scan(&claimed)
+	if err != nil {
+		return ErrEditConflict
+	}
+	*record.version() = claimed
+	return nil
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/The-Skyscape/devtools/pkg/emailing"
+)
+
+// Email delivery statuses. Sends are recorded as sent, failed or
+// suppressed; the provider's webhook later moves them to delivered,
+// bounced or complained.
+const (
+	EmailSent       = "sent"
+	EmailFailed     = "failed"
+	EmailSuppressed = "suppressed"
+	EmailDelivered  = "delivered"
+	EmailBounced    = "bounced"
+	EmailComplained = "complained"
+)
+
+// ErrEmailSuppressed is returned when sending to an address that hard
+// bounced or marked our mail as spam
+var ErrEmailSuppressed = errors.New("email address is suppressed after a bounce or complaint")
+
+// EmailLog records an outgoing email
+type EmailLog struct {
+	application.Model
+	Recipient string
+	Template  string
+	Subject   string
+	Status    string
+	Detail    string // Send error or bounce reason
+}
+
+func (*EmailLog) Table() string { return "email_logs" }
+
+// EmailSuppression blocks sends to an address the provider reported as a
+// hard bounce or spam complaint
+type EmailSuppression struct {
+	application.Model
+	Email  string // Lowercased
+	Reason string // EmailBounced or EmailComplained
+	Detail string
+}
+
+func (*EmailSuppression) Table() string { return "email_suppressions" }
+
+// SendEmail sends a templated email and records it, skipping addresses
+// that are suppressed. Use it instead of Emails.Send.
+func SendEmail(to, subject, template string, opts ...emailing.EmailOption) error {
+	log := &EmailLog{
+		Recipient: strings.ToLower(strings.TrimSpace(to)),
+		Template:  template,
+		Subject:   subject,
+		Status:    EmailSent,
+	}
+
+	var err error
+	if EmailSuppressedFor(log.Recipient) {
+		log.Status, err = EmailSuppressed, ErrEmailSuppressed
+	} else if err = Emails.Send(to, subject, append(opts, emailing.WithTemplate(template))...); err != nil {
+		log.Status, log.Detail = EmailFailed, err.Error()
+	}
+
+	if _, logErr := EmailLogs.Insert(log); logErr != nil {
+		slog.Error("failed to record email", "template", template, "error", logErr)
+	}
+	return err
+}
+
+// EmailSuppressedFor reports whether sends to an address are suppressed
+func EmailSuppressedFor(email string) bool {
+	return EmailSuppressions.Count("WHERE Email = ?", strings.ToLower(strings.TrimSpace(email))) > 0
+}
+
+// RecordEmailEvent applies a provider event to the latest email sent to an
+// address. Bounces and complaints also suppress the address; soft bounces
+// are recorded without suppressing it.
+func RecordEmailEvent(email, status, detail string, permanent bool) error {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if log, err := EmailLogs.First(`
+		WHERE Recipient = ?
+		ORDER BY CreatedAt DESC
+	`, email); err == nil && log != nil {
+		log.Status, log.Detail = status, detail
+		if err = EmailLogs.Update(log); err != nil {
+			return err
+		}
+	}
+
+	if !permanent || EmailSuppressedFor(email) {
+		return nil
+	}
+	_, err := EmailSuppressions.Insert(&EmailSuppression{
+		Email:  email,
+		Reason: status,
+		Detail: detail,
+	})
+	return err
+}
+
+// EmailDelivery summarizes recent outgoing email for the admin dashboard
+type EmailDelivery struct {
+	Days   int
+	Counts map[string]int // By status
+	Issues []*EmailLog    // Latest failures, bounces and complaints
+}
+
+// Total returns how many emails were recorded
+func (d *EmailDelivery) Total() int {
+	total := 0
+	for _, n := range d.Counts {
+		total += n
+	}
+	return total
+}
+
+// EmailDeliveryFor summarizes the last days of outgoing email
+func EmailDeliveryFor(days int) *EmailDelivery {
+	since := time.Now().AddDate(0, 0, -days)
+	d := &EmailDelivery{Days: days, Counts: map[string]int{}}
+	for _, status := range []string{EmailSent, EmailDelivered, EmailFailed, EmailSuppressed, EmailBounced, EmailComplained} {
+		d.Counts[status] = EmailLogs.Count("WHERE Status = ? AND CreatedAt > ?", status, since)
+	}
+	d.Issues, _ = EmailLogs.Search(`
+		WHERE Status IN (?, ?, ?) AND CreatedAt > ?
+		ORDER BY UpdatedAt DESC
+		LIMIT 10
+	`, EmailFailed, EmailBounced, EmailComplained, since)
+	return d
+}
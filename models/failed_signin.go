@@ -0,0 +1,105 @@
+package models
+
+import (
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+)
+
+// Per-account sign-in protection. The per-IP limit stops one machine
+// guessing, but a botnet spreads its guesses across thousands of IPs, so
+// failures are also counted against the account being guessed at.
+const (
+	FailedSigninWindow = 15 * time.Minute // Failures older than this stop counting
+	CaptchaThreshold   = 3                // Failures before sign in needs a CAPTCHA
+	AlertThreshold     = 5                // Failures before the owner is emailed
+	LockoutThreshold   = 10               // Failures that lock the account
+	LockoutDuration    = 15 * time.Minute
+)
+
+// FailedSignin is a wrong password for an account
+type FailedSignin struct {
+	application.Model
+	UserID    string
+	IP        string
+	UserAgent string
+}
+
+func (*FailedSignin) Table() string { return "failed_signins" }
+
+// SigninRisk summarizes recent failures against an account
+type SigninRisk struct {
+	Failures    int
+	IPs         int       // Distinct IPs the failures came from
+	LockedUntil time.Time // Zero unless the account is locked
+}
+
+// IsLocked returns true while the account refuses sign in
+func (r *SigninRisk) IsLocked() bool {
+	return time.Now().Before(r.LockedUntil)
+}
+
+// NeedsCaptcha returns true once failures suggest someone is guessing
+func (r *SigninRisk) NeedsCaptcha() bool {
+	return r.Failures >= CaptchaThreshold
+}
+
+// IsDistributed returns true when the failures come from several IPs at
+// once, the sign of a botnet rather than someone mistyping
+func (r *SigninRisk) IsDistributed() bool {
+	return r.IPs >= 3
+}
+
+// MinutesLocked returns the whole minutes left on a lockout, at least 1
+func (r *SigninRisk) MinutesLocked() int {
+	return max(int(time.Until(r.LockedUntil).Minutes())+1, 1)
+}
+
+// CheckSigninRisk returns recent failures against the account. The
+// lockout runs from the failure that crossed LockoutThreshold; attempts
+// are refused without being counted while it lasts, so it ends on time.
+func CheckSigninRisk(userID string) *SigninRisk {
+	risk := &SigninRisk{}
+	since := time.Now().Add(-FailedSigninWindow)
+	DB.Query(`
+		SELECT COUNT(*), COUNT(DISTINCT IP) FROM failed_signins
+		WHERE UserID = ? AND CreatedAt > ?
+	`, userID, since).Scan(&risk.Failures, &risk.IPs)
+
+	if risk.Failures >= LockoutThreshold {
+		latest, err := FailedSignins.First(`
+			WHERE UserID = ? AND CreatedAt > ?
+			ORDER BY CreatedAt DESC
+		`, userID, since)
+		if err == nil {
+			risk.LockedUntil = latest.CreatedAt.Add(LockoutDuration)
+		}
+	}
+	return risk
+}
+
+// RecordFailedSignin counts a wrong password against the account and
+// returns its risk including it. The risk is read before the write, since
+// the replica may not have the new row yet.
+func RecordFailedSignin(userID, ip, userAgent string) *SigninRisk {
+	risk := CheckSigninRisk(userID)
+	FailedSignins.Insert(&FailedSignin{
+		UserID:    userID,
+		IP:        ip,
+		UserAgent: userAgent,
+	})
+	DB.Query("DELETE FROM failed_signins WHERE UserID = ? AND CreatedAt < ?",
+		userID, time.Now().Add(-24*time.Hour)).Exec()
+
+	risk.Failures++
+	if risk.Failures >= LockoutThreshold && risk.LockedUntil.IsZero() {
+		risk.LockedUntil = time.Now().Add(LockoutDuration)
+	}
+	return risk
+}
+
+// ClearFailedSignins forgets failures once the owner proves who they are,
+// by signing in or resetting their password
+func ClearFailedSignins(userID string) error {
+	return DB.Query("DELETE FROM failed_signins WHERE UserID = ?", userID).Exec()
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"slices"
+	"strings"
+)
+
+// FeedKind is a group of activity actions users can leave out of their home
+// feed. Posts can't be hidden; they're what the feed is for.
+type FeedKind struct {
+	Key     string
+	Label   string
+	Actions []string
+}
+
+// FeedKinds lists the kinds of activity shown in the home feed that users
+// can turn off
+var FeedKinds = []FeedKind{
+	{"pushes", "Pushes and deploys", []string{"pushed", "deployed", "migrated"}},
+	{"comments", "Comments", []string{"commented"}},
+	{"stars", "Stars", []string{"starred"}},
+	{"joins", "New members and follows", []string{"joined", "followed"}},
+}
+
+// HiddenFeedKindKeys returns the keys of the kinds the user turned off
+func (p *Profile) HiddenFeedKindKeys() []string {
+	if p.HiddenFeedKinds == "" {
+		return nil
+	}
+	return strings.Split(p.HiddenFeedKinds, ",")
+}
+
+// ShowsFeedKind reports whether the user's home feed includes a kind
+func (p *Profile) ShowsFeedKind(key string) bool {
+	return !slices.Contains(p.HiddenFeedKindKeys(), key)
+}
+
+// SetHiddenFeedKinds stores the kinds to leave out, ignoring unknown keys
+func (p *Profile) SetHiddenFeedKinds(keys []string) {
+	var hidden []string
+	for _, kind := range FeedKinds {
+		if slices.Contains(keys, kind.Key) {
+			hidden = append(hidden, kind.Key)
+		}
+	}
+	p.HiddenFeedKinds = strings.Join(hidden, ",")
+}
+
+// FeedKindFilter returns a WHERE clause leaving out the actions of the
+// kinds the user hid from their home feed
+func (p *Profile) FeedKindFilter() string {
+	var actions []string
+	for _, kind := range FeedKinds {
+		if !p.ShowsFeedKind(kind.Key) {
+			for _, action := range kind.Actions {
+				actions = append(actions, "'"+action+"'")
+			}
+		}
+	}
+	if len(actions) == 0 {
+		return "1 = 1"
+	}
+	return "Action NOT IN (" + strings.Join(actions, ", ") + ")"
+}
+
+// HomeFeed returns a page of the user's home feed: their own activity,
+// that of people they follow and activity reaching them through followed
+// topics, leaving out the kinds they hid. Without a cursor, offset skips
+// into the feed instead.
+func (p *Profile) HomeFeed(cursor *Cursor, limit, offset int) []*Activity {
+	following := p.Following()
+	userIDs := make([]any, 0, len(following)+1)
+	userIDs = append(userIDs, p.UserID)
+	for _, f := range following {
+		userIDs = append(userIDs, f.FolloweeID)
+	}
+	placeholders := "?" + strings.Repeat(",?", len(userIDs)-1)
+
+	before, cursorArgs := cursor.Before("")
+	args := append(append(append(userIDs, p.UserID, p.UserID), cursorArgs...), limit, offset)
+	activities, _ := Activities.Search(`
+		WHERE (UserID IN (`+placeholders+`) OR (`+PublicActivities+` AND `+TopicActivities+`))
+			AND UserID NOT IN (SELECT UserID FROM profiles WHERE Suspended = true)
+			AND `+p.FeedKindFilter()+`
+			AND DeletedAt IS NULL
+			AND `+before+`
+		ORDER BY CreatedAt DESC, ID DESC
+		LIMIT ? OFFSET ?
+	`, args...)
+	return activities
+}
@@ -1,18 +1,46 @@
 package models
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"time"
+
 	"github.com/The-Skyscape/devtools/pkg/application"
 	"github.com/The-Skyscape/devtools/pkg/authentication"
 )
 
+// Scan statuses for uploaded files
+const (
+	ScanPending     = "pending"
+	ScanClean       = "clean"
+	ScanQuarantined = "quarantined"
+)
+
 type File struct {
 	application.Model
-	OwnerID  string
-	FilePath string
-	MimeType string
-	Content  []byte
+	OwnerID    string
+	FilePath   string
+	MimeType   string
+	Content    []byte
+	ScanStatus string // "pending", "clean", "quarantined" (empty for legacy uploads)
+	ScanResult string // Detected signature or scanner error
+	ScannedAt  time.Time
+	Visibility string // "public" or "private" (empty is public)
 }
 
+// File visibilities. Private files are only served to their owner or to
+// holders of a signed URL.
+const (
+	FilePublic  = "public"
+	FilePrivate = "private"
+)
+
+// SignedURLTTL is how long URLs returned by File.URL remain valid
+const SignedURLTTL = time.Hour
+
 func (*File) Table() string { return "files" }
 
 func (f *File) Owner() *authentication.User {
@@ -23,3 +51,77 @@ func (f *File) Owner() *authentication.User {
 
 	return user
 }
+
+// IsAvailable returns true if the file may be served. Files uploaded before
+// scanning existed have no status and remain available.
+func (f *File) IsAvailable() bool {
+	return f.ScanStatus == "" || f.ScanStatus == ScanClean
+}
+
+// IsQuarantined returns true if the scanner flagged this file
+func (f *File) IsQuarantined() bool {
+	return f.ScanStatus == ScanQuarantined
+}
+
+// IsPrivate returns true if the file requires a signature to download
+func (f *File) IsPrivate() bool {
+	return f.Visibility == FilePrivate
+}
+
+// URL returns the path used to download this file, signing it when private
+func (f *File) URL() string {
+	if !f.IsPrivate() {
+		return "/file/" + f.ID
+	}
+	return f.SignedURL(SignedURLTTL)
+}
+
+// FileURL returns the download path of the file with the ID, signing it
+// when private, reading only its visibility rather than the whole file
+func FileURL(id string) (string, bool) {
+	var visibility string
+	if err := DB.Query("SELECT COALESCE(Visibility, '') FROM files WHERE ID = ?", id).Scan(&visibility); err != nil {
+		return "", false
+	}
+	file := &File{Model: application.Model{ID: id}, Visibility: visibility}
+	return file.URL(), true
+}
+
+// SignedURL returns a download path that is valid until ttl has elapsed
+func (f *File) SignedURL(ttl time.Duration) string {
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	return "/file/" + f.ID + "?expires=" + expires + "&sig=" + f.signature(expires)
+}
+
+// VerifySignature checks a signature produced by SignedURL and returns
+// when it expires
+func (f *File) VerifySignature(expires, sig string) (time.Time, bool) {
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	expiresAt := time.Unix(unix, 0)
+	if time.Now().After(expiresAt) {
+		return time.Time{}, false
+	}
+
+	return expiresAt, hmac.Equal([]byte(sig), []byte(f.signature(expires)))
+}
+
+// signature is an HMAC over the file ID and expiry keyed by AUTH_SECRET,
+// prefixed so it can't pass for another purpose's signature
+func (f *File) signature(expires string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("AUTH_SECRET")))
+	mac.Write([]byte("file:" + f.ID + ":" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SetVisibility updates the file's visibility if it changed
+func (f *File) SetVisibility(visibility string) error {
+	if f.Visibility == visibility {
+		return nil
+	}
+	f.Visibility = visibility
+	return Files.Update(f)
+}
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"www.theskyscape.com/internal/git"
+)
+
+// Health check keys
+const (
+	CheckReadme  = "readme"
+	CheckLicense = "license"
+	CheckRecent  = "recent"
+	CheckBuild   = "build"
+)
+
+// MaintainedWithin is how recently a repo or project must have been
+// committed to for it to count as maintained
+const MaintainedWithin = 90 * 24 * time.Hour
+
+// licenseFiles are the names a license is recognized by, lowercased
+var licenseFiles = []string{"license", "license.md", "license.txt", "licence", "licence.md", "copying"}
+
+// HealthCheck is one signal that a repo or project is looked after
+type HealthCheck struct {
+	Key   string
+	Title string
+	Tip   string // How the owner can fix it
+	Done  bool
+}
+
+// Health is the checklist shown on repo and project pages. Like the
+// onboarding checklist, it's worked out from the code each time rather
+// than stored.
+type Health struct {
+	Checks []*HealthCheck
+}
+
+// Health returns the repo's checklist for its main branch. The build
+// check only appears once the repo has launched an app.
+func (r *Repo) Health() *Health {
+	h := codeHealth(r.Path())
+
+	apps, _ := r.Apps()
+	if len(apps) > 0 {
+		passing := true
+		for _, app := range apps {
+			img, err := Images.First(`
+				WHERE AppID = ? AND Status != 'building'
+				ORDER BY CreatedAt DESC
+			`, app.ID)
+			if err != nil || img.Status == "failed" {
+				passing = false
+			}
+		}
+		h.Checks = append(h.Checks, buildCheck(passing))
+	}
+	return h
+}
+
+// Health returns the project's checklist for its main branch
+func (p *Project) Health() *Health {
+	h := codeHealth(p.Path())
+
+	img, err := Images.First(`
+		WHERE ProjectID = ? AND Status != 'building'
+		ORDER BY CreatedAt DESC
+	`, p.ID)
+	h.Checks = append(h.Checks, buildCheck(err == nil && img.Status != "failed"))
+	return h
+}
+
+// codeHealth checks what's committed to a git repo's main branch
+func codeHealth(path string) *Health {
+	var hasReadme, hasLicense bool
+	files, _ := git.ListFiles(path, "main", "")
+	for _, file := range files {
+		if file.IsDir {
+			continue
+		}
+		name := strings.ToLower(file.Path)
+		if name == "readme" || strings.HasPrefix(name, "readme.") {
+			hasReadme = true
+		}
+		if slices.Contains(licenseFiles, name) {
+			hasLicense = true
+		}
+	}
+
+	last, err := git.LastCommitTime(path, "main")
+	return &Health{Checks: []*HealthCheck{{
+		Key:   CheckReadme,
+		Title: "Has a README",
+		Tip:   "Add a README.md explaining what this is and how to run it. It's the first thing visitors see.",
+		Done:  hasReadme,
+	}, {
+		Key:   CheckLicense,
+		Title: "Has a license",
+		Tip:   "Add a LICENSE file so people know whether they can use and fork your code.",
+		Done:  hasLicense,
+	}, {
+		Key:   CheckRecent,
+		Title: "Committed to recently",
+		Tip:   "Nothing has been pushed in 90 days. A recent commit shows visitors it's still maintained.",
+		Done:  err == nil && time.Since(last) < MaintainedWithin,
+	}}}
+}
+
+func buildCheck(passing bool) *HealthCheck {
+	return &HealthCheck{
+		Key:   CheckBuild,
+		Title: "Build passing",
+		Tip:   "The latest build failed or hasn't run yet. Check its logs, fix the Dockerfile and push again.",
+		Done:  passing,
+	}
+}
+
+// Passed returns how many checks are done
+func (h *Health) Passed() int {
+	n := 0
+	for _, check := range h.Checks {
+		if check.Done {
+			n++
+		}
+	}
+	return n
+}
+
+// Healthy reports whether every check is done
+func (h *Health) Healthy() bool {
+	return h.Passed() == len(h.Checks)
+}
+
+// Percent returns how many checks are done, 0-100
+func (h *Health) Percent() int {
+	if len(h.Checks) == 0 {
+		return 100
+	}
+	return h.Passed() * 100 / len(h.Checks)
+}
@@ -1,6 +1,11 @@
 package models
 
-import "github.com/The-Skyscape/devtools/pkg/application"
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+)
 
 type Image struct {
 	application.Model
@@ -9,6 +14,14 @@ type Image struct {
 	GitHash   string
 	Status    string
 	Error     string
+
+	// Vulnerability scan of the built image, see internal/imagescan
+	Scanned         bool
+	CriticalCount   int
+	HighCount       int
+	ModerateCount   int
+	LowCount        int
+	Vulnerabilities string // JSON []ImageVulnerability, the worst MaxImageVulnerabilities
 }
 
 func (*Image) Table() string { return "images" }
@@ -42,3 +55,60 @@ func (i *Image) Repo() *Repo {
 	}
 	return nil
 }
+
+// StuckBuildAfter is how long a build may run before it's considered stuck
+const StuckBuildAfter = 20 * time.Minute
+
+// IsBuilding returns true while the image is being built
+func (i *Image) IsBuilding() bool {
+	return i.Status == "building"
+}
+
+// IsStuck returns true if the build has run longer than expected
+func (i *Image) IsStuck() bool {
+	return i.IsBuilding() && time.Since(i.CreatedAt) > StuckBuildAfter
+}
+
+// BuildDuration returns how long the build has been running
+func (i *Image) BuildDuration() time.Duration {
+	return time.Since(i.CreatedAt).Round(time.Second)
+}
+
+// EntityID returns the project or legacy app ID this image was built for
+func (i *Image) EntityID() string {
+	if i.ProjectID != "" {
+		return i.ProjectID
+	}
+	return i.AppID
+}
+
+// MaxImageVulnerabilities is how many findings an image keeps. The counts
+// cover every finding with a known severity.
+const MaxImageVulnerabilities = 100
+
+// ImageVulnerability is a known CVE in a package installed in an image
+type ImageVulnerability struct {
+	ID       string `json:"id"` // e.g. "CVE-2024-..."
+	Package  string `json:"package"`
+	Version  string `json:"version"`
+	FixedIn  string `json:"fixed_in,omitempty"`
+	Severity string `json:"severity"` // One of the advisory severities
+	Title    string `json:"title,omitempty"`
+}
+
+// URL links to the vulnerability on osv.dev
+func (v *ImageVulnerability) URL() string {
+	return "https://osv.dev/vulnerability/" + v.ID
+}
+
+// Findings returns the stored vulnerabilities, most severe first
+func (i *Image) Findings() []*ImageVulnerability {
+	var findings []*ImageVulnerability
+	json.Unmarshal([]byte(i.Vulnerabilities), &findings)
+	return findings
+}
+
+// VulnerabilityCount returns how many vulnerabilities the scan found
+func (i *Image) VulnerabilityCount() int {
+	return i.CriticalCount + i.HighCount + i.ModerateCount + i.LowCount
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/The-Skyscape/devtools/pkg/authentication"
+)
+
+// ImpersonationExpiry is how long an admin can stay signed in as a user
+const ImpersonationExpiry = time.Hour
+
+// Impersonation is an admin signed in as a user to reproduce a problem
+// they reported. It runs in its own short-lived session for the user, so
+// the admin never needs the user's credentials, and the admin's session is
+// restored when it ends.
+type Impersonation struct {
+	application.Model
+	AdminID        string
+	UserID         string
+	SessionID      string // The user's session the admin is browsing with
+	AdminSessionID string // The admin's own session, restored afterwards
+	Reason         string
+	ExpiresAt      time.Time
+	Ended          bool
+	EndedAt        time.Time
+}
+
+func (*Impersonation) Table() string { return "impersonations" }
+
+// User returns the user being impersonated
+func (i *Impersonation) User() *authentication.User {
+	user, _ := Auth.Users.Get(i.UserID)
+	return user
+}
+
+// Admin returns the admin doing the impersonating
+func (i *Impersonation) Admin() *authentication.User {
+	user, _ := Auth.Users.Get(i.AdminID)
+	return user
+}
+
+// IsExpired returns true once the impersonation has run out of time
+func (i *Impersonation) IsExpired() bool {
+	return time.Now().After(i.ExpiresAt)
+}
+
+// MinutesLeft returns the whole minutes until the impersonation expires
+func (i *Impersonation) MinutesLeft() int {
+	return max(int(time.Until(i.ExpiresAt).Minutes()), 0)
+}
+
+// Impersonate starts a session for the user on the admin's behalf
+func Impersonate(admin *authentication.User, adminSession *authentication.Session, user *authentication.User, reason string) (*Impersonation, *authentication.Session, error) {
+	session, err := Auth.Sessions.Insert(&authentication.Session{
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(ImpersonationExpiry),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	impersonation, err := Impersonations.Insert(&Impersonation{
+		AdminID:        admin.ID,
+		UserID:         user.ID,
+		SessionID:      session.ID,
+		AdminSessionID: adminSession.ID,
+		Reason:         reason,
+		ExpiresAt:      session.ExpiresAt,
+	})
+	if err != nil {
+		Auth.Sessions.Delete(session)
+		return nil, nil, err
+	}
+	return impersonation, session, nil
+}
+
+// ActiveImpersonation returns the unexpired impersonation using a
+// session, or nil if the session is the user's own
+func ActiveImpersonation(sessionID string) *Impersonation {
+	impersonation, err := Impersonations.First("WHERE SessionID = ? AND Ended = false", sessionID)
+	if err != nil || impersonation.IsExpired() {
+		return nil
+	}
+	return impersonation
+}
+
+// End closes the impersonation and signs its session out
+func (i *Impersonation) End() error {
+	if session, err := Auth.Sessions.Get(i.SessionID); err == nil {
+		if err = Auth.Sessions.Delete(session); err != nil {
+			return err
+		}
+	}
+	i.Ended = true
+	i.EndedAt = time.Now()
+	return Impersonations.Update(i)
+}
+
+// EndImpersonations ends everything the admin started from one of their
+// sessions, expired or not, returning what was ended
+func EndImpersonations(adminSessionID string) []*Impersonation {
+	impersonations, _ := Impersonations.Search("WHERE AdminSessionID = ? AND Ended = false", adminSessionID)
+	for _, impersonation := range impersonations {
+		impersonation.End()
+	}
+	return impersonations
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+)
+
+// Incident states, in the order an incident usually moves through them
+const (
+	IncidentInvestigating = "investigating"
+	IncidentIdentified    = "identified"
+	IncidentMonitoring    = "monitoring"
+	IncidentResolved      = "resolved"
+)
+
+// Incident is a problem with a platform component, posted by admins on
+// the status page
+type Incident struct {
+	application.Model
+	CreatedBy  string
+	Title      string
+	Component  string // One of health.Components, e.g. "builds"
+	Impact     string // "degraded" or "outage"
+	Status     string // investigating, identified, monitoring, resolved
+	Message    string // Latest update for users
+	ResolvedAt time.Time
+}
+
+func (*Incident) Table() string { return "incidents" }
+
+// IsResolved returns true once the incident is over
+func (i *Incident) IsResolved() bool {
+	return i.Status == IncidentResolved
+}
+
+// OpenIncidents returns unresolved incidents, newest first
+func OpenIncidents() []*Incident {
+	incidents, _ := Incidents.Search(`
+		WHERE Status != ?
+		ORDER BY CreatedAt DESC
+	`, IncidentResolved)
+	return incidents
+}
+
+// RecentIncidents returns incidents resolved within the last days
+func RecentIncidents(days int) []*Incident {
+	incidents, _ := Incidents.Search(`
+		WHERE Status = ? AND ResolvedAt > ?
+		ORDER BY ResolvedAt DESC
+	`, IncidentResolved, time.Now().AddDate(0, 0, -days))
+	return incidents
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/The-Skyscape/devtools/pkg/authentication"
+	"github.com/pkg/errors"
+)
+
+// DefaultInviteQuota is how many invites each user may create unless their
+// profile overrides it
+const DefaultInviteQuota = 5
+
+// InviteOnly returns true when signups require an invite code
+func InviteOnly() bool {
+	return os.Getenv("INVITE_ONLY") == "true"
+}
+
+// Invite is a single-use signup code. The inviter/invitee pair is kept after
+// use so growth can be attributed.
+type Invite struct {
+	application.Model
+	Code      string
+	InviterID string
+	Email     string // Set when issued to a waitlist entry
+	InviteeID string // Set once redeemed
+	UsedAt    time.Time
+}
+
+func (*Invite) Table() string { return "invites" }
+
+// Inviter returns the user who created the invite
+func (i *Invite) Inviter() *authentication.User {
+	user, _ := Auth.Users.Get(i.InviterID)
+	return user
+}
+
+// Invitee returns the user who redeemed the invite
+func (i *Invite) Invitee() *authentication.User {
+	if i.InviteeID == "" {
+		return nil
+	}
+	user, _ := Auth.Users.Get(i.InviteeID)
+	return user
+}
+
+// IsUsed returns true once the invite has been redeemed
+func (i *Invite) IsUsed() bool {
+	return i.InviteeID != ""
+}
+
+// URL returns the signup link with the code prefilled
+func (i *Invite) URL() string {
+	return "https://www.theskyscape.com/signup?invite=" + i.Code
+}
+
+// CreateInvite issues a new invite code for the inviter
+func CreateInvite(inviterID, email string) (*Invite, error) {
+	buf := make([]byte, 5)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, errors.Wrap(err, "failed to generate invite code")
+	}
+
+	return Invites.Insert(&Invite{
+		Code:      base32.StdEncoding.EncodeToString(buf),
+		InviterID: inviterID,
+		Email:     email,
+	})
+}
+
+// FindInvite returns the unused invite with the given code
+func FindInvite(code string) (*Invite, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return nil, errors.New("an invite code is required to sign up")
+	}
+
+	invite, err := Invites.First("WHERE Code = ? AND InviteeID = ''", code)
+	if err != nil {
+		return nil, errors.New("invalid or already used invite code")
+	}
+
+	return invite, nil
+}
+
+// Redeem marks the invite as used by the new user
+func (i *Invite) Redeem(userID string) error {
+	i.InviteeID = userID
+	i.UsedAt = time.Now()
+	return Invites.Update(i)
+}
+
+// InviteQuota returns how many invites the user may create in total
+func (p *Profile) InviteQuota() int {
+	if p.InviteLimit > 0 {
+		return p.InviteLimit
+	}
+	return DefaultInviteQuota
+}
+
+// RemainingInvites returns how many more invites the user may create
+func (p *Profile) RemainingInvites() int {
+	used := Invites.Count("WHERE InviterID = ?", p.UserID)
+	return max(p.InviteQuota()-used, 0)
+}
+
+// InvitedCount returns how many users joined with this user's invites
+func (p *Profile) InvitedCount() int {
+	return Invites.Count("WHERE InviterID = ? AND InviteeID != ''", p.UserID)
+}
+
+// WaitlistEntry is someone asking for an invite while signups are closed
+type WaitlistEntry struct {
+	application.Model
+	Email    string
+	Name     string
+	Reason   string // What they want to build
+	InviteID string // Set once an admin invites them
+}
+
+func (*WaitlistEntry) Table() string { return "waitlist_entries" }
+
+// Invite returns the invite sent to this entry, if any
+func (w *WaitlistEntry) Invite() *Invite {
+	if w.InviteID == "" {
+		return nil
+	}
+	invite, _ := Invites.Get(w.InviteID)
+	return invite
+}
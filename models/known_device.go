@@ -0,0 +1,89 @@
+package models
+
+import (
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+)
+
+// KnownDeviceExpiry is how long a device or network stays recognized after
+// it was last used to sign in
+const KnownDeviceExpiry = 180 * 24 * time.Hour
+
+// KnownDevice is a browser and network a user has signed in from. Signing
+// in from a browser or network the user hasn't used before sends them an
+// alert.
+type KnownDevice struct {
+	application.Model
+	UserID     string
+	Device     string // Browser and OS, e.g. "Chrome on macOS"
+	Network    string // The IP's network, see ipNetwork
+	IP         string // Most recent IP on the network
+	LastSeenAt time.Time
+}
+
+func (*KnownDevice) Table() string { return "known_devices" }
+
+// RecognizeSignin records a sign-in and reports whether the user has signed
+// in with this browser and from this network before. A user's first
+// sign-in is always recognized, since there's nothing to compare it to.
+func RecognizeSignin(userID, device, ip string) bool {
+	network := ipNetwork(ip)
+	known, _ := KnownDevices.Search(`
+		WHERE UserID = ? AND LastSeenAt > ?
+	`, userID, time.Now().Add(-KnownDeviceExpiry))
+
+	// Users who signed in before devices were tracked start from the
+	// sessions they already have
+	if len(known) == 0 {
+		for _, s := range SessionsOf(userID) {
+			if k, err := rememberDevice(userID, s.Device, s.IP); err == nil {
+				known = append(known, k)
+			}
+		}
+	}
+
+	first := len(known) == 0
+	recognized := slices.ContainsFunc(known, func(k *KnownDevice) bool { return k.Device == device }) &&
+		slices.ContainsFunc(known, func(k *KnownDevice) bool { return k.Network == network })
+	rememberDevice(userID, device, ip)
+	return first || recognized
+}
+
+// rememberDevice adds or refreshes a known device
+func rememberDevice(userID, device, ip string) (*KnownDevice, error) {
+	network := ipNetwork(ip)
+	if k, err := KnownDevices.First("WHERE UserID = ? AND Device = ? AND Network = ?", userID, device, network); err == nil {
+		k.IP = ip
+		k.LastSeenAt = time.Now()
+		return k, KnownDevices.Update(k)
+	}
+	return KnownDevices.Insert(&KnownDevice{
+		UserID:     userID,
+		Device:     device,
+		Network:    network,
+		IP:         ip,
+		LastSeenAt: time.Now(),
+	})
+}
+
+// ipNetwork returns the network an IP belongs to: the /24 for IPv4 and
+// the /48 for IPv6. Home and mobile IPs change often within their network,
+// so comparing whole addresses would alert on nearly every sign-in.
+func ipNetwork(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	bits := 48
+	if addr.Unmap().Is4() {
+		addr, bits = addr.Unmap(), 24
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ip
+	}
+	return prefix.String()
+}
@@ -38,3 +38,8 @@ func (m *Message) MarkAsRead() error {
 	m.Read = true
 	return Messages.Update(m)
 }
+
+// Cursor returns the token for paging past this message
+func (m *Message) Cursor() string {
+	return EncodeCursor(m.CreatedAt, m.ID)
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// siteURL is the public origin used for absolute links in shared cards
+const siteURL = "https://www.theskyscape.com"
+
+// Meta describes how a page unfurls when its link is shared, rendered as
+// Open Graph and Twitter card tags by views/partials/layout/social-meta.html
+type Meta struct {
+	Type        string // Open Graph type: "website", "article" or "profile"
+	Title       string
+	Description string
+	Image       string // Absolute URL
+	URL         string // Absolute canonical URL
+	LargeImage  bool   // Use Twitter's summary_large_image card
+	NoIndex     bool   // Ask search engines not to index the page
+}
+
+// Meta for a user's profile page
+func (p *Profile) Meta() Meta {
+	return Meta{
+		Type:        "profile",
+		Title:       p.Name() + " (@" + p.Handle() + ") | The Skyscape",
+		Description: summary(p.Description, "@"+p.Handle()+" on The Skyscape."),
+		Image:       absoluteURL(p.Avatar()),
+		URL:         siteURL + "/user/" + p.Handle(),
+		NoIndex:     p.NoIndex,
+	}
+}
+
+// Meta for a published thought
+func (t *Thought) Meta() Meta {
+	if t.Takedown() != nil {
+		return removedMeta("/thought/" + t.ID)
+	}
+	description := "A thought on The Skyscape."
+	if p := t.Profile(); p != nil {
+		description = "A thought by @" + p.Handle() + " on The Skyscape."
+	}
+	return Meta{
+		Type:        "article",
+		Title:       t.Title + " | The Skyscape",
+		Description: summary(t.BlocksToMarkdown(), description),
+		Image:       siteURL + "/og/thought/" + t.ID + ".png",
+		URL:         siteURL + "/thought/" + t.ID,
+		LargeImage:  true,
+		NoIndex:     !t.Published,
+	}
+}
+
+// Meta for a feed post
+func (a *Activity) Meta() Meta {
+	if a.Takedown() != nil {
+		return removedMeta("/post/" + a.ID)
+	}
+	m := Meta{
+		Type:        "article",
+		Title:       "Post on The Skyscape",
+		Description: summary(a.Content, "A post on The Skyscape."),
+		URL:         siteURL + "/post/" + a.ID,
+	}
+	if p := a.UserProfile(); p != nil {
+		m.Title = "@" + p.Handle() + "'s post on The Skyscape"
+		m.Image = absoluteURL(p.Avatar())
+	}
+	if a.FileID != "" {
+		if file, err := Files.Get(a.FileID); err == nil && strings.HasPrefix(file.MimeType, "image/") {
+			m.Image, m.LargeImage = absoluteURL(file.URL()), true
+		}
+	}
+	return m
+}
+
+// Meta for a repository page
+func (r *Repo) Meta() Meta {
+	if r.Takedown() != nil {
+		return removedMeta("/repo/" + r.ID)
+	}
+	m := Meta{
+		Type:        "website",
+		Title:       r.Name + " | The Skyscape",
+		Description: summary(r.Description, "A repository on The Skyscape."),
+		Image:       siteURL + "/og/repo/" + r.ID + ".png",
+		URL:         siteURL + "/repo/" + r.ID,
+		LargeImage:  true,
+	}
+	if owner := r.Owner(); owner != nil {
+		m.Title = owner.Handle + "/" + r.Name + " | The Skyscape"
+	}
+	return m
+}
+
+// Meta for a project page
+func (p *Project) Meta() Meta {
+	if p.Takedown() != nil {
+		return removedMeta("/project/" + p.ID)
+	}
+	return Meta{
+		Type:        "website",
+		Title:       p.Name + " | The Skyscape",
+		Description: summary(p.Description, "A project on The Skyscape."),
+		Image:       siteURL + "/og/project/" + p.ID + ".png",
+		URL:         siteURL + "/project/" + p.ID,
+		LargeImage:  true,
+	}
+}
+
+// Meta for an app page
+func (a *App) Meta() Meta {
+	if a.Takedown() != nil {
+		return removedMeta("/app/" + a.ID)
+	}
+	m := Meta{
+		Type:        "website",
+		Title:       a.Name + " | The Skyscape",
+		Description: summary(a.Description, "An app on The Skyscape."),
+		URL:         siteURL + "/app/" + a.ID,
+	}
+	if owner := a.Owner(); owner != nil {
+		m.Image = absoluteURL(owner.Avatar)
+	}
+	return m
+}
+
+// removedMeta keeps taken down content out of link previews
+func removedMeta(path string) Meta {
+	return Meta{
+		Type:        "website",
+		Title:       "Content removed | The Skyscape",
+		Description: "This content was removed by The Skyscape moderators.",
+		URL:         siteURL + path,
+		NoIndex:     true,
+	}
+}
+
+// maxDescription is about what link previews show before truncating
+const maxDescription = 200
+
+// summary flattens text to a single line short enough for a card,
+// falling back when there is no text
+func summary(text, fallback string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if text == "" {
+		return fallback
+	}
+	if utf8.RuneCountInString(text) > maxDescription {
+		text = string([]rune(text)[:maxDescription-1]) + "…"
+	}
+	return text
+}
+
+// absoluteURL makes site-relative URLs absolute, since crawlers fetch card
+// images without knowing which page they came from
+func absoluteURL(u string) string {
+	if u == "" || strings.HasPrefix(u, "https://") || strings.HasPrefix(u, "http://") {
+		return u
+	}
+	return siteURL + "/" + strings.TrimPrefix(u, "/")
+}
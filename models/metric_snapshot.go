@@ -0,0 +1,89 @@
+package models
+
+import (
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+)
+
+// MetricSnapshot caches the platform aggregates for a single day so the
+// admin dashboard doesn't rerun every count on each page load
+type MetricSnapshot struct {
+	application.Model
+	Day          string // Date in YYYY-MM-DD (UTC)
+	Signups      int
+	ActiveUsers  int // Users who posted, commented, or messaged that day
+	Posts        int
+	Builds       int
+	FailedBuilds int
+	Revenue      int64 // Completed payments in cents
+}
+
+func (*MetricSnapshot) Table() string { return "metric_snapshots" }
+
+// snapshotRefresh is how stale today's snapshot may get before recomputing
+const snapshotRefresh = 10 * time.Minute
+
+// FormatRevenue returns the day's revenue formatted as currency
+func (s *MetricSnapshot) FormatRevenue() string {
+	return "$" + formatFloat(float64(s.Revenue)/100)
+}
+
+// DailySnapshot returns the cached metrics for the given day, computing
+// them if missing. Past days are immutable; today is refreshed periodically.
+func DailySnapshot(day time.Time) (*MetricSnapshot, error) {
+	start := day.UTC().Truncate(24 * time.Hour)
+	key := start.Format("2006-01-02")
+	isToday := key == time.Now().UTC().Format("2006-01-02")
+
+	snapshot, err := MetricSnapshots.First("WHERE Day = ?", key)
+	if err == nil && (!isToday || time.Since(snapshot.UpdatedAt) < snapshotRefresh) {
+		return snapshot, nil
+	}
+
+	fresh := computeSnapshot(start)
+	fresh.Day = key
+	if err != nil {
+		return MetricSnapshots.Insert(fresh)
+	}
+
+	fresh.Model = snapshot.Model
+	return fresh, MetricSnapshots.Update(fresh)
+}
+
+// RecentSnapshots returns snapshots for the last n days, oldest first
+func RecentSnapshots(days int) []*MetricSnapshot {
+	var snapshots []*MetricSnapshot
+	now := time.Now()
+	for i := days - 1; i >= 0; i-- {
+		if s, err := DailySnapshot(now.AddDate(0, 0, -i)); err == nil {
+			snapshots = append(snapshots, s)
+		}
+	}
+	return snapshots
+}
+
+// computeSnapshot runs the aggregate queries for the day starting at start
+func computeSnapshot(start time.Time) *MetricSnapshot {
+	end := start.Add(24 * time.Hour)
+	s := &MetricSnapshot{
+		Signups: Auth.Users.Count("WHERE CreatedAt >= ? AND CreatedAt < ?", start, end),
+		ActiveUsers: Auth.Users.Count(`
+			WHERE ID IN (
+				SELECT UserID FROM activities WHERE CreatedAt >= $1 AND CreatedAt < $2
+				UNION SELECT UserID FROM comments WHERE CreatedAt >= $1 AND CreatedAt < $2
+				UNION SELECT SenderID FROM messages WHERE CreatedAt >= $1 AND CreatedAt < $2
+			)
+		`, start, end),
+		Posts:        Activities.Count("WHERE Action = 'posted' AND CreatedAt >= ? AND CreatedAt < ?", start, end),
+		Builds:       Images.Count("WHERE CreatedAt >= ? AND CreatedAt < ?", start, end),
+		FailedBuilds: Images.Count("WHERE Status = 'failed' AND CreatedAt >= ? AND CreatedAt < ?", start, end),
+	}
+
+	payments, _ := Payments.Search("WHERE Status = ? AND CreatedAt >= ? AND CreatedAt < ?", PaymentCompleted, start, end)
+	for _, p := range payments {
+		s.Revenue += p.Amount
+	}
+
+	return s
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+)
+
+// Notification kinds a hook can relay
+const (
+	NotifyMessage = "message"
+	NotifyPost    = "post"
+	NotifyFollow  = "follow"
+	NotifyComment = "comment"
+	NotifyMention = "mention"
+	NotifyDeploy  = "deploy"
+	NotifyStar    = "star"
+	NotifyApp     = "app" // Sent by a project the user authorized
+)
+
+// NotifySignin alerts a user to a sign-in from a new device. It's always
+// pushed and emailed, so it isn't one of the NotificationKinds users can
+// turn off.
+const NotifySignin = "signin"
+
+// NotificationKinds lists every kind, in the order settings shows them
+var NotificationKinds = []string{NotifyFollow, NotifyMention, NotifyComment, NotifyMessage, NotifyPost, NotifyStar, NotifyDeploy, NotifyApp}
+
+// NotificationHook relays a user's notifications to a chat webhook
+type NotificationHook struct {
+	application.Model
+	UserID     string
+	Service    string // "slack", "discord" or "telegram"
+	URL        string // Incoming webhook URL, or the bot token for Telegram
+	ChatID     string // Telegram chat to post in
+	Kinds      string // Comma-separated notification kinds to relay
+	LastSentAt time.Time
+	LastError  string // Error from the most recent delivery, if it failed
+}
+
+func (*NotificationHook) Table() string { return "notification_hooks" }
+
+// Relays reports whether the hook is subscribed to a notification kind
+func (h *NotificationHook) Relays(kind string) bool {
+	return slices.Contains(strings.Split(h.Kinds, ","), kind)
+}
+
+// Destination is a display-safe description of where the hook posts,
+// without the secret part of the URL or token
+func (h *NotificationHook) Destination() string {
+	if h.ChatID != "" {
+		return "chat " + h.ChatID
+	}
+	if i := strings.Index(strings.TrimPrefix(h.URL, "https://"), "/"); i > 0 {
+		return strings.TrimPrefix(h.URL, "https://")[:i]
+	}
+	return h.Service
+}
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"slices"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+)
+
+// Notification channels a user can choose per kind
+const (
+	ChannelAll   = "all" // Push and email
+	ChannelPush  = "push"
+	ChannelEmail = "email"
+	ChannelNone  = "none"
+)
+
+// EmailKinds are the notification kinds that have an email; the rest can
+// only be pushed
+var EmailKinds = []string{NotifyFollow, NotifyComment, NotifyMessage, NotifyPost, NotifyStar}
+
+// PushIntervals are the batching choices in minutes: pushes that arrive
+// within one interval of the last are coalesced into a single notification
+var PushIntervals = []int{5, 15, 60, 240}
+
+// DefaultPushInterval is used until a user picks one
+const DefaultPushInterval = 15
+
+// NotificationSettings records how a user wants each kind of notification
+// delivered. Kinds left blank use their default: every channel the kind
+// supports. Open tabs and chat hooks are unaffected.
+type NotificationSettings struct {
+	application.Model
+	UserID       string
+	Follow       string
+	Mention      string
+	Comment      string
+	Message      string
+	Post         string
+	Deploy       string
+	Star         string
+	App          string
+	PushInterval int // Minutes between batched pushes, one of PushIntervals
+}
+
+func (*NotificationSettings) Table() string { return "notification_settings" }
+
+// NotificationSettingsFor returns a user's settings, or the defaults if the
+// user never changed them
+func NotificationSettingsFor(userID string) *NotificationSettings {
+	settings, err := NotificationSettingsManager.First("WHERE UserID = ?", userID)
+	if err != nil || settings == nil {
+		return &NotificationSettings{UserID: userID}
+	}
+	return settings
+}
+
+// Channels lists the choices a kind offers in settings
+func Channels(kind string) []string {
+	if slices.Contains(EmailKinds, kind) {
+		return []string{ChannelAll, ChannelPush, ChannelEmail, ChannelNone}
+	}
+	return []string{ChannelPush, ChannelNone}
+}
+
+// Channel returns how a kind is delivered, falling back to its default
+func (s *NotificationSettings) Channel(kind string) string {
+	var channel string
+	switch kind {
+	case NotifyFollow:
+		channel = s.Follow
+	case NotifyMention:
+		channel = s.Mention
+	case NotifyComment:
+		channel = s.Comment
+	case NotifyMessage:
+		channel = s.Message
+	case NotifyPost:
+		channel = s.Post
+	case NotifyDeploy:
+		channel = s.Deploy
+	case NotifyStar:
+		channel = s.Star
+	case NotifyApp:
+		channel = s.App
+	}
+	if !slices.Contains(Channels(kind), channel) {
+		return Channels(kind)[0]
+	}
+	return channel
+}
+
+// SetChannel changes how a kind is delivered, ignoring unsupported choices
+func (s *NotificationSettings) SetChannel(kind, channel string) {
+	if !slices.Contains(Channels(kind), channel) {
+		return
+	}
+	switch kind {
+	case NotifyFollow:
+		s.Follow = channel
+	case NotifyMention:
+		s.Mention = channel
+	case NotifyComment:
+		s.Comment = channel
+	case NotifyMessage:
+		s.Message = channel
+	case NotifyPost:
+		s.Post = channel
+	case NotifyDeploy:
+		s.Deploy = channel
+	case NotifyStar:
+		s.Star = channel
+	case NotifyApp:
+		s.App = channel
+	}
+}
+
+// IntervalMinutes returns how many minutes pushes are batched for, falling
+// back to the default
+func (s *NotificationSettings) IntervalMinutes() int {
+	if !slices.Contains(PushIntervals, s.PushInterval) {
+		return DefaultPushInterval
+	}
+	return s.PushInterval
+}
+
+// Interval returns how long pushes are batched for
+func (s *NotificationSettings) Interval() time.Duration {
+	return time.Duration(s.IntervalMinutes()) * time.Minute
+}
+
+// SetInterval changes the batching interval, ignoring unsupported choices
+func (s *NotificationSettings) SetInterval(minutes int) {
+	if slices.Contains(PushIntervals, minutes) {
+		s.PushInterval = minutes
+	}
+}
+
+// Save inserts or updates the settings
+func (s *NotificationSettings) Save() error {
+	if s.ID == "" {
+		_, err := NotificationSettingsManager.Insert(s)
+		return err
+	}
+	return NotificationSettingsManager.Update(s)
+}
+
+// WantsPush reports whether a user wants a kind pushed to their devices
+func WantsPush(userID, kind string) bool {
+	channel := NotificationSettingsFor(userID).Channel(kind)
+	return channel == ChannelAll || channel == ChannelPush
+}
+
+// WantsEmail reports whether a user wants a kind emailed to them
+func WantsEmail(userID, kind string) bool {
+	channel := NotificationSettingsFor(userID).Channel(kind)
+	return channel == ChannelAll || channel == ChannelEmail
+}
@@ -3,6 +3,8 @@ package models
 import (
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/The-Skyscape/devtools/pkg/application"
@@ -12,11 +14,14 @@ import (
 // OAuthAuthorization represents a user's consent to allow an app/project to access their data
 type OAuthAuthorization struct {
 	application.Model
-	UserID    string
-	AppID     string // legacy - for App authorizations
-	ProjectID string // new - for Project authorizations
-	Scopes    string // space-separated granted scopes
-	Revoked   bool
+	UserID     string
+	AppID      string // legacy - for App authorizations
+	ProjectID  string // new - for Project authorizations
+	Scopes     string // space-separated granted scopes
+	Revoked    bool
+	RevokedAt  time.Time // Tokens issued before this are rejected even after re-authorizing
+	LastUsedAt time.Time // Last API request, updated at most every SessionSeenInterval
+	Muted      bool      // User turned off notifications from this app, see the service API
 }
 
 func (*OAuthAuthorization) Table() string { return "oauth_authorizations" }
@@ -45,12 +50,101 @@ func (a *OAuthAuthorization) Project() *Project {
 	return project
 }
 
-// Revoke marks this authorization as revoked
+// ScopeList returns the granted scopes
+func (a *OAuthAuthorization) ScopeList() []string {
+	return strings.Fields(a.Scopes)
+}
+
+// Revoke marks this authorization as revoked, invalidating every access
+// token issued for it so far
 func (a *OAuthAuthorization) Revoke() error {
 	a.Revoked = true
+	a.RevokedAt = time.Now()
 	return OAuthAuthorizations.Update(a)
 }
 
+// ClientID returns the ID of the app or project this authorization is for
+func (a *OAuthAuthorization) ClientID() string {
+	if a.ProjectID != "" {
+		return a.ProjectID
+	}
+	return a.AppID
+}
+
+// MarkUsed records that the client just made a request with the user's
+// token, at most every SessionSeenInterval
+func (a *OAuthAuthorization) MarkUsed() {
+	if time.Since(a.LastUsedAt) < SessionSeenInterval {
+		return
+	}
+	a.LastUsedAt = time.Now()
+	OAuthAuthorizations.Update(a)
+}
+
+// AuthorizationsOf returns the apps and projects a user has given access to
+// their account, most recently used first
+func AuthorizationsOf(userID string) []*OAuthAuthorization {
+	authorizations, _ := OAuthAuthorizations.Search(`
+		WHERE UserID = ? AND Revoked = false
+		ORDER BY LastUsedAt DESC, CreatedAt DESC
+	`, userID)
+	return authorizations
+}
+
+// How far the consent screen can vouch for an OAuth client
+const (
+	ClientVerified    = "verified"    // Owned by a verified developer
+	ClientEstablished = "established" // Used by many people for a while
+	ClientNew         = "new"         // Neither, so users should take care
+)
+
+// Clients become established once this many people have used them for
+// this long
+const (
+	EstablishedClientUsers = 25
+	EstablishedClientAge   = 30 * 24 * time.Hour
+)
+
+// ClientVerification returns the verification level of a client from its
+// owner's profile, when it was created and how many users authorized it
+func ClientVerification(owner *Profile, createdAt time.Time, users int) string {
+	switch {
+	case owner != nil && owner.Verified && !owner.Suspended:
+		return ClientVerified
+	case users >= EstablishedClientUsers && time.Since(createdAt) >= EstablishedClientAge:
+		return ClientEstablished
+	default:
+		return ClientNew
+	}
+}
+
+// ScopeDescriptions explains each OAuth scope to the user granting it
+var ScopeDescriptions = map[string]string{
+	"user:read":      "Read your profile information",
+	"user:write":     "Update your profile information",
+	"repo:read":      "Read your repositories",
+	"repo:write":     "Create and update repositories",
+	"app:read":       "Read your applications",
+	"app:write":      "Create and manage applications",
+	"follow:read":    "See who you follow and who follows you",
+	"post:read":      "Read your feed and the posts you can see",
+	"post:write":     "Post to the feed as you",
+	"thought:write":  "Read, write and publish your thoughts, drafts included",
+	"message:write":  "Read your messages and send messages as you",
+	"project:deploy": "Deploy your projects",
+	"openid":         "Sign you in with your Skyscape account",
+	"profile":        "See your name, handle and avatar",
+	"email":          "See your email address",
+}
+
+// ScopeDescription explains a scope, or returns it as is if it's unknown
+func ScopeDescription(scope string) string {
+	if description, ok := ScopeDescriptions[scope]; ok {
+		return description
+	}
+	return scope
+}
+
 // OAuthAuthorizationCode represents a short-lived code used to exchange for an access token
 type OAuthAuthorizationCode struct {
 	application.Model
@@ -59,6 +153,7 @@ type OAuthAuthorizationCode struct {
 	Code        string // SHA-256 hashed
 	RedirectURI string
 	Scopes      string // space-separated
+	Nonce       string // OpenID Connect nonce, echoed in the ID token
 	ExpiresAt   time.Time
 	Used        bool
 }
@@ -75,10 +170,21 @@ func (c *OAuthAuthorizationCode) IsValid() bool {
 	return !c.Used && !c.IsExpired()
 }
 
-// MarkAsUsed marks this code as used
+// MarkAsUsed marks this code as used. The write is checked against the
+// primary, so a code the replica still shows as unused can't be redeemed
+// twice.
 func (c *OAuthAuthorizationCode) MarkAsUsed() error {
+	var id string
+	err := DB.Query(`
+		UPDATE oauth_authorization_codes SET Used = true, UpdatedAt = ?
+		WHERE ID = ? AND Used = false
+		RETURNING ID
+	`, time.Now(), c.ID).Scan(&id)
+	if err != nil {
+		return errors.New("authorization code already used")
+	}
 	c.Used = true
-	return OAuthAuthorizationCodes.Update(c)
+	return nil
 }
 
 // VerifyCode checks if the provided code matches the stored hash
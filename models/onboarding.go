@@ -0,0 +1,102 @@
+package models
+
+// Onboarding step keys
+const (
+	StepProfile = "profile"
+	StepProject = "project"
+	StepPush    = "push"
+	StepFollow  = "follow"
+)
+
+// OnboardingFollows is how many people a new user is nudged to follow
+const OnboardingFollows = 3
+
+// OnboardingStep is one item on the welcome checklist
+type OnboardingStep struct {
+	Key   string
+	Title string
+	Tip   string // Shown while this is the next step
+	URL   string // Where to go to do it
+	Done  bool
+}
+
+// Onboarding is a new user's welcome checklist. Steps are worked out from
+// what the user has already done, so nothing needs recording as they go.
+type Onboarding struct {
+	Steps []*OnboardingStep
+}
+
+// Onboarding returns the profile's checklist, or nil once it's finished or
+// dismissed
+func (p *Profile) Onboarding() *Onboarding {
+	if p.OnboardingDismissed {
+		return nil
+	}
+
+	pushURL := "/projects"
+	if project, err := Projects.First("WHERE OwnerID = ? ORDER BY CreatedAt DESC", p.UserID); err == nil {
+		pushURL = "/project/" + project.ID
+	}
+
+	o := &Onboarding{Steps: []*OnboardingStep{{
+		Key:   StepProfile,
+		Title: "Complete your profile",
+		Tip:   "Add a bio and an avatar so people know who they're following.",
+		URL:   "/user/" + p.Handle(),
+		Done:  p.Description != "" && p.AvatarFileID != "",
+	}, {
+		Key:   StepProject,
+		Title: "Create a project",
+		Tip:   "A project is your code and its hosting in one place. Start from a template and it's live in a minute.",
+		URL:   "/projects",
+		Done:  Projects.Count("WHERE OwnerID = ?", p.UserID) > 0,
+	}, {
+		Key:   StepPush,
+		Title: "Make your first push",
+		Tip:   "Clone your project, commit a change and push it. Every push rebuilds and redeploys.",
+		URL:   pushURL,
+		Done:  Activities.Count("WHERE UserID = ? AND Action = 'pushed'", p.UserID) > 0,
+	}, {
+		Key:   StepFollow,
+		Title: "Follow 3 people",
+		Tip:   "Follow a few builders to fill your feed with what they ship.",
+		URL:   "/users",
+		Done:  p.FollowingTotal >= OnboardingFollows,
+	}}}
+
+	if o.Finished() {
+		return nil
+	}
+	return o
+}
+
+// Next returns the first step not done yet
+func (o *Onboarding) Next() *OnboardingStep {
+	for _, step := range o.Steps {
+		if !step.Done {
+			return step
+		}
+	}
+	return nil
+}
+
+// Completed returns how many steps are done
+func (o *Onboarding) Completed() int {
+	n := 0
+	for _, step := range o.Steps {
+		if step.Done {
+			n++
+		}
+	}
+	return n
+}
+
+// Finished reports whether every step is done
+func (o *Onboarding) Finished() bool {
+	return o.Completed() == len(o.Steps)
+}
+
+// Percent returns progress through the checklist, 0-100
+func (o *Onboarding) Percent() int {
+	return o.Completed() * 100 / len(o.Steps)
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"www.theskyscape.com/internal/webauthn"
+)
+
+// PasskeyChallengeTTL is how long the browser has to answer a passkey
+// prompt
+const PasskeyChallengeTTL = 5 * time.Minute
+
+// Passkey ceremonies
+const (
+	PasskeyRegister = "register"
+	PasskeySignin   = "signin"
+)
+
+// WebAuthnCredential is a passkey a user can sign in with instead of their
+// password
+type WebAuthnCredential struct {
+	application.Model
+	UserID       string
+	CredentialID string // Base64url, as browsers send it
+	PublicKey    string // Base64url COSE key
+	SignCount    int64  // Authenticator's counter, to spot cloned keys
+	Name         string // Label the user gave it, e.g. "MacBook"
+	LastUsedAt   time.Time
+}
+
+func (*WebAuthnCredential) Table() string {
+	return "webauthn_credentials"
+}
+
+// PasskeysOf returns a user's passkeys, most recently used first
+func PasskeysOf(userID string) []*WebAuthnCredential {
+	passkeys, _ := WebAuthnCredentials.Search(`
+		WHERE UserID = ?
+		ORDER BY LastUsedAt DESC, CreatedAt DESC
+	`, userID)
+	return passkeys
+}
+
+// FindPasskey looks a passkey up by the credential ID the browser sent
+func FindPasskey(credentialID string) (*WebAuthnCredential, error) {
+	return WebAuthnCredentials.First("WHERE CredentialID = ?", credentialID)
+}
+
+// Key returns the passkey's decoded COSE public key
+func (p *WebAuthnCredential) Key() []byte {
+	key, _ := webauthn.Encoding.DecodeString(p.PublicKey)
+	return key
+}
+
+// WebAuthnChallenge is a passkey prompt waiting for the browser's answer.
+// Each challenge can be answered once.
+type WebAuthnChallenge struct {
+	application.Model
+	UserID    string // Who is registering; empty when signing in
+	Challenge string
+	Purpose   string // PasskeyRegister or PasskeySignin
+	ExpiresAt time.Time
+}
+
+func (*WebAuthnChallenge) Table() string {
+	return "webauthn_challenges"
+}
+
+// NewPasskeyChallenge starts a passkey ceremony
+func NewPasskeyChallenge(userID, purpose string) (string, error) {
+	DB.Query("DELETE FROM webauthn_challenges WHERE ExpiresAt < ?", time.Now()).Exec()
+	challenge, err := WebAuthnChallenges.Insert(&WebAuthnChallenge{
+		UserID:    userID,
+		Challenge: webauthn.NewChallenge(),
+		Purpose:   purpose,
+		ExpiresAt: time.Now().Add(PasskeyChallengeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return challenge.Challenge, nil
+}
+
+// UsePasskeyChallenge finds an unexpired challenge for a ceremony and uses
+// it up
+func UsePasskeyChallenge(challenge, userID, purpose string) error {
+	c, err := WebAuthnChallenges.First(`
+		WHERE Challenge = ? AND UserID = ? AND Purpose = ?
+	`, challenge, userID, purpose)
+	if err != nil {
+		return errors.New("passkey prompt expired, please try again")
+	}
+	WebAuthnChallenges.Delete(c)
+
+	if time.Now().After(c.ExpiresAt) {
+		return errors.New("passkey prompt expired, please try again")
+	}
+	return nil
+}
@@ -12,6 +12,7 @@ const (
 	PaymentPromotion       = "promotion"
 	PaymentVerified        = "verified"
 	PaymentResourceUpgrade = "resource_upgrade"
+	PaymentCredit          = "credit" // Account credit issued, not charged
 )
 
 // PaymentStatus represents the state of a payment
@@ -32,6 +33,7 @@ type Payment struct {
 	Currency        string // "usd"
 	Status          string // "pending", "completed", "failed", "refunded"
 	CompletedAt     *time.Time
+	CreditApplied   int64 // Cents covered by account credit on top of Amount
 }
 
 func (*Payment) Table() string { return "payments" }
@@ -90,6 +92,11 @@ func (p *Payment) FormatAmount() string {
 	return "$" + formatFloat(dollars)
 }
 
+// FormatCreditApplied returns the account credit spent formatted as currency
+func (p *Payment) FormatCreditApplied() string {
+	return "$" + formatFloat(float64(p.CreditApplied)/100)
+}
+
 func formatFloat(f float64) string {
 	dollars := int64(f)
 	cents := int64(f*100+0.5) % 100
@@ -0,0 +1,206 @@
+package models
+
+import (
+	"context"
+	"strings"
+
+	"github.com/The-Skyscape/devtools/pkg/authentication"
+	"go.opentelemetry.io/otel/attribute"
+	"www.theskyscape.com/internal/tracing"
+)
+
+// activityPreload holds everything feed-post.html renders for an activity,
+// loaded for a whole page at once by PreloadActivities. Activities without
+// a preload fall back to querying on demand.
+type activityPreload struct {
+	user      *authentication.User
+	profile   *Profile
+	subject   any
+	file      *File
+	takedown  *Takedown
+	comments  []*Comment
+	reactions []*Reaction
+}
+
+// commentPreload holds a comment's author, see PreloadActivities
+type commentPreload struct {
+	user    *authentication.User
+	profile *Profile
+}
+
+// PreloadActivities batch-loads the authors, subjects, files, takedowns,
+// comments and reactions of a page of activities with one query per kind,
+// instead of several queries per activity at render time. The queries are
+// traced as one span under ctx.
+func PreloadActivities(ctx context.Context, activities []*Activity) {
+	if len(activities) == 0 {
+		return
+	}
+
+	_, span := tracing.Start(ctx, "PreloadActivities",
+		attribute.String("db.system.name", "libsql"),
+		attribute.Int("activities", len(activities)),
+	)
+	defer span.End()
+
+	var activityIDs, userIDs, fileIDs, subjectIDs []string
+	subjectsByType := map[string][]string{}
+	for _, a := range activities {
+		a.preload = &activityPreload{}
+		activityIDs = append(activityIDs, a.ID)
+		userIDs = append(userIDs, a.UserID)
+		if a.FileID != "" {
+			fileIDs = append(fileIDs, a.FileID)
+		}
+		if a.SubjectID != "" {
+			subjectType := a.SubjectType
+			if subjectType == "" {
+				subjectType = "repo" // Legacy activities predate SubjectType
+			}
+			subjectsByType[subjectType] = append(subjectsByType[subjectType], a.SubjectID)
+			subjectIDs = append(subjectIDs, a.SubjectID)
+		}
+	}
+
+	// Comments and reactions, capped per activity like the lazy loaders
+	comments := map[string][]*Comment{}
+	if rows, err := Comments.Search(`
+		WHERE SubjectType = 'post' AND SubjectID IN (`+placeholders(len(activityIDs))+`)
+		ORDER BY CreatedAt ASC
+	`, idArgs(activityIDs)...); err == nil {
+		for _, comment := range rows {
+			if len(comments[comment.SubjectID]) < 100 {
+				comments[comment.SubjectID] = append(comments[comment.SubjectID], comment)
+				userIDs = append(userIDs, comment.UserID)
+			}
+		}
+	}
+
+	reactions := map[string][]*Reaction{}
+	if rows, err := Reactions.Search(`
+		WHERE ActivityID IN (`+placeholders(len(activityIDs))+`)
+	`, idArgs(activityIDs)...); err == nil {
+		for _, reaction := range rows {
+			if len(reactions[reaction.ActivityID]) < 500 {
+				reactions[reaction.ActivityID] = append(reactions[reaction.ActivityID], reaction)
+			}
+		}
+	}
+
+	// Authors of activities and comments, plus profiles shared as subjects
+	profileIDs := append(append([]string{}, userIDs...), subjectsByType["profile"]...)
+	users := map[string]*authentication.User{}
+	if rows, err := Auth.Users.Search(`
+		WHERE ID IN (`+placeholders(len(userIDs))+`)
+	`, idArgs(userIDs)...); err == nil {
+		for _, u := range rows {
+			users[u.ID] = u
+		}
+	}
+
+	profiles := map[string]*Profile{}
+	if rows, err := Profiles.Search(`
+		WHERE UserID IN (`+placeholders(len(profileIDs))+`)
+	`, idArgs(profileIDs)...); err == nil {
+		for _, p := range rows {
+			profiles[p.UserID] = p
+		}
+	}
+
+	// Subjects, one query per subject type
+	subjects := map[string]any{}
+	if ids := subjectsByType["repo"]; len(ids) > 0 {
+		rows, _ := Repos.Search("WHERE ID IN ("+placeholders(len(ids))+")", idArgs(ids)...)
+		for _, row := range rows {
+			subjects["repo:"+row.ID] = row
+		}
+	}
+	if ids := subjectsByType["app"]; len(ids) > 0 {
+		rows, _ := Apps.Search("WHERE ID IN ("+placeholders(len(ids))+")", idArgs(ids)...)
+		for _, row := range rows {
+			subjects["app:"+row.ID] = row
+		}
+	}
+	if ids := subjectsByType["project"]; len(ids) > 0 {
+		rows, _ := Projects.Search("WHERE ID IN ("+placeholders(len(ids))+")", idArgs(ids)...)
+		for _, row := range rows {
+			subjects["project:"+row.ID] = row
+		}
+	}
+	if ids := subjectsByType["thought"]; len(ids) > 0 {
+		rows, _ := Thoughts.Search("WHERE ID IN ("+placeholders(len(ids))+")", idArgs(ids)...)
+		for _, row := range rows {
+			subjects["thought:"+row.ID] = row
+		}
+	}
+	for _, id := range subjectsByType["profile"] {
+		if p, ok := profiles[id]; ok {
+			subjects["profile:"+id] = p
+		}
+	}
+
+	files := map[string]*File{}
+	if len(fileIDs) > 0 {
+		rows, _ := Files.Search("WHERE ID IN ("+placeholders(len(fileIDs))+")", idArgs(fileIDs)...)
+		for _, f := range rows {
+			files[f.ID] = f
+		}
+	}
+
+	// Takedowns of the posts themselves and of the content they share
+	takedowns := map[string]*Takedown{}
+	takedownIDs := append(append([]string{}, activityIDs...), subjectIDs...)
+	if rows, err := Takedowns.Search(`
+		WHERE Active = true AND SubjectID IN (`+placeholders(len(takedownIDs))+`)
+	`, idArgs(takedownIDs)...); err == nil {
+		for _, t := range rows {
+			takedowns[t.SubjectType+":"+t.SubjectID] = t
+		}
+	}
+
+	for _, a := range activities {
+		subjectType := a.SubjectType
+		if subjectType == "" {
+			subjectType = "repo"
+		}
+
+		a.preload.user = users[a.UserID]
+		a.preload.profile = profiles[a.UserID]
+		a.preload.subject = subjects[subjectType+":"+a.SubjectID]
+		a.preload.file = files[a.FileID]
+		a.preload.comments = comments[a.ID]
+		a.preload.reactions = reactions[a.ID]
+
+		a.preload.takedown = takedowns[TakedownPost+":"+a.ID]
+		if a.preload.takedown == nil {
+			switch a.SubjectType {
+			case TakedownThought, TakedownRepo, TakedownProject, TakedownApp:
+				a.preload.takedown = takedowns[a.SubjectType+":"+a.SubjectID]
+			}
+		}
+
+		for _, comment := range a.preload.comments {
+			comment.preload = &commentPreload{
+				user:    users[comment.UserID],
+				profile: profiles[comment.UserID],
+			}
+		}
+	}
+}
+
+// placeholders returns n comma-separated SQL placeholders for an IN clause
+func placeholders(n int) string {
+	if n == 0 {
+		return "NULL"
+	}
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+// idArgs converts IDs to query arguments
+func idArgs(ids []string) []any {
+	result := make([]any, len(ids))
+	for i, id := range ids {
+		result[i] = id
+	}
+	return result
+}
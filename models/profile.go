@@ -2,19 +2,39 @@ package models
 
 import (
 	"cmp"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
 	"time"
 
 	"github.com/The-Skyscape/devtools/pkg/application"
 	"github.com/The-Skyscape/devtools/pkg/authentication"
 	"github.com/The-Skyscape/devtools/pkg/database"
+	"www.theskyscape.com/internal/i18n"
 )
 
 type Profile struct {
 	application.Model
-	UserID           string
-	Description      string
-	Verified         bool   // User has active Verified subscription
-	StripeCustomerID string // Stripe customer ID for billing
+	UserID              string
+	Description         string
+	Verified            bool   // User has active Verified subscription
+	StripeCustomerID    string // Stripe customer ID for billing
+	AvatarFileID        string // Processed 256px avatar upload
+	AvatarThumbID       string // Processed 64px avatar upload
+	Suspended           bool   // Cached from the user's active Suspension
+	EmailOptOut         bool   // Unsubscribed from admin broadcast emails
+	InviteLimit         int    // Overrides DefaultInviteQuota when set
+	FollowerTotal       int    // Cached follower count, see CountFollow
+	FollowingTotal      int    // Cached following count, see CountFollow
+	Locale              string // Preferred language, "" to follow the browser
+	NoIndex             bool   // Opted out of search engine indexing
+	CalendarToken       string // Secret in the calendar feed URL, see CalendarURL
+	Summaries           bool   // Opted in to AI commit summaries, see summaries.Enabled
+	OnboardingDismissed bool   // Hid the welcome checklist, see Onboarding
+	HiddenFeedKinds     string // Comma-separated FeedKinds left out of the home feed
+	Credit              int64  // Account credit in cents, from promotions stopped early
+	Version             int    // Bumped on every profile edit, see ClaimEdit
 }
 
 func (*Profile) Table() string { return "profiles" }
@@ -93,12 +113,12 @@ func (p *Profile) RecentFollowers(limit int) []*Follow {
 
 // FollowersCount returns the count of followers
 func (p *Profile) FollowersCount() int {
-	return Follows.Count("WHERE FolloweeID = ?", p.UserID)
+	return p.FollowerTotal
 }
 
 // FollowingCount returns the count of users this profile follows
 func (p *Profile) FollowingCount() int {
-	return Follows.Count("WHERE FollowerID = ?", p.UserID)
+	return p.FollowingTotal
 }
 
 // AppsCount returns the count of active apps owned by this profile
@@ -126,6 +146,15 @@ func (p *Profile) IsFollowing(userID string) bool {
 	return follow != nil
 }
 
+// EmailLocale returns the language to email the user in, since emails are
+// sent outside of any request to negotiate from
+func EmailLocale(userID string) string {
+	if p, err := Profiles.Get(userID); err == nil && i18n.Supported(p.Locale) {
+		return p.Locale
+	}
+	return i18n.Default
+}
+
 func (p *Profile) User() *authentication.User {
 	user, _ := Auth.Users.Get(p.UserID)
 	return user
@@ -140,7 +169,20 @@ func (p *Profile) Handle() string {
 }
 
 func (p *Profile) Avatar() string {
-	return cmp.Or(p.User(), &authentication.User{}).Avatar
+	return cmp.Or(cmp.Or(p.User(), &authentication.User{}).Avatar, IdenticonURL(p.UserID))
+}
+
+// AvatarThumb returns the small avatar variant, falling back to the full avatar
+func (p *Profile) AvatarThumb() string {
+	if p.AvatarThumbID != "" {
+		return "/file/" + p.AvatarThumbID
+	}
+	return p.Avatar()
+}
+
+// IdenticonURL returns the generated fallback avatar for a user
+func IdenticonURL(userID string) string {
+	return "/avatar/" + userID + ".png"
 }
 
 func CreateProfile(userID, description string) (*Profile, error) {
@@ -209,6 +251,25 @@ func (p *Profile) Messages(with *Profile, page, limit int) []*Message {
 	return messages
 }
 
+// MessagesBefore returns the page of messages with another profile that
+// follows the cursor, newest first
+func (p *Profile) MessagesBefore(with *Profile, cursor *Cursor, limit int) []*Message {
+	if with == nil {
+		return nil
+	}
+
+	before, args := cursor.Before("")
+	args = append([]any{p.ID, with.ID, with.ID, p.ID}, append(args, limit)...)
+	messages, _ := Messages.Search(`
+		WHERE ((SenderID = ? AND RecipientID = ?)
+		   OR (SenderID = ? AND RecipientID = ?))
+		  AND `+before+`
+		ORDER BY CreatedAt DESC, ID DESC
+		LIMIT ?
+	`, args...)
+	return messages
+}
+
 // UnreadMessagesFrom returns count of unread messages FROM another profile TO this profile
 func (p *Profile) UnreadMessagesFrom(from *Profile) int {
 	return Messages.Count(`
@@ -259,7 +320,7 @@ func (p *Profile) MarkMessagesReadFrom(from *Profile) error {
 // RecentActivities returns the user's recent activity feed posts
 func (p *Profile) RecentActivities(limit int) []*Activity {
 	activities, _ := Activities.Search(`
-		WHERE UserID = ?
+		WHERE UserID = ? AND DeletedAt IS NULL
 		ORDER BY CreatedAt DESC
 		LIMIT ?
 	`, p.UserID, limit)
@@ -326,3 +387,15 @@ func (p *Profile) RecentProjects() []*Project {
 func (p *Profile) ProjectsCount() int {
 	return Projects.Count("WHERE OwnerID = ? AND Status != 'shutdown'", p.UserID)
 }
+
+// UnsubscribeToken authorizes one-click unsubscribes from email links
+func (p *Profile) UnsubscribeToken() string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("AUTH_SECRET")))
+	mac.Write([]byte("unsubscribe:" + p.UserID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// UnsubscribeURL returns the absolute unsubscribe link for emails
+func (p *Profile) UnsubscribeURL() string {
+	return "https://www.theskyscape.com/unsubscribe?user=" + p.UserID + "&token=" + p.UnsubscribeToken()
+}
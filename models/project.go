@@ -2,6 +2,7 @@ package models
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"html/template"
 	"path/filepath"
@@ -20,13 +21,18 @@ import (
 // Project combines code storage (like Repo) with container deployment (like App)
 type Project struct {
 	application.Model
-	OwnerID           string
-	Name              string
-	Description       string
-	Status            string // draft, launching, online, offline, shutdown
-	Error             string
-	OAuthClientSecret string // bcrypt hashed
-	DatabaseEnabled   bool
+	OwnerID             string
+	Name                string
+	Description         string
+	Status              string // draft, launching, online, offline, suspended, removed, shutdown
+	Error               string
+	OAuthClientSecret   string // bcrypt hashed
+	DatabaseEnabled     bool
+	StarTotal           int  // Cached star count, see CountStar
+	AnalyticsEnabled    bool // Opted in to visitor analytics, see internal/analytics
+	Version             int  // Bumped on every edit, see ClaimEdit
+	ServiceTokenVersion int  // Bumped to rotate the service token, see ServiceToken
+	BlockVulnerable     bool // Fail builds whose image has critical vulnerabilities
 }
 
 func (*Project) Table() string { return "projects" }
@@ -51,6 +57,11 @@ func NewProject(id, ownerID, name, description string) (*Project, error) {
 // Ownership
 // =============================================================================
 
+// Takedown returns the active takedown for this project, if any
+func (p *Project) Takedown() *Takedown {
+	return ActiveTakedown(TakedownProject, p.ID)
+}
+
 func (p *Project) Owner() *Profile {
 	profile, _ := Profiles.First("WHERE UserID = ?", p.OwnerID)
 	return profile
@@ -68,6 +79,11 @@ func (p *Project) Git(args ...string) (stdout, stderr bytes.Buffer, err error) {
 	return git.Exec(p.Path(), args...)
 }
 
+// GitContext runs a git command in the project, traced under ctx
+func (p *Project) GitContext(ctx context.Context, args ...string) (stdout, stderr bytes.Buffer, err error) {
+	return git.ExecContext(ctx, p.Path(), args...)
+}
+
 func (p *Project) IsEmpty(branch string) bool {
 	return git.IsEmpty(p.Path(), branch)
 }
@@ -109,6 +125,18 @@ func (p *Project) ListFiles(branch, path string) ([]*ProjectBlob, error) {
 	return files, nil
 }
 
+// Tree returns the path of every file on a branch
+func (p *Project) Tree(branch string) ([]string, error) {
+	return git.ListTree(p.Path(), branch)
+}
+
+// Commit writes changes to a branch as a commit by user on top of parent,
+// without a push. See git.Commit.
+func (p *Project) Commit(ctx context.Context, branch, parent string, user *authentication.User, message string, changes []git.Change) (string, error) {
+	author := git.Author{Name: user.Name, Email: user.Email}
+	return git.Commit(ctx, p.Path(), branch, parent, author, message, changes)
+}
+
 func (p *Project) IsDir(branch, path string) (bool, error) {
 	return git.IsDir(p.Path(), branch, path)
 }
@@ -166,12 +194,9 @@ func (f *ProjectBlob) ListFiles(branch, _ string) ([]*ProjectBlob, error) {
 	return f.Project.ListFiles(branch, f.Path)
 }
 
-func (f *ProjectBlob) Comments() ([]*Comment, error) {
-	return Comments.Search(`
-		WHERE SubjectID = $1
-			AND Content != ''
-		ORDER BY CreatedAt DESC
-	`, fmt.Sprintf("file:%s:%s", f.Project.ID, f.Path))
+// Comments returns the comments on the file, picked by a FileComments filter
+func (f *ProjectBlob) Comments(filter string) ([]*Comment, error) {
+	return FileComments(f.Project.ID, f.Path, filter)
 }
 
 func (f *ProjectBlob) Read() (*ProjectContent, error) {
@@ -206,29 +231,19 @@ func (c *ProjectContent) Markdown() template.HTML {
 // =============================================================================
 
 func (p *Project) Stars() []*Star {
-	stars, _ := Stars.Search(`
-		WHERE ProjectID = ?
-		ORDER BY CreatedAt DESC
-	`, p.ID)
-	return stars
+	return StarsOf(StarProject, p.ID)
 }
 
 func (p *Project) StarsCount() int {
-	return Stars.Count("WHERE ProjectID = ?", p.ID)
+	return p.StarTotal
 }
 
 func (p *Project) RecentStargazers(limit int) []*Star {
-	stars, _ := Stars.Search(`
-		WHERE ProjectID = ?
-		ORDER BY CreatedAt DESC
-		LIMIT ?
-	`, p.ID, limit)
-	return stars
+	return RecentStars(StarProject, p.ID, limit)
 }
 
 func (p *Project) IsStarredBy(userID string) bool {
-	star, _ := Stars.First("WHERE UserID = ? AND ProjectID = ?", userID, p.ID)
-	return star != nil
+	return IsStarred(userID, StarProject, p.ID)
 }
 
 // =============================================================================
@@ -285,11 +300,24 @@ func (p *Project) AuthorizedUsersCount() int {
 
 func (p *Project) Comments(limit, offset int) []*Comment {
 	comments, _ := Comments.Search(`
-		WHERE SubjectID = ?
+		WHERE SubjectType = ? AND SubjectID = ?
 			AND Content != ''
 		ORDER BY CreatedAt DESC
 		LIMIT ? OFFSET ?
-	`, p.ID, limit, offset)
+	`, CommentProject, p.ID, limit, offset)
+	return comments
+}
+
+// CommentsBefore returns the page of comments that follows the cursor
+func (p *Project) CommentsBefore(cursor *Cursor, limit int) []*Comment {
+	before, args := cursor.Before("")
+	comments, _ := Comments.Search(`
+		WHERE SubjectType = ? AND SubjectID = ?
+			AND Content != ''
+			AND `+before+`
+		ORDER BY CreatedAt DESC, ID DESC
+		LIMIT ?
+	`, append(append([]any{CommentProject, p.ID}, args...), limit)...)
 	return comments
 }
 
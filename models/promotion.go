@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"github.com/The-Skyscape/devtools/pkg/application"
@@ -19,6 +20,11 @@ type Promotion struct {
 	ExpiresAt   time.Time
 	PaymentID   string // Links to Payment record (empty for free promotions)
 	IsPaid      bool   // Whether this was a paid promotion
+	PaidDays    int    // Days paid for, including extensions
+
+	// Targeting
+	Tags             string // Comma-separated topic tags; empty reaches everyone
+	ExcludeFollowers bool   // Skip users who already follow the promoter
 }
 
 func (*Promotion) Table() string {
@@ -71,3 +77,37 @@ func ActivePromotions() []*Promotion {
 	`, time.Now())
 	return promotions
 }
+
+// MaxPromotionTags bounds the topics a promotion can target
+const MaxPromotionTags = 5
+
+// PromotionTags normalizes a comma or space separated list of tags for
+// Promotion.Tags, dropping invalid and duplicate ones
+func PromotionTags(input string) string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, field := range strings.FieldsFunc(input, func(r rune) bool { return r == ',' || r == ' ' }) {
+		tag := NormalizeTag(field)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		if tags = append(tags, tag); len(tags) == MaxPromotionTags {
+			break
+		}
+	}
+	return strings.Join(tags, ",")
+}
+
+// TagList returns the topics the promotion targets
+func (p *Promotion) TagList() []string {
+	if p.Tags == "" {
+		return nil
+	}
+	return strings.Split(p.Tags, ",")
+}
+
+// IsTargeted returns true if the promotion only reaches some users
+func (p *Promotion) IsTargeted() bool {
+	return p.Tags != "" || p.ExcludeFollowers
+}
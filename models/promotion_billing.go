@@ -0,0 +1,103 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// PromotionDayPrice is what a day of promotion costs, in cents
+const PromotionDayPrice = 100
+
+// MaxPromotionDays bounds a single purchase or extension
+const MaxPromotionDays = 30
+
+// RefundableDays returns the whole unused days of the promotion that were
+// paid for. Extensions are added at the end, so a free promotion that was
+// extended only refunds what the extensions bought.
+func (p *Promotion) RefundableDays() int {
+	if !p.IsPaid || p.IsExpired() {
+		return 0
+	}
+	remaining := p.DaysRemaining()
+	if p.PaidDays > 0 && p.PaidDays < remaining {
+		return p.PaidDays
+	}
+	return remaining
+}
+
+// Extend adds paid days to the end of the promotion. A promotion that ran
+// out while the extension was being paid for restarts from now.
+func (p *Promotion) Extend(days int) error {
+	start := p.ExpiresAt
+	if p.IsExpired() {
+		start = time.Now()
+	}
+	p.ExpiresAt = start.Add(time.Duration(days) * 24 * time.Hour)
+	p.PaidDays += days
+	p.IsPaid = true
+	return Promotions.Update(p)
+}
+
+// Stop ends the promotion now, keeping it for its report. Unused paid days
+// are credited to the owner's account, which is returned in cents.
+func (p *Promotion) Stop() (int64, error) {
+	if p.IsExpired() {
+		return 0, errors.New("no active promotion found")
+	}
+
+	credit := int64(p.RefundableDays()) * PromotionDayPrice
+	p.ExpiresAt = time.Now()
+	if err := Promotions.Update(p); err != nil {
+		return 0, err
+	}
+	if credit == 0 {
+		return 0, nil
+	}
+
+	if err := AddCredit(p.UserID, credit); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	Payments.Insert(&Payment{
+		UserID:      p.UserID,
+		ProductType: PaymentCredit,
+		SubjectID:   p.SubjectID,
+		Amount:      credit,
+		Currency:    "usd",
+		Status:      PaymentCompleted,
+		CompletedAt: &now,
+	})
+	return credit, nil
+}
+
+// AddCredit adds cents to a user's account credit
+func AddCredit(userID string, cents int64) error {
+	return DB.Query(`
+		UPDATE profiles SET Credit = Credit + ? WHERE UserID = ?
+	`, cents, userID).Exec()
+}
+
+// SpendCredit takes cents from a user's account credit, failing if they
+// don't have enough
+func SpendCredit(userID string, cents int64) error {
+	if Profiles.Count("WHERE UserID = ? AND Credit >= ?", userID, cents) == 0 {
+		return errors.New("not enough account credit")
+	}
+	return DB.Query(`
+		UPDATE profiles SET Credit = Credit - ? WHERE UserID = ? AND Credit >= ?
+	`, cents, userID, cents).Exec()
+}
+
+// CreditDays returns how many of the days a user's credit covers
+func CreditDays(userID string, days int) int {
+	profile, err := Profiles.First("WHERE UserID = ?", userID)
+	if err != nil {
+		return 0
+	}
+	return min(days, int(profile.Credit/PromotionDayPrice))
+}
+
+// FormatCredit returns the profile's account credit formatted as currency
+func (p *Profile) FormatCredit() string {
+	return "$" + formatFloat(float64(p.Credit)/100)
+}
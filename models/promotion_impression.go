@@ -0,0 +1,107 @@
+package models
+
+import (
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+)
+
+// Frequency capping: a user sees the same promotion at most
+// PromotionFrequencyCap times per PromotionCapWindow
+const (
+	PromotionFrequencyCap = 3
+	PromotionCapWindow    = 24 * time.Hour
+)
+
+// PromotionInterestWindow is how far back a user's tagged posts count as
+// interest in a topic
+const PromotionInterestWindow = 90 * 24 * time.Hour
+
+// PromotionImpression records a promotion being shown in someone's feed.
+// Signed-out impressions have no UserID.
+type PromotionImpression struct {
+	application.Model
+	PromotionID string
+	UserID      string
+}
+
+func (*PromotionImpression) Table() string { return "promotion_impressions" }
+
+// RecordImpression records that a user was shown a promotion
+func RecordImpression(promotionID, userID string) {
+	PromotionImpressions.Insert(&PromotionImpression{
+		PromotionID: promotionID,
+		UserID:      userID,
+	})
+}
+
+// Reaches returns true if the promotion's targeting includes the user.
+// Signed-out users only see promotions without topic targeting.
+func (p *Promotion) Reaches(userID string) bool {
+	if userID == "" {
+		return p.Tags == ""
+	}
+
+	if p.ExcludeFollowers && p.UserID != userID {
+		if Follows.Count("WHERE FollowerID = ? AND FolloweeID = ?", userID, p.UserID) > 0 {
+			return false
+		}
+	}
+
+	for _, tag := range p.TagList() {
+		if FollowsTopic(userID, TopicTag, tag) {
+			return true
+		}
+		if ActivityTags.Count(`
+			JOIN activities ON activities.ID = activity_tags.ActivityID
+			WHERE activity_tags.Tag = ? AND activities.UserID = ? AND activities.CreatedAt > ?
+		`, tag, userID, time.Now().Add(-PromotionInterestWindow)) > 0 {
+			return true
+		}
+	}
+	return p.Tags == ""
+}
+
+// RecentImpressions returns how many times the user saw the promotion
+// within the frequency cap window
+func (p *Promotion) RecentImpressions(userID string) int {
+	return PromotionImpressions.Count(`
+		WHERE PromotionID = ? AND UserID = ? AND CreatedAt > ?
+	`, p.ID, userID, time.Now().Add(-PromotionCapWindow))
+}
+
+// PromotionFor picks the promotion to show a user on a feed page, or nil.
+// Signed-in users get the targeted promotion they've seen least, skipping
+// any they've hit the frequency cap on; ties rotate by page like they do
+// for signed-out users.
+func PromotionFor(userID string, page int) *Promotion {
+	var (
+		candidates []*Promotion
+		fewest     = PromotionFrequencyCap
+	)
+	for _, promo := range ActivePromotions() {
+		if !promo.Reaches(userID) {
+			continue
+		}
+		if userID == "" {
+			candidates = append(candidates, promo)
+			continue
+		}
+
+		seen := promo.RecentImpressions(userID)
+		switch {
+		case seen < fewest:
+			fewest, candidates = seen, []*Promotion{promo}
+		case seen == fewest && seen < PromotionFrequencyCap:
+			candidates = append(candidates, promo)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil
+	}
+	if page < 1 {
+		page = 1
+	}
+	return candidates[(page-1)%len(candidates)]
+}
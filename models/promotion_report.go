@@ -0,0 +1,171 @@
+package models
+
+import (
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+)
+
+// PromotionClick records someone following a promotion from the feed.
+// Signed-out clicks have no UserID.
+type PromotionClick struct {
+	application.Model
+	PromotionID string
+	UserID      string
+}
+
+func (*PromotionClick) Table() string { return "promotion_clicks" }
+
+// RecordClick records that a user clicked a promotion
+func RecordClick(promotionID, userID string) {
+	PromotionClicks.Insert(&PromotionClick{
+		PromotionID: promotionID,
+		UserID:      userID,
+	})
+}
+
+// Project returns the promoted project, if the promotion is for one
+func (p *Promotion) Project() *Project {
+	if p.SubjectType != "project" {
+		return nil
+	}
+	project, _ := Projects.Get(p.SubjectID)
+	return project
+}
+
+// URL returns the promoted subject's page, or "" if it's gone
+func (p *Promotion) URL() string {
+	switch p.SubjectType {
+	case "app":
+		if app := p.App(); app != nil {
+			return "/app/" + app.ID
+		}
+	case "project":
+		if project := p.Project(); project != nil {
+			return "/project/" + project.ID
+		}
+	case "repo":
+		if repo := p.Repo(); repo != nil {
+			return "/repo/" + repo.ID
+		}
+	}
+	return ""
+}
+
+// SubjectName returns the promoted subject's name
+func (p *Promotion) SubjectName() string {
+	if app := p.App(); app != nil {
+		return app.Name
+	}
+	if project := p.Project(); project != nil {
+		return project.Name
+	}
+	if repo := p.Repo(); repo != nil {
+		return repo.Name
+	}
+	return "Deleted " + p.SubjectType
+}
+
+// PromotionDay is one day of a promotion's report
+type PromotionDay struct {
+	Date        time.Time
+	Impressions int
+	Clicks      int
+	Percent     int // Impressions relative to the busiest day, for the chart
+}
+
+// PromotionReport is how a promotion performed over its window. Stars and
+// authorizations only count people who clicked through the promotion, so
+// they measure what the promotion brought in rather than all activity.
+type PromotionReport struct {
+	Promotion      *Promotion
+	Impressions    int
+	Reach          int // Distinct signed-in users shown the promotion
+	Clicks         int
+	Stars          int
+	Authorizations int
+	Days           []PromotionDay
+}
+
+// Report tallies the promotion's performance so far
+func (p *Promotion) Report() *PromotionReport {
+	end := time.Now()
+	if p.ExpiresAt.Before(end) {
+		end = p.ExpiresAt
+	}
+
+	r := &PromotionReport{
+		Promotion:   p,
+		Impressions: PromotionImpressions.Count("WHERE PromotionID = ?", p.ID),
+		Reach: PromotionImpressions.Count(`
+			WHERE ID IN (
+				SELECT MIN(ID) FROM promotion_impressions
+				WHERE PromotionID = ? AND UserID != ''
+				GROUP BY UserID
+			)
+		`, p.ID),
+		Clicks: PromotionClicks.Count("WHERE PromotionID = ?", p.ID),
+	}
+
+	clickers := `UserID IN (
+		SELECT UserID FROM promotion_clicks WHERE PromotionID = ? AND UserID != ''
+	)`
+	if p.SubjectType == "app" || p.SubjectType == "project" {
+		r.Stars = Stars.Count(`
+			WHERE SubjectType = ? AND SubjectID = ? AND CreatedAt BETWEEN ? AND ?
+				AND `+clickers,
+			p.SubjectType, p.SubjectID, p.CreatedAt, end, p.ID)
+
+		column := "AppID"
+		if p.SubjectType == "project" {
+			column = "ProjectID"
+		}
+		r.Authorizations = OAuthAuthorizations.Count(`
+			WHERE `+column+` = ? AND CreatedAt BETWEEN ? AND ?
+				AND `+clickers,
+			p.SubjectID, p.CreatedAt, end, p.ID)
+	}
+
+	start := p.CreatedAt.UTC().Truncate(24 * time.Hour)
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+		r.Days = append(r.Days, PromotionDay{
+			Date: day,
+			Impressions: PromotionImpressions.Count(`
+				WHERE PromotionID = ? AND CreatedAt >= ? AND CreatedAt < ?
+			`, p.ID, day, next),
+			Clicks: PromotionClicks.Count(`
+				WHERE PromotionID = ? AND CreatedAt >= ? AND CreatedAt < ?
+			`, p.ID, day, next),
+		})
+	}
+
+	busiest := 0
+	for _, day := range r.Days {
+		busiest = max(busiest, day.Impressions)
+	}
+	for i := range r.Days {
+		if busiest > 0 {
+			r.Days[i].Percent = r.Days[i].Impressions * 100 / busiest
+		}
+	}
+	return r
+}
+
+// ClickRate returns clicks per impression as a percentage
+func (r *PromotionReport) ClickRate() float64 {
+	if r.Impressions == 0 {
+		return 0
+	}
+	return float64(r.Clicks) * 100 / float64(r.Impressions)
+}
+
+// PromotionsBy returns the promotions a user bought or created, newest
+// first
+func PromotionsBy(userID string) []*Promotion {
+	promotions, _ := Promotions.Search(`
+		WHERE UserID = ?
+		ORDER BY CreatedAt DESC
+	`, userID)
+	return promotions
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"strings"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+)
+
+// Bounds owners can set their proxy limits within
+const (
+	MaxProxyBodyMB  = 100
+	MaxProxyTimeout = 300 // Seconds
+	MaxProxyRules   = 100 // Lines in each list
+)
+
+// ProxyRules is how the reverse proxy screens requests to an app or
+// project before they reach its container. A site without rules gets
+// every request, as before rules existed.
+type ProxyRules struct {
+	application.Model
+	SiteID         string // App or project ID
+	MaxBodyMB      int    // Largest request body accepted, 0 for no limit
+	TimeoutSeconds int    // How long the container has to respond, 0 for no limit
+	BlockedPaths   string // Path prefixes to refuse, one per line
+	AllowIPs       string // IPs or CIDR ranges, one per line; when set, everyone else is refused
+	DenyIPs        string // IPs or CIDR ranges to refuse, one per line
+	WAF            bool   // Refuse requests matching common attack patterns
+}
+
+func (*ProxyRules) Table() string { return "proxy_rules" }
+
+// ProxyRulesFor returns a site's rules, or empty ones if it has none
+func ProxyRulesFor(siteID string) *ProxyRules {
+	rules, err := ProxyRuleSets.First("WHERE SiteID = ?", siteID)
+	if err != nil || rules == nil {
+		return &ProxyRules{SiteID: siteID}
+	}
+	return rules
+}
+
+// Lines splits one of the newline-separated lists, dropping blank lines
+// and # comments
+func Lines(list string) []string {
+	var lines []string
+	for _, line := range strings.Split(list, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// IsActive reports whether any rule is set
+func (r *ProxyRules) IsActive() bool {
+	return r.MaxBodyMB > 0 || r.TimeoutSeconds > 0 || r.WAF ||
+		len(Lines(r.BlockedPaths)) > 0 || len(Lines(r.AllowIPs)) > 0 || len(Lines(r.DenyIPs)) > 0
+}
+
+// Save stores the rules, inserting them the first time
+func (r *ProxyRules) Save() error {
+	if r.ID == "" {
+		saved, err := ProxyRuleSets.Insert(r)
+		if err == nil {
+			*r = *saved
+		}
+		return err
+	}
+	return ProxyRuleSets.Update(r)
+}
+
+// ProxyRules returns the project's proxy rules
+func (p *Project) ProxyRules() *ProxyRules {
+	return ProxyRulesFor(p.ID)
+}
+
+// ProxyRules returns the app's proxy rules
+func (a *App) ProxyRules() *ProxyRules {
+	return ProxyRulesFor(a.ID)
+}
@@ -9,17 +9,23 @@ import (
 // PushSubscription stores a user's web push subscription
 type PushSubscription struct {
 	application.Model
-	UserID   string
-	Endpoint string
-	P256dh   string // Public key for encryption
-	Auth     string // Auth secret
+	UserID     string
+	Endpoint   string
+	P256dh     string    // Public key for encryption
+	Auth       string    // Auth secret
+	Label      string    // Browser and OS, e.g. "Firefox on Android"
+	LastUsedAt time.Time // Last delivery or check-in from the device
+	ExpiresAt  time.Time // Set when the push service gave an expiry
+	Failures   int       // Consecutive failed deliveries
 }
 
 func (p *PushSubscription) Table() string {
 	return "push_subscriptions"
 }
 
-// PushNotificationLog tracks when notifications were last sent to users per source
+// PushNotificationLog tracks when a user was last sent a push. Batched
+// pushes are logged once per user with an empty SourceID; rows with a
+// SourceID are from the old per-source rate limit.
 type PushNotificationLog struct {
 	application.Model
 	UserID     string // Recipient
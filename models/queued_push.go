@@ -0,0 +1,18 @@
+package models
+
+import "github.com/The-Skyscape/devtools/pkg/application"
+
+// QueuedPush is a notification waiting to be pushed to a user's devices.
+// The push queue sends everything queued for a user as one notification
+// once their batching interval has passed.
+type QueuedPush struct {
+	application.Model
+	UserID   string // Recipient
+	SourceID string // User or entity that triggered it
+	Kind     string // One of the Notify* kinds
+	Title    string
+	Body     string
+	URL      string
+}
+
+func (*QueuedPush) Table() string { return "queued_pushes" }
@@ -1,10 +1,11 @@
 package models
 
 import (
-	"log"
+	"math"
 	"time"
 
 	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/google/uuid"
 )
 
 type RateLimit struct {
@@ -19,23 +20,13 @@ func (*RateLimit) Table() string {
 	return "rate_limits"
 }
 
-// Check checks if the rate limit has been exceeded for the given identifier and action
+// Check checks if the rate limit has been exceeded for the given identifier and action.
+// Expired windows are left for retention to prune.
 func Check(identifier, action string, maxAttempts int, window time.Duration) (bool, int, error) {
-	// Clean up expired rate limits with batch delete
-	if err := DB.Query("DELETE FROM rate_limits WHERE ResetAt < ?", time.Now()).Exec(); err != nil {
-		log.Printf("Failed to clean up expired rate limits: %v", err)
-	}
-
 	// Get existing rate limit record (don't create if not exists)
 	limit, err := RateLimits.First("WHERE Identifier = ? AND Action = ?", identifier, action)
-	if err != nil {
-		// No existing limit - allow the action
-		return true, maxAttempts, nil
-	}
-
-	// Check if limit has expired and should be deleted
-	if time.Now().After(limit.ResetAt) {
-		RateLimits.Delete(limit)
+	if err != nil || limit == nil || time.Now().After(limit.ResetAt) {
+		// No current limit - allow the action
 		return true, maxAttempts, nil
 	}
 
@@ -50,21 +41,70 @@ func Check(identifier, action string, maxAttempts int, window time.Duration) (bo
 
 // Record records an attempt for the given identifier and action
 func Record(identifier, action string, window time.Duration) error {
+	_, _, _, err := Take(identifier, action, math.MaxInt, window)
+	return err
+}
+
+// Take counts an attempt if it's within maxAttempts, reporting whether it
+// was, how many remain and when the count resets. Attempts over the limit
+// aren't counted, so callers who back off get back in once it resets.
+// Each step counts the attempt in one statement, so concurrent attempts
+// are each counted once; expired windows are left for retention to prune.
+func Take(identifier, action string, maxAttempts int, window time.Duration) (bool, int, time.Time, error) {
+	now := time.Now()
+	var id string
+	var attempts int
+
+	// Count it in the current window, if it has room
+	increment := func() error {
+		return DB.Query(`
+			UPDATE rate_limits SET Attempts = Attempts + 1, UpdatedAt = ?
+			WHERE Identifier = ? AND Action = ? AND ResetAt > ? AND Attempts < ?
+			RETURNING ID, Attempts
+		`, now, identifier, action, now, maxAttempts).Scan(&id, &attempts)
+	}
+	if err := increment(); err == nil {
+		return taken(id, maxAttempts-attempts, now)
+	}
+
+	// Start a new window over an expired one, or the first one
+	resetAt := now.Add(window)
+	err := DB.Query(`
+		UPDATE rate_limits SET Attempts = 1, ResetAt = ?, UpdatedAt = ?
+		WHERE Identifier = ? AND Action = ? AND ResetAt <= ?
+		RETURNING ID
+	`, resetAt, now, identifier, action, now).Scan(&id)
+	if err != nil {
+		err = DB.Query(`
+			INSERT INTO rate_limits (ID, CreatedAt, UpdatedAt, Identifier, Action, Attempts, ResetAt)
+			SELECT ?, ?, ?, ?, ?, 1, ?
+			WHERE NOT EXISTS (SELECT 1 FROM rate_limits WHERE Identifier = ? AND Action = ?)
+			RETURNING ID
+		`, uuid.NewString(), now, now, identifier, action, resetAt, identifier, action).Scan(&id)
+	}
+	if err == nil {
+		return true, maxAttempts - 1, resetAt, nil
+	}
+
+	// Another attempt may have just started the window
+	if err := increment(); err == nil {
+		return taken(id, maxAttempts-attempts, now)
+	}
+
 	limit, err := RateLimits.First("WHERE Identifier = ? AND Action = ?", identifier, action)
 	if err != nil {
-		// Create new record
-		_, err = RateLimits.Insert(&RateLimit{
-			Identifier: identifier,
-			Action:     action,
-			Attempts:   1,
-			ResetAt:    time.Now().Add(window),
-		})
-		return err
+		return false, 0, now, err
 	}
+	return false, 0, limit.ResetAt, nil
+}
 
-	// Update existing record
-	limit.Attempts++
-	return RateLimits.Update(limit)
+// taken reports an attempt Take counted in the window with the ID
+func taken(id string, remaining int, now time.Time) (bool, int, time.Time, error) {
+	limit, err := RateLimits.Get(id)
+	if err != nil {
+		return true, remaining, now, nil
+	}
+	return true, remaining, limit.ResetAt, nil
 }
 
 // Reset resets the rate limit for the given identifier and action
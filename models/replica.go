@@ -0,0 +1,111 @@
+package models
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DB is an embedded replica: reads are served from the local file and
+// writes are forwarded to the primary. The local file only catches up when
+// it syncs, so a row written moments ago, by this server or another, may
+// not be readable yet. Reads that must see a fresh write go through
+// ReadAfterWrite, and every sync goes through SyncReplica so it's counted.
+
+// ReplicaStalled is how far behind the replica can fall before the status
+// page reports the database as degraded
+const ReplicaStalled = 5 * time.Minute
+
+// ReplicaStats describes how fresh the local replica is
+type ReplicaStats struct {
+	SyncedAt     time.Time     // When the last successful sync started
+	SyncDuration time.Duration // How long it took
+	Syncs        int64
+	Failures     int64
+	LastError    string    // Empty once a sync succeeds again
+	FailedAt     time.Time // When the last sync failed
+}
+
+// Lag is the most the replica can be behind the primary: anything written
+// since the last successful sync started may be missing
+func (s ReplicaStats) Lag() time.Duration {
+	if s.SyncedAt.IsZero() {
+		return 0
+	}
+	return time.Since(s.SyncedAt)
+}
+
+var replica struct {
+	mu    sync.Mutex // Guards stats
+	stats ReplicaStats
+	sync  sync.Mutex // Held while a sync runs, so callers queue behind it
+}
+
+// ReplicaStatus returns the replica's sync stats
+func ReplicaStatus() ReplicaStats {
+	replica.mu.Lock()
+	defer replica.mu.Unlock()
+	return replica.stats
+}
+
+// SyncReplica pulls the latest changes from the primary
+func SyncReplica() error {
+	return SyncReplicaSince(time.Now())
+}
+
+// SyncReplicaSince makes sure the replica has everything written before t.
+// If another caller started a sync after t while this one waited, that
+// sync already covers it and no new one is made.
+func SyncReplicaSince(t time.Time) error {
+	replica.sync.Lock()
+	defer replica.sync.Unlock()
+
+	if ReplicaStatus().SyncedAt.After(t) {
+		return nil
+	}
+
+	start := time.Now()
+	err := DB.Sync()
+
+	replica.mu.Lock()
+	defer replica.mu.Unlock()
+	if err != nil {
+		replica.stats.Failures++
+		replica.stats.LastError = err.Error()
+		replica.stats.FailedAt = time.Now()
+		slog.Error("database replica sync failed", "error", err)
+		return err
+	}
+	replica.stats.Syncs++
+	replica.stats.SyncedAt = start
+	replica.stats.SyncDuration = time.Since(start)
+	replica.stats.LastError = ""
+	return nil
+}
+
+// ReadAfterWrite runs a read against the replica and, if it fails, syncs
+// and tries once more. Use it to look up rows another request may have
+// just written, like an OAuth code, without syncing on every read.
+func ReadAfterWrite(read func() error) error {
+	start := time.Now()
+	if err := read(); err == nil {
+		return nil
+	}
+	if err := SyncReplicaSince(start); err != nil {
+		return err
+	}
+	return read()
+}
+
+// KeepReplicaSynced syncs immediately and then on each interval, so the
+// replica never falls far behind even when nothing asks for a sync.
+// Blocks forever, so run it in a goroutine.
+func KeepReplicaSynced(interval time.Duration) {
+	for {
+		start := time.Now()
+		if err := SyncReplica(); err == nil && time.Since(start) > interval {
+			slog.Warn("database replica sync is slower than its interval", "duration", time.Since(start), "interval", interval)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"html/template"
 	"path/filepath"
@@ -21,6 +22,8 @@ type Repo struct {
 	Name        string
 	Description string
 	Archived    bool
+	StarTotal   int // Cached star count, see CountStar
+	Version     int // Bumped on every edit, see ClaimEdit
 }
 
 func (*Repo) Table() string { return "repos" }
@@ -44,6 +47,11 @@ func (r *Repo) Path() string {
 	return fmt.Sprintf("/mnt/git-repos/%s", r.ID)
 }
 
+// Takedown returns the active takedown for this repo, if any
+func (r *Repo) Takedown() *Takedown {
+	return ActiveTakedown(TakedownRepo, r.ID)
+}
+
 func (r *Repo) Owner() *authentication.User {
 	u, err := Auth.Users.Get(r.OwnerID)
 	if err != nil {
@@ -55,10 +63,10 @@ func (r *Repo) Owner() *authentication.User {
 
 func (r *Repo) Comments() ([]*Comment, error) {
 	return Comments.Search(`
-		WHERE SubjectID = $1
+		WHERE SubjectType = $1 AND SubjectID = $2
 			AND Content != ''
 		ORDER BY CreatedAt DESC
-	`, r.ID)
+	`, CommentRepo, r.ID)
 }
 
 func (r *Repo) Apps() ([]*App, error) {
@@ -70,38 +78,33 @@ func (r *Repo) Apps() ([]*App, error) {
 
 // Stars returns all stars for this repository
 func (r *Repo) Stars() []*Star {
-	stars, _ := Stars.Search(`
-		WHERE RepoID = ?
-		ORDER BY CreatedAt DESC
-	`, r.ID)
-	return stars
+	return StarsOf(StarRepo, r.ID)
 }
 
 // StarsCount returns the count of stars for this repository
 func (r *Repo) StarsCount() int {
-	return Stars.Count("WHERE RepoID = ?", r.ID)
+	return r.StarTotal
 }
 
 // RecentStargazers returns the most recent users who starred this repository
 func (r *Repo) RecentStargazers(limit int) []*Star {
-	stars, _ := Stars.Search(`
-		WHERE RepoID = ?
-		ORDER BY CreatedAt DESC
-		LIMIT ?
-	`, r.ID, limit)
-	return stars
+	return RecentStars(StarRepo, r.ID, limit)
 }
 
 // IsStarredBy checks if a specific user has starred this repository
 func (r *Repo) IsStarredBy(userID string) bool {
-	star, _ := Stars.First("WHERE UserID = ? AND RepoID = ?", userID, r.ID)
-	return star != nil
+	return IsStarred(userID, StarRepo, r.ID)
 }
 
 func (r *Repo) Git(args ...string) (stdout, stderr bytes.Buffer, err error) {
 	return git.Exec(r.Path(), args...)
 }
 
+// GitContext runs a git command in the repo, traced under ctx
+func (r *Repo) GitContext(ctx context.Context, args ...string) (stdout, stderr bytes.Buffer, err error) {
+	return git.ExecContext(ctx, r.Path(), args...)
+}
+
 func (r *Repo) ListCommits(branch string, limit int) ([]*Commit, error) {
 	infos, err := git.ListCommits(r.Path(), branch, limit)
 	if err != nil {
@@ -197,12 +200,17 @@ func (f *Blob) ListFiles(branch, _ string) ([]*Blob, error) {
 	return f.Repo.ListFiles(branch, f.Path)
 }
 
-func (f *Blob) Comments() ([]*Comment, error) {
-	return Comments.Search(`
-		WHERE SubjectID = $1
-			AND Content != ''
-		ORDER BY CreatedAt DESC
-	`, fmt.Sprintf("file:%s:%s", f.Repo.ID, f.Path))
+// Comments returns the comments on the file, picked by a FileComments filter
+func (f *Blob) Comments(filter string) ([]*Comment, error) {
+	return FileComments(f.Repo.ID, f.Path, filter)
+}
+
+// OpenComments counts the file's comments that aren't resolved or deleted
+func (f *Blob) OpenComments() int {
+	return Comments.Count(`
+		WHERE SubjectType = ? AND SubjectID = ?
+			AND Content != '' AND ResolvedAt IS NULL AND DeletedAt IS NULL
+	`, CommentFile, "file:"+f.Repo.ID+":"+f.Path)
 }
 
 func (f *Blob) Read() (*Content, error) {
@@ -228,6 +236,22 @@ func (c *Content) Lines() []string {
 	return strings.Split(c.Content, "\n")
 }
 
+// Line is a line of a file, numbered from 1 so comments can point at it
+type Line struct {
+	Number int
+	Text   string
+}
+
+// NumberedLines returns the file's lines with their line numbers
+func (c *Content) NumberedLines() []Line {
+	lines := c.Lines()
+	numbered := make([]Line, len(lines))
+	for i, text := range lines {
+		numbered[i] = Line{Number: i + 1, Text: text}
+	}
+	return numbered
+}
+
 func (c *Content) Markdown() template.HTML {
 	return markup.RenderMarkdown(c.Content)
 }
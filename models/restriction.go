@@ -0,0 +1,148 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/The-Skyscape/devtools/pkg/authentication"
+)
+
+// Throttle limits an abusable action per account and per IP address with
+// the rate limiter. An account that goes over either limit is
+// automatically restricted from the action for a while.
+type Throttle struct {
+	Action   string
+	Account  int // Attempts allowed per account per Window
+	IP       int // Attempts allowed per IP address per Window
+	Window   time.Duration
+	Restrict time.Duration // How long an account that goes over is restricted
+	Err      error         // Shown while throttled
+}
+
+var (
+	// ThrottleStrangerDM limits messages to people who don't follow the
+	// sender and never messaged them
+	ThrottleStrangerDM = Throttle{
+		Action:   "stranger-dm",
+		Account:  10,
+		IP:       30,
+		Window:   time.Hour,
+		Restrict: 24 * time.Hour,
+		Err:      errors.New("you're temporarily restricted from messaging people who don't follow you"),
+	}
+
+	// ThrottleComment limits comment bursts
+	ThrottleComment = Throttle{
+		Action:   "comment",
+		Account:  10,
+		IP:       30,
+		Window:   5 * time.Minute,
+		Restrict: time.Hour,
+		Err:      errors.New("you're commenting too fast, try again later"),
+	}
+
+	// ThrottleFollow limits follow churn; follows and unfollows both count
+	ThrottleFollow = Throttle{
+		Action:   "follow",
+		Account:  50,
+		IP:       150,
+		Window:   time.Hour,
+		Restrict: 24 * time.Hour,
+		Err:      errors.New("you're following and unfollowing too fast, try again later"),
+	}
+)
+
+// Allow checks and counts an attempt by a user from an IP address,
+// restricting the user if they went over a limit
+func (t Throttle) Allow(userID, ip string) error {
+	if ActiveRestriction(userID, t.Action) != nil {
+		return t.Err
+	}
+
+	allowed, _, _ := Check(userID, t.Action, t.Account, t.Window)
+	if allowed && ip != "" {
+		allowed, _, _ = Check(ip, t.Action, t.IP, t.Window)
+	}
+	if !allowed {
+		_, err := Restrictions.Insert(&Restriction{
+			UserID: userID,
+			Action: t.Action,
+			IP:     ip,
+			Reason: fmt.Sprintf("Over %d per account or %d per IP in %s", t.Account, t.IP, t.Window),
+			EndsAt: time.Now().Add(t.Restrict),
+		})
+		if err != nil {
+			slog.Error("failed to restrict user", "user_id", userID, "action", t.Action, "error", err)
+		}
+		slog.Warn("user automatically restricted", "user_id", userID, "action", t.Action, "ip", ip)
+		return t.Err
+	}
+
+	Record(userID, t.Action, t.Window)
+	if ip != "" {
+		Record(ip, t.Action, t.Window)
+	}
+	return nil
+}
+
+// Restriction temporarily blocks a user from one action after they tripped
+// its throttle. Moderators see them next to suspensions and can lift them.
+type Restriction struct {
+	application.Model
+	UserID   string
+	Action   string // Throttle action
+	IP       string // Address the last attempt came from
+	Reason   string
+	EndsAt   time.Time
+	LiftedBy string // Admin user ID, empty unless lifted early
+}
+
+func (*Restriction) Table() string { return "restrictions" }
+
+// User returns the restricted user
+func (r *Restriction) User() *authentication.User {
+	user, _ := Auth.Users.Get(r.UserID)
+	return user
+}
+
+// ActiveRestriction returns the user's restriction from an action, if any
+func ActiveRestriction(userID, action string) *Restriction {
+	r, err := Restrictions.First(`
+		WHERE UserID = ? AND Action = ? AND EndsAt > ?
+	`, userID, action, time.Now())
+	if err != nil {
+		return nil
+	}
+	return r
+}
+
+// ActiveRestrictions returns every restriction still in effect
+func ActiveRestrictions() []*Restriction {
+	restrictions, _ := Restrictions.Search(`
+		WHERE EndsAt > ?
+		ORDER BY CreatedAt DESC
+	`, time.Now())
+	return restrictions
+}
+
+// Lift ends a restriction early and clears the user's count, so they
+// aren't restricted again on their next attempt
+func (r *Restriction) Lift(adminID string) error {
+	r.EndsAt = time.Now()
+	r.LiftedBy = adminID
+	Reset(r.UserID, r.Action)
+	if r.IP != "" {
+		Reset(r.IP, r.Action)
+	}
+	return Restrictions.Update(r)
+}
+
+// IsStranger reports whether a recipient neither follows the sender nor
+// ever messaged them
+func IsStranger(senderID, recipientID string) bool {
+	return Follows.Count("WHERE FollowerID = ? AND FolloweeID = ?", recipientID, senderID) == 0 &&
+		Messages.Count("WHERE SenderID = ? AND RecipientID = ?", recipientID, senderID) == 0
+}
@@ -0,0 +1,261 @@
+package models
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Site-wide search is backed by an SQLite FTS5 table. Each source table has
+// triggers that re-index the affected document on every insert, update and
+// delete, so the index stays current no matter which code path writes. Hits
+// are joined back to their source table so visibility rules (suspensions,
+// takedowns, drafts) are applied at query time rather than baked into the
+// index.
+
+// Searchable document kinds, used as the ?type= filter on /search
+const (
+	SearchUser    = "user"
+	SearchRepo    = "repo"
+	SearchProject = "project"
+	SearchApp     = "app"
+	SearchThought = "thought"
+	SearchPost    = "post"
+)
+
+// SearchKinds lists every document kind in display order
+var SearchKinds = []string{SearchUser, SearchProject, SearchRepo, SearchApp, SearchThought, SearchPost}
+
+// searchSource describes how one table feeds the index. Document selects
+// (Kind, SubjectID, Title, Body) rows and Match is the column matched
+// against the trigger row's Key when a single document is re-indexed.
+// Primary sources are used to rebuild the whole index.
+type searchSource struct {
+	Kind     string
+	Table    string
+	Key      string
+	Document string
+	Match    string
+	Primary  bool
+}
+
+var (
+	userDocument = `SELECT 'user', users.ID, users.Name || ' @' || users.Handle, COALESCE(profiles.Description, '')
+		FROM users LEFT JOIN profiles ON profiles.UserID = users.ID WHERE 1 = 1`
+	thoughtDocument = `SELECT 'thought', thoughts.ID, thoughts.Title,
+		COALESCE((SELECT group_concat(Content, ' ') FROM thought_blocks WHERE ThoughtID = thoughts.ID), '')
+		FROM thoughts WHERE 1 = 1`
+)
+
+var searchSources = []searchSource{
+	{SearchUser, "users", "ID", userDocument, "users.ID", true},
+	{SearchUser, "profiles", "UserID", userDocument, "users.ID", false},
+	{SearchRepo, "repos", "ID", `SELECT 'repo', ID, Name, Description FROM repos WHERE 1 = 1`, "ID", true},
+	{SearchProject, "projects", "ID", `SELECT 'project', ID, Name, Description FROM projects WHERE 1 = 1`, "ID", true},
+	{SearchApp, "apps", "ID", `SELECT 'app', ID, Name, Description FROM apps WHERE 1 = 1`, "ID", true},
+	{SearchThought, "thoughts", "ID", thoughtDocument, "thoughts.ID", true},
+	{SearchThought, "thought_blocks", "ThoughtID", thoughtDocument, "thoughts.ID", false},
+	{SearchPost, "activities", "ID", `SELECT 'post', ID, '', Content FROM activities WHERE Content != ''`, "ID", true},
+}
+
+// SetupSearch creates the search index and the triggers that keep it up to
+// date, then rebuilds the index if it is empty (first run or new database)
+func SetupSearch() error {
+	if err := DB.Query(`
+		CREATE VIRTUAL TABLE IF NOT EXISTS search_index USING fts5(
+			Kind UNINDEXED,
+			SubjectID UNINDEXED,
+			Title,
+			Body,
+			tokenize = 'porter unicode61'
+		)
+	`).Exec(); err != nil {
+		return err
+	}
+
+	for _, source := range searchSources {
+		for _, trigger := range source.triggers() {
+			if err := DB.Query(trigger).Exec(); err != nil {
+				return fmt.Errorf("failed to create search trigger on %s: %w", source.Table, err)
+			}
+		}
+	}
+
+	indexed := Profiles.Count(`
+		JOIN search_index ON search_index.Kind = 'user' AND search_index.SubjectID = profiles.UserID
+	`)
+	if indexed == 0 && Profiles.Count("") > 0 {
+		return RebuildSearchIndex()
+	}
+	return nil
+}
+
+// triggers returns the statements that re-index a document whenever a row
+// in the source table changes. Updates re-index both the old and new key in
+// case the row was renamed.
+func (s searchSource) triggers() []string {
+	reindex := func(row string) string {
+		return fmt.Sprintf(`
+			DELETE FROM search_index WHERE Kind = '%[1]s' AND SubjectID = %[2]s.%[3]s;
+			INSERT INTO search_index (Kind, SubjectID, Title, Body) %[4]s AND %[5]s = %[2]s.%[3]s;`,
+			s.Kind, row, s.Key, s.Document, s.Match)
+	}
+
+	name := "search_" + s.Table
+	return []string{
+		fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_insert AFTER INSERT ON %s BEGIN %s END",
+			name, s.Table, reindex("NEW")),
+		fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_update AFTER UPDATE ON %s BEGIN %s %s END",
+			name, s.Table, reindex("OLD"), reindex("NEW")),
+		fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_delete AFTER DELETE ON %s BEGIN %s END",
+			name, s.Table, reindex("OLD")),
+	}
+}
+
+// RebuildSearchIndex re-indexes every document from the source tables
+func RebuildSearchIndex() error {
+	if err := DB.Query("DELETE FROM search_index").Exec(); err != nil {
+		return err
+	}
+
+	for _, source := range searchSources {
+		if !source.Primary {
+			continue
+		}
+		if err := DB.Query("INSERT INTO search_index (Kind, SubjectID, Title, Body) " + source.Document).Exec(); err != nil {
+			return fmt.Errorf("failed to index %s: %w", source.Table, err)
+		}
+	}
+
+	slog.Info("rebuilt search index")
+	return nil
+}
+
+// SearchMatch converts user input into an FTS5 query: every word must
+// match, and the last word also matches as a prefix for search-as-you-type.
+// Returns "" when there is nothing to search for.
+func SearchMatch(query string) string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		word = strings.Map(func(r rune) rune {
+			if r == '"' || r == '*' {
+				return -1
+			}
+			return r
+		}, word)
+		if word != "" {
+			terms = append(terms, `"`+word+`"`)
+		}
+	}
+
+	if len(terms) == 0 {
+		return ""
+	}
+	terms[len(terms)-1] += "*"
+	return strings.Join(terms, " ")
+}
+
+// SuggestMatch is SearchMatch restricted to titles (names and handles), so
+// typeahead suggestions don't surface documents that only mention the query
+func SuggestMatch(query string) string {
+	match := SearchMatch(query)
+	if match == "" {
+		return ""
+	}
+	return "Title : (" + match + ")"
+}
+
+// searchJoin joins a source table to the index rows matching the query
+func searchJoin(kind, column string) string {
+	return `
+		JOIN search_index ON search_index.Kind = '` + kind + `' AND search_index.SubjectID = ` + column + `
+		WHERE search_index MATCH ?`
+}
+
+// searchOrder ranks title matches above body matches
+const searchOrder = `ORDER BY bm25(search_index, 0, 0, 10.0, 1.0) LIMIT ? OFFSET ?`
+
+// Visibility rules applied to search hits, mirroring the listing pages
+const (
+	searchVisibleUsers = `
+		AND profiles.Suspended = false`
+	searchVisibleRepos = `
+		AND repos.Archived = false
+		AND repos.OwnerID NOT IN (SELECT UserID FROM profiles WHERE Suspended = true)
+		AND repos.ID NOT IN (SELECT SubjectID FROM takedowns WHERE SubjectType = 'repo' AND Active = true)`
+	searchVisibleProjects = `
+		AND projects.Status NOT IN ('shutdown', 'suspended', 'removed')
+		AND projects.OwnerID NOT IN (SELECT UserID FROM profiles WHERE Suspended = true)`
+	searchVisibleApps = `
+		AND apps.Status NOT IN ('shutdown', 'suspended', 'removed')`
+	searchVisibleThoughts = `
+		AND thoughts.Published = true
+		AND thoughts.UserID NOT IN (SELECT UserID FROM profiles WHERE Suspended = true)
+		AND thoughts.ID NOT IN (SELECT SubjectID FROM takedowns WHERE SubjectType = 'thought' AND Active = true)`
+	searchVisiblePosts = `
+		AND activities.UserID NOT IN (SELECT UserID FROM profiles WHERE Suspended = true)
+		AND activities.ID NOT IN (SELECT SubjectID FROM takedowns WHERE SubjectType = 'post' AND Active = true)
+		AND activities.Visibility IN ('', 'public')
+		AND activities.DeletedAt IS NULL`
+)
+
+// SearchProfiles returns profiles matching an FTS query from SearchMatch
+func SearchProfiles(match string, limit, offset int) []*Profile {
+	profiles, _ := Profiles.Search(searchJoin(SearchUser, "profiles.UserID")+searchVisibleUsers+"\n"+searchOrder,
+		match, limit, offset)
+	return profiles
+}
+
+// SearchRepos returns repos matching an FTS query from SearchMatch
+func SearchRepos(match string, limit, offset int) []*Repo {
+	repos, _ := Repos.Search(searchJoin(SearchRepo, "repos.ID")+searchVisibleRepos+"\n"+searchOrder,
+		match, limit, offset)
+	return repos
+}
+
+// SearchProjects returns projects matching an FTS query from SearchMatch
+func SearchProjects(match string, limit, offset int) []*Project {
+	projects, _ := Projects.Search(searchJoin(SearchProject, "projects.ID")+searchVisibleProjects+"\n"+searchOrder,
+		match, limit, offset)
+	return projects
+}
+
+// SearchApps returns apps matching an FTS query from SearchMatch
+func SearchApps(match string, limit, offset int) []*App {
+	apps, _ := Apps.Search(searchJoin(SearchApp, "apps.ID")+searchVisibleApps+"\n"+searchOrder,
+		match, limit, offset)
+	return apps
+}
+
+// SearchThoughts returns published thoughts matching an FTS query from SearchMatch
+func SearchThoughts(match string, limit, offset int) []*Thought {
+	thoughts, _ := Thoughts.Search(searchJoin(SearchThought, "thoughts.ID")+searchVisibleThoughts+"\n"+searchOrder,
+		match, limit, offset)
+	return thoughts
+}
+
+// SearchPosts returns posts matching an FTS query from SearchMatch
+func SearchPosts(match string, limit, offset int) []*Activity {
+	posts, _ := Activities.Search(searchJoin(SearchPost, "activities.ID")+searchVisiblePosts+"\n"+searchOrder,
+		match, limit, offset)
+	return posts
+}
+
+// SearchCount returns how many visible documents of a kind match
+func SearchCount(kind, match string) int {
+	switch kind {
+	case SearchUser:
+		return Profiles.Count(searchJoin(kind, "profiles.UserID")+searchVisibleUsers, match)
+	case SearchRepo:
+		return Repos.Count(searchJoin(kind, "repos.ID")+searchVisibleRepos, match)
+	case SearchProject:
+		return Projects.Count(searchJoin(kind, "projects.ID")+searchVisibleProjects, match)
+	case SearchApp:
+		return Apps.Count(searchJoin(kind, "apps.ID")+searchVisibleApps, match)
+	case SearchThought:
+		return Thoughts.Count(searchJoin(kind, "thoughts.ID")+searchVisibleThoughts, match)
+	case SearchPost:
+		return Activities.Count(searchJoin(kind, "activities.ID")+searchVisiblePosts, match)
+	}
+	return 0
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// serviceTokenPrefix marks service tokens so they are recognizable in
+// environment files and secret scanners
+const serviceTokenPrefix = "sks_"
+
+// ServiceToken returns the token the project's backend calls the platform's
+// service API with, acting as the project rather than as any user. Every
+// project has one without setting anything up: it's derived from the
+// project ID and ServiceTokenVersion, keyed by AUTH_SECRET, so rotating it
+// only bumps the version.
+func (p *Project) ServiceToken() string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("AUTH_SECRET")))
+	mac.Write([]byte("service:" + p.ID + ":" + strconv.Itoa(p.ServiceTokenVersion)))
+	return serviceTokenPrefix + p.ID + "." + hex.EncodeToString(mac.Sum(nil))[:40]
+}
+
+// RotateServiceToken invalidates the project's service token and issues a
+// new one
+func (p *Project) RotateServiceToken() error {
+	p.ServiceTokenVersion++
+	return Projects.Update(p)
+}
+
+// FindServiceToken returns the project a service token belongs to
+func FindServiceToken(token string) (*Project, error) {
+	id, _, ok := strings.Cut(strings.TrimPrefix(token, serviceTokenPrefix), ".")
+	if !ok || !strings.HasPrefix(token, serviceTokenPrefix) {
+		return nil, errors.New("invalid service token")
+	}
+	project, err := Projects.Get(id)
+	if err != nil || !hmac.Equal([]byte(token), []byte(project.ServiceToken())) {
+		return nil, errors.New("invalid service token")
+	}
+	return project, nil
+}
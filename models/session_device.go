@@ -0,0 +1,85 @@
+package models
+
+import (
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/The-Skyscape/devtools/pkg/authentication"
+)
+
+// SessionSeenInterval throttles how often a session's last-seen time is
+// written, so browsing doesn't write on every request
+const SessionSeenInterval = 5 * time.Minute
+
+// SessionDevice describes the browser behind a session, for the session
+// list at /settings/security. It's recorded the first time the session is
+// used, whichever way the user signed in.
+type SessionDevice struct {
+	application.Model
+	SessionID  string
+	UserID     string
+	Device     string // Browser and OS, e.g. "Chrome on macOS"
+	UserAgent  string
+	IP         string // Where the session was last seen from
+	LastSeenAt time.Time
+}
+
+func (*SessionDevice) Table() string { return "session_devices" }
+
+// TrackSession records the device behind a session the first time it's
+// seen, then keeps its last-seen time and IP current
+func TrackSession(session *authentication.Session, device, userAgent, ip string) {
+	now := time.Now()
+	existing, err := SessionDevices.First("WHERE SessionID = ?", session.ID)
+	if err != nil {
+		SessionDevices.Insert(&SessionDevice{
+			SessionID:  session.ID,
+			UserID:     session.UserID,
+			Device:     device,
+			UserAgent:  userAgent,
+			IP:         ip,
+			LastSeenAt: now,
+		})
+		return
+	}
+
+	if now.Sub(existing.LastSeenAt) < SessionSeenInterval && existing.IP == ip {
+		return
+	}
+	existing.IP = ip
+	existing.LastSeenAt = now
+	SessionDevices.Update(existing)
+}
+
+// SessionsOf returns a user's unexpired sessions, most recently seen first
+func SessionsOf(userID string) []*SessionDevice {
+	sessions, _ := SessionDevices.Search(`
+		WHERE UserID = ?
+			AND SessionID IN (SELECT ID FROM sessions WHERE ExpiresAt > ?)
+		ORDER BY LastSeenAt DESC
+	`, userID, time.Now())
+	return sessions
+}
+
+// Revoke signs the session out
+func (d *SessionDevice) Revoke() error {
+	if session, err := Auth.Sessions.Get(d.SessionID); err == nil {
+		if err = Auth.Sessions.Delete(session); err != nil {
+			return err
+		}
+	}
+	return SessionDevices.Delete(d)
+}
+
+// RevokeOtherSessions signs a user out everywhere except the session to
+// keep, including sessions that were never tracked
+func RevokeOtherSessions(userID, keep string) error {
+	if err := DB.Query(`
+		DELETE FROM sessions WHERE UserID = ? AND ID != ?
+	`, userID, keep).Exec(); err != nil {
+		return err
+	}
+	return DB.Query(`
+		DELETE FROM session_devices WHERE UserID = ? AND SessionID != ?
+	`, userID, keep).Exec()
+}
@@ -0,0 +1,16 @@
+package models
+
+import "github.com/The-Skyscape/devtools/pkg/application"
+
+// SigningKey is a private key that signs tokens hosted apps verify on their
+// own, like access tokens and OpenID Connect ID tokens. Its public half is
+// published at /.well-known/jwks.json under its ID. Keys are kept in the
+// database so every server signs with, and publishes, the same keys.
+type SigningKey struct {
+	application.Model
+	Algorithm  string // JWS algorithm, "RS256" or "EdDSA"
+	PrivateKey string // PKCS #8, PEM encoded
+	Revoked    bool   // Withdrawn early, rejecting every token it signed
+}
+
+func (*SigningKey) Table() string { return "signing_keys" }
@@ -0,0 +1,279 @@
+package models
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+)
+
+// LatencyBuckets are the upper bounds, in milliseconds, latencies are
+// counted under. Percentiles are read from the merged counts, so they're
+// accurate to a bucket; anything slower than the last falls in an overflow
+// bucket after it.
+var LatencyBuckets = []int{10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// SiteTraffic is a day of requests proxied to an app or project. Unlike
+// SiteVisit it counts every request, bots and assets included, since it's
+// what the site costs to serve.
+type SiteTraffic struct {
+	application.Model
+	SiteID   string // App or project ID
+	Day      string // UTC date, "2006-01-02"
+	Requests int
+	Errors   int    // 5xx responses, including the proxy's own
+	BytesIn  int64  // Request bodies
+	BytesOut int64  // Response bodies
+	Latency  string // JSON counts per LatencyBuckets, plus overflow
+}
+
+func (*SiteTraffic) Table() string { return "site_traffic" }
+
+// LatencyCounts returns the day's latency histogram
+func (t *SiteTraffic) LatencyCounts() []int {
+	counts := make([]int, len(LatencyBuckets)+1)
+	var stored []int
+	json.Unmarshal([]byte(t.Latency), &stored)
+	for i := range min(len(stored), len(counts)) {
+		counts[i] = stored[i]
+	}
+	return counts
+}
+
+// LatencyBucket returns the index in LatencyBuckets a latency is counted
+// under, or len(LatencyBuckets) when it's slower than all of them
+func LatencyBucket(d time.Duration) int {
+	ms := int(d.Milliseconds())
+	for i, bound := range LatencyBuckets {
+		if ms <= bound {
+			return i
+		}
+	}
+	return len(LatencyBuckets)
+}
+
+// AddSiteTraffic adds counts gathered by the proxy to a site's day
+func AddSiteTraffic(siteID, day string, requests, errors int, bytesIn, bytesOut int64, latency []int) error {
+	traffic, err := SiteTraffics.First("WHERE SiteID = ? AND Day = ?", siteID, day)
+	if err != nil || traffic == nil {
+		traffic = &SiteTraffic{SiteID: siteID, Day: day}
+	}
+
+	counts := traffic.LatencyCounts()
+	for i := range min(len(latency), len(counts)) {
+		counts[i] += latency[i]
+	}
+	data, _ := json.Marshal(counts)
+
+	traffic.Requests += requests
+	traffic.Errors += errors
+	traffic.BytesIn += bytesIn
+	traffic.BytesOut += bytesOut
+	traffic.Latency = string(data)
+	if traffic.ID == "" {
+		_, err = SiteTraffics.Insert(traffic)
+		return err
+	}
+	return SiteTraffics.Update(traffic)
+}
+
+// DailyTraffic is one day's totals
+type DailyTraffic struct {
+	Day      string
+	Requests int
+	BytesOut int64
+	Percent  int // Requests relative to the busiest day, for charts
+}
+
+// TrafficSummary summarizes a site's proxied traffic over recent days
+type TrafficSummary struct {
+	Days     int
+	Requests int
+	Errors   int
+	BytesIn  int64
+	BytesOut int64
+	P95      int // Milliseconds, the bucket bound 95% of requests were within; -1 past the last
+	Daily    []DailyTraffic
+}
+
+// SiteTrafficFor summarizes the last days of a site's traffic
+func SiteTrafficFor(siteID string, days int) *TrafficSummary {
+	since := time.Now().UTC().AddDate(0, 0, 1-days)
+	rows, _ := SiteTraffics.Search(`
+		WHERE SiteID = ? AND Day >= ?
+	`, siteID, since.Format(time.DateOnly))
+
+	byDay := map[string]*SiteTraffic{}
+	latency := make([]int, len(LatencyBuckets)+1)
+	s := &TrafficSummary{Days: days}
+	for _, row := range rows {
+		byDay[row.Day] = row
+		s.Requests += row.Requests
+		s.Errors += row.Errors
+		s.BytesIn += row.BytesIn
+		s.BytesOut += row.BytesOut
+		for i, n := range row.LatencyCounts() {
+			latency[i] += n
+		}
+	}
+	s.P95 = percentile(latency, 95)
+
+	peak := 1
+	for i := range days {
+		day := since.AddDate(0, 0, i).Format(time.DateOnly)
+		d := DailyTraffic{Day: day}
+		if row, ok := byDay[day]; ok {
+			d.Requests, d.BytesOut = row.Requests, row.BytesOut
+		}
+		s.Daily = append(s.Daily, d)
+		peak = max(peak, d.Requests)
+	}
+	for i := range s.Daily {
+		s.Daily[i].Percent = s.Daily[i].Requests * 100 / peak
+	}
+	return s
+}
+
+// percentile returns the bound of the bucket holding the pth percentile of
+// a latency histogram, 0 when it's empty and -1 when it's in the overflow
+func percentile(counts []int, p int) int {
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank, seen := (total*p+99)/100, 0
+	for i, n := range counts {
+		seen += n
+		if seen >= rank {
+			if i == len(LatencyBuckets) {
+				return -1
+			}
+			return LatencyBuckets[i]
+		}
+	}
+	return -1
+}
+
+// FormatP95 returns the 95th percentile latency for display
+func (s *TrafficSummary) FormatP95() string {
+	switch {
+	case s.Requests == 0:
+		return "—"
+	case s.P95 < 0:
+		return fmt.Sprintf("> %ds", LatencyBuckets[len(LatencyBuckets)-1]/1000)
+	case s.P95 >= 1000:
+		return fmt.Sprintf("≤ %gs", float64(s.P95)/1000)
+	}
+	return fmt.Sprintf("≤ %dms", s.P95)
+}
+
+// ErrorRate returns the percentage of requests that failed with a 5xx
+func (s *TrafficSummary) ErrorRate() string {
+	if s.Requests == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.1f%%", float64(s.Errors)*100/float64(s.Requests))
+}
+
+// FormatBytesIn returns the bytes received for display
+func (s *TrafficSummary) FormatBytesIn() string {
+	return formatBytes(s.BytesIn)
+}
+
+// FormatBytesOut returns the bytes sent for display
+func (s *TrafficSummary) FormatBytesOut() string {
+	return formatBytes(s.BytesOut)
+}
+
+// FormatBytesOut returns the bytes sent for display
+func (d DailyTraffic) FormatBytesOut() string {
+	return formatBytes(d.BytesOut)
+}
+
+// formatBytes returns a byte count in B, KB, MB, GB or TB
+func formatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, exp := float64(n)/unit, 0
+	for value >= unit && exp < 3 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", value, "KMGT"[exp])
+}
+
+// trafficDays is the window shown on manage pages
+const trafficDays = 30
+
+// Traffic summarizes the project's last 30 days of proxied requests
+func (p *Project) Traffic() *TrafficSummary {
+	return SiteTrafficFor(p.ID, trafficDays)
+}
+
+// Traffic summarizes the app's last 30 days of proxied requests
+func (a *App) Traffic() *TrafficSummary {
+	return SiteTrafficFor(a.ID, trafficDays)
+}
+
+// SiteUsage is a site's transfer over a billing period
+type SiteUsage struct {
+	SiteID   string
+	Name     string
+	Requests int
+	BytesIn  int64
+	BytesOut int64
+}
+
+// Bytes returns the total transferred in both directions
+func (u *SiteUsage) Bytes() int64 {
+	return u.BytesIn + u.BytesOut
+}
+
+// FormatBytes returns the total transferred for display
+func (u *SiteUsage) FormatBytes() string {
+	return formatBytes(u.Bytes())
+}
+
+// UsageSince returns the transfer of each of a user's apps and projects
+// since a day, for billing. Sites with no traffic are left out.
+func UsageSince(userID string, since time.Time) []*SiteUsage {
+	names := map[string]string{}
+	if projects, err := Projects.Search("WHERE OwnerID = ?", userID); err == nil {
+		for _, p := range projects {
+			names[p.ID] = p.Name
+		}
+	}
+	if apps, err := Apps.Search("WHERE RepoID IN (SELECT ID FROM repos WHERE OwnerID = ?)", userID); err == nil {
+		for _, a := range apps {
+			names[a.ID] = a.Name
+		}
+	}
+
+	var usage []*SiteUsage
+	day := since.UTC().Format(time.DateOnly)
+	for id, name := range names {
+		rows, _ := SiteTraffics.Search("WHERE SiteID = ? AND Day >= ?", id, day)
+		u := &SiteUsage{SiteID: id, Name: name}
+		for _, row := range rows {
+			u.Requests += row.Requests
+			u.BytesIn += row.BytesIn
+			u.BytesOut += row.BytesOut
+		}
+		if u.Requests > 0 {
+			usage = append(usage, u)
+		}
+	}
+	slices.SortFunc(usage, func(a, b *SiteUsage) int {
+		return cmp.Compare(b.Bytes(), a.Bytes())
+	})
+	return usage
+}
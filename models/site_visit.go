@@ -0,0 +1,147 @@
+package models
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+)
+
+// Site analytics dimensions
+const (
+	VisitTotal    = "total"
+	VisitPage     = "page"
+	VisitReferrer = "referrer"
+	VisitCountry  = "country"
+)
+
+// SiteVisit counts a day's page views of an app or project for one value of
+// a dimension. Visitors are only counted for totals, from hashes that are
+// never stored, so nothing here identifies a visitor.
+type SiteVisit struct {
+	application.Model
+	SiteID    string // App or project ID
+	Day       string // UTC date, "2006-01-02"
+	Dimension string
+	Value     string // Path, referring host or country code; "" for totals
+	Views     int
+	Visitors  int
+}
+
+func (*SiteVisit) Table() string { return "site_visits" }
+
+// AddSiteVisits adds to a day's counts for one dimension value
+func AddSiteVisits(siteID, day, dimension, value string, views, visitors int) error {
+	visit, err := SiteVisits.First(`
+		WHERE SiteID = ? AND Day = ? AND Dimension = ? AND Value = ?
+	`, siteID, day, dimension, value)
+	if err == nil && visit != nil {
+		visit.Views += views
+		visit.Visitors += visitors
+		return SiteVisits.Update(visit)
+	}
+
+	_, err = SiteVisits.Insert(&SiteVisit{
+		SiteID:    siteID,
+		Day:       day,
+		Dimension: dimension,
+		Value:     value,
+		Views:     views,
+		Visitors:  visitors,
+	})
+	return err
+}
+
+// VisitCount is a dimension value with its page views
+type VisitCount struct {
+	Value string
+	Views int
+}
+
+// DailyVisits is one day's totals
+type DailyVisits struct {
+	Day      string
+	Views    int
+	Visitors int
+	Percent  int // Views relative to the busiest day, for charts
+}
+
+// SiteAnalytics summarizes a site's traffic over recent days
+type SiteAnalytics struct {
+	Days      int
+	Views     int
+	Visitors  int
+	Daily     []DailyVisits // Oldest first, one entry per day
+	Pages     []VisitCount
+	Referrers []VisitCount
+	Countries []VisitCount
+}
+
+// analyticsTop is how many pages, referrers and countries are listed
+const analyticsTop = 10
+
+// SiteAnalyticsFor summarizes the last days of a site's traffic
+func SiteAnalyticsFor(siteID string, days int) *SiteAnalytics {
+	since := time.Now().UTC().AddDate(0, 0, 1-days)
+	visits, _ := SiteVisits.Search(`
+		WHERE SiteID = ? AND Day >= ?
+	`, siteID, since.Format(time.DateOnly))
+
+	daily := map[string]*DailyVisits{}
+	dims := map[string]map[string]int{}
+	for _, v := range visits {
+		if v.Dimension == VisitTotal {
+			daily[v.Day] = &DailyVisits{Day: v.Day, Views: v.Views, Visitors: v.Visitors}
+			continue
+		}
+		if dims[v.Dimension] == nil {
+			dims[v.Dimension] = map[string]int{}
+		}
+		dims[v.Dimension][v.Value] += v.Views
+	}
+
+	a, peak := &SiteAnalytics{Days: days}, 1
+	for i := range days {
+		day := since.AddDate(0, 0, i).Format(time.DateOnly)
+		d := DailyVisits{Day: day}
+		if found, ok := daily[day]; ok {
+			d = *found
+		}
+		a.Views += d.Views
+		a.Visitors += d.Visitors
+		a.Daily = append(a.Daily, d)
+		peak = max(peak, d.Views)
+	}
+	for i := range a.Daily {
+		a.Daily[i].Percent = a.Daily[i].Views * 100 / peak
+	}
+	a.Pages = topVisits(dims[VisitPage])
+	a.Referrers = topVisits(dims[VisitReferrer])
+	a.Countries = topVisits(dims[VisitCountry])
+	return a
+}
+
+func topVisits(counts map[string]int) []VisitCount {
+	top := make([]VisitCount, 0, len(counts))
+	for value, views := range counts {
+		top = append(top, VisitCount{value, views})
+	}
+	slices.SortFunc(top, func(a, b VisitCount) int {
+		return cmp.Or(cmp.Compare(b.Views, a.Views), cmp.Compare(a.Value, b.Value))
+	})
+	return top[:min(len(top), analyticsTop)]
+}
+
+// analyticsDays is the window shown on manage pages
+const analyticsDays = 30
+
+// Analytics summarizes the project's last 30 days of traffic
+func (p *Project) Analytics() *SiteAnalytics {
+	return SiteAnalyticsFor(p.ID, analyticsDays)
+}
+
+// Analytics summarizes the app's last 30 days of traffic
+func (a *App) Analytics() *SiteAnalytics {
+	return SiteAnalyticsFor(a.ID, analyticsDays)
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"log/slog"
+	"time"
+)
+
+// SitemapEntry is a public page listed in the sitemap
+type SitemapEntry struct {
+	Path     string
+	Modified time.Time
+}
+
+// SitemapEntries lists every public profile, repo, project, app and
+// published thought, hiding the same content search does
+func SitemapEntries() []SitemapEntry {
+	var entries []SitemapEntry
+
+	profiles, err := Profiles.Search(`
+		WHERE profiles.NoIndex = false` + searchVisibleUsers + `
+		ORDER BY profiles.CreatedAt
+	`)
+	if err != nil {
+		slog.Error("failed to list profiles for sitemap", "error", err)
+	}
+	for _, p := range profiles {
+		if user := p.User(); user != nil {
+			entries = append(entries, SitemapEntry{"/user/" + user.Handle, p.UpdatedAt})
+		}
+	}
+
+	repos, err := Repos.Search(`
+		WHERE 1 = 1` + searchVisibleRepos + `
+		ORDER BY repos.CreatedAt
+	`)
+	if err != nil {
+		slog.Error("failed to list repos for sitemap", "error", err)
+	}
+	for _, r := range repos {
+		entries = append(entries, SitemapEntry{"/repo/" + r.ID, r.UpdatedAt})
+	}
+
+	projects, err := Projects.Search(`
+		WHERE 1 = 1` + searchVisibleProjects + `
+		ORDER BY projects.CreatedAt
+	`)
+	if err != nil {
+		slog.Error("failed to list projects for sitemap", "error", err)
+	}
+	for _, p := range projects {
+		entries = append(entries, SitemapEntry{"/project/" + p.ID, p.UpdatedAt})
+	}
+
+	apps, err := Apps.Search(`
+		WHERE 1 = 1` + searchVisibleApps + `
+		ORDER BY apps.CreatedAt
+	`)
+	if err != nil {
+		slog.Error("failed to list apps for sitemap", "error", err)
+	}
+	for _, a := range apps {
+		entries = append(entries, SitemapEntry{"/app/" + a.ID, a.UpdatedAt})
+	}
+
+	thoughts, err := Thoughts.Search(`
+		WHERE 1 = 1` + searchVisibleThoughts + `
+		ORDER BY thoughts.CreatedAt
+	`)
+	if err != nil {
+		slog.Error("failed to list thoughts for sitemap", "error", err)
+	}
+	for _, t := range thoughts {
+		entries = append(entries, SitemapEntry{"/thought/" + t.ID, t.UpdatedAt})
+	}
+
+	return entries
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/The-Skyscape/devtools/pkg/authentication"
+)
+
+// SocialSigninTTL is how long the user has to approve signing in at the
+// provider
+const SocialSigninTTL = 10 * time.Minute
+
+// SocialIdentity links a GitHub or Google account to a user, so they can
+// sign in with it
+type SocialIdentity struct {
+	application.Model
+	UserID   string
+	Provider string // "github" or "google"
+	Subject  string // The provider's ID for the account
+	Email    string // As the provider reported it when linked
+}
+
+func (*SocialIdentity) Table() string { return "social_identities" }
+
+// FindSocialIdentity returns the link for a provider account
+func FindSocialIdentity(provider, subject string) (*SocialIdentity, error) {
+	return SocialIdentities.First("WHERE Provider = ? AND Subject = ?", provider, subject)
+}
+
+// SocialIdentitiesOf returns the provider accounts linked to a user
+func SocialIdentitiesOf(userID string) []*SocialIdentity {
+	identities, _ := SocialIdentities.Search(`
+		WHERE UserID = ?
+		ORDER BY Provider
+	`, userID)
+	return identities
+}
+
+// LinkSocialIdentity links a provider account to a user. An account can
+// only be linked to one user.
+func LinkSocialIdentity(userID, provider, subject, email string) (*SocialIdentity, error) {
+	if existing, err := FindSocialIdentity(provider, subject); err == nil {
+		if existing.UserID != userID {
+			return nil, errors.New("this account is already connected to another user")
+		}
+		return existing, nil
+	}
+	if SocialIdentities.Count("WHERE UserID = ? AND Provider = ?", userID, provider) > 0 {
+		return nil, errors.New("you already connected an account from this provider")
+	}
+	return SocialIdentities.Insert(&SocialIdentity{
+		UserID:   userID,
+		Provider: provider,
+		Subject:  subject,
+		Email:    email,
+	})
+}
+
+// Unlink removes the link, unless it's the only way left to sign in
+func (s *SocialIdentity) Unlink(user *authentication.User) error {
+	if len(user.PassHash) == 0 &&
+		SocialIdentities.Count("WHERE UserID = ?", user.ID) <= 1 &&
+		WebAuthnCredentials.Count("WHERE UserID = ?", user.ID) == 0 {
+		return errors.New("set a password before disconnecting your only way to sign in")
+	}
+	return SocialIdentities.Delete(s)
+}
+
+// SocialSignin is a sign in waiting on the provider. Its ID is the OAuth
+// state, which is also kept in a cookie so the callback can only finish
+// the sign in in the browser that started it.
+type SocialSignin struct {
+	application.Model
+	Provider   string
+	Next       string // Where to go after signing in
+	Invite     string // Invite code to redeem if this signs someone up
+	LinkUserID string // Set when a signed-in user is connecting an account
+	ExpiresAt  time.Time
+}
+
+func (*SocialSignin) Table() string { return "social_signins" }
+
+// NewSocialSignin starts signing in with a provider
+func NewSocialSignin(provider, next, invite, linkUserID string) (*SocialSignin, error) {
+	DB.Query("DELETE FROM social_signins WHERE ExpiresAt < ?", time.Now()).Exec()
+	return SocialSignins.Insert(&SocialSignin{
+		Provider:   provider,
+		Next:       next,
+		Invite:     invite,
+		LinkUserID: linkUserID,
+		ExpiresAt:  time.Now().Add(SocialSigninTTL),
+	})
+}
+
+// UseSocialSignin returns an unexpired sign in, which can only be used once
+func UseSocialSignin(id, provider string) (*SocialSignin, error) {
+	signin, err := SocialSignins.Get(id)
+	if err != nil || signin.Provider != provider || time.Now().After(signin.ExpiresAt) {
+		return nil, errors.New("sign-in expired, please sign in again")
+	}
+	SocialSignins.Delete(signin)
+	return signin, nil
+}
+
+var handleInvalid = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// AvailableHandle turns a suggested handle into one no one has, numbering
+// it if it's taken
+func AvailableHandle(suggested string) string {
+	base := strings.Trim(handleInvalid.ReplaceAllString(suggested, "-"), "-")
+	if len(base) > 30 {
+		base = base[:30]
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	handle := base
+	for i := 2; Auth.Users.Count("WHERE Handle = ? COLLATE NOCASE", handle) > 0; i++ {
+		handle = fmt.Sprintf("%s%d", base, i)
+	}
+	return handle
+}
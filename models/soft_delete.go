@@ -0,0 +1,161 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// DeletedRetention is how long deleted posts and comments are kept as
+// tombstones, so accidental deletions can be restored and moderators keep
+// the evidence, before PurgeDeleted removes them for good
+const DeletedRetention = 30 * 24 * time.Hour
+
+// errNotRestorable is returned for tombstones that can't be brought back
+var errNotRestorable = errors.New("this can no longer be restored")
+
+// IsDeleted returns true if the comment is a tombstone
+func (c *Comment) IsDeleted() bool {
+	return c.DeletedAt != nil
+}
+
+// RemovedByModerator returns true if someone other than the author
+// deleted the comment
+func (c *Comment) RemovedByModerator() bool {
+	return c.IsDeleted() && c.DeletedBy != c.UserID
+}
+
+// CanRestore returns true if the user may restore the deleted comment.
+// Authors can undo their own deletions; only admins undo a moderator's.
+func (c *Comment) CanRestore(userID string, isAdmin bool) bool {
+	if !c.IsDeleted() || time.Since(*c.DeletedAt) > DeletedRetention {
+		return false
+	}
+	return isAdmin || (c.DeletedBy == userID && userID == c.UserID)
+}
+
+// SoftDelete turns the comment into a tombstone, keeping its content for
+// DeletedRetention
+func (c *Comment) SoftDelete(userID string) error {
+	if c.IsDeleted() {
+		return nil
+	}
+	now := time.Now()
+	c.DeletedAt, c.DeletedBy = &now, userID
+	if err := Comments.Update(c); err != nil {
+		return err
+	}
+	CountComment(c, -1)
+	return nil
+}
+
+// Restore brings a deleted comment back
+func (c *Comment) Restore() error {
+	if !c.IsDeleted() || time.Since(*c.DeletedAt) > DeletedRetention {
+		return errNotRestorable
+	}
+	c.DeletedAt, c.DeletedBy = nil, ""
+	if err := Comments.Update(c); err != nil {
+		return err
+	}
+	CountComment(c, 1)
+	return nil
+}
+
+// IsDeleted returns true if the post is a tombstone
+func (a *Activity) IsDeleted() bool {
+	return a.DeletedAt != nil
+}
+
+// RemovedByModerator returns true if someone other than the author
+// deleted the post
+func (a *Activity) RemovedByModerator() bool {
+	return a.IsDeleted() && a.DeletedBy != a.UserID
+}
+
+// CanRestore returns true if the user may restore the deleted post.
+// Authors can undo their own deletions; only admins undo a moderator's.
+func (a *Activity) CanRestore(userID string, isAdmin bool) bool {
+	if !a.IsDeleted() || time.Since(*a.DeletedAt) > DeletedRetention {
+		return false
+	}
+	return isAdmin || (a.DeletedBy == userID && userID == a.UserID)
+}
+
+// SoftDelete takes the post out of feeds, tag pages and search, leaving a
+// tombstone at its link for DeletedRetention
+func (a *Activity) SoftDelete(userID string) error {
+	if a.IsDeleted() {
+		return nil
+	}
+	now := time.Now()
+	a.DeletedAt, a.DeletedBy = &now, userID
+	if err := Activities.Update(a); err != nil {
+		return err
+	}
+	return UntagActivity(a)
+}
+
+// Restore brings a deleted post back
+func (a *Activity) Restore() error {
+	if !a.IsDeleted() || time.Since(*a.DeletedAt) > DeletedRetention {
+		return errNotRestorable
+	}
+	a.DeletedAt, a.DeletedBy = nil, ""
+	if err := Activities.Update(a); err != nil {
+		return err
+	}
+	TagActivity(a)
+	return nil
+}
+
+// PurgeDeleted permanently removes posts and comments that were deleted
+// more than DeletedRetention ago, along with the comments on those posts.
+// It returns how many posts and comments were removed.
+func PurgeDeleted() (posts, comments int, err error) {
+	cutoff := time.Now().Add(-DeletedRetention)
+
+	posts = Activities.Count("WHERE DeletedAt IS NOT NULL AND DeletedAt < ?", cutoff)
+	comments = Comments.Count(`
+		WHERE (DeletedAt IS NOT NULL AND DeletedAt < ?)
+			OR (SubjectType = 'post' AND SubjectID IN (
+				SELECT ID FROM activities WHERE DeletedAt IS NOT NULL AND DeletedAt < ?
+			))
+	`, cutoff, cutoff)
+
+	if err = DB.Query(`
+		DELETE FROM comments
+		WHERE (DeletedAt IS NOT NULL AND DeletedAt < ?)
+			OR (SubjectType = 'post' AND SubjectID IN (
+				SELECT ID FROM activities WHERE DeletedAt IS NOT NULL AND DeletedAt < ?
+			))
+	`, cutoff, cutoff).Exec(); err != nil {
+		return 0, 0, err
+	}
+	if err = DB.Query(`
+		DELETE FROM reactions WHERE ActivityID IN (
+			SELECT ID FROM activities WHERE DeletedAt IS NOT NULL AND DeletedAt < ?
+		)
+	`, cutoff).Exec(); err != nil {
+		return 0, 0, err
+	}
+	if err = DB.Query(`
+		DELETE FROM activities WHERE DeletedAt IS NOT NULL AND DeletedAt < ?
+	`, cutoff).Exec(); err != nil {
+		return 0, 0, err
+	}
+	return posts, comments, nil
+}
+
+// PruneBefore permanently deletes rows from table whose column is older
+// than cutoff, returning how many were deleted. Table and column must come
+// from code, never from a request.
+func PruneBefore(table, column string, cutoff time.Time) (int, error) {
+	var count int
+	if err := DB.Query(`SELECT COUNT(*) FROM `+table+` WHERE `+column+` < ?`, cutoff).Scan(&count); err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	return count, DB.Query(`DELETE FROM `+table+` WHERE `+column+` < ?`, cutoff).Exec()
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"golang.org/x/crypto/ssh"
+)
+
+// MaxSSHKeys bounds how many keys one account can register
+const MaxSSHKeys = 20
+
+// SSHKey is a public key a user can push and pull over SSH with
+type SSHKey struct {
+	application.Model
+	UserID      string
+	Name        string // Label the user gave it, e.g. "Work laptop"
+	Fingerprint string // SHA256 fingerprint, as ssh-keygen -l prints it
+	PublicKey   string // authorized_keys line, without the comment
+	LastUsedAt  time.Time
+}
+
+func (*SSHKey) Table() string { return "ssh_keys" }
+
+// AddSSHKey parses an authorized_keys line and registers it for a user. The
+// key's comment names it when no name is given.
+func AddSSHKey(userID, name, line string) (*SSHKey, error) {
+	key, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(line)))
+	if err != nil {
+		return nil, errors.New("not a valid SSH public key")
+	}
+	if key.Type() == ssh.KeyAlgoDSA {
+		return nil, errors.New("DSA keys are not supported")
+	}
+
+	fingerprint := ssh.FingerprintSHA256(key)
+	if SSHKeys.Count("WHERE Fingerprint = ?", fingerprint) > 0 {
+		return nil, errors.New("this SSH key is already in use")
+	}
+	if SSHKeys.Count("WHERE UserID = ?", userID) >= MaxSSHKeys {
+		return nil, errors.New("too many SSH keys")
+	}
+
+	if name = strings.TrimSpace(name); name == "" {
+		name = strings.TrimSpace(comment)
+	}
+	if name == "" {
+		name = key.Type()
+	}
+
+	return SSHKeys.Insert(&SSHKey{
+		UserID:      userID,
+		Name:        name,
+		Fingerprint: fingerprint,
+		PublicKey:   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))),
+	})
+}
+
+// SSHKeysOf returns a user's SSH keys, most recently used first
+func SSHKeysOf(userID string) []*SSHKey {
+	keys, _ := SSHKeys.Search(`
+		WHERE UserID = ?
+		ORDER BY LastUsedAt DESC, CreatedAt DESC
+	`, userID)
+	return keys
+}
+
+// FindSSHKey looks a key up by the one an SSH client offered
+func FindSSHKey(key ssh.PublicKey) (*SSHKey, error) {
+	return SSHKeys.First("WHERE Fingerprint = ?", ssh.FingerprintSHA256(key))
+}
+
+// Touch records that the key was just used
+func (k *SSHKey) Touch() {
+	k.LastUsedAt = time.Now()
+	SSHKeys.Update(k)
+}
@@ -4,11 +4,25 @@ import (
 	"github.com/The-Skyscape/devtools/pkg/application"
 )
 
+// Star subject types
+const (
+	StarRepo    = "repo"
+	StarProject = "project"
+	StarApp     = "app"
+	StarThought = "thought"
+)
+
+// StarTypes lists every kind of thing that can be starred
+var StarTypes = []string{StarProject, StarRepo, StarApp, StarThought}
+
+// Star is a user starring a repo, project, app or thought
 type Star struct {
 	application.Model
-	UserID    string
-	RepoID    string // legacy - for Repo stars
-	ProjectID string // new - for Project stars
+	UserID      string
+	SubjectType string // One of StarTypes
+	SubjectID   string
+	RepoID      string // Deprecated: backfilled into SubjectID by migration.MigrateStars
+	ProjectID   string // Deprecated: backfilled into SubjectID by migration.MigrateStars
 }
 
 func (*Star) Table() string {
@@ -21,17 +35,196 @@ func (s *Star) User() *Profile {
 }
 
 func (s *Star) Repo() *Repo {
-	if s.RepoID == "" {
+	if s.SubjectType != StarRepo {
 		return nil
 	}
-	repo, _ := Repos.Get(s.RepoID)
+	repo, _ := Repos.Get(s.SubjectID)
 	return repo
 }
 
 func (s *Star) Project() *Project {
-	if s.ProjectID == "" {
+	if s.SubjectType != StarProject {
 		return nil
 	}
-	project, _ := Projects.Get(s.ProjectID)
+	project, _ := Projects.Get(s.SubjectID)
 	return project
 }
+
+func (s *Star) App() *App {
+	if s.SubjectType != StarApp {
+		return nil
+	}
+	app, _ := Apps.Get(s.SubjectID)
+	return app
+}
+
+func (s *Star) Thought() *Thought {
+	if s.SubjectType != StarThought {
+		return nil
+	}
+	thought, _ := Thoughts.Get(s.SubjectID)
+	return thought
+}
+
+// FindStar returns a user's star on a subject, or nil
+func FindStar(userID, subjectType, subjectID string) *Star {
+	star, err := Stars.First(`
+		WHERE UserID = ? AND SubjectType = ? AND SubjectID = ?
+	`, userID, subjectType, subjectID)
+	if err != nil {
+		return nil
+	}
+	return star
+}
+
+// IsStarred returns true if the user starred the subject
+func IsStarred(userID, subjectType, subjectID string) bool {
+	return FindStar(userID, subjectType, subjectID) != nil
+}
+
+// StarsOf returns every star on a subject
+func StarsOf(subjectType, subjectID string) []*Star {
+	stars, _ := Stars.Search(`
+		WHERE SubjectType = ? AND SubjectID = ?
+		ORDER BY CreatedAt DESC
+	`, subjectType, subjectID)
+	return stars
+}
+
+// RecentStars returns the latest stars on a subject
+func RecentStars(subjectType, subjectID string, limit int) []*Star {
+	stars, _ := Stars.Search(`
+		WHERE SubjectType = ? AND SubjectID = ?
+		ORDER BY CreatedAt DESC
+		LIMIT ?
+	`, subjectType, subjectID, limit)
+	return stars
+}
+
+// StarSubject is the thing a star points at
+type StarSubject struct {
+	Type    string
+	ID      string
+	OwnerID string
+	Name    string
+	URL     string
+}
+
+// FindStarSubject looks up a starrable subject. Draft thoughts can't be
+// starred.
+func FindStarSubject(subjectType, subjectID string) (*StarSubject, error) {
+	subject := &StarSubject{Type: subjectType, ID: subjectID, URL: "/" + subjectType + "/" + subjectID}
+	switch subjectType {
+	case StarRepo:
+		repo, err := Repos.Get(subjectID)
+		if err != nil {
+			return nil, err
+		}
+		subject.OwnerID, subject.Name = repo.OwnerID, repo.Name
+	case StarProject:
+		project, err := Projects.Get(subjectID)
+		if err != nil {
+			return nil, err
+		}
+		subject.OwnerID, subject.Name = project.OwnerID, project.Name
+	case StarApp:
+		app, err := Apps.Get(subjectID)
+		if err != nil {
+			return nil, err
+		}
+		if owner := app.Owner(); owner != nil {
+			subject.OwnerID = owner.ID
+		}
+		subject.Name = app.Name
+	case StarThought:
+		thought, err := Thoughts.Get(subjectID)
+		if err != nil || !thought.Published {
+			return nil, application.ErrNotFound
+		}
+		subject.OwnerID, subject.Name = thought.UserID, thought.Title
+	default:
+		return nil, application.ErrNotFound
+	}
+	return subject, nil
+}
+
+// Subject returns what the star points at, or nil if it's gone
+func (s *Star) Subject() *StarSubject {
+	subject, err := FindStarSubject(s.SubjectType, s.SubjectID)
+	if err != nil {
+		return nil
+	}
+	return subject
+}
+
+// Stars returns everything the user starred, newest first
+func (p *Profile) Stars() []*Star {
+	return StarsBy(p.UserID, "")
+}
+
+// StarsBy returns a user's stars of one type, or of every type when
+// subjectType is empty, newest first
+func StarsBy(userID, subjectType string) []*Star {
+	if subjectType == "" {
+		stars, _ := Stars.Search(`
+			WHERE UserID = ?
+			ORDER BY CreatedAt DESC
+		`, userID)
+		return stars
+	}
+	stars, _ := Stars.Search(`
+		WHERE UserID = ? AND SubjectType = ?
+		ORDER BY CreatedAt DESC
+	`, userID, subjectType)
+	return stars
+}
+
+// StarRecommendation suggests things starred by people who also starred
+// one of the user's stars
+type StarRecommendation struct {
+	Because *StarSubject
+	Stars   []*Star // One star per suggested subject
+}
+
+// RecommendStars suggests what to star next from the user's latest stars:
+// the first one whose other stargazers starred things the user hasn't
+// starred yet and doesn't own.
+func RecommendStars(userID string, limit int) *StarRecommendation {
+	recent, _ := Stars.Search(`
+		WHERE UserID = ?
+		ORDER BY CreatedAt DESC
+		LIMIT 5
+	`, userID)
+
+	for _, star := range recent {
+		subject := star.Subject()
+		if subject == nil {
+			continue
+		}
+
+		suggested, _ := Stars.Search(`
+			WHERE UserID IN (
+				SELECT UserID FROM stars
+				WHERE SubjectType = ? AND SubjectID = ? AND UserID != ?
+			)
+			AND SubjectType || ':' || SubjectID NOT IN (
+				SELECT SubjectType || ':' || SubjectID FROM stars WHERE UserID = ?
+			)
+			AND SubjectID NOT IN (SELECT ID FROM repos WHERE OwnerID = ?)
+			AND SubjectID NOT IN (SELECT ID FROM projects WHERE OwnerID = ?)
+			AND SubjectID NOT IN (SELECT ID FROM thoughts WHERE UserID = ? OR Published = false)
+			GROUP BY SubjectType, SubjectID
+			ORDER BY COUNT(*) DESC, MAX(CreatedAt) DESC
+			LIMIT ?
+		`, subject.Type, subject.ID, userID, userID, userID, userID, userID, limit)
+		if len(suggested) > 0 {
+			return &StarRecommendation{Because: subject, Stars: suggested}
+		}
+	}
+	return nil
+}
+
+// StarredCount returns how many things the user starred
+func (p *Profile) StarredCount() int {
+	return Stars.Count("WHERE UserID = ?", p.UserID)
+}
@@ -0,0 +1,179 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/The-Skyscape/devtools/pkg/authentication"
+)
+
+// Suspension kinds. Suspensions may expire; bans last until lifted.
+const (
+	SuspensionSuspended = "suspended"
+	SuspensionBanned    = "banned"
+)
+
+// Appeal states
+const (
+	AppealPending  = "pending"
+	AppealApproved = "approved"
+	AppealDenied   = "denied"
+)
+
+// Suspension records a moderation action against a user. While active the
+// user can't sign in, their content is hidden, and their apps are offline.
+type Suspension struct {
+	application.Model
+	UserID       string
+	IssuedBy     string // Admin user ID
+	Kind         string // "suspended" or "banned"
+	Reason       string
+	EndsAt       time.Time // Zero for indefinite
+	Active       bool
+	LiftedBy     string // Admin user ID, empty if it expired
+	LiftedAt     time.Time
+	Appeal       string // User's appeal message
+	AppealStatus string // "", "pending", "approved", "denied"
+	AppealedAt   time.Time
+}
+
+func (*Suspension) Table() string { return "suspensions" }
+
+// User returns the suspended user
+func (s *Suspension) User() *authentication.User {
+	user, _ := Auth.Users.Get(s.UserID)
+	return user
+}
+
+// Issuer returns the admin who issued the suspension
+func (s *Suspension) Issuer() *authentication.User {
+	user, _ := Auth.Users.Get(s.IssuedBy)
+	return user
+}
+
+// IsBan returns true for permanent bans
+func (s *Suspension) IsBan() bool {
+	return s.Kind == SuspensionBanned
+}
+
+// IsExpired returns true if a timed suspension has run out
+func (s *Suspension) IsExpired() bool {
+	return !s.IsBan() && !s.EndsAt.IsZero() && time.Now().After(s.EndsAt)
+}
+
+// CanAppeal returns true if the user hasn't appealed yet
+func (s *Suspension) CanAppeal() bool {
+	return s.Active && s.AppealStatus == ""
+}
+
+// AppealToken authorizes an appeal without a session, since suspended
+// users can't sign in
+func (s *Suspension) AppealToken() string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("AUTH_SECRET")))
+	mac.Write([]byte("appeal:" + s.ID + ":" + s.UserID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// URL returns the page where the user can review and appeal the suspension
+func (s *Suspension) URL() string {
+	return "/suspended/" + s.ID + "?token=" + s.AppealToken()
+}
+
+// VerifyAppealToken checks a token produced by AppealToken
+func (s *Suspension) VerifyAppealToken(token string) bool {
+	return hmac.Equal([]byte(token), []byte(s.AppealToken()))
+}
+
+// ActiveSuspension returns the user's current suspension, lifting it first
+// if it has expired
+func ActiveSuspension(userID string) *Suspension {
+	s, err := Suspensions.First("WHERE UserID = ? AND Active = true ORDER BY CreatedAt DESC", userID)
+	if err != nil {
+		return nil
+	}
+
+	if s.IsExpired() {
+		s.Lift("")
+		return nil
+	}
+
+	return s
+}
+
+// Suspend records a suspension, hides the user's profile, and takes their
+// apps offline. A zero duration suspends indefinitely.
+func Suspend(userID, adminID, kind, reason string, duration time.Duration) (*Suspension, error) {
+	s := &Suspension{
+		UserID:   userID,
+		IssuedBy: adminID,
+		Kind:     kind,
+		Reason:   reason,
+		Active:   true,
+	}
+	if kind != SuspensionBanned && duration > 0 {
+		s.EndsAt = time.Now().Add(duration)
+	}
+
+	// Replace any existing suspension so only one is active at a time
+	if existing := ActiveSuspension(userID); existing != nil {
+		existing.Active = false
+		existing.LiftedBy = adminID
+		existing.LiftedAt = time.Now()
+		Suspensions.Update(existing)
+	}
+
+	s, err := Suspensions.Insert(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, setSuspended(userID, true)
+}
+
+// Lift ends the suspension and restores the user's profile and apps
+func (s *Suspension) Lift(adminID string) error {
+	s.Active = false
+	s.LiftedBy = adminID
+	s.LiftedAt = time.Now()
+	if err := Suspensions.Update(s); err != nil {
+		return err
+	}
+
+	return setSuspended(s.UserID, false)
+}
+
+// setSuspended flags the profile and stops or restores the user's apps.
+// Only apps that were online are suspended so restoring doesn't resurrect
+// apps the owner had shut down.
+func setSuspended(userID string, suspended bool) error {
+	profile, err := Profiles.Get(userID)
+	if err != nil {
+		return err
+	}
+
+	profile.Suspended = suspended
+	if err = Profiles.Update(profile); err != nil {
+		return err
+	}
+
+	from, to := "online", "suspended"
+	if !suspended {
+		from, to = to, from
+	}
+
+	if err = DB.Query(
+		"UPDATE projects SET Status = ? WHERE OwnerID = ? AND Status = ?",
+		to, userID, from,
+	).Exec(); err != nil {
+		return err
+	}
+
+	return DB.Query(`
+		UPDATE apps SET Status = ?
+		WHERE Status = ? AND RepoID IN (SELECT ID FROM repos WHERE OwnerID = ?)
+	`, to, from, userID).Exec()
+}
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"github.com/The-Skyscape/devtools/pkg/authentication"
+	"github.com/pkg/errors"
+)
+
+// Takedown subject types
+const (
+	TakedownPost    = "post"
+	TakedownThought = "thought"
+	TakedownRepo    = "repo"
+	TakedownProject = "project"
+	TakedownApp     = "app"
+)
+
+// Takedown records an admin removing a piece of content. Records are never
+// deleted so they double as the audit trail; restoring marks them inactive.
+type Takedown struct {
+	application.Model
+	SubjectType string // "post", "thought", "repo", "project", "app"
+	SubjectID   string
+	AuthorID    string // Owner of the content at takedown time
+	AdminID     string // Admin who took it down
+	Reason      string
+	Active      bool
+	RestoredBy  string // Admin who restored it
+	RestoredAt  time.Time
+}
+
+func (*Takedown) Table() string { return "takedowns" }
+
+// Author returns the owner of the removed content
+func (t *Takedown) Author() *authentication.User {
+	user, _ := Auth.Users.Get(t.AuthorID)
+	return user
+}
+
+// Admin returns the admin who took the content down
+func (t *Takedown) Admin() *authentication.User {
+	user, _ := Auth.Users.Get(t.AdminID)
+	return user
+}
+
+// Restorer returns the admin who restored the content
+func (t *Takedown) Restorer() *authentication.User {
+	if t.RestoredBy == "" {
+		return nil
+	}
+	user, _ := Auth.Users.Get(t.RestoredBy)
+	return user
+}
+
+// SubjectURL returns the path to the removed content
+func (t *Takedown) SubjectURL() string {
+	switch t.SubjectType {
+	case TakedownPost:
+		return "/post/" + t.SubjectID
+	default:
+		return "/" + t.SubjectType + "/" + t.SubjectID
+	}
+}
+
+// ActiveTakedown returns the takedown in effect for the subject, if any
+func ActiveTakedown(subjectType, subjectID string) *Takedown {
+	t, err := Takedowns.First(`
+		WHERE SubjectType = ? AND SubjectID = ? AND Active = true
+	`, subjectType, subjectID)
+	if err != nil {
+		return nil
+	}
+	return t
+}
+
+// TakedownSubjectOwner returns the author of the content being taken down
+func TakedownSubjectOwner(subjectType, subjectID string) (string, error) {
+	switch subjectType {
+	case TakedownPost:
+		if a, err := Activities.Get(subjectID); err == nil {
+			return a.UserID, nil
+		}
+	case TakedownThought:
+		if t, err := Thoughts.Get(subjectID); err == nil {
+			return t.UserID, nil
+		}
+	case TakedownRepo:
+		if r, err := Repos.Get(subjectID); err == nil {
+			return r.OwnerID, nil
+		}
+	case TakedownProject:
+		if p, err := Projects.Get(subjectID); err == nil {
+			return p.OwnerID, nil
+		}
+	case TakedownApp:
+		if a, err := Apps.Get(subjectID); err == nil {
+			if repo := a.Repo(); repo != nil {
+				return repo.OwnerID, nil
+			}
+		}
+	default:
+		return "", errors.New("unsupported content type")
+	}
+	return "", errors.New("content not found")
+}
+
+// TakeDown removes the content and takes hosted apps offline
+func TakeDown(subjectType, subjectID, adminID, reason string) (*Takedown, error) {
+	if existing := ActiveTakedown(subjectType, subjectID); existing != nil {
+		return nil, errors.New("content is already taken down")
+	}
+
+	authorID, err := TakedownSubjectOwner(subjectType, subjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := Takedowns.Insert(&Takedown{
+		SubjectType: subjectType,
+		SubjectID:   subjectID,
+		AuthorID:    authorID,
+		AdminID:     adminID,
+		Reason:      reason,
+		Active:      true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return t, setRemoved(subjectType, subjectID, true)
+}
+
+// Restore puts the content back and brings hosted apps back online
+func (t *Takedown) Restore(adminID string) error {
+	t.Active = false
+	t.RestoredBy = adminID
+	t.RestoredAt = time.Now()
+	if err := Takedowns.Update(t); err != nil {
+		return err
+	}
+
+	return setRemoved(t.SubjectType, t.SubjectID, false)
+}
+
+// setRemoved toggles online projects and apps to "removed" so the proxy
+// stops serving them
+func setRemoved(subjectType, subjectID string, removed bool) error {
+	from, to := "online", "removed"
+	if !removed {
+		from, to = to, from
+	}
+
+	switch subjectType {
+	case TakedownProject:
+		return DB.Query("UPDATE projects SET Status = ? WHERE ID = ? AND Status = ?", to, subjectID, from).Exec()
+	case TakedownApp:
+		return DB.Query("UPDATE apps SET Status = ? WHERE ID = ? AND Status = ?", to, subjectID, from).Exec()
+	}
+	return nil
+}
@@ -2,10 +2,16 @@ package models
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"html/template"
+	"os"
+	"time"
 
 	"github.com/The-Skyscape/devtools/pkg/application"
 	"github.com/The-Skyscape/devtools/pkg/authentication"
+	"www.theskyscape.com/internal/assets"
 	"www.theskyscape.com/internal/markup"
 )
 
@@ -14,23 +20,59 @@ type Thought struct {
 	application.Model
 	UserID        string
 	Title         string
-	Slug          string // URL-friendly slug
-	Published     bool   // Draft vs published
-	ViewsCount    int    // Cached view count
-	StarsCount    int    // Cached star count
-	HeaderImageID string // Optional header image file ID
+	Slug          string    // URL-friendly slug
+	Published     bool      // Draft vs published
+	PublishedAt   time.Time // When the thought was first published
+	ViewsCount    int       // Cached view count
+	StarsCount    int       // Cached star count, see CountStar
+	CommentTotal  int       // Cached comment count, see CountComment
+	HeaderImageID string    // Optional header image file ID
+	Version       int       // Bumped on every edit, see ClaimEdit
 }
 
 // HeaderImage returns the header image URL, or default background
 func (t *Thought) HeaderImage() string {
 	if t.HeaderImageID != "" {
-		return "/file/" + t.HeaderImageID
+		if url, ok := FileURL(t.HeaderImageID); ok {
+			return url
+		}
+	}
+	return assets.URL("background.png")
+}
+
+// FileVisibility returns the visibility images should have: drafts keep
+// their uploads private until the thought is published
+func (t *Thought) FileVisibility() string {
+	if t.Published {
+		return FilePublic
+	}
+	return FilePrivate
+}
+
+// SyncFileVisibility updates the header and block images to match the
+// thought's published state
+func (t *Thought) SyncFileVisibility() {
+	visibility := t.FileVisibility()
+	if t.HeaderImageID != "" {
+		if file, err := Files.Get(t.HeaderImageID); err == nil {
+			file.SetVisibility(visibility)
+		}
+	}
+
+	for _, block := range t.Blocks() {
+		if file := block.File(); file != nil {
+			file.SetVisibility(visibility)
+		}
 	}
-	return "/public/background.png"
 }
 
 func (*Thought) Table() string { return "thoughts" }
 
+// Takedown returns the active takedown for this thought, if any
+func (t *Thought) Takedown() *Takedown {
+	return ActiveTakedown(TakedownThought, t.ID)
+}
+
 // User returns the author of this thought
 func (t *Thought) User() *authentication.User {
 	user, err := Auth.Users.Get(t.UserID)
@@ -50,15 +92,18 @@ func (t *Thought) Profile() *Profile {
 }
 
 // Stars returns all stars on this thought
-func (t *Thought) Stars() []*ThoughtStar {
-	stars, _ := ThoughtStars.Search("WHERE ThoughtID = ?", t.ID)
-	return stars
+func (t *Thought) Stars() []*Star {
+	return StarsOf(StarThought, t.ID)
+}
+
+// RecentStargazers returns the most recent stars on this thought
+func (t *Thought) RecentStargazers(limit int) []*Star {
+	return RecentStars(StarThought, t.ID, limit)
 }
 
 // IsStarredBy returns true if the user has starred this thought
 func (t *Thought) IsStarredBy(userID string) bool {
-	star, _ := ThoughtStars.First("WHERE ThoughtID = ? AND UserID = ?", t.ID, userID)
-	return star != nil
+	return IsStarred(userID, StarThought, t.ID)
 }
 
 // Views returns all views on this thought
@@ -67,15 +112,24 @@ func (t *Thought) Views() []*ThoughtView {
 	return views
 }
 
-// RecordView records a view from a user (or anonymous via IP)
-func (t *Thought) RecordView(userID, ipAddress string) {
+// RecordView records a view from a user, or an anonymous reader by their
+// IP. Anonymous readers are only told apart by viewerHash, so the raw IP is
+// never stored. Pass an empty IP for readers who asked not to be tracked:
+// their views aren't recorded or counted.
+func (t *Thought) RecordView(userID, ip string) {
+	if userID == "" && ip == "" {
+		return
+	}
+
 	// Check if already viewed
 	var existing *ThoughtView
 	var err error
+	viewer := ""
 	if userID != "" {
 		existing, err = ThoughtViews.First("WHERE ThoughtID = ? AND UserID = ?", t.ID, userID)
 	} else {
-		existing, err = ThoughtViews.First("WHERE ThoughtID = ? AND IPAddress = ?", t.ID, ipAddress)
+		viewer = viewerHash(t.ID, ip)
+		existing, err = ThoughtViews.First("WHERE ThoughtID = ? AND IPAddress = ?", t.ID, viewer)
 	}
 
 	if err == nil && existing != nil {
@@ -86,7 +140,7 @@ func (t *Thought) RecordView(userID, ipAddress string) {
 	ThoughtViews.Insert(&ThoughtView{
 		ThoughtID: t.ID,
 		UserID:    userID,
-		IPAddress: ipAddress,
+		IPAddress: viewer,
 	})
 
 	// Update cached count
@@ -94,18 +148,38 @@ func (t *Thought) RecordView(userID, ipAddress string) {
 	Thoughts.Update(t)
 }
 
+// viewerHash identifies an anonymous reader of a thought without keeping
+// their IP. It's keyed by AUTH_SECRET so it can't be reversed by hashing
+// every address, and by the thought so readers can't be followed across
+// thoughts.
+func viewerHash(thoughtID, ip string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("AUTH_SECRET")))
+	mac.Write([]byte("view:" + thoughtID + ":" + ip))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// AnonymizeViews replaces raw IPs recorded before views were hashed, which
+// contain dots or colons that hashes never do. Those readers count again if
+// they return.
+func AnonymizeViews() error {
+	return DB.Query(`
+		UPDATE thought_views SET IPAddress = ''
+		WHERE IPAddress LIKE '%.%' OR IPAddress LIKE '%:%'
+	`).Exec()
+}
+
 // Comments returns all comments on this thought
 func (t *Thought) Comments() []*Comment {
 	comments, _ := Comments.Search(`
-		WHERE SubjectID = ?
+		WHERE SubjectType = ? AND SubjectID = ?
 		ORDER BY CreatedAt ASC
-	`, t.ID)
+	`, CommentThought, t.ID)
 	return comments
 }
 
 // CommentsCount returns the number of comments
 func (t *Thought) CommentsCount() int {
-	return Comments.Count("WHERE SubjectID = ?", t.ID)
+	return t.CommentTotal
 }
 
 // Blocks returns all blocks for this thought ordered by position
@@ -126,11 +200,11 @@ func (t *Thought) BlocksToMarkdown() string {
 
 		switch block.Type {
 		case "image":
-			if block.FileID != "" {
+			if file := block.File(); file != nil {
 				result.WriteString("![")
 				result.WriteString(block.Content) // Alt text/caption
-				result.WriteString("](/file/")
-				result.WriteString(block.FileID)
+				result.WriteString("](")
+				result.WriteString(file.URL())
 				result.WriteString(")")
 			}
 
@@ -153,22 +227,7 @@ type ThoughtView struct {
 	application.Model
 	ThoughtID string
 	UserID    string // Empty for anonymous views
-	IPAddress string
+	IPAddress string // Anonymous reader's viewerHash, never the raw IP
 }
 
 func (*ThoughtView) Table() string { return "thought_views" }
-
-// ThoughtStar represents a user starring a thought
-type ThoughtStar struct {
-	application.Model
-	ThoughtID string
-	UserID    string
-}
-
-func (*ThoughtStar) Table() string { return "thought_stars" }
-
-// User returns the user who starred
-func (s *ThoughtStar) User() *authentication.User {
-	user, _ := Auth.Users.Get(s.UserID)
-	return user
-}
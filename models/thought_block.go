@@ -1,6 +1,16 @@
 package models
 
-import "github.com/The-Skyscape/devtools/pkg/application"
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+)
+
+// ErrBlockConflict is returned when a block or the block order changed
+// since the editor loaded it, e.g. in another tab
+var ErrBlockConflict = errors.New("this thought was changed somewhere else, reload to get the latest version")
 
 // ThoughtBlock represents a content block within a thought
 type ThoughtBlock struct {
@@ -10,6 +20,7 @@ type ThoughtBlock struct {
 	Content   string // Markdown text or image caption
 	FileID    string // File reference for image blocks
 	Position  int    // Order within the thought
+	Version   int    // Bumped on every edit, for optimistic locking
 }
 
 func (*ThoughtBlock) Table() string { return "thought_blocks" }
@@ -25,3 +36,121 @@ func (b *ThoughtBlock) File() *File {
 	}
 	return file
 }
+
+// The database has no multi-statement transactions, so each block
+// operation below is built so every write is a single atomic statement and
+// any interleaving with another editor still leaves a consistent order.
+
+// InsertBlock adds a block to a thought at the block's Position, shifting
+// the blocks after it down. A Position of 0 or past the end appends.
+func InsertBlock(block *ThoughtBlock) (*ThoughtBlock, error) {
+	count := ThoughtBlocks.Count("WHERE ThoughtID = ?", block.ThoughtID)
+	if block.Position <= 0 || block.Position > count {
+		block.Position = count + 1
+	} else if err := DB.Query(`
+		UPDATE thought_blocks SET Position = Position + 1
+		WHERE ThoughtID = ? AND Position >= ?
+	`, block.ThoughtID, block.Position).Exec(); err != nil {
+		return nil, err
+	}
+
+	created, err := ThoughtBlocks.Insert(block)
+	if err != nil {
+		return nil, err
+	}
+	return created, renumberBlocks(block.ThoughtID)
+}
+
+// DeleteBlock removes a block and closes the gap it leaves
+func DeleteBlock(block *ThoughtBlock) error {
+	if err := ThoughtBlocks.Delete(block); err != nil {
+		return err
+	}
+	return renumberBlocks(block.ThoughtID)
+}
+
+// UpdateBlock saves the block's type, content and file if nobody else
+// saved it since version, bumping its Version
+func UpdateBlock(block *ThoughtBlock, version int) error {
+	var saved int
+	err := DB.Query(`
+		UPDATE thought_blocks
+		SET Type = ?, Content = ?, FileID = ?, Version = COALESCE(Version, 0) + 1, UpdatedAt = ?
+		WHERE ID = ? AND COALESCE(Version, 0) = ?
+		RETURNING Version
+	`, block.Type, block.Content, block.FileID, time.Now(), block.ID, version).Scan(&saved)
+	if err != nil {
+		if ThoughtBlocks.Count("WHERE ID = ?", block.ID) == 0 {
+			return application.ErrNotFound
+		}
+		return ErrBlockConflict
+	}
+	block.Version = saved
+	return nil
+}
+
+// ReorderBlocks puts a thought's blocks in the given order in one
+// statement. It only applies if blockIDs are exactly the thought's current
+// blocks, so a block added or deleted meanwhile is a conflict rather than
+// a corrupted order.
+func ReorderBlocks(thoughtID string, blockIDs []string) error {
+	if len(blockIDs) == 0 {
+		return nil
+	}
+
+	var (
+		cases strings.Builder
+		args  []any
+		ids   = strings.TrimSuffix(strings.Repeat("?,", len(blockIDs)), ",")
+	)
+	cases.WriteString("CASE ID")
+	for i, id := range blockIDs {
+		cases.WriteString(" WHEN ? THEN ?")
+		args = append(args, id, i+1)
+	}
+	cases.WriteString(" END")
+
+	args = append(args, thoughtID, thoughtID, len(blockIDs), thoughtID)
+	for _, id := range blockIDs {
+		args = append(args, id)
+	}
+	args = append(args, len(blockIDs))
+
+	if err := DB.Query(`
+		UPDATE thought_blocks SET Position = `+cases.String()+`
+		WHERE ThoughtID = ?
+			AND (SELECT COUNT(*) FROM thought_blocks WHERE ThoughtID = ?) = ?
+			AND (SELECT COUNT(DISTINCT ID) FROM thought_blocks WHERE ThoughtID = ? AND ID IN (`+ids+`)) = ?
+	`, args...).Exec(); err != nil {
+		return err
+	}
+
+	// Check the order took, since a mismatched set updates nothing
+	blocks, err := ThoughtBlocks.Search("WHERE ThoughtID = ? ORDER BY Position ASC", thoughtID)
+	if err != nil {
+		return err
+	}
+	if len(blocks) != len(blockIDs) {
+		return ErrBlockConflict
+	}
+	for i, block := range blocks {
+		if block.ID != blockIDs[i] {
+			return ErrBlockConflict
+		}
+	}
+	return nil
+}
+
+// renumberBlocks makes a thought's positions 1..n in their current order.
+// Blocks that two editors inserted at the same position at once keep the
+// order they were created in.
+func renumberBlocks(thoughtID string) error {
+	return DB.Query(`
+		UPDATE thought_blocks SET Position = ranked.Position
+		FROM (
+			SELECT ID, ROW_NUMBER() OVER (ORDER BY Position, CreatedAt, ID) AS Position
+			FROM thought_blocks WHERE ThoughtID = ?
+		) AS ranked
+		WHERE thought_blocks.ID = ranked.ID AND thought_blocks.Position != ranked.Position
+	`, thoughtID).Exec()
+}
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+)
+
+// Topic types a user can follow besides people
+const (
+	TopicRepo    = "repo"
+	TopicProject = "project"
+	TopicTag     = "tag"
+)
+
+// TopicTypes lists every kind of topic that can be followed
+var TopicTypes = []string{TopicRepo, TopicProject, TopicTag}
+
+// TopicFollow is a user following a repo, project or tag. Followed repos
+// and projects bring their pushes and deploys into the feed; followed tags
+// bring posts tagged with them.
+type TopicFollow struct {
+	application.Model
+	UserID    string
+	TopicType string // One of TopicTypes
+	TopicID   string // Repo or project ID, or lowercased tag
+}
+
+func (*TopicFollow) Table() string { return "topic_follows" }
+
+// FindTopicFollow returns a user's follow of a topic, or nil
+func FindTopicFollow(userID, topicType, topicID string) *TopicFollow {
+	follow, err := TopicFollows.First(`
+		WHERE UserID = ? AND TopicType = ? AND TopicID = ?
+	`, userID, topicType, topicID)
+	if err != nil {
+		return nil
+	}
+	return follow
+}
+
+// FollowsTopic returns true if the user follows the topic
+func FollowsTopic(userID, topicType, topicID string) bool {
+	return FindTopicFollow(userID, topicType, topicID) != nil
+}
+
+// TopicFollowersCount returns how many users follow a topic
+func TopicFollowersCount(topicType, topicID string) int {
+	return TopicFollows.Count("WHERE TopicType = ? AND TopicID = ?", topicType, topicID)
+}
+
+// FollowedTopics returns the topics a user follows, newest first
+func FollowedTopics(userID string) []*TopicFollow {
+	follows, _ := TopicFollows.Search(`
+		WHERE UserID = ?
+		ORDER BY CreatedAt DESC
+	`, userID)
+	return follows
+}
+
+// TopicActivities is a WHERE clause matching activities that reach a user
+// through followed topics: pushes and deploys on followed repos and
+// projects, and posts with followed tags. It takes the user ID twice.
+const TopicActivities = `(
+	(
+		SubjectType IN ('repo', 'project')
+		AND Action IN ('pushed', 'deployed', 'migrated')
+		AND SubjectType || ':' || SubjectID IN (
+			SELECT TopicType || ':' || TopicID FROM topic_follows WHERE UserID = ?
+		)
+	)
+	OR ID IN (
+		SELECT ActivityID FROM activity_tags
+		WHERE Tag IN (SELECT TopicID FROM topic_follows WHERE UserID = ? AND TopicType = 'tag')
+	)
+)`
+
+// ActivityTag links a post to a #tag in its content
+type ActivityTag struct {
+	application.Model
+	ActivityID string
+	Tag        string // Lowercased, without the #
+}
+
+func (*ActivityTag) Table() string { return "activity_tags" }
+
+// hashtagPattern matches #tag at the start of the text or after a space
+var hashtagPattern = regexp.MustCompile(`(?:^|\s)#([A-Za-z0-9_-]{1,50})`)
+
+// maxHashtags bounds the tags a single post gets
+const maxHashtags = 10
+
+// Hashtags returns the distinct lowercased #tags in text, in order
+func Hashtags(text string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, match := range hashtagPattern.FindAllStringSubmatch(text, -1) {
+		tag := strings.ToLower(match[1])
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		if tags = append(tags, tag); len(tags) == maxHashtags {
+			break
+		}
+	}
+	return tags
+}
+
+// NormalizeTag lowercases a tag and strips a leading #, returning "" if it
+// isn't a valid tag
+func NormalizeTag(tag string) string {
+	tags := Hashtags("#" + strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+	if len(tags) != 1 {
+		return ""
+	}
+	return tags[0]
+}
+
+// TagActivity records the #tags in an activity's content
+func TagActivity(a *Activity) {
+	for _, tag := range Hashtags(a.Content) {
+		ActivityTags.Insert(&ActivityTag{ActivityID: a.ID, Tag: tag})
+	}
+}
+
+// UntagActivity removes an activity's tags
+func UntagActivity(a *Activity) error {
+	return DB.Query("DELETE FROM activity_tags WHERE ActivityID = ?", a.ID).Exec()
+}
+
+// Hashtags returns the #tags in the activity's content
+func (a *Activity) Hashtags() []string {
+	return Hashtags(a.Content)
+}
@@ -0,0 +1,180 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+	"www.theskyscape.com/internal/totp"
+)
+
+// TwoFactorIssuer names the site in authenticator apps
+const TwoFactorIssuer = "The Skyscape"
+
+// RecoveryCodeCount is how many recovery codes a user gets at a time
+const RecoveryCodeCount = 10
+
+// ChallengeTTL is how long a user has to enter their code after their
+// password
+const ChallengeTTL = 10 * time.Minute
+
+// TwoFactorSecret is a user's authenticator app enrollment. It's created
+// when they start setting 2FA up and only enforced once a code from the app
+// has been confirmed.
+type TwoFactorSecret struct {
+	application.Model
+	UserID        string
+	Secret        string // Base32 TOTP secret
+	Enabled       bool
+	EnabledAt     time.Time
+	LastStep      int64  // Last TOTP step accepted, so codes can't be replayed
+	RecoveryCodes string // JSON list of SHA-256 hashes of unused codes
+}
+
+func (*TwoFactorSecret) Table() string {
+	return "two_factor_secrets"
+}
+
+// TwoFactorFor returns a user's enrollment, enabled or pending, or nil
+func TwoFactorFor(userID string) *TwoFactorSecret {
+	secret, err := TwoFactorSecrets.First("WHERE UserID = ?", userID)
+	if err != nil {
+		return nil
+	}
+	return secret
+}
+
+// TwoFactorEnabled reports whether a user must enter a code to sign in
+func TwoFactorEnabled(userID string) bool {
+	secret := TwoFactorFor(userID)
+	return secret != nil && secret.Enabled
+}
+
+// StartTwoFactor creates a new pending enrollment for the user, replacing
+// any earlier one they didn't finish
+func StartTwoFactor(userID string) (*TwoFactorSecret, error) {
+	if existing := TwoFactorFor(userID); existing != nil {
+		if existing.Enabled {
+			return nil, errors.New("two-factor authentication is already enabled")
+		}
+		existing.Secret = totp.NewSecret()
+		existing.LastStep = 0
+		return existing, TwoFactorSecrets.Update(existing)
+	}
+
+	return TwoFactorSecrets.Insert(&TwoFactorSecret{
+		UserID: userID,
+		Secret: totp.NewSecret(),
+	})
+}
+
+// URI returns the otpauth:// link for the user's authenticator app
+func (s *TwoFactorSecret) URI(account string) string {
+	return totp.URI(TwoFactorIssuer, account, s.Secret)
+}
+
+// Verify checks a code from the authenticator app. Each code works once.
+func (s *TwoFactorSecret) Verify(code string) bool {
+	step, ok := totp.Validate(s.Secret, code, time.Now())
+	if !ok || step <= s.LastStep {
+		return false
+	}
+
+	s.LastStep = step
+	return TwoFactorSecrets.Update(s) == nil
+}
+
+// Enable turns 2FA on and returns the user's first recovery codes
+func (s *TwoFactorSecret) Enable() ([]string, error) {
+	s.Enabled = true
+	s.EnabledAt = time.Now()
+	return s.RegenerateRecoveryCodes()
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes. The codes are
+// only returned here; just their hashes are kept.
+func (s *TwoFactorSecret) RegenerateRecoveryCodes() ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		rand.Read(b)
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	data, _ := json.Marshal(hashes)
+	s.RecoveryCodes = string(data)
+	return codes, TwoFactorSecrets.Update(s)
+}
+
+// UseRecoveryCode checks a recovery code and crosses it off if it's valid
+func (s *TwoFactorSecret) UseRecoveryCode(code string) bool {
+	var hashes []string
+	json.Unmarshal([]byte(s.RecoveryCodes), &hashes)
+
+	hash := hashRecoveryCode(code)
+	for i, h := range hashes {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+			hashes = append(hashes[:i], hashes[i+1:]...)
+			data, _ := json.Marshal(hashes)
+			s.RecoveryCodes = string(data)
+			return TwoFactorSecrets.Update(s) == nil
+		}
+	}
+	return false
+}
+
+// RecoveryCodesLeft returns how many recovery codes haven't been used
+func (s *TwoFactorSecret) RecoveryCodesLeft() int {
+	var hashes []string
+	json.Unmarshal([]byte(s.RecoveryCodes), &hashes)
+	return len(hashes)
+}
+
+// hashRecoveryCode normalizes a code as typed and hashes it
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// TwoFactorChallenge is a sign-in waiting on a user's second factor. Its
+// ID is handed to the browser once the password checks out.
+type TwoFactorChallenge struct {
+	application.Model
+	UserID    string
+	Next      string // Where to go after signing in
+	ExpiresAt time.Time
+}
+
+func (*TwoFactorChallenge) Table() string {
+	return "two_factor_challenges"
+}
+
+// NewTwoFactorChallenge starts the second step of a user's sign-in
+func NewTwoFactorChallenge(userID, next string) (*TwoFactorChallenge, error) {
+	DB.Query("DELETE FROM two_factor_challenges WHERE ExpiresAt < ?", time.Now()).Exec()
+	return TwoFactorChallenges.Insert(&TwoFactorChallenge{
+		UserID:    userID,
+		Next:      next,
+		ExpiresAt: time.Now().Add(ChallengeTTL),
+	})
+}
+
+// FindTwoFactorChallenge returns an unexpired challenge
+func FindTwoFactorChallenge(id string) (*TwoFactorChallenge, error) {
+	challenge, err := TwoFactorChallenges.Get(id)
+	if err != nil || time.Now().After(challenge.ExpiresAt) {
+		return nil, errors.New("sign-in expired, please sign in again")
+	}
+	return challenge, nil
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"github.com/The-Skyscape/devtools/pkg/application"
+)
+
+// Advisory severities, worst first
+const (
+	SeverityCritical = "critical"
+	SeverityHigh     = "high"
+	SeverityModerate = "moderate"
+	SeverityLow      = "low"
+	SeverityUnknown  = "unknown"
+)
+
+// VulnerabilityAlert is a known advisory affecting a dependency of a
+// project's latest build
+type VulnerabilityAlert struct {
+	application.Model
+	ProjectID  string
+	GitHash    string // Build the dependency was found in
+	Ecosystem  string // "Go" or "npm"
+	Package    string
+	Version    string
+	AdvisoryID string // e.g. "GHSA-..." or "GO-2024-..."
+	Summary    string
+	Severity   string
+	FixedIn    string // First fixed version, if known
+}
+
+func (*VulnerabilityAlert) Table() string { return "vulnerability_alerts" }
+
+// URL links to the advisory on osv.dev
+func (a *VulnerabilityAlert) URL() string {
+	return "https://osv.dev/vulnerability/" + a.AdvisoryID
+}
+
+// VulnerabilityAlerts returns the project's open alerts, most severe first
+func (p *Project) VulnerabilityAlerts() []*VulnerabilityAlert {
+	alerts, _ := VulnerabilityAlerts.Search(`
+		WHERE ProjectID = ?
+		ORDER BY CASE Severity
+			WHEN 'critical' THEN 0
+			WHEN 'high' THEN 1
+			WHEN 'moderate' THEN 2
+			WHEN 'low' THEN 3
+			ELSE 4 END, Package
+	`, p.ID)
+	return alerts
+}
@@ -0,0 +1,167 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/The-Skyscape/devtools/pkg/application"
+)
+
+// Webhook events
+const (
+	WebhookPush            = "push"
+	WebhookDeploySucceeded = "deploy.succeeded"
+	WebhookDeployFailed    = "deploy.failed"
+	WebhookFollow          = "follow"
+	WebhookComment         = "comment"
+	WebhookPing            = "ping" // Sent by the test button, to every hook
+)
+
+// WebhookEvents lists the events a webhook can subscribe to, in the order
+// settings shows them
+var WebhookEvents = []string{WebhookPush, WebhookDeploySucceeded, WebhookDeployFailed, WebhookFollow, WebhookComment}
+
+// Webhook scopes. Account hooks receive events for everything the user
+// owns; repo and project hooks only those about their subject.
+const (
+	WebhookAccount = "account"
+	WebhookRepo    = "repo"
+	WebhookProject = "project"
+)
+
+// MaxWebhooks bounds how many webhooks a user can register
+const MaxWebhooks = 20
+
+// WebhookDisableAfter is how many deliveries in a row can fail for good
+// before the webhook is turned off
+const WebhookDisableAfter = 10
+
+// webhookSecretPrefix marks signing secrets in environment files
+const webhookSecretPrefix = "whsec_"
+
+// Webhook posts signed JSON to a URL of the user's when events happen
+type Webhook struct {
+	application.Model
+	UserID        string
+	SubjectType   string // One of WebhookAccount, WebhookRepo or WebhookProject
+	SubjectID     string // Repo or project ID, "" for account hooks
+	URL           string
+	Events        string // Comma-separated WebhookEvents
+	SecretVersion int    // Bumped to rotate the signing secret
+	Disabled      bool   // Turned off after WebhookDisableAfter failures
+	Failures      int    // Deliveries in a row that failed for good
+	LastStatus    int    // HTTP status of the most recent attempt, 0 if it didn't connect
+	LastAttemptAt time.Time
+}
+
+func (*Webhook) Table() string { return "webhooks" }
+
+// Subscribes reports whether the webhook wants an event. Every hook gets
+// pings.
+func (h *Webhook) Subscribes(event string) bool {
+	return event == WebhookPing || slices.Contains(h.EventList(), event)
+}
+
+// EventList returns the events the webhook subscribes to
+func (h *Webhook) EventList() []string {
+	if h.Events == "" {
+		return nil
+	}
+	return strings.Split(h.Events, ",")
+}
+
+// Secret returns the key deliveries are signed with. Like service tokens
+// it's derived from the ID and version with AUTH_SECRET, so nothing secret
+// is stored and rotating only bumps the version.
+func (h *Webhook) Secret() string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("AUTH_SECRET")))
+	mac.Write([]byte("webhook:" + h.ID + ":" + strconv.Itoa(h.SecretVersion)))
+	return webhookSecretPrefix + hex.EncodeToString(mac.Sum(nil))[:40]
+}
+
+// Subject describes what the webhook receives events for
+func (h *Webhook) Subject() string {
+	switch h.SubjectType {
+	case WebhookRepo:
+		if repo, err := Repos.Get(h.SubjectID); err == nil {
+			return "Repo " + repo.Name
+		}
+	case WebhookProject:
+		if project, err := Projects.Get(h.SubjectID); err == nil {
+			return "Project " + project.Name
+		}
+	case WebhookAccount:
+		return "Account"
+	}
+	return h.SubjectType + " " + h.SubjectID
+}
+
+// Deliveries returns the webhook's most recent deliveries, newest first
+func (h *Webhook) Deliveries(limit int) []*WebhookDelivery {
+	deliveries, _ := WebhookDeliveries.Search(`
+		WHERE WebhookID = ?
+		ORDER BY CreatedAt DESC
+		LIMIT ?
+	`, h.ID, limit)
+	return deliveries
+}
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending" // Waiting for its first or next attempt
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed" // Out of attempts
+)
+
+// DeliveryRetries are the waits before each retry of a failed delivery
+var DeliveryRetries = []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour, 8 * time.Hour}
+
+// WebhookDelivery is one event sent, or to be sent, to a webhook. The
+// payload is kept so it can be redelivered exactly as it was.
+type WebhookDelivery struct {
+	application.Model
+	WebhookID     string
+	Event         string
+	Payload       string // JSON body
+	Status        string // One of the Delivery* statuses
+	Attempts      int
+	NextAttemptAt time.Time
+	ResponseCode  int    // 0 when the request didn't get a response
+	ResponseBody  string // Start of the body, for debugging
+	Error         string
+	DurationMS    int
+}
+
+func (*WebhookDelivery) Table() string { return "webhook_deliveries" }
+
+// Webhook returns the hook the delivery is for
+func (d *WebhookDelivery) Webhook() *Webhook {
+	hook, _ := Webhooks.Get(d.WebhookID)
+	return hook
+}
+
+// WebhooksFor returns the user's active webhooks that want an event about
+// a subject: their account hooks, plus hooks on the repo or project itself
+func WebhooksFor(userID, subjectType, subjectID, event string) []*Webhook {
+	hooks, err := Webhooks.Search(`
+		WHERE UserID = ? AND Disabled = false
+		  AND (SubjectType = ? OR (SubjectType = ? AND SubjectID = ?))
+	`, userID, WebhookAccount, subjectType, subjectID)
+	if err != nil {
+		return nil
+	}
+
+	var subscribed []*Webhook
+	for _, hook := range hooks {
+		if hook.Subscribes(event) {
+			subscribed = append(subscribed, hook)
+		}
+	}
+	return subscribed
+}
@@ -70,6 +70,56 @@
     setTimeout(() => toast.remove(), 4000);
   };
 
+  // ============================================
+  // Real-time Events
+  // ============================================
+
+  /**
+   * Open the signed-in user's event stream. Each event is re-dispatched on
+   * document.body as "skyscape:<kind>" so HTMX elements can refresh on it,
+   * e.g. hx-trigger="skyscape:message from:body". EventSource reconnects on
+   * its own, and HTMX navigation keeps the one connection open.
+   */
+  function connectEvents() {
+    const meta = document.querySelector('meta[name="skyscape-events"]');
+    if (!meta || !('EventSource' in window) || window.Skyscape.events) return;
+
+    const source = new EventSource(meta.content);
+    ['message', 'notification', 'build'].forEach(kind => {
+      source.addEventListener(kind, (e) => {
+        let detail = {};
+        try { detail = JSON.parse(e.data); } catch { /* ignore */ }
+        document.body.dispatchEvent(new CustomEvent('skyscape:' + kind, { detail, bubbles: true }));
+      });
+    });
+    window.Skyscape.events = source;
+  }
+
+  document.addEventListener('DOMContentLoaded', connectEvents);
+
+  // Show notifications in-app, unless they link to the page already open
+  document.addEventListener('skyscape:notification', (e) => {
+    const { title, body, url } = e.detail;
+    if (!title || (url && url === window.location.pathname)) return;
+
+    const link = document.createElement('a');
+    link.className = 'alert alert-info flex flex-col items-start gap-0 max-w-sm';
+    link.href = url || '#';
+    const heading = document.createElement('span');
+    heading.className = 'font-bold';
+    heading.textContent = title;
+    const text = document.createElement('span');
+    text.className = 'text-sm opacity-80 line-clamp-2';
+    text.textContent = body || '';
+    link.append(heading, text);
+
+    const toast = document.createElement('div');
+    toast.className = 'toast toast-end z-[100]';
+    toast.appendChild(link);
+    document.body.appendChild(toast);
+    setTimeout(() => toast.remove(), 6000);
+  });
+
   // ============================================
   // Service Worker Registration
   // ============================================
@@ -351,6 +401,44 @@
     }
   };
 
+  /**
+   * Re-send the push subscription once a day so the server knows this
+   * device is still in use. If it was revoked from settings, unsubscribe.
+   */
+  async function checkInPush() {
+    if (!document.querySelector('meta[name="skyscape-events"]')) return;
+    if (!('serviceWorker' in navigator) || !('PushManager' in window)) return;
+    if (!('Notification' in window) || Notification.permission !== 'granted') return;
+
+    const last = Number(getStorageItem('push-checkin') || 0);
+    if (Date.now() - last < 24 * 60 * 60 * 1000) return;
+
+    try {
+      const registration = await navigator.serviceWorker.ready;
+      const subscription = await registration.pushManager.getSubscription();
+      if (!subscription) return;
+
+      const resp = await fetch('/api/push/subscribe?checkin=1', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        credentials: 'same-origin',
+        body: JSON.stringify(subscription)
+      });
+      if (!resp.ok) return;
+
+      const { status } = await resp.json();
+      if (status === 'revoked') {
+        await subscription.unsubscribe();
+        console.log('[Push] Device was revoked, unsubscribed');
+      }
+      setStorageItem('push-checkin', String(Date.now()));
+    } catch (err) {
+      console.warn('[Push] Check-in failed:', err);
+    }
+  }
+
+  document.addEventListener('DOMContentLoaded', checkInPush);
+
   /**
    * Check if push is supported and user is subscribed
    */
@@ -364,6 +452,87 @@
     return subscription !== null;
   };
 
+  // ============================================
+  // Passkeys
+  // ============================================
+
+  function base64urlToBuffer(value) {
+    return urlBase64ToUint8Array(value).buffer;
+  }
+
+  function bufferToBase64url(buffer) {
+    let binary = '';
+    for (const byte of new Uint8Array(buffer)) {
+      binary += String.fromCharCode(byte);
+    }
+    return window.btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+  }
+
+  /**
+   * POST JSON to a passkey endpoint, throwing the server's error message
+   */
+  async function passkeyRequest(url, body) {
+    const resp = await fetch(url, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      credentials: 'same-origin',
+      body: JSON.stringify(body || {})
+    });
+    const data = await resp.json();
+    if (!resp.ok) {
+      throw new Error(data.error || 'Passkey request failed');
+    }
+    return data;
+  }
+
+  /**
+   * Whether this browser can use passkeys
+   */
+  window.Skyscape.passkeysSupported = function() {
+    return !!(window.PublicKeyCredential && navigator.credentials);
+  };
+
+  /**
+   * Create a passkey for the signed-in user and save it
+   */
+  window.Skyscape.registerPasskey = async function(name) {
+    const options = await passkeyRequest('/_auth/passkeys/register/options');
+    const challenge = options.challenge;
+    options.challenge = base64urlToBuffer(options.challenge);
+    options.user.id = base64urlToBuffer(options.user.id);
+    options.excludeCredentials = options.excludeCredentials.map(c => ({ ...c, id: base64urlToBuffer(c.id) }));
+
+    const credential = await navigator.credentials.create({ publicKey: options });
+    const { redirect } = await passkeyRequest('/_auth/passkeys/register', {
+      challenge,
+      name,
+      id: credential.id,
+      clientDataJSON: bufferToBase64url(credential.response.clientDataJSON),
+      attestationObject: bufferToBase64url(credential.response.attestationObject)
+    });
+    window.location.href = redirect;
+  };
+
+  /**
+   * Sign in with any passkey this device has for the site
+   */
+  window.Skyscape.signinWithPasskey = async function(next) {
+    const options = await passkeyRequest('/_auth/passkeys/signin/options');
+    const challenge = options.challenge;
+    options.challenge = base64urlToBuffer(options.challenge);
+
+    const credential = await navigator.credentials.get({ publicKey: options });
+    const { redirect } = await passkeyRequest('/_auth/passkeys/signin', {
+      challenge,
+      next,
+      id: credential.id,
+      clientDataJSON: bufferToBase64url(credential.response.clientDataJSON),
+      authenticatorData: bufferToBase64url(credential.response.authenticatorData),
+      signature: bufferToBase64url(credential.response.signature)
+    });
+    window.location.href = redirect;
+  };
+
   // ============================================
   // Cookie Consent Banner
   // ============================================